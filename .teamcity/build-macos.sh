@@ -26,6 +26,10 @@ export PATH="$PATH:/usr/local/bin"
 mkdir -p ../src/github.com/cloudflare/    
 cp -r . ../src/github.com/cloudflare/cloudflared
 cd ../src/github.com/cloudflare/cloudflared 
+# The public keys the binary verifies the signature of updates with, passed to make from the release environment
+if [[ -z "$UPDATE_PUBLIC_KEYS" ]]; then
+    echo "UPDATE_PUBLIC_KEYS isn't set, the binary won't verify the signature of updates" >&2
+fi
 GOCACHE="$PWD/../../../../" GOPATH="$PWD/../../../../" CGO_ENABLED=1 make cloudflared
 
 # Add code signing private key to the key chain
@@ -1,6 +1,11 @@
 VERSION=$(git describe --tags --always --match "[0-9][0-9][0-9][0-9].*.*")
 echo $VERSION
 
+# The public keys release binaries verify the signature of updates with, passed to make from the release environment
+if [[ -z "$UPDATE_PUBLIC_KEYS" ]]; then
+    echo "UPDATE_PUBLIC_KEYS isn't set, the binaries won't verify the signature of updates" >&2
+fi
+
 # This controls the directory the built artifacts go into
 export ARTIFACT_DIR=built_artifacts/
 mkdir -p $ARTIFACT_DIR
@@ -31,6 +31,8 @@ type StartOptions struct {
 	Headers         http.Header
 	Host            string
 	TLSClientConfig *tls.Config
+	// Optional service tokens authenticating with Access instead of Headers, see ServiceTokenFile
+	ServiceTokens ServiceTokens
 }
 
 // Connection wraps up all the needed functions to forward over the tunnel
@@ -54,6 +56,11 @@ func (c *StdinoutStream) Write(p []byte) (int, error) {
 	return os.Stdout.Write(p)
 }
 
+// CloseWrite closes Stdout, so that the reading process knows no more data is coming
+func (c *StdinoutStream) CloseWrite() error {
+	return os.Stdout.Close()
+}
+
 // Helper to allow deferring the response close with a check that the resp is not nil
 func closeRespBody(resp *http.Response) {
 	if resp != nil {
@@ -0,0 +1,136 @@
+package carrier
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	cfwebsocket "github.com/cloudflare/cloudflared/websocket"
+)
+
+// ErrDaemonUnavailable is returned by StartDaemonClient when no daemon listens on the socket
+var ErrDaemonUnavailable = errors.New("access daemon is not running")
+
+// daemonRequest is the first line a client sends to the daemon, as JSON, before the data of its stream
+type daemonRequest struct {
+	OriginURL string      `json:"originURL"`
+	Host      string      `json:"host,omitempty"`
+	Headers   http.Header `json:"headers,omitempty"`
+}
+
+// daemonResponse is the line the daemon answers with, as JSON, before the data of the origin
+type daemonResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// ServeDaemon accepts connections of clients started with StartDaemonClient on listener, and carries each one
+// over a connection of pool until shutdownC is closed. `ServeDaemon` always closes `listener` and `pool`.
+func ServeDaemon(pool *Pool, listener net.Listener, shutdownC <-chan struct{}, log *zerolog.Logger) error {
+	defer pool.Close()
+	defer listener.Close()
+	errChan := make(chan error, 1)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				errChan <- err
+				return
+			}
+			go serveDaemonConnection(pool, conn, log)
+		}
+	}()
+
+	select {
+	case <-shutdownC:
+		return nil
+	case err := <-errChan:
+		return err
+	}
+}
+
+func serveDaemonConnection(pool *Pool, conn net.Conn, log *zerolog.Logger) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	var request daemonRequest
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to read the request of a daemon client")
+		return
+	}
+	if err := json.Unmarshal(line, &request); err != nil {
+		log.Debug().Err(err).Msg("Invalid request from a daemon client")
+		return
+	}
+
+	options := &StartOptions{
+		OriginURL: request.OriginURL,
+		Host:      request.Host,
+		Headers:   request.Headers,
+	}
+	if options.Headers == nil {
+		options.Headers = make(http.Header)
+	}
+	wsConn, err := pool.Get(options)
+	if err != nil {
+		log.Err(err).Str(LogFieldOriginURL, options.OriginURL).Msg("failed to connect to origin")
+		_ = json.NewEncoder(conn).Encode(daemonResponse{Error: err.Error()})
+		return
+	}
+	defer wsConn.Close()
+	if err := json.NewEncoder(conn).Encode(daemonResponse{}); err != nil {
+		return
+	}
+
+	cfwebsocket.StreamHalfClose(wsConn, &bufferedConn{Reader: reader, Writer: conn}, log)
+}
+
+// StartDaemonClient asks the daemon listening on socketPath to carry the data of stream to the origin of options
+func StartDaemonClient(socketPath string, stream io.ReadWriter, options *StartOptions, log *zerolog.Logger) error {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDaemonUnavailable, err)
+	}
+	defer conn.Close()
+
+	request := daemonRequest{OriginURL: options.OriginURL, Host: options.Host, Headers: options.Headers}
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return errors.Wrap(err, "failed to send request to the access daemon")
+	}
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return errors.Wrap(err, "failed to read the response of the access daemon")
+	}
+	var response daemonResponse
+	if err := json.Unmarshal(line, &response); err != nil {
+		return errors.Wrap(err, "invalid response from the access daemon")
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+
+	cfwebsocket.StreamHalfClose(&bufferedConn{Reader: reader, Writer: conn}, stream, log)
+	return nil
+}
+
+// bufferedConn reads a connection through the reader that consumed its first line
+type bufferedConn struct {
+	io.Reader
+	io.Writer
+}
+
+// CloseWrite half-closes the connection, so that the end of the data of a stream is passed on through the daemon
+func (c *bufferedConn) CloseWrite() error {
+	if conn, ok := c.Writer.(interface{ CloseWrite() error }); ok {
+		return conn.CloseWrite()
+	}
+	return errors.New("the connection can't be half-closed")
+}
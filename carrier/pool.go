@@ -0,0 +1,335 @@
+package carrier
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/h2mux"
+	cfwebsocket "github.com/cloudflare/cloudflared/websocket"
+)
+
+const (
+	PoolSizeDefault        = 2
+	PoolIdleTimeoutDefault = 30 * time.Second
+)
+
+// Pool multiplexes the streams to an origin over one authenticated WebSocket connection, so that a stream can be
+// carried without waiting for the TLS handshake and Access authentication. When cloudflared in front of the origin
+// doesn't multiplex streams, the pool keeps connections open ahead of time instead. Those connections are closed once
+// they stay idle for longer than the idle timeout, as origins such as SSH servers drop connections that don't start a
+// session.
+type Pool struct {
+	size        int
+	idleTimeout time.Duration
+	log         *zerolog.Logger
+	dial        func(options *StartOptions) (io.ReadWriteCloser, error)
+
+	lock    sync.Mutex
+	origins map[string]*originPool
+	closed  bool
+}
+
+type originPool struct {
+	// Kept across connections so the Access application is only looked up once
+	options *StartOptions
+	idle    []*idleConn
+	dialing int
+	// muxer carries the streams to the origin once cloudflared in front of it accepted to multiplex them
+	muxer *h2mux.Muxer
+	// muxUnsupported is set once cloudflared in front of the origin declined to multiplex streams
+	muxUnsupported bool
+	// muxLock makes sure a single muxer is connected at a time
+	muxLock sync.Mutex
+}
+
+type idleConn struct {
+	conn  io.ReadWriteCloser
+	timer *time.Timer
+}
+
+// NewPool creates a pool keeping up to size idle connections to each origin it was asked for that doesn't multiplex
+// streams
+func NewPool(size int, idleTimeout time.Duration, log *zerolog.Logger) *Pool {
+	return &Pool{
+		size:        size,
+		idleTimeout: idleTimeout,
+		log:         log,
+		dial: func(options *StartOptions) (io.ReadWriteCloser, error) {
+			return createWebsocketStream(options, log)
+		},
+		origins: make(map[string]*originPool),
+	}
+}
+
+// Get returns a stream multiplexed over the connection to the origin of options. If the origin doesn't multiplex
+// streams, it returns an idle connection, or a new one if there's none, and opens new idle connections in the
+// background to replace it.
+func (p *Pool) Get(options *StartOptions) (io.ReadWriteCloser, error) {
+	key := poolKey(options)
+
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return nil, errors.New("connection pool is closed")
+	}
+	origin, ok := p.origins[key]
+	if !ok {
+		copied := *options
+		origin = &originPool{options: &copied}
+		p.origins[key] = origin
+	}
+	muxUnsupported := origin.muxUnsupported
+	p.lock.Unlock()
+
+	if !muxUnsupported {
+		if stream, err := p.openStream(origin); stream != nil || err != nil {
+			return stream, err
+		}
+	}
+	return p.getIdle(origin)
+}
+
+// openStream opens a stream multiplexed over the connection to origin, connecting it if needed. It returns neither a
+// stream nor an error if the origin doesn't multiplex streams, or the connection if it just found out.
+func (p *Pool) openStream(origin *originPool) (io.ReadWriteCloser, error) {
+	muxer, conn, err := p.connectMuxer(origin, false)
+	if muxer == nil {
+		return conn, err
+	}
+	stream, err := muxer.OpenStream(context.Background(), cfwebsocket.MuxRequestHeaders, nil)
+	if err != nil {
+		// The connection may have been lost since the last stream, without the heartbeats noticing yet
+		p.log.Debug().Err(err).Str(LogFieldOriginURL, origin.options.OriginURL).Msg("Failed to open a stream, connecting again")
+		p.dropMuxer(origin, muxer)
+		if muxer, conn, err = p.connectMuxer(origin, true); muxer == nil {
+			return conn, err
+		}
+		if stream, err = muxer.OpenStream(context.Background(), cfwebsocket.MuxRequestHeaders, nil); err != nil {
+			return nil, err
+		}
+	}
+	if !cfwebsocket.IsMuxStreamConnected(stream) {
+		_ = stream.Close()
+		return nil, errors.Errorf("cloudflared couldn't connect to the origin of %s", origin.options.OriginURL)
+	}
+	return stream, nil
+}
+
+// connectMuxer returns the muxer of origin, connecting it if there's none or if reconnect is set. If cloudflared in
+// front of the origin doesn't multiplex streams, the connection is returned instead to carry a single stream.
+func (p *Pool) connectMuxer(origin *originPool, reconnect bool) (*h2mux.Muxer, io.ReadWriteCloser, error) {
+	origin.muxLock.Lock()
+	defer origin.muxLock.Unlock()
+
+	p.lock.Lock()
+	muxer, muxUnsupported := origin.muxer, origin.muxUnsupported
+	p.lock.Unlock()
+	if muxUnsupported || (muxer != nil && !reconnect) {
+		return muxer, nil, nil
+	}
+
+	conn, err := p.dialOrigin(origin, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subprotocolConn, ok := conn.(interface{ Subprotocol() string }); !ok || subprotocolConn.Subprotocol() != cfwebsocket.MuxSubprotocol {
+		p.log.Debug().Str(LogFieldOriginURL, origin.options.OriginURL).Msg("The origin doesn't multiplex streams, keeping idle connections to it instead")
+		p.lock.Lock()
+		origin.muxUnsupported = true
+		p.lock.Unlock()
+		p.refill(origin)
+		return nil, conn, nil
+	}
+	if muxer, err = cfwebsocket.NewClientMuxer(conn, p.log); err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		_ = conn.Close()
+		return nil, nil, errors.New("connection pool is closed")
+	}
+	origin.muxer = muxer
+	go func() {
+		err := muxer.Serve(context.Background())
+		p.log.Debug().Err(err).Str(LogFieldOriginURL, origin.options.OriginURL).Msg("Multiplexed connection closed")
+		p.dropMuxer(origin, muxer)
+	}()
+	return muxer, nil, nil
+}
+
+func (p *Pool) dropMuxer(origin *originPool, muxer *h2mux.Muxer) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if origin.muxer == muxer {
+		origin.muxer = nil
+	}
+}
+
+// getIdle returns an idle connection to origin, or a new one if there's none, and opens new idle connections in the
+// background to replace it
+func (p *Pool) getIdle(origin *originPool) (io.ReadWriteCloser, error) {
+	p.lock.Lock()
+	var conn io.ReadWriteCloser
+	for conn == nil && len(origin.idle) > 0 {
+		idle := origin.idle[0]
+		origin.idle = origin.idle[1:]
+		// The timer already closed the connection if it can't be stopped
+		if idle.timer.Stop() {
+			conn = idle.conn
+		}
+	}
+	p.lock.Unlock()
+
+	if conn == nil {
+		var err error
+		if conn, err = p.dialOrigin(origin, false); err != nil {
+			return nil, err
+		}
+	}
+	p.refill(origin)
+	return conn, nil
+}
+
+// Close closes the idle connections, connections and streams returned by Get are left to their users
+func (p *Pool) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.closed = true
+	for _, origin := range p.origins {
+		// The multiplexed connection is closed once its last stream is
+		if origin.muxer != nil {
+			origin.muxer.Shutdown()
+		}
+		for _, idle := range origin.idle {
+			if idle.timer.Stop() {
+				_ = idle.conn.Close()
+			}
+		}
+		origin.idle = nil
+	}
+}
+
+func (p *Pool) refill(origin *originPool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for ; !p.closed && len(origin.idle)+origin.dialing < p.size; origin.dialing++ {
+		go func() {
+			conn, err := p.dialOrigin(origin, false)
+			p.lock.Lock()
+			defer p.lock.Unlock()
+
+			origin.dialing--
+			if err != nil {
+				p.log.Debug().Err(err).Str(LogFieldOriginURL, origin.options.OriginURL).Msg("Failed to open idle connection")
+				return
+			}
+			if p.closed {
+				_ = conn.Close()
+				return
+			}
+			idle := &idleConn{conn: conn}
+			idle.timer = time.AfterFunc(p.idleTimeout, func() {
+				p.expire(origin, idle)
+			})
+			origin.idle = append(origin.idle, idle)
+		}()
+	}
+}
+
+func (p *Pool) expire(origin *originPool, expired *idleConn) {
+	p.lock.Lock()
+	for i, idle := range origin.idle {
+		if idle == expired {
+			origin.idle = append(origin.idle[:i], origin.idle[i+1:]...)
+			break
+		}
+	}
+	p.lock.Unlock()
+	_ = expired.conn.Close()
+}
+
+// dialOrigin opens a connection with a copy of the origin options, as they are updated with the Access application
+// when the origin turns out to be protected by Access. With mux, it offers cloudflared to multiplex streams over it.
+func (p *Pool) dialOrigin(origin *originPool, mux bool) (io.ReadWriteCloser, error) {
+	p.lock.Lock()
+	options := *origin.options
+	options.Headers = origin.options.Headers.Clone()
+	p.lock.Unlock()
+	if mux {
+		if options.Headers == nil {
+			options.Headers = make(http.Header)
+		}
+		options.Headers.Set("Sec-WebSocket-Protocol", cfwebsocket.MuxSubprotocol)
+	}
+
+	conn, err := p.dial(&options)
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	if options.AppInfo != nil {
+		origin.options.AppInfo = options.AppInfo
+	}
+	p.lock.Unlock()
+	return conn, nil
+}
+
+// poolKey identifies the origin and headers of a connection, connections are only shared between streams sending the
+// same headers as they may carry different credentials or bastion destinations
+func poolKey(options *StartOptions) string {
+	var b strings.Builder
+	b.WriteString(options.OriginURL)
+	b.WriteString("\n")
+	b.WriteString(options.Host)
+	keys := make([]string, 0, len(options.Headers))
+	for key := range options.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.WriteString("\n")
+		b.WriteString(http.CanonicalHeaderKey(key))
+		b.WriteString(": ")
+		b.WriteString(strings.Join(options.Headers[key], ","))
+	}
+	return b.String()
+}
+
+// pooledConnection carries streams over connections of a Pool
+type pooledConnection struct {
+	pool *Pool
+	log  *zerolog.Logger
+}
+
+// NewPooledConnection returns a connection carrying streams over connections of pool
+func NewPooledConnection(pool *Pool, log *zerolog.Logger) Connection {
+	return &pooledConnection{pool: pool, log: log}
+}
+
+// ServeStream carries the data of conn over a stream multiplexed over a pooled WebSocket connection, or over a
+// pooled WebSocket connection of its own
+func (c *pooledConnection) ServeStream(options *StartOptions, conn io.ReadWriter) error {
+	wsConn, err := c.pool.Get(options)
+	if err != nil {
+		c.log.Err(err).Str(LogFieldOriginURL, options.OriginURL).Msg("failed to connect to origin")
+		return err
+	}
+	defer wsConn.Close()
+
+	cfwebsocket.StreamHalfClose(wsConn, conn, c.log)
+	return nil
+}
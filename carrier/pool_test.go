@@ -0,0 +1,171 @@
+package carrier
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/h2mux"
+	cfwebsocket "github.com/cloudflare/cloudflared/websocket"
+)
+
+// newTestPool returns a pool whose connections are pipes to an echo server, and the number of dials
+func newTestPool(size int, idleTimeout time.Duration) (*Pool, func() int) {
+	log := zerolog.Nop()
+	pool := NewPool(size, idleTimeout, &log)
+	var lock sync.Mutex
+	dials := 0
+	pool.dial = func(options *StartOptions) (io.ReadWriteCloser, error) {
+		lock.Lock()
+		dials++
+		lock.Unlock()
+		client, server := net.Pipe()
+		go func() {
+			_, _ = io.Copy(server, server)
+		}()
+		return client, nil
+	}
+	return pool, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return dials
+	}
+}
+
+func idleCount(pool *Pool, options *StartOptions) int {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	if origin, ok := pool.origins[poolKey(options)]; ok {
+		return len(origin.idle)
+	}
+	return 0
+}
+
+func TestPoolReusesIdleConnections(t *testing.T) {
+	pool, dials := newTestPool(2, time.Minute)
+	defer pool.Close()
+	options := &StartOptions{OriginURL: "https://ssh.example.com", Headers: http.Header{}}
+
+	conn, err := pool.Get(options)
+	require.NoError(t, err)
+	_ = conn.Close()
+	require.Eventually(t, func() bool { return idleCount(pool, options) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 3, dials())
+
+	// Idle connections are used, and replaced
+	conn, err = pool.Get(options)
+	require.NoError(t, err)
+	_ = conn.Close()
+	require.Eventually(t, func() bool { return idleCount(pool, options) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 4, dials())
+
+	// Other headers don't share connections
+	other := &StartOptions{OriginURL: "https://ssh.example.com", Headers: http.Header{cfJumpDestinationHeader: []string{"other:22"}}}
+	assert.Equal(t, 0, idleCount(pool, other))
+}
+
+// muxConn is a connection whose multiplexing subprotocol was accepted
+type muxConn struct {
+	net.Conn
+}
+
+func (c *muxConn) Subprotocol() string {
+	return cfwebsocket.MuxSubprotocol
+}
+
+func TestPoolMultiplexesStreams(t *testing.T) {
+	log := zerolog.Nop()
+	pool := NewPool(2, time.Minute, &log)
+	defer pool.Close()
+	var lock sync.Mutex
+	dials := 0
+	pool.dial = func(options *StartOptions) (io.ReadWriteCloser, error) {
+		lock.Lock()
+		dials++
+		lock.Unlock()
+		assert.Equal(t, cfwebsocket.MuxSubprotocol, options.Headers.Get("Sec-WebSocket-Protocol"))
+		client, server := net.Pipe()
+		go func() {
+			echo := h2mux.MuxedStreamFunc(func(stream *h2mux.MuxedStream) error {
+				if err := stream.WriteHeaders(cfwebsocket.MuxConnectedHeaders); err != nil {
+					return err
+				}
+				_, err := io.Copy(stream, stream)
+				return err
+			})
+			muxer, err := h2mux.Handshake(server, server, h2mux.MuxerConfig{Handler: echo, Log: &log}, h2mux.ActiveStreams)
+			if err == nil {
+				_ = muxer.Serve(context.Background())
+			}
+		}()
+		return &muxConn{Conn: client}, nil
+	}
+	options := &StartOptions{OriginURL: "https://ssh.example.com", Headers: http.Header{}}
+
+	for _, message := range []string{"first\n", "second\n"} {
+		stream, err := pool.Get(options)
+		require.NoError(t, err)
+		_, err = stream.Write([]byte(message))
+		require.NoError(t, err)
+		echo, err := bufio.NewReader(stream).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, message, echo)
+	}
+	// Both streams are carried over the same connection, without idle connections
+	lock.Lock()
+	assert.Equal(t, 1, dials)
+	lock.Unlock()
+	assert.Equal(t, 0, idleCount(pool, options))
+	// The headers of the streams don't include the subprotocol
+	assert.Empty(t, options.Headers.Get("Sec-WebSocket-Protocol"))
+}
+
+func TestPoolClosesExpiredConnections(t *testing.T) {
+	pool, _ := newTestPool(1, 50*time.Millisecond)
+	defer pool.Close()
+	options := &StartOptions{OriginURL: "https://ssh.example.com", Headers: http.Header{}}
+
+	conn, err := pool.Get(options)
+	require.NoError(t, err)
+	_ = conn.Close()
+	require.Eventually(t, func() bool { return idleCount(pool, options) == 1 }, time.Second, 5*time.Millisecond)
+	require.Eventually(t, func() bool { return idleCount(pool, options) == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestDaemon(t *testing.T) {
+	pool, _ := newTestPool(1, time.Minute)
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "access.sock"))
+	require.NoError(t, err)
+	shutdownC := make(chan struct{})
+	log := zerolog.Nop()
+	errC := make(chan error)
+	go func() {
+		errC <- ServeDaemon(pool, listener, shutdownC, &log)
+	}()
+
+	client, stream := net.Pipe()
+	go func() {
+		_ = StartDaemonClient(listener.Addr().String(), stream, &StartOptions{OriginURL: "https://ssh.example.com"}, &log)
+	}()
+
+	message := "SSH-2.0-OpenSSH_8.9\n"
+	_, err = client.Write([]byte(message))
+	require.NoError(t, err)
+	echo, err := bufio.NewReader(client).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, message, echo)
+	_ = client.Close()
+
+	close(shutdownC)
+	assert.NoError(t, <-errC)
+}
@@ -0,0 +1,123 @@
+package carrier
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	yaml "gopkg.in/yaml.v3"
+)
+
+const (
+	CFAccessClientIDHeader     = "Cf-Access-Client-Id"
+	CFAccessClientSecretHeader = "Cf-Access-Client-Secret"
+)
+
+// ServiceToken is an Access service token, see https://developers.cloudflare.com/cloudflare-one/identity/service-tokens/
+type ServiceToken struct {
+	ClientID     string `yaml:"clientID"`
+	ClientSecret string `yaml:"clientSecret"`
+}
+
+// SetHeaders sets the headers authenticating a request with the token
+func (t ServiceToken) SetHeaders(header http.Header) {
+	header.Set(CFAccessClientIDHeader, t.ClientID)
+	header.Set(CFAccessClientSecretHeader, t.ClientSecret)
+}
+
+// ServiceTokens provides the service tokens to authenticate with, in the order they should be tried
+type ServiceTokens interface {
+	Tokens() ([]ServiceToken, error)
+}
+
+// serviceTokenFileContent is the format of service token files, in YAML or JSON
+type serviceTokenFileContent struct {
+	ServiceToken `yaml:",inline"`
+	// Tokens tried when Access rejects the first one, e.g. the new token during a rotation
+	Next []ServiceToken `yaml:"next"`
+}
+
+// ServiceTokenFile reads service tokens from a file, and reads it again whenever it changes so that tokens can be
+// rotated without restarting. Changes are detected when tokens are used rather than with a file watcher, as secrets
+// are often rotated by replacing a symlink, e.g. in Kubernetes, which isn't a write to the file.
+type ServiceTokenFile struct {
+	path string
+	log  *zerolog.Logger
+
+	lock    sync.Mutex
+	modTime time.Time
+	size    int64
+	tokens  []ServiceToken
+}
+
+// NewServiceTokenFile reads the service tokens of the file at path
+func NewServiceTokenFile(path string, log *zerolog.Logger) (*ServiceTokenFile, error) {
+	f := &ServiceTokenFile{path: path, log: log}
+	if _, err := f.Tokens(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Tokens returns the tokens of the file, read again if it changed. The last valid tokens are kept if the file
+// becomes invalid, e.g. while it's being written.
+func (f *ServiceTokenFile) Tokens() ([]ServiceToken, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return f.keepTokens(errors.Wrap(err, "failed to read service token file"))
+	}
+	if f.tokens != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.tokens, nil
+	}
+
+	tokens, err := readServiceTokenFile(f.path)
+	if err != nil {
+		return f.keepTokens(err)
+	}
+	if f.tokens != nil {
+		f.log.Info().Str("path", f.path).Int("tokens", len(tokens)).Msg("Reloaded service tokens")
+	}
+	f.tokens, f.modTime, f.size = tokens, info.ModTime(), info.Size()
+	return f.tokens, nil
+}
+
+func (f *ServiceTokenFile) keepTokens(err error) ([]ServiceToken, error) {
+	if f.tokens == nil {
+		return nil, err
+	}
+	f.log.Warn().Err(err).Str("path", f.path).Msg("Using the last valid service tokens")
+	return f.tokens, nil
+}
+
+func readServiceTokenFile(path string) ([]ServiceToken, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read service token file")
+	}
+	var file serviceTokenFileContent
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, errors.Wrap(err, "failed to parse service token file")
+	}
+
+	var tokens []ServiceToken
+	for _, token := range append([]ServiceToken{file.ServiceToken}, file.Next...) {
+		if token.ClientID == "" && token.ClientSecret == "" {
+			continue
+		}
+		if token.ClientID == "" || token.ClientSecret == "" {
+			return nil, errors.Errorf("service token file %s has a token without client ID or secret", path)
+		}
+		tokens = append(tokens, token)
+	}
+	if len(tokens) == 0 {
+		return nil, errors.Errorf("service token file %s has no token", path)
+	}
+	return tokens, nil
+}
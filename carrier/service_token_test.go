@@ -0,0 +1,116 @@
+package carrier
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/token"
+)
+
+func writeServiceTokenFile(t *testing.T, path, content string, modTime time.Time) {
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestServiceTokenFile(t *testing.T) {
+	log := zerolog.Nop()
+	path := filepath.Join(t.TempDir(), "token.yaml")
+	now := time.Now()
+
+	writeServiceTokenFile(t, path, "clientID: id1\nclientSecret: secret1\n", now)
+	tokens, err := NewServiceTokenFile(path, &log)
+	require.NoError(t, err)
+	current, err := tokens.Tokens()
+	require.NoError(t, err)
+	assert.Equal(t, []ServiceToken{{ClientID: "id1", ClientSecret: "secret1"}}, current)
+
+	// Rotation window with both tokens, in JSON
+	writeServiceTokenFile(t, path, `{"clientID": "id1", "clientSecret": "secret1", "next": [{"clientID": "id2", "clientSecret": "secret2"}]}`, now.Add(time.Second))
+	current, err = tokens.Tokens()
+	require.NoError(t, err)
+	assert.Equal(t, []ServiceToken{{ClientID: "id1", ClientSecret: "secret1"}, {ClientID: "id2", ClientSecret: "secret2"}}, current)
+
+	// Invalid files keep the last valid tokens
+	writeServiceTokenFile(t, path, "clientID: id3\n", now.Add(2*time.Second))
+	current, err = tokens.Tokens()
+	require.NoError(t, err)
+	assert.Len(t, current, 2)
+	require.NoError(t, os.Remove(path))
+	current, err = tokens.Tokens()
+	require.NoError(t, err)
+	assert.Len(t, current, 2)
+
+	writeServiceTokenFile(t, path, "clientID: id2\nclientSecret: secret2\n", now.Add(3*time.Second))
+	current, err = tokens.Tokens()
+	require.NoError(t, err)
+	assert.Equal(t, []ServiceToken{{ClientID: "id2", ClientSecret: "secret2"}}, current)
+}
+
+func TestServiceTokenFileInvalid(t *testing.T) {
+	log := zerolog.Nop()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"empty":     "",
+		"no secret": "clientID: id\n",
+		"next":      "clientID: id\nclientSecret: secret\nnext:\n- clientSecret: secret\n",
+	} {
+		path := filepath.Join(dir, "token.yaml")
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		_, err := NewServiceTokenFile(path, &log)
+		assert.Error(t, err, name)
+	}
+	_, err := NewServiceTokenFile(filepath.Join(dir, "missing.yaml"), &log)
+	assert.Error(t, err)
+}
+
+type staticServiceTokens []ServiceToken
+
+func (s staticServiceTokens) Tokens() ([]ServiceToken, error) { return s, nil }
+
+func TestCreateServiceTokenStream(t *testing.T) {
+	upgrader := ws.Upgrader{}
+	var tried []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tried = append(tried, r.Header.Get(CFAccessClientIDHeader))
+		if r.Header.Get(CFAccessClientSecretHeader) != "valid" {
+			http.Redirect(w, r, "https://team.cloudflareaccess.com"+token.AccessLoginWorkerPath, http.StatusFound)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer server.Close()
+	log := zerolog.Nop()
+
+	options := &StartOptions{
+		OriginURL: server.URL,
+		Headers:   make(http.Header),
+		ServiceTokens: staticServiceTokens{
+			{ClientID: "old", ClientSecret: "revoked"},
+			{ClientID: "new", ClientSecret: "valid"},
+		},
+	}
+	conn, err := createWebsocketStream(options, &log)
+	require.NoError(t, err)
+	_ = conn.Close()
+	assert.Equal(t, []string{"old", "new"}, tried)
+	assert.Empty(t, options.Headers, "the headers of the options are left unchanged")
+
+	tried = nil
+	options.ServiceTokens = staticServiceTokens{{ClientID: "old", ClientSecret: "revoked"}}
+	_, err = createWebsocketStream(options, &log)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"old"}, tried)
+}
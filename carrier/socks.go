@@ -0,0 +1,131 @@
+package carrier
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/socks"
+)
+
+// SocksDialer is a SOCKS5 dialer connecting to destinations of private networks through an Access application served
+// by a tunnel in bastion mode, and to other destinations directly
+type SocksDialer struct {
+	networks []*net.IPNet
+	domains  []string
+	direct   socks.Dialer
+	log      *zerolog.Logger
+
+	lock sync.Mutex
+	// Kept across connections so the Access application is only looked up once
+	options *StartOptions
+}
+
+// NewSocksDialer creates a dialer routing destinations in networks, or with a hostname in one of domains, through the
+// bastion of options
+func NewSocksDialer(options *StartOptions, networks []*net.IPNet, domains []string, log *zerolog.Logger) *SocksDialer {
+	copied := *options
+	return &SocksDialer{
+		networks: networks,
+		domains:  domains,
+		direct:   socks.NewNetDialer(),
+		log:      log,
+		options:  &copied,
+	}
+}
+
+// Dial implements socks.Dialer
+func (d *SocksDialer) Dial(address string) (io.ReadWriteCloser, *socks.AddrSpec, error) {
+	if !d.isPrivate(address) {
+		return d.direct.Dial(address)
+	}
+
+	d.lock.Lock()
+	options := *d.options
+	options.Headers = d.options.Headers.Clone()
+	d.lock.Unlock()
+	if options.Headers == nil {
+		options.Headers = make(http.Header)
+	}
+	SetBastionDest(options.Headers, address)
+
+	conn, err := createWebsocketStream(&options, d.log)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.lock.Lock()
+	if options.AppInfo != nil {
+		d.options.AppInfo = options.AppInfo
+	}
+	d.lock.Unlock()
+
+	// The address of the connection from the bastion to the destination isn't known
+	return conn, &socks.AddrSpec{IP: net.IPv4zero}, nil
+}
+
+// isPrivate returns whether address should be reached through the bastion. Hostnames of private domains are resolved
+// by the bastion, other hostnames are resolved locally to see if they belong to private networks.
+func (d *SocksDialer) isPrivate(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return d.inNetworks(ip)
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range d.domains {
+		domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		d.log.Debug().Err(err).Str("host", host).Msg("Failed to resolve SOCKS destination")
+		return false
+	}
+	for _, ip := range ips {
+		if d.inNetworks(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *SocksDialer) inNetworks(ip net.IP) bool {
+	for _, network := range d.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// socksConnection serves SOCKS5 clients, carrying their connections with a SocksDialer
+type socksConnection struct {
+	handler socks.ConnectionHandler
+	log     *zerolog.Logger
+}
+
+// NewSocksConnection returns a connection serving SOCKS5 clients with dialer
+func NewSocksConnection(dialer socks.Dialer, log *zerolog.Logger) Connection {
+	return &socksConnection{
+		handler: socks.NewConnectionHandler(socks.NewRequestHandler(dialer, nil)),
+		log:     log,
+	}
+}
+
+// ServeStream serves the SOCKS5 client of conn
+func (c *socksConnection) ServeStream(_ *StartOptions, conn io.ReadWriter) error {
+	if err := c.handler.Serve(conn); err != nil {
+		c.log.Debug().Err(err).Msg("SOCKS5 connection failed")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package carrier
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseCIDR(t *testing.T, cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	require.NoError(t, err)
+	return network
+}
+
+func TestSocksDialerIsPrivate(t *testing.T) {
+	log := zerolog.Nop()
+	dialer := NewSocksDialer(&StartOptions{}, []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8"), mustParseCIDR(t, "fd00::/8")}, []string{"internal.example.com"}, &log)
+
+	tests := []struct {
+		address string
+		private bool
+	}{
+		{"10.1.2.3:22", true},
+		{"[fd00::1]:443", true},
+		{"192.168.1.1:22", false},
+		{"db.internal.example.com:5432", true},
+		{"INTERNAL.example.com.:80", true},
+		{"notinternal.example.com:80", false},
+		{"localhost:80", false},
+		{"invalid", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.private, dialer.isPrivate(test.address), test.address)
+	}
+}
+
+func TestSocksDialer(t *testing.T) {
+	upgrader := ws.Upgrader{}
+	var destination string
+	bastion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		destination = r.Header.Get(cfJumpDestinationHeader)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		mt, message, err := conn.ReadMessage()
+		if err == nil {
+			_ = conn.WriteMessage(mt, message)
+		}
+	}))
+	defer bastion.Close()
+
+	direct, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer direct.Close()
+	go func() {
+		conn, err := direct.Accept()
+		if err == nil {
+			_, _ = conn.Write([]byte("direct"))
+			_ = conn.Close()
+		}
+	}()
+
+	log := zerolog.Nop()
+	dialer := NewSocksDialer(&StartOptions{OriginURL: bastion.URL}, []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8")}, nil, &log)
+
+	conn, _, err := dialer.Dial("10.1.2.3:22")
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("private"))
+	require.NoError(t, err)
+	buf := make([]byte, len("private"))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "private", string(buf))
+	assert.Equal(t, "10.1.2.3:22", destination)
+	_ = conn.Close()
+
+	conn, _, err = dialer.Dial(direct.Addr().String())
+	require.NoError(t, err)
+	content, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "direct", string(content))
+	_ = conn.Close()
+}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 
 	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
 	"github.com/cloudflare/cloudflared/token"
@@ -37,7 +38,7 @@ func (ws *Websocket) ServeStream(options *StartOptions, conn io.ReadWriter) erro
 	}
 	defer wsConn.Close()
 
-	cfwebsocket.Stream(wsConn, conn, ws.log)
+	cfwebsocket.StreamHalfClose(wsConn, conn, ws.log)
 	return nil
 }
 
@@ -45,26 +46,11 @@ func (ws *Websocket) ServeStream(options *StartOptions, conn io.ReadWriter) erro
 // It also handles redirects from Access and will present that flow if
 // the token is not present on the request
 func createWebsocketStream(options *StartOptions, log *zerolog.Logger) (*cfwebsocket.GorillaConn, error) {
-	req, err := http.NewRequest(http.MethodGet, options.OriginURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header = options.Headers
-	if options.Host != "" {
-		req.Host = options.Host
+	if options.ServiceTokens != nil {
+		return createServiceTokenStream(options, log)
 	}
 
-	dump, err := httputil.DumpRequest(req, false)
-	if err != nil {
-		return nil, err
-	}
-	log.Debug().Msgf("Websocket request: %s", string(dump))
-
-	dialer := &websocket.Dialer{
-		TLSClientConfig: options.TLSClientConfig,
-		Proxy:           http.ProxyFromEnvironment,
-	}
-	wsConn, resp, err := clientConnect(req, dialer)
+	wsConn, resp, err := dialWebsocket(options, options.Headers, log)
 	defer closeRespBody(resp)
 
 	if err != nil && IsAccessResponse(resp) {
@@ -88,7 +74,58 @@ func createWebsocketStream(options *StartOptions, log *zerolog.Logger) (*cfwebso
 		return nil, err
 	}
 
-	return &cfwebsocket.GorillaConn{Conn: wsConn}, nil
+	return cfwebsocket.NewGorillaConn(wsConn, log), nil
+}
+
+// createServiceTokenStream connects with each service token of options in turn until Access accepts one, so that
+// both the current and the next token can be used while a token is rotated
+func createServiceTokenStream(options *StartOptions, log *zerolog.Logger) (*cfwebsocket.GorillaConn, error) {
+	tokens, err := options.ServiceTokens.Tokens()
+	if err != nil {
+		return nil, err
+	}
+	for i, serviceToken := range tokens {
+		headers := options.Headers.Clone()
+		if headers == nil {
+			headers = make(http.Header)
+		}
+		serviceToken.SetHeaders(headers)
+
+		wsConn, resp, err := dialWebsocket(options, headers, log)
+		closeRespBody(resp)
+		if err == nil {
+			return cfwebsocket.NewGorillaConn(wsConn, log), nil
+		}
+		if !IsAccessResponse(resp) {
+			return nil, err
+		}
+		log.Debug().Int("token", i).Str("clientID", serviceToken.ClientID).Msg("Access rejected service token")
+	}
+	return nil, errors.New("Access rejected all the service tokens")
+}
+
+// dialWebsocket opens a WebSocket connection to the origin of options with the given headers
+func dialWebsocket(options *StartOptions, headers http.Header, log *zerolog.Logger) (*websocket.Conn, *http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, options.OriginURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header = headers
+	if options.Host != "" {
+		req.Host = options.Host
+	}
+
+	dump, err := httputil.DumpRequest(req, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Debug().Msgf("Websocket request: %s", string(dump))
+
+	dialer := &websocket.Dialer{
+		TLSClientConfig: options.TLSClientConfig,
+		Proxy:           http.ProxyFromEnvironment,
+	}
+	return clientConnect(req, dialer)
 }
 
 var stripWebsocketHeaders = []string{
@@ -5,10 +5,15 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"io"
 	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	gobwas "github.com/gobwas/ws"
 	gws "github.com/gorilla/websocket"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
@@ -47,7 +52,7 @@ func TestServe(t *testing.T) {
 	defer listener.Close()
 
 	go func() {
-		errC <- hello.StartHelloWorldServer(&log, listener, shutdownC)
+		errC <- hello.StartHelloWorldServer(&log, listener, shutdownC, hello.Config{})
 	}()
 
 	req := testRequest(t, "https://localhost:1111/ws", nil)
@@ -88,7 +93,7 @@ func TestWebsocketWrapper(t *testing.T) {
 	defer cancelHelloSvr()
 	go func() {
 		log := zerolog.Nop()
-		serverErrorChan <- hello.StartHelloWorldServer(&log, listener, helloSvrCtx.Done())
+		serverErrorChan <- hello.StartHelloWorldServer(&log, listener, helloSvrCtx.Done(), hello.Config{})
 	}()
 
 	tlsConfig := websocketClientTLSConfig(t)
@@ -121,3 +126,69 @@ func TestWebsocketWrapper(t *testing.T) {
 	require.Equal(t, n, 2)
 	require.Equal(t, "bc", string(buf[:n]))
 }
+
+// TestHalfCloseThroughCarrier checks that the end of the data of each side is passed on from the local connection of
+// the carrier to the origin behind the server side of the WebSocket connection, and back
+func TestHalfCloseThroughCarrier(t *testing.T) {
+	log := zerolog.Nop()
+	request := []byte("QUIT")
+	response := []byte("221 Bye")
+
+	// The origin only responds once the client is done sending, like an SMTP server after QUIT
+	origin, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer origin.Close()
+	go func() {
+		conn, err := origin.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		received, err := io.ReadAll(conn)
+		if err != nil || string(received) != string(request) {
+			return
+		}
+		_, _ = conn.Write(response)
+	}()
+
+	// Server side of the tunnel with the tcpHalfClose origin option
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _, err := gobwas.UpgradeHTTP(r, w)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		originConn, err := net.Dial("tcp", origin.Addr().String())
+		if err != nil {
+			return
+		}
+		defer originConn.Close()
+		wsConn := cfwebsocket.NewConn(r.Context(), conn, &log)
+		cfwebsocket.StreamHalfClose(wsConn, originConn, &log)
+		wsConn.Close()
+	}))
+	defer server.Close()
+
+	local, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer local.Close()
+	go func() {
+		conn, err := local.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = NewWSConnection(&log).ServeStream(&StartOptions{OriginURL: server.URL}, conn)
+	}()
+
+	client, err := net.Dial("tcp", local.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = client.Write(request)
+	require.NoError(t, err)
+	require.NoError(t, client.(*net.TCPConn).CloseWrite())
+	received, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, response, received)
+}
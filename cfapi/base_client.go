@@ -2,22 +2,31 @@ package cfapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"golang.org/x/net/http2"
+
+	"github.com/cloudflare/cloudflared/retry"
 )
 
 const (
 	defaultTimeout  = 15 * time.Second
 	jsonContentType = "application/json"
+
+	// Requests rate limited by the API are retried up to maxRateLimitRetries times, waiting for as long as the
+	// Retry-After header of the response asks, up to maxRetryAfter
+	maxRateLimitRetries = 5
+	maxRetryAfter       = time.Minute
 )
 
 var (
@@ -25,14 +34,17 @@ var (
 	ErrBadRequest   = errors.New("incorrect request parameters")
 	ErrNotFound     = errors.New("not found")
 	ErrAPINoSuccess = errors.New("API call failed")
+	ErrRateLimited  = errors.New("rate limited")
 )
 
 type RESTClient struct {
 	baseEndpoints *baseEndpoints
 	authToken     string
-	userAgent     string
-	client        http.Client
-	log           *zerolog.Logger
+	// bearerAuth is whether authToken is a scoped API token rather than the service key of an origin certificate
+	bearerAuth bool
+	userAgent  string
+	client     http.Client
+	log        *zerolog.Logger
 }
 
 type baseEndpoints struct {
@@ -86,56 +98,127 @@ func NewRESTClient(baseURL, accountTag, zoneTag, authToken, userAgent string, lo
 	}, nil
 }
 
+// NewRESTClientWithAPIToken creates a client of the account-level endpoints that authenticates with a scoped API token
+// instead of the service key of an origin certificate
+func NewRESTClientWithAPIToken(baseURL, accountTag, apiToken, userAgent string, log *zerolog.Logger) (*RESTClient, error) {
+	client, err := NewRESTClient(baseURL, accountTag, "", apiToken, userAgent, log)
+	if err != nil {
+		return nil, err
+	}
+	client.bearerAuth = true
+	return client, nil
+}
+
 func (r *RESTClient) sendRequest(method string, url url.URL, body interface{}) (*http.Response, error) {
-	var bodyReader io.Reader
+	return r.sendRequestContext(context.Background(), method, url, body)
+}
+
+// sendRequestContext sends a request until it isn't rate limited, or ctx is done
+func (r *RESTClient) sendRequestContext(ctx context.Context, method string, url url.URL, body interface{}) (*http.Response, error) {
+	var bodyBytes []byte
 	if body != nil {
-		if bodyBytes, err := json.Marshal(body); err != nil {
+		var err error
+		if bodyBytes, err = json.Marshal(body); err != nil {
 			return nil, errors.Wrap(err, "failed to serialize json body")
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		var bodyReader io.Reader
+		if bodyBytes != nil {
+			bodyReader = bytes.NewReader(bodyBytes)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url.String(), bodyReader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't create %s request", method)
+		}
+		req.Header.Set("User-Agent", r.userAgent)
+		if bodyReader != nil {
+			req.Header.Set("Content-Type", jsonContentType)
+		}
+		if r.bearerAuth {
+			req.Header.Set("Authorization", "Bearer "+r.authToken)
 		} else {
-			bodyReader = bytes.NewBuffer(bodyBytes)
+			req.Header.Add("X-Auth-User-Service-Key", r.authToken)
+		}
+		req.Header.Add("Accept", "application/json;version=1")
+		resp, err := r.client.Do(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt >= maxRateLimitRetries {
+			return resp, err
+		}
+		// Give up retrying when the retry budget shared with the other subsystems is exhausted
+		if !retry.GlobalBudget().Take(retry.APIRetries) {
+			return resp, err
+		}
+
+		delay := retryAfter(resp.Header, attempt, time.Now())
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		r.log.Debug().Msgf("%s %s was rate limited, retrying in %s", method, url.Path, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
 		}
 	}
+}
 
-	req, err := http.NewRequest(method, url.String(), bodyReader)
-	if err != nil {
-		return nil, errors.Wrapf(err, "can't create %s request", method)
+// retryAfter is how long to wait before retrying a rate limited request, from the Retry-After header in seconds or as
+// a date, else backing off exponentially
+func retryAfter(header http.Header, attempt int, now time.Time) time.Duration {
+	delay := time.Second << attempt
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		} else if date, err := http.ParseTime(value); err == nil {
+			delay = date.Sub(now)
+			if delay < 0 {
+				delay = 0
+			}
+		}
 	}
-	req.Header.Set("User-Agent", r.userAgent)
-	if bodyReader != nil {
-		req.Header.Set("Content-Type", jsonContentType)
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
 	}
-	req.Header.Add("X-Auth-User-Service-Key", r.authToken)
-	req.Header.Add("Accept", "application/json;version=1")
-	return r.client.Do(req)
+	return delay
 }
 
 func parseResponse(reader io.Reader, data interface{}) error {
+	_, err := parsePagedResponse(reader, data)
+	return err
+}
+
+// parsePagedResponse parses the response like parseResponse, also returning its pagination if it has any
+func parsePagedResponse(reader io.Reader, data interface{}) (*ResultInfo, error) {
 	// Schema for Tunnelstore responses in the v1 API.
 	// Roughly, it's a wrapper around a particular result that adds failures/errors/etc
 	var result response
 	// First, parse the wrapper and check the API call succeeded
 	if err := json.NewDecoder(reader).Decode(&result); err != nil {
-		return errors.Wrap(err, "failed to decode response")
+		return nil, errors.Wrap(err, "failed to decode response")
 	}
 	if err := result.checkErrors(); err != nil {
-		return err
+		return nil, err
 	}
 	if !result.Success {
-		return ErrAPINoSuccess
+		return nil, ErrAPINoSuccess
 	}
 	// At this point we know the API call succeeded, so, parse out the inner
 	// result into the datatype provided as a parameter.
 	if err := json.Unmarshal(result.Result, &data); err != nil {
-		return errors.Wrap(err, "the Cloudflare API response was an unexpected type")
+		return nil, errors.Wrap(err, "the Cloudflare API response was an unexpected type")
 	}
-	return nil
+	return result.ResultInfo, nil
 }
 
 type response struct {
-	Success  bool            `json:"success,omitempty"`
-	Errors   []apiErr        `json:"errors,omitempty"`
-	Messages []string        `json:"messages,omitempty"`
-	Result   json.RawMessage `json:"result,omitempty"`
+	Success    bool            `json:"success,omitempty"`
+	Errors     []apiErr        `json:"errors,omitempty"`
+	Messages   []string        `json:"messages,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	ResultInfo *ResultInfo     `json:"result_info,omitempty"`
 }
 
 func (r *response) checkErrors() error {
@@ -180,6 +263,8 @@ func (r *RESTClient) statusCodeToError(op string, resp *http.Response) error {
 		return ErrUnauthorized
 	case http.StatusNotFound:
 		return ErrNotFound
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
 	}
 	return errors.Errorf("API call to %s failed with status %d: %s", op,
 		resp.StatusCode, http.StatusText(resp.StatusCode))
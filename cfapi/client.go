@@ -1,17 +1,21 @@
 package cfapi
 
 import (
+	"context"
+
 	"github.com/google/uuid"
 )
 
 type TunnelClient interface {
-	CreateTunnel(name string, tunnelSecret []byte) (*TunnelWithToken, error)
+	CreateTunnel(name string, tunnelSecret []byte, metadata map[string]string) (*TunnelWithToken, error)
 	GetTunnel(tunnelID uuid.UUID) (*Tunnel, error)
 	GetTunnelToken(tunnelID uuid.UUID) (string, error)
 	DeleteTunnel(tunnelID uuid.UUID) error
 	ListTunnels(filter *TunnelFilter) ([]*Tunnel, error)
+	IterateTunnels(ctx context.Context, filter *TunnelFilter) *Iterator[*Tunnel]
 	ListActiveClients(tunnelID uuid.UUID) ([]*ActiveClient, error)
 	CleanupConnections(tunnelID uuid.UUID, params *CleanupParams) error
+	GetTunnelConfiguration(tunnelID uuid.UUID) (*TunnelConfiguration, error)
 }
 
 type HostnameClient interface {
@@ -20,6 +24,7 @@ type HostnameClient interface {
 
 type IPRouteClient interface {
 	ListRoutes(filter *IpRouteFilter) ([]*DetailedRoute, error)
+	IterateRoutes(ctx context.Context, filter *IpRouteFilter) *Iterator[*DetailedRoute]
 	AddRoute(newRoute NewRoute) (Route, error)
 	DeleteRoute(params DeleteRouteParams) error
 	GetByIP(params GetRouteByIpParams) (DetailedRoute, error)
@@ -28,6 +33,7 @@ type IPRouteClient interface {
 type VnetClient interface {
 	CreateVirtualNetwork(newVnet NewVirtualNetwork) (VirtualNetwork, error)
 	ListVirtualNetworks(filter *VnetFilter) ([]*VirtualNetwork, error)
+	IterateVirtualNetworks(ctx context.Context, filter *VnetFilter) *Iterator[*VirtualNetwork]
 	DeleteVirtualNetwork(id uuid.UUID) error
 	UpdateVirtualNetwork(id uuid.UUID, updates UpdateVirtualNetwork) error
 }
@@ -56,6 +56,15 @@ type IpRouteFilter struct {
 	queryParams url.Values
 }
 
+// NewIpRouteFilter creates a filter matching all the routes which aren't deleted
+func NewIpRouteFilter() *IpRouteFilter {
+	f := &IpRouteFilter{
+		queryParams: url.Values{},
+	}
+	f.notDeleted()
+	return f
+}
+
 // NewIpRouteFilterFromCLI parses CLI flags to discover which filters should get applied.
 func NewIpRouteFilterFromCLI(c *cli.Context) (*IpRouteFilter, error) {
 	f := &IpRouteFilter{
@@ -0,0 +1,169 @@
+package cfapi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// ResultInfo is the pagination of the results of a list call. Endpoints paginate either by page number, or by the
+// cursor of the next page.
+type ResultInfo struct {
+	Page       int    `json:"page"`
+	PerPage    int    `json:"per_page"`
+	Count      int    `json:"count"`
+	TotalCount int    `json:"total_count"`
+	TotalPages int    `json:"total_pages"`
+	Cursor     string `json:"cursor,omitempty"`
+}
+
+// Iterator iterates over all the results of a list call, fetching the next page when the results of the previous
+// one are consumed:
+//
+//	it := client.IterateTunnels(ctx, filter)
+//	for it.Next() {
+//		tunnel := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type Iterator[T any] struct {
+	ctx   context.Context
+	fetch func(ctx context.Context, query url.Values) ([]T, *ResultInfo, error)
+	query url.Values
+
+	results []T
+	current T
+	done    bool
+	err     error
+}
+
+func newIterator[T any](ctx context.Context, query url.Values, fetch func(context.Context, url.Values) ([]T, *ResultInfo, error)) *Iterator[T] {
+	return &Iterator[T]{
+		ctx:   ctx,
+		fetch: fetch,
+		query: query,
+	}
+}
+
+// Next advances to the next result, fetching the next page if needed. It returns false once all results are
+// iterated, or fetching a page failed.
+func (it *Iterator[T]) Next() bool {
+	for len(it.results) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.fetchPage()
+	}
+	it.current = it.results[0]
+	it.results = it.results[1:]
+	return true
+}
+
+func (it *Iterator[T]) fetchPage() {
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return
+	}
+	results, info, err := it.fetch(it.ctx, it.query)
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.results = results
+	switch {
+	case info == nil || len(results) == 0:
+		it.done = true
+	case info.Cursor != "":
+		it.query.Set("cursor", info.Cursor)
+	case info.Page > 0 && info.Page < info.TotalPages:
+		it.query.Set("page", strconv.Itoa(info.Page+1))
+	default:
+		it.done = true
+	}
+}
+
+// Value is the current result
+func (it *Iterator[T]) Value() T {
+	return it.current
+}
+
+// Err is the error fetching a page, if any
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// All consumes the iterator, returning all its remaining results
+func (it *Iterator[T]) All() ([]T, error) {
+	var results []T
+	for it.Next() {
+		results = append(results, it.Value())
+	}
+	return results, it.Err()
+}
+
+// listPage fetches a page of a list call into data
+func (r *RESTClient) listPage(ctx context.Context, op string, endpoint url.URL, query url.Values, data interface{}) (*ResultInfo, error) {
+	endpoint.RawQuery = query.Encode()
+	resp, err := r.sendRequestContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "REST request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return parsePagedResponse(resp.Body, data)
+	}
+
+	return nil, r.statusCodeToError(op, resp)
+}
+
+// IterateTunnels iterates over all the tunnels matching filter, which may be nil
+func (r *RESTClient) IterateTunnels(ctx context.Context, filter *TunnelFilter) *Iterator[*Tunnel] {
+	query := url.Values{}
+	if filter != nil {
+		query = cloneValues(filter.queryParams)
+	}
+	return newIterator(ctx, query, func(ctx context.Context, query url.Values) ([]*Tunnel, *ResultInfo, error) {
+		var tunnels []*Tunnel
+		info, err := r.listPage(ctx, "list tunnels", r.baseEndpoints.accountLevel, query, &tunnels)
+		return tunnels, info, err
+	})
+}
+
+// IterateRoutes iterates over all the routes matching filter, which may be nil
+func (r *RESTClient) IterateRoutes(ctx context.Context, filter *IpRouteFilter) *Iterator[*DetailedRoute] {
+	query := url.Values{}
+	if filter != nil {
+		query = cloneValues(filter.queryParams)
+	}
+	return newIterator(ctx, query, func(ctx context.Context, query url.Values) ([]*DetailedRoute, *ResultInfo, error) {
+		var routes []*DetailedRoute
+		info, err := r.listPage(ctx, "list routes", r.baseEndpoints.accountRoutes, query, &routes)
+		return routes, info, err
+	})
+}
+
+// IterateVirtualNetworks iterates over all the virtual networks matching filter, which may be nil
+func (r *RESTClient) IterateVirtualNetworks(ctx context.Context, filter *VnetFilter) *Iterator[*VirtualNetwork] {
+	query := url.Values{}
+	if filter != nil {
+		query = cloneValues(filter.queryParams)
+	}
+	return newIterator(ctx, query, func(ctx context.Context, query url.Values) ([]*VirtualNetwork, *ResultInfo, error) {
+		var vnets []*VirtualNetwork
+		info, err := r.listPage(ctx, "list virtual networks", r.baseEndpoints.accountVnets, query, &vnets)
+		return vnets, info, err
+	})
+}
+
+// cloneValues copies the query of a filter, so iterating doesn't change it
+func cloneValues(values url.Values) url.Values {
+	clone := make(url.Values, len(values))
+	for key, value := range values {
+		clone[key] = append([]string(nil), value...)
+	}
+	return clone
+}
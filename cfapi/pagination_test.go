@@ -0,0 +1,147 @@
+package cfapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *RESTClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	log := zerolog.Nop()
+	client, err := NewRESTClient(server.URL, "account", "zone", "token", "test", &log)
+	require.NoError(t, err)
+	return client
+}
+
+func TestIterateTunnelsByPage(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/accounts/account/cfd_tunnel", r.URL.Path)
+		assert.Equal(t, "false", r.URL.Query().Get("is_deleted"))
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			page = "1"
+		}
+		fmt.Fprintf(w, `{"success": true, "result": [{"name": "tunnel-%s-a"}, {"name": "tunnel-%s-b"}],
+			"result_info": {"page": %s, "per_page": 2, "total_pages": 3}}`, page, page, page)
+	})
+
+	filter := NewTunnelFilter()
+	filter.NoDeleted()
+	var names []string
+	it := client.IterateTunnels(context.Background(), filter)
+	for it.Next() {
+		names = append(names, it.Value().Name)
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, []string{"tunnel-1-a", "tunnel-1-b", "tunnel-2-a", "tunnel-2-b", "tunnel-3-a", "tunnel-3-b"}, names)
+	// The filter isn't changed by iterating
+	assert.Empty(t, filter.queryParams.Get("page"))
+}
+
+func TestIterateRoutesByCursor(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/accounts/account/teamnet/routes", r.URL.Path)
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			fmt.Fprint(w, `{"success": true, "result": [{"network": "10.0.0.0/24"}], "result_info": {"cursor": "next"}}`)
+		case "next":
+			fmt.Fprint(w, `{"success": true, "result": [{"network": "10.0.1.0/24"}], "result_info": {}}`)
+		default:
+			t.Errorf("unexpected cursor %s", r.URL.Query().Get("cursor"))
+		}
+	})
+
+	routes, err := client.IterateRoutes(context.Background(), nil).All()
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	assert.Equal(t, "10.0.0.0/24", routes[0].Network.String())
+	assert.Equal(t, "10.0.1.0/24", routes[1].Network.String())
+}
+
+func TestIterateVirtualNetworksError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"success": true, "result": [{"id": "%s", "name": "vnet"}],
+			"result_info": {"page": 1, "per_page": 1, "total_pages": 2}}`, uuid.New())
+	})
+
+	it := client.IterateVirtualNetworks(context.Background(), NewVnetFilter())
+	require.True(t, it.Next())
+	assert.Equal(t, "vnet", it.Value().Name)
+	assert.False(t, it.Next())
+	assert.ErrorIs(t, it.Err(), ErrUnauthorized)
+}
+
+func TestRateLimitedRequestRetried(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"success": true, "result": [{"name": "tunnel"}]}`)
+	})
+
+	tunnels, err := client.ListTunnels(NewTunnelFilter())
+	require.NoError(t, err)
+	require.Len(t, tunnels, 1)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestRateLimitedRequestCanceled(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := client.IterateTunnels(ctx, nil).All()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestAPITokenAuthentication(t *testing.T) {
+	tunnelID := uuid.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, fmt.Sprintf("/accounts/account/cfd_tunnel/%s/token", tunnelID), r.URL.Path)
+		assert.Equal(t, "Bearer api-token", r.Header.Get("Authorization"))
+		assert.Empty(t, r.Header.Get("X-Auth-User-Service-Key"))
+		fmt.Fprint(w, `{"success": true, "result": "tunnel-token"}`)
+	}))
+	defer server.Close()
+	log := zerolog.Nop()
+	client, err := NewRESTClientWithAPIToken(server.URL, "account", "api-token", "test", &log)
+	require.NoError(t, err)
+
+	token, err := client.GetTunnelToken(tunnelID)
+	require.NoError(t, err)
+	assert.Equal(t, "tunnel-token", token)
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	header := func(value string) http.Header {
+		return http.Header{"Retry-After": []string{value}}
+	}
+	assert.Equal(t, 5*time.Second, retryAfter(header("5"), 0, now))
+	assert.Equal(t, 10*time.Second, retryAfter(header("Wed, 01 Jun 2022 12:00:10 GMT"), 0, now))
+	assert.Equal(t, time.Duration(0), retryAfter(header("Wed, 01 Jun 2022 11:00:00 GMT"), 0, now))
+	assert.Equal(t, maxRetryAfter, retryAfter(header("3600"), 0, now))
+	assert.Equal(t, 4*time.Second, retryAfter(http.Header{}, 2, now))
+	assert.Equal(t, 4*time.Second, retryAfter(header("soon"), 2, now))
+}
@@ -1,6 +1,7 @@
 package cfapi
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
@@ -21,6 +22,19 @@ type Tunnel struct {
 	CreatedAt   time.Time    `json:"created_at"`
 	DeletedAt   time.Time    `json:"deleted_at"`
 	Connections []Connection `json:"connections"`
+	// Metadata are arbitrary values attached to the tunnel, e.g. its labels
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Labels returns the string values of the metadata of the tunnel
+func (t *Tunnel) Labels() map[string]string {
+	labels := make(map[string]string)
+	for key, value := range t.Metadata {
+		if s, ok := value.(string); ok {
+			labels[key] = s
+		}
+	}
+	return labels
 }
 
 type TunnelWithToken struct {
@@ -45,9 +59,21 @@ type ActiveClient struct {
 	Connections []Connection `json:"conns"`
 }
 
+// TunnelConfiguration is the remotely-managed configuration of a tunnel
+type TunnelConfiguration struct {
+	TunnelID uuid.UUID `json:"tunnel_id"`
+	Version  int       `json:"version"`
+	// Config has the ingress rules, originRequest and warp-routing settings of the tunnel, in the format of the
+	// configuration file
+	Config    json.RawMessage `json:"config"`
+	Source    string          `json:"source"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
 type newTunnel struct {
-	Name         string `json:"name"`
-	TunnelSecret []byte `json:"tunnel_secret"`
+	Name         string            `json:"name"`
+	TunnelSecret []byte            `json:"tunnel_secret"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
 }
 
 type CleanupParams struct {
@@ -68,7 +94,7 @@ func (cp CleanupParams) encode() string {
 	return cp.queryParams.Encode()
 }
 
-func (r *RESTClient) CreateTunnel(name string, tunnelSecret []byte) (*TunnelWithToken, error) {
+func (r *RESTClient) CreateTunnel(name string, tunnelSecret []byte, metadata map[string]string) (*TunnelWithToken, error) {
 	if name == "" {
 		return nil, errors.New("tunnel name required")
 	}
@@ -78,6 +104,7 @@ func (r *RESTClient) CreateTunnel(name string, tunnelSecret []byte) (*TunnelWith
 	body := &newTunnel{
 		Name:         name,
 		TunnelSecret: tunnelSecret,
+		Metadata:     metadata,
 	}
 
 	resp, err := r.sendRequest("POST", r.baseEndpoints.accountLevel, body)
@@ -202,6 +229,28 @@ func (r *RESTClient) CleanupConnections(tunnelID uuid.UUID, params *CleanupParam
 	return r.statusCodeToError("cleanup connections", resp)
 }
 
+func (r *RESTClient) GetTunnelConfiguration(tunnelID uuid.UUID) (*TunnelConfiguration, error) {
+	endpoint := r.baseEndpoints.accountLevel
+	endpoint.Path = path.Join(endpoint.Path, fmt.Sprintf("%v/configurations", tunnelID))
+	resp, err := r.sendRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "REST request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return parseTunnelConfiguration(resp.Body)
+	}
+
+	return nil, r.statusCodeToError("get tunnel configuration", resp)
+}
+
+func parseTunnelConfiguration(reader io.Reader) (*TunnelConfiguration, error) {
+	var configuration TunnelConfiguration
+	err := parseResponse(reader, &configuration)
+	return &configuration, err
+}
+
 func unmarshalTunnel(reader io.Reader) (*Tunnel, error) {
 	var tunnel Tunnel
 	err := parseResponse(reader, &tunnel)
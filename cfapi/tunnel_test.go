@@ -2,6 +2,7 @@ package cfapi
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -81,6 +82,7 @@ func Test_unmarshalTunnel(t *testing.T) {
 				CreatedAt:   time.Date(2021, 07, 29, 13, 46, 14, 90955000, loc),
 				DeletedAt:   time.Date(2021, 07, 29, 14, 7, 27, 559047000, loc),
 				Connections: nil,
+				Metadata:    map[string]interface{}{"qtid": "a6fJROgkXutNruBGaJjD"},
 			},
 		},
 	}
@@ -112,6 +114,13 @@ func TestUnmarshalTunnelOk(t *testing.T) {
 	assert.Equal(t, &expected, actual)
 }
 
+func TestTunnelLabels(t *testing.T) {
+	jsonBody := `{"success": true, "result": {"id": "00000000-0000-0000-0000-000000000000","name":"test","metadata":{"team":"payments","environment":"staging","replicas":2}}}`
+	tunnel, err := unmarshalTunnel(bytes.NewReader([]byte(jsonBody)))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "payments", "environment": "staging"}, tunnel.Labels())
+}
+
 func TestUnmarshalTunnelErr(t *testing.T) {
 
 	tests := []string{
@@ -147,3 +156,16 @@ func TestUnmarshalConnections(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []*ActiveClient{&expected}, actual)
 }
+
+func TestParseTunnelConfiguration(t *testing.T) {
+	jsonBody := `{"success":true,"messages":[],"errors":[],"result":{"tunnel_id":"d4041254-91e3-4deb-bd94-b46e11680b1e","version":3,"config":{"ingress":[{"service":"http_status:404"}]},"source":"cloudflare","created_at":"0001-01-01T00:00:00Z"}}`
+	actual, err := parseTunnelConfiguration(bytes.NewReader([]byte(jsonBody)))
+	assert.NoError(t, err)
+	assert.Equal(t, &TunnelConfiguration{
+		TunnelID:  uuid.MustParse("d4041254-91e3-4deb-bd94-b46e11680b1e"),
+		Version:   3,
+		Config:    json.RawMessage(`{"ingress":[{"service":"http_status:404"}]}`),
+		Source:    "cloudflare",
+		CreatedAt: time.Time{},
+	}, actual)
+}
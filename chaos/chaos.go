@@ -0,0 +1,123 @@
+// Package chaos injects faults in the traffic of a connector to its origins: latency, jitter, dropped datagrams and
+// failures to dial origins. It's meant for staging connectors, to rehearse how the applications behind a tunnel handle
+// failures.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrInjectedDialFailure is the error of the dials to origins that are failed on purpose
+var ErrInjectedDialFailure = errors.New("the connection to the origin was failed by chaos testing")
+
+// Config is the faults to inject
+type Config struct {
+	// Latency is added to requests and streams to origins, and to the datagrams sent to origins
+	Latency time.Duration
+	// Jitter is the maximum random variation of the latency, in both directions
+	Jitter time.Duration
+	// DatagramDropRate is the rate of datagrams dropped, in both directions, between 0 and 1
+	DatagramDropRate float64
+	// DialFailureRate is the rate of requests and streams failing to reach their origin, between 0 and 1
+	DialFailureRate float64
+}
+
+func (c Config) validate() error {
+	if c.Latency < 0 || c.Jitter < 0 {
+		return fmt.Errorf("the latency and jitter can't be negative")
+	}
+	if c.DatagramDropRate < 0 || c.DatagramDropRate > 1 {
+		return fmt.Errorf("the datagram drop rate %v must be between 0 and 1", c.DatagramDropRate)
+	}
+	if c.DialFailureRate < 0 || c.DialFailureRate > 1 {
+		return fmt.Errorf("the dial failure rate %v must be between 0 and 1", c.DialFailureRate)
+	}
+	return nil
+}
+
+func (c Config) injectsFaults() bool {
+	return c.Latency > 0 || c.Jitter > 0 || c.DatagramDropRate > 0 || c.DialFailureRate > 0
+}
+
+// Injector decides which faults to inject. A nil Injector injects no faults.
+type Injector struct {
+	config Config
+
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+// NewInjector returns an Injector of the faults of config, or nil if config has no faults.
+func NewInjector(config Config) (*Injector, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if !config.injectsFaults() {
+		return nil, nil
+	}
+	return &Injector{
+		config: config,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+func (i *Injector) String() string {
+	return fmt.Sprintf("latency %s ± %s, %.1f%% of datagrams dropped, %.1f%% of dials failed",
+		i.config.Latency, i.config.Jitter, i.config.DatagramDropRate*100, i.config.DialFailureRate*100)
+}
+
+// Dial delays a request or stream to an origin by the latency, then fails it at the dial failure rate.
+func (i *Injector) Dial(ctx context.Context) error {
+	if i == nil {
+		return nil
+	}
+	if delay := i.Delay(); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if i.chance(i.config.DialFailureRate) {
+		return ErrInjectedDialFailure
+	}
+	return nil
+}
+
+// Delay returns the latency with a random jitter
+func (i *Injector) Delay() time.Duration {
+	if i == nil {
+		return 0
+	}
+	delay := i.config.Latency
+	if i.config.Jitter > 0 {
+		i.lock.Lock()
+		delay += time.Duration(i.rand.Int63n(int64(2*i.config.Jitter)+1)) - i.config.Jitter
+		i.lock.Unlock()
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// DropDatagram reports whether to drop a datagram, at the datagram drop rate
+func (i *Injector) DropDatagram() bool {
+	return i != nil && i.chance(i.config.DatagramDropRate)
+}
+
+func (i *Injector) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.rand.Float64() < rate
+}
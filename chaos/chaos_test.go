@@ -0,0 +1,66 @@
+package chaos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInjector(t *testing.T) {
+	injector, err := NewInjector(Config{})
+	require.NoError(t, err)
+	assert.Nil(t, injector)
+	// A nil injector injects no faults
+	assert.NoError(t, injector.Dial(context.Background()))
+	assert.Zero(t, injector.Delay())
+	assert.False(t, injector.DropDatagram())
+
+	for _, invalid := range []Config{
+		{Latency: -time.Second},
+		{DatagramDropRate: 1.5},
+		{DialFailureRate: -0.1},
+	} {
+		_, err := NewInjector(invalid)
+		assert.Error(t, err)
+	}
+}
+
+func TestInjectorRates(t *testing.T) {
+	injector, err := NewInjector(Config{DatagramDropRate: 0.25, DialFailureRate: 1})
+	require.NoError(t, err)
+	assert.ErrorIs(t, injector.Dial(context.Background()), ErrInjectedDialFailure)
+
+	dropped := 0
+	for i := 0; i < 10000; i++ {
+		if injector.DropDatagram() {
+			dropped++
+		}
+	}
+	assert.InDelta(t, 2500, dropped, 300)
+
+	injector, err = NewInjector(Config{DatagramDropRate: 1})
+	require.NoError(t, err)
+	assert.True(t, injector.DropDatagram())
+	assert.NoError(t, injector.Dial(context.Background()))
+}
+
+func TestInjectorDelay(t *testing.T) {
+	injector, err := NewInjector(Config{Latency: 100 * time.Millisecond, Jitter: 20 * time.Millisecond})
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		delay := injector.Delay()
+		assert.GreaterOrEqual(t, delay, 80*time.Millisecond)
+		assert.LessOrEqual(t, delay, 120*time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, injector.Dial(ctx), context.Canceled)
+
+	start := time.Now()
+	assert.NoError(t, injector.Dial(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond)
+}
@@ -18,8 +18,8 @@ import (
 
 const (
 	LogFieldHost               = "host"
-	cfAccessClientIDHeader     = "Cf-Access-Client-Id"
-	cfAccessClientSecretHeader = "Cf-Access-Client-Secret"
+	cfAccessClientIDHeader     = carrier.CFAccessClientIDHeader
+	cfAccessClientSecretHeader = carrier.CFAccessClientSecretHeader
 )
 
 // StartForwarder starts a client side websocket forward
@@ -29,6 +29,20 @@ func StartForwarder(forwarder config.Forwarder, shutdown <-chan struct{}, log *z
 		return errors.Wrap(err, "error validating origin URL")
 	}
 
+	options, err := forwarderOptions(forwarder, log)
+	if err != nil {
+		return err
+	}
+
+	// we could add a cmd line variable for this bool if we want the SOCK5 server to be on the client side
+	wsConn := carrier.NewWSConnection(log)
+
+	log.Info().Str(LogFieldHost, validURL.Host).Msg("Start Websocket listener")
+	return carrier.StartForwarder(wsConn, validURL.Host, shutdown, options)
+}
+
+// forwarderOptions returns the options connecting to the origin of forwarder
+func forwarderOptions(forwarder config.Forwarder, log *zerolog.Logger) (*carrier.StartOptions, error) {
 	// get the headers from the config file and add to the request
 	headers := make(http.Header)
 	if forwarder.TokenClientID != "" {
@@ -45,12 +59,13 @@ func StartForwarder(forwarder config.Forwarder, shutdown <-chan struct{}, log *z
 		OriginURL: forwarder.URL,
 		Headers:   headers, //TODO: TUN-2688 support custom headers from config file
 	}
-
-	// we could add a cmd line variable for this bool if we want the SOCK5 server to be on the client side
-	wsConn := carrier.NewWSConnection(log)
-
-	log.Info().Str(LogFieldHost, validURL.Host).Msg("Start Websocket listener")
-	return carrier.StartForwarder(wsConn, validURL.Host, shutdown, options)
+	if forwarder.TokenFile != "" {
+		var err error
+		if options.ServiceTokens, err = carrier.NewServiceTokenFile(forwarder.TokenFile, log); err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
 }
 
 // ssh will start a WS proxy server for server mode
@@ -84,6 +99,14 @@ func ssh(c *cli.Context) error {
 		Headers:   headers,
 		Host:      hostname,
 	}
+	if c.IsSet(sshTokenFileFlag) {
+		if c.IsSet(sshTokenIDFlag) || c.IsSet(sshTokenSecretFlag) {
+			return fmt.Errorf("--%s can't be used with --%s or --%s", sshTokenFileFlag, sshTokenIDFlag, sshTokenSecretFlag)
+		}
+		if options.ServiceTokens, err = carrier.NewServiceTokenFile(c.String(sshTokenFileFlag), log); err != nil {
+			return err
+		}
+	}
 
 	if connectTo := c.String(sshConnectTo); connectTo != "" {
 		parts := strings.Split(connectTo, ":")
@@ -121,6 +144,15 @@ func ssh(c *cli.Context) error {
 		return err
 	}
 
+	// The daemon authenticates with the headers of the request, it can't try rotated service tokens
+	if socketPath, ok := daemonSocketPath(c); ok && options.TLSClientConfig == nil && options.ServiceTokens == nil {
+		err := carrier.StartDaemonClient(socketPath, &carrier.StdinoutStream{}, options, log)
+		if err == nil || !errors.Is(err, carrier.ErrDaemonUnavailable) {
+			return err
+		}
+		log.Debug().Err(err).Msg("Access daemon is not running, connecting directly")
+	}
+
 	return carrier.StartClient(wsConn, &carrier.StdinoutStream{}, options)
 }
 
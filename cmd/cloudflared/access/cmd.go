@@ -3,6 +3,7 @@ package access
 import (
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -15,6 +16,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/net/idna"
 
 	"github.com/cloudflare/cloudflared/carrier"
@@ -32,8 +34,12 @@ const (
 	sshHeaderFlag      = "header"
 	sshTokenIDFlag     = "service-token-id"
 	sshTokenSecretFlag = "service-token-secret"
+	sshTokenFileFlag   = "service-token-file"
 	sshGenCertFlag     = "short-lived-cert"
+	sshGenRefreshFlag  = "refresh"
+	sshGenAgentFlag    = "agent"
 	sshConnectTo       = "connect-to"
+	noBrowserFlag      = "no-browser"
 	sshConfigTemplate  = `
 Add to your {{.Home}}/.ssh/config:
 
@@ -92,6 +98,13 @@ func Commands() []*cli.Command {
 					Once authenticated with your identity provider, the login command will generate a JSON Web Token (JWT)
 					scoped to your identity, the application you intend to reach, and valid for a session duration set by your
 					administrator. cloudflared stores the token in local storage.`,
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:    noBrowserFlag,
+							Usage:   "log in from a browser on another device, e.g. on a headless server. This is the default without a display or over SSH.",
+							EnvVars: []string{"TUNNEL_LOGIN_NO_BROWSER"},
+						},
+					},
 				},
 				{
 					Name:   "curl",
@@ -153,6 +166,11 @@ func Commands() []*cli.Command {
 							Usage:   "specify an Access service token secret you wish to use.",
 							EnvVars: []string{"TUNNEL_SERVICE_TOKEN_SECRET"},
 						},
+						&cli.StringFlag{
+							Name:    sshTokenFileFlag,
+							Usage:   "specify a YAML or JSON file with the clientID and clientSecret of an Access service token, and optionally the next tokens to try under next. The file is read again when it changes, so tokens can be rotated without restarting.",
+							EnvVars: []string{"TUNNEL_SERVICE_TOKEN_FILE"},
+						},
 						&cli.StringFlag{
 							Name:    logger.LogSSHDirectoryFlag,
 							Aliases: []string{"logfile"}, //added to match the tunnel side
@@ -168,6 +186,128 @@ func Commands() []*cli.Command {
 							Hidden: true,
 							Usage:  "Connect to alternate location for testing, value is host, host:port, or sni:port:host",
 						},
+						&cli.StringFlag{
+							Name:    sshDaemonSocketFlag,
+							Usage:   "specify the socket of an access daemon to connect through its pool of connections, started with access daemon. Connects directly if the daemon isn't running.",
+							EnvVars: []string{"TUNNEL_ACCESS_DAEMON_SOCKET"},
+						},
+					},
+				},
+				{
+					Name:   "socks5",
+					Action: cliutil.Action(socks5),
+					Usage:  "socks5 --hostname <hostname> --network <cidr> [--listener <address>]",
+					Description: `The socks5 subcommand runs a local SOCKS5 server. Connections to the --network CIDRs, or to hostnames of
+					the --domain suffixes, are carried to the bastion of an Access application, i.e. a tunnel ingress rule with the
+					bastion service, which connects them to their destination in the private network. Other connections are made
+					directly. This lets tools supporting SOCKS reach internal services without WARP.`,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    sshHostnameFlag,
+							Aliases: []string{"tunnel-host", "T"},
+							Usage:   "specify the hostname of the Access application served by a bastion.",
+						},
+						&cli.StringFlag{
+							Name:    socksListenerFlag,
+							Aliases: []string{"L"},
+							Usage:   "specify the host:port to listen on for SOCKS5 clients.",
+							Value:   socksListenerDefault,
+						},
+						&cli.StringSliceFlag{
+							Name:  socksNetworkFlag,
+							Usage: "specify a CIDR of the private network to reach through the bastion, e.g. 10.0.0.0/8. Can be repeated.",
+						},
+						&cli.StringSliceFlag{
+							Name:  socksDomainFlag,
+							Usage: "specify a domain whose hostnames are resolved and reached through the bastion, e.g. internal.example.com. Can be repeated.",
+						},
+						&cli.StringSliceFlag{
+							Name:    sshHeaderFlag,
+							Aliases: []string{"H"},
+							Usage:   "specify additional headers you wish to send.",
+						},
+						&cli.StringFlag{
+							Name:    sshTokenIDFlag,
+							Aliases: []string{"id"},
+							Usage:   "specify an Access service token ID you wish to use.",
+							EnvVars: []string{"TUNNEL_SERVICE_TOKEN_ID"},
+						},
+						&cli.StringFlag{
+							Name:    sshTokenSecretFlag,
+							Aliases: []string{"secret"},
+							Usage:   "specify an Access service token secret you wish to use.",
+							EnvVars: []string{"TUNNEL_SERVICE_TOKEN_SECRET"},
+						},
+						&cli.StringFlag{
+							Name:    sshTokenFileFlag,
+							Usage:   "specify a YAML or JSON file with the service tokens to use, see access tcp --help.",
+							EnvVars: []string{"TUNNEL_SERVICE_TOKEN_FILE"},
+						},
+						&cli.StringFlag{
+							Name:    logger.LogSSHDirectoryFlag,
+							Aliases: []string{"logfile"},
+							Usage:   "Save application log to this directory for reporting issues.",
+						},
+						&cli.StringFlag{
+							Name:    logger.LogSSHLevelFlag,
+							Aliases: []string{"loglevel"},
+							Usage:   "Application logging level {debug, info, warn, error, fatal}. ",
+						},
+					},
+				},
+				{
+					Name:   "daemon",
+					Action: cliutil.Action(daemon),
+					Usage:  "daemon [--socket <path>]",
+					Description: `The daemon subcommand keeps an authenticated connection to each Access application open, and
+					multiplexes the data of tcp subcommands started with --daemon-socket over it. This avoids the TLS handshake and
+					Access authentication of each new session, e.g. when opening many SSH sessions with a ProxyCommand. When the
+					cloudflared serving the application doesn't multiplex streams, connections are opened ahead of time instead.`,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    daemonSocketFlag,
+							Usage:   "specify the unix socket to listen on for tcp subcommands.",
+							Value:   daemonSocketDefault,
+							EnvVars: []string{"TUNNEL_ACCESS_DAEMON_SOCKET"},
+						},
+						&cli.IntFlag{
+							Name:  daemonPoolSizeFlag,
+							Usage: "specify the number of idle connections kept open to each application that doesn't multiplex streams.",
+							Value: carrier.PoolSizeDefault,
+						},
+						&cli.DurationFlag{
+							Name:  daemonIdleTimeoutFlag,
+							Usage: "specify how long idle connections are kept open.",
+							Value: carrier.PoolIdleTimeoutDefault,
+						},
+					},
+				},
+				{
+					Name:      "serve",
+					Action:    cliutil.Action(serve),
+					Usage:     "serve [--metrics <address>] <config file>",
+					ArgsUsage: "<config file>",
+					Description: `The serve subcommand opens the local listeners of a YAML config file, each forwarding its connections to
+					an Access application, instead of running an access tcp command per application. For example:
+
+					listeners:
+					  - name: prod-db
+					    url: db.example.com
+					    listener: localhost:5432
+					  - name: jump
+					    protocol: ssh
+					    url: ssh.example.com
+					    listener: localhost:2222
+					    serviceTokenFile: /etc/cloudflared/ssh-token.yaml
+
+					Each listener accepts the protocol (tcp, ssh, rdp or smb), destination, serviceTokenID, serviceTokenSecret and
+					serviceTokenFile options of access tcp. The metrics of each listener are labelled with its name.`,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    serveMetricsFlag,
+							Usage:   "Listen address for metrics reporting, disabled if empty.",
+							EnvVars: []string{"TUNNEL_ACCESS_METRICS"},
+						},
 					},
 				},
 				{
@@ -187,15 +327,24 @@ func Commands() []*cli.Command {
 					},
 				},
 				{
-					Name:        "ssh-gen",
-					Action:      cliutil.Action(sshGen),
-					Usage:       "",
-					Description: `Generates a short lived certificate for given hostname`,
+					Name:   "ssh-gen",
+					Action: cliutil.Action(sshGen),
+					Usage:  "",
+					Description: `Generates a short lived certificate for given hostname. With --refresh, keeps running and signs a new
+					certificate before the current one expires, so that new sessions never find an expired certificate.`,
 					Flags: []cli.Flag{
 						&cli.StringFlag{
 							Name:  sshHostnameFlag,
 							Usage: "specify the hostname of your application.",
 						},
+						&cli.BoolFlag{
+							Name:  sshGenRefreshFlag,
+							Usage: "keep running and renew the certificate in the background before it expires.",
+						},
+						&cli.BoolFlag{
+							Name:  sshGenAgentFlag,
+							Usage: "add the key and certificate to the SSH agent of SSH_AUTH_SOCK, again after each renewal.",
+						},
 					},
 				},
 			},
@@ -210,6 +359,9 @@ func login(c *cli.Context) error {
 	}
 
 	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+	if c.Bool(noBrowserFlag) {
+		token.SetHeadless()
+	}
 
 	args := c.Args()
 	rawURL := ensureURLScheme(args.First())
@@ -386,7 +538,12 @@ func sshGen(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	cfdToken, err := token.FetchTokenWithRedirect(fetchTokenURL, appInfo, log)
+	getToken := func() (string, error) {
+		fetchTokenURL := &url.URL{}
+		*fetchTokenURL = *originURL
+		return token.FetchTokenWithRedirect(fetchTokenURL, appInfo, log)
+	}
+	cfdToken, err := getToken()
 	if err != nil {
 		return err
 	}
@@ -395,10 +552,39 @@ func sshGen(c *cli.Context) error {
 		return err
 	}
 
+	var onRenew func() error
+	if c.Bool(sshGenAgentFlag) {
+		onRenew = func() error {
+			return addCertificateToAgent(originURL)
+		}
+		if err := onRenew(); err != nil {
+			return err
+		}
+	}
+
+	if c.Bool(sshGenRefreshFlag) {
+		return sshgen.RenewShortLivedCertificate(originURL, getToken, onRenew, shutdownC, log)
+	}
 	return nil
 }
 
-// getAppURL will pull the request URL needed for fetching a user's Access token
+// addCertificateToAgent adds the short lived certificate of appURL to the SSH agent of SSH_AUTH_SOCK
+func addCertificateToAgent(appURL *url.URL) error {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return errors.New("SSH_AUTH_SOCK is not set, start an SSH agent to use --agent")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to the SSH agent")
+	}
+	defer conn.Close()
+	return sshgen.AddShortLivedCertificateToAgent(appURL, agent.NewClient(conn))
+}
+
+// getAppURL will pull the request URL needed for fetching a user's Access token.
+// The URL is usually the first argument, otherwise the first http or https URL of cmdArgs
+// is used, so that curl options can be given before the URL.
 func getAppURL(cmdArgs []string, log *zerolog.Logger) (*url.URL, error) {
 	if len(cmdArgs) < 1 {
 		log.Error().Msg("Please provide a valid URL as the first argument to curl.")
@@ -406,12 +592,20 @@ func getAppURL(cmdArgs []string, log *zerolog.Logger) (*url.URL, error) {
 	}
 
 	u, err := processURL(cmdArgs[0])
-	if err != nil {
-		log.Error().Msg("Please provide a valid URL as the first argument to curl.")
-		return nil, err
+	if err == nil {
+		return u, nil
+	}
+	for _, arg := range cmdArgs[1:] {
+		if !strings.HasPrefix(arg, "https://") && !strings.HasPrefix(arg, "http://") {
+			continue
+		}
+		if u, urlErr := processURL(arg); urlErr == nil {
+			return u, nil
+		}
 	}
 
-	return u, err
+	log.Error().Msg("Please provide a valid URL as the first argument to curl.")
+	return nil, err
 }
 
 // parseAllowRequest will parse cmdArgs and return a copy of the args and result
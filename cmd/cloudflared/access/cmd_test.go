@@ -1,6 +1,10 @@
 package access
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+)
 
 func Test_ensureURLScheme(t *testing.T) {
 	type args struct {
@@ -23,3 +27,29 @@ func Test_ensureURLScheme(t *testing.T) {
 		})
 	}
 }
+
+func Test_getAppURL(t *testing.T) {
+	log := zerolog.Nop()
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{"url first", []string{"https://app.example.com/api", "-X", "POST"}, "https://app.example.com/api", false},
+		{"options first", []string{"-sS", "-X", "POST", "https://app.example.com/api"}, "https://app.example.com/api", false},
+		{"no url", []string{"-sS", "app.example.com"}, "", true},
+		{"no args", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getAppURL(tt.args, &log)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getAppURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("getAppURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package access
+
+import (
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/carrier"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/logger"
+)
+
+const (
+	daemonSocketFlag      = "socket"
+	daemonPoolSizeFlag    = "pool-size"
+	daemonIdleTimeoutFlag = "idle-timeout"
+	sshDaemonSocketFlag   = "daemon-socket"
+
+	daemonSocketDefault = "~/.cloudflared/access.sock"
+)
+
+// daemon serves ProxyCommand invocations started with --daemon-socket over a pool of authenticated WebSocket
+// connections, multiplexing them when possible, so that each new session doesn't wait for its own handshakes
+func daemon(c *cli.Context) error {
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+
+	socketPath, err := homedir.Expand(c.String(daemonSocketFlag))
+	if err != nil {
+		return errors.Wrap(err, "invalid daemon socket path")
+	}
+	// Only the user running the daemon can use its credentials
+	listener, err := cliutil.ListenPrivateSocket(socketPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to listen on the daemon socket")
+	}
+
+	pool := carrier.NewPool(c.Int(daemonPoolSizeFlag), c.Duration(daemonIdleTimeoutFlag), log)
+	log.Info().Str("socket", socketPath).Msg("Starting access daemon")
+	return carrier.ServeDaemon(pool, listener, shutdownC, log)
+}
+
+// daemonSocketPath returns the socket of the access daemon to carry the stream of the tcp subcommand with, if any
+func daemonSocketPath(c *cli.Context) (string, bool) {
+	if !c.IsSet(sshDaemonSocketFlag) {
+		return "", false
+	}
+	socketPath, err := homedir.Expand(c.String(sshDaemonSocketFlag))
+	if err != nil {
+		return "", false
+	}
+	return socketPath, true
+}
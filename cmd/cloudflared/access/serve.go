@@ -0,0 +1,282 @@
+package access
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/cloudflare/cloudflared/carrier"
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/logger"
+	"github.com/cloudflare/cloudflared/metrics"
+	"github.com/cloudflare/cloudflared/validation"
+)
+
+const (
+	serveMetricsFlag = "metrics"
+
+	metricsNamespace = "cloudflared"
+	accessSubsystem  = "access"
+)
+
+// serveConfig is the format of the file of access serve
+type serveConfig struct {
+	Listeners []serveListener `yaml:"listeners"`
+}
+
+// serveListener is a local listener of access serve forwarding connections to an Access application
+type serveListener struct {
+	// Name of the listener in logs and metrics, the listen address by default
+	Name string `yaml:"name"`
+	// Protocol carried by the listener, one of tcp, ssh, rdp or smb
+	Protocol         string `yaml:"protocol"`
+	config.Forwarder `yaml:",inline"`
+}
+
+var serveProtocols = map[string]bool{"tcp": true, "ssh": true, "rdp": true, "smb": true}
+
+var (
+	serveConnections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: accessSubsystem,
+			Name:      "connections_total",
+			Help:      "Count of connections accepted by access serve listeners",
+		},
+		[]string{"listener", "protocol"},
+	)
+	serveConnectionErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: accessSubsystem,
+			Name:      "connection_errors_total",
+			Help:      "Count of connections of access serve listeners that failed to reach the Access application",
+		},
+		[]string{"listener", "protocol"},
+	)
+	serveActiveConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: accessSubsystem,
+			Name:      "active_connections",
+			Help:      "Number of open connections of access serve listeners",
+		},
+		[]string{"listener", "protocol"},
+	)
+	serveBytesSent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: accessSubsystem,
+			Name:      "sent_bytes_total",
+			Help:      "Count of bytes sent to Access applications by access serve listeners",
+		},
+		[]string{"listener", "protocol"},
+	)
+	serveBytesReceived = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: accessSubsystem,
+			Name:      "received_bytes_total",
+			Help:      "Count of bytes received from Access applications by access serve listeners",
+		},
+		[]string{"listener", "protocol"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		serveConnections,
+		serveConnectionErrors,
+		serveActiveConnections,
+		serveBytesSent,
+		serveBytesReceived,
+	)
+}
+
+// serve opens the listeners of a config file, each forwarding its connections to an Access application, as many
+// access tcp commands would
+func serve(c *cli.Context) error {
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+
+	if c.NArg() != 1 {
+		return cli.ShowCommandHelp(c, "serve")
+	}
+	serveConfig, err := readServeConfig(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	// Open all the listeners first so that a listener that can't be opened doesn't leave the others running
+	listeners := make([]net.Listener, 0, len(serveConfig.Listeners))
+	defer func() {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+	}()
+	options := make([]*carrier.StartOptions, 0, len(serveConfig.Listeners))
+	for _, l := range serveConfig.Listeners {
+		validURL, err := validation.ValidateUrl(l.Listener)
+		if err != nil {
+			return errors.Wrapf(err, "invalid listen address of %s", l.Name)
+		}
+		listener, err := net.Listen("tcp", validURL.Host)
+		if err != nil {
+			return errors.Wrapf(err, "failed to listen for %s", l.Name)
+		}
+		listeners = append(listeners, listener)
+
+		listenerOptions, err := forwarderOptions(l.Forwarder, log)
+		if err != nil {
+			return errors.Wrapf(err, "invalid listener %s", l.Name)
+		}
+		options = append(options, listenerOptions)
+	}
+
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopAll := func() { stopOnce.Do(func() { close(stop) }) }
+	var group errgroup.Group
+
+	if address := c.String(serveMetricsFlag); address != "" {
+		metricsListener, err := net.Listen("tcp", address)
+		if err != nil {
+			return errors.Wrap(err, "failed to listen for metrics")
+		}
+		group.Go(func() error {
+			return metrics.ServeMetrics(metricsListener, stop, metrics.Config{}, log)
+		})
+	}
+
+	for i, l := range serveConfig.Listeners {
+		l, listener, options := l, listeners[i], options[i]
+		conn := &meteredConnection{
+			Connection: carrier.NewWSConnection(log),
+			labels:     prometheus.Labels{"listener": l.Name, "protocol": l.Protocol},
+		}
+		log.Info().Str("listener", l.Name).Str(LogFieldHost, listener.Addr().String()).Str(carrier.LogFieldOriginURL, options.OriginURL).Msg("Start Websocket listener")
+		group.Go(func() error {
+			err := carrier.Serve(conn, listener, stop, options)
+			// Serve only returns before stop when the listener fails
+			stopAll()
+			return errors.Wrapf(err, "listener %s failed", l.Name)
+		})
+	}
+	listeners = nil
+
+	go func() {
+		select {
+		case <-shutdownC:
+			stopAll()
+		case <-stop:
+		}
+	}()
+	return group.Wait()
+}
+
+// readServeConfig reads and validates the config file of access serve
+func readServeConfig(path string) (*serveConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read access serve config")
+	}
+	defer file.Close()
+
+	var serveConfig serveConfig
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&serveConfig); err != nil {
+		return nil, errors.Wrap(err, "failed to parse access serve config")
+	}
+	if len(serveConfig.Listeners) == 0 {
+		return nil, errors.Errorf("access serve config %s has no listener", path)
+	}
+
+	names := make(map[string]bool, len(serveConfig.Listeners))
+	for i := range serveConfig.Listeners {
+		l := &serveConfig.Listeners[i]
+		if l.Listener == "" || l.URL == "" {
+			return nil, errors.Errorf("listener %d of %s needs a listener address and an Access application url", i, path)
+		}
+		if l.Name == "" {
+			l.Name = l.Listener
+		}
+		if names[l.Name] {
+			return nil, errors.Errorf("%s has several listeners named %s", path, l.Name)
+		}
+		names[l.Name] = true
+
+		if l.Protocol == "" {
+			l.Protocol = "tcp"
+		}
+		if l.Protocol == "udp" {
+			return nil, errors.Errorf("listener %s: Access applications only carry TCP streams, udp isn't supported", l.Name)
+		}
+		if !serveProtocols[l.Protocol] {
+			return nil, errors.Errorf("listener %s has unknown protocol %s, use tcp, ssh, rdp or smb", l.Name, l.Protocol)
+		}
+		if l.TokenFile != "" && (l.TokenClientID != "" || l.TokenSecret != "") {
+			return nil, errors.Errorf("listener %s can't have both a service token and a service token file", l.Name)
+		}
+		l.URL = ensureURLScheme(l.URL)
+	}
+	return &serveConfig, nil
+}
+
+// meteredConnection records the metrics of the listener of the connections it carries
+type meteredConnection struct {
+	carrier.Connection
+	labels prometheus.Labels
+}
+
+// ServeStream carries conn and records its metrics
+func (c *meteredConnection) ServeStream(options *carrier.StartOptions, conn io.ReadWriter) error {
+	serveConnections.With(c.labels).Inc()
+	active := serveActiveConnections.With(c.labels)
+	active.Inc()
+	defer active.Dec()
+
+	err := c.Connection.ServeStream(options, &meteredStream{
+		ReadWriter: conn,
+		sent:       serveBytesSent.With(c.labels),
+		received:   serveBytesReceived.With(c.labels),
+	})
+	if err != nil {
+		serveConnectionErrors.With(c.labels).Inc()
+	}
+	return err
+}
+
+// meteredStream counts the bytes read from a local connection, which are sent to the application, and the bytes
+// written to it, which were received from the application
+type meteredStream struct {
+	io.ReadWriter
+	sent     prometheus.Counter
+	received prometheus.Counter
+}
+
+func (s *meteredStream) Read(p []byte) (int, error) {
+	n, err := s.ReadWriter.Read(p)
+	s.sent.Add(float64(n))
+	return n, err
+}
+
+func (s *meteredStream) Write(p []byte) (int, error) {
+	n, err := s.ReadWriter.Write(p)
+	s.received.Add(float64(n))
+	return n, err
+}
+
+// CloseWrite half-closes the local connection if it supports it
+func (s *meteredStream) CloseWrite() error {
+	if conn, ok := s.ReadWriter.(interface{ CloseWrite() error }); ok {
+		return conn.CloseWrite()
+	}
+	return errors.New("the connection can't be half-closed")
+}
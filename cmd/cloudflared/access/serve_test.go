@@ -0,0 +1,96 @@
+package access
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/carrier"
+)
+
+func writeServeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "serve.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestReadServeConfig(t *testing.T) {
+	serveConfig, err := readServeConfig(writeServeConfig(t, `
+listeners:
+  - url: db.example.com
+    listener: localhost:5432
+  - name: jump
+    protocol: ssh
+    url: https://ssh.example.com
+    listener: localhost:2222
+    destination: bastion.internal:22
+    serviceTokenFile: /etc/cloudflared/token.yaml
+`))
+	require.NoError(t, err)
+	require.Len(t, serveConfig.Listeners, 2)
+
+	db := serveConfig.Listeners[0]
+	assert.Equal(t, "localhost:5432", db.Name)
+	assert.Equal(t, "tcp", db.Protocol)
+	assert.Equal(t, "https://db.example.com", db.URL)
+
+	jump := serveConfig.Listeners[1]
+	assert.Equal(t, "jump", jump.Name)
+	assert.Equal(t, "ssh", jump.Protocol)
+	assert.Equal(t, "https://ssh.example.com", jump.URL)
+	assert.Equal(t, "bastion.internal:22", jump.Destination)
+	assert.Equal(t, "/etc/cloudflared/token.yaml", jump.TokenFile)
+}
+
+func TestReadServeConfigInvalid(t *testing.T) {
+	tests := map[string]string{
+		"no listener":    "listeners: []\n",
+		"unknown field":  "listeners:\n  - url: a.example.com\n    listener: localhost:1\n    hostname: a.example.com\n",
+		"no url":         "listeners:\n  - listener: localhost:1\n",
+		"duplicate name": "listeners:\n  - url: a.example.com\n    listener: localhost:1\n  - url: b.example.com\n    listener: localhost:1\n",
+		"udp":            "listeners:\n  - url: a.example.com\n    listener: localhost:1\n    protocol: udp\n",
+		"unknown":        "listeners:\n  - url: a.example.com\n    listener: localhost:1\n    protocol: ftp\n",
+		"two tokens":     "listeners:\n  - url: a.example.com\n    listener: localhost:1\n    serviceTokenID: id\n    serviceTokenFile: token.yaml\n",
+	}
+	for name, content := range tests {
+		_, err := readServeConfig(writeServeConfig(t, content))
+		assert.Error(t, err, name)
+	}
+}
+
+// echoConnection writes back what it reads from streams
+type echoConnection struct{}
+
+func (echoConnection) ServeStream(options *carrier.StartOptions, stream io.ReadWriter) error {
+	_, err := io.Copy(stream, stream)
+	return err
+}
+
+type testStream struct {
+	io.Reader
+	io.Writer
+}
+
+func TestMeteredConnection(t *testing.T) {
+	labels := prometheus.Labels{"listener": "test-metered", "protocol": "tcp"}
+	conn := &meteredConnection{Connection: echoConnection{}, labels: labels}
+
+	input := "hello"
+	var output bytes.Buffer
+	require.NoError(t, conn.ServeStream(&carrier.StartOptions{}, &testStream{Reader: strings.NewReader(input), Writer: &output}))
+	assert.Equal(t, input, output.String())
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(serveConnections.With(labels)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(serveActiveConnections.With(labels)))
+	assert.Equal(t, float64(len(input)), testutil.ToFloat64(serveBytesSent.With(labels)))
+	assert.Equal(t, float64(len(input)), testutil.ToFloat64(serveBytesReceived.With(labels)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(serveConnectionErrors.With(labels)))
+}
@@ -0,0 +1,74 @@
+package access
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/carrier"
+	"github.com/cloudflare/cloudflared/logger"
+	"github.com/cloudflare/cloudflared/validation"
+)
+
+const (
+	socksListenerFlag = "listener"
+	socksNetworkFlag  = "network"
+	socksDomainFlag   = "domain"
+
+	socksListenerDefault = "localhost:1080"
+)
+
+// socks5 serves SOCKS5 clients locally, connecting them to private networks through an Access application served by a
+// tunnel in bastion mode
+func socks5(c *cli.Context) error {
+	log := logger.CreateSSHLoggerFromContext(c, logger.EnableTerminalLog)
+
+	rawHostName := c.String(sshHostnameFlag)
+	hostname, err := validation.ValidateHostname(rawHostName)
+	if err != nil || rawHostName == "" {
+		return cli.ShowCommandHelp(c, "socks5")
+	}
+
+	networks := make([]*net.IPNet, 0, len(c.StringSlice(socksNetworkFlag)))
+	for _, cidr := range c.StringSlice(socksNetworkFlag) {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return errors.Wrapf(err, "invalid --%s", socksNetworkFlag)
+		}
+		networks = append(networks, network)
+	}
+	if len(networks) == 0 && len(c.StringSlice(socksDomainFlag)) == 0 {
+		return fmt.Errorf("specify the private networks to reach with --%s or --%s", socksNetworkFlag, socksDomainFlag)
+	}
+
+	headers := buildRequestHeaders(c.StringSlice(sshHeaderFlag))
+	if c.IsSet(sshTokenIDFlag) {
+		headers.Set(cfAccessClientIDHeader, c.String(sshTokenIDFlag))
+	}
+	if c.IsSet(sshTokenSecretFlag) {
+		headers.Set(cfAccessClientSecretHeader, c.String(sshTokenSecretFlag))
+	}
+	options := &carrier.StartOptions{
+		OriginURL: ensureURLScheme(hostname),
+		Headers:   headers,
+		Host:      hostname,
+	}
+	if c.IsSet(sshTokenFileFlag) {
+		if c.IsSet(sshTokenIDFlag) || c.IsSet(sshTokenSecretFlag) {
+			return fmt.Errorf("--%s can't be used with --%s or --%s", sshTokenFileFlag, sshTokenIDFlag, sshTokenSecretFlag)
+		}
+		if options.ServiceTokens, err = carrier.NewServiceTokenFile(c.String(sshTokenFileFlag), log); err != nil {
+			return err
+		}
+	}
+
+	dialer := carrier.NewSocksDialer(options, networks, c.StringSlice(socksDomainFlag), log)
+	listener, err := net.Listen("tcp", c.String(socksListenerFlag))
+	if err != nil {
+		return errors.Wrap(err, "failed to start SOCKS5 server")
+	}
+	log.Info().Str(LogFieldHost, listener.Addr().String()).Msg("Start SOCKS5 server")
+	return carrier.Serve(carrier.NewSocksConnection(dialer, log), listener, shutdownC, options)
+}
@@ -57,8 +57,14 @@ func (s *ResolverService) Shutdown() {
 // Run is the run loop that is started by the overwatch service
 func (s *ResolverService) Run() error {
 	// create a listener
-	l, err := tunneldns.CreateListener(s.resolver.AddressOrDefault(), s.resolver.PortOrDefault(),
-		s.resolver.UpstreamsOrDefault(), s.resolver.BootstrapsOrDefault(), s.resolver.MaxUpstreamConnectionsOrDefault(), s.log)
+	l, err := tunneldns.CreateListener(tunneldns.ListenerConfig{
+		Address:                s.resolver.AddressOrDefault(),
+		Port:                   s.resolver.PortOrDefault(),
+		Upstreams:              s.resolver.UpstreamsOrDefault(),
+		Bootstraps:             s.resolver.BootstrapsOrDefault(),
+		MaxUpstreamConnections: s.resolver.MaxUpstreamConnectionsOrDefault(),
+		Cache:                  tunneldns.DefaultCacheConfig(),
+	}, s.log)
 	if err != nil {
 		return err
 	}
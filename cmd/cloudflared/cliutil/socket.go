@@ -0,0 +1,22 @@
+package cliutil
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// ListenPrivateSocket listens on the unix socket at path, which only the user running cloudflared can connect to. A
+// socket left behind by a process that didn't shut down cleanly is replaced, but not one a process listens on.
+func ListenPrivateSocket(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("a process is already listening on %s", path)
+	}
+	_ = os.Remove(path)
+	return listenPrivateSocket(path)
+}
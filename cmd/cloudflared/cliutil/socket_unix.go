@@ -0,0 +1,22 @@
+//go:build !windows
+
+package cliutil
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// umaskLock serializes the sockets created with a restrictive umask, since the umask is shared by the process
+var umaskLock sync.Mutex
+
+// listenPrivateSocket creates the socket with the permissions 0600 right away, so that there is no window in which
+// other users can connect to it
+func listenPrivateSocket(path string) (net.Listener, error) {
+	umaskLock.Lock()
+	defer umaskLock.Unlock()
+	oldMask := syscall.Umask(0177)
+	defer syscall.Umask(oldMask)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package cliutil
+
+import (
+	"net"
+)
+
+// listenPrivateSocket relies on the socket inheriting the access control list of its directory, created for the user
+// running cloudflared
+func listenPrivateSocket(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 
@@ -28,3 +32,31 @@ func getServiceExtraArgsFromCliArgs(c *cli.Context, log *zerolog.Logger) ([]stri
 		return make([]string, 0), nil
 	}
 }
+
+// serviceEnvFlag sets environment variables of the installed service, on every platform
+const serviceEnvFlag = "env"
+
+func newServiceEnvFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:  serviceEnvFlag,
+		Usage: "Environment variable `KEY=VALUE` of cloudflared when run by the service, e.g. TUNNEL_METRICS=localhost:2000. Can be repeated.",
+	}
+}
+
+// serviceEnv returns the environment variables of --env, sorted by name
+func serviceEnv(c *cli.Context) ([]string, error) {
+	envByKey := make(map[string]string)
+	for _, env := range c.StringSlice(serviceEnvFlag) {
+		key, value, ok := strings.Cut(env, "=")
+		if !ok || key == "" || strings.ContainsAny(env, "\r\n") {
+			return nil, cliutil.UsageError("Invalid --%s %q, expected KEY=VALUE.", serviceEnvFlag, env)
+		}
+		envByKey[key] = value
+	}
+	env := make([]string, 0, len(envByKey))
+	for key, value := range envByKey {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(env)
+	return env, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+)
+
+// The completion scripts ask cloudflared itself for the completions of the command line, by running it with
+// --generate-bash-completion as its last argument, so they also complete the names of tunnels and virtual networks.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for cloudflared
+_cloudflared_completion() {
+	local cur opts
+	COMPREPLY=()
+	cur="${COMP_WORDS[COMP_CWORD]}"
+	if [[ "$cur" == "-"* ]]; then
+		opts=$("${COMP_WORDS[@]:0:$COMP_CWORD}" "$cur" --generate-bash-completion 2>/dev/null)
+	else
+		opts=$("${COMP_WORDS[@]:0:$COMP_CWORD}" --generate-bash-completion 2>/dev/null)
+	fi
+	COMPREPLY=($(compgen -W "$opts" -- "$cur"))
+	return 0
+}
+complete -o bashdefault -o default -F _cloudflared_completion cloudflared
+`,
+	"zsh": `#compdef cloudflared
+# zsh completion for cloudflared
+_cloudflared() {
+	local -a opts
+	local cur
+	cur=${words[-1]}
+	if [[ "$cur" == "-"* ]]; then
+		opts=("${(@f)$(_CLI_ZSH_AUTOCOMPLETE_HACK=1 ${words[@]:0:#words[@]-1} "$cur" --generate-bash-completion 2>/dev/null)}")
+	else
+		opts=("${(@f)$(_CLI_ZSH_AUTOCOMPLETE_HACK=1 ${words[@]:0:#words[@]-1} --generate-bash-completion 2>/dev/null)}")
+	fi
+	if [[ "${opts[1]}" != "" ]]; then
+		_describe 'values' opts
+	else
+		_files
+	fi
+}
+compdef _cloudflared cloudflared
+`,
+	"fish": `# fish completion for cloudflared
+function __cloudflared_complete
+	set -l args (commandline -opc)
+	set -l cur (commandline -ct)
+	if string match -q -- '-*' $cur
+		$args $cur --generate-bash-completion 2>/dev/null
+	else
+		$args --generate-bash-completion 2>/dev/null
+	end
+end
+complete -c cloudflared -f -a '(__cloudflared_complete)'
+`,
+	"powershell": `# PowerShell completion for cloudflared
+Register-ArgumentCompleter -Native -CommandName cloudflared -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+	$words = @($commandAst.CommandElements | Where-Object { $_.Extent.EndOffset -le $cursorPosition } | ForEach-Object { $_.ToString() })
+	if ($wordToComplete -ne '' -and $words.Count -gt 1) {
+		$words = $words[0..($words.Count - 2)]
+	}
+	$arguments = @()
+	if ($words.Count -gt 1) {
+		$arguments = $words[1..($words.Count - 1)]
+	}
+	if ($wordToComplete.StartsWith('-')) {
+		$arguments += $wordToComplete
+	}
+	& $words[0] @arguments --generate-bash-completion 2>$null | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+	}
+}
+`,
+}
+
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+func completionCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "completion",
+		Action:    cliutil.WithErrorHandler(printCompletionScript),
+		Usage:     "Print the script that completes cloudflared commands in a shell",
+		UsageText: "cloudflared completion [" + strings.Join(completionShells, "|") + "]",
+		Description: `Prints the completion script for the given shell. Besides commands and flags, it completes the names of
+tunnels and virtual networks, which are cached for an hour from the credentials files and the API.
+
+To load the completions in the current shell:
+  bash:       source <(cloudflared completion bash)
+  zsh:        source <(cloudflared completion zsh)
+  fish:       cloudflared completion fish | source
+  powershell: cloudflared completion powershell | Out-String | Invoke-Expression`,
+		BashComplete: func(c *cli.Context) {
+			if c.NArg() == 0 {
+				for _, shell := range completionShells {
+					fmt.Fprintln(c.App.Writer, shell)
+				}
+			}
+		},
+	}
+}
+
+func printCompletionScript(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cliutil.UsageError(`"cloudflared completion" requires exactly 1 argument, the shell: %s`, strings.Join(completionShells, ", "))
+	}
+	script, ok := completionScripts[c.Args().First()]
+	if !ok {
+		return cliutil.UsageError("%s isn't a supported shell, use one of: %s", c.Args().First(), strings.Join(completionShells, ", "))
+	}
+	_, err := fmt.Fprint(c.App.Writer, script)
+	return err
+}
@@ -6,6 +6,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
@@ -25,6 +27,29 @@ func runApp(app *cli.App, graceShutdownC chan struct{}) {
 				Name:   "install",
 				Usage:  "Install cloudflared as a system service",
 				Action: cliutil.ConfiguredAction(installLinuxService),
+				Flags: []cli.Flag{
+					newServiceEnvFlag(),
+					&cli.StringSliceFlag{
+						Name:  afterFlag,
+						Usage: "Start the systemd service after this `UNIT`, e.g. a VPN or the origin service. Can be repeated.",
+					},
+					&cli.StringFlag{
+						Name:  limitNOFileFlag,
+						Usage: "Maximum number of open files of the systemd service, its LimitNOFILE directive.",
+					},
+					&cli.StringFlag{
+						Name:  memoryMaxFlag,
+						Usage: "Maximum memory of the systemd service, its MemoryMax directive, e.g. 512M.",
+					},
+					&cli.StringFlag{
+						Name:  cpuQuotaFlag,
+						Usage: "CPU time quota of the systemd service, its CPUQuota directive, e.g. 200%.",
+					},
+					&cli.StringSliceFlag{
+						Name:  serviceDirectiveFlag,
+						Usage: "Extra `DIRECTIVE=VALUE` of the [Service] section of the systemd unit, e.g. Nice=5. Can be repeated.",
+					},
+				},
 			},
 			{
 				Name:   "uninstall",
@@ -46,12 +71,21 @@ const (
 	cloudflaredService    = "cloudflared.service"
 )
 
+// Flags of service install customizing the systemd unit
+const (
+	afterFlag            = "after"
+	limitNOFileFlag      = "limit-nofile"
+	memoryMaxFlag        = "memory-max"
+	cpuQuotaFlag         = "cpu-quota"
+	serviceDirectiveFlag = "service-directive"
+)
+
 var systemdTemplates = []ServiceTemplate{
 	{
 		Path: fmt.Sprintf("/etc/systemd/system/%s", cloudflaredService),
 		Content: `[Unit]
 Description=cloudflared
-After=network.target
+After=network.target{{ range .After }} {{ . }}{{ end }}
 
 [Service]
 TimeoutStartSec=0
@@ -59,6 +93,12 @@ Type=notify
 ExecStart={{ .Path }} --no-autoupdate{{ range .ExtraArgs }} {{ . }}{{ end }}
 Restart=on-failure
 RestartSec=5s
+{{- range .Env }}
+Environment={{ systemdQuote . }}
+{{- end }}
+{{- range .ServiceDirectives }}
+{{ . }}
+{{- end }}
 
 [Install]
 WantedBy=multi-user.target
@@ -110,6 +150,9 @@ cmd="{{.Path}} --pidfile /var/run/$name.pid --autoupdate-freq 24h0m0s{{ range .E
 pid_file="/var/run/$name.pid"
 stdout_log="/var/log/$name.log"
 stderr_log="/var/log/$name.err"
+{{- range .Env }}
+export {{ shellQuote . }}
+{{- end }}
 [ -e /etc/sysconfig/$name ] && . /etc/sysconfig/$name
 get_pid() {
     cat "$pid_file"
@@ -209,13 +252,24 @@ func installLinuxService(c *cli.Context) error {
 	}
 
 	templateArgs.ExtraArgs = extraArgs
+	if templateArgs.Env, err = serviceEnv(c); err != nil {
+		return err
+	}
 
 	switch {
 	case isSystemd():
 		log.Info().Msgf("Using Systemd")
+		if err := setSystemdUnitOptions(c, &templateArgs); err != nil {
+			return err
+		}
 		err = installSystemd(&templateArgs, log)
 	default:
 		log.Info().Msgf("Using SysV")
+		for _, flag := range []string{afterFlag, limitNOFileFlag, memoryMaxFlag, cpuQuotaFlag, serviceDirectiveFlag} {
+			if c.IsSet(flag) {
+				log.Warn().Msgf("--%s only applies to systemd services, it's ignored", flag)
+			}
+		}
 		err = installSysv(&templateArgs, log)
 	}
 
@@ -261,6 +315,34 @@ credentials-file: CREDENTIALS-FILE
 	}, nil
 }
 
+// setSystemdUnitOptions sets the options of the systemd unit from the flags of service install
+func setSystemdUnitOptions(c *cli.Context, templateArgs *ServiceTemplateArgs) error {
+	for _, unit := range c.StringSlice(afterFlag) {
+		if unit == "" || strings.ContainsAny(unit, " \t\r\n") {
+			return cliutil.UsageError("Invalid --%s %q, expected a unit name.", afterFlag, unit)
+		}
+		templateArgs.After = append(templateArgs.After, unit)
+	}
+	for flag, directive := range map[string]string{
+		limitNOFileFlag: "LimitNOFILE",
+		memoryMaxFlag:   "MemoryMax",
+		cpuQuotaFlag:    "CPUQuota",
+	} {
+		if value := c.String(flag); value != "" {
+			templateArgs.ServiceDirectives = append(templateArgs.ServiceDirectives, directive+"="+value)
+		}
+	}
+	sort.Strings(templateArgs.ServiceDirectives)
+	templateArgs.ServiceDirectives = append(templateArgs.ServiceDirectives, c.StringSlice(serviceDirectiveFlag)...)
+	for _, directive := range templateArgs.ServiceDirectives {
+		name, _, ok := strings.Cut(directive, "=")
+		if !ok || name == "" || strings.ContainsAny(directive, "\r\n") {
+			return cliutil.UsageError("Invalid systemd directive %q, expected DIRECTIVE=VALUE.", directive)
+		}
+	}
+	return nil
+}
+
 func installSystemd(templateArgs *ServiceTemplateArgs, log *zerolog.Logger) error {
 	for _, serviceTemplate := range systemdTemplates {
 		err := serviceTemplate.Generate(templateArgs)
@@ -0,0 +1,112 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func newServiceInstallContext(t *testing.T, args ...string) *cli.Context {
+	flagSet := flag.NewFlagSet("test", flag.PanicOnError)
+	flagSet.Var(cli.NewStringSlice(), afterFlag, "")
+	flagSet.String(limitNOFileFlag, "", "")
+	flagSet.String(memoryMaxFlag, "", "")
+	flagSet.String(cpuQuotaFlag, "", "")
+	flagSet.Var(cli.NewStringSlice(), serviceDirectiveFlag, "")
+	flagSet.Var(cli.NewStringSlice(), serviceEnvFlag, "")
+	require.NoError(t, flagSet.Parse(args))
+	return cli.NewContext(cli.NewApp(), flagSet, nil)
+}
+
+func TestSetSystemdUnitOptions(t *testing.T) {
+	c := newServiceInstallContext(t,
+		"--after", "docker.service", "--after", "wg-quick@wg0.service",
+		"--memory-max", "512M", "--limit-nofile", "65535", "--cpu-quota", "50%",
+		"--service-directive", "Nice=5", "--service-directive", "ProtectSystem=strict",
+	)
+	var templateArgs ServiceTemplateArgs
+	require.NoError(t, setSystemdUnitOptions(c, &templateArgs))
+	assert.Equal(t, []string{"docker.service", "wg-quick@wg0.service"}, templateArgs.After)
+	// The directives of flags are sorted, the directives of --service-directive come after them in order
+	assert.Equal(t, []string{"CPUQuota=50%", "LimitNOFILE=65535", "MemoryMax=512M", "Nice=5", "ProtectSystem=strict"}, templateArgs.ServiceDirectives)
+}
+
+func TestSetSystemdUnitOptionsInvalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"--after", ""},
+		{"--after", "docker.service network-online.target"},
+		{"--after", "docker.service\nExecStartPre=/bin/sh"},
+		{"--service-directive", "Nice"},
+		{"--service-directive", "=5"},
+		{"--service-directive", "Nice=5\nExecStartPre=/bin/sh"},
+		{"--memory-max", "512M\nExecStartPre=/bin/sh"},
+	} {
+		var templateArgs ServiceTemplateArgs
+		assert.Error(t, setSystemdUnitOptions(newServiceInstallContext(t, args...), &templateArgs), "%q", args)
+	}
+}
+
+func TestSystemdUnitTemplate(t *testing.T) {
+	c := newServiceInstallContext(t,
+		"--after", "docker.service", "--memory-max", "512M", "--service-directive", "Nice=5",
+		"--env", "TUNNEL_METRICS=localhost:2000", "--env", `PROXY_PASSWORD=50%"\'`,
+	)
+	templateArgs := ServiceTemplateArgs{
+		Path:      "/usr/bin/cloudflared",
+		ExtraArgs: []string{"tunnel", "run", "--token", "eyJh"},
+	}
+	var err error
+	templateArgs.Env, err = serviceEnv(c)
+	require.NoError(t, err)
+	require.NoError(t, setSystemdUnitOptions(c, &templateArgs))
+
+	unit := systemdTemplates[0]
+	unit.Path = filepath.Join(t.TempDir(), cloudflaredService)
+	require.NoError(t, unit.Generate(&templateArgs))
+	content, err := ioutil.ReadFile(unit.Path)
+	require.NoError(t, err)
+	assert.Equal(t, `[Unit]
+Description=cloudflared
+After=network.target docker.service
+
+[Service]
+TimeoutStartSec=0
+Type=notify
+ExecStart=/usr/bin/cloudflared --no-autoupdate tunnel run --token eyJh
+Restart=on-failure
+RestartSec=5s
+Environment="PROXY_PASSWORD=50%%\"\\'"
+Environment="TUNNEL_METRICS=localhost:2000"
+MemoryMax=512M
+Nice=5
+
+[Install]
+WantedBy=multi-user.target
+`, string(content))
+}
+
+func TestSysvTemplate(t *testing.T) {
+	c := newServiceInstallContext(t, "--env", "TUNNEL_METRICS=localhost:2000", "--env", "PROXY_PASSWORD=it's $secret")
+	templateArgs := ServiceTemplateArgs{Path: "/usr/bin/cloudflared"}
+	var err error
+	templateArgs.Env, err = serviceEnv(c)
+	require.NoError(t, err)
+
+	script := sysvTemplate
+	script.Path = filepath.Join(t.TempDir(), "cloudflared")
+	require.NoError(t, script.Generate(&templateArgs))
+	content, err := ioutil.ReadFile(script.Path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `stderr_log="/var/log/$name.err"
+export 'PROXY_PASSWORD=it'\''s $secret'
+export 'TUNNEL_METRICS=localhost:2000'
+[ -e /etc/sysconfig/$name ]`)
+}
@@ -4,8 +4,15 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
 	"fmt"
 	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
@@ -18,6 +25,13 @@ const (
 	launchdIdentifier = "com.cloudflare.cloudflared"
 )
 
+const (
+	launchdThrottleIntervalFlag = "throttle-interval"
+	launchdUnifiedLoggingFlag   = "unified-logging"
+	launchdExitTimeoutFlag      = "exit-timeout"
+	launchdNiceFlag             = "nice"
+)
+
 func runApp(app *cli.App, graceShutdownC chan struct{}) {
 	app.Commands = append(app.Commands, &cli.Command{
 		Name:  "service",
@@ -27,21 +41,57 @@ func runApp(app *cli.App, graceShutdownC chan struct{}) {
 				Name:   "install",
 				Usage:  "Install cloudflared as an user launch agent",
 				Action: cliutil.ConfiguredAction(installLaunchd),
+				Flags: []cli.Flag{
+					newServiceEnvFlag(),
+					&cli.DurationFlag{
+						Name:  launchdThrottleIntervalFlag,
+						Usage: "Minimum time between two starts of cloudflared by launchd, to throttle restarts when it keeps crashing",
+						Value: 5 * time.Second,
+					},
+					&cli.BoolFlag{
+						Name:  launchdUnifiedLoggingFlag,
+						Usage: "Log into the unified logging system instead of log files, read them with: log show --predicate 'process == \"cloudflared\"'",
+					},
+					&cli.DurationFlag{
+						Name:  launchdExitTimeoutFlag,
+						Usage: "Time launchd waits for cloudflared to stop before killing it, its ExitTimeOut key. Set it above --grace-period to drain connections when stopping.",
+					},
+					&cli.IntFlag{
+						Name:  launchdNiceFlag,
+						Usage: "Scheduling priority of cloudflared, its Nice key, from -20 to 19",
+					},
+				},
 			},
 			{
 				Name:   "uninstall",
 				Usage:  "Uninstall the cloudflared launch agent",
 				Action: cliutil.ConfiguredAction(uninstallLaunchd),
 			},
+			{
+				Name:   "status",
+				Usage:  "Show the state of the cloudflared launch agent",
+				Action: cliutil.ConfiguredAction(statusLaunchd),
+			},
 		},
 	})
 	_ = app.Run(os.Args)
 }
 
-func newLaunchdTemplate(installPath, stdoutPath, stderrPath string) *ServiceTemplate {
-	return &ServiceTemplate{
-		Path: installPath,
-		Content: fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+// launchdOptions are the settings of the launchd property list beyond the program to run
+type launchdOptions struct {
+	// stdoutPath and stderrPath are empty to log into the unified logging system
+	stdoutPath       string
+	stderrPath       string
+	env              map[string]string
+	throttleInterval time.Duration
+	// exitTimeout and nice are left to launchd if nil
+	exitTimeout *time.Duration
+	nice        *int
+}
+
+func newLaunchdTemplate(installPath string, options launchdOptions) *ServiceTemplate {
+	var content strings.Builder
+	fmt.Fprintf(&content, `<?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
 <plist version="1.0">
 	<dict>
@@ -56,20 +106,112 @@ func newLaunchdTemplate(installPath, stdoutPath, stderrPath string) *ServiceTemp
 		</array>
 		<key>RunAtLoad</key>
 		<true/>
-		<key>StandardOutPath</key>
+`, launchdIdentifier)
+	if options.stdoutPath != "" {
+		fmt.Fprintf(&content, `		<key>StandardOutPath</key>
 		<string>%s</string>
-		<key>StandardErrorPath</key>
+`, xmlEscape(options.stdoutPath))
+	}
+	if options.stderrPath != "" {
+		fmt.Fprintf(&content, `		<key>StandardErrorPath</key>
 		<string>%s</string>
-		<key>KeepAlive</key>
+`, xmlEscape(options.stderrPath))
+	}
+	if len(options.env) > 0 {
+		content.WriteString(`		<key>EnvironmentVariables</key>
+		<dict>
+`)
+		keys := make([]string, 0, len(options.env))
+		for key := range options.env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&content, `			<key>%s</key>
+			<string>%s</string>
+`, xmlEscape(key), xmlEscape(options.env[key]))
+		}
+		content.WriteString(`		</dict>
+`)
+	}
+	if options.exitTimeout != nil {
+		fmt.Fprintf(&content, `		<key>ExitTimeOut</key>
+		<integer>%d</integer>
+`, int(*options.exitTimeout/time.Second))
+	}
+	if options.nice != nil {
+		fmt.Fprintf(&content, `		<key>Nice</key>
+		<integer>%d</integer>
+`, *options.nice)
+	}
+	// Restart cloudflared when it exits with an error or crashes, at most once per throttle interval
+	fmt.Fprintf(&content, `		<key>KeepAlive</key>
 		<dict>
 			<key>SuccessfulExit</key>
 			<false/>
+			<key>Crashed</key>
+			<true/>
 		</dict>
 		<key>ThrottleInterval</key>
-		<integer>5</integer>
+		<integer>%d</integer>
 	</dict>
-</plist>`, launchdIdentifier, stdoutPath, stderrPath),
+</plist>`, int(options.throttleInterval/time.Second))
+	return &ServiceTemplate{
+		Path:    installPath,
+		Content: content.String(),
+	}
+}
+
+// xmlEscape escapes s for the property list, which is also a template
+func xmlEscape(s string) string {
+	var escaped strings.Builder
+	_ = xml.EscapeText(&escaped, []byte(s))
+	return strings.ReplaceAll(escaped.String(), "{{", `{{"{{"}}`)
+}
+
+// launchdOptionsFromContext returns the options of the property list set by the flags of service install
+func launchdOptionsFromContext(c *cli.Context) (launchdOptions, error) {
+	options := launchdOptions{
+		env:              make(map[string]string),
+		throttleInterval: c.Duration(launchdThrottleIntervalFlag),
+	}
+	if options.throttleInterval < time.Second {
+		return launchdOptions{}, fmt.Errorf("--%s must be at least 1s", launchdThrottleIntervalFlag)
+	}
+	env, err := serviceEnv(c)
+	if err != nil {
+		return launchdOptions{}, err
+	}
+	for _, env := range env {
+		key, value, _ := strings.Cut(env, "=")
+		options.env[key] = value
+	}
+	if c.IsSet(launchdExitTimeoutFlag) {
+		exitTimeout := c.Duration(launchdExitTimeoutFlag)
+		if exitTimeout < time.Second {
+			return launchdOptions{}, fmt.Errorf("--%s must be at least 1s", launchdExitTimeoutFlag)
+		}
+		options.exitTimeout = &exitTimeout
+	}
+	if c.IsSet(launchdNiceFlag) {
+		nice := c.Int(launchdNiceFlag)
+		if nice < -20 || nice > 19 {
+			return launchdOptions{}, fmt.Errorf("--%s must be between -20 and 19", launchdNiceFlag)
+		}
+		options.nice = &nice
+	}
+	if c.Bool(launchdUnifiedLoggingFlag) {
+		options.env["TUNNEL_LOG_SYSLOG"] = "true"
+		return options, nil
+	}
+
+	if options.stdoutPath, err = stdoutPath(); err != nil {
+		return launchdOptions{}, errors.Wrap(err, "error determining stdout path")
 	}
+	if options.stderrPath, err = stderrPath(); err != nil {
+		return launchdOptions{}, errors.Wrap(err, "error determining stderr path")
+	}
+	return options, nil
 }
 
 func isRootUser() bool {
@@ -139,17 +281,12 @@ func installLaunchd(c *cli.Context) error {
 		return errors.Wrap(err, errMsg)
 	}
 
-	stdoutPath, err := stdoutPath()
-	if err != nil {
-		log.Err(err).Msg("error determining stdout path")
-		return errors.Wrap(err, "error determining stdout path")
-	}
-	stderrPath, err := stderrPath()
+	options, err := launchdOptionsFromContext(c)
 	if err != nil {
-		log.Err(err).Msg("error determining stderr path")
-		return errors.Wrap(err, "error determining stderr path")
+		log.Err(err).Msg("Invalid launchd options")
+		return err
 	}
-	launchdTemplate := newLaunchdTemplate(installPath, stdoutPath, stderrPath)
+	launchdTemplate := newLaunchdTemplate(installPath, options)
 	templateArgs := ServiceTemplateArgs{Path: etPath, ExtraArgs: extraArgs}
 	err = launchdTemplate.Generate(&templateArgs)
 	if err != nil {
@@ -162,7 +299,11 @@ func installLaunchd(c *cli.Context) error {
 		return err
 	}
 
-	log.Info().Msgf("Outputs are logged to %s and %s", stderrPath, stdoutPath)
+	if options.stdoutPath != "" {
+		log.Info().Msgf("Outputs are logged to %s and %s", options.stderrPath, options.stdoutPath)
+	} else {
+		log.Info().Msg("Outputs are logged to the unified logging system, run `log show --predicate 'process == \"cloudflared\"'` to read them")
+	}
 	err = runCommand("launchctl", "load", plistPath)
 	if err == nil {
 		log.Info().Msg("MacOS service for cloudflared installed successfully")
@@ -182,15 +323,7 @@ func uninstallLaunchd(c *cli.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "error determining install path")
 	}
-	stdoutPath, err := stdoutPath()
-	if err != nil {
-		return errors.Wrap(err, "error determining stdout path")
-	}
-	stderrPath, err := stderrPath()
-	if err != nil {
-		return errors.Wrap(err, "error determining stderr path")
-	}
-	launchdTemplate := newLaunchdTemplate(installPath, stdoutPath, stderrPath)
+	launchdTemplate := newLaunchdTemplate(installPath, launchdOptions{})
 	plistPath, err := launchdTemplate.ResolvePath()
 	if err != nil {
 		log.Err(err).Msg("error resolving launchd template path")
@@ -208,3 +341,89 @@ func uninstallLaunchd(c *cli.Context) error {
 	}
 	return err
 }
+
+// launchdTarget is the service target of cloudflared for launchctl: the system domain for a launch daemon, or the GUI
+// domain of the user for a launch agent
+func launchdTarget() string {
+	if isRootUser() {
+		return fmt.Sprintf("system/%s", launchdIdentifier)
+	}
+	return fmt.Sprintf("gui/%d/%s", os.Getuid(), launchdIdentifier)
+}
+
+// launchdStatus is the state of the service reported by `launchctl print`
+type launchdStatus struct {
+	State                 string
+	PID                   string
+	Runs                  string
+	LastExitCode          string
+	LastTerminatingSignal string
+}
+
+// parseLaunchdStatus parses the properties of the service in the output of `launchctl print`, ignoring the nested
+// ones e.g. of its environment
+func parseLaunchdStatus(output []byte) launchdStatus {
+	var (
+		status launchdStatus
+		depth  int
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasSuffix(line, "{"):
+			depth++
+			continue
+		case line == "}":
+			depth--
+			continue
+		}
+		if depth != 1 {
+			continue
+		}
+		key, value, ok := strings.Cut(line, " = ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "state":
+			status.State = value
+		case "pid":
+			status.PID = value
+		case "runs":
+			status.Runs = value
+		case "last exit code":
+			status.LastExitCode = value
+		case "last terminating signal":
+			status.LastTerminatingSignal = value
+		}
+	}
+	return status
+}
+
+func statusLaunchd(c *cli.Context) error {
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+
+	target := launchdTarget()
+	output, err := exec.Command("launchctl", "print", target).Output()
+	if err != nil {
+		log.Info().Msgf("cloudflared service %s isn't loaded, run `cloudflared service install` to install it", target)
+		return nil
+	}
+	status := parseLaunchdStatus(output)
+	event := log.Info().Str("state", status.State)
+	if status.PID != "" {
+		event = event.Str("pid", status.PID)
+	}
+	if status.Runs != "" {
+		event = event.Str("runs", status.Runs)
+	}
+	if status.LastExitCode != "" {
+		event = event.Str("lastExitCode", status.LastExitCode)
+	}
+	if status.LastTerminatingSignal != "" {
+		event = event.Str("lastTerminatingSignal", status.LastTerminatingSignal)
+	}
+	event.Msgf("cloudflared service %s", target)
+	return nil
+}
@@ -42,7 +42,7 @@ func Command(hidden bool) *cli.Command {
 			},
 			&cli.StringSliceFlag{
 				Name:    "upstream",
-				Usage:   "Upstream endpoint URL, you can specify multiple endpoints for redundancy.",
+				Usage:   "Upstream endpoint URL, you can specify multiple endpoints for redundancy. Use https:// for DNS over HTTPS, tls:// for DNS over TLS or quic:// for DNS over QUIC.",
 				Value:   cli.NewStringSlice("https://1.1.1.1/dns-query", "https://1.0.0.1/dns-query"),
 				EnvVars: []string{"TUNNEL_DNS_UPSTREAM"},
 			},
@@ -58,6 +58,98 @@ func Command(hidden bool) *cli.Command {
 				Value:   tunneldns.MaxUpstreamConnsDefault,
 				EnvVars: []string{"TUNNEL_DNS_MAX_UPSTREAM_CONNS"},
 			},
+			&cli.StringFlag{
+				Name:    "upstream-policy",
+				Usage:   "Order in which upstreams are tried {sequential, lowest-latency, random, weighted}.",
+				Value:   tunneldns.UpstreamPolicySequential,
+				EnvVars: []string{"TUNNEL_DNS_UPSTREAM_POLICY"},
+			},
+			&cli.IntSliceFlag{
+				Name:    "upstream-weight",
+				Usage:   "Weight of each upstream for the weighted policy, in the same order as the upstreams. Defaults to 1.",
+				EnvVars: []string{"TUNNEL_DNS_UPSTREAM_WEIGHT"},
+			},
+			&cli.DurationFlag{
+				Name:    "upstream-health-check-interval",
+				Usage:   "Interval between health checks of the upstreams. Unhealthy upstreams are only tried after the healthy ones until they recover. Setting to 0 disables health checks.",
+				Value:   tunneldns.HealthCheckIntervalDefault,
+				EnvVars: []string{"TUNNEL_DNS_UPSTREAM_HEALTH_CHECK_INTERVAL"},
+			},
+			&cli.IntFlag{
+				Name:    "cache-size",
+				Usage:   "Maximum number of DNS responses cached. Setting to 0 disables the cache.",
+				Value:   tunneldns.CacheSizeDefault,
+				EnvVars: []string{"TUNNEL_DNS_CACHE_SIZE"},
+			},
+			&cli.DurationFlag{
+				Name:    "cache-min-ttl",
+				Usage:   "Minimum duration a DNS response is cached for, regardless of its TTL.",
+				Value:   tunneldns.CacheMinTTLDefault,
+				EnvVars: []string{"TUNNEL_DNS_CACHE_MIN_TTL"},
+			},
+			&cli.DurationFlag{
+				Name:    "cache-max-ttl",
+				Usage:   "Maximum duration a DNS response is cached for, regardless of its TTL.",
+				Value:   tunneldns.CacheMaxTTLDefault,
+				EnvVars: []string{"TUNNEL_DNS_CACHE_MAX_TTL"},
+			},
+			&cli.DurationFlag{
+				Name:    "cache-serve-stale",
+				Usage:   "How long after expiring a cached DNS response may still be served when no upstream answers. Setting to 0 disables serving stale responses.",
+				EnvVars: []string{"TUNNEL_DNS_CACHE_SERVE_STALE"},
+			},
+			&cli.StringFlag{
+				Name:    "rules",
+				Usage:   "Path of a YAML file with rules to forward queries for specific domains to designated resolvers, and with local records or hosts files to answer from. The file is reloaded when it changes.",
+				EnvVars: []string{"TUNNEL_DNS_RULES"},
+			},
+			&cli.StringFlag{
+				Name:    "doh-address",
+				Usage:   "Listen address for serving DNS over HTTPS queries on " + tunneldns.DoHPath + ", e.g. localhost:8443. Disabled if empty.",
+				EnvVars: []string{"TUNNEL_DNS_DOH_ADDRESS"},
+			},
+			&cli.StringFlag{
+				Name:    "dot-address",
+				Usage:   "Listen address for serving DNS over TLS queries, e.g. localhost:853. Disabled if empty.",
+				EnvVars: []string{"TUNNEL_DNS_DOT_ADDRESS"},
+			},
+			&cli.StringFlag{
+				Name:    "doh-cert",
+				Usage:   "Certificate file for serving DNS over HTTPS and DNS over TLS. Without a certificate and key, a self-signed certificate is generated at startup.",
+				EnvVars: []string{"TUNNEL_DNS_DOH_CERT"},
+			},
+			&cli.StringFlag{
+				Name:    "doh-key",
+				Usage:   "Private key file of the certificate for serving DNS over HTTPS and DNS over TLS.",
+				EnvVars: []string{"TUNNEL_DNS_DOH_KEY"},
+			},
+			&cli.StringFlag{
+				Name:    "ecs-policy",
+				Usage:   "How the EDNS Client Subnet option of queries is sent upstream {passthrough, strip, truncate, override}.",
+				Value:   tunneldns.ECSPassthrough,
+				EnvVars: []string{"TUNNEL_DNS_ECS_POLICY"},
+			},
+			&cli.StringFlag{
+				Name:    "ecs-subnet",
+				Usage:   "EDNS Client Subnet sent upstream with the override policy, e.g. 203.0.113.0/24.",
+				EnvVars: []string{"TUNNEL_DNS_ECS_SUBNET"},
+			},
+			&cli.StringFlag{
+				Name:    "dnssec",
+				Usage:   "DNSSEC validation of responses {off, permissive, enforce}. Permissive only logs bogus responses, enforce answers them with SERVFAIL.",
+				Value:   tunneldns.DNSSECOff,
+				EnvVars: []string{"TUNNEL_DNS_DNSSEC"},
+			},
+			&cli.StringSliceFlag{
+				Name:    "dnssec-trust-anchor",
+				Usage:   "DS record of the root zone used as DNSSEC trust anchor, e.g. \". IN DS 20326 8 2 E06D...\". Defaults to the current root KSKs.",
+				EnvVars: []string{"TUNNEL_DNS_DNSSEC_TRUST_ANCHOR"},
+			},
+			&cli.StringFlag{
+				Name:    "dns64-prefix",
+				Usage:   "NAT64 prefix used to synthesize AAAA records for names without IPv6 addresses, e.g. 64:ff9b::/96. DNS64 is disabled if empty.",
+				EnvVars: []string{"TUNNEL_DNS_DNS64_PREFIX"},
+			},
 		},
 		ArgsUsage: " ", // can't be the empty string or we get the default output
 		Hidden:    hidden,
@@ -73,17 +165,45 @@ func Run(c *cli.Context) error {
 		log.Fatal().Err(err).Msg("Failed to open the metrics listener")
 	}
 
-	go metrics.ServeMetrics(metricsListener, nil, nil, "", nil, log)
+	go metrics.ServeMetrics(metricsListener, nil, metrics.Config{}, log)
 
-	listener, err := tunneldns.CreateListener(
-		c.String("address"),
+	listener, err := tunneldns.CreateListener(tunneldns.ListenerConfig{
+		Address: c.String("address"),
 		// Note TUN-3758 , we use Int because UInt is not supported with altsrc
-		uint16(c.Int("port")),
-		c.StringSlice("upstream"),
-		c.StringSlice("bootstrap"),
-		c.Int("max-upstream-conns"),
-		log,
-	)
+		Port:                   uint16(c.Int("port")),
+		Upstreams:              c.StringSlice("upstream"),
+		Bootstraps:             c.StringSlice("bootstrap"),
+		MaxUpstreamConnections: c.Int("max-upstream-conns"),
+		Cache: tunneldns.CacheConfig{
+			MaxSize:    c.Int("cache-size"),
+			MinTTL:     c.Duration("cache-min-ttl"),
+			MaxTTL:     c.Duration("cache-max-ttl"),
+			ServeStale: c.Duration("cache-serve-stale"),
+		},
+		RulesFile: c.String("rules"),
+		DoH: tunneldns.DoHConfig{
+			Address:    c.String("doh-address"),
+			DoTAddress: c.String("dot-address"),
+			CertFile:   c.String("doh-cert"),
+			KeyFile:    c.String("doh-key"),
+		},
+		ECS: tunneldns.ECSConfig{
+			Policy: c.String("ecs-policy"),
+			Subnet: c.String("ecs-subnet"),
+		},
+		DNSSEC: tunneldns.DNSSECConfig{
+			Mode:         c.String("dnssec"),
+			TrustAnchors: c.StringSlice("dnssec-trust-anchor"),
+		},
+		UpstreamSelection: tunneldns.UpstreamSelectionConfig{
+			Policy:              c.String("upstream-policy"),
+			Weights:             c.IntSlice("upstream-weight"),
+			HealthCheckInterval: c.Duration("upstream-health-check-interval"),
+		},
+		DNS64: tunneldns.DNS64Config{
+			Prefix: c.String("dns64-prefix"),
+		},
+	}, log)
 
 	if err != nil {
 		log.Err(err).Msg("Failed to create the listeners")
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 	"text/template"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -25,6 +26,28 @@ type ServiceTemplate struct {
 type ServiceTemplateArgs struct {
 	Path      string
 	ExtraArgs []string
+	// Env are the KEY=VALUE environment variables of the service
+	Env []string
+	// After are the systemd units the service starts after, besides network.target
+	After []string
+	// ServiceDirectives are the extra directives of the [Service] section of the systemd unit
+	ServiceDirectives []string
+}
+
+var templateFuncs = template.FuncMap{
+	"systemdQuote": systemdQuote,
+	"shellQuote":   shellQuote,
+}
+
+// systemdQuote quotes s as a single word of a systemd unit setting, escaping the specifiers of systemd
+func systemdQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%").Replace(s)
+	return `"` + s + `"`
+}
+
+// shellQuote quotes s as a single word of a shell script
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
 
 func (st *ServiceTemplate) ResolvePath() (string, error) {
@@ -36,7 +59,7 @@ func (st *ServiceTemplate) ResolvePath() (string, error) {
 }
 
 func (st *ServiceTemplate) Generate(args *ServiceTemplateArgs) error {
-	tmpl, err := template.New(st.Path).Parse(st.Content)
+	tmpl, err := template.New(st.Path).Funcs(templateFuncs).Parse(st.Content)
 	if err != nil {
 		return fmt.Errorf("error generating %s template: %v", st.Path, err)
 	}
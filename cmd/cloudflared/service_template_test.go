@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestSystemdQuote(t *testing.T) {
+	tests := []struct {
+		value  string
+		quoted string
+	}{
+		{value: "TUNNEL_METRICS=localhost:2000", quoted: `"TUNNEL_METRICS=localhost:2000"`},
+		{value: "PROXY=http://proxy %i:8080", quoted: `"PROXY=http://proxy %%i:8080"`},
+		{value: `QUOTED="value"`, quoted: `"QUOTED=\"value\""`},
+		{value: `WINDOWS=C:\cloudflared`, quoted: `"WINDOWS=C:\\cloudflared"`},
+		{value: "APOSTROPHE=it's", quoted: `"APOSTROPHE=it's"`},
+		{value: `ALL=%"\'`, quoted: `"ALL=%%\"\\'"`},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.quoted, systemdQuote(test.value), test.value)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		value  string
+		quoted string
+	}{
+		{value: "TUNNEL_METRICS=localhost:2000", quoted: `'TUNNEL_METRICS=localhost:2000'`},
+		{value: "APOSTROPHE=it's", quoted: `'APOSTROPHE=it'\''s'`},
+		{value: `EXPANDED=$HOME $(id) ` + "`id`", quoted: `'EXPANDED=$HOME $(id) ` + "`id`'"},
+		{value: `ALL=%"\'`, quoted: `'ALL=%"\'\'''`},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.quoted, shellQuote(test.value), test.value)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// The shell reads the quoted values back unchanged
+	for _, test := range tests {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(test.value)).Output()
+		require.NoError(t, err)
+		assert.Equal(t, test.value, string(out))
+	}
+}
+
+func TestServiceEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       []string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name:     "sorted by name",
+			env:      []string{"TUNNEL_METRICS=localhost:2000", "NO_PROXY=", "HTTPS_PROXY=http://proxy:8080"},
+			expected: []string{"HTTPS_PROXY=http://proxy:8080", "NO_PROXY=", "TUNNEL_METRICS=localhost:2000"},
+		},
+		{
+			name:     "last value of a name",
+			env:      []string{"TUNNEL_LOGLEVEL=info", "TUNNEL_LOGLEVEL=debug"},
+			expected: []string{"TUNNEL_LOGLEVEL=debug"},
+		},
+		{
+			name:     "value with an equal sign",
+			env:      []string{"TUNNEL_TOKEN=eyJh=="},
+			expected: []string{"TUNNEL_TOKEN=eyJh=="},
+		},
+		{name: "no name", env: []string{"=value"}, expectErr: true},
+		{name: "no value", env: []string{"TUNNEL_METRICS"}, expectErr: true},
+		{name: "newline", env: []string{"TUNNEL_METRICS=localhost:2000\nExecStartPre=/bin/sh"}, expectErr: true},
+		{name: "carriage return", env: []string{"TUNNEL_METRICS=localhost:2000\rrm -rf /"}, expectErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flagSet := flag.NewFlagSet("test", flag.PanicOnError)
+			flagSet.Var(cli.NewStringSlice(test.env...), serviceEnvFlag, "")
+			env, err := serviceEnv(cli.NewContext(cli.NewApp(), flagSet, nil))
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, env)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/secretprovider"
+)
+
+// tunnelTokenSource is the Cloudflare API the token of a tunnel is fetched from with a scoped API token, so that the
+// token doesn't need to be stored with cloudflared
+type tunnelTokenSource struct {
+	client   cfapi.Client
+	tunnelID uuid.UUID
+	token    []byte
+}
+
+func (s *tunnelTokenSource) Description() string {
+	return fmt.Sprintf("token of tunnel %s", s.tunnelID)
+}
+
+func (s *tunnelTokenSource) Fetch(context.Context) ([]byte, error) {
+	token, err := s.client.GetTunnelToken(s.tunnelID)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(token), nil
+}
+
+// watchRefreshes fetches the token again at the refresh interval until ctx is done, and makes the connections
+// registered after its secret is rotated authenticate with the new secret
+func (s *tunnelTokenSource) watchRefreshes(ctx context.Context, namedTunnel *connection.NamedTunnelProperties, refreshInterval time.Duration, log *zerolog.Logger) {
+	if refreshInterval <= 0 {
+		return
+	}
+	secretprovider.Watch(ctx, s, s.token, refreshInterval, func(value []byte) {
+		token, err := ParseToken(string(value))
+		if err != nil {
+			log.Err(err).Str(LogFieldTunnelID, s.tunnelID.String()).Msg("The refreshed token of the tunnel is invalid, keeping the current one")
+			return
+		}
+		if token.TunnelID != namedTunnel.Credentials.TunnelID || token.AccountTag != namedTunnel.Credentials.AccountTag {
+			log.Error().Str(LogFieldTunnelID, s.tunnelID.String()).Msg("The refreshed token is for another tunnel, keeping the current one")
+			return
+		}
+		namedTunnel.RefreshSecret(token.TunnelSecret)
+		log.Info().Str(LogFieldTunnelID, s.tunnelID.String()).Msg("The secret of the tunnel was rotated, new connections will register with it")
+	}, log)
+}
+
+// runWithAPIToken runs the tunnel with the token fetched from the Cloudflare API with apiToken
+func runWithAPIToken(sc *subcommandContext, tunnelRef, apiToken string) error {
+	accountID := sc.c.String(accountIDFlag.Name)
+	if accountID == "" {
+		return cliutil.UsageError("--%s is required to run a tunnel with --%s", accountIDFlag.Name, apiTokenFlag.Name)
+	}
+	userAgent := fmt.Sprintf("cloudflared/%s", buildInfo.Version())
+	client, err := cfapi.NewRESTClientWithAPIToken(sc.c.String("api-url"), accountID, apiToken, userAgent, sc.log)
+	if err != nil {
+		return err
+	}
+	sc.tunnelstoreClient = client
+
+	tunnelID, err := sc.findID(tunnelRef)
+	if err != nil {
+		return errors.Wrap(err, "error parsing tunnel ID")
+	}
+	source := &tunnelTokenSource{client: client, tunnelID: tunnelID}
+	if source.token, err = source.Fetch(context.Background()); err != nil {
+		return errors.Wrapf(err, "couldn't fetch the token of tunnel %s", tunnelID)
+	}
+	token, err := ParseToken(string(source.token))
+	if err != nil {
+		return errors.Wrapf(err, "the token of tunnel %s is invalid", tunnelID)
+	}
+	sc.log.Debug().Str(LogFieldTunnelID, tunnelID.String()).Msg("Fetched the token of the tunnel from the Cloudflare API")
+	sc.tunnelToken = source
+	return sc.runWithCredentials(token.Credentials())
+}
@@ -0,0 +1,62 @@
+package tunnel
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/connection"
+)
+
+type tokenMockTunnelStore struct {
+	cfapi.Client
+	lock   sync.Mutex
+	tokens []string
+}
+
+func (s *tokenMockTunnelStore) GetTunnelToken(uuid.UUID) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	token := s.tokens[0]
+	if len(s.tokens) > 1 {
+		s.tokens = s.tokens[1:]
+	}
+	return token, nil
+}
+
+func TestTunnelTokenRefresh(t *testing.T) {
+	tunnelID := uuid.New()
+	encode := func(token connection.TunnelToken) string {
+		encoded, err := token.Encode()
+		require.NoError(t, err)
+		return encoded
+	}
+	current := encode(connection.TunnelToken{AccountTag: "account", TunnelSecret: []byte("secret"), TunnelID: tunnelID})
+	rotated := encode(connection.TunnelToken{AccountTag: "account", TunnelSecret: []byte("rotated"), TunnelID: tunnelID})
+	otherTunnel := encode(connection.TunnelToken{AccountTag: "account", TunnelSecret: []byte("other"), TunnelID: uuid.New()})
+
+	source := &tunnelTokenSource{
+		client:   &tokenMockTunnelStore{tokens: []string{"invalid", otherTunnel, current, rotated}},
+		tunnelID: tunnelID,
+		token:    []byte(current),
+	}
+	namedTunnel := &connection.NamedTunnelProperties{
+		Credentials: connection.Credentials{AccountTag: "account", TunnelSecret: []byte("secret"), TunnelID: tunnelID},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := zerolog.Nop()
+	go source.watchRefreshes(ctx, namedTunnel, time.Millisecond, &log)
+
+	// The invalid token and the one of the other tunnel are skipped
+	assert.Eventually(t, func() bool {
+		return string(namedTunnel.Auth().TunnelSecret) == "rotated"
+	}, time.Second, time.Millisecond)
+}
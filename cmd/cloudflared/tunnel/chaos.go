@@ -0,0 +1,64 @@
+package tunnel
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/cloudflare/cloudflared/chaos"
+)
+
+const (
+	chaosLatencyFlag          = "chaos-latency"
+	chaosJitterFlag           = "chaos-jitter"
+	chaosDatagramDropRateFlag = "chaos-datagram-drop-rate"
+	chaosDialFailureRateFlag  = "chaos-dial-failure-rate"
+)
+
+// configureChaosFlags are the flags of fault injection. They're always hidden, since they're only meant for staging
+// connectors.
+func configureChaosFlags() []cli.Flag {
+	return []cli.Flag{
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    chaosLatencyFlag,
+			Usage:   "Testing only: latency added to the requests, streams and datagrams to origins.",
+			EnvVars: []string{"TUNNEL_CHAOS_LATENCY"},
+			Hidden:  true,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    chaosJitterFlag,
+			Usage:   "Testing only: maximum random variation of --chaos-latency, in both directions.",
+			EnvVars: []string{"TUNNEL_CHAOS_JITTER"},
+			Hidden:  true,
+		}),
+		altsrc.NewFloat64Flag(&cli.Float64Flag{
+			Name:    chaosDatagramDropRateFlag,
+			Usage:   "Testing only: rate of the datagrams of UDP sessions dropped in both directions, between 0 and 1.",
+			EnvVars: []string{"TUNNEL_CHAOS_DATAGRAM_DROP_RATE"},
+			Hidden:  true,
+		}),
+		altsrc.NewFloat64Flag(&cli.Float64Flag{
+			Name:    chaosDialFailureRateFlag,
+			Usage:   "Testing only: rate of the requests and streams failing to reach their origin, between 0 and 1.",
+			EnvVars: []string{"TUNNEL_CHAOS_DIAL_FAILURE_RATE"},
+			Hidden:  true,
+		}),
+	}
+}
+
+// newChaosInjector returns the injector of the faults set by the chaos flags, or nil if none is set
+func newChaosInjector(c *cli.Context, log *zerolog.Logger) (*chaos.Injector, error) {
+	injector, err := chaos.NewInjector(chaos.Config{
+		Latency:          c.Duration(chaosLatencyFlag),
+		Jitter:           c.Duration(chaosJitterFlag),
+		DatagramDropRate: c.Float64(chaosDatagramDropRateFlag),
+		DialFailureRate:  c.Float64(chaosDialFailureRateFlag),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if injector != nil {
+		log.Warn().Msgf("Injecting faults in the traffic to origins for chaos testing: %s. Don't use this in production.", injector)
+	}
+	return injector, nil
+}
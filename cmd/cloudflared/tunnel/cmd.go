@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/url"
 	"os"
 	"runtime/trace"
@@ -12,7 +13,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/coreos/go-systemd/daemon"
 	"github.com/facebookgo/grace/gracenet"
 	"github.com/getsentry/raven-go"
 	"github.com/google/uuid"
@@ -74,6 +74,9 @@ const (
 	// uiFlag is to enable launching cloudflared in interactive UI mode
 	uiFlag = "ui"
 
+	// metricsHostnamesFlag is how many hostnames have their own label in the metric of the requests by hostname
+	metricsHostnamesFlag = "metrics-hostnames"
+
 	debugLevelWarning = "At debug level cloudflared will log request URL, method, protocol, content length, as well as, all request and response headers. " +
 		"This can expose sensitive information in your logs."
 
@@ -107,9 +110,14 @@ func Commands() []*cli.Command {
 		buildListCommand(),
 		buildInfoCommand(),
 		buildIngressSubcommand(),
+		buildConfigSubcommand(),
 		buildDeleteCommand(),
 		buildCleanupCommand(),
+		buildStressCommand(),
 		buildTokenCommand(),
+		buildEncryptCredentialsCommand(),
+		buildFeaturesCommand(),
+		buildMaintenanceCommand(),
 		// for compatibility, allow following as tunnel subcommands
 		proxydns.Command(true),
 		cliutil.RemovedCommand("db-connect"),
@@ -119,6 +127,8 @@ func Commands() []*cli.Command {
 		buildTunnelCommand(subcommands),
 		// for compatibility, allow following as top-level subcommands
 		buildLoginSubcommand(true),
+		buildSetupCommand(),
+		buildDiagCommand(),
 		cliutil.RemovedCommand("db-connect"),
 	}
 }
@@ -281,38 +291,69 @@ func StartServer(
 	info.Log(log)
 	logClientOptions(c, log)
 
+	if err := setRuntimeLimits(c, log); err != nil {
+		return err
+	}
+	wd, err := newWatchdog(c, log)
+	if err != nil {
+		return errors.Wrap(err, "invalid watchdog flags")
+	}
+	if err := setRetryBudget(c, log); err != nil {
+		return errors.Wrap(err, "invalid retry budget flags")
+	}
+	creds, err := privilegeDrop(c)
+	if err != nil {
+		return err
+	}
+
 	// this context drives the server, when it's cancelled tunnel and all other components (origins, dns, etc...) should stop
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	if wd != nil {
+		go wd.Run(ctx)
+	}
+
 	go waitForSignal(graceShutdownC, log)
 
-	if c.IsSet("proxy-dns") {
-		dnsReadySignal := make(chan struct{})
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			errC <- runDNSProxyServer(c, dnsReadySignal, ctx.Done(), log)
-		}()
-		// Wait for proxy-dns to come up (if used)
-		<-dnsReadySignal
+	metricsListener, err := startPrivilegedListeners(ctx, c, dnsProxyStandAlone(c, namedTunnel), creds, &listeners, &wg, errC, log)
+	if err != nil {
+		log.Err(err).Msg("Couldn't start tunnel")
+		return err
+	}
+	if metricsListener != nil {
+		defer metricsListener.Close()
 	}
 
 	connectedSignal := signal.New(make(chan struct{}))
-	go notifySystemd(connectedSignal)
+	systemd := newSystemdNotifier(log)
+	go systemd.ready(connectedSignal)
+	go systemd.stopping(ctx, graceShutdownC)
+	go systemd.runWatchdog(ctx)
 	if c.IsSet("pidfile") {
 		go writePidFile(connectedSignal, c.String("pidfile"), log)
 	}
 
+	updatePolicy, err := autoupdatePolicy(c)
+	if err != nil {
+		return err
+	}
 	// update needs to be after DNS proxy is up to resolve equinox server address
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		autoupdater := updater.NewAutoUpdater(
-			c.Bool("no-autoupdate"), c.Duration("autoupdate-freq"), &listeners, log,
+			c.Bool("no-autoupdate"), c.Duration("autoupdate-freq"), updatePolicy, &listeners, log,
 		)
 		errC <- autoupdater.Run(ctx)
 	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := updater.WatchUpdate(ctx, connectedSignal.Wait(), updatePolicy.RollbackGracePeriod, log); err != nil {
+			errC <- err
+		}
+	}()
 
 	// Serve DNS proxy stand-alone if no hostname or tag or app is going to run
 	if dnsProxyStandAlone(c, namedTunnel) {
@@ -347,6 +388,10 @@ func StartServer(
 		log.Err(err).Msg("Couldn't start tunnel")
 		return err
 	}
+	if tunnelConfig.UDPRing != nil {
+		defer tunnelConfig.UDPRing.Close()
+	}
+	tunnelConfig.Watchdog = wd
 	var clientID uuid.UUID
 	if tunnelConfig.NamedTunnel != nil {
 		clientID, err = uuid.FromBytes(tunnelConfig.NamedTunnel.Client.ClientID)
@@ -356,23 +401,83 @@ func StartServer(
 		}
 	}
 
+	observer.RegisterSink(systemd)
+	observer.RegisterSink(orchestratorConfig.ConnectorHealth)
+	serviceStatus.Store(systemd.status)
+	orchestratorConfig.ReloadNotifier = systemd
 	orchestrator, err := orchestration.NewOrchestrator(ctx, orchestratorConfig, tunnelConfig.Tags, tunnelConfig.Log)
 	if err != nil {
 		return err
 	}
 
-	metricsListener, err := listeners.Listen("tcp", c.String("metrics"))
+	if policy := orchestratorConfig.WarpRoutingPolicy; policy != nil {
+		go func() {
+			if err := policy.Run(ctx); err != nil {
+				log.Err(err).Msg("Failed to watch the warp-routing policy, it won't be reloaded")
+			}
+		}()
+	}
+
+	if c.IsSet(kubernetesIngressClassFlag) && c.Bool(dockerLabelsFlag) {
+		return fmt.Errorf("--%s can't be used with --%s", dockerLabelsFlag, kubernetesIngressClassFlag)
+	}
+	if !c.IsSet(kubernetesIngressClassFlag) && !c.Bool(dockerLabelsFlag) {
+		// Ingress rules discovered locally aren't from the configuration file, so they aren't reloaded from it
+		go reloadIngressOnRequest(ctx, orchestrator, log)
+	}
+	if c.IsSet(kubernetesIngressClassFlag) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errC <- runKubernetesController(ctx, c, orchestrator, namedTunnel, log)
+		}()
+	}
+	if c.Bool(dockerLabelsFlag) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errC <- runDockerProvider(ctx, c, orchestrator, namedTunnel, log)
+		}()
+	}
+
+	for _, tcpListener := range config.GetConfiguration().TCPListeners {
+		listener, err := listeners.Listen("tcp", tcpListener.Listen)
+		if err != nil {
+			log.Err(err).Msgf("Error opening the TCP listener on %s", tcpListener.Listen)
+			return errors.Wrapf(err, "Error opening the TCP listener on %s", tcpListener.Listen)
+		}
+		hostname := tcpListener.Hostname
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errC <- orchestrator.ServeTCPListener(ctx, listener, hostname)
+		}()
+	}
+	// The maintenance socket is owned by the user cloudflared runs as, the only one it accepts connections of
+	maintenanceListener, err := listenMaintenance(c)
 	if err != nil {
-		log.Err(err).Msg("Error opening metrics server listener")
-		return errors.Wrap(err, "Error opening metrics server listener")
+		log.Err(err).Msg("Couldn't start tunnel")
+		return err
+	}
+	if maintenanceListener != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errC <- serveMaintenance(maintenanceListener, orchestratorConfig.Maintenance, ctx.Done(), log)
+		}()
 	}
-	defer metricsListener.Close()
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		readinessServer := metrics.NewReadyServer(log, clientID)
 		observer.RegisterSink(readinessServer)
-		errC <- metrics.ServeMetrics(metricsListener, ctx.Done(), readinessServer, quickTunnelURL, orchestrator, log)
+		errC <- metrics.ServeMetrics(metricsListener, ctx.Done(), metrics.Config{
+			ReadyServer:         readinessServer,
+			QuickTunnelHostname: quickTunnelURL,
+			Orchestrator:        orchestrator,
+			Flows:               orchestratorConfig.Flows,
+			FeatureSelector:     tunnelConfig.FeatureSelector,
+		}, log)
 	}()
 
 	reconnectCh := make(chan supervisor.ReconnectSignal, 1)
@@ -381,6 +486,19 @@ func StartServer(
 		go stdinControl(reconnectCh, log)
 	}
 
+	var tunnelID uuid.UUID
+	if namedTunnel != nil {
+		tunnelID = namedTunnel.Credentials.TunnelID
+	}
+	hooks := newRunHooks(c, tunnelID, clientID, log)
+	go hooks.runPostStart(ctx, connectedSignal)
+	// The pre-stop hook delays the end of the shutdown until it finishes
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		hooks.runPreStop(ctx, graceShutdownC)
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer func() {
@@ -397,6 +515,48 @@ func StartServer(
 	return waitToShutdown(&wg, cancel, errC, graceShutdownC, gracePeriod, log)
 }
 
+// startPrivilegedListeners starts the DNS proxy if enabled, and binds the listener of the metrics server unless the DNS
+// proxy runs stand-alone. Privileges are dropped to creds once these sockets are bound, before anything else starts.
+func startPrivilegedListeners(
+	ctx context.Context,
+	c *cli.Context,
+	dnsProxyStandAlone bool,
+	creds *credentials,
+	listeners *gracenet.Net,
+	wg *sync.WaitGroup,
+	errC chan<- error,
+	log *zerolog.Logger,
+) (net.Listener, error) {
+	if c.IsSet("proxy-dns") {
+		dnsReadySignal := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errC <- runDNSProxyServer(c, dnsReadySignal, ctx.Done(), log)
+		}()
+		// Wait for proxy-dns to come up (if used)
+		<-dnsReadySignal
+	}
+
+	var metricsListener net.Listener
+	if !dnsProxyStandAlone {
+		var err error
+		if metricsListener = activatedMetricsListener(); metricsListener != nil {
+			log.Info().Msgf("Using the metrics server listener on %s passed by systemd", metricsListener.Addr())
+		} else if metricsListener, err = listeners.Listen("tcp", c.String("metrics")); err != nil {
+			return nil, errors.Wrap(err, "Error opening metrics server listener")
+		}
+	}
+
+	if err := dropPrivileges(creds, log); err != nil {
+		if metricsListener != nil {
+			metricsListener.Close()
+		}
+		return nil, err
+	}
+	return metricsListener, nil
+}
+
 func waitToShutdown(wg *sync.WaitGroup,
 	cancelServerContext func(),
 	errC <-chan error,
@@ -439,11 +599,6 @@ func waitToShutdown(wg *sync.WaitGroup,
 	return err
 }
 
-func notifySystemd(waitForSignal *signal.Signal) {
-	<-waitForSignal.Wait()
-	daemon.SdNotify(false, "READY=1")
-}
-
 func writePidFile(waitForSignal *signal.Signal, pidPathname string, log *zerolog.Logger) {
 	<-waitForSignal.Wait()
 	expandedPath, err := homedir.Expand(pidPathname)
@@ -490,6 +645,14 @@ func tunnelFlags(shouldHide bool) []cli.Flag {
 	flags = append(flags, configureProxyFlags(shouldHide)...)
 	flags = append(flags, configureLoggingFlags(shouldHide)...)
 	flags = append(flags, configureProxyDNSFlags(shouldHide)...)
+	flags = append(flags, configureKubernetesFlags(shouldHide)...)
+	flags = append(flags, configureDockerFlags(shouldHide)...)
+	flags = append(flags, configureWarpRoutingPolicyFlags(shouldHide)...)
+	flags = append(flags, configureHookFlags(shouldHide)...)
+	flags = append(flags, configureWatchdogFlags(shouldHide)...)
+	flags = append(flags, configureRetryBudgetFlags(shouldHide)...)
+	flags = append(flags, configureFeatureOverrideFlags(shouldHide)...)
+	flags = append(flags, configureChaosFlags()...)
 	flags = append(flags, []cli.Flag{
 		credentialsFileFlag,
 		altsrc.NewBoolFlag(&cli.BoolFlag{
@@ -516,6 +679,25 @@ func tunnelFlags(shouldHide bool) []cli.Flag {
 			Value:   "4",
 			Hidden:  false,
 		}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
+			Name:    "edge-discovery-resolver",
+			Usage:   "Resolver to discover the Cloudflare Edge with, instead of the resolver of the system and then 1.1.1.1 over TLS. Resolvers are tried in the order they're given in. Each is system, an IP with an optional port, tls:// followed by an IP with an optional port for DNS over TLS, or an https:// URL for DNS over HTTPS, e.g. https://1.1.1.1/dns-query.",
+			EnvVars: []string{"TUNNEL_EDGE_DISCOVERY_RESOLVER"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "edge-addr-cache",
+			Usage:   "Caches the Cloudflare Edge addresses in `FILE`. On startup, the cached addresses are used right away while the edge is resolved again in the background, which saves the time of resolving it on slow or flaky DNS resolvers.",
+			EnvVars: []string{"TUNNEL_EDGE_ADDR_CACHE"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "edge-addr-cache-max-age",
+			Usage:   "How old the cache of edge-addr-cache can be to be used on startup.",
+			Value:   time.Hour * 24,
+			EnvVars: []string{"TUNNEL_EDGE_ADDR_CACHE_MAX_AGE"},
+			Hidden:  shouldHide,
+		}),
 		altsrc.NewStringFlag(&cli.StringFlag{
 			Name:    tlsconfig.CaCertFlag,
 			Usage:   "Certificate Authority authenticating connections with Cloudflare's edge network.",
@@ -572,6 +754,12 @@ func tunnelFlags(shouldHide bool) []cli.Flag {
 			EnvVars: []string{"TUNNEL_METRICS_UPDATE_FREQ"},
 			Hidden:  shouldHide,
 		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    metricsHostnamesFlag,
+			Usage:   "Counts the requests by hostname in the cloudflared_tunnel_requests_by_hostname metric, with a label for up to this many hostnames at a time and \"other\" for the rest. It's disabled if it's 0.",
+			EnvVars: []string{"TUNNEL_METRICS_HOSTNAMES"},
+			Hidden:  shouldHide,
+		}),
 		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
 			Name:    "tag",
 			Usage:   "Custom tags used to identify this tunnel, in format `KEY=VALUE`. Multiple tags may be specified",
@@ -633,6 +821,63 @@ func tunnelFlags(shouldHide bool) []cli.Flag {
 			EnvVars: []string{"DIAL_EDGE_TIMEOUT"},
 			Hidden:  true,
 		}),
+		// Note TUN-3758 , we use Int because UInt is not supported with altsrc
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    "http2-initial-connection-window-size",
+			Usage:   "Flow-control window in bytes of each HTTP/2 connection with the edge, for the data it sends. Larger windows help on links with a high bandwidth-delay product. 0 keeps the default.",
+			EnvVars: []string{"TUNNEL_HTTP2_INITIAL_CONNECTION_WINDOW_SIZE"},
+			Hidden:  shouldHide,
+		}),
+		// Note TUN-3758 , we use Int because UInt is not supported with altsrc
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    "http2-initial-stream-window-size",
+			Usage:   "Flow-control window in bytes of each stream of HTTP/2 connections with the edge, for the data it sends. 0 keeps the default.",
+			EnvVars: []string{"TUNNEL_HTTP2_INITIAL_STREAM_WINDOW_SIZE"},
+			Hidden:  shouldHide,
+		}),
+		// Note TUN-3758 , we use Int because UInt is not supported with altsrc
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    "http2-max-concurrent-streams",
+			Usage:   "Maximum number of concurrent streams of each HTTP/2 connection with the edge. 0 keeps the default.",
+			EnvVars: []string{"TUNNEL_HTTP2_MAX_CONCURRENT_STREAMS"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "http2-ping-timeout",
+			Usage:   "Closes an HTTP/2 connection with the edge when nothing, including pings, is received from it for this long. 0 disables it.",
+			EnvVars: []string{"TUNNEL_HTTP2_PING_TIMEOUT"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    "max-procs",
+			Usage:   "Sets GOMAXPROCS, the number of threads running Go code at once. By default it's the CPU quota of the container, or the number of CPUs.",
+			EnvVars: []string{"TUNNEL_MAX_PROCS"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "memory-limit",
+			Usage:   "Sets GOMEMLIMIT, the soft memory limit of the Go runtime, e.g. 512MiB. By default it's 90% of the memory limit of the container.",
+			EnvVars: []string{"TUNNEL_MEMORY_LIMIT"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    "udp-io-uring",
+			Usage:   "Use io_uring on Linux for the UDP sockets of QUIC connections and of the origins of UDP sessions, batching their reads and writes. Falls back to standard sockets if io_uring is unavailable.",
+			EnvVars: []string{"TUNNEL_UDP_IO_URING"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    userFlag,
+			Usage:   "When started as root, e.g. to bind ports below 1024, switch to this user once the sockets of the metrics server and DNS proxy are bound. Only the capabilities to bind ports below 1024 and open ICMP sockets are kept. Linux only.",
+			EnvVars: []string{"TUNNEL_USER"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    groupFlag,
+			Usage:   "Group to switch to with --" + userFlag + ", instead of the primary group of the user.",
+			EnvVars: []string{"TUNNEL_GROUP"},
+			Hidden:  shouldHide,
+		}),
 		altsrc.NewBoolFlag(&cli.BoolFlag{
 			Name:    "stdin-control",
 			Usage:   "Control the process using commands sent through stdin",
@@ -694,6 +939,32 @@ func configureCloudflaredFlags(shouldHide bool) []cli.Flag {
 			Value:  updater.DefaultCheckUpdateFreq,
 			Hidden: shouldHide,
 		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "autoupdate-channel",
+			Usage:   "Release channel to autoupdate from, stable or beta.",
+			EnvVars: []string{"TUNNEL_AUTOUPDATE_CHANNEL"},
+			Value:   updater.ChannelStable,
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    "autoupdate-rollout-percentage",
+			Usage:   "Percentage of the instances autoupdating to a new version, the others hold it back. Instances are picked by their hostname and the version, so raising the percentage extends the rollout of a version to more instances.",
+			EnvVars: []string{"TUNNEL_AUTOUPDATE_ROLLOUT_PERCENTAGE"},
+			Value:   100,
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "autoupdate-window",
+			Usage:   "Daily period of local time in which autoupdates are applied, in the HH:MM-HH:MM format, e.g. 02:00-04:00.",
+			EnvVars: []string{"TUNNEL_AUTOUPDATE_WINDOW"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "autoupdate-rollback-grace-period",
+			Usage:   "Time a new version has to connect to the edge after an autoupdate, before the previous version is restored and the new one skipped. Updates aren't rolled back if it's 0.",
+			EnvVars: []string{"TUNNEL_AUTOUPDATE_ROLLBACK_GRACE_PERIOD"},
+			Hidden:  shouldHide,
+		}),
 		altsrc.NewBoolFlag(&cli.BoolFlag{
 			Name:    "no-autoupdate",
 			Usage:   "Disable periodic check for updates, restarting the server with the new version.",
@@ -704,7 +975,7 @@ func configureCloudflaredFlags(shouldHide bool) []cli.Flag {
 		altsrc.NewStringFlag(&cli.StringFlag{
 			Name:    "metrics",
 			Value:   "localhost:",
-			Usage:   "Listen address for metrics reporting.",
+			Usage:   "Listen address for metrics reporting. It's ignored when systemd passes the socket of the metrics server with socket activation, either named \"metrics\" with FileDescriptorName or as the only socket.",
 			EnvVars: []string{"TUNNEL_METRICS"},
 			Hidden:  shouldHide,
 		}),
@@ -955,6 +1226,18 @@ func configureLoggingFlags(shouldHide bool) []cli.Flag {
 			EnvVars: []string{"TUNNEL_PROTO_LOGLEVEL", "TUNNEL_TRANSPORT_LOGLEVEL"},
 			Hidden:  shouldHide,
 		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    logger.LogErrorSummaryIntervalFlag,
+			Usage:   "Collapses identical recurring warnings and errors into one summary with an occurrence count per interval. 0 logs every occurrence.",
+			EnvVars: []string{"TUNNEL_LOG_ERROR_SUMMARY_INTERVAL"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    logger.LogTransportErrorSummaryIntervalFlag,
+			Usage:   "Same as --" + logger.LogErrorSummaryIntervalFlag + " but for the transport logger.",
+			EnvVars: []string{"TUNNEL_TRANSPORT_LOG_ERROR_SUMMARY_INTERVAL"},
+			Hidden:  shouldHide,
+		}),
 		altsrc.NewStringFlag(&cli.StringFlag{
 			Name:    logger.LogFileFlag,
 			Usage:   "Save application log to this file for reporting issues.",
@@ -967,6 +1250,30 @@ func configureLoggingFlags(shouldHide bool) []cli.Flag {
 			EnvVars: []string{"TUNNEL_LOGDIRECTORY"},
 			Hidden:  shouldHide,
 		}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
+			Name:    logger.LogRedactHeaderFlag,
+			Usage:   "Additional header whose value is masked in the log output. Authorization, cookie and Access token headers are always masked.",
+			EnvVars: []string{"TUNNEL_LOG_REDACT_HEADER"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
+			Name:    logger.LogRedactQueryParamFlag,
+			Usage:   "Additional URL query parameter whose value is masked in the log output. Token query parameters are always masked.",
+			EnvVars: []string{"TUNNEL_LOG_REDACT_QUERY_PARAM"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    logger.LogDisableRedactionFlag,
+			Usage:   "Disables masking of credentials in the log output. Only use this in lab environments.",
+			EnvVars: []string{"TUNNEL_LOG_DISABLE_REDACTION"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    logger.LogSyslogFlag,
+			Usage:   "Also log into syslog, which is forwarded to the unified logging system on macOS. Not supported on Windows.",
+			EnvVars: []string{"TUNNEL_LOG_SYSLOG"},
+			Hidden:  shouldHide,
+		}),
 		altsrc.NewStringFlag(&cli.StringFlag{
 			Name:    "trace-output",
 			Usage:   "Name of trace output file, generated when cloudflared stops.",
@@ -1000,7 +1307,7 @@ func configureProxyDNSFlags(shouldHide bool) []cli.Flag {
 		}),
 		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
 			Name:    "proxy-dns-upstream",
-			Usage:   "Upstream endpoint URL, you can specify multiple endpoints for redundancy.",
+			Usage:   "Upstream endpoint URL, you can specify multiple endpoints for redundancy. Use https:// for DNS over HTTPS, tls:// for DNS over TLS or quic:// for DNS over QUIC.",
 			Value:   cli.NewStringSlice("https://1.1.1.1/dns-query", "https://1.0.0.1/dns-query"),
 			EnvVars: []string{"TUNNEL_DNS_UPSTREAM"},
 			Hidden:  shouldHide,
@@ -1012,6 +1319,115 @@ func configureProxyDNSFlags(shouldHide bool) []cli.Flag {
 			Hidden:  shouldHide,
 			EnvVars: []string{"TUNNEL_DNS_MAX_UPSTREAM_CONNS"},
 		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "proxy-dns-upstream-policy",
+			Usage:   "Order in which upstreams are tried {sequential, lowest-latency, random, weighted}.",
+			Value:   tunneldns.UpstreamPolicySequential,
+			EnvVars: []string{"TUNNEL_DNS_UPSTREAM_POLICY"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntSliceFlag(&cli.IntSliceFlag{
+			Name:    "proxy-dns-upstream-weight",
+			Usage:   "Weight of each upstream for the weighted policy, in the same order as the upstreams. Defaults to 1.",
+			EnvVars: []string{"TUNNEL_DNS_UPSTREAM_WEIGHT"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "proxy-dns-upstream-health-check-interval",
+			Usage:   "Interval between health checks of the upstreams. Unhealthy upstreams are only tried after the healthy ones until they recover. Setting to 0 disables health checks.",
+			Value:   tunneldns.HealthCheckIntervalDefault,
+			EnvVars: []string{"TUNNEL_DNS_UPSTREAM_HEALTH_CHECK_INTERVAL"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    "proxy-dns-cache-size",
+			Usage:   "Maximum number of DNS responses cached by the DNS over HTTPS proxy server. Setting to 0 disables the cache.",
+			Value:   tunneldns.CacheSizeDefault,
+			EnvVars: []string{"TUNNEL_DNS_CACHE_SIZE"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "proxy-dns-cache-min-ttl",
+			Usage:   "Minimum duration a DNS response is cached for, regardless of its TTL.",
+			Value:   tunneldns.CacheMinTTLDefault,
+			EnvVars: []string{"TUNNEL_DNS_CACHE_MIN_TTL"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "proxy-dns-cache-max-ttl",
+			Usage:   "Maximum duration a DNS response is cached for, regardless of its TTL.",
+			Value:   tunneldns.CacheMaxTTLDefault,
+			EnvVars: []string{"TUNNEL_DNS_CACHE_MAX_TTL"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    "proxy-dns-cache-serve-stale",
+			Usage:   "How long after expiring a cached DNS response may still be served when no upstream answers. Setting to 0 disables serving stale responses.",
+			EnvVars: []string{"TUNNEL_DNS_CACHE_SERVE_STALE"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "proxy-dns-rules",
+			Usage:   "Path of a YAML file with rules to forward queries for specific domains to designated resolvers, and with local records or hosts files to answer from. The file is reloaded when it changes.",
+			EnvVars: []string{"TUNNEL_DNS_RULES"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "proxy-dns-doh-address",
+			Usage:   "Listen address for serving DNS over HTTPS queries on " + tunneldns.DoHPath + ", e.g. localhost:8443. Disabled if empty.",
+			EnvVars: []string{"TUNNEL_DNS_DOH_ADDRESS"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "proxy-dns-dot-address",
+			Usage:   "Listen address for serving DNS over TLS queries, e.g. localhost:853. Disabled if empty.",
+			EnvVars: []string{"TUNNEL_DNS_DOT_ADDRESS"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "proxy-dns-doh-cert",
+			Usage:   "Certificate file for serving DNS over HTTPS and DNS over TLS. Without a certificate and key, a self-signed certificate is generated at startup.",
+			EnvVars: []string{"TUNNEL_DNS_DOH_CERT"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "proxy-dns-doh-key",
+			Usage:   "Private key file of the certificate for serving DNS over HTTPS and DNS over TLS.",
+			EnvVars: []string{"TUNNEL_DNS_DOH_KEY"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "proxy-dns-ecs-policy",
+			Usage:   "How the EDNS Client Subnet option of queries is sent upstream {passthrough, strip, truncate, override}.",
+			Value:   tunneldns.ECSPassthrough,
+			EnvVars: []string{"TUNNEL_DNS_ECS_POLICY"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "proxy-dns-ecs-subnet",
+			Usage:   "EDNS Client Subnet sent upstream with the override policy, e.g. 203.0.113.0/24.",
+			EnvVars: []string{"TUNNEL_DNS_ECS_SUBNET"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "proxy-dns-dnssec",
+			Usage:   "DNSSEC validation of responses {off, permissive, enforce}. Permissive only logs bogus responses, enforce answers them with SERVFAIL.",
+			Value:   tunneldns.DNSSECOff,
+			EnvVars: []string{"TUNNEL_DNS_DNSSEC"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
+			Name:    "proxy-dns-dnssec-trust-anchor",
+			Usage:   "DS record of the root zone used as DNSSEC trust anchor, e.g. \". IN DS 20326 8 2 E06D...\". Defaults to the current root KSKs.",
+			EnvVars: []string{"TUNNEL_DNS_DNSSEC_TRUST_ANCHOR"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    "proxy-dns-dns64-prefix",
+			Usage:   "NAT64 prefix used to synthesize AAAA records for names without IPv6 addresses, e.g. 64:ff9b::/96. DNS64 is disabled if empty.",
+			EnvVars: []string{"TUNNEL_DNS_DNS64_PREFIX"},
+			Hidden:  shouldHide,
+		}),
 		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
 			Name:  "proxy-dns-bootstrap",
 			Usage: "bootstrap endpoint URL, you can specify multiple endpoints for redundancy.",
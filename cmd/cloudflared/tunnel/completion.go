@@ -0,0 +1,225 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/logger"
+)
+
+const (
+	completionCacheFile = "completion_cache.json"
+	// completionCacheTTL is how long the names of tunnels and virtual networks are completed without asking the API
+	completionCacheTTL = time.Hour
+	// completionRefreshTimeout bounds how long completions wait for the API, the stale names are completed after it
+	completionRefreshTimeout = 3 * time.Second
+)
+
+// What an argument of a command is completed with
+type completionKind int
+
+const (
+	noCompletion completionKind = iota
+	tunnelCompletion
+	vnetCompletion
+)
+
+// completionCache holds the names of the tunnels and virtual networks of the account, to complete them without asking
+// the API every time
+type completionCache struct {
+	UpdatedAt       time.Time          `json:"updatedAt"`
+	Tunnels         []completionTunnel `json:"tunnels"`
+	VirtualNetworks []string           `json:"virtualNetworks"`
+}
+
+type completionTunnel struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// completeArgs returns a completion function for a command whose arguments are of the given kinds, in order. The last
+// kind repeats if variadic. Flags are completed as usual, and the values of --vnet with virtual networks.
+func completeArgs(variadic bool, kinds ...completionKind) cli.BashCompleteFunc {
+	return func(c *cli.Context) {
+		if len(os.Args) > 2 {
+			lastArg := os.Args[len(os.Args)-2]
+			if isFlagName(lastArg, vnetFlag) {
+				printCompletions(c, vnetCompletion)
+				return
+			}
+			if strings.HasPrefix(lastArg, "-") {
+				cli.DefaultCompleteWithFlags(c.Command)(c)
+				return
+			}
+		}
+		position := c.NArg()
+		if position >= len(kinds) {
+			if !variadic || len(kinds) == 0 {
+				return
+			}
+			position = len(kinds) - 1
+		}
+		printCompletions(c, kinds[position])
+	}
+}
+
+func isFlagName(arg string, flag cli.Flag) bool {
+	for _, name := range flag.Names() {
+		if arg == "-"+name || arg == "--"+name {
+			return true
+		}
+	}
+	return false
+}
+
+func printCompletions(c *cli.Context, kind completionKind) {
+	if kind == noCompletion {
+		return
+	}
+	cache := loadCompletionCache(c)
+	var names []string
+	switch kind {
+	case tunnelCompletion:
+		names = cache.tunnelNames(credentialsFileIDs(c))
+	case vnetCompletion:
+		names = cache.VirtualNetworks
+	}
+	for _, name := range names {
+		fmt.Fprintln(c.App.Writer, name)
+	}
+}
+
+// tunnelNames returns the names of the tunnels, and the IDs of the tunnels of credentials files that aren't in the cache
+func (cache *completionCache) tunnelNames(credentialsIDs []uuid.UUID) []string {
+	known := make(map[uuid.UUID]bool)
+	var names []string
+	for _, tunnel := range cache.Tunnels {
+		known[tunnel.ID] = true
+		names = append(names, tunnel.Name)
+	}
+	for _, id := range credentialsIDs {
+		if !known[id] {
+			names = append(names, id.String())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// credentialsFileIDs returns the IDs of the tunnels with a credentials file where cloudflared looks for them
+func credentialsFileIDs(c *cli.Context) []uuid.UUID {
+	directories := config.DefaultConfigSearchDirectories()
+	if originCert := c.String("origincert"); originCert != "" {
+		directories = append(directories, filepath.Dir(originCert))
+	}
+	found := make(map[uuid.UUID]bool)
+	var ids []uuid.UUID
+	for _, directory := range directories {
+		directory, err := homedir.Expand(directory)
+		if err != nil {
+			continue
+		}
+		files, _ := filepath.Glob(filepath.Join(directory, "*.json"))
+		for _, file := range files {
+			id, err := uuid.Parse(strings.TrimSuffix(filepath.Base(file), ".json"))
+			if err == nil && !found[id] {
+				found[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+func completionCachePath() (string, error) {
+	directory, err := homedir.Expand(config.DefaultConfigSearchDirectories()[0])
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(directory, completionCacheFile), nil
+}
+
+// loadCompletionCache returns the cached names, refreshed from the API if they're stale and the API answers in time
+func loadCompletionCache(c *cli.Context) *completionCache {
+	cache := &completionCache{}
+	path, err := completionCachePath()
+	if err != nil {
+		return cache
+	}
+	if data, err := ioutil.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, cache)
+	}
+	if time.Since(cache.UpdatedAt) < completionCacheTTL {
+		return cache
+	}
+
+	refreshed := make(chan *completionCache, 1)
+	go func() {
+		fresh, err := fetchCompletionCache(c)
+		if err != nil {
+			refreshed <- nil
+			return
+		}
+		if data, err := json.Marshal(fresh); err == nil {
+			_ = ioutil.WriteFile(path, data, 0600)
+		}
+		refreshed <- fresh
+	}()
+	select {
+	case fresh := <-refreshed:
+		if fresh != nil {
+			return fresh
+		}
+	case <-time.After(completionRefreshTimeout):
+	}
+	return cache
+}
+
+func fetchCompletionCache(c *cli.Context) (*completionCache, error) {
+	sc := &subcommandContext{
+		c:   c,
+		log: logger.CreateLoggerFromContext(c, logger.DisableTerminalLog),
+		fs:  realFileSystem{},
+	}
+	filter := cfapi.NewTunnelFilter()
+	filter.NoDeleted()
+	tunnels, err := sc.list(filter)
+	if err != nil {
+		return nil, err
+	}
+	vnetFilter := cfapi.NewVnetFilter()
+	vnetFilter.WithDeleted(false)
+	vnets, err := sc.listVirtualNetworks(vnetFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &completionCache{UpdatedAt: time.Now()}
+	for _, tunnel := range tunnels {
+		cache.Tunnels = append(cache.Tunnels, completionTunnel{ID: tunnel.ID, Name: tunnel.Name})
+	}
+	for _, vnet := range vnets {
+		cache.VirtualNetworks = append(cache.VirtualNetworks, vnet.Name)
+	}
+	sort.Strings(cache.VirtualNetworks)
+	return cache, nil
+}
+
+// invalidateCompletionCache removes the cached names, after tunnels or virtual networks are added or removed
+func invalidateCompletionCache() {
+	if path, err := completionCachePath(); err == nil {
+		_ = os.Remove(path)
+	}
+}
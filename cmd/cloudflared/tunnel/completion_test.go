@@ -0,0 +1,114 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestTunnelNames(t *testing.T) {
+	cached := uuid.New()
+	notCached := uuid.MustParse("11111111-2222-3333-4444-555555555555")
+	cache := completionCache{Tunnels: []completionTunnel{{ID: cached, Name: "web"}, {ID: uuid.New(), Name: "api"}}}
+	assert.Equal(t, []string{"11111111-2222-3333-4444-555555555555", "api", "web"}, cache.tunnelNames([]uuid.UUID{cached, notCached}))
+}
+
+func TestCompleteArgs(t *testing.T) {
+	homedir.DisableCache = true
+	defer func() { homedir.DisableCache = false }()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	configDir := filepath.Join(home, ".cloudflared")
+	require.NoError(t, os.MkdirAll(configDir, 0700))
+
+	credentialsID := uuid.MustParse("11111111-2222-3333-4444-555555555555")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(configDir, credentialsID.String()+".json"), []byte("{}"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(configDir, "config.json"), []byte("{}"), 0600))
+	assert.Equal(t, []uuid.UUID{credentialsID}, credentialsFileIDs(newCompletionContext(t, nil, nil)))
+
+	cache := completionCache{
+		UpdatedAt:       time.Now(),
+		Tunnels:         []completionTunnel{{ID: uuid.New(), Name: "web"}},
+		VirtualNetworks: []string{"default", "staging"},
+	}
+	data, err := json.Marshal(cache)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(configDir, completionCacheFile), data, 0600))
+
+	tests := []struct {
+		name     string
+		complete cli.BashCompleteFunc
+		args     []string
+		osArgs   []string
+		want     string
+	}{
+		{
+			name:     "tunnel",
+			complete: completeArgs(false, tunnelCompletion),
+			want:     "11111111-2222-3333-4444-555555555555\nweb\n",
+		},
+		{
+			name:     "no more arguments",
+			complete: completeArgs(false, tunnelCompletion),
+			args:     []string{"web"},
+		},
+		{
+			name:     "variadic",
+			complete: completeArgs(true, tunnelCompletion),
+			args:     []string{"web"},
+			want:     "11111111-2222-3333-4444-555555555555\nweb\n",
+		},
+		{
+			name:     "second argument",
+			complete: completeArgs(false, noCompletion, vnetCompletion),
+			args:     []string{"10.0.0.0/8"},
+			want:     "default\nstaging\n",
+		},
+		{
+			name:     "vnet flag",
+			complete: completeArgs(false, tunnelCompletion),
+			osArgs:   []string{"cloudflared", "tunnel", "route", "ip", "add", "--vnet", "--generate-bash-completion"},
+			want:     "default\nstaging\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			osArgs := os.Args
+			defer func() { os.Args = osArgs }()
+			os.Args = test.osArgs
+			if os.Args == nil {
+				os.Args = append([]string{"cloudflared", "tunnel", "info"}, append(test.args, "--generate-bash-completion")...)
+			}
+			var output bytes.Buffer
+			test.complete(newCompletionContext(t, test.args, &output))
+			assert.Equal(t, test.want, output.String())
+		})
+	}
+
+	invalidateCompletionCache()
+	_, err = os.Stat(filepath.Join(configDir, completionCacheFile))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func newCompletionContext(t *testing.T, args []string, output *bytes.Buffer) *cli.Context {
+	flagSet := flag.NewFlagSet("test", flag.PanicOnError)
+	flagSet.String("origincert", "", "")
+	require.NoError(t, flagSet.Parse(args))
+	app := cli.NewApp()
+	if output != nil {
+		app.Writer = output
+	}
+	return cli.NewContext(app, flagSet, nil)
+}
@@ -0,0 +1,313 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+func buildDiffConfigCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "diff",
+		Action:    cliutil.ConfiguredAction(diffConfigCommand),
+		Usage:     "Compare the configuration file with the remotely-managed configuration of the tunnel",
+		UsageText: "cloudflared tunnel [--config FILEPATH] config diff [flags] [TUNNEL]",
+		Description: `Fetches the remotely-managed configuration of the tunnel (given its ID or name, or the tunnel of the
+configuration file) and compares its ingress rules and warp-routing settings with the ones of the configuration
+file, once both are normalized with the default settings. The rules are matched by hostname and path: the rules
+only in the configuration file, only in the remote configuration, and the ones whose service, effective
+originRequest settings or precedence change are the ones that proxy differently after migrating the tunnel to
+remote management.`,
+		Flags: []cli.Flag{outputFormatFlag, templateFormatFlag},
+	}
+}
+
+// configRule is an ingress rule of a configuration, at Index starting from 1
+type configRule struct {
+	Index    int    `json:"index" yaml:"index"`
+	Hostname string `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	Path     string `json:"path,omitempty" yaml:"path,omitempty"`
+	Service  string `json:"service" yaml:"service"`
+}
+
+func (r configRule) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "rule #%d", r.Index)
+	if r.Hostname != "" {
+		fmt.Fprintf(&out, " hostname=%s", r.Hostname)
+	}
+	if r.Path != "" {
+		fmt.Fprintf(&out, " path=%s", r.Path)
+	}
+	fmt.Fprintf(&out, " service=%s", r.Service)
+	return out.String()
+}
+
+// settingChange is a setting whose value differs between the local and remote configurations
+type settingChange struct {
+	Name   string      `json:"name" yaml:"name"`
+	Local  interface{} `json:"local" yaml:"local"`
+	Remote interface{} `json:"remote" yaml:"remote"`
+}
+
+// ruleChange is an ingress rule in both configurations that proxies differently
+type ruleChange struct {
+	Local  configRule `json:"local" yaml:"local"`
+	Remote configRule `json:"remote" yaml:"remote"`
+	// Reordered is whether the rule has a different precedence among the rules of both configurations
+	Reordered bool            `json:"reordered" yaml:"reordered"`
+	Settings  []settingChange `json:"settings" yaml:"settings"`
+}
+
+// configDiff is how the remotely-managed configuration of a tunnel differs from the local one
+type configDiff struct {
+	TunnelID      uuid.UUID       `json:"tunnelId" yaml:"tunnelId"`
+	RemoteVersion int             `json:"remoteVersion" yaml:"remoteVersion"`
+	Removed       []configRule    `json:"removed" yaml:"removed"`
+	Added         []configRule    `json:"added" yaml:"added"`
+	Changed       []ruleChange    `json:"changed" yaml:"changed"`
+	WarpRouting   []settingChange `json:"warpRouting" yaml:"warpRouting"`
+}
+
+func (d *configDiff) empty() bool {
+	return len(d.Removed) == 0 && len(d.Added) == 0 && len(d.Changed) == 0 && len(d.WarpRouting) == 0
+}
+
+func ruleKey(rule *ingress.Rule) string {
+	key := rule.Hostname
+	if rule.Path != nil && rule.Path.Regexp != nil {
+		key += "\x00" + rule.Path.Regexp.String()
+	}
+	return key
+}
+
+func newConfigRule(rule *ingress.Rule, i int) configRule {
+	r := configRule{Index: i + 1, Hostname: rule.Hostname, Service: rule.Service.String()}
+	if rule.Path != nil && rule.Path.Regexp != nil {
+		r.Path = rule.Path.Regexp.String()
+	}
+	return r
+}
+
+// diffSettings compares the settings of local and remote, as they are marshalled to JSON
+func diffSettings(local, remote interface{}) ([]settingChange, error) {
+	toMap := func(v interface{}) (map[string]interface{}, error) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var settings map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		return settings, decoder.Decode(&settings)
+	}
+	localSettings, err := toMap(local)
+	if err != nil {
+		return nil, err
+	}
+	remoteSettings, err := toMap(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{})
+	for name := range localSettings {
+		names[name] = struct{}{}
+	}
+	for name := range remoteSettings {
+		names[name] = struct{}{}
+	}
+	var changes []settingChange
+	for name := range names {
+		if !reflect.DeepEqual(localSettings[name], remoteSettings[name]) {
+			changes = append(changes, settingChange{Name: name, Local: localSettings[name], Remote: remoteSettings[name]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes, nil
+}
+
+// diffConfigs compares the ingress rules and warp-routing settings of the local configuration with the remote one.
+// Rules are matched by hostname and path, and compared with their effective originRequest settings.
+func diffConfigs(local, remote ingress.RemoteConfig) (*configDiff, error) {
+	remoteRules := make(map[string]int, len(remote.Ingress.Rules))
+	for i := range remote.Ingress.Rules {
+		key := ruleKey(&remote.Ingress.Rules[i])
+		if _, ok := remoteRules[key]; !ok {
+			remoteRules[key] = i
+		}
+	}
+
+	diff := &configDiff{}
+	// common has the indexes of the rules in both configurations, in the order of the local configuration
+	var common [][2]int
+	localRules := make(map[string]struct{}, len(local.Ingress.Rules))
+	for i := range local.Ingress.Rules {
+		rule := &local.Ingress.Rules[i]
+		key := ruleKey(rule)
+		if _, ok := localRules[key]; ok {
+			// Rules after the first one with the same hostname and path never match
+			continue
+		}
+		localRules[key] = struct{}{}
+		if j, ok := remoteRules[key]; ok {
+			common = append(common, [2]int{i, j})
+		} else {
+			diff.Removed = append(diff.Removed, newConfigRule(rule, i))
+		}
+	}
+	for i := range remote.Ingress.Rules {
+		rule := &remote.Ingress.Rules[i]
+		if _, ok := localRules[ruleKey(rule)]; !ok {
+			diff.Added = append(diff.Added, newConfigRule(rule, i))
+		}
+	}
+
+	for i := range common {
+		localRule, remoteRule := &local.Ingress.Rules[common[i][0]], &remote.Ingress.Rules[common[i][1]]
+		settings, err := diffSettings(ingress.ConvertToRawOriginConfig(localRule.Config), ingress.ConvertToRawOriginConfig(remoteRule.Config))
+		if err != nil {
+			return nil, err
+		}
+		if localService, remoteService := localRule.Service.String(), remoteRule.Service.String(); localService != remoteService {
+			settings = append([]settingChange{{Name: "service", Local: localService, Remote: remoteService}}, settings...)
+		}
+		// A rule is reordered if it takes precedence over a rule it came after, or the other way around
+		reordered := false
+		for j := range common {
+			if (common[i][0] < common[j][0]) != (common[i][1] < common[j][1]) {
+				reordered = true
+				break
+			}
+		}
+		if reordered || len(settings) > 0 {
+			diff.Changed = append(diff.Changed, ruleChange{
+				Local:     newConfigRule(localRule, common[i][0]),
+				Remote:    newConfigRule(remoteRule, common[i][1]),
+				Reordered: reordered,
+				Settings:  settings,
+			})
+		}
+	}
+
+	warpRouting, err := diffSettings(local.WarpRouting, remote.WarpRouting)
+	if err != nil {
+		return nil, err
+	}
+	diff.WarpRouting = warpRouting
+	return diff, nil
+}
+
+func diffConfigCommand(c *cli.Context) error {
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() > 1 {
+		return cliutil.UsageError(`"cloudflared tunnel config diff" accepts at most one argument, the ID or name of the tunnel`)
+	}
+
+	conf := config.GetConfiguration()
+	if conf.Source() == "" {
+		return errors.New("No configuration file was found. Please create one, or use the --config flag to specify its filepath")
+	}
+	localIngress, err := ingress.ParseIngress(conf)
+	if err != nil {
+		return errors.Wrapf(err, "invalid ingress rules in %s", conf.Source())
+	}
+	localWarpRouting, err := ingress.NewWarpRoutingConfig(&conf.WarpRouting)
+	if err != nil {
+		return errors.Wrapf(err, "invalid warp-routing settings in %s", conf.Source())
+	}
+
+	tunnelRef := c.Args().First()
+	if tunnelRef == "" {
+		tunnelRef = conf.TunnelID
+	}
+	if tunnelRef == "" {
+		return cliutil.UsageError("The tunnel isn't set in %s, give its ID or name as argument", conf.Source())
+	}
+	tunnelID, err := sc.findID(tunnelRef)
+	if err != nil {
+		return errors.Wrap(err, "error parsing tunnel ID")
+	}
+	client, err := sc.client()
+	if err != nil {
+		return err
+	}
+	remoteConfiguration, err := client.GetTunnelConfiguration(tunnelID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the remote configuration of the tunnel")
+	}
+	var remoteJSON ingress.RemoteConfigJSON
+	if err := json.Unmarshal(remoteConfiguration.Config, &remoteJSON); err != nil || len(remoteJSON.IngressRules) == 0 {
+		return fmt.Errorf("tunnel %s has no remotely-managed configuration", tunnelID)
+	}
+	var remote ingress.RemoteConfig
+	if err := json.Unmarshal(remoteConfiguration.Config, &remote); err != nil {
+		return errors.Wrap(err, "invalid remote configuration")
+	}
+
+	diff, err := diffConfigs(ingress.RemoteConfig{Ingress: localIngress, WarpRouting: localWarpRouting}, remote)
+	if err != nil {
+		return err
+	}
+	diff.TunnelID = tunnelID
+	diff.RemoteVersion = remoteConfiguration.Version
+
+	if rendered, err := renderOutputFromFlags(c, diff); rendered || err != nil {
+		return err
+	}
+	printConfigDiff(os.Stdout, conf.Source(), diff)
+	return nil
+}
+
+func printConfigDiff(writer io.Writer, source string, diff *configDiff) {
+	if diff.empty() {
+		_, _ = fmt.Fprintf(writer, "%s and the remote configuration (version %d) of tunnel %s proxy the same way\n", source, diff.RemoteVersion, diff.TunnelID)
+		return
+	}
+	_, _ = fmt.Fprintf(writer, "From %s to the remote configuration (version %d) of tunnel %s:\n", source, diff.RemoteVersion, diff.TunnelID)
+	for _, rule := range diff.Removed {
+		_, _ = fmt.Fprintf(writer, "- %s is only in the local configuration\n", rule)
+	}
+	for _, rule := range diff.Added {
+		_, _ = fmt.Fprintf(writer, "+ %s is only in the remote configuration\n", rule)
+	}
+	for _, change := range diff.Changed {
+		_, _ = fmt.Fprintf(writer, "~ %s proxies differently\n", change.Local)
+		if change.Reordered {
+			_, _ = fmt.Fprintf(writer, "    precedence: rule #%d instead of #%d, relative to the other rules it changed places with\n", change.Remote.Index, change.Local.Index)
+		}
+		for _, setting := range change.Settings {
+			_, _ = fmt.Fprintf(writer, "    %s: %s -> %s\n", setting.Name, settingValue(setting.Local), settingValue(setting.Remote))
+		}
+	}
+	for _, setting := range diff.WarpRouting {
+		_, _ = fmt.Fprintf(writer, "~ warp-routing %s: %s -> %s\n", setting.Name, settingValue(setting.Local), settingValue(setting.Remote))
+	}
+}
+
+func settingValue(value interface{}) string {
+	if value == nil {
+		return "(default)"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
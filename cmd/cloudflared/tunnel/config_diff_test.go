@@ -0,0 +1,85 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	parse := func(raw string) ingress.RemoteConfig {
+		var rc ingress.RemoteConfig
+		require.NoError(t, json.Unmarshal([]byte(raw), &rc))
+		return rc
+	}
+	local := parse(`{
+		"ingress": [
+			{"hostname": "app.example.com", "service": "http://localhost:8000"},
+			{"hostname": "api.example.com", "path": "^/v1/", "service": "http://localhost:8001"},
+			{"hostname": "api.example.com", "service": "http://localhost:8002"},
+			{"hostname": "old.example.com", "service": "http://localhost:8003"},
+			{"service": "http_status:404"}
+		],
+		"warp-routing": {"enabled": true}
+	}`)
+	remote := parse(`{
+		"ingress": [
+			{"hostname": "api.example.com", "service": "http://localhost:8002"},
+			{"hostname": "api.example.com", "path": "^/v1/", "service": "http://localhost:8001"},
+			{"hostname": "app.example.com", "service": "http://localhost:9000", "originRequest": {"noTLSVerify": true}},
+			{"hostname": "new.example.com", "service": "http://localhost:8004"},
+			{"service": "http_status:404"}
+		]
+	}`)
+
+	diff, err := diffConfigs(local, remote)
+	require.NoError(t, err)
+	assert.Equal(t, []configRule{{Index: 4, Hostname: "old.example.com", Service: "http://localhost:8003"}}, diff.Removed)
+	assert.Equal(t, []configRule{{Index: 4, Hostname: "new.example.com", Service: "http://localhost:8004"}}, diff.Added)
+	require.Len(t, diff.Changed, 3)
+
+	app := diff.Changed[0]
+	assert.Equal(t, 1, app.Local.Index)
+	assert.Equal(t, 3, app.Remote.Index)
+	assert.True(t, app.Reordered)
+	assert.Equal(t, []settingChange{
+		{Name: "service", Local: "http://localhost:8000", Remote: "http://localhost:9000"},
+		{Name: "noTLSVerify", Local: nil, Remote: true},
+	}, app.Settings)
+
+	// The rule of the whole API hostname matches the requests to /v1/ first in the remote configuration
+	assert.True(t, diff.Changed[1].Reordered)
+	assert.Equal(t, "^/v1/", diff.Changed[1].Local.Path)
+	assert.Equal(t, 2, diff.Changed[1].Remote.Index)
+	assert.Empty(t, diff.Changed[1].Settings)
+	assert.True(t, diff.Changed[2].Reordered)
+
+	require.Len(t, diff.WarpRouting, 1)
+	assert.Equal(t, settingChange{Name: "enabled", Local: true, Remote: false}, diff.WarpRouting[0])
+
+	diff.TunnelID = uuid.Nil
+	diff.RemoteVersion = 7
+	var out bytes.Buffer
+	printConfigDiff(&out, "config.yml", diff)
+	assert.Contains(t, out.String(), "From config.yml to the remote configuration (version 7) of tunnel 00000000-0000-0000-0000-000000000000:\n")
+	assert.Contains(t, out.String(), "- rule #4 hostname=old.example.com service=http://localhost:8003 is only in the local configuration\n")
+	assert.Contains(t, out.String(), "+ rule #4 hostname=new.example.com service=http://localhost:8004 is only in the remote configuration\n")
+	assert.Contains(t, out.String(), "~ rule #1 hostname=app.example.com service=http://localhost:8000 proxies differently\n"+
+		"    precedence: rule #3 instead of #1, relative to the other rules it changed places with\n"+
+		"    service: \"http://localhost:8000\" -> \"http://localhost:9000\"\n"+
+		"    noTLSVerify: (default) -> true\n")
+	assert.Contains(t, out.String(), "~ warp-routing enabled: true -> false\n")
+
+	diff, err = diffConfigs(local, local)
+	require.NoError(t, err)
+	assert.True(t, diff.empty())
+	out.Reset()
+	printConfigDiff(&out, "config.yml", diff)
+	assert.Equal(t, "config.yml and the remote configuration (version 0) of tunnel 00000000-0000-0000-0000-000000000000 proxy the same way\n", out.String())
+}
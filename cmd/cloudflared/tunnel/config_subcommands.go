@@ -0,0 +1,191 @@
+package tunnel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/edgediscovery/allregions"
+	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/logger"
+	"github.com/cloudflare/cloudflared/secretstore"
+)
+
+var strictFlag = &cli.BoolFlag{
+	Name:  "strict",
+	Usage: "Fail on warnings too, e.g. settings that are ignored",
+}
+
+func buildConfigSubcommand() *cli.Command {
+	return &cli.Command{
+		Name:        "config",
+		Category:    "Tunnel",
+		Usage:       "Check cloudflared tunnel's configuration file",
+		UsageText:   "cloudflared tunnel [--config FILEPATH] config COMMAND [arguments...]",
+		Subcommands: []*cli.Command{buildValidateConfigCommand(), buildDiffConfigCommand()},
+	}
+}
+
+func buildValidateConfigCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "validate",
+		Action:    cliutil.WithErrorHandler(validateConfigCommand),
+		Usage:     "Validate the configuration file",
+		UsageText: "cloudflared tunnel [--config FILEPATH] config validate [--strict]",
+		Description: `Validates the configuration file without running the tunnel: its YAML, JSON or TOML syntax, keys and the
+types of their values, the ingress rules and the schemes of their services, the originRequest settings that don't apply
+to the service of their rule, and the credentials file of the tunnel. Problems are printed with their file, line and column, and the
+command exits with an error if there are errors, or warnings with --strict, e.g. to check configuration files in CI.`,
+		Flags: []cli.Flag{strictFlag},
+	}
+}
+
+func validateConfigCommand(c *cli.Context) error {
+	configFile := c.String("config")
+	if configFile == "" {
+		return cliutil.UsageError("No configuration file was found, set its path with --config.")
+	}
+	doc, problems, err := config.ParseDocument(configFile, settingNames(c))
+	if err != nil {
+		return errors.Wrapf(err, "couldn't read the configuration file %s", configFile)
+	}
+	if doc != nil {
+		problems = append(problems, validateIngressRules(doc)...)
+		problems = append(problems, validateCredentialsFile(c, doc)...)
+	}
+	config.SortProblems(problems)
+
+	var errorCount, warningCount int
+	for _, problem := range problems {
+		fmt.Println(problem)
+		if problem.Warning {
+			warningCount++
+		} else {
+			errorCount++
+		}
+	}
+	if errorCount > 0 || (warningCount > 0 && c.Bool(strictFlag.Name)) {
+		return cli.Exit(fmt.Sprintf("%s is invalid: %d errors, %d warnings", configFile, errorCount, warningCount), 1)
+	}
+	if warningCount > 0 {
+		fmt.Printf("%s is valid, with %d warnings\n", configFile, warningCount)
+		return nil
+	}
+	fmt.Printf("%s is valid\n", configFile)
+	return nil
+}
+
+// settingNames returns the names and aliases of the flags that can be set in the configuration file
+func settingNames(c *cli.Context) []string {
+	var names []string
+	addFlags := func(flags []cli.Flag) {
+		for _, flag := range flags {
+			names = append(names, flag.Names()...)
+		}
+	}
+	var addCommands func(commands []*cli.Command)
+	addCommands = func(commands []*cli.Command) {
+		for _, command := range commands {
+			addFlags(command.Flags)
+			addCommands(command.Subcommands)
+		}
+	}
+	// Each command has its own app, the outermost one has all the commands
+	var app *cli.App
+	for _, ctx := range c.Lineage() {
+		if ctx.App != nil {
+			app = ctx.App
+		}
+	}
+	addFlags(app.Flags)
+	addCommands(app.Commands)
+	return names
+}
+
+func validateIngressRules(doc *config.Document) []config.Problem {
+	var problems []config.Problem
+	if len(doc.Configuration.Ingress) > 0 {
+		if _, ok := doc.Settings["url"]; ok {
+			problems = append(problems, doc.Problem(ingress.ErrURLIncompatibleWithIngress.Error(), "remove url and add a rule for its service instead", false, "url"))
+		}
+	}
+	for _, problem := range ingress.ValidateRules(doc.Configuration) {
+		path := []interface{}{"ingress", problem.Index}
+		for _, field := range problem.Field {
+			path = append(path, field)
+		}
+		problems = append(problems, doc.Problem(problem.Message, problem.Suggestion, problem.Warning, path...))
+	}
+	if _, err := ingress.NewWarpRoutingConfig(&doc.Configuration.WarpRouting); err != nil {
+		problems = append(problems, doc.Problem(err.Error(), "", false, "warp-routing"))
+	}
+	if edgeAddresses := doc.Configuration.EdgeAddresses; len(edgeAddresses.Region1) > 0 || len(edgeAddresses.Region2) > 0 {
+		if _, err := allregions.ParseStaticRegions([][]string{edgeAddresses.Region1, edgeAddresses.Region2}); err != nil {
+			problems = append(problems, doc.Problem(err.Error(), "", false, "edge-addresses"))
+		}
+	}
+	for i, tcpListener := range doc.Configuration.TCPListeners {
+		if _, _, err := net.SplitHostPort(tcpListener.Listen); err != nil {
+			problems = append(problems, doc.Problem(fmt.Sprintf("invalid listen address %q: %v", tcpListener.Listen, err), "set an address with a port, e.g. 127.0.0.1:2222", false, "tcp-listeners", i, "listen"))
+		}
+		if tcpListener.Hostname == "" {
+			problems = append(problems, doc.Problem("the hostname of the ingress rule to forward the connections to is missing", "", false, "tcp-listeners", i, "hostname"))
+		}
+	}
+	return problems
+}
+
+// validateCredentialsFile checks that the credentials file of the tunnel can be read
+func validateCredentialsFile(c *cli.Context, doc *config.Document) []config.Problem {
+	secrets := doc.Configuration.Secrets
+	if secrets.Credentials != nil || secrets.Token != nil || doc.Settings[TunnelTokenFlag] != nil {
+		return nil
+	}
+	settingKey := CredFileFlag
+	credentialsFile, _ := doc.Settings[CredFileFlag].(string)
+	if credentialsFile == "" {
+		settingKey = CredFileFlagAlias
+		credentialsFile, _ = doc.Settings[CredFileFlagAlias].(string)
+	}
+	if credentialsFile == "" {
+		tunnelID, err := uuid.Parse(doc.Configuration.TunnelID)
+		if err != nil {
+			// Tunnels referenced by name are resolved with the API when they run
+			return nil
+		}
+		log := logger.CreateLoggerFromContext(c, logger.DisableTerminalLog)
+		if _, err := newSearchByID(tunnelID, c, log, realFileSystem{}).Path(); err != nil {
+			return []config.Problem{doc.Problem(err.Error(), fmt.Sprintf("set the path of the credentials file in %s", CredFileFlag), true, "tunnel")}
+		}
+		return nil
+	}
+
+	path, err := homedir.Expand(credentialsFile)
+	if err != nil {
+		return []config.Problem{doc.Problem(err.Error(), "", false, settingKey)}
+	}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		suggestion := ""
+		if strings.HasSuffix(path, ".pem") {
+			suggestion = "the credentials file is the .json file created by cloudflared tunnel create, not cert.pem"
+		}
+		return []config.Problem{doc.Problem(fmt.Sprintf("couldn't read the credentials file: %v", err), suggestion, false, settingKey)}
+	}
+	if _, err := decodeCredentials(body, path); err != nil {
+		if secretstore.IsSealed(body) {
+			// The key of the credentials may only be available where the tunnel runs
+			return []config.Problem{doc.Problem(fmt.Sprintf("couldn't check the encrypted credentials file: %v", errors.Cause(err)), "", true, settingKey)}
+		}
+		return []config.Problem{doc.Problem("the credentials file isn't valid JSON", "the credentials file is the .json file created by cloudflared tunnel create", false, settingKey)}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -18,14 +19,21 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/updater"
 	"github.com/cloudflare/cloudflared/edgediscovery/allregions"
 
 	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/connection"
 	"github.com/cloudflare/cloudflared/edgediscovery"
+	"github.com/cloudflare/cloudflared/features"
+	"github.com/cloudflare/cloudflared/flowtable"
 	"github.com/cloudflare/cloudflared/h2mux"
 	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/iouring"
 	"github.com/cloudflare/cloudflared/orchestration"
+	"github.com/cloudflare/cloudflared/proxy"
+	"github.com/cloudflare/cloudflared/runtimelimits"
+	"github.com/cloudflare/cloudflared/secretstore"
 	"github.com/cloudflare/cloudflared/supervisor"
 	"github.com/cloudflare/cloudflared/tlsconfig"
 	tunnelpogs "github.com/cloudflare/cloudflared/tunnelrpc/pogs"
@@ -35,6 +43,9 @@ import (
 const LogFieldOriginCertPath = "originCertPath"
 const secretValue = "*****"
 
+// http2MinWindowSize is the initial flow-control window size of HTTP/2, smaller windows would slow connections down
+const http2MinWindowSize = 65535
+
 var (
 	developerPortal = "https://developers.cloudflare.com/argo-tunnel"
 	serviceUrl      = developerPortal + "/reference/service/"
@@ -42,7 +53,7 @@ var (
 
 	LogFieldHostname = "hostname"
 
-	secretFlags     = [2]*altsrc.StringFlag{credentialsContentsFlag, tunnelTokenFlag}
+	secretFlags     = [3]*altsrc.StringFlag{credentialsContentsFlag, tunnelTokenFlag, apiTokenFlag}
 	defaultFeatures = []string{supervisor.FeatureAllowRemoteConfig, supervisor.FeatureSerializedHeaders}
 
 	configFlags = []string{"autoupdate-freq", "no-autoupdate", "retries", "protocol", "loglevel", "transport-loglevel", "origincert", "metrics", "metrics-update-freq", "edge-ip-version"}
@@ -176,11 +187,37 @@ func readOriginCert(originCertPath string) ([]byte, error) {
 }
 
 func getOriginCert(originCertPath string, log *zerolog.Logger) ([]byte, error) {
-	if originCertPath, err := findOriginCert(originCertPath, log); err != nil {
-		return nil, err
-	} else {
-		return readOriginCert(originCertPath)
+	_, originCert, err := loadOriginCert(originCertPath, log)
+	return originCert, err
+}
+
+// loadOriginCert returns the origin cert of the secret manager of the configuration file, the one at originCertPath, or
+// the one saved by login --secure-storage if there's no file at originCertPath, along with the path of the cert.
+func loadOriginCert(originCertPath string, log *zerolog.Logger) (string, []byte, error) {
+	if source := config.GetConfiguration().Secrets.OriginCert; source != nil {
+		secret, err := fetchSecret(source, log)
+		if err != nil {
+			return "", nil, err
+		}
+		return originCertPath, secret.value, nil
+	}
+	if expandedPath, err := homedir.Expand(originCertPath); err == nil {
+		if ok, err := config.FileExists(expandedPath); !ok && err == nil {
+			if store, err := secretstore.Default(); err == nil {
+				if originCert, err := store.Get(config.DefaultCredentialFile); err == nil {
+					log.Debug().Msgf("Using origin certificate from %s", store.Description())
+					return expandedPath, originCert, nil
+				}
+			}
+		}
 	}
+
+	originCertPath, err := findOriginCert(originCertPath, log)
+	if err != nil {
+		return "", nil, err
+	}
+	originCert, err := readOriginCert(originCertPath)
+	return originCertPath, originCert, err
 }
 
 func prepareTunnelConfig(
@@ -229,7 +266,7 @@ func prepareTunnelConfig(
 			return nil, nil, errors.Wrap(err, "can't generate connector UUID")
 		}
 		log.Info().Msgf("Generated Connector ID: %s", clientUUID)
-		features := append(c.StringSlice("features"), defaultFeatures...)
+		clientFeatures := append(c.StringSlice("features"), defaultFeatures...)
 		if c.IsSet(TunnelTokenFlag) {
 			if transportProtocol == connection.AutoSelectFlag {
 				protocolFetcher = func() (edgediscovery.ProtocolPercents, error) {
@@ -251,7 +288,7 @@ func prepareTunnelConfig(
 		}
 		namedTunnel.Client = tunnelpogs.ClientInfo{
 			ClientID: clientUUID[:],
-			Features: dedup(features),
+			Features: dedup(clientFeatures),
 			Version:  info.Version(),
 			Arch:     info.OSArch(),
 		}
@@ -329,24 +366,40 @@ func prepareTunnelConfig(
 	if err != nil {
 		return nil, nil, err
 	}
+	http2Config, err := parseHTTP2Config(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	edgeResolvers, err := allregions.ParseResolvers(c.StringSlice("edge-discovery-resolver"))
+	if err != nil {
+		return nil, nil, err
+	}
+	edgeRegionAddrs, err := staticEdgeRegions(c, cfg.EdgeAddresses)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	tunnelConfig := &supervisor.TunnelConfig{
-		GracePeriod:     gracePeriod,
-		ReplaceExisting: c.Bool("force"),
-		OSArch:          info.OSArch(),
-		ClientID:        clientID,
-		EdgeAddrs:       c.StringSlice("edge"),
-		Region:          c.String("region"),
-		EdgeIPVersion:   edgeIPVersion,
-		HAConnections:   c.Int("ha-connections"),
-		IncidentLookup:  supervisor.NewIncidentLookup(),
-		IsAutoupdated:   c.Bool("is-autoupdated"),
-		LBPool:          c.String("lb-pool"),
-		Tags:            tags,
-		Log:             log,
-		LogTransport:    logTransport,
-		Observer:        observer,
-		ReportedVersion: info.Version(),
+		GracePeriod:         gracePeriod,
+		ReplaceExisting:     c.Bool("force"),
+		OSArch:              info.OSArch(),
+		ClientID:            clientID,
+		EdgeAddrs:           c.StringSlice("edge"),
+		EdgeRegionAddrs:     edgeRegionAddrs,
+		Region:              c.String("region"),
+		EdgeIPVersion:       edgeIPVersion,
+		EdgeResolvers:       edgeResolvers,
+		EdgeAddrCache:       c.String("edge-addr-cache"),
+		EdgeAddrCacheMaxAge: c.Duration("edge-addr-cache-max-age"),
+		HAConnections:       c.Int("ha-connections"),
+		IncidentLookup:      supervisor.NewIncidentLookup(),
+		IsAutoupdated:       c.Bool("is-autoupdated"),
+		LBPool:              c.String("lb-pool"),
+		Tags:                tags,
+		Log:                 log,
+		LogTransport:        logTransport,
+		Observer:            observer,
+		ReportedVersion:     info.Version(),
 		// Note TUN-3758 , we use Int because UInt is not supported with altsrc
 		Retries:          uint(c.Int("retries")),
 		RunFromTerminal:  isRunningFromTerminal(),
@@ -355,10 +408,42 @@ func prepareTunnelConfig(
 		MuxerConfig:      muxerConfig,
 		ProtocolSelector: protocolSelector,
 		EdgeTLSConfigs:   edgeTLSConfigs,
+		HTTP2Config:      http2Config,
+	}
+	policy, err := warpRoutingPolicy(c, log)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid warp-routing policy")
+	}
+	warpRouting, err := ingress.NewWarpRoutingConfig(&cfg.WarpRouting)
+	if err != nil {
+		return nil, nil, err
+	}
+	udpRing, err := newUDPRing(c, log)
+	if err != nil {
+		return nil, nil, err
+	}
+	tunnelConfig.UDPRing = udpRing
+	if namedTunnel != nil {
+		overrideFile, err := featureOverrideFile(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		tunnelConfig.FeatureSelector = features.NewSelector(namedTunnel.Client.Features, overrideFile, log)
+	}
+	faults, err := newChaosInjector(c, log)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid chaos testing flags")
 	}
 	orchestratorConfig := &orchestration.Config{
 		Ingress:            &ingressRules,
-		WarpRouting:        ingress.NewWarpRoutingConfig(&cfg.WarpRouting),
+		WarpRouting:        warpRouting,
+		WarpRoutingPolicy:  policy,
+		Flows:              flowtable.NewTable(),
+		UDPRing:            udpRing,
+		Chaos:              faults,
+		HostnameRequests:   proxy.NewHostnameRequests(c.Int(metricsHostnamesFlag)),
+		Maintenance:        proxy.NewMaintenance(log),
+		ConnectorHealth:    proxy.NewConnectorHealth(log),
 		ConfigurationFlags: parseConfigFlags(c),
 	}
 	return tunnelConfig, orchestratorConfig, nil
@@ -384,6 +469,126 @@ func gracePeriod(c *cli.Context) (time.Duration, error) {
 	return period, nil
 }
 
+func parseHTTP2Config(c *cli.Context) (connection.HTTP2Config, error) {
+	connWindow, err := http2WindowSize(c, "http2-initial-connection-window-size")
+	if err != nil {
+		return connection.HTTP2Config{}, err
+	}
+	streamWindow, err := http2WindowSize(c, "http2-initial-stream-window-size")
+	if err != nil {
+		return connection.HTTP2Config{}, err
+	}
+	// Note TUN-3758 , we use Int because UInt is not supported with altsrc
+	maxConcurrentStreams := c.Int("http2-max-concurrent-streams")
+	if maxConcurrentStreams < 0 || int64(maxConcurrentStreams) > math.MaxUint32 {
+		return connection.HTTP2Config{}, fmt.Errorf("http2-max-concurrent-streams must be between 0 and %d", uint32(math.MaxUint32))
+	}
+	pingTimeout := c.Duration("http2-ping-timeout")
+	if pingTimeout < 0 {
+		return connection.HTTP2Config{}, fmt.Errorf("http2-ping-timeout must not be negative")
+	}
+	return connection.HTTP2Config{
+		InitialConnectionWindowSize: connWindow,
+		InitialStreamWindowSize:     streamWindow,
+		MaxConcurrentStreams:        uint32(maxConcurrentStreams),
+		PingTimeout:                 pingTimeout,
+	}, nil
+}
+
+// autoupdatePolicy returns the policy staging the autoupdates of cloudflared
+func autoupdatePolicy(c *cli.Context) (updater.UpdatePolicy, error) {
+	policy := updater.UpdatePolicy{
+		Channel:             c.String("autoupdate-channel"),
+		RolloutPercentage:   c.Int("autoupdate-rollout-percentage"),
+		RollbackGracePeriod: c.Duration("autoupdate-rollback-grace-period"),
+	}
+	if window := c.String("autoupdate-window"); window != "" {
+		var err error
+		if policy.Window, err = updater.ParseUpdateWindow(window); err != nil {
+			return updater.UpdatePolicy{}, err
+		}
+	}
+	if err := policy.Validate(); err != nil {
+		return updater.UpdatePolicy{}, errors.Wrap(err, "invalid autoupdate settings")
+	}
+	return policy, nil
+}
+
+// setRuntimeLimits sizes the Go runtime to the limits of the container, unless max-procs or memory-limit override them
+func setRuntimeLimits(c *cli.Context, log *zerolog.Logger) error {
+	maxProcs := c.Int("max-procs")
+	if maxProcs < 0 {
+		return fmt.Errorf("max-procs must not be negative")
+	}
+	var memoryLimit int64
+	if c.IsSet("memory-limit") {
+		var err error
+		if memoryLimit, err = runtimelimits.ParseMemoryLimit(c.String("memory-limit")); err != nil {
+			return err
+		}
+	}
+	limits, err := runtimelimits.Set(runtimelimits.Config{
+		MaxProcs:    maxProcs,
+		MemoryLimit: memoryLimit,
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to detect the CPU and memory limits of the container")
+	}
+	event := log.Info().
+		Int("maxProcs", limits.MaxProcs).
+		Str("maxProcsSource", limits.MaxProcsSource).
+		Str("memoryLimitSource", limits.MemoryLimitSource)
+	if limits.MemoryLimit != math.MaxInt64 {
+		event = event.Int64("memoryLimit", limits.MemoryLimit)
+	}
+	event.Msg("Runtime limits")
+	return nil
+}
+
+// staticEdgeRegions returns the addresses of the regions of the edge set in edge-addresses of the configuration file, or
+// nil if there are none
+func staticEdgeRegions(c *cli.Context, edgeAddresses config.EdgeAddressesConfig) ([][]string, error) {
+	if len(edgeAddresses.Region1) == 0 && len(edgeAddresses.Region2) == 0 {
+		return nil, nil
+	}
+	if c.IsSet("edge") {
+		return nil, fmt.Errorf("edge and edge-addresses of the configuration file can't both be set")
+	}
+	regionAddrs := [][]string{edgeAddresses.Region1, edgeAddresses.Region2}
+	if _, err := allregions.ParseStaticRegions(regionAddrs); err != nil {
+		return nil, errors.Wrap(err, "invalid edge-addresses")
+	}
+	return regionAddrs, nil
+}
+
+// http2WindowSize returns the flow-control window size of flag, which is either 0 for the default or a valid HTTP/2
+// window size
+func http2WindowSize(c *cli.Context, flag string) (int32, error) {
+	size := c.Int(flag)
+	if size != 0 && (size < http2MinWindowSize || size > math.MaxInt32) {
+		return 0, fmt.Errorf("%s must be between %d and %d bytes, or 0 for the default", flag, http2MinWindowSize, math.MaxInt32)
+	}
+	return int32(size), nil
+}
+
+// newUDPRing returns the io_uring of the UDP sockets if udp-io-uring is set. It returns nil if it's unset, or if
+// io_uring isn't supported, so the standard sockets are used.
+func newUDPRing(c *cli.Context, log *zerolog.Logger) (*iouring.Ring, error) {
+	if !c.Bool("udp-io-uring") {
+		return nil, nil
+	}
+	ring, err := iouring.NewRing(iouring.DefaultEntries)
+	if err == iouring.ErrUnsupported {
+		log.Warn().Msg("udp-io-uring is set but io_uring is not supported on this system, UDP sockets will use the standard I/O")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set up io_uring")
+	}
+	log.Info().Msg("UDP sockets of QUIC connections and datagram sessions use io_uring")
+	return ring, nil
+}
+
 func isWarpRoutingEnabled(warpConfig config.WarpRoutingConfig, isNamedTunnel bool) bool {
 	return warpConfig.Enabled && isNamedTunnel
 }
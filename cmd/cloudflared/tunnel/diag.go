@@ -0,0 +1,412 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/edgediscovery/allregions"
+	"github.com/cloudflare/cloudflared/logger"
+	"github.com/cloudflare/cloudflared/netdiag"
+	"github.com/cloudflare/cloudflared/speedtest"
+	"github.com/cloudflare/cloudflared/tlsconfig"
+)
+
+const (
+	speedtestRegionFlag         = "region"
+	speedtestEdgeIPVersionFlag  = "edge-ip-version"
+	speedtestAddrsPerRegionFlag = "addresses-per-region"
+	speedtestProbesFlag         = "probes"
+	speedtestTimeoutFlag        = "timeout"
+	speedtestDownloadSizeFlag   = "download-size"
+	speedtestDownloadURLFlag    = "download-url"
+
+	pathMetricsFlag = "metrics"
+	pathModeFlag    = "mode"
+	pathMaxHopsFlag = "max-hops"
+	pathCountFlag   = "count"
+	pathArchiveFlag = "archive"
+
+	globalRegion = "global"
+)
+
+func buildDiagCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "diag",
+		Category:  "Tunnel",
+		Usage:     "Diagnose the connectivity of cloudflared to the Cloudflare edge",
+		UsageText: "cloudflared diag command [command options]",
+		Subcommands: []*cli.Command{
+			buildSpeedtestCommand(),
+			buildPathCommand(),
+		},
+	}
+}
+
+func buildSpeedtestCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "speedtest",
+		Action:    cliutil.WithErrorHandler(speedtestCommand),
+		Usage:     "Compare the latency, loss and throughput to the Cloudflare edge over QUIC and HTTP/2",
+		UsageText: "cloudflared diag speedtest [command options]",
+		Description: `Measures the path to nearby colos of the Cloudflare edge over both protocols of tunnels, to help choose
+  their --protocol and --region:
+
+  - the round trip time and loss of QUIC and TCP handshakes with a few addresses of each region of the edge, which
+    tunnels connect to. Handshakes that don't complete before --timeout are counted as lost.
+  - the throughput of downloads from the nearest colo over QUIC, with HTTP/3, and over HTTP/2. Set --download-size
+    to 0 to skip them.
+
+  The suggested settings are the protocol and region with the least loss, then the lowest round trip time. Compare
+  regions with --region, e.g.:
+
+  $ cloudflared diag speedtest --region global --region us`,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  speedtestRegionFlag,
+				Value: cli.NewStringSlice(globalRegion),
+				Usage: fmt.Sprintf("Region of the edge to measure, as set by the --region of tunnels or %s. Can be repeated to compare regions.", globalRegion),
+			},
+			&cli.StringFlag{
+				Name:  speedtestEdgeIPVersionFlag,
+				Value: "4",
+				Usage: "IP version of the edge addresses to measure. {4, 6, auto}",
+			},
+			&cli.IntFlag{
+				Name:  speedtestAddrsPerRegionFlag,
+				Value: 2,
+				Usage: "Number of addresses measured in each region of the edge",
+			},
+			&cli.IntFlag{
+				Name:  speedtestProbesFlag,
+				Value: 5,
+				Usage: "Number of handshakes with each address over each protocol",
+			},
+			&cli.DurationFlag{
+				Name:  speedtestTimeoutFlag,
+				Value: 5 * time.Second,
+				Usage: "Time a handshake has to complete before it's counted as lost",
+			},
+			&cli.Int64Flag{
+				Name:  speedtestDownloadSizeFlag,
+				Value: 10 * 1000 * 1000,
+				Usage: "Size in bytes of the downloads that measure the throughput over each protocol, or 0 to skip them",
+			},
+			&cli.StringFlag{
+				Name:   speedtestDownloadURLFlag,
+				Value:  speedtest.DefaultDownloadURL,
+				Usage:  "URL of the downloads, which serves the number of bytes of its bytes parameter",
+				Hidden: true,
+			},
+			outputFormatFlag,
+			templateFormatFlag,
+		},
+		CustomHelpTemplate: commandHelpTemplate(),
+	}
+}
+
+func speedtestCommand(c *cli.Context) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+
+	ipVersion, err := parseConfigIPVersion(c.String(speedtestEdgeIPVersionFlag))
+	if err != nil {
+		return cliutil.UsageError("%v", err)
+	}
+	config := speedtest.Config{
+		IPVersion:      ipVersion,
+		AddrsPerRegion: c.Int(speedtestAddrsPerRegionFlag),
+		Probes:         c.Int(speedtestProbesFlag),
+		Timeout:        c.Duration(speedtestTimeoutFlag),
+		TLSConfigs:     make(map[connection.Protocol]*tls.Config),
+		DownloadURL:    c.String(speedtestDownloadURLFlag),
+		DownloadSize:   c.Int64(speedtestDownloadSizeFlag),
+	}
+	for _, region := range c.StringSlice(speedtestRegionFlag) {
+		if region == globalRegion {
+			region = ""
+		}
+		config.Regions = append(config.Regions, region)
+	}
+	for _, protocol := range speedtest.Protocols {
+		settings := protocol.TLSSettings()
+		tlsConfig, err := tlsconfig.NewTunnelConfig(nil, settings.ServerName)
+		if err != nil {
+			return err
+		}
+		tlsConfig.NextProtos = settings.NextProtos
+		config.TLSConfigs[protocol] = tlsConfig
+	}
+
+	log.Info().Msgf("Measuring the paths to %d addresses of each region of the edge over %s", config.AddrsPerRegion, fmtProtocols())
+	report, err := speedtest.Run(ctx, config, log)
+	if err != nil {
+		return err
+	}
+	if rendered, err := renderOutputFromFlags(c, report); rendered || err != nil {
+		return err
+	}
+	formatAndPrintSpeedtestReport(report)
+	return nil
+}
+
+func fmtProtocols() string {
+	var protocols []string
+	for _, protocol := range speedtest.Protocols {
+		protocols = append(protocols, protocol.String())
+	}
+	return strings.Join(protocols, " and ")
+}
+
+func formatAndPrintSpeedtestReport(report *speedtest.Report) {
+	writer := tabWriter()
+	defer writer.Flush()
+
+	withErrors := false
+	for _, path := range report.Paths {
+		withErrors = withErrors || path.Error != ""
+	}
+	header := "REGION\tEDGE REGION\tADDRESS\tPROTOCOL\tRTT MIN\tRTT AVG\tRTT MAX\tLOSS\t"
+	if withErrors {
+		header += "LAST ERROR\t"
+	}
+	_, _ = fmt.Fprintln(writer, header)
+	for _, path := range report.Paths {
+		rtt := "-\t-\t-"
+		if path.Lost < path.Probes {
+			rtt = fmt.Sprintf("%.1fms\t%.1fms\t%.1fms", path.RTT.Min, path.RTT.Avg, path.RTT.Max)
+		}
+		line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%.0f%%\t",
+			speedtest.RegionName(path.Region), path.EdgeRegion, path.Address, path.Protocol, rtt, path.LossPercent)
+		if withErrors {
+			line += path.Error + "\t"
+		}
+		_, _ = fmt.Fprintln(writer, line)
+	}
+
+	if len(report.Downloads) > 0 {
+		_, _ = fmt.Fprintln(writer, "\nPROTOCOL\tCOLO\tTHROUGHPUT\t")
+		for _, download := range report.Downloads {
+			throughput := fmt.Sprintf("%.1f Mbit/s", download.Mbps)
+			if download.Error != "" {
+				throughput = "failed: " + download.Error
+			}
+			colo := download.Colo
+			if colo == "" {
+				colo = "-"
+			}
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t\n", download.Protocol, colo, throughput)
+		}
+	}
+
+	if report.Suggestion == nil {
+		_, _ = fmt.Fprintln(writer, "\nNo handshake with the edge completed, check that outbound connections to port 7844 are allowed.")
+		return
+	}
+	settings := "--protocol " + report.Suggestion.Protocol
+	if report.Suggestion.Region != "" {
+		settings += " --region " + report.Suggestion.Region
+	}
+	_, _ = fmt.Fprintf(writer, "\nSuggested settings: %s (%.0f%% loss, %.1fms average RTT)\n",
+		settings, report.Suggestion.LossPercent, report.Suggestion.AvgRTT)
+}
+
+func buildPathCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "path",
+		Action:    cliutil.WithErrorHandler(pathCommand),
+		Usage:     "Trace the network path to the edge addresses the connector uses, and probe its MTU",
+		UsageText: "cloudflared diag path [command options] [EDGE-IP...]",
+		Description: `Traces the path to each edge address with mtr if it's installed, or else traceroute, or tracert on Windows, with
+  ICMP, UDP and TCP probes, the latter two to port 7844 of the edge. Then probes the MTU of the path with pings that
+  can't be fragmented.
+
+  The edge addresses are the arguments, or those the connections of the connector running on this machine use if its
+  metrics server is given with --metrics, or else the first address of each region of the edge.
+
+  --archive writes the results and the output of the tools to a zip file, to attach to support tickets:
+
+  $ cloudflared diag path --metrics localhost:2000 --archive cloudflared-diag.zip`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    pathMetricsFlag,
+				Usage:   "Address of the metrics server of the connector running on this machine, to trace the edge addresses its connections use",
+				EnvVars: []string{"TUNNEL_METRICS"},
+			},
+			&cli.StringSliceFlag{
+				Name:  pathModeFlag,
+				Value: cli.NewStringSlice(netdiag.Modes...),
+				Usage: "Protocol of the probes of traces, one of icmp, udp or tcp. Can be repeated.",
+			},
+			&cli.IntFlag{
+				Name:  pathMaxHopsFlag,
+				Value: 30,
+				Usage: "Maximum number of hops of traces",
+			},
+			&cli.IntFlag{
+				Name:  pathCountFlag,
+				Value: 10,
+				Usage: "Number of probes sent to each hop",
+			},
+			&cli.PathFlag{
+				Name:  pathArchiveFlag,
+				Usage: "Write the results and the output of the tools to this zip `FILE`",
+			},
+			outputFormatFlag,
+			templateFormatFlag,
+		},
+		CustomHelpTemplate: commandHelpTemplate(),
+	}
+}
+
+func pathCommand(c *cli.Context) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+
+	targets, err := pathTargets(c, log)
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("Tracing the path to %s, this can take a few minutes", fmtIPs(targets))
+	report, err := netdiag.Run(ctx, netdiag.Config{
+		Targets: targets,
+		Modes:   c.StringSlice(pathModeFlag),
+		MaxHops: c.Int(pathMaxHopsFlag),
+		Count:   c.Int(pathCountFlag),
+	})
+	if err != nil {
+		return cliutil.UsageError("%v", err)
+	}
+
+	if path := c.Path(pathArchiveFlag); path != "" {
+		if err := writePathArchive(path, report); err != nil {
+			return errors.Wrap(err, "failed to write the archive")
+		}
+		log.Info().Msgf("Wrote the results to %s", path)
+	}
+	if rendered, err := renderOutputFromFlags(c, report); rendered || err != nil {
+		return err
+	}
+	formatAndPrintPathReport(report)
+	return nil
+}
+
+// pathTargets returns the edge addresses of the arguments, of the connections of the local connector, or the first
+// address of each region of the edge
+func pathTargets(c *cli.Context, log *zerolog.Logger) ([]net.IP, error) {
+	var targets []net.IP
+	if c.NArg() > 0 {
+		for _, arg := range c.Args().Slice() {
+			ip := net.ParseIP(arg)
+			if ip == nil {
+				return nil, cliutil.UsageError("%s isn't an IP address", arg)
+			}
+			targets = append(targets, ip)
+		}
+		return targets, nil
+	}
+
+	if address := c.String(pathMetricsFlag); address != "" {
+		state, err := fetchConnectorState(address)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, connection := range state.Connections {
+			if connection.EdgeAddress != "" && !seen[connection.EdgeAddress] {
+				seen[connection.EdgeAddress] = true
+				targets = append(targets, net.ParseIP(connection.EdgeAddress))
+			}
+		}
+		if len(targets) == 0 {
+			return nil, fmt.Errorf("the connector at %s has no connection to the edge with a known address", address)
+		}
+		return targets, nil
+	}
+
+	regions, err := allregions.DiscoverRegions(log, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, addrs := range regions {
+		for _, addr := range addrs {
+			if addr.IPVersion == allregions.V4 {
+				targets = append(targets, addr.TCP.IP)
+				break
+			}
+		}
+	}
+	return targets, nil
+}
+
+func fmtIPs(ips []net.IP) string {
+	var formatted []string
+	for _, ip := range ips {
+		formatted = append(formatted, ip.String())
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func writePathArchive(path string, report *netdiag.Report) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := netdiag.WriteArchive(file, report); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func formatAndPrintPathReport(report *netdiag.Report) {
+	writer := tabWriter()
+	defer writer.Flush()
+
+	for _, trace := range report.Traces {
+		_, _ = fmt.Fprintf(writer, "PATH TO %s WITH %s", trace.Target, strings.ToUpper(trace.Mode))
+		if trace.Tool != "" {
+			_, _ = fmt.Fprintf(writer, " (%s)", trace.Tool)
+		}
+		_, _ = fmt.Fprintln(writer, ":")
+		if trace.Error != "" {
+			_, _ = fmt.Fprintf(writer, "Error: %s\n", trace.Error)
+		}
+		if len(trace.Hops) > 0 {
+			_, _ = fmt.Fprintln(writer, "HOP\tHOST\tLOSS\tSENT\tBEST\tAVG\tWORST\t")
+			for _, hop := range trace.Hops {
+				host := hop.Host
+				if host == "" {
+					host = "???"
+				}
+				_, _ = fmt.Fprintf(writer, "%d\t%s\t%.0f%%\t%d\t%.1fms\t%.1fms\t%.1fms\t\n",
+					hop.Number, host, hop.LossPercent, hop.Sent, hop.Best, hop.Avg, hop.Worst)
+			}
+		}
+		_, _ = fmt.Fprintln(writer)
+	}
+
+	_, _ = fmt.Fprintln(writer, "TARGET\tMTU\t")
+	for _, mtu := range report.MTUs {
+		value := strconv.Itoa(mtu.MTU)
+		if mtu.Error != "" {
+			value = "unknown: " + mtu.Error
+		}
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t\n", mtu.Target, value)
+	}
+}
@@ -0,0 +1,68 @@
+package tunnel
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/docker"
+	"github.com/cloudflare/cloudflared/orchestration"
+)
+
+const (
+	dockerLabelsFlag   = "docker-labels"
+	dockerHostFlag     = "docker-host"
+	dockerRouteDNSFlag = "docker-route-dns"
+)
+
+func configureDockerFlags(shouldHide bool) []cli.Flag {
+	return []cli.Flag{
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name: dockerLabelsFlag,
+			Usage: "Publish the running Docker containers labeled with " + docker.HostnameLabel + " and " + docker.PortLabel +
+				" through the tunnel, replacing the ingress rules of the configuration as containers start and stop. " +
+				docker.PathLabel + ", " + docker.SchemeLabel + " and " + docker.NetworkLabel + " labels are optional.",
+			EnvVars: []string{"TUNNEL_DOCKER_LABELS"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    dockerHostFlag,
+			Usage:   "Docker daemon to publish the containers of, as unix:///path/to/socket or tcp://host:port. Defaults to DOCKER_HOST, or " + docker.DefaultHost + ".",
+			EnvVars: []string{"TUNNEL_DOCKER_HOST"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    dockerRouteDNSFlag,
+			Usage:   "Route the hostnames of published Docker containers to the tunnel, leaving existing DNS records alone.",
+			EnvVars: []string{"TUNNEL_DOCKER_ROUTE_DNS"},
+			Hidden:  shouldHide,
+		}),
+	}
+}
+
+// runDockerProvider replaces the ingress rules of the orchestrator with the rules converted from the labels of Docker
+// containers until ctx is done
+func runDockerProvider(
+	ctx context.Context,
+	c *cli.Context,
+	orchestrator *orchestration.Orchestrator,
+	namedTunnel *connection.NamedTunnelProperties,
+	log *zerolog.Logger,
+) error {
+	client, err := docker.NewClient(c.String(dockerHostFlag))
+	if err != nil {
+		return err
+	}
+
+	routeHostname, err := tunnelHostnameRouter(c, dockerRouteDNSFlag, namedTunnel, log)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msg("Publishing labeled Docker containers")
+	provider := docker.NewProvider(client, localIngressApplier(orchestrator), routeHostname, log)
+	return provider.Run(ctx)
+}
@@ -0,0 +1,168 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/secretstore"
+)
+
+// credentialsPassphraseEnv holds the passphrase of credentials encrypted with a passphrase. It's not a flag so that it
+// doesn't show in the command line of the process.
+const credentialsPassphraseEnv = "TUNNEL_CRED_PASSPHRASE"
+
+var (
+	keySourceFlag = &cli.StringFlag{
+		Name: "key-source",
+		Usage: fmt.Sprintf("Encrypt the credentials with a key derived from a passphrase (%s), a key of AWS KMS (%s), or a key of the TPM of this host with systemd-creds (%s)",
+			secretstore.KeySourcePassphrase, secretstore.KeySourceAWSKMS, secretstore.KeySourceTPM),
+		Value: secretstore.KeySourcePassphrase,
+	}
+	kmsKeyFlag = &cli.StringFlag{
+		Name:    "kms-key",
+		Usage:   "The ID, ARN or alias of the AWS KMS key encrypting the credentials",
+		EnvVars: []string{"TUNNEL_CRED_KMS_KEY"},
+	}
+	kmsRegionFlag = &cli.StringFlag{
+		Name:    "kms-region",
+		Usage:   "The region of the AWS KMS key, AWS_REGION by default",
+		EnvVars: []string{"TUNNEL_CRED_KMS_REGION"},
+	}
+	encryptOutputFlag = &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "Write the encrypted credentials to `FILE` instead of replacing the credentials file",
+	}
+)
+
+func buildEncryptCredentialsCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "encrypt-credentials",
+		Action:    cliutil.ConfiguredAction(encryptCredentialsCommand),
+		Usage:     "Encrypt a tunnel credentials file so that it's useless without its key",
+		UsageText: "cloudflared tunnel [tunnel command options] encrypt-credentials [subcommand options] CREDENTIALS_FILE",
+		Description: fmt.Sprintf(`Encrypts the credentials file of a tunnel with AES-GCM, so that copies of the file, e.g. from a stolen disk
+or a backup, don't allow to run the tunnel. cloudflared tunnel run decrypts the file when it starts:
+  - with --key-source %s, the passphrase must be in the %s environment variable
+  - with --key-source %s, cloudflared needs AWS credentials allowing to decrypt with the KMS key
+  - with --key-source %s, the file can only be decrypted on this host, by root`,
+			secretstore.KeySourcePassphrase, credentialsPassphraseEnv, secretstore.KeySourceAWSKMS, secretstore.KeySourceTPM),
+		Flags:              []cli.Flag{keySourceFlag, kmsKeyFlag, kmsRegionFlag, encryptOutputFlag},
+		CustomHelpTemplate: commandHelpTemplate(),
+	}
+}
+
+func encryptCredentialsCommand(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cliutil.UsageError(`"cloudflared tunnel encrypt-credentials" requires exactly 1 argument, the path of the credentials file.`)
+	}
+	path, err := homedir.Expand(c.Args().First())
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't read tunnel credentials from %s", path)
+	}
+	if secretstore.IsSealed(body) {
+		return fmt.Errorf("%s is already encrypted", path)
+	}
+	var credentials connection.Credentials
+	if err := json.Unmarshal(body, &credentials); err != nil {
+		return errInvalidJSONCredential{path: path, err: err}
+	}
+
+	options := secretstore.SealOptions{
+		KeySource: c.String(keySourceFlag.Name),
+		KMSKeyID:  c.String(kmsKeyFlag.Name),
+		KMSRegion: c.String(kmsRegionFlag.Name),
+	}
+	if options.KeySource == secretstore.KeySourcePassphrase {
+		if options.Passphrase, err = newCredentialsPassphrase(); err != nil {
+			return err
+		}
+	}
+	sealed, err := secretstore.Seal(context.Background(), body, options)
+	if err != nil {
+		return err
+	}
+
+	output := path
+	if c.IsSet(encryptOutputFlag.Name) {
+		output = c.String(encryptOutputFlag.Name)
+	}
+	if err := replaceFile(output, sealed); err != nil {
+		return errors.Wrapf(err, "couldn't write the encrypted credentials to %s", output)
+	}
+	fmt.Printf("Encrypted the credentials of tunnel %s in %s\n", credentials.TunnelID, output)
+	if output != path {
+		fmt.Printf("Delete %s and its backups once the encrypted credentials work\n", path)
+	}
+	return nil
+}
+
+// newCredentialsPassphrase returns the passphrase of credentialsPassphraseEnv, or asks it on the terminal
+func newCredentialsPassphrase() (string, error) {
+	if passphrase := os.Getenv(credentialsPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	stdin := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(stdin) {
+		return "", fmt.Errorf("set the passphrase in %s", credentialsPassphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	passphrase, err := terminal.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+	confirmation, err := terminal.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(passphrase) != string(confirmation) {
+		return "", errors.New("the passphrases don't match")
+	}
+	if strings.TrimSpace(string(passphrase)) == "" {
+		return "", errors.New("the passphrase is empty")
+	}
+	return string(passphrase), nil
+}
+
+// openCredentials decrypts credentials encrypted by encrypt-credentials, other credentials are returned as is
+func openCredentials(body []byte) ([]byte, error) {
+	if !secretstore.IsSealed(body) {
+		return body, nil
+	}
+	credentials, err := secretstore.Open(context.Background(), body, os.Getenv(credentialsPassphraseEnv))
+	if err == secretstore.ErrPassphraseRequired {
+		return nil, fmt.Errorf("the tunnel credentials are encrypted with a passphrase, set it in %s", credentialsPassphraseEnv)
+	}
+	return credentials, err
+}
+
+// replaceFile writes data to a file only readable by the user, replacing the file at path if any
+func replaceFile(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0400); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/features"
+)
+
+const (
+	featureOverrideFileFlag  = "feature-override-file"
+	defaultFeatureOverride   = "~/.cloudflared/feature-overrides.json"
+	featureOverrideFileUsage = "Filepath of the feature override file, which force enables or disables features negotiated with the edge until it expires."
+)
+
+var (
+	enableFeatureFlag = &cli.StringSliceFlag{
+		Name:  "enable",
+		Usage: "Feature to force enable, e.g. support_datagram_v2. Can be repeated.",
+	}
+	disableFeatureFlag = &cli.StringSliceFlag{
+		Name:  "disable",
+		Usage: "Feature to force disable. Can be repeated.",
+	}
+	featureOverrideTTLFlag = &cli.DurationFlag{
+		Name:  "ttl",
+		Usage: "How long the override applies for.",
+		Value: time.Hour,
+	}
+)
+
+func configureFeatureOverrideFlags(shouldHide bool) []cli.Flag {
+	return []cli.Flag{
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    featureOverrideFileFlag,
+			Usage:   featureOverrideFileUsage + " It's read every time a connection registers, so an override applies without restarting cloudflared.",
+			Value:   defaultFeatureOverride,
+			EnvVars: []string{"TUNNEL_FEATURE_OVERRIDE_FILE"},
+			Hidden:  shouldHide,
+		}),
+	}
+}
+
+func buildFeaturesCommand() *cli.Command {
+	fileFlag := &cli.StringFlag{
+		Name:    featureOverrideFileFlag,
+		Usage:   featureOverrideFileUsage,
+		Value:   defaultFeatureOverride,
+		EnvVars: []string{"TUNNEL_FEATURE_OVERRIDE_FILE"},
+	}
+	return &cli.Command{
+		Name:      "features",
+		Category:  "Tunnel",
+		Usage:     "Override the features negotiated with the edge, to debug them",
+		UsageText: "cloudflared tunnel features COMMAND [arguments...]",
+		Description: `Force enables or disables features negotiated with the edge, e.g. support_datagram_v2, regardless of the
+features cloudflared would use, until the override expires. Running tunnels read the override file every time a
+connection registers, so the override applies to the next connections without restarting them. The features in effect
+in a running tunnel are served on /features of its metrics server.`,
+		Subcommands: []*cli.Command{
+			{
+				Name:      "override",
+				Action:    cliutil.WithErrorHandler(overrideFeaturesCommand),
+				Usage:     "Force enable or disable features until the override expires",
+				UsageText: "cloudflared tunnel features override [--enable FEATURE] [--disable FEATURE] [--ttl DURATION]",
+				Flags:     []cli.Flag{fileFlag, enableFeatureFlag, disableFeatureFlag, featureOverrideTTLFlag},
+			},
+			{
+				Name:      "show",
+				Action:    cliutil.WithErrorHandler(showFeatureOverrideCommand),
+				Usage:     "Show the override of the features",
+				UsageText: "cloudflared tunnel features show",
+				Flags:     []cli.Flag{fileFlag},
+			},
+			{
+				Name:      "clear",
+				Action:    cliutil.WithErrorHandler(clearFeatureOverrideCommand),
+				Usage:     "Remove the override of the features",
+				UsageText: "cloudflared tunnel features clear",
+				Flags:     []cli.Flag{fileFlag},
+			},
+		},
+	}
+}
+
+// featureOverrideFile returns the path of the feature override file
+func featureOverrideFile(c *cli.Context) (string, error) {
+	path := c.String(featureOverrideFileFlag)
+	if path == "" {
+		return "", nil
+	}
+	return homedir.Expand(path)
+}
+
+func overrideFeaturesCommand(c *cli.Context) error {
+	enable, disable := c.StringSlice(enableFeatureFlag.Name), c.StringSlice(disableFeatureFlag.Name)
+	if len(enable) == 0 && len(disable) == 0 {
+		return cliutil.UsageError("Set the features to enable with --%s or to disable with --%s.", enableFeatureFlag.Name, disableFeatureFlag.Name)
+	}
+	ttl := c.Duration(featureOverrideTTLFlag.Name)
+	if ttl <= 0 {
+		return cliutil.UsageError("--%s must be positive.", featureOverrideTTLFlag.Name)
+	}
+	path, err := featureOverrideFile(c)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return cliutil.UsageError("Set the feature override file with --%s.", featureOverrideFileFlag)
+	}
+	override := &features.Override{
+		Enable:  enable,
+		Disable: disable,
+		Expires: time.Now().Add(ttl).UTC().Truncate(time.Second),
+	}
+	if err := features.SaveOverride(path, override); err != nil {
+		return errors.Wrapf(err, "couldn't write the feature override file %s", path)
+	}
+	fmt.Printf("Features overridden in %s until %s\n", path, override.Expires.Format(time.RFC3339))
+	return nil
+}
+
+func showFeatureOverrideCommand(c *cli.Context) error {
+	path, err := featureOverrideFile(c)
+	if err != nil {
+		return err
+	}
+	override, err := features.LoadOverride(path)
+	if err != nil {
+		return err
+	}
+	if override.Expired(time.Now()) {
+		fmt.Println("No feature override in effect")
+		return nil
+	}
+	data, err := json.MarshalIndent(override, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func clearFeatureOverrideCommand(c *cli.Context) error {
+	path, err := featureOverrideFile(c)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "couldn't remove the feature override file %s", path)
+	}
+	fmt.Println("Feature override cleared")
+	return nil
+}
@@ -0,0 +1,130 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/cloudflare/cloudflared/signal"
+)
+
+const (
+	postStartHookFlag = "post-start-hook"
+	preStopHookFlag   = "pre-stop-hook"
+	hookTimeoutFlag   = "hook-timeout"
+)
+
+func configureHookFlags(shouldHide bool) []cli.Flag {
+	return []cli.Flag{
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    postStartHookFlag,
+			Usage:   "Shell `COMMAND` to run once the first connection to the edge is registered, e.g. to register the tunnel in a service registry. It has CLOUDFLARED_TUNNEL_ID, CLOUDFLARED_CONNECTOR_ID and CLOUDFLARED_HOOK in its environment.",
+			EnvVars: []string{"TUNNEL_POST_START_HOOK"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    preStopHookFlag,
+			Usage:   "Shell `COMMAND` to run when graceful shutdown starts, before it completes. It has the same environment as the post-start hook.",
+			EnvVars: []string{"TUNNEL_PRE_STOP_HOOK"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    hookTimeoutFlag,
+			Usage:   "Time the hooks have to run before they're killed.",
+			Value:   time.Second * 30,
+			EnvVars: []string{"TUNNEL_HOOK_TIMEOUT"},
+			Hidden:  shouldHide,
+		}),
+	}
+}
+
+// runHooks runs the commands of the post-start and pre-stop hooks of tunnel run
+type runHooks struct {
+	postStart string
+	preStop   string
+	timeout   time.Duration
+	// env is added to the environment of the commands
+	env []string
+	log *zerolog.Logger
+}
+
+func newRunHooks(c *cli.Context, tunnelID, connectorID uuid.UUID, log *zerolog.Logger) *runHooks {
+	env := []string{fmt.Sprintf("CLOUDFLARED_CONNECTOR_ID=%s", connectorID)}
+	if tunnelID != uuid.Nil {
+		env = append(env, fmt.Sprintf("CLOUDFLARED_TUNNEL_ID=%s", tunnelID))
+	}
+	return &runHooks{
+		postStart: c.String(postStartHookFlag),
+		preStop:   c.String(preStopHookFlag),
+		timeout:   c.Duration(hookTimeoutFlag),
+		env:       env,
+		log:       log,
+	}
+}
+
+// runPostStart runs the post-start hook once the tunnel is connected. It returns when ctx is done before that.
+func (h *runHooks) runPostStart(ctx context.Context, connectedSignal *signal.Signal) {
+	if h.postStart == "" {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-connectedSignal.Wait():
+		h.run("post-start", h.postStart)
+	}
+}
+
+// runPreStop runs the pre-stop hook when graceful shutdown starts. It returns when ctx is done before that.
+func (h *runHooks) runPreStop(ctx context.Context, graceShutdownC <-chan struct{}) {
+	if h.preStop == "" {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-graceShutdownC:
+		h.run("pre-stop", h.preStop)
+	}
+}
+
+func (h *runHooks) run(hook, command string) {
+	log := h.log.With().Str("hook", hook).Logger()
+	// The hook isn't stopped with the tunnel, so that a pre-stop hook runs through the grace period
+	ctx := context.Background()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	cmd := shellCommand(ctx, command)
+	cmd.Env = append(os.Environ(), h.env...)
+	cmd.Env = append(cmd.Env, "CLOUDFLARED_HOOK="+hook)
+	// Not pipes, which would be waited for as long as a process started by the command has them open after a timeout
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	log.Info().Msgf("Running the %s hook", hook)
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Error().Msgf("The %s hook didn't finish in %s", hook, h.timeout)
+		return
+	}
+	if err != nil {
+		log.Err(err).Msgf("The %s hook failed", hook)
+		return
+	}
+	log.Debug().Msgf("The %s hook finished", hook)
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
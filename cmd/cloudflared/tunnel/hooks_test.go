@@ -0,0 +1,80 @@
+package tunnel
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/signal"
+)
+
+func TestRunHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks of the test are shell commands")
+	}
+	dir := t.TempDir()
+	log := zerolog.Nop()
+	tunnelID := uuid.New()
+	connectorID := uuid.New()
+	hooks := &runHooks{
+		postStart: `echo "$CLOUDFLARED_HOOK $CLOUDFLARED_TUNNEL_ID $CLOUDFLARED_CONNECTOR_ID" > ` + filepath.Join(dir, "post-start"),
+		preStop:   `echo "$CLOUDFLARED_HOOK" > ` + filepath.Join(dir, "pre-stop"),
+		timeout:   time.Second * 10,
+		env:       newRunHooks(newCompletionContext(t, nil, nil), tunnelID, connectorID, &log).env,
+		log:       &log,
+	}
+
+	connectedSignal := signal.New(make(chan struct{}))
+	postStartDone := make(chan struct{})
+	go func() {
+		hooks.runPostStart(context.Background(), connectedSignal)
+		close(postStartDone)
+	}()
+	connectedSignal.Notify()
+	<-postStartDone
+	output, err := ioutil.ReadFile(filepath.Join(dir, "post-start"))
+	require.NoError(t, err)
+	assert.Equal(t, "post-start "+tunnelID.String()+" "+connectorID.String()+"\n", string(output))
+
+	graceShutdownC := make(chan struct{})
+	close(graceShutdownC)
+	hooks.runPreStop(context.Background(), graceShutdownC)
+	output, err = ioutil.ReadFile(filepath.Join(dir, "pre-stop"))
+	require.NoError(t, err)
+	assert.Equal(t, "pre-stop\n", string(output))
+}
+
+func TestRunHooksStopped(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks of the test are shell commands")
+	}
+	dir := t.TempDir()
+	log := zerolog.Nop()
+	hooks := &runHooks{
+		postStart: "touch " + filepath.Join(dir, "post-start"),
+		preStop:   "exec sleep 10",
+		timeout:   time.Millisecond * 100,
+		log:       &log,
+	}
+
+	// The hooks don't run if the tunnel stops before
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hooks.runPostStart(ctx, signal.New(make(chan struct{})))
+	assert.NoFileExists(t, filepath.Join(dir, "post-start"))
+
+	// Hooks are killed after the timeout
+	graceShutdownC := make(chan struct{})
+	close(graceShutdownC)
+	start := time.Now()
+	hooks.runPreStop(context.Background(), graceShutdownC)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
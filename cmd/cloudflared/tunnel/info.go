@@ -1,16 +1,96 @@
 package tunnel
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 
 	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/metrics"
+	"github.com/cloudflare/cloudflared/tunnelstate"
 )
 
+// connectorStateTimeout bounds how long tunnel info waits for the metrics server of the local connector
+const connectorStateTimeout = 3 * time.Second
+
 type Info struct {
 	ID         uuid.UUID             `json:"id"`
 	Name       string                `json:"name"`
 	CreatedAt  time.Time             `json:"createdAt"`
 	Connectors []*cfapi.ActiveClient `json:"conns"`
+	// LocalConnector is set when the connector running on this machine is one of the connectors of the tunnel
+	LocalConnector *LocalConnector `json:"localConnector,omitempty"`
+}
+
+// LocalConnector is the connector running on this machine, with the state of its connections to the edge as reported
+// by its metrics server
+type LocalConnector struct {
+	metrics.ConnectorState
+	Version string `json:"version"`
+}
+
+// findLocalConnector gets the state of the connector whose metrics server listens at address, and merges it with the
+// connector of the tunnel with the same ID. It's nil if the connector isn't a connector of the tunnel.
+func findLocalConnector(address string, connectors []*cfapi.ActiveClient) (*LocalConnector, error) {
+	state, err := fetchConnectorState(address)
+	if err != nil {
+		return nil, err
+	}
+	for _, connector := range connectors {
+		if connector.ID == state.ConnectorID {
+			return &LocalConnector{ConnectorState: *state, Version: connector.Version}, nil
+		}
+	}
+	return nil, nil
+}
+
+func fetchConnectorState(address string) (*metrics.ConnectorState, error) {
+	client := http.Client{Timeout: connectorStateTimeout}
+	resp, err := client.Get(fmt.Sprintf("http://%s/connections", address))
+	if err != nil {
+		return nil, errors.Wrap(err, "error querying the metrics server of the local connector")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the metrics server of the local connector responded with status %s", resp.Status)
+	}
+	var state metrics.ConnectorState
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return nil, errors.Wrap(err, "error parsing the response of the metrics server of the local connector")
+	}
+	return &state, nil
+}
+
+func printLocalConnector(w io.Writer, connector *LocalConnector, now time.Time) {
+	_, _ = fmt.Fprintf(w, "\nCONNECTIONS OF THE CONNECTOR ON THIS MACHINE (%s, version %s):\n", connector.ConnectorID, connector.Version)
+	_, _ = fmt.Fprintln(w, "INDEX\tEDGE\tPROTOCOL\tUPTIME\tRECENT ERRORS\t")
+	for _, connection := range connector.Connections {
+		edge, protocol, uptime := "-", "-", "disconnected"
+		if connection.IsConnected {
+			edge, protocol = connection.Location, connection.Protocol
+			if connection.ConnectedAt != nil {
+				uptime = now.Sub(*connection.ConnectedAt).Round(time.Second).String()
+			}
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t\n", connection.Index, edge, protocol, uptime, fmtRecentErrors(connection.RecentErrors))
+	}
+}
+
+// fmtRecentErrors shows the last error, and how many errors happened before it
+func fmtRecentErrors(recentErrors []tunnelstate.ConnectionError) string {
+	if len(recentErrors) == 0 {
+		return "-"
+	}
+	last := recentErrors[len(recentErrors)-1]
+	message := fmt.Sprintf("%s: %s", last.Time.Format(time.RFC3339), strings.SplitN(last.Message, "\n", 2)[0])
+	if len(recentErrors) > 1 {
+		message += fmt.Sprintf(" (and %d before)", len(recentErrors)-1)
+	}
+	return message
 }
@@ -0,0 +1,64 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/metrics"
+	"github.com/cloudflare/cloudflared/tunnelstate"
+)
+
+func TestFindLocalConnector(t *testing.T) {
+	connectorID := uuid.New()
+	connectedAt := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	state := metrics.ConnectorState{
+		ConnectorID: connectorID,
+		Connections: []metrics.ConnectionState{
+			{Index: 0, IsConnected: true, Location: "lax01", Protocol: "quic", ConnectedAt: &connectedAt, UptimeSeconds: 90},
+			{Index: 1, RecentErrors: []tunnelstate.ConnectionError{
+				{Time: connectedAt, Message: "timeout: no recent network activity"},
+				{Time: connectedAt.Add(time.Minute), Message: "connection closed\nstack trace"},
+			}},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/connections", r.URL.Path)
+		_ = json.NewEncoder(w).Encode(state)
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	connector, err := findLocalConnector(address, []*cfapi.ActiveClient{{ID: uuid.New()}, {ID: connectorID, Version: "2022.7.1"}})
+	require.NoError(t, err)
+	require.NotNil(t, connector)
+	assert.Equal(t, "2022.7.1", connector.Version)
+	assert.Equal(t, state.Connections[0].Location, connector.Connections[0].Location)
+
+	var output bytes.Buffer
+	printLocalConnector(&output, connector, connectedAt.Add(90*time.Second))
+	assert.Equal(t, `
+CONNECTIONS OF THE CONNECTOR ON THIS MACHINE (`+connectorID.String()+`, version 2022.7.1):
+INDEX	EDGE	PROTOCOL	UPTIME	RECENT ERRORS	
+0	lax01	quic	1m30s	-	
+1	-	-	disconnected	2022-07-01T12:01:00Z: connection closed (and 1 before)	
+`, output.String())
+
+	// The connector on this machine runs another tunnel
+	connector, err = findLocalConnector(address, []*cfapi.ActiveClient{{ID: uuid.New()}})
+	require.NoError(t, err)
+	assert.Nil(t, connector)
+
+	server.Close()
+	_, err = findLocalConnector(address, nil)
+	assert.Error(t, err)
+}
@@ -3,17 +3,30 @@ package tunnel
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"os"
+	"sort"
+	"strings"
 
 	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
 	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/proxy"
+	tunnelpogs "github.com/cloudflare/cloudflared/tunnelrpc/pogs"
+	"github.com/cloudflare/cloudflared/websocket"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 )
 
-const ingressDataJSONFlagName = "json"
+const (
+	ingressDataJSONFlagName = "json"
+	ingressRuleMethodFlag   = "method"
+	ingressRuleHeaderFlag   = "header"
+)
 
 var ingressDataJSON = &cli.StringFlag{
 	Name:    ingressDataJSONFlagName,
@@ -68,13 +81,28 @@ func buildTestURLCommand() *cli.Command {
 		Name:      "rule",
 		Action:    cliutil.ConfiguredAction(testURLCommand),
 		Usage:     "Check which ingress rule matches a given request URL",
-		UsageText: "cloudflared tunnel [--config FILEPATH] ingress rule URL",
+		UsageText: "cloudflared tunnel [--config FILEPATH] ingress rule [--method METHOD] [--header 'NAME: VALUE'] URL",
 		ArgsUsage: "URL",
 		Description: "Check which ingress rule matches a given request URL. " +
 			"Ingress rules match a request's hostname and path. Hostname is " +
 			"optional and is either a full hostname like `www.example.com` or a " +
 			"hostname with a `*` for its subdomains, e.g. `*.example.com`. Path " +
-			"is optional and matches a regular expression, like `/[a-zA-Z0-9_]+.html`",
+			"is optional and matches a regular expression, like `/[a-zA-Z0-9_]+.html`. " +
+			"The request is simulated without being sent: the request the origin would receive after the " +
+			"rewrites of the rule, and the effective originRequest settings of the rule, are printed.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    ingressRuleMethodFlag,
+				Aliases: []string{"X"},
+				Usage:   "Method of the simulated request",
+				Value:   http.MethodGet,
+			},
+			&cli.StringSliceFlag{
+				Name:    ingressRuleHeaderFlag,
+				Aliases: []string{"H"},
+				Usage:   "Header of the simulated request, formatted as 'NAME: VALUE'. It can be repeated.",
+			},
+		},
 	}
 }
 
@@ -138,8 +166,67 @@ func testURLCommand(c *cli.Context) error {
 		return errors.Wrap(err, "Validation failed")
 	}
 
-	_, i := ing.FindMatchingRule(requestURL.Hostname(), requestURL.Path)
-	fmt.Printf("Matched rule #%d\n", i+1)
-	fmt.Println(ing.Rules[i].MultiLineString())
+	req, err := http.NewRequest(c.String(ingressRuleMethodFlag), requestURL.String(), nil)
+	if err != nil {
+		return errors.Wrap(err, "invalid request")
+	}
+	for _, header := range c.StringSlice(ingressRuleHeaderFlag) {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("invalid header %q, it must be formatted as 'NAME: VALUE'", header)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+		} else {
+			req.Header.Add(name, value)
+		}
+	}
+	tags, err := NewTagSliceFromCLI(c.StringSlice("tag"))
+	if err != nil {
+		return errors.Wrap(err, "invalid tags")
+	}
+	return printSimulatedRequest(os.Stdout, ing, tags, req)
+}
+
+// printSimulatedRequest prints the rule of ing req matches, how cloudflared with tags answers it or the request its
+// origin receives, and the effective originRequest settings of the rule
+func printSimulatedRequest(w io.Writer, ing ingress.Ingress, tags []tunnelpogs.Tag, req *http.Request) error {
+	log := zerolog.Nop()
+	originProxy := proxy.NewOriginProxy(ing, ingress.WarpRoutingConfig{}, tags, &log, proxy.Options{Health: proxy.NewConnectorHealth(&log)})
+	simulated := originProxy.Simulate(req, websocket.IsWebSocketUpgrade(req))
+	rule := ing.Rules[simulated.RuleIndex]
+	fmt.Fprintf(w, "Matched rule #%d\n", simulated.RuleIndex+1)
+	fmt.Fprintln(w, rule.MultiLineString())
+
+	if simulated.LocalResponse != "" {
+		fmt.Fprintf(w, "The request isn't proxied to the origin, cloudflared answers with %s\n", simulated.LocalResponse)
+	} else if originReq := simulated.OriginRequest; originReq != nil {
+		fmt.Fprintln(w, "Request to the origin:")
+		fmt.Fprintf(w, "\t%s %s\n", originReq.Method, originReq.URL)
+		fmt.Fprintf(w, "\tHost: %s\n", originReq.Host)
+		names := make([]string, 0, len(originReq.Header))
+		for name := range originReq.Header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, value := range originReq.Header[name] {
+				fmt.Fprintf(w, "\t%s: %s\n", name, value)
+			}
+		}
+		if simulated.ServerName != "" {
+			fmt.Fprintf(w, "\tTLS server name: %s\n", simulated.ServerName)
+		}
+	} else {
+		fmt.Fprintln(w, "The service of the rule isn't an HTTP origin, the request isn't proxied to it over HTTP")
+	}
+
+	settings, err := json.MarshalIndent(ingress.ConvertToRawOriginConfig(rule.Config), "\t", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "Effective originRequest settings, besides the defaults:")
+	fmt.Fprintf(w, "\t%s\n", settings)
 	return nil
 }
@@ -0,0 +1,56 @@
+package tunnel
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/ingress"
+	tunnelpogs "github.com/cloudflare/cloudflared/tunnelrpc/pogs"
+)
+
+func TestPrintSimulatedRequest(t *testing.T) {
+	hostHeader := "internal.example.com"
+	healthPath := "/_tunnel/healthz"
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{Hostname: "app.example.com", Service: "https://localhost:8443", OriginRequest: config.OriginRequestConfig{HTTPHostHeader: &hostHeader, HealthPath: &healthPath}},
+			{Service: "http_status:404"},
+		},
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPut, "https://app.example.com/users/1", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	var out bytes.Buffer
+	tags := []tunnelpogs.Tag{{Name: "Env", Value: "prod"}}
+	require.NoError(t, printSimulatedRequest(&out, ing, tags, req))
+	assert.Contains(t, out.String(), "Matched rule #1\n\thostname: app.example.com\n\tservice: https://localhost:8443\n")
+	assert.Contains(t, out.String(), "Request to the origin:\n"+
+		"\tPUT https://localhost:8443/users/1\n"+
+		"\tHost: internal.example.com\n"+
+		"\tCf-Warp-Tag-Env: prod\n"+
+		"\tConnection: keep-alive\n"+
+		"\tContent-Type: application/json\n"+
+		"\tUser-Agent: \n"+
+		"\tX-Forwarded-Host: app.example.com\n"+
+		"\tTLS server name: localhost\n")
+	assert.Contains(t, out.String(), `"httpHostHeader": "internal.example.com"`)
+
+	req, err = http.NewRequest(http.MethodGet, "https://other.example.com/", nil)
+	require.NoError(t, err)
+	out.Reset()
+	require.NoError(t, printSimulatedRequest(&out, ing, nil, req))
+	assert.Contains(t, out.String(), "Matched rule #2\n")
+
+	req, err = http.NewRequest(http.MethodGet, "http://app.example.com/_tunnel/healthz", nil)
+	require.NoError(t, err)
+	out.Reset()
+	require.NoError(t, printSimulatedRequest(&out, ing, nil, req))
+	assert.Contains(t, out.String(), "The request isn't proxied to the origin, cloudflared answers with the health of cloudflared")
+}
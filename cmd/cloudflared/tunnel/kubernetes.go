@@ -0,0 +1,73 @@
+package tunnel
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/kubernetes"
+	"github.com/cloudflare/cloudflared/orchestration"
+)
+
+const (
+	kubernetesIngressClassFlag = "kubernetes-ingress-class"
+	kubernetesNamespaceFlag    = "kubernetes-namespace"
+	kubernetesRouteDNSFlag     = "kubernetes-route-dns"
+)
+
+func configureKubernetesFlags(shouldHide bool) []cli.Flag {
+	return []cli.Flag{
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    kubernetesIngressClassFlag,
+			Usage:   "Publish the Kubernetes ingresses of this class through the tunnel, replacing the ingress rules of the configuration as they change. Requires running in the cluster, with a service account allowed to list and watch ingresses and get services.",
+			EnvVars: []string{"TUNNEL_KUBERNETES_INGRESS_CLASS"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    kubernetesNamespaceFlag,
+			Usage:   "Only publish the Kubernetes ingresses of this namespace. Ingresses of all namespaces are published by default.",
+			EnvVars: []string{"TUNNEL_KUBERNETES_NAMESPACE"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:    kubernetesRouteDNSFlag,
+			Usage:   "Route the hostnames of published Kubernetes ingresses to the tunnel, leaving existing DNS records alone.",
+			EnvVars: []string{"TUNNEL_KUBERNETES_ROUTE_DNS"},
+			Hidden:  shouldHide,
+		}),
+	}
+}
+
+// runKubernetesController replaces the ingress rules of the orchestrator with the rules converted from Kubernetes
+// ingresses until ctx is done
+func runKubernetesController(
+	ctx context.Context,
+	c *cli.Context,
+	orchestrator *orchestration.Orchestrator,
+	namedTunnel *connection.NamedTunnelProperties,
+	log *zerolog.Logger,
+) error {
+	client, err := kubernetes.NewInClusterClient()
+	if err != nil {
+		return err
+	}
+
+	routeHostname, err := tunnelHostnameRouter(c, kubernetesRouteDNSFlag, namedTunnel, log)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("class", c.String(kubernetesIngressClassFlag)).Msg("Publishing Kubernetes ingresses")
+	controller := kubernetes.NewController(
+		client,
+		c.String(kubernetesIngressClassFlag),
+		c.String(kubernetesNamespaceFlag),
+		localIngressApplier(orchestrator),
+		routeHostname,
+		log,
+	)
+	return controller.Run(ctx)
+}
@@ -0,0 +1,97 @@
+package tunnel
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+)
+
+// The keys of labels are like the keys of Kubernetes labels, e.g. team or example.com/environment
+var labelKeyRegexp = regexp.MustCompile(`^([a-z0-9.-]+/)?[A-Za-z0-9]([A-Za-z0-9_.-]*[A-Za-z0-9])?$`)
+
+var (
+	createLabelFlag = &cli.StringSliceFlag{
+		Name:  "label",
+		Usage: "Attaches a `KEY=VALUE` label to the tunnel, e.g. team=payments, to filter tunnel list with. Can be repeated.",
+	}
+	listLabelFlag = &cli.StringSliceFlag{
+		Name:    "label",
+		Aliases: []string{"l"},
+		Usage:   "List tunnels with the given label, either `KEY=VALUE` or only KEY to list the tunnels with the label whatever its value. Can be repeated to list the tunnels with all the labels.",
+		EnvVars: []string{"TUNNEL_LIST_LABEL"},
+	}
+)
+
+// parseLabels parses labels in the form key=value
+func parseLabels(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(values))
+	for _, value := range values {
+		key, labelValue, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("label %s must be in the form KEY=VALUE", value)
+		}
+		if !labelKeyRegexp.MatchString(key) {
+			return nil, fmt.Errorf("%s is not a valid label key: it can only have letters, digits, '-', '_' and '.', optionally after a prefix ending with '/'", key)
+		}
+		labels[key] = labelValue
+	}
+	return labels, nil
+}
+
+// labelSelector selects the tunnels that have all its labels. A label with no value selects the tunnels with the label
+// whatever its value.
+type labelSelector map[string]*string
+
+func parseLabelSelector(values []string) labelSelector {
+	selector := make(labelSelector, len(values))
+	for _, value := range values {
+		if key, labelValue, ok := strings.Cut(value, "="); ok {
+			selector[key] = &labelValue
+		} else {
+			selector[value] = nil
+		}
+	}
+	return selector
+}
+
+func (s labelSelector) matches(tunnel *cfapi.Tunnel) bool {
+	labels := tunnel.Labels()
+	for key, value := range s {
+		labelValue, ok := labels[key]
+		if !ok || (value != nil && *value != labelValue) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s labelSelector) filter(tunnels []*cfapi.Tunnel) []*cfapi.Tunnel {
+	if len(s) == 0 {
+		return tunnels
+	}
+	selected := make([]*cfapi.Tunnel, 0)
+	for _, tunnel := range tunnels {
+		if s.matches(tunnel) {
+			selected = append(selected, tunnel)
+		}
+	}
+	return selected
+}
+
+// fmtLabels formats labels as key=value, sorted by key
+func fmtLabels(labels map[string]string) string {
+	var formatted []string
+	for key, value := range labels {
+		formatted = append(formatted, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(formatted)
+	return strings.Join(formatted, ",")
+}
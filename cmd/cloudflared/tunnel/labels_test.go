@@ -0,0 +1,39 @@
+package tunnel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels([]string{"team=payments", "example.com/environment=staging", "empty="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "payments", "example.com/environment": "staging", "empty": ""}, labels)
+
+	labels, err = parseLabels(nil)
+	require.NoError(t, err)
+	assert.Nil(t, labels)
+
+	for _, invalid := range []string{"team", "=payments", "team name=payments", "-team=payments", "example.com/=staging"} {
+		_, err := parseLabels([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLabelSelector(t *testing.T) {
+	payments := &cfapi.Tunnel{Name: "payments", Metadata: map[string]interface{}{"team": "payments", "environment": "production"}}
+	staging := &cfapi.Tunnel{Name: "staging", Metadata: map[string]interface{}{"team": "payments", "environment": "staging"}}
+	unlabeled := &cfapi.Tunnel{Name: "unlabeled"}
+	tunnels := []*cfapi.Tunnel{payments, staging, unlabeled}
+
+	assert.Equal(t, tunnels, parseLabelSelector(nil).filter(tunnels))
+	assert.Equal(t, []*cfapi.Tunnel{payments, staging}, parseLabelSelector([]string{"team"}).filter(tunnels))
+	assert.Equal(t, []*cfapi.Tunnel{staging}, parseLabelSelector([]string{"team=payments", "environment=staging"}).filter(tunnels))
+	assert.Empty(t, parseLabelSelector([]string{"team=search"}).filter(tunnels))
+
+	assert.Equal(t, "environment=staging,team=payments", fmtLabels(staging.Labels()))
+}
@@ -0,0 +1,59 @@
+package tunnel
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/orchestration"
+)
+
+// localIngressApplier returns a function replacing the ingress rules of orchestrator, for rules discovered locally
+// e.g. from Kubernetes ingresses or Docker containers. Settings of the configuration file, e.g. originRequest, still
+// apply to them.
+func localIngressApplier(orchestrator *orchestration.Orchestrator) func([]config.UnvalidatedIngressRule) error {
+	fileConfig := config.GetConfiguration()
+	return func(rules []config.UnvalidatedIngressRule) error {
+		ingressRules, err := ingress.ParseIngress(&config.Configuration{
+			Ingress:       rules,
+			OriginRequest: fileConfig.OriginRequest,
+		})
+		if err != nil {
+			return err
+		}
+		return orchestrator.UpdateLocalIngress(ingressRules)
+	}
+}
+
+// tunnelHostnameRouter returns a function routing hostnames to the named tunnel if routeDNSFlag is set, or nil
+func tunnelHostnameRouter(
+	c *cli.Context,
+	routeDNSFlag string,
+	namedTunnel *connection.NamedTunnelProperties,
+	log *zerolog.Logger,
+) (func(string) error, error) {
+	if !c.Bool(routeDNSFlag) {
+		return nil, nil
+	}
+	if namedTunnel == nil {
+		return nil, fmt.Errorf("--%s requires a named tunnel", routeDNSFlag)
+	}
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return nil, err
+	}
+	tunnelID := namedTunnel.Credentials.TunnelID
+	return func(hostname string) error {
+		res, err := sc.route(tunnelID, cfapi.NewDNSRoute(hostname, false))
+		if err != nil {
+			return err
+		}
+		log.Info().Str("hostname", hostname).Msg(res.SuccessSummary())
+		return nil
+	}, nil
+}
@@ -15,12 +15,15 @@ import (
 	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
 	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/logger"
+	"github.com/cloudflare/cloudflared/secretstore"
 	"github.com/cloudflare/cloudflared/token"
 )
 
 const (
-	baseLoginURL     = "https://dash.cloudflare.com/argotunnel"
-	callbackStoreURL = "https://login.cloudflareaccess.org/"
+	baseLoginURL      = "https://dash.cloudflare.com/argotunnel"
+	callbackStoreURL  = "https://login.cloudflareaccess.org/"
+	noBrowserFlag     = "no-browser"
+	secureStorageFlag = "secure-storage"
 )
 
 func buildLoginSubcommand(hidden bool) *cli.Command {
@@ -30,11 +33,26 @@ func buildLoginSubcommand(hidden bool) *cli.Command {
 		Usage:     "Generate a configuration file with your login details",
 		ArgsUsage: " ",
 		Hidden:    hidden,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    noBrowserFlag,
+				Usage:   "Log in from a browser on another device, e.g. on a headless server. This is the default without a display or over SSH.",
+				EnvVars: []string{"TUNNEL_LOGIN_NO_BROWSER"},
+			},
+			&cli.BoolFlag{
+				Name:    secureStorageFlag,
+				Usage:   "Store the certificate in the keyring of the OS instead of cert.pem, login fails if there's none. Commands use it when there is no file at the origincert path.",
+				EnvVars: []string{"TUNNEL_LOGIN_SECURE_STORAGE"},
+			},
+		},
 	}
 }
 
 func login(c *cli.Context) error {
 	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+	if c.Bool(noBrowserFlag) {
+		token.SetHeadless()
+	}
 
 	path, ok, err := checkForExistingCert()
 	if ok {
@@ -64,6 +82,20 @@ func login(c *cli.Context) error {
 		return err
 	}
 
+	if c.Bool(secureStorageFlag) {
+		store, err := secretstore.Default()
+		if err == nil {
+			err = store.Set(config.DefaultCredentialFile, resourceData)
+		}
+		if err == secretstore.ErrNoKeyring {
+			return errors.Wrapf(err, "the certificate can't be stored securely, run login without --%s to save it to %s", secureStorageFlag, path)
+		} else if err != nil {
+			return errors.Wrap(err, "error storing cert")
+		}
+		fmt.Fprintf(os.Stdout, "You have successfully logged in.\nYour certificate has been saved to %s.\n", store.Description())
+		return nil
+	}
+
 	if err := ioutil.WriteFile(path, resourceData, 0600); err != nil {
 		return errors.Wrap(err, fmt.Sprintf("error writing cert to %s", path))
 	}
@@ -0,0 +1,194 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/proxy"
+)
+
+const maintenanceSocketFlagName = "maintenance-socket"
+
+var (
+	// maintenanceSocketFlag enables the maintenance endpoint of tunnel run
+	maintenanceSocketFlag = altsrc.NewStringFlag(&cli.StringFlag{
+		Name: maintenanceSocketFlagName,
+		Usage: "Unix socket to serve the maintenance endpoint on, toggled with \"cloudflared tunnel maintenance\". " +
+			"Only the user running cloudflared can connect to it.",
+		EnvVars: []string{"TUNNEL_MAINTENANCE_SOCKET"},
+	})
+	maintenanceClientSocketFlag = &cli.StringFlag{
+		Name:     maintenanceSocketFlagName,
+		Usage:    "Maintenance socket of the connector running on this machine, as set with its --maintenance-socket",
+		EnvVars:  []string{"TUNNEL_MAINTENANCE_SOCKET"},
+		Required: true,
+	}
+)
+
+func buildMaintenanceCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "maintenance",
+		Category:  "Tunnel",
+		Usage:     "Serve a maintenance page instead of the origin of ingress rules, during planned downtime",
+		UsageText: "cloudflared tunnel maintenance COMMAND [arguments...]",
+		Description: `Puts the ingress rules of a hostname of a running connector in maintenance mode, and takes them out of it,
+through the socket of its --maintenance-socket. The requests to rules in maintenance mode are answered with their maintenanceStatus (503 by
+default) and maintenancePage instead of being proxied to their origin. Rules are selected by their hostname as
+configured, e.g. *.example.com for a wildcard rule or * for the catch-all rule. Maintenance mode is kept when the
+configuration is updated, until the connector restarts.`,
+		Subcommands: []*cli.Command{
+			{
+				Name:      "enable",
+				Action:    cliutil.WithErrorHandler(enableMaintenanceCommand),
+				Usage:     "Put the ingress rules of a hostname in maintenance mode",
+				UsageText: "cloudflared tunnel maintenance enable --maintenance-socket PATH HOSTNAME",
+				Flags:     []cli.Flag{maintenanceClientSocketFlag},
+			},
+			{
+				Name:      "disable",
+				Action:    cliutil.WithErrorHandler(disableMaintenanceCommand),
+				Usage:     "Take the ingress rules of a hostname out of maintenance mode",
+				UsageText: "cloudflared tunnel maintenance disable --maintenance-socket PATH HOSTNAME",
+				Flags:     []cli.Flag{maintenanceClientSocketFlag},
+			},
+			{
+				Name:      "status",
+				Action:    cliutil.WithErrorHandler(maintenanceStatusCommand),
+				Usage:     "List the hostnames in maintenance mode",
+				UsageText: "cloudflared tunnel maintenance status --maintenance-socket PATH",
+				Flags:     []cli.Flag{maintenanceClientSocketFlag},
+			},
+		},
+	}
+}
+
+func enableMaintenanceCommand(c *cli.Context) error {
+	return toggleMaintenance(c, http.MethodPost)
+}
+
+func disableMaintenanceCommand(c *cli.Context) error {
+	return toggleMaintenance(c, http.MethodDelete)
+}
+
+func toggleMaintenance(c *cli.Context, method string) error {
+	if c.NArg() != 1 {
+		return cliutil.UsageError("Pass the hostname of the ingress rules as the only argument.")
+	}
+	status, err := requestMaintenance(c.String(maintenanceSocketFlagName), method, c.Args().First())
+	if err != nil {
+		return err
+	}
+	printMaintenanceStatus(status)
+	return nil
+}
+
+func maintenanceStatusCommand(c *cli.Context) error {
+	status, err := requestMaintenance(c.String(maintenanceSocketFlagName), http.MethodGet, "")
+	if err != nil {
+		return err
+	}
+	printMaintenanceStatus(status)
+	return nil
+}
+
+// requestMaintenance sends a request to the /maintenance endpoint of the maintenance socket at socketPath, and returns
+// the hostnames in maintenance mode it responded with
+func requestMaintenance(socketPath, method, hostname string) ([]proxy.MaintenanceStatus, error) {
+	socketPath, err := homedir.Expand(socketPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid maintenance socket path")
+	}
+	endpoint := "http://cloudflared/maintenance"
+	if hostname != "" {
+		endpoint += "?hostname=" + url.QueryEscape(hostname)
+	}
+	req, err := http.NewRequest(method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(proxy.MaintenanceRequestHeader, "true")
+	client := http.Client{
+		Timeout: connectorStateTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error querying the maintenance socket of the local connector")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("the maintenance socket of the local connector responded with status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var status []proxy.MaintenanceStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, errors.Wrap(err, "error parsing the response of the maintenance socket of the local connector")
+	}
+	return status, nil
+}
+
+// listenMaintenance listens on the socket of --maintenance-socket, it returns a nil listener if it's not set
+func listenMaintenance(c *cli.Context) (net.Listener, error) {
+	socketPath := c.String(maintenanceSocketFlagName)
+	if socketPath == "" {
+		return nil, nil
+	}
+	socketPath, err := homedir.Expand(socketPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid maintenance socket path")
+	}
+	listener, err := cliutil.ListenPrivateSocket(socketPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen on the maintenance socket")
+	}
+	return listener, nil
+}
+
+// serveMaintenance serves the /maintenance endpoint of maintenance on listener until shutdownC is closed
+func serveMaintenance(listener net.Listener, maintenance *proxy.Maintenance, shutdownC <-chan struct{}, log *zerolog.Logger) error {
+	router := http.NewServeMux()
+	router.Handle("/maintenance", maintenance)
+	server := &http.Server{
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		Handler:      router,
+	}
+	go func() {
+		<-shutdownC
+		_ = server.Close()
+	}()
+	log.Info().Msgf("Serving the maintenance endpoint on %s", listener.Addr())
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func printMaintenanceStatus(status []proxy.MaintenanceStatus) {
+	if len(status) == 0 {
+		fmt.Println("No ingress rules in maintenance mode")
+		return
+	}
+	for _, hostname := range status {
+		fmt.Printf("%s in maintenance mode since %s\n", hostname.Hostname, hostname.Since.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,49 @@
+package tunnel
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/proxy"
+)
+
+func TestMaintenanceSocket(t *testing.T) {
+	log := zerolog.Nop()
+	maintenance := proxy.NewMaintenance(&log)
+	socketPath := filepath.Join(t.TempDir(), "maintenance.sock")
+	listener, err := cliutil.ListenPrivateSocket(socketPath)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(socketPath)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	shutdownC := make(chan struct{})
+	errC := make(chan error)
+	go func() {
+		errC <- serveMaintenance(listener, maintenance, shutdownC, &log)
+	}()
+
+	status, err := requestMaintenance(socketPath, http.MethodPost, "example.com")
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	assert.True(t, maintenance.Enabled("example.com"))
+	status, err = requestMaintenance(socketPath, http.MethodDelete, "example.com")
+	require.NoError(t, err)
+	assert.Empty(t, status)
+
+	// Only one connector listens on the socket
+	_, err = cliutil.ListenPrivateSocket(socketPath)
+	assert.Error(t, err)
+
+	close(shutdownC)
+	require.NoError(t, <-errC)
+}
@@ -0,0 +1,86 @@
+package tunnel
+
+import (
+	"fmt"
+	"os/user"
+	"runtime"
+	"strconv"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	userFlag  = "user"
+	groupFlag = "group"
+)
+
+// credentials are the user and group cloudflared runs as after dropping its privileges
+type credentials struct {
+	uid int
+	gid int
+}
+
+// lookupCredentials returns the credentials of userName and groupName, which are names or numeric IDs. The group is
+// the primary group of the user if groupName is empty.
+func lookupCredentials(userName, groupName string) (credentials, error) {
+	u, err := user.Lookup(userName)
+	if err != nil {
+		if u, err = user.LookupId(userName); err != nil {
+			return credentials{}, fmt.Errorf("unknown user %s", userName)
+		}
+	}
+	gid := u.Gid
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return credentials{}, fmt.Errorf("unknown group %s", groupName)
+			}
+		}
+		gid = g.Gid
+	}
+	var creds credentials
+	if creds.uid, err = strconv.Atoi(u.Uid); err != nil {
+		return credentials{}, fmt.Errorf("user %s has a non-numeric ID %s", userName, u.Uid)
+	}
+	if creds.gid, err = strconv.Atoi(gid); err != nil {
+		return credentials{}, fmt.Errorf("group %s has a non-numeric ID %s", groupName, gid)
+	}
+	return creds, nil
+}
+
+// switchCredentials switches the process to other credentials, it's replaced in tests
+var switchCredentials = setCredentials
+
+// privilegeDrop returns the credentials of --user and --group to switch to once the sockets requiring privileges are
+// bound, or nil without --user. It's called before anything starts, so that invalid flags fail right away.
+func privilegeDrop(c *cli.Context) (*credentials, error) {
+	if !c.IsSet(userFlag) {
+		if c.IsSet(groupFlag) {
+			return nil, fmt.Errorf("--%s requires --%s", groupFlag, userFlag)
+		}
+		return nil, nil
+	}
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("--%s is only supported on Linux", userFlag)
+	}
+	creds, err := lookupCredentials(c.String(userFlag), c.String(groupFlag))
+	if err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+// dropPrivileges switches to creds, if any. Only the capabilities to bind low ports and to open ICMP sockets are
+// kept, for the origins and proxies started later.
+func dropPrivileges(creds *credentials, log *zerolog.Logger) error {
+	if creds == nil {
+		return nil
+	}
+	if err := switchCredentials(*creds); err != nil {
+		return fmt.Errorf("failed to drop privileges to uid %d: %w", creds.uid, err)
+	}
+	log.Info().Int("uid", creds.uid).Int("gid", creds.gid).Msg("Dropped privileges")
+	return nil
+}
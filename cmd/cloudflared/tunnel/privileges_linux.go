@@ -0,0 +1,51 @@
+package tunnel
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// retainedCapabilities are kept after dropping privileges: binding ports below 1024 and opening ICMP sockets
+const retainedCapabilities = 1<<unix.CAP_NET_BIND_SERVICE | 1<<unix.CAP_NET_RAW
+
+// setCredentials switches every thread of the process to creds, keeping only retainedCapabilities. Capabilities are
+// per thread on Linux, so they're set with AllThreadsSyscall, which requires a build without cgo.
+func setCredentials(creds credentials) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("cloudflared must be started as root")
+	}
+	// Keep the permitted capabilities when the user changes, they're reduced to retainedCapabilities below
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, unix.PR_SET_KEEPCAPS, 1, 0); errno != 0 {
+		if errno == syscall.ENOTSUP {
+			return fmt.Errorf("cloudflared must be built without cgo")
+		}
+		return fmt.Errorf("failed to keep capabilities: %w", errno)
+	}
+	if err := syscall.Setgroups([]int{creds.gid}); err != nil {
+		return fmt.Errorf("failed to set supplementary groups: %w", err)
+	}
+	if err := syscall.Setgid(creds.gid); err != nil {
+		return fmt.Errorf("failed to set group: %w", err)
+	}
+	if err := syscall.Setuid(creds.uid); err != nil {
+		return fmt.Errorf("failed to set user: %w", err)
+	}
+
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	data[0].Effective = retainedCapabilities
+	data[0].Permitted = retainedCapabilities
+	if _, _, errno := syscall.AllThreadsSyscall(
+		syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0,
+	); errno != 0 {
+		return fmt.Errorf("failed to set capabilities: %w", errno)
+	}
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, unix.PR_SET_KEEPCAPS, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to reset keeping capabilities: %w", errno)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package tunnel
+
+import (
+	"fmt"
+)
+
+// setCredentials returns an error, since dropping privileges while keeping capabilities is only supported on Linux
+func setCredentials(creds credentials) error {
+	return fmt.Errorf("dropping privileges is only supported on Linux")
+}
@@ -0,0 +1,97 @@
+package tunnel
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os/user"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/grace/gracenet"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestLookupCredentials(t *testing.T) {
+	current, err := user.Current()
+	require.NoError(t, err)
+	uid, err := strconv.Atoi(current.Uid)
+	require.NoError(t, err)
+	gid, err := strconv.Atoi(current.Gid)
+	require.NoError(t, err)
+	group, err := user.LookupGroupId(current.Gid)
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		user  string
+		group string
+	}{
+		{user: current.Username},
+		{user: current.Uid},
+		{user: current.Username, group: group.Name},
+		{user: current.Username, group: current.Gid},
+	} {
+		creds, err := lookupCredentials(test.user, test.group)
+		require.NoError(t, err, "user=%s, group=%s", test.user, test.group)
+		assert.Equal(t, credentials{uid: uid, gid: gid}, creds)
+	}
+
+	_, err = lookupCredentials("cloudflared-unknown-user", "")
+	require.Error(t, err)
+	_, err = lookupCredentials(current.Username, "cloudflared-unknown-group")
+	require.Error(t, err)
+}
+
+func TestDropPrivilegesWithStandAloneDNSProxy(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	require.NoError(t, conn.Close())
+
+	flagSet := flag.NewFlagSet("test", flag.PanicOnError)
+	flagSet.Bool("proxy-dns", false, "")
+	flagSet.String("proxy-dns-address", "", "")
+	flagSet.Int("proxy-dns-port", 0, "")
+	flagSet.Var(cli.NewStringSlice("https://127.0.0.1/dns-query"), "proxy-dns-upstream", "")
+	require.NoError(t, flagSet.Parse([]string{"--proxy-dns", "--proxy-dns-address", "127.0.0.1", "--proxy-dns-port", strconv.Itoa(port)}))
+	c := cli.NewContext(cli.NewApp(), flagSet, nil)
+
+	// Privileges are dropped once the DNS proxy is bound, even though the tunnel doesn't start
+	var switched *credentials
+	switchCredentials = func(creds credentials) error {
+		_, err := net.ListenPacket("udp", fmt.Sprintf("127.0.0.1:%d", port))
+		assert.Error(t, err, "the DNS proxy isn't bound")
+		switched = &creds
+		return nil
+	}
+	defer func() { switchCredentials = setCredentials }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	errC := make(chan error, 1)
+	log := zerolog.Nop()
+	creds := &credentials{uid: 65534, gid: 65534}
+	metricsListener, err := startPrivilegedListeners(ctx, c, true, creds, &gracenet.Net{}, &wg, errC, &log)
+	require.NoError(t, err)
+	assert.Nil(t, metricsListener)
+	assert.Equal(t, creds, switched)
+
+	// The DNS proxy answers once privileges are dropped, with an error as the upstream is unreachable
+	query := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+	for _, network := range []string{"udp", "tcp"} {
+		client := dns.Client{Net: network, Timeout: 5 * time.Second}
+		_, _, err := client.Exchange(query, fmt.Sprintf("127.0.0.1:%d", port))
+		require.NoError(t, err, network)
+	}
+
+	cancel()
+	wg.Wait()
+	assert.NoError(t, <-errC)
+}
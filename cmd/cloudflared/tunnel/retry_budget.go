@@ -0,0 +1,54 @@
+package tunnel
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/cloudflare/cloudflared/retry"
+)
+
+const (
+	retryBudgetFlag               = "retry-budget"
+	retryBudgetRefillIntervalFlag = "retry-budget-refill-interval"
+)
+
+func configureRetryBudgetFlags(shouldHide bool) []cli.Flag {
+	return []cli.Flag{
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    retryBudgetFlag,
+			Usage:   "Maximum number of retries that edge reconnects, origin discovery and API calls can make in a burst, shared between them. A retry is added back to the budget every refill interval. 0 for unlimited retries.",
+			EnvVars: []string{"TUNNEL_RETRY_BUDGET"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    retryBudgetRefillIntervalFlag,
+			Usage:   "How often a retry is added back to the retry budget.",
+			Value:   time.Second,
+			EnvVars: []string{"TUNNEL_RETRY_BUDGET_REFILL_INTERVAL"},
+			Hidden:  shouldHide,
+		}),
+	}
+}
+
+// setRetryBudget sets the retry budget shared by the subsystems from the flags, leaving retries unlimited if it isn't
+// enabled.
+func setRetryBudget(c *cli.Context, log *zerolog.Logger) error {
+	capacity := c.Int(retryBudgetFlag)
+	if capacity == 0 {
+		return nil
+	}
+	if capacity < 0 {
+		return fmt.Errorf("%s must not be negative", retryBudgetFlag)
+	}
+	refillInterval := c.Duration(retryBudgetRefillIntervalFlag)
+	if refillInterval <= 0 {
+		return fmt.Errorf("%s must be positive", retryBudgetRefillIntervalFlag)
+	}
+	retry.SetGlobalBudget(retry.NewBudget(capacity, refillInterval))
+	log.Info().Int("capacity", capacity).Dur("refillInterval", refillInterval).Msg("Retry budget enabled")
+	return nil
+}
@@ -0,0 +1,190 @@
+package tunnel
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+)
+
+// Columns of the CSV files of DNS routes, the tunnel can be an ID or a name
+var dnsRoutesCSVHeader = []string{"hostname", "tunnel"}
+
+func buildRouteDNSBulkSubcommand() *cli.Command {
+	return &cli.Command{
+		Name:      "dns-bulk",
+		Action:    cliutil.ConfiguredAction(routeDNSBulkCommand),
+		Usage:     "Route the hostnames listed in a CSV file by creating DNS CNAME records to their tunnels",
+		UsageText: "cloudflared tunnel route dns-bulk [flags] [FILE]",
+		Description: `Creates a DNS CNAME record to a tunnel for each row "hostname,tunnel" of a CSV file, where
+the tunnel is an ID or a name. The whole file is validated before any record is created,
+then the result of each record is printed, and records that fail don't stop the others.
+Records already routed to their tunnel are unchanged, so the file can be applied again.
+With --overwrite-dns, existing records of the hostnames are updated to route to the
+tunnels of the file, making the records match the file however they were before.`,
+		Flags: []cli.Flag{overwriteDNSFlag, outputFormatFlag, templateFormatFlag},
+	}
+}
+
+// dnsRouteRow is a DNS route of a CSV file
+type dnsRouteRow struct {
+	line     int
+	hostname string
+	tunnel   string
+}
+
+// dnsRouteOutcome is the result of routing a hostname
+type dnsRouteOutcome struct {
+	Hostname string       `json:"hostname" yaml:"hostname"`
+	Tunnel   string       `json:"tunnel" yaml:"tunnel"`
+	TunnelID uuid.UUID    `json:"tunnel_id" yaml:"tunnel_id"`
+	Change   cfapi.Change `json:"change,omitempty" yaml:"change,omitempty"`
+	Error    string       `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// parseDNSRoutesCSV parses the DNS routes of a CSV file, returning the errors of all invalid rows
+func parseDNSRoutesCSV(reader io.Reader) ([]dnsRouteRow, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.Comment = '#'
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	var (
+		rows     []dnsRouteRow
+		problems []string
+	)
+	hostnames := make(map[string]int)
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid CSV")
+		}
+		line, _ := csvReader.FieldPos(0)
+		if len(rows) == 0 && len(problems) == 0 && strings.EqualFold(record[0], dnsRoutesCSVHeader[0]) {
+			continue
+		}
+		if len(record) != len(dnsRoutesCSVHeader) {
+			problems = append(problems, fmt.Sprintf("line %d: expected %s", line, strings.Join(dnsRoutesCSVHeader, ",")))
+			continue
+		}
+		row := dnsRouteRow{
+			line:     line,
+			hostname: strings.ToLower(strings.TrimSpace(record[0])),
+			tunnel:   strings.TrimSpace(record[1]),
+		}
+		if !validateHostname(row.hostname, true) {
+			problems = append(problems, fmt.Sprintf("line %d: %s is not a valid hostname", line, record[0]))
+			continue
+		}
+		if row.tunnel == "" {
+			problems = append(problems, fmt.Sprintf("line %d: missing tunnel", line))
+			continue
+		}
+		if previous, ok := hostnames[row.hostname]; ok {
+			problems = append(problems, fmt.Sprintf("line %d: %s is already routed on line %d", line, row.hostname, previous))
+			continue
+		}
+		hostnames[row.hostname] = line
+		rows = append(rows, row)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid DNS routes:\n%s", strings.Join(problems, "\n"))
+	}
+	return rows, nil
+}
+
+func routeDNSBulkCommand(c *cli.Context) error {
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() != 1 {
+		return cliutil.UsageError(`This command expects the format "cloudflared tunnel route dns-bulk <file>"`)
+	}
+
+	file, err := os.Open(c.Args().First())
+	if err != nil {
+		return err
+	}
+	rows, err := parseDNSRoutesCSV(file)
+	_ = file.Close()
+	if err != nil {
+		return err
+	}
+
+	// Tunnels are resolved before any record is created, so a typo doesn't leave the file half applied
+	tunnelIDs := make(map[string]uuid.UUID)
+	for _, row := range rows {
+		if _, ok := tunnelIDs[row.tunnel]; ok {
+			continue
+		}
+		ids, err := sc.findIDs([]string{row.tunnel})
+		if err != nil {
+			return errors.Wrapf(err, "line %d: invalid tunnel", row.line)
+		}
+		tunnelIDs[row.tunnel] = ids[0]
+	}
+
+	overwrite := c.Bool(overwriteDNSFlagName)
+	outcomes := make([]dnsRouteOutcome, 0, len(rows))
+	failed := 0
+	for _, row := range rows {
+		outcome := dnsRouteOutcome{
+			Hostname: row.hostname,
+			Tunnel:   row.tunnel,
+			TunnelID: tunnelIDs[row.tunnel],
+		}
+		result, err := sc.route(outcome.TunnelID, cfapi.NewDNSRoute(row.hostname, overwrite))
+		if err != nil {
+			outcome.Error = err.Error()
+			failed++
+		} else if dnsResult, ok := result.(*cfapi.DNSRouteResult); ok {
+			outcome.Change = dnsResult.CName
+		}
+		outcomes = append(outcomes, outcome)
+	}
+
+	if rendered, err := renderOutputFromFlags(c, outcomes); err != nil {
+		return err
+	} else if !rendered {
+		formatAndPrintDNSRouteOutcomes(outcomes)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hostnames failed to route", failed, len(rows))
+	}
+	return nil
+}
+
+func formatAndPrintDNSRouteOutcomes(outcomes []dnsRouteOutcome) {
+	const (
+		minWidth = 0
+		tabWidth = 8
+		padding  = 1
+		padChar  = ' '
+		flags    = 0
+	)
+
+	writer := tabwriter.NewWriter(os.Stdout, minWidth, tabWidth, padding, padChar, flags)
+	defer writer.Flush()
+
+	_, _ = fmt.Fprintln(writer, "HOSTNAME\tTUNNEL ID\tRESULT\t")
+	for _, outcome := range outcomes {
+		result := outcome.Change
+		if outcome.Error != "" {
+			result = "failed: " + outcome.Error
+		}
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t\n", outcome.Hostname, outcome.TunnelID, result)
+	}
+}
@@ -0,0 +1,31 @@
+package tunnel
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDNSRoutesCSV(t *testing.T) {
+	rows, err := parseDNSRoutesCSV(strings.NewReader(`hostname,tunnel
+# Public apps
+app.example.com, web
+API.example.com,2b8a5c8b-5a6e-4d4e-9c5b-2f0d2f8a4b1c
+*.docs.example.com,web
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []dnsRouteRow{
+		{line: 3, hostname: "app.example.com", tunnel: "web"},
+		{line: 4, hostname: "api.example.com", tunnel: "2b8a5c8b-5a6e-4d4e-9c5b-2f0d2f8a4b1c"},
+		{line: 5, hostname: "*.docs.example.com", tunnel: "web"},
+	}, rows)
+
+	_, err = parseDNSRoutesCSV(strings.NewReader("app.example.com,web\nbad host,web\napp.example.com,api\nweb.example.com\nweb.example.com,\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2: bad host is not a valid hostname")
+	assert.Contains(t, err.Error(), "line 3: app.example.com is already routed on line 1")
+	assert.Contains(t, err.Error(), "line 4: expected hostname,tunnel")
+	assert.Contains(t, err.Error(), "line 5: missing tunnel")
+}
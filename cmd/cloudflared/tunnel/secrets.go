@@ -0,0 +1,56 @@
+package tunnel
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/secretprovider"
+)
+
+// secretSource is a secret of the configuration file that cloudflared fetched, to watch it for rotations
+type secretSource struct {
+	source *config.SecretSource
+	value  []byte
+	// credentials decodes the credentials of the tunnel from a value of the secret, if it holds them
+	credentials func(value []byte) (connection.Credentials, error)
+}
+
+// fetchSecret returns the value of the secret of the configuration file located by source
+func fetchSecret(source *config.SecretSource, log *zerolog.Logger) (*secretSource, error) {
+	value, err := secretprovider.Fetch(context.Background(), *source)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Str("provider", source.Provider).Str("secret", source.Name).Msg("Fetched secret from the secret manager")
+	return &secretSource{source: source, value: value}, nil
+}
+
+// watchRotations fetches the secret again at the refresh interval of the configuration file until ctx is done, and
+// makes the connections registered after its secret is rotated authenticate with the new secret
+func (s *secretSource) watchRotations(ctx context.Context, namedTunnel *connection.NamedTunnelProperties, log *zerolog.Logger) {
+	refreshInterval := config.GetConfiguration().Secrets.RefreshInterval
+	if refreshInterval == nil || refreshInterval.Duration <= 0 || s.credentials == nil {
+		return
+	}
+	provider, err := secretprovider.New(*s.source)
+	if err != nil {
+		log.Err(err).Msg("Secret won't be refreshed")
+		return
+	}
+	secretprovider.Watch(ctx, provider, s.value, refreshInterval.Duration, func(value []byte) {
+		credentials, err := s.credentials(value)
+		if err != nil {
+			log.Err(err).Str("secret", provider.Description()).Msg("The rotated secret of the tunnel is invalid, keeping the current one")
+			return
+		}
+		if credentials.TunnelID != namedTunnel.Credentials.TunnelID || credentials.AccountTag != namedTunnel.Credentials.AccountTag {
+			log.Error().Str("secret", provider.Description()).Msg("The rotated secret is for another tunnel, keeping the current one")
+			return
+		}
+		namedTunnel.RefreshSecret(credentials.TunnelSecret)
+		log.Info().Str("secret", provider.Description()).Msg("The secret of the tunnel was rotated, new connections will register with it")
+	}, log)
+}
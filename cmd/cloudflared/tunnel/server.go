@@ -19,10 +19,44 @@ func runDNSProxyServer(c *cli.Context, dnsReadySignal chan struct{}, shutdownC <
 	if maxUpstreamConnections < 0 {
 		return fmt.Errorf("'%s' must be 0 or higher", "proxy-dns-max-upstream-conns")
 	}
-	listener, err := tunneldns.CreateListener(c.String("proxy-dns-address"), uint16(port), c.StringSlice("proxy-dns-upstream"), c.StringSlice("proxy-dns-bootstrap"), maxUpstreamConnections, log)
+	listener, err := tunneldns.CreateListener(tunneldns.ListenerConfig{
+		Address:                c.String("proxy-dns-address"),
+		Port:                   uint16(port),
+		Upstreams:              c.StringSlice("proxy-dns-upstream"),
+		Bootstraps:             c.StringSlice("proxy-dns-bootstrap"),
+		MaxUpstreamConnections: maxUpstreamConnections,
+		Cache: tunneldns.CacheConfig{
+			MaxSize:    c.Int("proxy-dns-cache-size"),
+			MinTTL:     c.Duration("proxy-dns-cache-min-ttl"),
+			MaxTTL:     c.Duration("proxy-dns-cache-max-ttl"),
+			ServeStale: c.Duration("proxy-dns-cache-serve-stale"),
+		},
+		RulesFile: c.String("proxy-dns-rules"),
+		DoH: tunneldns.DoHConfig{
+			Address:    c.String("proxy-dns-doh-address"),
+			DoTAddress: c.String("proxy-dns-dot-address"),
+			CertFile:   c.String("proxy-dns-doh-cert"),
+			KeyFile:    c.String("proxy-dns-doh-key"),
+		},
+		ECS: tunneldns.ECSConfig{
+			Policy: c.String("proxy-dns-ecs-policy"),
+			Subnet: c.String("proxy-dns-ecs-subnet"),
+		},
+		DNSSEC: tunneldns.DNSSECConfig{
+			Mode:         c.String("proxy-dns-dnssec"),
+			TrustAnchors: c.StringSlice("proxy-dns-dnssec-trust-anchor"),
+		},
+		UpstreamSelection: tunneldns.UpstreamSelectionConfig{
+			Policy:              c.String("proxy-dns-upstream-policy"),
+			Weights:             c.IntSlice("proxy-dns-upstream-weight"),
+			HealthCheckInterval: c.Duration("proxy-dns-upstream-health-check-interval"),
+		},
+		DNS64: tunneldns.DNS64Config{
+			Prefix: c.String("proxy-dns-dns64-prefix"),
+		},
+	}, log)
 	if err != nil {
 		close(dnsReadySignal)
-		listener.Stop()
 		return errors.Wrap(err, "Cannot create the DNS over HTTPS proxy server")
 	}
 
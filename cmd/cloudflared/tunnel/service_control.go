@@ -0,0 +1,72 @@
+package tunnel
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/orchestration"
+)
+
+var (
+	// reloadC requests to reload the ingress rules of the configuration file, e.g. from the Windows service control
+	// manager. It's buffered so that requests received while reloading are coalesced into one.
+	reloadC = make(chan struct{}, 1)
+	// serviceStatus is a func() string describing the state of the running tunnel
+	serviceStatus atomic.Value
+)
+
+// ReloadConfig requests the running tunnel to reload the ingress rules of its configuration file. Requests are ignored
+// when the ingress rules aren't from a configuration file.
+func ReloadConfig() {
+	select {
+	case reloadC <- struct{}{}:
+	default:
+	}
+}
+
+// ServiceStatus describes the state of the running tunnel for the service manager, e.g. while it drains its
+// connections to the edge
+func ServiceStatus() string {
+	if status, ok := serviceStatus.Load().(func() string); ok {
+		return status()
+	}
+	return "starting"
+}
+
+// reloadIngressOnRequest replaces the ingress rules of orchestrator with the ones of the configuration file each time
+// a reload is requested, until ctx is done
+func reloadIngressOnRequest(ctx context.Context, orchestrator *orchestration.Orchestrator, log *zerolog.Logger) {
+	configFile := config.GetConfiguration().Source()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reloadC:
+		}
+		if configFile == "" {
+			log.Warn().Msg("Ignoring the request to reload the configuration, cloudflared doesn't run with a configuration file")
+			continue
+		}
+		if err := reloadIngress(configFile, orchestrator); err != nil {
+			log.Err(err).Str("config", configFile).Msg("Failed to reload the configuration, the current ingress rules are kept")
+			continue
+		}
+		log.Info().Str("config", configFile).Msg("Reloaded the ingress rules of the configuration file")
+	}
+}
+
+func reloadIngress(configFile string, orchestrator *orchestration.Orchestrator) error {
+	fileConfig, err := config.ReadConfiguration(configFile)
+	if err != nil {
+		return err
+	}
+	ingressRules, err := ingress.ParseIngress(fileConfig)
+	if err != nil {
+		return err
+	}
+	return orchestrator.UpdateLocalIngress(ingressRules)
+}
@@ -0,0 +1,433 @@
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+const (
+	probeTimeout          = 5 * time.Second
+	defaultSetupService   = "http://localhost:8080"
+	catchAllSetupService  = "http_status:404"
+	setupConfigPermission = 0644
+)
+
+// Ports of the schemes that don't need one in the service of an ingress rule
+var defaultSchemePorts = map[string]string{
+	"http":  "80",
+	"ws":    "80",
+	"https": "443",
+	"wss":   "443",
+	"ssh":   "22",
+	"rdp":   "3389",
+	"smb":   "445",
+}
+
+func buildSetupCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "setup",
+		Action:    cliutil.WithErrorHandler(setupCommand),
+		Category:  "Tunnel",
+		Usage:     "Set up a tunnel interactively",
+		UsageText: "cloudflared [--config FILEPATH] setup",
+		Description: `Walks through setting up a tunnel, asking questions along the way:
+  - logs in to Cloudflare if there's no origin certificate yet
+  - creates the tunnel, or reuses a tunnel of the same name
+  - adds ingress rules, checking that their services are reachable from this host
+  - routes the hostnames of the rules to the tunnel in DNS
+  - writes and validates the configuration file
+  - installs cloudflared as a service running the tunnel`,
+	}
+}
+
+func setupCommand(c *cli.Context) error {
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return err
+	}
+	w := &setupWizard{sc: sc, prompt: newPrompter(os.Stdin, os.Stdout)}
+	return w.run()
+}
+
+// setupWizard holds the answers of cloudflared setup
+type setupWizard struct {
+	sc              *subcommandContext
+	prompt          *prompter
+	tunnelID        uuid.UUID
+	credentialsFile string
+	rules           []setupIngressRule
+}
+
+// setupConfig is the configuration file written by cloudflared setup
+type setupConfig struct {
+	Tunnel          string             `yaml:"tunnel"`
+	CredentialsFile string             `yaml:"credentials-file"`
+	Ingress         []setupIngressRule `yaml:"ingress"`
+}
+
+type setupIngressRule struct {
+	Hostname string `yaml:"hostname,omitempty"`
+	Service  string `yaml:"service"`
+}
+
+func (c setupConfig) marshal() ([]byte, error) {
+	var content bytes.Buffer
+	encoder := yaml.NewEncoder(&content)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return content.Bytes(), nil
+}
+
+func (w *setupWizard) run() error {
+	fmt.Fprintln(w.prompt.w, "This will set up a tunnel exposing services of this host, press Ctrl+C to stop at any time.")
+	if err := w.login(); err != nil {
+		return err
+	}
+	if err := w.createTunnel(); err != nil {
+		return err
+	}
+	if err := w.addIngressRules(); err != nil {
+		return err
+	}
+	if err := w.routeDNS(); err != nil {
+		return err
+	}
+	configPath, err := w.writeConfig()
+	if err != nil {
+		return err
+	}
+	return w.installService(configPath)
+}
+
+// login logs in to Cloudflare, unless there's already an origin certificate
+func (w *setupWizard) login() error {
+	if _, err := w.sc.credential(); err == nil {
+		return nil
+	}
+	fmt.Fprintln(w.prompt.w, "\nStep 1: log in to Cloudflare to allow cloudflared to manage tunnels of your account.")
+	ok, err := w.prompt.confirm("Log in now?", true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("cloudflared needs to log in to create a tunnel, run cloudflared setup again once logged in with cloudflared tunnel login")
+	}
+	if err := login(w.sc.c); err != nil {
+		return err
+	}
+	_, err = w.sc.credential()
+	return err
+}
+
+// createTunnel creates a tunnel, or reuses the tunnel with the same name if this host has its credentials
+func (w *setupWizard) createTunnel() error {
+	fmt.Fprintln(w.prompt.w, "\nStep 2: create the tunnel.")
+	hostname, _ := os.Hostname()
+	name, err := w.prompt.ask("Name of the tunnel", hostname)
+	if err != nil {
+		return err
+	}
+	existing, ok, err := w.sc.tunnelActive(name)
+	if err != nil {
+		return err
+	}
+	if ok {
+		credentialsFile, err := w.sc.credentialFinder(existing.ID).Path()
+		if err != nil {
+			return fmt.Errorf("tunnel %s already exists but its credentials aren't on this host, choose another name or copy them from where the tunnel was created: %v", name, err)
+		}
+		fmt.Fprintf(w.prompt.w, "Using the existing tunnel %s with id %s\n", name, existing.ID)
+		w.tunnelID, w.credentialsFile = existing.ID, credentialsFile
+		return nil
+	}
+
+	tunnel, err := w.sc.create(name, "", "")
+	if err != nil {
+		return errors.Wrap(err, "failed to create tunnel")
+	}
+	credential, err := w.sc.credential()
+	if err != nil {
+		return err
+	}
+	// Where sc.create writes the credentials
+	credentialsFile, err := tunnelFilePath(tunnel.ID, filepath.Dir(credential.certPath))
+	if err != nil {
+		return err
+	}
+	w.tunnelID, w.credentialsFile = tunnel.ID, credentialsFile
+	return nil
+}
+
+// addIngressRules asks for the hostnames and services to expose, probing that the services are reachable
+func (w *setupWizard) addIngressRules() error {
+	fmt.Fprintln(w.prompt.w, "\nStep 3: add the services to expose through the tunnel.")
+	for {
+		hostname, err := w.prompt.ask("Hostname of the service, e.g. app.example.com (empty to finish)", "")
+		if err != nil {
+			return err
+		}
+		if hostname == "" {
+			if len(w.rules) == 0 {
+				fmt.Fprintln(w.prompt.w, "Add at least one service.")
+				continue
+			}
+			break
+		}
+		if !validateHostname(hostname, true) {
+			fmt.Fprintf(w.prompt.w, "%s is not a valid hostname.\n", hostname)
+			continue
+		}
+		service, err := w.prompt.ask(fmt.Sprintf("Service for %s", hostname), defaultSetupService)
+		if err != nil {
+			return err
+		}
+		rule := setupIngressRule{Hostname: hostname, Service: service}
+		if err := validateSetupRules(append(w.rules, rule)); err != nil {
+			fmt.Fprintf(w.prompt.w, "Invalid service: %v\n", err)
+			continue
+		}
+		if err := probeService(service, probeTimeout); err != nil {
+			fmt.Fprintf(w.prompt.w, "%s isn't reachable from this host: %v\n", service, err)
+			ok, err := w.prompt.confirm("Add it anyway?", false)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+		w.rules = append(w.rules, rule)
+	}
+	w.rules = append(w.rules, setupIngressRule{Service: catchAllSetupService})
+	return nil
+}
+
+// routeDNS routes the hostnames of the ingress rules to the tunnel
+func (w *setupWizard) routeDNS() error {
+	fmt.Fprintln(w.prompt.w, "\nStep 4: route the hostnames to the tunnel with DNS records.")
+	for _, rule := range w.rules {
+		if rule.Hostname == "" {
+			continue
+		}
+		ok, err := w.prompt.confirm(fmt.Sprintf("Create a DNS record for %s?", rule.Hostname), true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		res, err := w.sc.route(w.tunnelID, cfapi.NewDNSRoute(rule.Hostname, false))
+		if err != nil {
+			fmt.Fprintf(w.prompt.w, "Failed to route %s: %v\nRoute it later with cloudflared tunnel route dns %s %s\n", rule.Hostname, err, w.tunnelID, rule.Hostname)
+			continue
+		}
+		fmt.Fprintln(w.prompt.w, res.SuccessSummary())
+	}
+	return nil
+}
+
+// writeConfig writes the configuration file of the tunnel and validates it, returning its path
+func (w *setupWizard) writeConfig() (string, error) {
+	fmt.Fprintln(w.prompt.w, "\nStep 5: write the configuration file.")
+	path, err := w.prompt.ask("Path of the configuration file", w.sc.c.String("config"))
+	if err != nil {
+		return "", err
+	}
+	if path, err = homedir.Expand(path); err != nil {
+		return "", err
+	}
+	if exists, err := config.FileExists(path); err != nil {
+		return "", err
+	} else if exists {
+		ok, err := w.prompt.confirm(fmt.Sprintf("%s already exists, replace it?", path), false)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("%s already exists", path)
+		}
+	}
+
+	content, err := setupConfig{Tunnel: w.tunnelID.String(), CredentialsFile: w.credentialsFile, Ingress: w.rules}.marshal()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path, content, setupConfigPermission); err != nil {
+		return "", errors.Wrapf(err, "couldn't write the configuration file %s", path)
+	}
+
+	doc, problems, err := config.ParseDocument(path, []string{CredFileFlag})
+	if err != nil {
+		return "", err
+	}
+	if doc != nil {
+		problems = append(problems, validateIngressRules(doc)...)
+		problems = append(problems, validateCredentialsFile(w.sc.c, doc)...)
+	}
+	var invalid bool
+	for _, problem := range problems {
+		fmt.Fprintln(w.prompt.w, problem)
+		invalid = invalid || !problem.Warning
+	}
+	if invalid {
+		return "", fmt.Errorf("%s is invalid, fix it and check it with cloudflared tunnel --config %s config validate", path, path)
+	}
+	fmt.Fprintf(w.prompt.w, "Wrote the configuration to %s, run the tunnel with cloudflared tunnel --config %s run\n", path, path)
+	return path, nil
+}
+
+// installService installs cloudflared as a service running the tunnel, with cloudflared service install
+func (w *setupWizard) installService(configPath string) error {
+	fmt.Fprintln(w.prompt.w, "\nStep 6: install cloudflared as a service, to run the tunnel when this host starts.")
+	ok, err := w.prompt.confirm("Install the service?", true)
+	if err != nil || !ok {
+		return err
+	}
+	command := fmt.Sprintf("cloudflared --config %s service install", configPath)
+	if runtime.GOOS == "linux" && os.Geteuid() != 0 {
+		fmt.Fprintf(w.prompt.w, "Installing the service requires root, run sudo %s\n", command)
+		return nil
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	install := exec.Command(executable, "--config", configPath, "service", "install")
+	install.Stdin, install.Stdout, install.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := install.Run(); err != nil {
+		return errors.Wrapf(err, "failed to install the service, run %s to try again", command)
+	}
+	return nil
+}
+
+// validateSetupRules checks the ingress rules with a catch-all rule at the end
+func validateSetupRules(rules []setupIngressRule) error {
+	conf := config.Configuration{}
+	for _, rule := range append(rules, setupIngressRule{Service: catchAllSetupService}) {
+		conf.Ingress = append(conf.Ingress, config.UnvalidatedIngressRule{Hostname: rule.Hostname, Service: rule.Service})
+	}
+	_, err := ingress.ParseIngress(&conf)
+	return err
+}
+
+// probeService checks that the service of an ingress rule is reachable. Services that aren't URLs of a host, e.g.
+// hello_world, aren't probed.
+func probeService(service string, timeout time.Duration) error {
+	u, err := url.Parse(service)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	switch u.Scheme {
+	case "http", "https", "ws", "wss":
+		probeURL := *u
+		probeURL.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Head(probeURL.String())
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		return nil
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port, ok := defaultSchemePorts[u.Scheme]
+		if !ok {
+			return nil
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", host, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// prompter asks questions on a terminal
+type prompter struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+func newPrompter(r io.Reader, w io.Writer) *prompter {
+	return &prompter{r: bufio.NewReader(r), w: w}
+}
+
+// ask asks a question, the answer is defaultAnswer if it's empty
+func (p *prompter) ask(question, defaultAnswer string) (string, error) {
+	if defaultAnswer != "" {
+		fmt.Fprintf(p.w, "%s [%s]: ", question, defaultAnswer)
+	} else {
+		fmt.Fprintf(p.w, "%s: ", question)
+	}
+	answer, err := p.r.ReadString('\n')
+	if err != nil && (err != io.EOF || answer == "") {
+		if err == io.EOF {
+			return "", errors.New("no answer, cloudflared setup must be run in a terminal")
+		}
+		return "", err
+	}
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return defaultAnswer, nil
+	}
+	return answer, nil
+}
+
+// confirm asks a yes/no question
+func (p *prompter) confirm(question string, defaultYes bool) (bool, error) {
+	choices, defaultAnswer := "y/N", "n"
+	if defaultYes {
+		choices, defaultAnswer = "Y/n", "y"
+	}
+	for {
+		fmt.Fprintf(p.w, "%s [%s] ", question, choices)
+		answer, err := p.r.ReadString('\n')
+		if err != nil && (err != io.EOF || answer == "") {
+			if err == io.EOF {
+				return false, errors.New("no answer, cloudflared setup must be run in a terminal")
+			}
+			return false, err
+		}
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer == "" {
+			answer = defaultAnswer
+		}
+		switch answer {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package tunnel
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrompter(t *testing.T) {
+	var output bytes.Buffer
+	prompt := newPrompter(strings.NewReader("\nmy-tunnel\nmaybe\nYES\n\n"), &output)
+
+	answer, err := prompt.ask("Name of the tunnel", "host")
+	require.NoError(t, err)
+	assert.Equal(t, "host", answer)
+	answer, err = prompt.ask("Name of the tunnel", "host")
+	require.NoError(t, err)
+	assert.Equal(t, "my-tunnel", answer)
+
+	// Answers that aren't yes or no are asked again
+	ok, err := prompt.confirm("Proceed?", false)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = prompt.confirm("Proceed?", false)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "Name of the tunnel [host]: Name of the tunnel [host]: Proceed? [y/N] Proceed? [y/N] Proceed? [y/N] ", output.String())
+
+	_, err = prompt.ask("Name of the tunnel", "host")
+	assert.Error(t, err)
+}
+
+func TestProbeService(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := closed.Addr().String()
+	require.NoError(t, closed.Close())
+
+	assert.NoError(t, probeService(server.URL, time.Second))
+	assert.NoError(t, probeService(strings.Replace(server.URL, "http", "ws", 1), time.Second))
+	assert.NoError(t, probeService("tcp://"+listener.Addr().String(), time.Second))
+	assert.Error(t, probeService("http://"+closedAddr, time.Second))
+	assert.Error(t, probeService("ssh://"+closedAddr, time.Second))
+	// Services that aren't URLs of a host aren't probed
+	assert.NoError(t, probeService("http_status:404", time.Second))
+	assert.NoError(t, probeService("hello_world", time.Second))
+	assert.NoError(t, probeService("unix:/run/app.sock", time.Second))
+}
+
+func TestValidateSetupRules(t *testing.T) {
+	assert.NoError(t, validateSetupRules([]setupIngressRule{
+		{Hostname: "app.example.com", Service: "http://localhost:8000"},
+		{Hostname: "ssh.example.com", Service: "ssh://localhost:22"},
+	}))
+	assert.Error(t, validateSetupRules([]setupIngressRule{
+		{Hostname: "app.example.com", Service: "localhost:8000"},
+	}))
+}
+
+func TestSetupConfig(t *testing.T) {
+	content, err := setupConfig{
+		Tunnel:          "df5ed608-b8b4-4109-89f3-9f2cf199df64",
+		CredentialsFile: "/root/.cloudflared/df5ed608-b8b4-4109-89f3-9f2cf199df64.json",
+		Ingress: []setupIngressRule{
+			{Hostname: "app.example.com", Service: "http://localhost:8000"},
+			{Service: catchAllSetupService},
+		},
+	}.marshal()
+	require.NoError(t, err)
+	assert.Equal(t, `tunnel: df5ed608-b8b4-4109-89f3-9f2cf199df64
+credentials-file: /root/.cloudflared/df5ed608-b8b4-4109-89f3-9f2cf199df64.json
+ingress:
+  - hostname: app.example.com
+    service: http://localhost:8000
+  - service: http_status:404
+`, string(content))
+}
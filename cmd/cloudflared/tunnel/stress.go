@@ -0,0 +1,185 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/logger"
+	"github.com/cloudflare/cloudflared/stress"
+)
+
+const (
+	stressProtocolFlag    = "protocol"
+	stressConcurrencyFlag = "concurrency"
+	stressDurationFlag    = "duration"
+	stressRequestsFlag    = "requests"
+	stressPayloadSizeFlag = "payload-size"
+	stressMethodFlag      = "method"
+	stressTimeoutFlag     = "timeout"
+	stressEchoOriginFlag  = "echo-origin"
+
+	// defaultEchoPayloadSize is the size of the messages sent to echo servers if --payload-size isn't set
+	defaultEchoPayloadSize = 1024
+)
+
+func buildStressCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "stress",
+		Action:    cliutil.WithErrorHandler(stressCommand),
+		Usage:     "Generate HTTP, TCP or UDP load through a tunnel and report its throughput and latency",
+		UsageText: "cloudflared tunnel [tunnel command options] stress [subcommand options] TARGET",
+		Description: `Sends requests to TARGET from concurrent workers, for the given duration or number of requests, then reports the
+  throughput and latency percentiles of the requests, to size the hardware of a connector before sending it production
+  traffic.
+
+  With --protocol http, TARGET is the URL of a hostname routed to the tunnel, e.g. to its hello_world service:
+
+  $ cloudflared tunnel stress --concurrency 50 --duration 1m https://hello.example.com
+
+  With --protocol tcp or udp, TARGET is the host:port of an echo server behind the tunnel, which every message is
+  sent back by. It can be a private network address routed to the tunnel and reached with WARP, or the local listener
+  of "cloudflared access tcp" with TCP. --echo-origin runs such an echo server, to be the origin of the tunnel:
+
+  $ cloudflared tunnel stress --echo-origin localhost:9000
+  $ cloudflared tunnel stress --protocol udp --payload-size 512 10.0.0.5:9000`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  stressProtocolFlag,
+				Value: stress.HTTP,
+				Usage: "Protocol of the load, one of http, tcp or udp",
+			},
+			&cli.IntFlag{
+				Name:  stressConcurrencyFlag,
+				Value: 10,
+				Usage: "Number of requests in flight at once",
+			},
+			&cli.DurationFlag{
+				Name:  stressDurationFlag,
+				Value: 10 * time.Second,
+				Usage: "How long the load is generated for, or 0 to only stop after --requests",
+			},
+			&cli.Int64Flag{
+				Name:  stressRequestsFlag,
+				Usage: "Number of requests after which the load stops, or 0 to only stop after --duration",
+			},
+			&cli.IntFlag{
+				Name:  stressPayloadSizeFlag,
+				Usage: fmt.Sprintf("Size in bytes of the body of HTTP requests, and of the messages sent to echo servers (%d by default)", defaultEchoPayloadSize),
+			},
+			&cli.StringFlag{
+				Name:  stressMethodFlag,
+				Value: "GET",
+				Usage: "Method of HTTP requests",
+			},
+			&cli.DurationFlag{
+				Name:  stressTimeoutFlag,
+				Value: 10 * time.Second,
+				Usage: "Time a request has to complete before it fails",
+			},
+			&cli.StringFlag{
+				Name:  stressEchoOriginFlag,
+				Usage: "Instead of generating load, serve TCP and UDP echo servers at `ADDRESS` until interrupted",
+			},
+			outputFormatFlag,
+			templateFormatFlag,
+		},
+		CustomHelpTemplate: commandHelpTemplate(),
+	}
+}
+
+func stressCommand(c *cli.Context) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if address := c.String(stressEchoOriginFlag); address != "" {
+		log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+		return stress.ServeEcho(ctx, address, log)
+	}
+	if c.NArg() != 1 {
+		return cliutil.UsageError(`"cloudflared tunnel stress" requires exactly 1 argument, the URL or address to send requests to.`)
+	}
+
+	config := stress.Config{
+		Protocol:    c.String(stressProtocolFlag),
+		Target:      c.Args().First(),
+		Concurrency: c.Int(stressConcurrencyFlag),
+		Duration:    c.Duration(stressDurationFlag),
+		Requests:    c.Int64(stressRequestsFlag),
+		PayloadSize: c.Int(stressPayloadSizeFlag),
+		Method:      c.String(stressMethodFlag),
+		Timeout:     c.Duration(stressTimeoutFlag),
+	}
+	if config.Protocol != stress.HTTP && !c.IsSet(stressPayloadSizeFlag) {
+		config.PayloadSize = defaultEchoPayloadSize
+	}
+	report, err := stress.Run(ctx, config)
+	if err != nil {
+		return cliutil.UsageError("%v", err)
+	}
+
+	if rendered, err := renderOutputFromFlags(c, report); rendered || err != nil {
+		return err
+	}
+	formatAndPrintStressReport(report)
+	return nil
+}
+
+func formatAndPrintStressReport(report *stress.Report) {
+	writer := tabWriter()
+	defer writer.Flush()
+
+	_, _ = fmt.Fprintf(writer, "TARGET:\t%s (%s)\n", report.Target, report.Protocol)
+	_, _ = fmt.Fprintf(writer, "REQUESTS:\t%d in %.1fs, %d failed\n", report.Requests, report.Seconds, report.Errors)
+	if report.Seconds > 0 {
+		_, _ = fmt.Fprintf(writer, "THROUGHPUT:\t%.1f requests/s, %s/s sent, %s/s received\n",
+			report.RequestsPerSecond,
+			fmtBytes(float64(report.BytesSent)/report.Seconds),
+			fmtBytes(float64(report.BytesReceived)/report.Seconds),
+		)
+	}
+	_, _ = fmt.Fprintf(writer, "LATENCY:\tp50 %.1fms, p90 %.1fms, p99 %.1fms, max %.1fms\n",
+		report.Latency.P50, report.Latency.P90, report.Latency.P99, report.Latency.Max)
+
+	if len(report.StatusCodes) > 0 {
+		var codes []int
+		for code := range report.StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		_, _ = fmt.Fprintln(writer, "\nSTATUS\tRESPONSES\t")
+		for _, code := range codes {
+			_, _ = fmt.Fprintf(writer, "%d\t%d\t\n", code, report.StatusCodes[code])
+		}
+	}
+	if len(report.ErrorMessages) > 0 {
+		var messages []string
+		for message := range report.ErrorMessages {
+			messages = append(messages, message)
+		}
+		sort.Strings(messages)
+		_, _ = fmt.Fprintln(writer, "\nERROR\tCOUNT\t")
+		for _, message := range messages {
+			_, _ = fmt.Fprintf(writer, "%s\t%d\t\n", message, report.ErrorMessages[message])
+		}
+	}
+}
+
+// fmtBytes formats a number of bytes with a binary unit
+func fmtBytes(bytes float64) string {
+	const unit = 1024
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	i := 0
+	for bytes >= unit && i < len(units)-1 {
+		bytes /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", bytes, units[i])
+}
@@ -1,12 +1,15 @@
 package tunnel
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -15,6 +18,7 @@ import (
 
 	"github.com/cloudflare/cloudflared/certutil"
 	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/connection"
 	"github.com/cloudflare/cloudflared/logger"
 )
@@ -38,6 +42,10 @@ type subcommandContext struct {
 	// These fields should be accessed using their respective Getter
 	tunnelstoreClient cfapi.Client
 	userCredential    *userCredential
+	// tunnelSecret is the secret manager the credentials of the tunnel were fetched from, if any
+	tunnelSecret *secretSource
+	// tunnelToken is the Cloudflare API the token of the tunnel was fetched from with an API token, if any
+	tunnelToken *tunnelTokenSource
 }
 
 func newSubcommandContext(c *cli.Context) (*subcommandContext, error) {
@@ -93,13 +101,9 @@ func (sc *subcommandContext) credential() (*userCredential, error) {
 			Str(LogFieldOriginCertPath, originCertPath).
 			Logger()
 
-		originCertPath, err := findOriginCert(originCertPath, &originCertLog)
+		originCertPath, blocks, err := loadOriginCert(originCertPath, &originCertLog)
 		if err != nil {
-			return nil, errors.Wrap(err, "Error locating origin cert")
-		}
-		blocks, err := readOriginCert(originCertPath)
-		if err != nil {
-			return nil, errors.Wrapf(err, "Can't read origin cert from %s", originCertPath)
+			return nil, errors.Wrap(err, "Error loading origin cert")
 		}
 
 		cert, err := certutil.DecodeOriginCert(blocks)
@@ -128,6 +132,9 @@ func (sc *subcommandContext) readTunnelCredentials(credFinder CredFinder) (conne
 	if err != nil {
 		return connection.Credentials{}, errors.Wrapf(err, "couldn't read tunnel credentials from %v", filePath)
 	}
+	if body, err = openCredentials(body); err != nil {
+		return connection.Credentials{}, errors.Wrapf(err, "couldn't decrypt tunnel credentials from %v", filePath)
+	}
 
 	var credentials connection.Credentials
 	if err = json.Unmarshal(body, &credentials); err != nil {
@@ -148,6 +155,11 @@ func (sc *subcommandContext) create(name string, credentialsFilePath string, sec
 		return nil, errors.Wrap(err, "couldn't create client to talk to Cloudflare Tunnel backend")
 	}
 
+	labels, err := parseLabels(sc.c.StringSlice(createLabelFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+
 	var tunnelSecret []byte
 	if secret == "" {
 		tunnelSecret, err = generateTunnelSecret()
@@ -165,10 +177,11 @@ func (sc *subcommandContext) create(name string, credentialsFilePath string, sec
 		}
 	}
 
-	tunnel, err := client.CreateTunnel(name, tunnelSecret)
+	tunnel, err := client.CreateTunnel(name, tunnelSecret, labels)
 	if err != nil {
 		return nil, errors.Wrap(err, "Create Tunnel API call failed")
 	}
+	invalidateCompletionCache()
 
 	credential, err := sc.credential()
 	if err != nil {
@@ -203,8 +216,8 @@ func (sc *subcommandContext) create(name string, credentialsFilePath string, sec
 		return nil, errors.New(errorMsg)
 	}
 
-	if outputFormat := sc.c.String(outputFormatFlag.Name); outputFormat != "" {
-		return nil, renderOutput(outputFormat, &tunnel)
+	if rendered, err := renderOutputFromFlags(sc.c, &tunnel); rendered || err != nil {
+		return nil, err
 	}
 
 	fmt.Printf("Tunnel credentials written to %v.", credentialsFilePath)
@@ -252,6 +265,7 @@ func (sc *subcommandContext) delete(tunnelIDs []uuid.UUID) error {
 		if err := client.DeleteTunnel(tunnel.ID); err != nil {
 			return errors.Wrapf(err, "Error deleting tunnel %s", tunnel.ID)
 		}
+		invalidateCompletionCache()
 
 		credFinder := sc.credentialFinder(id)
 		if tunnelCredentialsPath, err := credFinder.Path(); err == nil {
@@ -263,6 +277,19 @@ func (sc *subcommandContext) delete(tunnelIDs []uuid.UUID) error {
 	return nil
 }
 
+// decodeCredentials decrypts the credentials of source if they're encrypted, and parses them
+func decodeCredentials(body []byte, source string) (connection.Credentials, error) {
+	var credentials connection.Credentials
+	body, err := openCredentials(body)
+	if err != nil {
+		return credentials, errors.Wrapf(err, "couldn't decrypt tunnel credentials from %v", source)
+	}
+	if err := json.Unmarshal(body, &credentials); err != nil {
+		return credentials, errInvalidJSONCredential{path: source, err: err}
+	}
+	return credentials, nil
+}
+
 // findCredentials will choose the right way to find the credentials file, find it,
 // and add the TunnelID into any old credentials (generated before TUN-3581 added the `TunnelID`
 // field to credentials files)
@@ -270,8 +297,16 @@ func (sc *subcommandContext) findCredentials(tunnelID uuid.UUID) (connection.Cre
 	var credentials connection.Credentials
 	var err error
 	if credentialsContents := sc.c.String(CredContentsFlag); credentialsContents != "" {
-		if err = json.Unmarshal([]byte(credentialsContents), &credentials); err != nil {
-			err = errInvalidJSONCredential{path: "TUNNEL_CRED_CONTENTS", err: err}
+		credentials, err = decodeCredentials([]byte(credentialsContents), "TUNNEL_CRED_CONTENTS")
+	} else if source := config.GetConfiguration().Secrets.Credentials; source != nil && !sc.c.IsSet(CredFileFlag) {
+		if sc.tunnelSecret, err = fetchSecret(source, sc.log); err == nil {
+			sc.tunnelSecret.credentials = func(value []byte) (connection.Credentials, error) {
+				credentials, err := decodeCredentials(value, source.Name)
+				// Credentials files generated before TUN-3581 don't have a TunnelID field
+				credentials.TunnelID = tunnelID
+				return credentials, err
+			}
+			credentials, err = sc.tunnelSecret.credentials(sc.tunnelSecret.value)
 		}
 	} else {
 		credFinder := sc.credentialFinder(tunnelID)
@@ -300,39 +335,181 @@ func (sc *subcommandContext) run(tunnelID uuid.UUID) error {
 func (sc *subcommandContext) runWithCredentials(credentials connection.Credentials) error {
 	sc.log.Info().Str(LogFieldTunnelID, credentials.TunnelID.String()).Msg("Starting tunnel")
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	namedTunnel := &connection.NamedTunnelProperties{Credentials: credentials}
+	if sc.tunnelSecret != nil {
+		go sc.tunnelSecret.watchRotations(ctx, namedTunnel, sc.log)
+	}
+	if sc.tunnelToken != nil {
+		go sc.tunnelToken.watchRefreshes(ctx, namedTunnel, sc.c.Duration(tokenRefreshIntervalFlag.Name), sc.log)
+	}
+
 	return StartServer(
 		sc.c,
 		buildInfo,
-		&connection.NamedTunnelProperties{Credentials: credentials},
+		namedTunnel,
 		sc.log,
 	)
 }
 
-func (sc *subcommandContext) cleanupConnections(tunnelIDs []uuid.UUID) error {
-	params := cfapi.NewCleanupParams()
-	extraLog := ""
-	if connector := sc.c.String("connector-id"); connector != "" {
+// connectorFilter selects the connectors of a tunnel whose connections are cleaned up
+type connectorFilter struct {
+	connectorID uuid.UUID
+	// version is a glob of the versions of the connectors
+	version   string
+	olderThan time.Duration
+}
+
+func newConnectorFilter(c *cli.Context) (*connectorFilter, error) {
+	filter := &connectorFilter{
+		version:   c.String(cleanupVersionFlag.Name),
+		olderThan: c.Duration(cleanupOlderThanFlag.Name),
+	}
+	if connector := c.String("connector-id"); connector != "" {
 		connectorID, err := uuid.Parse(connector)
 		if err != nil {
-			return errors.Wrapf(err, "%s is not a valid client ID (must be a UUID)", connector)
+			return nil, errors.Wrapf(err, "%s is not a valid client ID (must be a UUID)", connector)
 		}
-		params.ForClient(connectorID)
-		extraLog = fmt.Sprintf(" for connector-id %s", connectorID.String())
+		filter.connectorID = connectorID
+	}
+	if _, err := path.Match(filter.version, ""); err != nil {
+		return nil, errors.Wrapf(err, "%s is not a valid pattern of versions", filter.version)
+	}
+	return filter, nil
+}
+
+// byConnector is whether the filter selects connectors in a way the API can't, so that their connections are
+// cleaned up connector by connector
+func (f *connectorFilter) byConnector() bool {
+	return f.version != "" || f.olderThan > 0
+}
+
+func (f *connectorFilter) matches(connector *cfapi.ActiveClient, now time.Time) bool {
+	if f.connectorID != uuid.Nil && connector.ID != f.connectorID {
+		return false
+	}
+	if f.version != "" {
+		if ok, _ := path.Match(f.version, connector.Version); !ok {
+			return false
+		}
+	}
+	return f.olderThan <= 0 || now.Sub(connector.RunAt) > f.olderThan
+}
+
+func (f *connectorFilter) String() string {
+	var conditions []string
+	if f.connectorID != uuid.Nil {
+		conditions = append(conditions, fmt.Sprintf("connector-id %s", f.connectorID))
+	}
+	if f.version != "" {
+		conditions = append(conditions, fmt.Sprintf("version %s", f.version))
+	}
+	if f.olderThan > 0 {
+		conditions = append(conditions, fmt.Sprintf("started more than %s ago", f.olderThan))
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " for " + strings.Join(conditions, ", ")
+}
+
+// staleConnector is a connector whose connections are cleaned up
+type staleConnector struct {
+	tunnelID  uuid.UUID
+	connector *cfapi.ActiveClient
+}
+
+// cleanupConnections cleans up the connections of the connectors of the tunnels selected by the flags. With --dry-run,
+// it only prints the connectors.
+func (sc *subcommandContext) cleanupConnections(tunnelIDs []uuid.UUID) error {
+	filter, err := newConnectorFilter(sc.c)
+	if err != nil {
+		return err
 	}
+	dryRun := sc.c.Bool(cleanupDryRunFlag.Name)
 
 	client, err := sc.client()
 	if err != nil {
 		return err
 	}
-	for _, tunnelID := range tunnelIDs {
-		sc.log.Info().Msgf("Cleanup connection for tunnel %s%s", tunnelID, extraLog)
-		if err := client.CleanupConnections(tunnelID, params); err != nil {
-			sc.log.Error().Msgf("Error cleaning up connections for tunnel %v, error :%v", tunnelID, err)
+	if !dryRun && !filter.byConnector() {
+		params := cfapi.NewCleanupParams()
+		if filter.connectorID != uuid.Nil {
+			params.ForClient(filter.connectorID)
+		}
+		for _, tunnelID := range tunnelIDs {
+			sc.log.Info().Msgf("Cleanup connection for tunnel %s%s", tunnelID, filter)
+			if err := client.CleanupConnections(tunnelID, params); err != nil {
+				sc.log.Error().Msgf("Error cleaning up connections for tunnel %v, error :%v", tunnelID, err)
+			}
+		}
+		return nil
+	}
+
+	stale, err := sc.staleConnectors(tunnelIDs, filter)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		printStaleConnectors(stale, time.Now())
+		return nil
+	}
+	for _, s := range stale {
+		sc.log.Info().Msgf("Cleanup connection for tunnel %s for connector-id %s", s.tunnelID, s.connector.ID)
+		params := cfapi.NewCleanupParams()
+		params.ForClient(s.connector.ID)
+		if err := client.CleanupConnections(s.tunnelID, params); err != nil {
+			sc.log.Error().Msgf("Error cleaning up connections for tunnel %v, error :%v", s.tunnelID, err)
 		}
 	}
 	return nil
 }
 
+func (sc *subcommandContext) staleConnectors(tunnelIDs []uuid.UUID, filter *connectorFilter) ([]staleConnector, error) {
+	client, err := sc.client()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var stale []staleConnector
+	for _, tunnelID := range tunnelIDs {
+		connectors, err := client.ListActiveClients(tunnelID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing the connectors of tunnel %s", tunnelID)
+		}
+		for _, connector := range connectors {
+			if filter.matches(connector, now) {
+				stale = append(stale, staleConnector{tunnelID: tunnelID, connector: connector})
+			}
+		}
+	}
+	return stale, nil
+}
+
+func printStaleConnectors(stale []staleConnector, now time.Time) {
+	if len(stale) == 0 {
+		fmt.Println("No connections would be cleaned up.")
+		return
+	}
+	writer := tabWriter()
+	defer writer.Flush()
+	_, _ = fmt.Fprintln(writer, "The connections of these connectors would be cleaned up:")
+	_, _ = fmt.Fprintln(writer, "TUNNEL ID\tCONNECTOR ID\tVERSION\tSTARTED\tCONNECTIONS\t")
+	for _, s := range stale {
+		_, _ = fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s\t%s (%s ago)\t%d\t\n",
+			s.tunnelID,
+			s.connector.ID,
+			s.connector.Version,
+			s.connector.RunAt.Format(time.RFC3339),
+			now.Sub(s.connector.RunAt).Round(time.Second),
+			len(s.connector.Connections),
+		)
+	}
+}
+
 func (sc *subcommandContext) getTunnelTokenCredentials(tunnelID uuid.UUID) (*connection.TunnelToken, error) {
 	client, err := sc.client()
 	if err != nil {
@@ -423,6 +600,39 @@ func (sc *subcommandContext) findIDs(inputs []string) ([]uuid.UUID, error) {
 	return uuids, nil
 }
 
+// findIDsMatching returns the IDs of the tunnels whose names match any of the glob patterns. It fails if a pattern
+// matches no tunnel.
+func (sc *subcommandContext) findIDsMatching(patterns []string) ([]uuid.UUID, error) {
+	filter := cfapi.NewTunnelFilter()
+	filter.NoDeleted()
+	tunnels, err := sc.list(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[uuid.UUID]bool)
+	var ids []uuid.UUID
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid pattern of tunnel names", pattern)
+		}
+		matched := false
+		for _, tunnel := range tunnels {
+			if ok, _ := path.Match(pattern, tunnel.Name); ok {
+				matched = true
+				if !found[tunnel.ID] {
+					found[tunnel.ID] = true
+					ids = append(ids, tunnel.ID)
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no tunnel has a name matching %s", pattern)
+		}
+	}
+	return ids, nil
+}
+
 func splitUuids(inputs []string) ([]uuid.UUID, []string) {
 	uuids := make([]uuid.UUID, 0)
 	names := make([]string, 0)
@@ -1,6 +1,8 @@
 package tunnel
 
 import (
+	"context"
+
 	"github.com/pkg/errors"
 
 	"github.com/cloudflare/cloudflared/cfapi"
@@ -16,6 +18,15 @@ func (sc *subcommandContext) listRoutes(filter *cfapi.IpRouteFilter) ([]*cfapi.D
 	return client.ListRoutes(filter)
 }
 
+// listAllRoutes lists the routes of all the pages of results
+func (sc *subcommandContext) listAllRoutes(filter *cfapi.IpRouteFilter) ([]*cfapi.DetailedRoute, error) {
+	client, err := sc.client()
+	if err != nil {
+		return nil, errors.Wrap(err, noClientMsg)
+	}
+	return client.IterateRoutes(context.Background(), filter).All()
+}
+
 func (sc *subcommandContext) addRoute(newRoute cfapi.NewRoute) (cfapi.Route, error) {
 	client, err := sc.client()
 	if err != nil {
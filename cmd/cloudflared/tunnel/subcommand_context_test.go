@@ -1,6 +1,7 @@
 package tunnel
 
 import (
+	"context"
 	"encoding/base64"
 	"flag"
 	"fmt"
@@ -12,10 +13,12 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/urfave/cli/v2"
 
 	"github.com/cloudflare/cloudflared/cfapi"
 	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/secretstore"
 )
 
 type mockFileSystem struct {
@@ -49,6 +52,12 @@ func Test_subcommandContext_findCredentials(t *testing.T) {
 	secretB64 := base64.StdEncoding.EncodeToString(secret)
 	tunnelID := uuid.MustParse("df5ed608-b8b4-4109-89f3-9f2cf199df64")
 	name := "mytunnel"
+	encryptedCertPath := "encrypted_cert.json"
+	encryptedCert, err := secretstore.Seal(context.Background(),
+		[]byte(fmt.Sprintf(`{"AccountTag":"%s","TunnelSecret":"%s","TunnelID":"%s"}`, accountTag, secretB64, tunnelID)),
+		secretstore.SealOptions{KeySource: secretstore.KeySourcePassphrase, Passphrase: "passphrase"})
+	require.NoError(t, err)
+	t.Setenv(credentialsPassphraseEnv, "passphrase")
 
 	fs := mockFileSystem{
 		rf: func(filePath string) ([]byte, error) {
@@ -60,6 +69,9 @@ func Test_subcommandContext_findCredentials(t *testing.T) {
 				// A new credentials file created after TUN-3581 with its new fields.
 				return []byte(fmt.Sprintf(`{"AccountTag":"%s","TunnelSecret":"%s","TunnelID":"%s","TunnelName":"%s"}`, accountTag, secretB64, tunnelID, name)), nil
 			}
+			if filePath == encryptedCertPath {
+				return encryptedCert, nil
+			}
 			return nil, errors.New("file not found")
 		},
 		vfp: func(string) bool { return true },
@@ -117,6 +129,28 @@ func Test_subcommandContext_findCredentials(t *testing.T) {
 				TunnelSecret: secret,
 			},
 		},
+		{
+			name: "Filepath given leads to encrypted credentials file",
+			fields: fields{
+				log: &log,
+				fs:  fs,
+				c: func() *cli.Context {
+					flagSet := flag.NewFlagSet("test0", flag.PanicOnError)
+					flagSet.String(CredFileFlag, encryptedCertPath, "")
+					c := cli.NewContext(cli.NewApp(), flagSet, nil)
+					_ = c.Set(CredFileFlag, encryptedCertPath)
+					return c
+				}(),
+			},
+			args: args{
+				tunnelID: tunnelID,
+			},
+			want: connection.Credentials{
+				AccountTag:   accountTag,
+				TunnelID:     tunnelID,
+				TunnelSecret: secret,
+			},
+		},
 		{
 			name: "TUNNEL_CRED_CONTENTS given contains old credentials contents",
 			fields: fields{
@@ -367,3 +401,121 @@ func Test_subcommandContext_ValidateIngressCommand(t *testing.T) {
 		})
 	}
 }
+
+type cleanupMockTunnelStore struct {
+	cfapi.Client
+	tunnels    []*cfapi.Tunnel
+	connectors map[uuid.UUID][]*cfapi.ActiveClient
+	cleanups   map[uuid.UUID]int
+}
+
+func (s *cleanupMockTunnelStore) ListTunnels(_ *cfapi.TunnelFilter) ([]*cfapi.Tunnel, error) {
+	return s.tunnels, nil
+}
+
+func (s *cleanupMockTunnelStore) ListActiveClients(tunnelID uuid.UUID) ([]*cfapi.ActiveClient, error) {
+	return s.connectors[tunnelID], nil
+}
+
+func (s *cleanupMockTunnelStore) CleanupConnections(tunnelID uuid.UUID, _ *cfapi.CleanupParams) error {
+	s.cleanups[tunnelID]++
+	return nil
+}
+
+func Test_subcommandContext_cleanupConnections(t *testing.T) {
+	tunnelID1 := uuid.MustParse("df5ed608-b8b4-4109-89f3-9f2cf199df64")
+	tunnelID2 := uuid.MustParse("af5ed608-b8b4-4109-89f3-9f2cf199df64")
+	now := time.Now()
+	newStore := func() *cleanupMockTunnelStore {
+		return &cleanupMockTunnelStore{
+			tunnels: []*cfapi.Tunnel{
+				{ID: tunnelID1, Name: "web-1"},
+				{ID: tunnelID2, Name: "web-2"},
+				{ID: uuid.New(), Name: "api"},
+			},
+			connectors: map[uuid.UUID][]*cfapi.ActiveClient{
+				tunnelID1: {
+					{ID: uuid.New(), Version: "2022.5.0", RunAt: now.Add(-100 * time.Hour)},
+					{ID: uuid.New(), Version: "2022.5.3", RunAt: now.Add(-time.Hour)},
+					{ID: uuid.New(), Version: "2022.7.1", RunAt: now.Add(-100 * time.Hour)},
+				},
+				tunnelID2: {
+					{ID: uuid.New(), Version: "2022.7.1", RunAt: now.Add(-time.Hour)},
+				},
+			},
+			cleanups: make(map[uuid.UUID]int),
+		}
+	}
+	newContext := func(args ...string) *cli.Context {
+		flagSet := flag.NewFlagSet("cleanup", flag.PanicOnError)
+		flagSet.String(cleanupClientFlag.Name, "", "")
+		flagSet.String(cleanupVersionFlag.Name, "", "")
+		flagSet.Duration(cleanupOlderThanFlag.Name, 0, "")
+		flagSet.Bool(cleanupDryRunFlag.Name, false, "")
+		require.NoError(t, flagSet.Parse(args))
+		return cli.NewContext(cli.NewApp(), flagSet, nil)
+	}
+	log := zerolog.Nop()
+
+	tests := []struct {
+		name     string
+		args     []string
+		cleanups map[uuid.UUID]int
+		wantErr  bool
+	}{
+		{
+			name:     "all connections",
+			cleanups: map[uuid.UUID]int{tunnelID1: 1, tunnelID2: 1},
+		},
+		{
+			name:     "by version",
+			args:     []string{"--connector-version", "2022.5.*"},
+			cleanups: map[uuid.UUID]int{tunnelID1: 2},
+		},
+		{
+			name:     "by age",
+			args:     []string{"--older-than", "72h"},
+			cleanups: map[uuid.UUID]int{tunnelID1: 2},
+		},
+		{
+			name:     "by version and age",
+			args:     []string{"--connector-version", "2022.7.*", "--older-than", "72h"},
+			cleanups: map[uuid.UUID]int{tunnelID1: 1},
+		},
+		{
+			name:     "dry run",
+			args:     []string{"--dry-run", "--older-than", "72h"},
+			cleanups: map[uuid.UUID]int{},
+		},
+		{
+			name:    "invalid version pattern",
+			args:    []string{"--connector-version", "[2022"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid connector ID",
+			args:    []string{"--connector-id", "connector"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newStore()
+			sc := &subcommandContext{c: newContext(test.args...), log: &log, tunnelstoreClient: store}
+			err := sc.cleanupConnections([]uuid.UUID{tunnelID1, tunnelID2})
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.cleanups, store.cleanups)
+		})
+	}
+
+	sc := &subcommandContext{c: newContext(), log: &log, tunnelstoreClient: newStore()}
+	ids, err := sc.findIDsMatching([]string{"web-*", "web-1"})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{tunnelID1, tunnelID2}, ids)
+	_, err = sc.findIDsMatching([]string{"db-*"})
+	assert.Error(t, err)
+}
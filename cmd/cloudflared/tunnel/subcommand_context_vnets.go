@@ -12,7 +12,9 @@ func (sc *subcommandContext) addVirtualNetwork(newVnet cfapi.NewVirtualNetwork)
 	if err != nil {
 		return cfapi.VirtualNetwork{}, errors.Wrap(err, noClientMsg)
 	}
-	return client.CreateVirtualNetwork(newVnet)
+	vnet, err := client.CreateVirtualNetwork(newVnet)
+	invalidateCompletionCache()
+	return vnet, err
 }
 
 func (sc *subcommandContext) listVirtualNetworks(filter *cfapi.VnetFilter) ([]*cfapi.VirtualNetwork, error) {
@@ -28,7 +30,9 @@ func (sc *subcommandContext) deleteVirtualNetwork(vnetId uuid.UUID) error {
 	if err != nil {
 		return errors.Wrap(err, noClientMsg)
 	}
-	return client.DeleteVirtualNetwork(vnetId)
+	err = client.DeleteVirtualNetwork(vnetId)
+	invalidateCompletionCache()
+	return err
 }
 
 func (sc *subcommandContext) updateVirtualNetwork(vnetId uuid.UUID, updates cfapi.UpdateVirtualNetwork) error {
@@ -36,5 +40,7 @@ func (sc *subcommandContext) updateVirtualNetwork(vnetId uuid.UUID, updates cfap
 	if err != nil {
 		return errors.Wrap(err, noClientMsg)
 	}
-	return client.UpdateVirtualNetwork(vnetId, updates)
+	err = client.UpdateVirtualNetwork(vnetId, updates)
+	invalidateCompletionCache()
+	return err
 }
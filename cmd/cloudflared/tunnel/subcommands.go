@@ -2,16 +2,18 @@ package tunnel
 
 import (
 	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
 	"strings"
 	"text/tabwriter"
+	"text/template"
 	"time"
 
 	"github.com/google/uuid"
@@ -82,7 +84,11 @@ var (
 	outputFormatFlag = &cli.StringFlag{
 		Name:    "output",
 		Aliases: []string{"o"},
-		Usage:   "Render output using given `FORMAT`. Valid options are 'json' or 'yaml'",
+		Usage:   "Render output using given `FORMAT`. Valid options are 'json', 'yaml' or 'table'",
+	}
+	templateFormatFlag = &cli.StringFlag{
+		Name:  "format",
+		Usage: "Render each item of the output with the given Go `TEMPLATE`, e.g. '{{.ID}} {{.Name}}'",
 	}
 	sortByFlag = &cli.StringFlag{
 		Name:    "sort-by",
@@ -125,6 +131,24 @@ var (
 		Usage:   "The Tunnel token. When provided along with credentials, this will take precedence.",
 		EnvVars: []string{"TUNNEL_TOKEN"},
 	})
+	apiTokenFlag = altsrc.NewStringFlag(&cli.StringFlag{
+		Name: "api-token",
+		Usage: "A Cloudflare API token allowed to read the tunnels of --account-id. The token of the tunnel to run is " +
+			"fetched with it when cloudflared starts, instead of being passed with --token.",
+		EnvVars: []string{"TUNNEL_API_TOKEN"},
+	})
+	accountIDFlag = altsrc.NewStringFlag(&cli.StringFlag{
+		Name:    "account-id",
+		Usage:   "The ID of the account of the tunnel to run with --api-token.",
+		EnvVars: []string{"TUNNEL_ACCOUNT_ID"},
+	})
+	tokenRefreshIntervalFlag = altsrc.NewDurationFlag(&cli.DurationFlag{
+		Name: "token-refresh-interval",
+		Usage: "The interval to fetch the token of the tunnel again with --api-token. The connections registered " +
+			"after its secret is rotated authenticate with the new one. 0 disables the refresh.",
+		EnvVars: []string{"TUNNEL_TOKEN_REFRESH_INTERVAL"},
+		Value:   time.Hour,
+	})
 	forceDeleteFlag = &cli.BoolFlag{
 		Name:    "force",
 		Aliases: []string{"f"},
@@ -146,6 +170,23 @@ var (
 		Usage:   fmt.Sprintf("Sorts the list of connections of a tunnel by the given field. Valid options are {%s}", connsSortByOptions),
 		EnvVars: []string{"TUNNEL_INFO_SORT_BY"},
 	}
+	infoMetricsFlag = altsrc.NewStringFlag(&cli.StringFlag{
+		Name:    "metrics",
+		Usage:   "Address of the metrics server of the connector running on this machine, to show the location, protocol, uptime and recent errors of its connections",
+		EnvVars: []string{"TUNNEL_METRICS"},
+	})
+	cleanupVersionFlag = &cli.StringFlag{
+		Name:  "connector-version",
+		Usage: "Constraints the cleanup to the connectors with a version matching the given glob `PATTERN`, e.g. 2022.5.*",
+	}
+	cleanupOlderThanFlag = &cli.DurationFlag{
+		Name:  "older-than",
+		Usage: "Constraints the cleanup to the connectors started more than the given `DURATION` ago, e.g. 72h",
+	}
+	cleanupDryRunFlag = &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Shows the connectors whose connections would be cleaned up, without cleaning them up",
+	}
 	invertInfoSortFlag = &cli.BoolFlag{
 		Name:    "invert-sort",
 		Usage:   "Inverts the sort order of the tunnel info.",
@@ -182,8 +223,12 @@ func buildCreateCommand() *cli.Command {
 
   For example, to create a tunnel named 'my-tunnel' run:
 
-  $ cloudflared tunnel create my-tunnel`,
-		Flags:              []cli.Flag{outputFormatFlag, credentialsFileFlagCLIOnly, createSecretFlag},
+  $ cloudflared tunnel create my-tunnel
+
+  Labels group tunnels, e.g. by team or environment, and "cloudflared tunnel list --label" lists the tunnels with a label:
+
+  $ cloudflared tunnel create --label team=payments --label environment=staging my-tunnel`,
+		Flags:              []cli.Flag{outputFormatFlag, templateFormatFlag, credentialsFileFlagCLIOnly, createSecretFlag, createLabelFlag},
 		CustomHelpTemplate: commandHelpTemplate(),
 	}
 }
@@ -244,12 +289,14 @@ func buildListCommand() *cli.Command {
 		Description: "cloudflared tunnel list will display all active tunnels, their created time and associated connections. Use -d flag to include deleted tunnels. See the list of options to filter the list",
 		Flags: []cli.Flag{
 			outputFormatFlag,
+			templateFormatFlag,
 			showDeletedFlag,
 			listNameFlag,
 			listNamePrefixFlag,
 			listExcludeNamePrefixFlag,
 			listExistedAtFlag,
 			listIDFlag,
+			listLabelFlag,
 			showRecentlyDisconnected,
 			sortByFlag,
 			invertSortFlag,
@@ -298,6 +345,8 @@ func listCommand(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	// The API doesn't filter tunnels by label
+	tunnels = parseLabelSelector(c.StringSlice(listLabelFlag.Name)).filter(tunnels)
 
 	// Sort the tunnels
 	sortBy := c.String("sort-by")
@@ -329,8 +378,8 @@ func listCommand(c *cli.Context) error {
 		sc.log.Error().Msgf("%s is not a valid sort field. Valid sort fields are %s. Defaulting to 'name'.", sortBy, allSortByOptions)
 	}
 
-	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
-		return renderOutput(outputFormat, tunnels)
+	if rendered, err := renderOutputFromFlags(c, tunnels); rendered || err != nil {
+		return err
 	}
 
 	if len(tunnels) > 0 {
@@ -348,8 +397,20 @@ func formatAndPrintTunnelList(tunnels []*cfapi.Tunnel, showRecentlyDisconnected
 
 	_, _ = fmt.Fprintln(writer, "You can obtain more detailed information for each tunnel with `cloudflared tunnel info <name/uuid>`")
 
+	// Labels are only shown if some tunnels have labels
+	showLabels := false
+	for _, t := range tunnels {
+		if len(t.Labels()) > 0 {
+			showLabels = true
+		}
+	}
+
 	// Print column headers with tabbed columns
-	_, _ = fmt.Fprintln(writer, "ID\tNAME\tCREATED\tCONNECTIONS\t")
+	if showLabels {
+		_, _ = fmt.Fprintln(writer, "ID\tNAME\tCREATED\tCONNECTIONS\tLABELS\t")
+	} else {
+		_, _ = fmt.Fprintln(writer, "ID\tNAME\tCREATED\tCONNECTIONS\t")
+	}
 
 	// Loop through tunnels, create formatted string for each, and print using tabwriter
 	for _, t := range tunnels {
@@ -360,6 +421,9 @@ func formatAndPrintTunnelList(tunnels []*cfapi.Tunnel, showRecentlyDisconnected
 			t.CreatedAt.Format(time.RFC3339),
 			fmtConnections(t.Connections, showRecentlyDisconnected),
 		)
+		if showLabels {
+			formattedStr += fmtLabels(t.Labels()) + "\t"
+		}
 		_, _ = fmt.Fprintln(writer, formattedStr)
 	}
 }
@@ -391,16 +455,19 @@ func fmtConnections(connections []cfapi.Connection, showRecentlyDisconnected boo
 
 func buildInfoCommand() *cli.Command {
 	return &cli.Command{
-		Name:        "info",
-		Action:      cliutil.ConfiguredAction(tunnelInfo),
-		Usage:       "List details about the active connectors for a tunnel",
-		UsageText:   "cloudflared tunnel [tunnel command options] info [subcommand options] [TUNNEL]",
-		Description: "cloudflared tunnel info displays details about the active connectors for a given tunnel (identified by name or uuid).",
+		Name:         "info",
+		Action:       cliutil.ConfiguredAction(tunnelInfo),
+		Usage:        "List details about the active connectors for a tunnel",
+		UsageText:    "cloudflared tunnel [tunnel command options] info [subcommand options] [TUNNEL]",
+		BashComplete: completeArgs(false, tunnelCompletion),
+		Description:  "cloudflared tunnel info displays details about the active connectors for a given tunnel (identified by name or uuid).",
 		Flags: []cli.Flag{
 			outputFormatFlag,
+			templateFormatFlag,
 			showRecentlyDisconnected,
 			sortInfoByFlag,
 			invertInfoSortFlag,
+			infoMetricsFlag,
 		},
 		CustomHelpTemplate: commandHelpTemplate(),
 	}
@@ -469,10 +536,20 @@ func tunnelInfo(c *cli.Context) error {
 		tunnel.Name,
 		tunnel.CreatedAt,
 		clients,
+		nil,
+	}
+	if address := c.String(infoMetricsFlag.Name); address != "" {
+		localConnector, err := findLocalConnector(address, clients)
+		if err != nil {
+			sc.log.Warn().Err(err).Msg("Couldn't get the connections of the connector running on this machine")
+		} else if localConnector == nil {
+			sc.log.Warn().Msgf("The connector running on this machine isn't connected to tunnel %s", tunnelID)
+		}
+		info.LocalConnector = localConnector
 	}
 
-	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
-		return renderOutput(outputFormat, info)
+	if rendered, err := renderOutputFromFlags(c, info); rendered || err != nil {
+		return err
 	}
 
 	if len(clients) > 0 {
@@ -536,6 +613,10 @@ func formatAndPrintConnectionsList(tunnelInfo Info, showRecentlyDisconnected boo
 		)
 		_, _ = fmt.Fprintln(writer, formattedStr)
 	}
+
+	if tunnelInfo.LocalConnector != nil {
+		printLocalConnector(writer, tunnelInfo.LocalConnector, time.Now())
+	}
 }
 
 func tabWriter() *tabwriter.Writer {
@@ -557,6 +638,7 @@ func buildDeleteCommand() *cli.Command {
 		Action:             cliutil.ConfiguredAction(deleteCommand),
 		Usage:              "Delete existing tunnel by UUID or name",
 		UsageText:          "cloudflared tunnel [tunnel command options] delete [subcommand options] TUNNEL",
+		BashComplete:       completeArgs(true, tunnelCompletion),
 		Description:        "cloudflared tunnel delete will delete tunnels with the given tunnel UUIDs or names. A tunnel cannot be deleted if it has active connections. To delete the tunnel unconditionally, use -f flag.",
 		Flags:              []cli.Flag{credentialsFileFlagCLIOnly, forceDeleteFlag},
 		CustomHelpTemplate: commandHelpTemplate(),
@@ -584,6 +666,51 @@ func deleteCommand(c *cli.Context) error {
 	return sc.delete(tunnelIDs)
 }
 
+// renderOutputFromFlags renders v as selected by --output or --format. It returns false when the table output is
+// selected, which commands print themselves.
+func renderOutputFromFlags(c *cli.Context, v interface{}) (bool, error) {
+	outputFormat := c.String(outputFormatFlag.Name)
+	if format := c.String(templateFormatFlag.Name); format != "" {
+		if outputFormat != "" {
+			return true, cliutil.UsageError("--%s and --%s can't be used together", outputFormatFlag.Name, templateFormatFlag.Name)
+		}
+		return true, renderTemplate(os.Stdout, format, v)
+	}
+	if outputFormat == "" || outputFormat == "table" {
+		return false, nil
+	}
+	return true, renderOutput(outputFormat, v)
+}
+
+// renderTemplate renders each element of v with the template format if it's a slice, or else v itself, one per line
+func renderTemplate(w io.Writer, format string, v interface{}) error {
+	tmpl, err := template.New(templateFormatFlag.Name).Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(format)
+	if err != nil {
+		return errors.Wrapf(err, "invalid --%s template", templateFormatFlag.Name)
+	}
+	items := []interface{}{v}
+	if value := reflect.ValueOf(v); value.Kind() == reflect.Slice {
+		items = make([]interface{}, value.Len())
+		for i := range items {
+			items[i] = value.Index(i).Interface()
+		}
+	}
+	for _, item := range items {
+		if err := tmpl.Execute(w, item); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func renderOutput(format string, v interface{}) error {
 	switch format {
 	case "json":
@@ -605,19 +732,34 @@ func buildRunCommand() *cli.Command {
 		selectProtocolFlag,
 		featuresFlag,
 		tunnelTokenFlag,
+		apiTokenFlag,
+		accountIDFlag,
+		tokenRefreshIntervalFlag,
+		maintenanceSocketFlag,
 	}
 	flags = append(flags, configureProxyFlags(false)...)
+	flags = append(flags, configureKubernetesFlags(false)...)
+	flags = append(flags, configureDockerFlags(false)...)
+	flags = append(flags, configureWarpRoutingPolicyFlags(false)...)
+	flags = append(flags, configureHookFlags(false)...)
+	flags = append(flags, configureWatchdogFlags(false)...)
+	flags = append(flags, configureRetryBudgetFlags(false)...)
+	flags = append(flags, configureFeatureOverrideFlags(false)...)
+	flags = append(flags, configureChaosFlags()...)
 	return &cli.Command{
-		Name:      "run",
-		Action:    cliutil.ConfiguredAction(runCommand),
-		Usage:     "Proxy a local web server by running the given tunnel",
-		UsageText: "cloudflared tunnel [tunnel command options] run [subcommand options] [TUNNEL]",
+		Name:         "run",
+		Action:       cliutil.ConfiguredAction(runCommand),
+		Usage:        "Proxy a local web server by running the given tunnel",
+		UsageText:    "cloudflared tunnel [tunnel command options] run [subcommand options] [TUNNEL]",
+		BashComplete: completeArgs(false, tunnelCompletion),
 		Description: `Runs the tunnel identified by name or UUUD, creating highly available connections
   between your server and the Cloudflare edge. You can provide name or UUID of tunnel to run either as the
   last command line argument or in the configuration file using "tunnel: TUNNEL".
 
   This command requires the tunnel credentials file created when "cloudflared tunnel create" was run,
   however it does not need access to cert.pem from "cloudflared login" if you identify the tunnel by UUID.
+  Instead of the credentials file or a long-lived --token, --api-token and --account-id fetch the token of
+  the tunnel from the Cloudflare API when it starts, and again every --token-refresh-interval.
   If you experience other problems running the tunnel, "cloudflared tunnel cleanup" may help by removing
   any old connection records.
 `,
@@ -642,8 +784,23 @@ func runCommand(c *cli.Context) error {
 			"your origin will not be reachable. You should remove the `hostname` property to avoid this warning.")
 	}
 
+	tokenStr := c.String(TunnelTokenFlag)
+	if source := config.GetConfiguration().Secrets.Token; source != nil && tokenStr == "" {
+		if sc.tunnelSecret, err = fetchSecret(source, sc.log); err != nil {
+			return err
+		}
+		sc.tunnelSecret.credentials = func(value []byte) (connection.Credentials, error) {
+			token, err := ParseToken(strings.TrimSpace(string(value)))
+			if err != nil {
+				return connection.Credentials{}, err
+			}
+			return token.Credentials(), nil
+		}
+		tokenStr = strings.TrimSpace(string(sc.tunnelSecret.value))
+	}
+
 	// Check if token is provided and if not use default tunnelID flag method
-	if tokenStr := c.String(TunnelTokenFlag); tokenStr != "" {
+	if tokenStr != "" {
 		if token, err := ParseToken(tokenStr); err == nil {
 			return sc.runWithCredentials(token.Credentials())
 		}
@@ -659,21 +816,15 @@ func runCommand(c *cli.Context) error {
 			}
 		}
 
+		if apiToken := c.String(apiTokenFlag.Name); apiToken != "" {
+			return runWithAPIToken(sc, tunnelRef, apiToken)
+		}
 		return runNamedTunnel(sc, tunnelRef)
 	}
 }
 
 func ParseToken(tokenStr string) (*connection.TunnelToken, error) {
-	content, err := base64.StdEncoding.DecodeString(tokenStr)
-	if err != nil {
-		return nil, err
-	}
-
-	var token connection.TunnelToken
-	if err := json.Unmarshal(content, &token); err != nil {
-		return nil, err
-	}
-	return &token, nil
+	return connection.ParseTunnelToken(tokenStr)
 }
 
 func runNamedTunnel(sc *subcommandContext, tunnelRef string) error {
@@ -689,9 +840,10 @@ func buildCleanupCommand() *cli.Command {
 		Name:               "cleanup",
 		Action:             cliutil.ConfiguredAction(cleanupCommand),
 		Usage:              "Cleanup tunnel connections",
-		UsageText:          "cloudflared tunnel [tunnel command options] cleanup [subcommand options] TUNNEL",
-		Description:        "Delete connections for tunnels with the given UUIDs or names.",
-		Flags:              []cli.Flag{cleanupClientFlag},
+		UsageText:          "cloudflared tunnel [tunnel command options] cleanup [subcommand options] TUNNEL...",
+		BashComplete:       completeArgs(true, tunnelCompletion),
+		Description:        "Delete connections for tunnels with the given UUIDs or names. Names can be glob patterns, e.g. 'web-*', to clean up the connections of every tunnel with a matching name. The connections can be limited to the connectors with a given ID, version, or age, and --dry-run shows them without deleting their connections.",
+		Flags:              []cli.Flag{cleanupClientFlag, cleanupVersionFlag, cleanupOlderThanFlag, cleanupDryRunFlag},
 		CustomHelpTemplate: commandHelpTemplate(),
 	}
 }
@@ -706,10 +858,25 @@ func cleanupCommand(c *cli.Context) error {
 		return err
 	}
 
-	tunnelIDs, err := sc.findIDs(c.Args().Slice())
+	var inputs, patterns []string
+	for _, arg := range c.Args().Slice() {
+		if strings.ContainsAny(arg, "*?[") {
+			patterns = append(patterns, arg)
+		} else {
+			inputs = append(inputs, arg)
+		}
+	}
+	tunnelIDs, err := sc.findIDs(inputs)
 	if err != nil {
 		return err
 	}
+	if len(patterns) > 0 {
+		matchingIDs, err := sc.findIDsMatching(patterns)
+		if err != nil {
+			return err
+		}
+		tunnelIDs = append(tunnelIDs, matchingIDs...)
+	}
 
 	return sc.cleanupConnections(tunnelIDs)
 }
@@ -720,6 +887,7 @@ func buildTokenCommand() *cli.Command {
 		Action:             cliutil.ConfiguredAction(tokenCommand),
 		Usage:              "Fetch the credentials token for an existing tunnel (by name or UUID) that allows to run it",
 		UsageText:          "cloudflared tunnel [tunnel command options] token [subcommand options] TUNNEL",
+		BashComplete:       completeArgs(false, tunnelCompletion),
 		Description:        "cloudflared tunnel token will fetch the credentials token for a given tunnel (by its name or UUID), which is then used to run the tunnel. This command fails if the tunnel does not exist or has been deleted. Use the flag `cloudflared tunnel token --cred-file /my/path/file.json TUNNEL` to output the token to the credentials JSON file. Note: this command only works for Tunnels created since cloudflared version 2022.3.0",
 		Flags:              []cli.Flag{credentialsFileFlagCLIOnly},
 		CustomHelpTemplate: commandHelpTemplate(),
@@ -778,6 +946,9 @@ To route a hostname by creating a DNS CNAME record to a tunnel:
    cloudflared tunnel route dns <tunnel ID or name> <hostname>
 You can read more at: https://developers.cloudflare.com/cloudflare-one/connections/connect-apps/routing-to-tunnel/dns
 
+To route many hostnames at once, from a CSV file of hostname,tunnel rows:
+   cloudflared tunnel route dns-bulk <file>
+
 To use this tunnel as a load balancer origin, creating pool and load balancer if necessary:
    cloudflared tunnel route lb <tunnel ID or name> <hostname> <load balancer pool>
 You can read more at: https://developers.cloudflare.com/cloudflare-one/connections/connect-apps/routing-to-tunnel/lb
@@ -790,19 +961,22 @@ Further information about managing Cloudflare WARP traffic to your tunnel is ava
 		CustomHelpTemplate: commandHelpTemplate(),
 		Subcommands: []*cli.Command{
 			{
-				Name:        "dns",
-				Action:      cliutil.ConfiguredAction(routeDnsCommand),
-				Usage:       "HostnameRoute a hostname by creating a DNS CNAME record to a tunnel",
-				UsageText:   "cloudflared tunnel route dns [TUNNEL] [HOSTNAME]",
-				Description: `Creates a DNS CNAME record hostname that points to the tunnel.`,
-				Flags:       []cli.Flag{overwriteDNSFlag},
+				Name:         "dns",
+				Action:       cliutil.ConfiguredAction(routeDnsCommand),
+				Usage:        "HostnameRoute a hostname by creating a DNS CNAME record to a tunnel",
+				UsageText:    "cloudflared tunnel route dns [TUNNEL] [HOSTNAME]",
+				BashComplete: completeArgs(false, tunnelCompletion),
+				Description:  `Creates a DNS CNAME record hostname that points to the tunnel.`,
+				Flags:        []cli.Flag{overwriteDNSFlag},
 			},
+			buildRouteDNSBulkSubcommand(),
 			{
-				Name:        "lb",
-				Action:      cliutil.ConfiguredAction(routeLbCommand),
-				Usage:       "Use this tunnel as a load balancer origin, creating pool and load balancer if necessary",
-				UsageText:   "cloudflared tunnel route dns [TUNNEL] [HOSTNAME] [LB-POOL]",
-				Description: `Creates Load Balancer with an origin pool that points to the tunnel.`,
+				Name:         "lb",
+				Action:       cliutil.ConfiguredAction(routeLbCommand),
+				Usage:        "Use this tunnel as a load balancer origin, creating pool and load balancer if necessary",
+				UsageText:    "cloudflared tunnel route dns [TUNNEL] [HOSTNAME] [LB-POOL]",
+				BashComplete: completeArgs(false, tunnelCompletion),
+				Description:  `Creates Load Balancer with an origin pool that points to the tunnel.`,
 			},
 			buildRouteIPSubcommand(),
 		},
@@ -1,8 +1,10 @@
 package tunnel
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"flag"
 	"path/filepath"
 	"testing"
 
@@ -10,6 +12,7 @@ import (
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
 
 	"github.com/cloudflare/cloudflared/cfapi"
 	"github.com/cloudflare/cloudflared/connection"
@@ -202,3 +205,43 @@ func Test_TunnelToken(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, token, expectedToken)
 }
+
+func Test_renderTemplate(t *testing.T) {
+	tunnels := []*cfapi.Tunnel{
+		{ID: uuid.MustParse("df5ed608-b8b4-4109-89f3-9f2cf199df64"), Name: "first"},
+		{ID: uuid.MustParse("a6ea0cfb-6c0e-4a63-b4ba-2ba2b1fb7f6c"), Name: "second", Connections: []cfapi.Connection{{ColoName: "lhr01"}}},
+	}
+	var output bytes.Buffer
+	require.NoError(t, renderTemplate(&output, "{{.ID}} {{.Name}} {{len .Connections}}", tunnels))
+	assert.Equal(t, "df5ed608-b8b4-4109-89f3-9f2cf199df64 first 0\na6ea0cfb-6c0e-4a63-b4ba-2ba2b1fb7f6c second 1\n", output.String())
+
+	// Values that aren't lists are rendered once
+	output.Reset()
+	require.NoError(t, renderTemplate(&output, "{{.Name}}: {{json .ID}}", tunnels[0]))
+	assert.Equal(t, "first: \"df5ed608-b8b4-4109-89f3-9f2cf199df64\"\n", output.String())
+
+	assert.Error(t, renderTemplate(&output, "{{.Name", tunnels))
+	assert.Error(t, renderTemplate(&output, "{{.Missing}}", tunnels))
+}
+
+func Test_renderOutputFromFlags(t *testing.T) {
+	newContext := func(args ...string) *cli.Context {
+		flagSet := flag.NewFlagSet("test", flag.PanicOnError)
+		flagSet.String(outputFormatFlag.Name, "", "")
+		flagSet.String(templateFormatFlag.Name, "", "")
+		require.NoError(t, flagSet.Parse(args))
+		return cli.NewContext(cli.NewApp(), flagSet, nil)
+	}
+	rendered, err := renderOutputFromFlags(newContext(), nil)
+	assert.False(t, rendered)
+	assert.NoError(t, err)
+	rendered, err = renderOutputFromFlags(newContext("--output", "table"), nil)
+	assert.False(t, rendered)
+	assert.NoError(t, err)
+	rendered, err = renderOutputFromFlags(newContext("--output", "xml"), nil)
+	assert.True(t, rendered)
+	assert.Error(t, err)
+	rendered, err = renderOutputFromFlags(newContext("--output", "json", "--format", "{{.}}"), nil)
+	assert.True(t, rendered)
+	assert.Error(t, err)
+}
@@ -0,0 +1,117 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/go-systemd/daemon"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/signal"
+	"github.com/cloudflare/cloudflared/tunnelstate"
+)
+
+// systemdNotifier reports the state of cloudflared to systemd with sd_notify: READY=1 once the tunnel is connected,
+// RELOADING=1 while the configuration is reloaded, STOPPING=1 when shutting down, and WATCHDOG=1 keepalives while the
+// tunnel has connections to the edge, so that a unit with WatchdogSec is restarted when it can't connect. It does
+// nothing when cloudflared isn't run by systemd.
+type systemdNotifier struct {
+	tracker *tunnelstate.ConnTracker
+	// notify sends a state to systemd, it's daemon.SdNotify outside of tests
+	notify func(state string) (bool, error)
+	// isReady is set to 1 once READY=1 is sent, reloads before that don't notify systemd
+	isReady int32
+	log     *zerolog.Logger
+}
+
+func newSystemdNotifier(log *zerolog.Logger) *systemdNotifier {
+	return &systemdNotifier{
+		tracker: tunnelstate.NewConnTracker(log),
+		notify: func(state string) (bool, error) {
+			return daemon.SdNotify(false, state)
+		},
+		log: log,
+	}
+}
+
+func (n *systemdNotifier) send(state string) {
+	if _, err := n.notify(state); err != nil {
+		n.log.Debug().Err(err).Str("state", state).Msg("Failed to notify systemd")
+	}
+}
+
+// OnTunnelEvent tracks the connections of the tunnel, and reports them in the status of the unit
+func (n *systemdNotifier) OnTunnelEvent(event connection.Event) {
+	n.tracker.OnTunnelEvent(event)
+	switch event.EventType {
+	case connection.Connected, connection.Disconnected, connection.Reconnecting, connection.Unregistering:
+		n.send("STATUS=" + n.status())
+	}
+}
+
+// status describes the connections of the tunnel
+func (n *systemdNotifier) status() string {
+	return fmt.Sprintf("%d connections to the edge", n.tracker.CountActiveConns())
+}
+
+// ready notifies systemd that cloudflared is ready once the tunnel is connected
+func (n *systemdNotifier) ready(connectedSignal *signal.Signal) {
+	<-connectedSignal.Wait()
+	n.send(daemon.SdNotifyReady)
+	atomic.StoreInt32(&n.isReady, 1)
+}
+
+// Reloading notifies systemd that the configuration is being reloaded
+func (n *systemdNotifier) Reloading() {
+	if atomic.LoadInt32(&n.isReady) == 1 {
+		n.send(daemon.SdNotifyReloading)
+	}
+}
+
+// Reloaded notifies systemd that cloudflared is ready again after reloading its configuration
+func (n *systemdNotifier) Reloaded() {
+	if atomic.LoadInt32(&n.isReady) == 1 {
+		n.send(daemon.SdNotifyReady)
+	}
+}
+
+// stopping notifies systemd that cloudflared is shutting down, when graceful shutdown starts or ctx is done
+func (n *systemdNotifier) stopping(ctx context.Context, graceShutdownC <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+	case <-graceShutdownC:
+	}
+	n.send(daemon.SdNotifyStopping)
+}
+
+// runWatchdog sends keepalives at half the watchdog timeout of the unit, if it has one, while the tunnel has
+// connections to the edge. It returns when ctx is done.
+func (n *systemdNotifier) runWatchdog(ctx context.Context) {
+	timeout, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		n.log.Err(err).Msg("Invalid systemd watchdog timeout, keepalives won't be sent")
+		return
+	}
+	if timeout == 0 {
+		return
+	}
+	n.sendKeepalives(ctx, timeout/2)
+}
+
+func (n *systemdNotifier) sendKeepalives(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n.tracker.CountActiveConns() > 0 {
+				n.send(daemon.SdNotifyWatchdog)
+			}
+		}
+	}
+}
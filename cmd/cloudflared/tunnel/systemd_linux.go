@@ -0,0 +1,35 @@
+package tunnel
+
+import (
+	"net"
+
+	"github.com/coreos/go-systemd/activation"
+)
+
+// metricsSocketName is the FileDescriptorName of the socket of the metrics server in a systemd socket unit
+const metricsSocketName = "metrics"
+
+// activatedMetricsListener returns the listener of the metrics server passed by systemd socket activation, or nil if
+// cloudflared wasn't socket activated. It's the socket named metricsSocketName, or the only socket if there's one.
+// Other sockets are closed, since cloudflared doesn't serve them.
+func activatedMetricsListener() net.Listener {
+	listenersByName, _ := activation.ListenersWithNames()
+	var metricsListener net.Listener
+	if listeners := listenersByName[metricsSocketName]; len(listeners) > 0 {
+		metricsListener = listeners[0]
+	} else if len(listenersByName) == 1 {
+		for _, listeners := range listenersByName {
+			if len(listeners) == 1 {
+				metricsListener = listeners[0]
+			}
+		}
+	}
+	for _, listeners := range listenersByName {
+		for _, listener := range listeners {
+			if listener != metricsListener {
+				listener.Close()
+			}
+		}
+	}
+	return metricsListener
+}
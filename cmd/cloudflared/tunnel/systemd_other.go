@@ -0,0 +1,12 @@
+//go:build !linux
+
+package tunnel
+
+import (
+	"net"
+)
+
+// activatedMetricsListener returns nil, since there's no systemd socket activation outside of Linux
+func activatedMetricsListener() net.Listener {
+	return nil
+}
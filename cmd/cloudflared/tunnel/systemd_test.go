@@ -0,0 +1,97 @@
+package tunnel
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/signal"
+)
+
+// testSystemdNotifier returns a systemdNotifier recording the states it sends
+func testSystemdNotifier() (*systemdNotifier, func() []string) {
+	log := zerolog.Nop()
+	n := newSystemdNotifier(&log)
+	var (
+		lock   sync.Mutex
+		states []string
+	)
+	n.notify = func(state string) (bool, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		states = append(states, state)
+		return true, nil
+	}
+	return n, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		sent := states
+		states = nil
+		return sent
+	}
+}
+
+func TestSystemdNotifierLifecycle(t *testing.T) {
+	n, sent := testSystemdNotifier()
+
+	// Reloads before the tunnel is ready aren't reported
+	n.Reloading()
+	n.Reloaded()
+	assert.Empty(t, sent())
+
+	connectedSignal := signal.New(make(chan struct{}))
+	readyC := make(chan struct{})
+	go func() {
+		n.ready(connectedSignal)
+		close(readyC)
+	}()
+	n.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected})
+	connectedSignal.Notify()
+	<-readyC
+	assert.Equal(t, []string{"STATUS=1 connections to the edge", "READY=1"}, sent())
+
+	n.Reloading()
+	n.Reloaded()
+	assert.Equal(t, []string{"RELOADING=1", "READY=1"}, sent())
+
+	n.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Disconnected})
+	assert.Equal(t, []string{"STATUS=0 connections to the edge"}, sent())
+
+	graceShutdownC := make(chan struct{})
+	close(graceShutdownC)
+	n.stopping(context.Background(), graceShutdownC)
+	assert.Equal(t, []string{"STOPPING=1"}, sent())
+}
+
+func TestSystemdNotifierKeepalives(t *testing.T) {
+	n, sent := testSystemdNotifier()
+	ctx, cancel := context.WithCancel(context.Background())
+	doneC := make(chan struct{})
+	go func() {
+		n.sendKeepalives(ctx, 10*time.Millisecond)
+		close(doneC)
+	}()
+
+	// No keepalives are sent without connections to the edge
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, sent())
+
+	n.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected})
+	require.Eventually(t, func() bool {
+		for _, state := range sent() {
+			if state == "WATCHDOG=1" {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-doneC
+}
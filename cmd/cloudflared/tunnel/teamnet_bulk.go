@@ -0,0 +1,382 @@
+package tunnel
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+)
+
+// Columns of the CSV files of routes, the tunnel and virtual network can be IDs or names
+var routesCSVHeader = []string{"network", "tunnel", "vnet", "comment"}
+
+var (
+	routesDryRunFlag = &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Validate the file and print the routes that would be added and deleted, without changing any.",
+	}
+	routesDeleteMissingFlag = &cli.BoolFlag{
+		Name:  "delete-missing",
+		Usage: "Delete the routes of the routing table which aren't in the file, so the routing table matches the file.",
+	}
+)
+
+func buildRouteIPImportSubcommand() *cli.Command {
+	return &cli.Command{
+		Name:      "import",
+		Action:    cliutil.ConfiguredAction(importRoutesCommand),
+		Usage:     "Add the routes listed in a CSV file to the routing table",
+		UsageText: "cloudflared tunnel [--config FILEPATH] route ip import [flags] [FILE]",
+		Description: `Adds the routes of a CSV file to your routing table, replacing the routes of the same
+networks and virtual networks that go to other tunnels or have other comments. The rows
+of the file are "network,tunnel,vnet,comment", where the tunnel and virtual network are
+IDs or names, and the virtual network and comment are optional. The file is validated
+before any route is changed. Use --dry-run to review the changes, and --delete-missing
+to also delete the routes which aren't in the file.`,
+		Flags: []cli.Flag{routesDryRunFlag, routesDeleteMissingFlag},
+	}
+}
+
+func buildRouteIPExportSubcommand() *cli.Command {
+	return &cli.Command{
+		Name:        "export",
+		Action:      cliutil.ConfiguredAction(exportRoutesCommand),
+		Usage:       "Write the routing table to a CSV file",
+		UsageText:   "cloudflared tunnel [--config FILEPATH] route ip export [flags] [FILE]",
+		Description: `Writes your routing table as a CSV file that "route ip import" reads, to stdout if FILE is omitted or "-". You can use flags to filter the routes.`,
+		Flags:       cfapi.IpRouteFilterFlags,
+	}
+}
+
+// routeRow is a route of a CSV file
+type routeRow struct {
+	line    int
+	network net.IPNet
+	tunnel  string
+	vnet    string
+	comment string
+}
+
+// parseRoutesCSV parses the routes of a CSV file, returning the errors of all invalid rows
+func parseRoutesCSV(reader io.Reader) ([]routeRow, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.Comment = '#'
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	var (
+		rows     []routeRow
+		problems []string
+	)
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid CSV")
+		}
+		line, _ := csvReader.FieldPos(0)
+		if len(rows) == 0 && len(problems) == 0 && strings.EqualFold(record[0], routesCSVHeader[0]) {
+			continue
+		}
+		if len(record) < 2 || len(record) > len(routesCSVHeader) {
+			problems = append(problems, fmt.Sprintf("line %d: expected %s", line, strings.Join(routesCSVHeader, ",")))
+			continue
+		}
+		_, network, err := net.ParseCIDR(strings.TrimSpace(record[0]))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: invalid network CIDR %s", line, record[0]))
+			continue
+		}
+		row := routeRow{
+			line:    line,
+			network: *network,
+			tunnel:  strings.TrimSpace(record[1]),
+		}
+		if row.tunnel == "" {
+			problems = append(problems, fmt.Sprintf("line %d: missing tunnel", line))
+			continue
+		}
+		if len(record) > 2 {
+			row.vnet = strings.TrimSpace(record[2])
+		}
+		if len(record) > 3 {
+			row.comment = record[3]
+		}
+		rows = append(rows, row)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid routes:\n%s", strings.Join(problems, "\n"))
+	}
+	return rows, nil
+}
+
+// routeKey identifies a route by its network and virtual network
+type routeKey struct {
+	network string
+	vnet    uuid.UUID
+}
+
+// resolvedRoute is a route of a CSV file with the IDs of its tunnel and virtual network
+type resolvedRoute struct {
+	cfapi.NewRoute
+	line int
+}
+
+// routeReplacement is an existing route replaced by a route of a file with another tunnel or comment, as routes can't
+// be updated
+type routeReplacement struct {
+	current *cfapi.DetailedRoute
+	route   resolvedRoute
+}
+
+type routeImportPlan struct {
+	add       []resolvedRoute
+	replace   []routeReplacement
+	delete    []*cfapi.DetailedRoute
+	unchanged int
+}
+
+// planRouteImport compares the routes of a file with the existing routes. Routes of the default virtual network have
+// a nil VNetID, or defaultVnet as VNetID.
+func planRouteImport(routes []resolvedRoute, existing []*cfapi.DetailedRoute, defaultVnet uuid.UUID, deleteMissing bool) (routeImportPlan, error) {
+	keyOf := func(network net.IPNet, vnet *uuid.UUID) routeKey {
+		if vnet == nil {
+			return routeKey{network: network.String(), vnet: defaultVnet}
+		}
+		return routeKey{network: network.String(), vnet: *vnet}
+	}
+
+	existingByKey := make(map[routeKey]*cfapi.DetailedRoute, len(existing))
+	for _, route := range existing {
+		existingByKey[keyOf(net.IPNet(route.Network), route.VNetID)] = route
+	}
+
+	var plan routeImportPlan
+	inFile := make(map[routeKey]int, len(routes))
+	for _, route := range routes {
+		key := keyOf(route.Network, route.VNetID)
+		if line, ok := inFile[key]; ok {
+			return routeImportPlan{}, fmt.Errorf("line %d: network %s is already routed on line %d", route.line, key.network, line)
+		}
+		inFile[key] = route.line
+
+		current, ok := existingByKey[key]
+		switch {
+		case !ok:
+			plan.add = append(plan.add, route)
+		case current.TunnelID == route.TunnelID && current.Comment == route.Comment:
+			plan.unchanged++
+		default:
+			plan.replace = append(plan.replace, routeReplacement{current: current, route: route})
+		}
+	}
+	if deleteMissing {
+		for _, route := range existing {
+			if _, ok := inFile[keyOf(net.IPNet(route.Network), route.VNetID)]; !ok {
+				plan.delete = append(plan.delete, route)
+			}
+		}
+	}
+	return plan, nil
+}
+
+func importRoutesCommand(c *cli.Context) error {
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() != 1 {
+		return errors.New("You must supply exactly one argument, the CSV file of the routes to import")
+	}
+
+	file, err := os.Open(c.Args().First())
+	if err != nil {
+		return err
+	}
+	rows, err := parseRoutesCSV(file)
+	_ = file.Close()
+	if err != nil {
+		return err
+	}
+	routes, err := resolveRouteRows(sc, rows)
+	if err != nil {
+		return err
+	}
+
+	existing, err := sc.listAllRoutes(cfapi.NewIpRouteFilter())
+	if err != nil {
+		return errors.Wrap(err, "API error")
+	}
+	defaultVnet, err := defaultVnetID(sc)
+	if err != nil {
+		return err
+	}
+	plan, err := planRouteImport(routes, existing, defaultVnet, c.Bool(routesDeleteMissingFlag.Name))
+	if err != nil {
+		return err
+	}
+
+	if c.Bool(routesDryRunFlag.Name) {
+		for _, route := range plan.add {
+			fmt.Printf("Would add route for %s over tunnel %s\n", route.Network.String(), route.TunnelID)
+		}
+		for _, replacement := range plan.replace {
+			fmt.Printf("Would replace route for %s over tunnel %s with route over tunnel %s\n", replacement.current.Network, replacement.current.TunnelID, replacement.route.TunnelID)
+		}
+		for _, route := range plan.delete {
+			fmt.Printf("Would delete route for %s over tunnel %s\n", route.Network, route.TunnelID)
+		}
+		fmt.Printf("%d routes would be added, %d replaced, %d deleted and %d are unchanged\n", len(plan.add), len(plan.replace), len(plan.delete), plan.unchanged)
+		return nil
+	}
+
+	// Routes are added before any is deleted, so that a failure doesn't leave networks unrouted
+	for _, route := range plan.add {
+		if _, err := sc.addRoute(route.NewRoute); err != nil {
+			return errors.Wrapf(err, "API error adding route for %s on line %d", route.Network.String(), route.line)
+		}
+		fmt.Printf("Successfully added route for %s over tunnel %s\n", route.Network.String(), route.TunnelID)
+	}
+	for _, replacement := range plan.replace {
+		if err := replaceRoute(sc, replacement); err != nil {
+			return err
+		}
+		fmt.Printf("Successfully replaced route for %s, now over tunnel %s\n", replacement.route.Network.String(), replacement.route.TunnelID)
+	}
+	for _, route := range plan.delete {
+		if err := sc.deleteRoute(cfapi.DeleteRouteParams{Network: net.IPNet(route.Network), VNetID: route.VNetID}); err != nil {
+			return errors.Wrapf(err, "API error deleting route for %s", route.Network)
+		}
+		fmt.Printf("Successfully deleted route for %s\n", route.Network)
+	}
+	fmt.Printf("%d routes were added, %d replaced, %d deleted and %d are unchanged\n", len(plan.add), len(plan.replace), len(plan.delete), plan.unchanged)
+	return nil
+}
+
+// replaceRoute deletes the current route of a network to add the route of the file, as there can't be two routes for
+// the same network. The current route is added back if the route of the file can't be added.
+func replaceRoute(sc *subcommandContext, replacement routeReplacement) error {
+	current := replacement.current
+	if err := sc.deleteRoute(cfapi.DeleteRouteParams{Network: net.IPNet(current.Network), VNetID: current.VNetID}); err != nil {
+		return errors.Wrapf(err, "API error deleting route for %s to replace it", current.Network)
+	}
+	if _, err := sc.addRoute(replacement.route.NewRoute); err != nil {
+		restored := cfapi.NewRoute{Network: net.IPNet(current.Network), TunnelID: current.TunnelID, Comment: current.Comment, VNetID: current.VNetID}
+		if _, restoreErr := sc.addRoute(restored); restoreErr != nil {
+			return errors.Wrapf(err, "API error adding route for %s on line %d, and the previous route over tunnel %s couldn't be restored (%v)",
+				replacement.route.Network.String(), replacement.route.line, current.TunnelID, restoreErr)
+		}
+		return errors.Wrapf(err, "API error adding route for %s on line %d, the previous route was restored", replacement.route.Network.String(), replacement.route.line)
+	}
+	return nil
+}
+
+// resolveRouteRows looks up the IDs of the tunnels and virtual networks of the rows, once per name
+func resolveRouteRows(sc *subcommandContext, rows []routeRow) ([]resolvedRoute, error) {
+	tunnelIDs := make(map[string]uuid.UUID)
+	vnetIDs := make(map[string]uuid.UUID)
+	routes := make([]resolvedRoute, 0, len(rows))
+	for _, row := range rows {
+		tunnelID, ok := tunnelIDs[row.tunnel]
+		if !ok {
+			ids, err := sc.findIDs([]string{row.tunnel})
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d: invalid tunnel", row.line)
+			}
+			tunnelID = ids[0]
+			tunnelIDs[row.tunnel] = tunnelID
+		}
+		route := resolvedRoute{
+			NewRoute: cfapi.NewRoute{
+				Network:  row.network,
+				TunnelID: tunnelID,
+				Comment:  row.comment,
+			},
+			line: row.line,
+		}
+		if row.vnet != "" {
+			vnetID, ok := vnetIDs[row.vnet]
+			if !ok {
+				var err error
+				if vnetID, err = getVnetId(sc, row.vnet); err != nil {
+					return nil, errors.Wrapf(err, "line %d: invalid virtual network", row.line)
+				}
+				vnetIDs[row.vnet] = vnetID
+			}
+			route.VNetID = &vnetID
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func defaultVnetID(sc *subcommandContext) (uuid.UUID, error) {
+	filter := cfapi.NewVnetFilter()
+	filter.WithDeleted(false)
+	filter.ByDefaultStatus(true)
+	vnets, err := sc.listVirtualNetworks(filter)
+	if err != nil {
+		return uuid.Nil, errors.Wrap(err, "API error")
+	}
+	if len(vnets) != 1 {
+		return uuid.Nil, errors.New("there should be exactly 1 default virtual network")
+	}
+	return vnets[0].ID, nil
+}
+
+func exportRoutesCommand(c *cli.Context) error {
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() > 1 {
+		return errors.New("You must supply at most one argument, the CSV file to write the routes to")
+	}
+
+	filter, err := cfapi.NewIpRouteFilterFromCLI(c)
+	if err != nil {
+		return errors.Wrap(err, "invalid config for routing filters")
+	}
+	routes, err := sc.listAllRoutes(filter)
+	if err != nil {
+		return err
+	}
+
+	output := os.Stdout
+	if path := c.Args().First(); path != "" && path != "-" {
+		if output, err = os.Create(path); err != nil {
+			return err
+		}
+		defer output.Close()
+	}
+	return writeRoutesCSV(output, routes)
+}
+
+func writeRoutesCSV(writer io.Writer, routes []*cfapi.DetailedRoute) error {
+	csvWriter := csv.NewWriter(writer)
+	if err := csvWriter.Write(routesCSVHeader); err != nil {
+		return err
+	}
+	for _, route := range routes {
+		vnet := ""
+		if route.VNetID != nil {
+			vnet = route.VNetID.String()
+		}
+		if err := csvWriter.Write([]string{route.Network.String(), route.TunnelID.String(), vnet, route.Comment}); err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
@@ -0,0 +1,92 @@
+package tunnel
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+)
+
+func mustParseCIDR(t *testing.T, cidr string) net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	require.NoError(t, err)
+	return *network
+}
+
+func TestParseRoutesCSV(t *testing.T) {
+	rows, err := parseRoutesCSV(strings.NewReader(`network,tunnel,vnet,comment
+# Office networks
+10.0.0.0/16, office
+10.1.0.1/24,office,staging,"printers, scanners"
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []routeRow{
+		{line: 3, network: mustParseCIDR(t, "10.0.0.0/16"), tunnel: "office"},
+		{line: 4, network: mustParseCIDR(t, "10.1.0.0/24"), tunnel: "office", vnet: "staging", comment: "printers, scanners"},
+	}, rows)
+
+	_, err = parseRoutesCSV(strings.NewReader("10.0.0.0/33,office\n10.0.0.0/8\n10.0.0.0/8,,\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 1: invalid network CIDR 10.0.0.0/33")
+	assert.Contains(t, err.Error(), "line 2: expected network,tunnel,vnet,comment")
+	assert.Contains(t, err.Error(), "line 3: missing tunnel")
+}
+
+func TestPlanRouteImport(t *testing.T) {
+	defaultVnet := uuid.New()
+	stagingVnet := uuid.New()
+	tunnel1 := uuid.New()
+	tunnel2 := uuid.New()
+	existing := []*cfapi.DetailedRoute{
+		{Network: cfapi.CIDR(mustParseCIDR(t, "10.0.0.0/16")), TunnelID: tunnel1, VNetID: &defaultVnet},
+		{Network: cfapi.CIDR(mustParseCIDR(t, "10.1.0.0/16")), TunnelID: tunnel1, VNetID: &defaultVnet},
+		{Network: cfapi.CIDR(mustParseCIDR(t, "10.2.0.0/16")), TunnelID: tunnel1, VNetID: &stagingVnet},
+	}
+	routes := []resolvedRoute{
+		// Unchanged, as the default virtual network
+		{NewRoute: cfapi.NewRoute{Network: mustParseCIDR(t, "10.0.0.0/16"), TunnelID: tunnel1}, line: 1},
+		// Moved to another tunnel
+		{NewRoute: cfapi.NewRoute{Network: mustParseCIDR(t, "10.1.0.0/16"), TunnelID: tunnel2}, line: 2},
+		// Same network in another virtual network
+		{NewRoute: cfapi.NewRoute{Network: mustParseCIDR(t, "10.0.0.0/16"), TunnelID: tunnel2, VNetID: &stagingVnet}, line: 3},
+	}
+
+	plan, err := planRouteImport(routes, existing, defaultVnet, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, plan.unchanged)
+	assert.Empty(t, plan.delete)
+	assert.Equal(t, []routeReplacement{{current: existing[1], route: routes[1]}}, plan.replace)
+	assert.Equal(t, []resolvedRoute{routes[2]}, plan.add)
+
+	plan, err = planRouteImport(routes, existing, defaultVnet, true)
+	require.NoError(t, err)
+	assert.Equal(t, []*cfapi.DetailedRoute{existing[2]}, plan.delete)
+
+	duplicate := append(routes, resolvedRoute{NewRoute: cfapi.NewRoute{Network: mustParseCIDR(t, "10.0.0.0/16"), TunnelID: tunnel2, VNetID: &defaultVnet}, line: 4})
+	_, err = planRouteImport(duplicate, existing, defaultVnet, false)
+	assert.EqualError(t, err, "line 4: network 10.0.0.0/16 is already routed on line 1")
+}
+
+func TestWriteRoutesCSV(t *testing.T) {
+	vnet := uuid.New()
+	tunnelID := uuid.New()
+	routes := []*cfapi.DetailedRoute{
+		{Network: cfapi.CIDR(mustParseCIDR(t, "10.0.0.0/16")), TunnelID: tunnelID, Comment: "office, floor 1"},
+		{Network: cfapi.CIDR(mustParseCIDR(t, "10.2.0.0/16")), TunnelID: tunnelID, VNetID: &vnet},
+	}
+	var output bytes.Buffer
+	require.NoError(t, writeRoutesCSV(&output, routes))
+
+	rows, err := parseRoutesCSV(&output)
+	require.NoError(t, err)
+	assert.Equal(t, []routeRow{
+		{line: 2, network: mustParseCIDR(t, "10.0.0.0/16"), tunnel: tunnelID.String(), comment: "office, floor 1"},
+		{line: 3, network: mustParseCIDR(t, "10.2.0.0/16"), tunnel: tunnelID.String(), vnet: vnet.String()},
+	}, rows)
+}
@@ -38,10 +38,11 @@ then you have to manage the ambiguous IP routes by associating them to virtual n
 See "cloudflared tunnel vnet --help" for more information.`,
 		Subcommands: []*cli.Command{
 			{
-				Name:      "add",
-				Action:    cliutil.ConfiguredAction(addRouteCommand),
-				Usage:     "Add a new network to the routing table reachable via a Tunnel",
-				UsageText: "cloudflared tunnel [--config FILEPATH] route ip add [flags] [CIDR] [TUNNEL] [COMMENT?]",
+				Name:         "add",
+				Action:       cliutil.ConfiguredAction(addRouteCommand),
+				Usage:        "Add a new network to the routing table reachable via a Tunnel",
+				UsageText:    "cloudflared tunnel [--config FILEPATH] route ip add [flags] [CIDR] [TUNNEL] [COMMENT?]",
+				BashComplete: completeArgs(false, noCompletion, tunnelCompletion),
 				Description: `Adds a network IP route space (represented as a CIDR) to your routing table.
 That network IP space becomes reachable for requests egressing from a user's machine
 as long as it is using Cloudflare WARP client and is enrolled in the same account
@@ -85,6 +86,8 @@ and validate your config. Note that if you use virtual networks, then you have
 to tell which virtual network whose routing table you want to use.`,
 				Flags: []cli.Flag{vnetFlag},
 			},
+			buildRouteIPImportSubcommand(),
+			buildRouteIPExportSubcommand(),
 		},
 	}
 }
@@ -92,7 +95,7 @@ to tell which virtual network whose routing table you want to use.`,
 func showRoutesFlags() []cli.Flag {
 	flags := make([]cli.Flag, 0)
 	flags = append(flags, cfapi.IpRouteFilterFlags...)
-	flags = append(flags, outputFormatFlag)
+	flags = append(flags, outputFormatFlag, templateFormatFlag)
 	return flags
 }
 
@@ -115,8 +118,8 @@ func showRoutesCommand(c *cli.Context) error {
 		return err
 	}
 
-	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
-		return renderOutput(outputFormat, routes)
+	if rendered, err := renderOutputFromFlags(c, routes); rendered || err != nil {
+		return err
 	}
 
 	if len(routes) > 0 {
@@ -0,0 +1,297 @@
+package tunnel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+)
+
+var yesFlag = &cli.BoolFlag{
+	Name:    "yes",
+	Aliases: []string{"y"},
+	Usage:   "Don't ask for confirmation.",
+}
+
+func buildVirtualNetworkDefaultSubcommands(hidden bool) []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:         "set-default",
+			Action:       cliutil.ConfiguredAction(setDefaultVirtualNetworkCommand),
+			Usage:        "Make a virtual network the default one, after confirming the routes affected",
+			UsageText:    "cloudflared tunnel [--config FILEPATH] network set-default [flags] VIRTUAL_NETWORK",
+			BashComplete: completeArgs(false, vnetCompletion),
+			Description: `Makes the virtual network (given its ID or name) the default one of the account, in a single
+update that also makes the previous default not be the default anymore. The routes that change
+for clients that don't select a virtual network are shown first (see "cloudflared tunnel vnet diff"),
+and the switch must be confirmed, unless --yes is set. The default is checked after the switch.`,
+			Flags:  []cli.Flag{yesFlag, outputFormatFlag, templateFormatFlag},
+			Hidden: hidden,
+		},
+		{
+			Name:         "diff",
+			Action:       cliutil.ConfiguredAction(diffVirtualNetworkCommand),
+			Usage:        "Show the routes that change if a virtual network becomes the default one",
+			UsageText:    "cloudflared tunnel [--config FILEPATH] network diff [flags] VIRTUAL_NETWORK [OTHER_VIRTUAL_NETWORK]",
+			BashComplete: completeArgs(false, vnetCompletion, vnetCompletion),
+			Description: `Compares the routes of the default virtual network with the routes of the given virtual network,
+or the routes of two given virtual networks: the networks only routed in the first one, only routed in
+the second one, and routed to different tunnels. Clients that don't select a virtual network, and the
+sessions they have open, are affected by the routes that change when the default is switched.`,
+			Flags:  []cli.Flag{outputFormatFlag, templateFormatFlag},
+			Hidden: hidden,
+		},
+	}
+}
+
+// vnetRouteChange is a network routed to different tunnels by two virtual networks
+type vnetRouteChange struct {
+	From *cfapi.DetailedRoute `json:"from" yaml:"from"`
+	To   *cfapi.DetailedRoute `json:"to" yaml:"to"`
+}
+
+// vnetDiff is how the routes of virtual network From differ from the routes of To
+type vnetDiff struct {
+	From    *cfapi.VirtualNetwork  `json:"from" yaml:"from"`
+	To      *cfapi.VirtualNetwork  `json:"to" yaml:"to"`
+	Removed []*cfapi.DetailedRoute `json:"removed" yaml:"removed"`
+	Added   []*cfapi.DetailedRoute `json:"added" yaml:"added"`
+	Changed []vnetRouteChange      `json:"changed" yaml:"changed"`
+}
+
+func (d *vnetDiff) empty() bool {
+	return len(d.Removed) == 0 && len(d.Added) == 0 && len(d.Changed) == 0
+}
+
+// diffVnetRoutes compares the routes of two virtual networks. Routes without a virtual network belong to
+// defaultVnet.
+func diffVnetRoutes(from, to *cfapi.VirtualNetwork, routes []*cfapi.DetailedRoute, defaultVnet uuid.UUID) *vnetDiff {
+	vnetRoutes := func(vnet uuid.UUID) map[string]*cfapi.DetailedRoute {
+		byNetwork := make(map[string]*cfapi.DetailedRoute)
+		for _, route := range routes {
+			routeVnet := defaultVnet
+			if route.VNetID != nil {
+				routeVnet = *route.VNetID
+			}
+			if routeVnet == vnet {
+				byNetwork[route.Network.String()] = route
+			}
+		}
+		return byNetwork
+	}
+	fromRoutes := vnetRoutes(from.ID)
+	toRoutes := vnetRoutes(to.ID)
+
+	diff := &vnetDiff{From: from, To: to}
+	for network, fromRoute := range fromRoutes {
+		toRoute, ok := toRoutes[network]
+		if !ok {
+			diff.Removed = append(diff.Removed, fromRoute)
+		} else if toRoute.TunnelID != fromRoute.TunnelID {
+			diff.Changed = append(diff.Changed, vnetRouteChange{From: fromRoute, To: toRoute})
+		}
+	}
+	for network, toRoute := range toRoutes {
+		if _, ok := fromRoutes[network]; !ok {
+			diff.Added = append(diff.Added, toRoute)
+		}
+	}
+
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Network.String() < diff.Removed[j].Network.String() })
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Network.String() < diff.Added[j].Network.String() })
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].From.Network.String() < diff.Changed[j].From.Network.String()
+	})
+	return diff
+}
+
+// vnetDiffOf compares the routes of the virtual networks given as IDs or names. The first one is the default virtual
+// network if from is empty.
+func vnetDiffOf(sc *subcommandContext, c *cli.Context, from, to string) (*vnetDiff, error) {
+	filter := cfapi.NewVnetFilter()
+	filter.WithDeleted(false)
+	vnets, err := sc.listVirtualNetworks(filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "API error")
+	}
+	var defaultVnet *cfapi.VirtualNetwork
+	for _, vnet := range vnets {
+		if vnet.IsDefault {
+			defaultVnet = vnet
+		}
+	}
+	if defaultVnet == nil {
+		return nil, errors.New("the account has no default virtual network")
+	}
+	find := func(input string) (*cfapi.VirtualNetwork, error) {
+		for _, vnet := range vnets {
+			if vnet.ID.String() == input || vnet.Name == input {
+				return vnet, nil
+			}
+		}
+		return nil, fmt.Errorf("%s is neither the ID nor the name of any of your virtual networks", input)
+	}
+
+	fromVnet := defaultVnet
+	if from != "" {
+		if fromVnet, err = find(from); err != nil {
+			return nil, err
+		}
+	}
+	toVnet, err := find(to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without filter flags, the filter matches all the routes which aren't deleted
+	routeFilter, err := cfapi.NewIpRouteFilterFromCLI(c)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := sc.listAllRoutes(routeFilter)
+	if err != nil {
+		return nil, errors.Wrap(err, "API error")
+	}
+	return diffVnetRoutes(fromVnet, toVnet, routes, defaultVnet.ID), nil
+}
+
+func diffVirtualNetworkCommand(c *cli.Context) error {
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() < 1 || c.NArg() > 2 {
+		return errors.New("You must supply one or two arguments, the ID or name of the virtual networks to compare")
+	}
+
+	from, to := "", c.Args().Get(0)
+	if c.NArg() == 2 {
+		from, to = c.Args().Get(0), c.Args().Get(1)
+	}
+	diff, err := vnetDiffOf(sc, c, from, to)
+	if err != nil {
+		return err
+	}
+
+	if rendered, err := renderOutputFromFlags(c, diff); rendered || err != nil {
+		return err
+	}
+	printVnetDiff(os.Stdout, diff)
+	return nil
+}
+
+func printVnetDiff(writer io.Writer, diff *vnetDiff) {
+	if diff.empty() {
+		_, _ = fmt.Fprintf(writer, "Virtual networks '%s' and '%s' route the same networks to the same tunnels\n", diff.From.Name, diff.To.Name)
+		return
+	}
+	_, _ = fmt.Fprintf(writer, "From virtual network '%s' to '%s':\n", diff.From.Name, diff.To.Name)
+	for _, route := range diff.Removed {
+		_, _ = fmt.Fprintf(writer, "- %s is no longer routed (was tunnel %s)\n", route.Network, route.TunnelID)
+	}
+	for _, route := range diff.Added {
+		_, _ = fmt.Fprintf(writer, "+ %s is routed to tunnel %s\n", route.Network, route.TunnelID)
+	}
+	for _, change := range diff.Changed {
+		_, _ = fmt.Fprintf(writer, "~ %s is routed to tunnel %s instead of %s\n", change.To.Network, change.To.TunnelID, change.From.TunnelID)
+	}
+}
+
+// defaultSwitch is the result of switching the default virtual network
+type defaultSwitch struct {
+	Previous *cfapi.VirtualNetwork `json:"previous" yaml:"previous"`
+	Default  *cfapi.VirtualNetwork `json:"default" yaml:"default"`
+	Diff     *vnetDiff             `json:"diff" yaml:"diff"`
+}
+
+func setDefaultVirtualNetworkCommand(c *cli.Context) error {
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return err
+	}
+	if c.NArg() != 1 {
+		return errors.New("You must supply exactly one argument, either the ID or name of the virtual network to make the default")
+	}
+
+	diff, err := vnetDiffOf(sc, c, "", c.Args().First())
+	if err != nil {
+		return err
+	}
+	if diff.From.ID == diff.To.ID {
+		if rendered, err := renderOutputFromFlags(c, defaultSwitch{Previous: diff.From, Default: diff.To, Diff: diff}); rendered || err != nil {
+			return err
+		}
+		fmt.Printf("Virtual network '%s' is already the default\n", diff.To.Name)
+		return nil
+	}
+
+	if !c.Bool(yesFlag.Name) {
+		// The diff goes to stderr so that only the result is on stdout with --output
+		printVnetDiff(os.Stderr, diff)
+		confirmed, err := confirm(os.Stdin, os.Stderr, fmt.Sprintf("Make '%s' the default virtual network instead of '%s'?", diff.To.Name, diff.From.Name))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return errors.New("The default virtual network was not changed")
+		}
+	}
+
+	// Setting the default unsets the previous default in the same update
+	isDefault := true
+	if err := sc.updateVirtualNetwork(diff.To.ID, cfapi.UpdateVirtualNetwork{IsDefault: &isDefault}); err != nil {
+		return errors.Wrap(err, "API error")
+	}
+
+	filter := cfapi.NewVnetFilter()
+	filter.WithDeleted(false)
+	filter.ByDefaultStatus(true)
+	defaults, err := sc.listVirtualNetworks(filter)
+	if err != nil {
+		return errors.Wrap(err, "API error checking the default virtual network")
+	}
+	if len(defaults) != 1 || defaults[0].ID != diff.To.ID {
+		return fmt.Errorf("the default virtual network should be '%s' but is %s", diff.To.Name, vnetNames(defaults))
+	}
+
+	if rendered, err := renderOutputFromFlags(c, defaultSwitch{Previous: diff.From, Default: defaults[0], Diff: diff}); rendered || err != nil {
+		return err
+	}
+	fmt.Printf("Successfully made '%s' the default virtual network instead of '%s'\n", diff.To.Name, diff.From.Name)
+	return nil
+}
+
+func vnetNames(vnets []*cfapi.VirtualNetwork) string {
+	if len(vnets) == 0 {
+		return "none"
+	}
+	names := make([]string, len(vnets))
+	for i, vnet := range vnets {
+		names[i] = fmt.Sprintf("'%s'", vnet.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// confirm asks a yes/no question, anything but yes is a no
+func confirm(reader io.Reader, writer io.Writer, question string) (bool, error) {
+	_, _ = fmt.Fprintf(writer, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
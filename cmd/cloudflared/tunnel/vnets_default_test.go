@@ -0,0 +1,61 @@
+package tunnel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/cfapi"
+)
+
+func TestDiffVnetRoutes(t *testing.T) {
+	current := &cfapi.VirtualNetwork{ID: uuid.New(), Name: "current", IsDefault: true}
+	next := &cfapi.VirtualNetwork{ID: uuid.New(), Name: "next"}
+	other := uuid.New()
+	tunnel1 := uuid.New()
+	tunnel2 := uuid.New()
+	route := func(cidr string, tunnelID uuid.UUID, vnet *uuid.UUID) *cfapi.DetailedRoute {
+		return &cfapi.DetailedRoute{Network: cfapi.CIDR(mustParseCIDR(t, cidr)), TunnelID: tunnelID, VNetID: vnet}
+	}
+	routes := []*cfapi.DetailedRoute{
+		// Routes without a virtual network are in the default one
+		route("10.0.0.0/16", tunnel1, nil),
+		route("10.1.0.0/16", tunnel1, &current.ID),
+		route("10.2.0.0/16", tunnel1, &current.ID),
+		route("10.1.0.0/16", tunnel1, &next.ID),
+		route("10.2.0.0/16", tunnel2, &next.ID),
+		route("10.3.0.0/16", tunnel2, &next.ID),
+		route("10.4.0.0/16", tunnel2, &other),
+	}
+
+	diff := diffVnetRoutes(current, next, routes, current.ID)
+	assert.Equal(t, []*cfapi.DetailedRoute{routes[0]}, diff.Removed)
+	assert.Equal(t, []*cfapi.DetailedRoute{routes[5]}, diff.Added)
+	assert.Equal(t, []vnetRouteChange{{From: routes[2], To: routes[4]}}, diff.Changed)
+
+	var output bytes.Buffer
+	printVnetDiff(&output, diff)
+	assert.Equal(t, strings.Join([]string{
+		"From virtual network 'current' to 'next':",
+		"- 10.0.0.0/16 is no longer routed (was tunnel " + tunnel1.String() + ")",
+		"+ 10.3.0.0/16 is routed to tunnel " + tunnel2.String(),
+		"~ 10.2.0.0/16 is routed to tunnel " + tunnel2.String() + " instead of " + tunnel1.String(),
+		"",
+	}, "\n"), output.String())
+
+	assert.True(t, diffVnetRoutes(current, current, routes, current.ID).empty())
+}
+
+func TestConfirm(t *testing.T) {
+	for answer, expected := range map[string]bool{"y\n": true, "YES\n": true, "n\n": false, "\n": false, "": false} {
+		var prompt bytes.Buffer
+		confirmed, err := confirm(strings.NewReader(answer), &prompt, "Proceed?")
+		require.NoError(t, err)
+		assert.Equal(t, expected, confirmed, answer)
+		assert.Equal(t, "Proceed? [y/N] ", prompt.String())
+	}
+}
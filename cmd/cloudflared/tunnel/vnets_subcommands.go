@@ -50,7 +50,7 @@ Tunnel 1 and another that points to Tunnel 2) in different Virtual Networks. Tha
 Virtual Network X, they will see Tunnel 1 (via Route A) and not see Tunnel 2 (since its Route B is associated
 to another Virtual Network Y).`,
 		Hidden: hidden,
-		Subcommands: []*cli.Command{
+		Subcommands: append([]*cli.Command{
 			{
 				Name:      "add",
 				Action:    cliutil.ConfiguredAction(addVirtualNetworkCommand),
@@ -76,19 +76,21 @@ be the current default.`,
 				Hidden:      hidden,
 			},
 			{
-				Name:      "delete",
-				Action:    cliutil.ConfiguredAction(deleteVirtualNetworkCommand),
-				Usage:     "Delete a virtual network",
-				UsageText: "cloudflared tunnel [--config FILEPATH] network delete VIRTUAL_NETWORK",
+				Name:         "delete",
+				Action:       cliutil.ConfiguredAction(deleteVirtualNetworkCommand),
+				Usage:        "Delete a virtual network",
+				UsageText:    "cloudflared tunnel [--config FILEPATH] network delete VIRTUAL_NETWORK",
+				BashComplete: completeArgs(false, vnetCompletion),
 				Description: `Deletes the virtual network (given its ID or name). This is only possible if that virtual network is unused. 
 A virtual network may be used by IP routes or by WARP devices.`,
 				Hidden: hidden,
 			},
 			{
-				Name:      "update",
-				Action:    cliutil.ConfiguredAction(updateVirtualNetworkCommand),
-				Usage:     "Update a virtual network",
-				UsageText: "cloudflared tunnel [--config FILEPATH] network update [flags] VIRTUAL_NETWORK",
+				Name:         "update",
+				Action:       cliutil.ConfiguredAction(updateVirtualNetworkCommand),
+				Usage:        "Update a virtual network",
+				UsageText:    "cloudflared tunnel [--config FILEPATH] network update [flags] VIRTUAL_NETWORK",
+				BashComplete: completeArgs(false, vnetCompletion),
 				Description: `Updates the virtual network (given its ID or name). If this virtual network is updated to become the new
 default, then the previously existing default virtual network will also be modified to no longer be the default.
 You cannot update a virtual network to not be the default anymore directly. Instead, you should create a new
@@ -96,14 +98,14 @@ default or update an existing one to become the default.`,
 				Flags:  []cli.Flag{newNameFlag, newCommentFlag, makeDefaultFlag},
 				Hidden: hidden,
 			},
-		},
+		}, buildVirtualNetworkDefaultSubcommands(hidden)...),
 	}
 }
 
 func listVirtualNetworksFlags() []cli.Flag {
 	flags := make([]cli.Flag, 0)
 	flags = append(flags, cfapi.VnetFilterFlags...)
-	flags = append(flags, outputFormatFlag)
+	flags = append(flags, outputFormatFlag, templateFormatFlag)
 	return flags
 }
 
@@ -170,8 +172,8 @@ func listVirtualNetworksCommand(c *cli.Context) error {
 		return err
 	}
 
-	if outputFormat := c.String(outputFormatFlag.Name); outputFormat != "" {
-		return renderOutput(outputFormat, vnets)
+	if rendered, err := renderOutputFromFlags(c, vnets); rendered || err != nil {
+		return err
 	}
 
 	if len(vnets) > 0 {
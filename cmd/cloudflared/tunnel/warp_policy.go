@@ -0,0 +1,36 @@
+package tunnel
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/cloudflare/cloudflared/l4policy"
+)
+
+const warpRoutingPolicyFlag = "warp-routing-policy"
+
+func configureWarpRoutingPolicyFlags(shouldHide bool) []cli.Flag {
+	return []cli.Flag{
+		altsrc.NewPathFlag(&cli.PathFlag{
+			Name:    warpRoutingPolicyFlag,
+			Usage:   "Allow or deny the private network traffic of WARP clients by destination, port and protocol with the rules of this YAML `FILE`, reloaded when it changes.",
+			EnvVars: []string{"TUNNEL_WARP_ROUTING_POLICY"},
+			Hidden:  shouldHide,
+		}),
+	}
+}
+
+// warpRoutingPolicy loads the warp-routing policy file, if any
+func warpRoutingPolicy(c *cli.Context, log *zerolog.Logger) (*l4policy.Engine, error) {
+	path := c.Path(warpRoutingPolicyFlag)
+	if path == "" {
+		return nil, nil
+	}
+	policy, err := l4policy.NewEngine(path, log)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("path", path).Msg("Filtering warp-routing traffic with a policy")
+	return policy, nil
+}
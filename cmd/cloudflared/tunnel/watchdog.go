@@ -0,0 +1,89 @@
+package tunnel
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/cloudflare/cloudflared/runtimelimits"
+	"github.com/cloudflare/cloudflared/watchdog"
+)
+
+const (
+	watchdogDirFlag             = "watchdog-dir"
+	watchdogStallThresholdFlag  = "watchdog-stall-threshold"
+	watchdogMemoryThresholdFlag = "watchdog-memory-threshold"
+	watchdogMaxDumpsFlag        = "watchdog-max-dumps"
+)
+
+func configureWatchdogFlags(shouldHide bool) []cli.Flag {
+	return []cli.Flag{
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    watchdogDirFlag,
+			Usage:   "Enables the watchdog, which writes a goroutine dump and a heap profile to a new directory in `DIR` when the supervisor or a connection of cloudflared stalls, or it uses more memory than the memory threshold.",
+			EnvVars: []string{"TUNNEL_WATCHDOG_DIR"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:    watchdogStallThresholdFlag,
+			Usage:   "How long the supervisor or a connection of cloudflared has to stall for the watchdog to write a dump, 0 to only watch the memory. Time while the host is suspended or the VM is paused isn't a stall.",
+			Value:   time.Second * 10,
+			EnvVars: []string{"TUNNEL_WATCHDOG_STALL_THRESHOLD"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:    watchdogMemoryThresholdFlag,
+			Usage:   "Memory cloudflared has to use for the watchdog to write a dump, e.g. 512MiB. By default it's the soft memory limit of the Go runtime, if there's one.",
+			EnvVars: []string{"TUNNEL_WATCHDOG_MEMORY_THRESHOLD"},
+			Hidden:  shouldHide,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:    watchdogMaxDumpsFlag,
+			Usage:   "Number of dumps the watchdog keeps, the oldest are removed.",
+			Value:   5,
+			EnvVars: []string{"TUNNEL_WATCHDOG_MAX_DUMPS"},
+			Hidden:  shouldHide,
+		}),
+	}
+}
+
+// newWatchdog returns the watchdog of the flags, or nil if it isn't enabled. It has to be called after the runtime
+// limits are set, since the memory threshold defaults to the soft memory limit.
+func newWatchdog(c *cli.Context, log *zerolog.Logger) (*watchdog.Watchdog, error) {
+	dir := c.String(watchdogDirFlag)
+	if dir == "" {
+		return nil, nil
+	}
+	var memoryThreshold int64
+	if c.IsSet(watchdogMemoryThresholdFlag) {
+		var err error
+		if memoryThreshold, err = runtimelimits.ParseMemoryLimit(c.String(watchdogMemoryThresholdFlag)); err != nil {
+			return nil, err
+		}
+	} else if limit := runtimelimits.MemoryLimit(); limit != math.MaxInt64 {
+		memoryThreshold = limit
+	}
+	maxDumps := c.Int(watchdogMaxDumpsFlag)
+	if maxDumps < 1 {
+		return nil, fmt.Errorf("%s must be at least 1", watchdogMaxDumpsFlag)
+	}
+	wd, err := watchdog.New(watchdog.Config{
+		Dir:             dir,
+		StallThreshold:  c.Duration(watchdogStallThresholdFlag),
+		MemoryThreshold: uint64(memoryThreshold),
+		MaxDumps:        maxDumps,
+	}, log)
+	if err != nil {
+		return nil, err
+	}
+	event := log.Info().Str("dir", dir).Dur("stallThreshold", c.Duration(watchdogStallThresholdFlag))
+	if memoryThreshold > 0 {
+		event = event.Int64("memoryThreshold", memoryThreshold)
+	}
+	event.Msg("Watchdog enabled")
+	return wd, nil
+}
@@ -0,0 +1,19 @@
+package updater
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var signatureVerifications = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "cloudflared",
+		Subsystem: "update",
+		Name:      "signature_verifications_total",
+		Help:      "Number of verifications of the signature of downloaded updates, by result: valid, invalid, missing, or skipped when no public key is trusted",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(signatureVerifications)
+}
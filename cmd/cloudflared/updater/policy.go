@@ -0,0 +1,122 @@
+package updater
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ChannelStable = "stable"
+	ChannelBeta   = "beta"
+)
+
+// UpdatePolicy stages the automatic updates of a fleet of cloudflared, so that a new version doesn't reach every
+// instance at once
+type UpdatePolicy struct {
+	// Channel is the release channel to update from, ChannelStable or ChannelBeta
+	Channel string
+	// RolloutPercentage is the percentage of the instances updated to a new version, the others hold it back until
+	// the percentage is raised. An instance is in the rollout of a version depending on its hostname and the version,
+	// so that the same instances aren't always the first to update.
+	RolloutPercentage int
+	// Window restricts updates to a daily period of local time if it's not nil
+	Window *UpdateWindow
+	// RollbackGracePeriod is the time a new version has to connect to the edge before the previous binary is
+	// restored. Updates aren't rolled back if it's 0.
+	RollbackGracePeriod time.Duration
+}
+
+// DefaultUpdatePolicy updates every instance from the stable channel at any time
+var DefaultUpdatePolicy = UpdatePolicy{Channel: ChannelStable, RolloutPercentage: 100}
+
+func (p UpdatePolicy) Validate() error {
+	if p.Channel != ChannelStable && p.Channel != ChannelBeta {
+		return fmt.Errorf("unknown release channel %q, expected %s or %s", p.Channel, ChannelStable, ChannelBeta)
+	}
+	if p.RolloutPercentage < 0 || p.RolloutPercentage > 100 {
+		return fmt.Errorf("rollout percentage must be between 0 and 100")
+	}
+	if p.RollbackGracePeriod < 0 {
+		return fmt.Errorf("rollback grace period must not be negative")
+	}
+	return nil
+}
+
+// UpdateWindow is a daily period of local time, which wraps around midnight if it ends before it starts
+type UpdateWindow struct {
+	// start and end are the times since midnight
+	start time.Duration
+	end   time.Duration
+}
+
+// ParseUpdateWindow parses a window in the HH:MM-HH:MM format, e.g. 02:00-04:00
+func ParseUpdateWindow(s string) (*UpdateWindow, error) {
+	startStr, endStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid update window %q, expected HH:MM-HH:MM", s)
+	}
+	start, err := parseTimeOfDay(startStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid update window %q: %w", s, err)
+	}
+	end, err := parseTimeOfDay(endStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid update window %q: %w", s, err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid update window %q: it's empty", s)
+	}
+	return &UpdateWindow{start: start, end: end}, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a time of day", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains returns whether t is in the window, in its location
+func (w *UpdateWindow) Contains(t time.Time) bool {
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	if w.start < w.end {
+		return sinceMidnight >= w.start && sinceMidnight < w.end
+	}
+	return sinceMidnight >= w.start || sinceMidnight < w.end
+}
+
+func (w *UpdateWindow) String() string {
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+	return format(w.start) + "-" + format(w.end)
+}
+
+// inRollout returns whether the instance with hostname is in the first percentage of the instances updated to version
+func inRollout(hostname, version string, percentage int) bool {
+	if percentage >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(hostname))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(version))
+	return int(h.Sum32()%100) < percentage
+}
+
+// isHeldBack returns whether the update to version is held back by the policy at now
+func (p UpdatePolicy) isHeldBack(version, targetPath string) (bool, string) {
+	if rolledBack := readRolledBackVersion(targetPath); rolledBack != "" && rolledBack == version {
+		return true, fmt.Sprintf("version %s was rolled back, it's skipped", version)
+	}
+	hostname, _ := os.Hostname()
+	if !inRollout(hostname, version, p.RolloutPercentage) {
+		return true, fmt.Sprintf("version %s is held back, this instance isn't in its rollout of %d%%", version, p.RolloutPercentage)
+	}
+	return false, ""
+}
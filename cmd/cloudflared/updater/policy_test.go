@@ -0,0 +1,65 @@
+package updater
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2022, 6, 1, hour, minute, 0, 0, time.Local)
+	}
+	window, err := ParseUpdateWindow("02:00-04:00")
+	require.NoError(t, err)
+	assert.Equal(t, "02:00-04:00", window.String())
+	assert.False(t, window.Contains(at(1, 59)))
+	assert.True(t, window.Contains(at(2, 0)))
+	assert.True(t, window.Contains(at(3, 59)))
+	assert.False(t, window.Contains(at(4, 0)))
+
+	// Windows ending before they start wrap around midnight
+	window, err = ParseUpdateWindow("23:30-01:00")
+	require.NoError(t, err)
+	assert.True(t, window.Contains(at(23, 45)))
+	assert.True(t, window.Contains(at(0, 30)))
+	assert.False(t, window.Contains(at(1, 0)))
+	assert.False(t, window.Contains(at(12, 0)))
+
+	for _, invalid := range []string{"", "02:00", "02:00-", "2am-4am", "02:00-24:00", "02:00-02:00"} {
+		_, err := ParseUpdateWindow(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestInRollout(t *testing.T) {
+	const instances = 1000
+	for _, percentage := range []int{0, 10, 50, 100} {
+		updated := 0
+		for i := 0; i < instances; i++ {
+			if inRollout(fmt.Sprintf("host-%d", i), "2022.6.0", percentage) {
+				updated++
+			}
+		}
+		assert.InDelta(t, percentage*instances/100, updated, instances/20, "percentage=%d", percentage)
+	}
+
+	// Instances in the rollout of a version are still in it when the percentage is raised
+	for i := 0; i < instances; i++ {
+		hostname := fmt.Sprintf("host-%d", i)
+		if inRollout(hostname, "2022.6.0", 10) {
+			assert.True(t, inRollout(hostname, "2022.6.0", 20), hostname)
+		}
+	}
+}
+
+func TestUpdatePolicyValidate(t *testing.T) {
+	require.NoError(t, DefaultUpdatePolicy.Validate())
+	require.NoError(t, UpdatePolicy{Channel: ChannelBeta, RolloutPercentage: 0}.Validate())
+	require.Error(t, UpdatePolicy{Channel: "nightly", RolloutPercentage: 100}.Validate())
+	require.Error(t, UpdatePolicy{Channel: ChannelStable, RolloutPercentage: 101}.Validate())
+	require.Error(t, UpdatePolicy{Channel: ChannelStable, RolloutPercentage: 100, RollbackGracePeriod: -time.Second}.Validate())
+}
@@ -0,0 +1,93 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// statusRolledBack implements ExitCoder interface, the app will exit with status code 11 to be restarted with the
+// previous binary
+type statusRolledBack struct {
+	version string
+}
+
+func (r *statusRolledBack) Error() string {
+	return fmt.Sprintf("cloudflared %s didn't connect to the edge, the previous version was restored", r.version)
+}
+
+func (r *statusRolledBack) ExitCode() int {
+	return 11
+}
+
+// previousPath is where an update keeps the previous binary until the new version connects to the edge
+func previousPath(targetPath string) string {
+	return targetPath + ".old"
+}
+
+// rolledBackPath records the version that was rolled back, so that it isn't updated to again
+func rolledBackPath(targetPath string) string {
+	return targetPath + ".rolledback"
+}
+
+func readRolledBackVersion(targetPath string) string {
+	content, err := os.ReadFile(rolledBackPath(targetPath))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// WatchUpdate confirms the update to the running version once connectedC is closed, by removing the previous binary
+// kept by the update. If cloudflared doesn't connect to the edge within gracePeriod, the previous binary is restored
+// and an error is returned so that cloudflared exits and is restarted by its service manager. It returns nil right
+// away if cloudflared wasn't just updated.
+func WatchUpdate(ctx context.Context, connectedC <-chan struct{}, gracePeriod time.Duration, log *zerolog.Logger) error {
+	targetPath, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	return watchUpdate(ctx, targetPath, connectedC, gracePeriod, log)
+}
+
+func watchUpdate(ctx context.Context, targetPath string, connectedC <-chan struct{}, gracePeriod time.Duration, log *zerolog.Logger) error {
+	previous := previousPath(targetPath)
+	if _, err := os.Stat(previous); err != nil {
+		return nil
+	}
+	if gracePeriod <= 0 {
+		_ = os.Remove(previous)
+		return nil
+	}
+
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// Shutting down before connecting, the update is watched again on the next start
+		return nil
+	case <-connectedC:
+		if err := os.Remove(previous); err != nil {
+			log.Err(err).Msg("Failed to remove the previous cloudflared binary")
+		}
+		_ = os.Remove(rolledBackPath(targetPath))
+		log.Info().Str(LogFieldVersion, version).Msg("Update confirmed, cloudflared connected to the edge")
+		return nil
+	case <-timer.C:
+	}
+
+	log.Error().Str(LogFieldVersion, version).Dur("gracePeriod", gracePeriod).
+		Msg("cloudflared didn't connect to the edge after the update, rolling back to the previous version")
+	if err := os.Rename(previous, targetPath); err != nil {
+		log.Err(err).Msg("Failed to restore the previous cloudflared binary")
+		return nil
+	}
+	if err := os.WriteFile(rolledBackPath(targetPath), []byte(version), 0644); err != nil {
+		log.Err(err).Msg("Failed to record the rolled back version, it may be updated to again")
+	}
+	return &statusRolledBack{version: version}
+}
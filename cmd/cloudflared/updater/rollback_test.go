@@ -0,0 +1,61 @@
+package updater
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeUpdatedBinaries writes the binary of the new version and the previous binary kept by the update
+func writeUpdatedBinaries(t *testing.T) string {
+	targetPath := filepath.Join(t.TempDir(), "cloudflared")
+	require.NoError(t, os.WriteFile(targetPath, []byte("new"), 0755))
+	require.NoError(t, os.WriteFile(previousPath(targetPath), []byte("previous"), 0755))
+	return targetPath
+}
+
+func TestWatchUpdateConfirmed(t *testing.T) {
+	log := zerolog.Nop()
+	targetPath := writeUpdatedBinaries(t)
+	connectedC := make(chan struct{})
+	close(connectedC)
+
+	require.NoError(t, watchUpdate(context.Background(), targetPath, connectedC, time.Minute, &log))
+	content, err := os.ReadFile(targetPath)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+	assert.NoFileExists(t, previousPath(targetPath))
+}
+
+func TestWatchUpdateRolledBack(t *testing.T) {
+	log := zerolog.Nop()
+	targetPath := writeUpdatedBinaries(t)
+	Init("2022.6.0")
+	defer Init("")
+
+	err := watchUpdate(context.Background(), targetPath, make(chan struct{}), 10*time.Millisecond, &log)
+	require.Error(t, err)
+	assert.Equal(t, 11, err.(*statusRolledBack).ExitCode())
+	content, err := os.ReadFile(targetPath)
+	require.NoError(t, err)
+	assert.Equal(t, "previous", string(content))
+	assert.NoFileExists(t, previousPath(targetPath))
+
+	// The version that was rolled back is held back
+	heldBack, _ := DefaultUpdatePolicy.isHeldBack("2022.6.0", targetPath)
+	assert.True(t, heldBack)
+	heldBack, _ = DefaultUpdatePolicy.isHeldBack("2022.6.1", targetPath)
+	assert.False(t, heldBack)
+}
+
+func TestWatchUpdateNotUpdated(t *testing.T) {
+	log := zerolog.Nop()
+	targetPath := filepath.Join(t.TempDir(), "cloudflared")
+	require.NoError(t, watchUpdate(context.Background(), targetPath, make(chan struct{}), time.Millisecond, &log))
+}
@@ -0,0 +1,73 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// UpdatePublicKeys are the base64 encoded ed25519 public keys trusted to sign the binaries of updates, separated by
+// commas. It's set from UPDATE_PUBLIC_KEYS when building release binaries. If it's empty, the signature of updates
+// isn't verified.
+var UpdatePublicKeys = ""
+
+// Results of the verification of the signature of an update
+const (
+	signatureValid   = "valid"
+	signatureInvalid = "invalid"
+	signatureMissing = "missing"
+	// signatureSkipped is the result when no public key is trusted
+	signatureSkipped = "skipped"
+)
+
+// signedMessage is the message signed for the binary of version with SHA-256 digest. The version is signed too, so
+// that the binary of a version can't be served as another one.
+func signedMessage(version string, digest []byte) []byte {
+	return []byte(fmt.Sprintf("cloudflared %s sha256:%s", version, hex.EncodeToString(digest)))
+}
+
+// verifySignature verifies the base64 encoded signature of the binary of version with digest, by one of publicKeys,
+// and returns the result of the verification. Only invalid signatures are errors: updates without a signature, or
+// without a public key to verify it, are applied as long as the update service doesn't sign every update.
+func verifySignature(publicKeys, version string, digest []byte, signature string) (string, error) {
+	keys, err := parsePublicKeys(publicKeys)
+	if err != nil {
+		return signatureInvalid, err
+	}
+	if len(keys) == 0 {
+		return signatureSkipped, nil
+	}
+	if signature == "" {
+		return signatureMissing, nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return signatureInvalid, fmt.Errorf("invalid update signature: %w", err)
+	}
+	message := signedMessage(version, digest)
+	for _, key := range keys {
+		if ed25519.Verify(key, message, sig) {
+			return signatureValid, nil
+		}
+	}
+	return signatureInvalid, errors.New("signature validation failed")
+}
+
+func parsePublicKeys(publicKeys string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, encoded := range strings.Split(publicKeys, ",") {
+		encoded = strings.TrimSpace(encoded)
+		if encoded == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid update public key %q", encoded)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,101 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherPublicKey, otherPrivateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	trustedKeys := base64.StdEncoding.EncodeToString(otherPublicKey) + "," + base64.StdEncoding.EncodeToString(publicKey)
+
+	digest := sha256.Sum256([]byte("cloudflared binary"))
+	sign := func(key ed25519.PrivateKey, version string, digest []byte) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(key, signedMessage(version, digest)))
+	}
+	untrustedKey := func() ed25519.PrivateKey {
+		_, key, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+		return key
+	}()
+	otherDigest := sha256.Sum256([]byte("other binary"))
+
+	tests := []struct {
+		name           string
+		publicKeys     string
+		signature      string
+		expectedResult string
+	}{
+		{
+			name:           "valid",
+			publicKeys:     trustedKeys,
+			signature:      sign(privateKey, "2022.6.0", digest[:]),
+			expectedResult: signatureValid,
+		},
+		{
+			name:           "valid with another trusted key",
+			publicKeys:     trustedKeys,
+			signature:      sign(otherPrivateKey, "2022.6.0", digest[:]),
+			expectedResult: signatureValid,
+		},
+		{
+			name:           "untrusted key",
+			publicKeys:     trustedKeys,
+			signature:      sign(untrustedKey, "2022.6.0", digest[:]),
+			expectedResult: signatureInvalid,
+		},
+		{
+			name:           "other version",
+			publicKeys:     trustedKeys,
+			signature:      sign(privateKey, "2022.5.0", digest[:]),
+			expectedResult: signatureInvalid,
+		},
+		{
+			name:           "other binary",
+			publicKeys:     trustedKeys,
+			signature:      sign(privateKey, "2022.6.0", otherDigest[:]),
+			expectedResult: signatureInvalid,
+		},
+		{
+			name:           "not base64",
+			publicKeys:     trustedKeys,
+			signature:      "not base64!",
+			expectedResult: signatureInvalid,
+		},
+		{
+			name:           "missing",
+			publicKeys:     trustedKeys,
+			expectedResult: signatureMissing,
+		},
+		{
+			name:           "no trusted key",
+			signature:      sign(untrustedKey, "2022.6.0", digest[:]),
+			expectedResult: signatureSkipped,
+		},
+		{
+			name:           "invalid trusted key",
+			publicKeys:     "aW52YWxpZA==",
+			signature:      sign(privateKey, "2022.6.0", digest[:]),
+			expectedResult: signatureInvalid,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := verifySignature(test.publicKeys, "2022.6.0", digest[:], test.signature)
+			assert.Equal(t, test.expectedResult, result)
+			if result == signatureInvalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
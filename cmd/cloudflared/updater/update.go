@@ -67,6 +67,10 @@ type updateOptions struct {
 	isStaging       bool
 	isForced        bool
 	intendedVersion string
+	// keepPrevious keeps the previous binary, to roll back the update if the new version doesn't connect
+	keepPrevious bool
+	// isHeldBack returns whether the update to a version is held back, and why
+	isHeldBack func(version string) (bool, string)
 }
 
 type UpdateOutcome struct {
@@ -74,6 +78,13 @@ type UpdateOutcome struct {
 	Version     string
 	UserMessage string
 	Error       error
+	// Signature is the result of the verification of the signature of the update, once applied
+	Signature string
+}
+
+// signatureVerifier is implemented by the CheckResult verifying the signature of updates
+type signatureVerifier interface {
+	signatureVerification() string
 }
 
 func (uo *UpdateOutcome) noUpdate() bool {
@@ -96,7 +107,7 @@ func CheckForUpdate(options updateOptions) (CheckResult, error) {
 	}
 
 	s := NewWorkersService(version, url, cfdPath, Options{IsBeta: options.isBeta,
-		IsForced: options.isForced, RequestedVersion: options.intendedVersion})
+		IsForced: options.isForced, RequestedVersion: options.intendedVersion, KeepPrevious: options.keepPrevious})
 
 	return s.Check()
 }
@@ -111,7 +122,11 @@ func applyUpdate(options updateOptions, update CheckResult) UpdateOutcome {
 		return UpdateOutcome{Error: err}
 	}
 
-	return UpdateOutcome{Updated: true, Version: update.Version(), UserMessage: update.UserMessage()}
+	outcome := UpdateOutcome{Updated: true, Version: update.Version(), UserMessage: update.UserMessage()}
+	if verifier, ok := update.(signatureVerifier); ok {
+		outcome.Signature = verifier.signatureVerification()
+	}
+	return outcome
 }
 
 // Update is the handler for the update command from the command line
@@ -169,9 +184,21 @@ func loggedUpdate(log *zerolog.Logger, options updateOptions) UpdateOutcome {
 		return UpdateOutcome{Error: err}
 	}
 
+	if newVersion := checkResult.Version(); newVersion != "" && !options.updateDisabled && options.isHeldBack != nil {
+		if heldBack, reason := options.isHeldBack(newVersion); heldBack {
+			log.Info().Str(LogFieldVersion, newVersion).Msg(reason)
+			options.updateDisabled = true
+		}
+	}
 	updateOutcome := applyUpdate(options, checkResult)
 	if updateOutcome.Updated {
-		log.Info().Str(LogFieldVersion, updateOutcome.Version).Msg("cloudflared has been updated")
+		log.Info().Str(LogFieldVersion, updateOutcome.Version).Str("signature", updateOutcome.Signature).Msg("cloudflared has been updated")
+		switch updateOutcome.Signature {
+		case signatureSkipped:
+			log.Warn().Str(LogFieldVersion, updateOutcome.Version).Msg("The signature of the update wasn't verified as this build of cloudflared trusts no public key")
+		case signatureMissing:
+			log.Warn().Str(LogFieldVersion, updateOutcome.Version).Msg("The update wasn't signed by the update service")
+		}
 	}
 	if updateOutcome.Error != nil {
 		log.Err(updateOutcome.Error).Msg("update failed to apply")
@@ -183,6 +210,7 @@ func loggedUpdate(log *zerolog.Logger, options updateOptions) UpdateOutcome {
 // AutoUpdater periodically checks for new version of cloudflared.
 type AutoUpdater struct {
 	configurable     *configurable
+	policy           UpdatePolicy
 	listeners        *gracenet.Net
 	updateConfigChan chan *configurable
 	log              *zerolog.Logger
@@ -194,9 +222,10 @@ type configurable struct {
 	freq    time.Duration
 }
 
-func NewAutoUpdater(updateDisabled bool, freq time.Duration, listeners *gracenet.Net, log *zerolog.Logger) *AutoUpdater {
+func NewAutoUpdater(updateDisabled bool, freq time.Duration, policy UpdatePolicy, listeners *gracenet.Net, log *zerolog.Logger) *AutoUpdater {
 	return &AutoUpdater{
 		configurable:     createUpdateConfig(updateDisabled, freq, log),
+		policy:           policy,
 		listeners:        listeners,
 		updateConfigChan: make(chan *configurable),
 		log:              log,
@@ -221,7 +250,7 @@ func createUpdateConfig(updateDisabled bool, freq time.Duration, log *zerolog.Lo
 func (a *AutoUpdater) Run(ctx context.Context) error {
 	ticker := time.NewTicker(a.configurable.freq)
 	for {
-		updateOutcome := loggedUpdate(a.log, updateOptions{updateDisabled: !a.configurable.enabled})
+		updateOutcome := loggedUpdate(a.log, a.updateOptions(time.Now()))
 		if updateOutcome.Updated {
 			Init(updateOutcome.Version)
 			if IsSysV() {
@@ -254,6 +283,29 @@ func (a *AutoUpdater) Run(ctx context.Context) error {
 	}
 }
 
+// updateOptions are the options of an automatic update at now, following the update policy
+func (a *AutoUpdater) updateOptions(now time.Time) updateOptions {
+	options := updateOptions{
+		updateDisabled: !a.configurable.enabled,
+		isBeta:         a.policy.Channel == ChannelBeta,
+		keepPrevious:   a.policy.RollbackGracePeriod > 0,
+	}
+	if options.updateDisabled {
+		return options
+	}
+	if window := a.policy.Window; window != nil && !window.Contains(now) {
+		a.log.Debug().Msgf("Outside of the update window %s, updates aren't applied", window)
+		options.updateDisabled = true
+		return options
+	}
+	if targetPath, err := os.Executable(); err == nil {
+		options.isHeldBack = func(version string) (bool, string) {
+			return a.policy.isHeldBack(version, targetPath)
+		}
+	}
+	return options
+}
+
 // Update is the method to pass new AutoUpdaterConfigurable to a running AutoUpdater. It is safe to be called concurrently
 func (a *AutoUpdater) Update(updateDisabled bool, newFreq time.Duration) {
 	a.updateConfigChan <- createUpdateConfig(updateDisabled, newFreq, a.log)
@@ -14,7 +14,7 @@ import (
 func TestDisabledAutoUpdater(t *testing.T) {
 	listeners := &gracenet.Net{}
 	log := zerolog.Nop()
-	autoupdater := NewAutoUpdater(false, 0, listeners, &log)
+	autoupdater := NewAutoUpdater(false, 0, DefaultUpdatePolicy, listeners, &log)
 	ctx, cancel := context.WithCancel(context.Background())
 	errC := make(chan error)
 	go func() {
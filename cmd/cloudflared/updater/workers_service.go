@@ -17,13 +17,19 @@ type Options struct {
 
 	// RequestedVersion is the specific version to upgrade or downgrade to
 	RequestedVersion string
+
+	// KeepPrevious keeps the previous binary after updating, to roll back the update
+	KeepPrevious bool
 }
 
 // VersionResponse is the JSON response from the Workers API endpoint
 type VersionResponse struct {
-	URL          string `json:"url"`
-	Version      string `json:"version"`
-	Checksum     string `json:"checksum"`
+	URL      string `json:"url"`
+	Version  string `json:"version"`
+	Checksum string `json:"checksum"`
+	// Signature is the base64 encoded ed25519 signature of signedMessage, for the version and the SHA-256 digest of
+	// the binary
+	Signature    string `json:"signature"`
 	IsCompressed bool   `json:"compressed"`
 	UserMessage  string `json:"userMessage"`
 	ShouldUpdate bool   `json:"shouldUpdate"`
@@ -90,5 +96,8 @@ func (s *WorkersService) Check() (CheckResult, error) {
 		versionToUpdate = v.Version
 	}
 
-	return NewWorkersVersion(v.URL, versionToUpdate, v.Checksum, s.targetPath, v.UserMessage, v.IsCompressed), nil
+	result := newWorkersVersion(v.URL, versionToUpdate, v.Checksum, s.targetPath, v.UserMessage, v.IsCompressed)
+	result.keepPrevious = s.opts.KeepPrevious
+	result.signature = v.Signature
+	return result, nil
 }
@@ -55,6 +55,11 @@ type WorkersVersion struct {
 	targetPath   string
 	isCompressed bool
 	userMessage  string
+	// keepPrevious keeps the previous binary at previousPath, to roll back the update
+	keepPrevious bool
+	// signature is the base64 encoded signature of the binary, verified with UpdatePublicKeys
+	signature       string
+	signatureResult string
 }
 
 // NewWorkersVersion creates a new Version object. This is normally created by a WorkersService JSON checkin response
@@ -65,6 +70,10 @@ type WorkersVersion struct {
 // userMessage is a possible message to convey back to the user after having checked in with the Updater Service
 // isCompressed tells whether the asset to update cloudflared is compressed or not
 func NewWorkersVersion(url, version, checksum, targetPath, userMessage string, isCompressed bool) CheckResult {
+	return newWorkersVersion(url, version, checksum, targetPath, userMessage, isCompressed)
+}
+
+func newWorkersVersion(url, version, checksum, targetPath, userMessage string, isCompressed bool) *WorkersVersion {
 	return &WorkersVersion{
 		downloadURL:  url,
 		version:      version,
@@ -88,11 +97,22 @@ func (v *WorkersVersion) Apply() error {
 	}
 
 	// check that the file is what is expected
-	if err := isValidChecksum(v.checksum, newFilePath); err != nil {
+	digest, err := fileDigest(newFilePath)
+	if err != nil {
+		return err
+	}
+	if err := isValidChecksum(v.checksum, digest); err != nil {
+		os.Remove(newFilePath)
+		return err
+	}
+	v.signatureResult, err = verifySignature(UpdatePublicKeys, v.version, digest, v.signature)
+	signatureVerifications.WithLabelValues(v.signatureResult).Inc()
+	if err != nil {
+		os.Remove(newFilePath)
 		return err
 	}
 
-	oldFilePath := fmt.Sprintf("%s.old", v.targetPath)
+	oldFilePath := previousPath(v.targetPath)
 	// Windows requires more effort to self update, especially when it is running as a service:
 	// you have to stop the service (if running as one) in order to move/rename the binary
 	// but now the binary isn't running though, so an external process
@@ -118,11 +138,18 @@ func (v *WorkersVersion) Apply() error {
 		os.Rename(oldFilePath, v.targetPath)
 		return err
 	}
-	os.Remove(oldFilePath)
+	if !v.keepPrevious {
+		os.Remove(oldFilePath)
+	}
 
 	return nil
 }
 
+// signatureVerification returns the result of the verification of the signature of the binary, once applied
+func (v *WorkersVersion) signatureVerification() string {
+	return v.signatureResult
+}
+
 // String returns the version number of this update/release (e.g. 2020.08.05)
 func (v *WorkersVersion) Version() string {
 	return v.version
@@ -190,20 +217,24 @@ func isCompressedFile(urlstring string) bool {
 	return strings.HasSuffix(u.Path, ".tgz")
 }
 
-// checks if the checksum in the json response matches the checksum of the file download
-func isValidChecksum(checksum, filePath string) error {
+// fileDigest returns the SHA-256 digest of the file at filePath
+func fileDigest(filePath string) ([]byte, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer f.Close()
 
 	h := sha256.New()
 	if _, err := io.Copy(h, f); err != nil {
-		return err
+		return nil, err
 	}
+	return h.Sum(nil), nil
+}
 
-	hash := fmt.Sprintf("%x", h.Sum(nil))
+// checks if the checksum in the json response matches the digest of the file download
+func isValidChecksum(checksum string, digest []byte) error {
+	hash := fmt.Sprintf("%x", digest)
 
 	if checksum != hash {
 		return errors.New("checksum validation failed")
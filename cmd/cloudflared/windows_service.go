@@ -16,11 +16,13 @@ import (
 	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/eventlog"
 	"golang.org/x/sys/windows/svc/mgr"
 
 	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/tunnel"
 	"github.com/cloudflare/cloudflared/logger"
 )
 
@@ -41,6 +43,21 @@ const (
 	serviceControllerConnectionFailure = 1063
 
 	LogFieldWindowsServiceName = "windowsServiceName"
+
+	// Flags of service install customizing the recovery of the service
+	recoveryDelayFlag      = "recovery-delay"
+	failureResetPeriodFlag = "failure-reset-period"
+	noRecoveryFlag         = "no-recovery"
+
+	// serviceAcceptedControls are the controls accepted by the service: stop and shutdown gracefully shutdown the
+	// tunnel, pre-shutdown lets it drain its connections before the system shuts down, and paramchange reloads the
+	// ingress rules of the configuration file
+	serviceAcceptedControls = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPreShutdown | svc.AcceptParamChange
+	// drainStatusInterval is the interval at which the progress of the graceful shutdown is reported
+	drainStatusInterval = time.Second
+	// drainWaitHint is the time the service control manager waits for the next progress report before considering
+	// the service hung
+	drainWaitHint = 5 * time.Second
 )
 
 func runApp(app *cli.App, graceShutdownC chan struct{}) {
@@ -52,6 +69,23 @@ func runApp(app *cli.App, graceShutdownC chan struct{}) {
 				Name:   "install",
 				Usage:  "Install cloudflared as a Windows service",
 				Action: cliutil.ConfiguredAction(installWindowsService),
+				Flags: []cli.Flag{
+					newServiceEnvFlag(),
+					&cli.DurationFlag{
+						Name:  recoveryDelayFlag,
+						Usage: "Time the service control manager waits before restarting the service when it fails",
+						Value: recoverActionDelay,
+					},
+					&cli.DurationFlag{
+						Name:  failureResetPeriodFlag,
+						Usage: "Time without failures after which the failure count of the service is reset",
+						Value: failureCountResetPeriod,
+					},
+					&cli.BoolFlag{
+						Name:  noRecoveryFlag,
+						Usage: "Don't restart the service when it fails",
+					},
+				},
 			},
 			{
 				Name:   "uninstall",
@@ -136,21 +170,40 @@ func (s *windowsService) Execute(serviceArgs []string, r <-chan svc.ChangeReques
 	go func() {
 		errC <- s.app.Run(args)
 	}()
-	statusChan <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
-
+	statusChan <- svc.Status{State: svc.Running, Accepts: serviceAcceptedControls}
+
+	// drainTicker reports the progress of the graceful shutdown, so that the service control manager doesn't consider
+	// the service hung while it drains its connections
+	var (
+		drainTicker     *time.Ticker
+		drainTickerC    <-chan time.Time
+		drainCheckPoint uint32
+		drainStatus     string
+	)
+	defer func() {
+		if drainTicker != nil {
+			drainTicker.Stop()
+		}
+	}()
 	for {
 		select {
 		case c := <-r:
 			switch c.Cmd {
 			case svc.Interrogate:
 				statusChan <- c.CurrentStatus
-			case svc.Stop, svc.Shutdown:
+			case svc.ParamChange:
+				elog.Info(1, "cloudflared reloading its configuration")
+				tunnel.ReloadConfig()
+				statusChan <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown, svc.PreShutdown:
 				if s.graceShutdownC != nil {
 					// start graceful shutdown
-					elog.Info(1, "cloudflared starting graceful shutdown")
+					elog.Info(1, fmt.Sprintf("cloudflared starting graceful shutdown on %s, draining %s", controlName(c.Cmd), tunnel.ServiceStatus()))
 					close(s.graceShutdownC)
 					s.graceShutdownC = nil
-					statusChan <- svc.Status{State: svc.StopPending}
+					drainTicker = time.NewTicker(drainStatusInterval)
+					drainTickerC = drainTicker.C
+					statusChan <- svc.Status{State: svc.StopPending, WaitHint: uint32(drainWaitHint / time.Millisecond)}
 					continue
 				}
 				// repeated attempts at graceful shutdown forces immediate stop
@@ -160,6 +213,17 @@ func (s *windowsService) Execute(serviceArgs []string, r <-chan svc.ChangeReques
 			default:
 				elog.Error(1, fmt.Sprintf("unexpected control request #%d", c))
 			}
+		case <-drainTickerC:
+			drainCheckPoint++
+			statusChan <- svc.Status{
+				State:      svc.StopPending,
+				CheckPoint: drainCheckPoint,
+				WaitHint:   uint32(drainWaitHint / time.Millisecond),
+			}
+			if status := tunnel.ServiceStatus(); status != drainStatus {
+				elog.Info(1, fmt.Sprintf("cloudflared draining, %s", status))
+				drainStatus = status
+			}
 		case err := <-errC:
 			if err != nil {
 				elog.Error(1, fmt.Sprintf("cloudflared terminated with error %v", err))
@@ -174,6 +238,19 @@ func (s *windowsService) Execute(serviceArgs []string, r <-chan svc.ChangeReques
 	}
 }
 
+func controlName(cmd svc.Cmd) string {
+	switch cmd {
+	case svc.Stop:
+		return "stop"
+	case svc.Shutdown:
+		return "shutdown"
+	case svc.PreShutdown:
+		return "pre-shutdown"
+	default:
+		return fmt.Sprintf("control request #%d", cmd)
+	}
+}
+
 func installWindowsService(c *cli.Context) error {
 	zeroLogger := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
 
@@ -199,6 +276,14 @@ func installWindowsService(c *cli.Context) error {
 		log.Err(err).Msg(errMsg)
 		return errors.Wrap(err, errMsg)
 	}
+	env, err := serviceEnv(c)
+	if err != nil {
+		return err
+	}
+	recoveryDelay, failureResetPeriod := c.Duration(recoveryDelayFlag), c.Duration(failureResetPeriodFlag)
+	if recoveryDelay < 0 || failureResetPeriod < 0 {
+		return cliutil.UsageError("--%s and --%s must not be negative.", recoveryDelayFlag, failureResetPeriodFlag)
+	}
 
 	config := mgr.Config{StartType: mgr.StartAutomatic, DisplayName: windowsServiceDescription}
 	s, err = m.CreateService(windowsServiceName, exepath, config, extraArgs...)
@@ -213,8 +298,16 @@ func installWindowsService(c *cli.Context) error {
 		return errors.Wrap(err, "Cannot install event logger")
 	}
 
-	err = configRecoveryOption(s.Handle)
-	if err != nil {
+	if len(env) > 0 {
+		if err := setServiceEnvironment(env); err != nil {
+			s.Delete()
+			return errors.Wrap(err, "Cannot set the environment of the service")
+		}
+	}
+
+	if c.Bool(noRecoveryFlag) {
+		log.Info().Msg("The service won't be restarted when it fails")
+	} else if err = configRecoveryOption(s.Handle, recoveryDelay, failureResetPeriod); err != nil {
 		log.Err(err).Msg("Cannot set service recovery actions")
 		log.Info().Msgf("See %s to manually configure service recovery actions", windowsServiceUrl)
 	}
@@ -299,14 +392,24 @@ type recoveryAction struct {
 	delay uint32
 }
 
+// setServiceEnvironment sets the environment variables of the service, in the Environment value of its registry key
+func setServiceEnvironment(env []string) error {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+windowsServiceName, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	return key.SetStringsValue("Environment", env)
+}
+
 // until https://github.com/golang/go/issues/23239 is release, we will need to
 // configure through ChangeServiceConfig2
-func configRecoveryOption(handle windows.Handle) error {
+func configRecoveryOption(handle windows.Handle, delay, resetPeriod time.Duration) error {
 	actions := []recoveryAction{
-		{recoveryType: uint32(scActionRestart), delay: uint32(recoverActionDelay / time.Millisecond)},
+		{recoveryType: uint32(scActionRestart), delay: uint32(delay / time.Millisecond)},
 	}
 	serviceRecoveryActions := serviceFailureActions{
-		resetPeriod: uint32(failureCountResetPeriod / time.Second),
+		resetPeriod: uint32(resetPeriod / time.Second),
 		actionCount: uint32(len(actions)),
 		actions:     uintptr(unsafe.Pointer(&actions[0])),
 	}
@@ -3,12 +3,13 @@ package config
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -22,7 +23,7 @@ import (
 
 var (
 	// DefaultConfigFiles is the file names from which we attempt to read configuration.
-	DefaultConfigFiles = []string{"config.yml", "config.yaml"}
+	DefaultConfigFiles = []string{"config.yml", "config.yaml", "config.json", "config.toml"}
 
 	// DefaultUnixConfigLocation is the primary location to find a config file
 	DefaultUnixConfigLocation = "/usr/local/etc/cloudflared"
@@ -203,9 +204,9 @@ type OriginRequestConfig struct {
 	KeepAliveConnections *int `yaml:"keepAliveConnections" json:"keepAliveConnections,omitempty"`
 	// HTTP proxy timeout for closing an idle connection
 	KeepAliveTimeout *CustomDuration `yaml:"keepAliveTimeout" json:"keepAliveTimeout,omitempty"`
-	// Sets the HTTP Host header for the local webserver.
+	// Sets the HTTP Host header for the local webserver. It can contain the variables of the matched request, e.g. ${1}.
 	HTTPHostHeader *string `yaml:"httpHostHeader" json:"httpHostHeader,omitempty"`
-	// Hostname on the origin server certificate.
+	// Hostname on the origin server certificate. It can contain the variables of the matched request, e.g. ${1}.internal.
 	OriginServerName *string `yaml:"originServerName" json:"originServerName,omitempty"`
 	// Path to the CA for the certificate of your origin.
 	// This option should be used only if your certificate is not signed by Cloudflare.
@@ -229,6 +230,73 @@ type OriginRequestConfig struct {
 	IPRules []IngressIPRule `yaml:"ipRules" json:"ipRules,omitempty"`
 	// Attempt to connect to origin with HTTP/2
 	Http2Origin *bool `yaml:"http2Origin" json:"http2Origin,omitempty"`
+	// Interval of the pings sent to the origin of WebSocket connections
+	WebSocketPingInterval *CustomDuration `yaml:"webSocketPingInterval" json:"webSocketPingInterval,omitempty"`
+	// Timeout for the origin to answer a ping of a WebSocket connection, before closing the connection
+	WebSocketPongTimeout *CustomDuration `yaml:"webSocketPongTimeout" json:"webSocketPongTimeout,omitempty"`
+	// Maximum size in bytes of the messages of WebSocket connections, larger messages close the connection
+	WebSocketMaxMessageSize *uint `yaml:"webSocketMaxMessageSize" json:"webSocketMaxMessageSize,omitempty"`
+	// Disables the compression of WebSocket messages, which is negotiated between the client and origin otherwise
+	DisableWebSocketCompression *bool `yaml:"disableWebSocketCompression" json:"disableWebSocketCompression,omitempty"`
+	// Maximum number of concurrent WebSocket and TCP streams to the origin of the rule
+	MaxConcurrentStreams *uint `yaml:"maxConcurrentStreams" json:"maxConcurrentStreams,omitempty"`
+	// File of the template of the responses of the hello_world service
+	HelloWorldTemplate *string `yaml:"helloWorldTemplate" json:"helloWorldTemplate,omitempty"`
+	// Delay of the responses of the hello_world service
+	HelloWorldLatency *CustomDuration `yaml:"helloWorldLatency" json:"helloWorldLatency,omitempty"`
+	// HTTP proxy timeout for the origin to send the headers of its response after the request was sent
+	ResponseHeaderTimeout *CustomDuration `yaml:"responseHeaderTimeout" json:"responseHeaderTimeout,omitempty"`
+	// HTTP proxy deadline of a whole request, from connecting to the origin to the end of its response
+	RequestTimeout *CustomDuration `yaml:"requestTimeout" json:"requestTimeout,omitempty"`
+	// Timeout for closing TCP connections to the origin without traffic
+	TCPIdleTimeout *CustomDuration `yaml:"tcpIdleTimeout" json:"tcpIdleTimeout,omitempty"`
+	// Keeps TCP connections to the origin open until both directions are done
+	TCPHalfClose *bool `yaml:"tcpHalfClose" json:"tcpHalfClose,omitempty"`
+	// p99 latency of the origin above which cloudflared warns that it's slow
+	SlowOriginThreshold *CustomDuration `yaml:"slowOriginThreshold" json:"slowOriginThreshold,omitempty"`
+	// Number of pending requests to the origin above which cloudflared warns that they are queuing up
+	SlowOriginPendingRequests *uint `yaml:"slowOriginPendingRequests" json:"slowOriginPendingRequests,omitempty"`
+	// Translates gRPC-web requests into gRPC requests to the origin
+	GRPCWeb *bool `yaml:"grpcWeb" json:"grpcWeb,omitempty"`
+	// Sends every write of the responses of the origin to the eyeball right away, like Server-Sent Events
+	DisableResponseBuffering *bool `yaml:"disableResponseBuffering" json:"disableResponseBuffering,omitempty"`
+	// Longest time the responses of the origin are buffered for before they are sent to the eyeball
+	FlushInterval *CustomDuration `yaml:"flushInterval" json:"flushInterval,omitempty"`
+	// HTTP proxy deadline of streaming responses, from their headers to their end, instead of requestTimeout
+	StreamTimeout *CustomDuration `yaml:"streamTimeout" json:"streamTimeout,omitempty"`
+	// Local IP the connections to the origin are dialed from
+	SourceAddress *string `yaml:"sourceAddress" json:"sourceAddress,omitempty"`
+	// Redirects the requests the eyeball sent over HTTP to HTTPS
+	HTTPSRedirect *bool `yaml:"httpsRedirect" json:"httpsRedirect,omitempty"`
+	// max-age of the Strict-Transport-Security header added to the responses to requests sent over HTTPS
+	HSTSMaxAge *CustomDuration `yaml:"hstsMaxAge" json:"hstsMaxAge,omitempty"`
+	// Adds includeSubDomains to the Strict-Transport-Security header
+	HSTSIncludeSubdomains *bool `yaml:"hstsIncludeSubdomains" json:"hstsIncludeSubdomains,omitempty"`
+	// Status code of the responses of the rule while it's in maintenance mode
+	MaintenanceStatus *uint `yaml:"maintenanceStatus" json:"maintenanceStatus,omitempty"`
+	// File served as the body of the responses of the rule while it's in maintenance mode
+	MaintenancePage *string `yaml:"maintenancePage" json:"maintenancePage,omitempty"`
+	// Stops logging the requests and connections of the rule
+	DisableAccessLog *bool `yaml:"disableAccessLog" json:"disableAccessLog,omitempty"`
+	// Fields recorded in the logs of the requests and connections of the rule, all to record all of them
+	AccessLogFields []string `yaml:"accessLogFields" json:"accessLogFields,omitempty"`
+	// Number of idle connections to the origin kept established ahead of requests
+	WarmConnections *uint `yaml:"warmConnections" json:"warmConnections,omitempty"`
+	// How the revocation of the certificate of the origin is checked: stapled, ocsp or crl
+	RevocationCheck *string `yaml:"revocationCheck" json:"revocationCheck,omitempty"`
+	// Trusts the certificate of the origin when its revocation can't be checked
+	RevocationSoftFail *bool `yaml:"revocationSoftFail" json:"revocationSoftFail,omitempty"`
+	// Minimum TLS version of the connections to the origin, e.g. 1.0
+	TLSMinVersion *string `yaml:"tlsMinVersion" json:"tlsMinVersion,omitempty"`
+	// Maximum TLS version of the connections to the origin, e.g. 1.2
+	TLSMaxVersion *string `yaml:"tlsMaxVersion" json:"tlsMaxVersion,omitempty"`
+	// Cipher suites of the connections to the origin up to TLS 1.2
+	TLSCipherSuites []string `yaml:"tlsCipherSuites" json:"tlsCipherSuites,omitempty"`
+	// Forwards the details of the client certificate the eyeball presented to the edge to the origin. It can only be
+	// trusted with the "Add TLS client auth headers" managed transform enabled on the zone.
+	ForwardClientCert *bool `yaml:"forwardClientCert" json:"forwardClientCert,omitempty"`
+	// Path answered by cloudflared with its health instead of the origin, e.g. /_tunnel/healthz
+	HealthPath *string `yaml:"healthPath" json:"healthPath,omitempty"`
 }
 
 type IngressIPRule struct {
@@ -242,12 +310,70 @@ type Configuration struct {
 	Ingress       []UnvalidatedIngressRule
 	WarpRouting   WarpRoutingConfig   `yaml:"warp-routing"`
 	OriginRequest OriginRequestConfig `yaml:"originRequest"`
+	Secrets       SecretsConfig       `yaml:"secrets"`
+	EdgeAddresses EdgeAddressesConfig `yaml:"edge-addresses"`
+	TCPListeners  []TCPListenerConfig `yaml:"tcp-listeners"`
 	sourceFile    string
 }
 
+// TCPListenerConfig is a local port whose connections cloudflared forwards to the origin of an ingress rule, to relay
+// TCP between hosts of a private network
+type TCPListenerConfig struct {
+	// Listen is the local address of the port, e.g. 127.0.0.1:2222
+	Listen string `yaml:"listen"`
+	// Hostname selects the ingress rule whose origin the connections are forwarded to, it must be a TCP service
+	Hostname string `yaml:"hostname"`
+}
+
+// EdgeAddressesConfig are the IP:port addresses of each region of the edge to connect to, instead of discovering them
+// with DNS. They're for environments whose egress allowlists need deterministic destination IPs.
+type EdgeAddressesConfig struct {
+	Region1 []string `yaml:"region1"`
+	Region2 []string `yaml:"region2"`
+}
+
+// SecretsConfig fetches the secrets of cloudflared from secret managers instead of reading them from files on disk
+type SecretsConfig struct {
+	// Credentials of the named tunnel, the JSON written by `cloudflared tunnel create`
+	Credentials *SecretSource `yaml:"credentials"`
+	// Token of the tunnel, as given to --token
+	Token *SecretSource `yaml:"token"`
+	// OriginCert is the certificate written by `cloudflared login`
+	OriginCert *SecretSource `yaml:"originCert"`
+	// RefreshInterval is how often secrets are fetched again to detect rotations, never if unset
+	RefreshInterval *CustomDuration `yaml:"refreshInterval"`
+}
+
+// SecretSource locates a secret in a secret manager
+type SecretSource struct {
+	// Provider is the secret manager: vault, aws or gcp
+	Provider string `yaml:"provider"`
+	// Name of the secret: the API path of a Vault secret (e.g. secret/data/cloudflared), the name or ARN of an AWS
+	// secret, or the resource name of a GCP secret (e.g. projects/my-project/secrets/cloudflared)
+	Name string `yaml:"name"`
+	// Field selects one value of a secret holding a JSON object, it's required for Vault secrets with several keys
+	Field string `yaml:"field"`
+	// Address of the secret manager, e.g. the URL of the Vault server. Defaults to VAULT_ADDR for Vault, and to the
+	// public endpoint of the cloud provider otherwise.
+	Address string `yaml:"address"`
+	// Region of an AWS secret, defaults to AWS_REGION
+	Region string `yaml:"region"`
+}
+
 type WarpRoutingConfig struct {
-	Enabled        bool            `yaml:"enabled" json:"enabled"`
+	Enabled        bool                  `yaml:"enabled" json:"enabled"`
+	ConnectTimeout *CustomDuration       `yaml:"connectTimeout" json:"connectTimeout,omitempty"`
+	IdleTimeout    *CustomDuration       `yaml:"idleTimeout" json:"idleTimeout,omitempty"`
+	TCPKeepAlive   *CustomDuration       `yaml:"tcpKeepAlive" json:"tcpKeepAlive,omitempty"`
+	Overrides      []WarpRoutingOverride `yaml:"overrides" json:"overrides,omitempty"`
+}
+
+// WarpRoutingOverride overrides the settings of the TCP flows to a network. Unset settings are the ones of
+// WarpRoutingConfig.
+type WarpRoutingOverride struct {
+	Network        string          `yaml:"network" json:"network"`
 	ConnectTimeout *CustomDuration `yaml:"connectTimeout" json:"connectTimeout,omitempty"`
+	IdleTimeout    *CustomDuration `yaml:"idleTimeout" json:"idleTimeout,omitempty"`
 	TCPKeepAlive   *CustomDuration `yaml:"tcpKeepAlive" json:"tcpKeepAlive,omitempty"`
 }
 
@@ -376,34 +502,55 @@ func ReadConfigFile(c *cli.Context, log *zerolog.Logger) (settings *configFileSe
 	}
 
 	log.Debug().Msgf("Loading configuration from %s", configFile)
-	file, err := os.Open(configFile)
+	file, err := readYAMLFile(configFile)
 	if err != nil {
 		if os.IsNotExist(err) {
 			err = ErrNoConfigFile
 		}
 		return nil, "", err
 	}
-	defer file.Close()
-	if err := yaml.NewDecoder(file).Decode(&configuration); err != nil {
-		if err == io.EOF {
-			log.Error().Msgf("Configuration file %s was empty", configFile)
-			return &configuration, "", nil
-		}
-		return nil, "", errors.Wrap(err, "error parsing YAML in config file at "+configFile)
+	if file.root == nil {
+		log.Error().Msgf("Configuration file %s was empty", configFile)
+		return &configuration, "", nil
+	}
+	for _, unset := range file.warnings {
+		log.Warn().Msgf("Configuration file %s at %s", unset.file, unset)
+	}
+	if err := file.root.Decode(&configuration); err != nil {
+		return nil, "", errors.Wrapf(err, "error parsing %s in config file at %s", formatOf(configFile), configFile)
 	}
 	configuration.sourceFile = configFile
 
-	// Parse it again, with strict mode, to find warnings.
-	if file, err := os.Open(configFile); err == nil {
-		decoder := yaml.NewDecoder(file)
-		decoder.KnownFields(true)
-		var unusedConfig configFileSettings
-		if err := decoder.Decode(&unusedConfig); err != nil {
-			warnings = err.Error()
+	// Find the keys that aren't used, every key is used at the top level since they set flags
+	doc := Document{File: configFile, root: file.root.Content[0], sources: file.sources}
+	var topLevelKeys, unusedKeys []string
+	if doc.root.Kind == yaml.MappingNode {
+		for i := 0; i < len(doc.root.Content); i += 2 {
+			topLevelKeys = append(topLevelKeys, doc.root.Content[i].Value)
 		}
 	}
+	for _, problem := range doc.checkKeys(doc.root, reflect.TypeOf(Configuration{}), topLevelKeys) {
+		unusedKeys = append(unusedKeys, fmt.Sprintf("%s: line %d: %s", problem.File, problem.Line, problem.Message))
+	}
+
+	return &configuration, strings.Join(unusedKeys, "\n"), nil
+}
 
-	return &configuration, warnings, nil
+// ReadConfiguration reads the configuration file at path again, e.g. to reload its ingress rules. Unlike ReadConfigFile
+// it doesn't replace the configuration returned by GetConfiguration.
+func ReadConfiguration(path string) (*Configuration, error) {
+	file, err := readYAMLFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var settings configFileSettings
+	if file.root != nil {
+		if err := file.root.Decode(&settings); err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s in config file at %s", formatOf(path), path)
+		}
+	}
+	settings.sourceFile = path
+	return &settings.Configuration, nil
 }
 
 // A CustomDuration is a Duration that has custom serialization for JSON.
@@ -2,6 +2,8 @@ package config
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -25,7 +27,14 @@ func TestConfigFileSettings(t *testing.T) {
 		warpRouting = WarpRoutingConfig{
 			Enabled:        true,
 			ConnectTimeout: &CustomDuration{Duration: 2 * time.Second},
+			IdleTimeout:    &CustomDuration{Duration: time.Hour},
 			TCPKeepAlive:   &CustomDuration{Duration: 10 * time.Second},
+			Overrides: []WarpRoutingOverride{
+				{
+					Network:        "10.1.0.0/16",
+					ConnectTimeout: &CustomDuration{Duration: 30 * time.Second},
+				},
+			},
 		}
 	)
 	rawYAML := `
@@ -51,7 +60,17 @@ ingress:
 warp-routing: 
   enabled: true
   connectTimeout: 2s
+  idleTimeout: 1h
   tcpKeepAlive: 10s
+  overrides:
+  - network: 10.1.0.0/16
+    connectTimeout: 30s
+edge-addresses:
+  region1:
+  - 198.41.192.7:7844
+  region2:
+  - 198.41.200.13:7844
+  - "[2606:4700:a8::1]:7844"
 
 retries: 5
 grace-period: 30s
@@ -72,6 +91,10 @@ counters:
 	assert.Equal(t, firstIngress, config.Ingress[0])
 	assert.Equal(t, secondIngress, config.Ingress[1])
 	assert.Equal(t, warpRouting, config.WarpRouting)
+	assert.Equal(t, EdgeAddressesConfig{
+		Region1: []string{"198.41.192.7:7844"},
+		Region2: []string{"198.41.200.13:7844", "[2606:4700:a8::1]:7844"},
+	}, config.EdgeAddresses)
 	privateV4 := "10.0.0.0/8"
 	privateV6 := "fc00::/7"
 	ipRules := []IngressIPRule{
@@ -145,7 +168,9 @@ var rawJsonConfig = []byte(`
 			"allow": true
 		}
 	],
-	"http2Origin": true
+	"http2Origin": true,
+	"accessLogFields": ["host", "path"],
+	"tlsCipherSuites": ["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"]
 }
 `)
 
@@ -193,6 +218,8 @@ func assertConfig(
 	assert.Equal(t, uint(9000), *config.ProxyPort)
 	assert.Equal(t, "socks", *config.ProxyType)
 	assert.Equal(t, true, *config.Http2Origin)
+	assert.Equal(t, []string{"host", "path"}, config.AccessLogFields)
+	assert.Equal(t, []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}, config.TLSCipherSuites)
 
 	privateV4 := "10.0.0.0/8"
 	privateV6 := "fc00::/7"
@@ -218,3 +245,26 @@ func assertConfig(
 
 	require.Equal(t, config2, config)
 }
+
+func TestReadConfiguration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	rawYAML := `
+tunnel: config-file-test
+ingress:
+ - hostname: tunnel1.example.com
+   service: https://localhost:8000
+ - service: http_status:404
+loglevel: debug
+`
+	require.NoError(t, os.WriteFile(path, []byte(rawYAML), 0600))
+	configuration, err := ReadConfiguration(path)
+	require.NoError(t, err)
+	assert.Equal(t, "config-file-test", configuration.TunnelID)
+	assert.Len(t, configuration.Ingress, 2)
+	assert.Equal(t, path, configuration.Source())
+	// Reading the file again doesn't replace the configuration of the process
+	assert.NotEqual(t, path, GetConfiguration().Source())
+
+	_, err = ReadConfiguration(filepath.Join(t.TempDir(), "missing.yml"))
+	require.Error(t, err)
+}
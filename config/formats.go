@@ -0,0 +1,126 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// The TOML parser prefixes its errors with their line
+var tomlErrorLine = regexp.MustCompile(`^Near line (\d+) \(last key parsed '.*'\): (.*)$`)
+
+// parseConfig parses the content of the configuration file at path in the format of its extension: JSON with .json,
+// TOML with .toml, and YAML otherwise. Its errors start with the line of the error, like the errors of yaml.v3. The node
+// is nil if the file is empty.
+func parseConfig(path string, content []byte) (*yaml.Node, error) {
+	switch formatOf(path) {
+	case "JSON":
+		return parseJSON(content)
+	case "TOML":
+		return parseTOML(content)
+	}
+	return parseYAML(content)
+}
+
+// formatOf returns the format of the configuration file at path, see parseConfig
+func formatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "JSON"
+	case ".toml":
+		return "TOML"
+	}
+	return "YAML"
+}
+
+func parseYAML(content []byte) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+	return document.Content[0], nil
+}
+
+// parseJSON parses JSON as YAML when yaml.v3 accepts it, since it keeps the positions of the values. yaml.v3 rejects
+// some valid JSON, like the \/ escape or duplicate keys, in which case the node is built from the decoded JSON value,
+// without positions like with TOML.
+func parseJSON(content []byte) (*yaml.Node, error) {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(content, &value); err != nil {
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			line := bytes.Count(content[:syntaxErr.Offset], []byte("\n")) + 1
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		return nil, err
+	}
+	if node, err := parseYAML(content); err == nil {
+		return node, nil
+	}
+	// Numbers are decoded as written, so that integers are encoded as integers
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	if err := node.Encode(jsonNumbers(value)); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// jsonNumbers replaces the numbers of a JSON value decoded with UseNumber by integers, or floats if they aren't
+func jsonNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for k, v := range value {
+			value[k] = jsonNumbers(v)
+		}
+	case []interface{}:
+		for i, v := range value {
+			value[i] = jsonNumbers(v)
+		}
+	}
+	return value
+}
+
+// parseTOML converts TOML to a YAML node. TOML doesn't keep the positions of the values, so the nodes have no line.
+// References to environment variables can only be in TOML strings, which are encoded as plain scalars when they have
+// one, so that they're resolved again after interpolation like unquoted YAML values.
+func parseTOML(content []byte) (*yaml.Node, error) {
+	var value map[string]interface{}
+	if _, err := toml.Decode(string(content), &value); err != nil {
+		if match := tomlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			return nil, fmt.Errorf("line %d: %s", line, match[2])
+		}
+		return nil, err
+	}
+	if len(value) == 0 {
+		return nil, nil
+	}
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConfigurationFormats(t *testing.T) {
+	files := map[string]string{
+		"config.yml": `tunnel: df5ed608-b8b4-4109-89f3-9f2cf199df64
+originRequest:
+  keepAliveConnections: ${KEEP_ALIVE_CONNECTIONS}
+ingress:
+  - hostname: app.example.com
+    service: http://localhost:8000
+    originRequest:
+      noTLSVerify: true
+  - service: http_status:404
+`,
+		"config.json": `{
+	"tunnel": "df5ed608-b8b4-4109-89f3-9f2cf199df64",
+	"originRequest": {
+		"keepAliveConnections": 10
+	},
+	"ingress": [
+		{
+			"hostname": "app.example.com",
+			"service": "http://localhost:8000",
+			"originRequest": {"noTLSVerify": true}
+		},
+		{"service": "http_status:404"}
+	]
+}
+`,
+		"config.toml": `tunnel = "df5ed608-b8b4-4109-89f3-9f2cf199df64"
+
+[originRequest]
+keepAliveConnections = "${KEEP_ALIVE_CONNECTIONS}"
+
+[[ingress]]
+hostname = "app.example.com"
+service = "http://localhost:8000"
+originRequest = { noTLSVerify = true }
+
+[[ingress]]
+service = "http_status:404"
+`,
+	}
+	t.Setenv("KEEP_ALIVE_CONNECTIONS", "10")
+	dir := writeConfigFiles(t, files)
+	for name := range files {
+		t.Run(name, func(t *testing.T) {
+			conf, err := ReadConfiguration(filepath.Join(dir, name))
+			require.NoError(t, err)
+			assert.Equal(t, "df5ed608-b8b4-4109-89f3-9f2cf199df64", conf.TunnelID)
+			require.NotNil(t, conf.OriginRequest.KeepAliveConnections)
+			assert.Equal(t, 10, *conf.OriginRequest.KeepAliveConnections)
+			require.Len(t, conf.Ingress, 2)
+			assert.Equal(t, "app.example.com", conf.Ingress[0].Hostname)
+			assert.Equal(t, "http://localhost:8000", conf.Ingress[0].Service)
+			require.NotNil(t, conf.Ingress[0].OriginRequest.NoTLSVerify)
+			assert.True(t, *conf.Ingress[0].OriginRequest.NoTLSVerify)
+			assert.Equal(t, "http_status:404", conf.Ingress[1].Service)
+		})
+	}
+}
+
+func TestReadJSONConfigurationRejectedByYAML(t *testing.T) {
+	// yaml.v3 doesn't accept the \/ escape, nor duplicate keys, which are both valid JSON
+	dir := writeConfigFiles(t, map[string]string{"config.json": `{
+	"tunnel": "df5ed608-b8b4-4109-89f3-9f2cf199df64",
+	"originRequest": {"keepAliveConnections": 10, "keepAliveConnections": 20},
+	"ingress": [{"service": "http:\/\/localhost:8000"}]
+}
+`})
+	conf, err := ReadConfiguration(filepath.Join(dir, "config.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "df5ed608-b8b4-4109-89f3-9f2cf199df64", conf.TunnelID)
+	require.NotNil(t, conf.OriginRequest.KeepAliveConnections)
+	assert.Equal(t, 20, *conf.OriginRequest.KeepAliveConnections)
+	require.Len(t, conf.Ingress, 1)
+	assert.Equal(t, "http://localhost:8000", conf.Ingress[0].Service)
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		path    string
+		content string
+		err     string
+	}{
+		{
+			path:    "config.json",
+			content: "{\n  \"tunnel\": \"test\",\n  \"ingress\": [,]\n}\n",
+			err:     "line 3: invalid character ',' looking for beginning of value",
+		},
+		{
+			path:    "config.json",
+			content: "tunnel: test\n",
+			err:     "line 1: invalid character 'u' in literal true (expecting 'r')",
+		},
+		{
+			path:    "config.toml",
+			content: "tunnel = \"test\"\n\n[originRequest\n",
+			err:     "line 3: expected '.' or ']' to end table name, but got '\\n' instead",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			_, err := parseConfig(test.path, []byte(test.content))
+			assert.EqualError(t, err, test.err)
+		})
+	}
+
+	for _, path := range []string{"config.yml", "config.json", "config.toml"} {
+		node, err := parseConfig(path, []byte("\n"))
+		require.NoError(t, err)
+		assert.Nil(t, node, path)
+	}
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// HostnameRouter routes the hostnames of ingress rules discovered locally, e.g. from Kubernetes ingresses or Docker
+// containers, to the tunnel. Each hostname is only routed once.
+type HostnameRouter struct {
+	// route routes a hostname to the tunnel, it can be nil to leave DNS alone
+	route  func(hostname string) error
+	log    *zerolog.Logger
+	routed map[string]bool
+}
+
+// NewHostnameRouter creates a HostnameRouter routing hostnames with route, which can be nil to leave DNS alone
+func NewHostnameRouter(route func(hostname string) error, log *zerolog.Logger) *HostnameRouter {
+	return &HostnameRouter{
+		route:  route,
+		log:    log,
+		routed: make(map[string]bool),
+	}
+}
+
+// RouteHostnames routes the hostnames of rules not routed yet, failures are retried on the next call
+func (r *HostnameRouter) RouteHostnames(rules []UnvalidatedIngressRule) {
+	if r.route == nil {
+		return
+	}
+	for _, rule := range rules {
+		if rule.Hostname == "" || r.routed[rule.Hostname] {
+			continue
+		}
+		if err := r.route(rule.Hostname); err != nil {
+			r.log.Err(err).Str("hostname", rule.Hostname).Msg("Failed to route hostname to tunnel")
+			continue
+		}
+		r.routed[rule.Hostname] = true
+	}
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostnameRouter(t *testing.T) {
+	var routed []string
+	failing := map[string]bool{"docs.example.com": true}
+	log := zerolog.Nop()
+	router := NewHostnameRouter(func(hostname string) error {
+		if failing[hostname] {
+			return errors.New("route failed")
+		}
+		routed = append(routed, hostname)
+		return nil
+	}, &log)
+
+	rules := []UnvalidatedIngressRule{
+		{Hostname: "app.example.com", Service: "http://localhost:8080"},
+		{Hostname: "docs.example.com", Service: "http://localhost:8081"},
+		{Service: "http_status:404"},
+	}
+	router.RouteHostnames(rules)
+	assert.Equal(t, []string{"app.example.com"}, routed)
+
+	// Routed hostnames aren't routed again, failed ones are retried
+	delete(failing, "docs.example.com")
+	router.RouteHostnames(rules)
+	assert.Equal(t, []string{"app.example.com", "docs.example.com"}, routed)
+}
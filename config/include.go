@@ -0,0 +1,206 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"gopkg.in/yaml.v3"
+)
+
+// includeKey is the top level key of the files a configuration file includes, e.g.
+//
+//	include:
+//	  - /etc/cloudflared/base.yml
+//	  - conf.d/*.yml
+//
+// Relative paths are relative to the directory of the including file, and globs are expanded in lexical order. The
+// files are merged in the order they're included, then the including file is merged on top of them: mappings are merged
+// key by key, and other values, including sequences such as ingress, replace the values of the files merged before.
+// Included files can include other files, and be in any of the formats of parseConfig.
+const includeKey = "include"
+
+// fileError is an error in a configuration file, or in a file it includes
+type fileError struct {
+	file string
+	// operation is what failed, e.g. parsing YAML
+	operation string
+	err       error
+}
+
+func (e *fileError) Error() string {
+	return fmt.Sprintf("error %s in config file at %s: %v", e.operation, e.file, e.err)
+}
+
+// Cause returns the error of the file, for errors.Cause
+func (e *fileError) Cause() error {
+	return e.err
+}
+
+// yamlFile is a configuration file merged with the files it includes
+type yamlFile struct {
+	// root is the document node, nil if the files are empty
+	root *yaml.Node
+	// sources are the files of the nodes of root
+	sources map[*yaml.Node]string
+	// warnings are the references to environment variables that aren't set
+	warnings []*nodeError
+}
+
+// readYAMLFile parses the YAML file at path along with the files it includes, with the references to environment
+// variables in their values replaced, see interpolate. Errors in the files are *fileError, other errors are the errors
+// of opening the file at path.
+func readYAMLFile(path string) (*yamlFile, error) {
+	file := &yamlFile{sources: map[*yaml.Node]string{}}
+	root, err := file.read(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if root != nil {
+		file.root = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}, Line: 1, Column: 1}
+	}
+	return file, nil
+}
+
+// read parses the file at path merged with the files it includes. including are the files including it, to detect
+// cycles.
+func (f *yamlFile) read(path string, including []string) (*yaml.Node, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseConfig(path, content)
+	if err != nil {
+		return nil, &fileError{file: path, operation: "parsing " + formatOf(path), err: err}
+	}
+	if root == nil {
+		return nil, nil
+	}
+	warnings, err := interpolate(path, root, os.LookupEnv)
+	if err != nil {
+		return nil, &fileError{file: path, operation: "interpolating environment variables", err: err}
+	}
+	f.warnings = append(f.warnings, warnings...)
+	walk(root, func(node *yaml.Node) {
+		f.sources[node] = path
+	})
+
+	patterns := removeKey(root, includeKey)
+	if patterns == nil {
+		return root, nil
+	}
+	including = append(including, filepath.Clean(path))
+	includeError := func(node *yaml.Node, format string, args ...interface{}) error {
+		return &fileError{file: path, operation: "including files", err: &nodeError{
+			file:    path,
+			line:    node.Line,
+			column:  node.Column,
+			message: fmt.Sprintf(format, args...),
+		}}
+	}
+	if patterns.Kind == yaml.ScalarNode {
+		patterns = &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{patterns}}
+	}
+	if patterns.Kind != yaml.SequenceNode {
+		return nil, includeError(patterns, "%s must be a path or a list of paths", includeKey)
+	}
+
+	var merged *yaml.Node
+	for _, pattern := range patterns.Content {
+		if pattern.Kind != yaml.ScalarNode {
+			return nil, includeError(pattern, "%s must be a path or a list of paths", includeKey)
+		}
+		expanded, err := homedir.Expand(pattern.Value)
+		if err != nil {
+			return nil, includeError(pattern, "%v", err)
+		}
+		if !filepath.IsAbs(expanded) {
+			expanded = filepath.Join(filepath.Dir(path), expanded)
+		}
+		matches, err := filepath.Glob(expanded)
+		if err != nil {
+			return nil, includeError(pattern, "invalid pattern %q: %v", pattern.Value, err)
+		}
+		// Globs matching no file include nothing, but a missing file is likely a mistake
+		if len(matches) == 0 && !hasMeta(pattern.Value) {
+			return nil, includeError(pattern, "%s doesn't exist", expanded)
+		}
+		for _, match := range matches {
+			if containsString(including, match) {
+				return nil, includeError(pattern, "including %s again would be a cycle", match)
+			}
+			included, err := f.read(match, including)
+			if err != nil {
+				if _, ok := err.(*fileError); ok {
+					return nil, err
+				}
+				return nil, includeError(pattern, "%v", err)
+			}
+			if included == nil {
+				continue
+			}
+			if included.Kind != yaml.MappingNode {
+				return nil, includeError(pattern, "%s must be a mapping of keys to values", match)
+			}
+			merged = f.merge(merged, included)
+		}
+	}
+	return f.merge(merged, root), nil
+}
+
+// merge merges overlay on top of base: mappings are merged key by key, other values of overlay replace the values of
+// base
+func (f *yamlFile) merge(base, overlay *yaml.Node) *yaml.Node {
+	if base == nil || base.Kind != yaml.MappingNode || overlay.Kind != yaml.MappingNode {
+		return overlay
+	}
+	merged := *base
+	merged.Content = append([]*yaml.Node{}, base.Content...)
+	f.sources[&merged] = f.sources[base]
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		j := indexOfKey(&merged, key.Value)
+		if j < 0 {
+			merged.Content = append(merged.Content, key, value)
+			continue
+		}
+		merged.Content[j] = key
+		merged.Content[j+1] = f.merge(merged.Content[j+1], value)
+	}
+	return &merged
+}
+
+// removeKey removes key from the mapping node, returning its value if any
+func removeKey(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	i := indexOfKey(node, key)
+	if i < 0 {
+		return nil
+	}
+	value := node.Content[i+1]
+	node.Content = append(node.Content[:i:i], node.Content[i+2:]...)
+	return value
+}
+
+func indexOfKey(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasMeta(pattern string) bool {
+	for _, c := range pattern {
+		switch c {
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+	return dir
+}
+
+func TestReadConfigurationInclude(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yml": `tunnel: df5ed608-b8b4-4109-89f3-9f2cf199df64
+originRequest:
+  connectTimeout: 10s
+  noTLSVerify: true
+ingress:
+  - service: http_status:404
+`,
+		"conf.d/10-origin.yml": `originRequest:
+  connectTimeout: 20s
+  httpHostHeader: example.com
+`,
+		"conf.d/20-ingress.yml": `ingress:
+  - hostname: app.example.com
+    service: http://localhost:8000
+  - service: http_status:503
+`,
+		"conf.d/ignored.txt": `tunnel: ignored`,
+		"config.yml": `include:
+  - base.yml
+  - conf.d/*.yml
+originRequest:
+  noTLSVerify: false
+`,
+	})
+	conf, err := ReadConfiguration(filepath.Join(dir, "config.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, "df5ed608-b8b4-4109-89f3-9f2cf199df64", conf.TunnelID)
+	// Mappings are merged
+	require.NotNil(t, conf.OriginRequest.ConnectTimeout)
+	assert.Equal(t, "20s", conf.OriginRequest.ConnectTimeout.String())
+	require.NotNil(t, conf.OriginRequest.HTTPHostHeader)
+	assert.Equal(t, "example.com", *conf.OriginRequest.HTTPHostHeader)
+	require.NotNil(t, conf.OriginRequest.NoTLSVerify)
+	assert.False(t, *conf.OriginRequest.NoTLSVerify)
+	// Sequences are replaced
+	require.Len(t, conf.Ingress, 2)
+	assert.Equal(t, "app.example.com", conf.Ingress[0].Hostname)
+	assert.Equal(t, "http_status:503", conf.Ingress[1].Service)
+}
+
+func TestReadConfigurationIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{
+			name:  "missing file",
+			files: map[string]string{"config.yml": "include: missing.yml\n"},
+			err:   "line 1: {{dir}}/missing.yml doesn't exist",
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"config.yml": "include: other.yml\n",
+				"other.yml":  "loglevel: debug\ninclude: config.yml\n",
+			},
+			err: "line 2: including {{dir}}/config.yml again would be a cycle",
+		},
+		{
+			name:  "not a path",
+			files: map[string]string{"config.yml": "include:\n  path: base.yml\n"},
+			err:   "line 2: include must be a path or a list of paths",
+		},
+		{
+			name: "not a mapping",
+			files: map[string]string{
+				"config.yml": "include: [base.yml]\n",
+				"base.yml":   "- tunnel\n",
+			},
+			err: "line 1: {{dir}}/base.yml must be a mapping of keys to values",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeConfigFiles(t, test.files)
+			_, err := ReadConfiguration(filepath.Join(dir, "config.yml"))
+			require.Error(t, err)
+			fileErr, ok := err.(*fileError)
+			require.True(t, ok)
+			assert.Equal(t, "including files", fileErr.operation)
+			assert.Equal(t, filepath.FromSlash(strings.ReplaceAll(test.err, "{{dir}}", dir)), filepath.FromSlash(fileErr.err.Error()))
+		})
+	}
+
+	// A glob matching no file includes nothing
+	dir := writeConfigFiles(t, map[string]string{"config.yml": "include: conf.d/*.yml\ntunnel: test\n"})
+	conf, err := ReadConfiguration(filepath.Join(dir, "config.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, "test", conf.TunnelID)
+}
+
+func TestParseDocumentInclude(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"base.yml": `originRequest:
+  conectTimeout: 10s
+`,
+		"config.yml": `include: base.yml
+tunnel: df5ed608-b8b4-4109-89f3-9f2cf199df64
+ingress:
+  - service: http_status:404
+`,
+	})
+	doc, problems, err := ParseDocument(filepath.Join(dir, "config.yml"), nil)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, filepath.Join(dir, "base.yml"), problems[0].File)
+	assert.Equal(t, 2, problems[0].Line)
+	assert.Equal(t, `unknown key "conectTimeout"`, problems[0].Message)
+
+	problem := doc.Problem("invalid service", "", false, "ingress", 0, "service")
+	assert.Equal(t, filepath.Join(dir, "config.yml"), problem.File)
+	assert.Equal(t, 4, problem.Line)
+}
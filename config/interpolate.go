@@ -0,0 +1,156 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// nodeError is an error or a warning at a node of a configuration file
+type nodeError struct {
+	file         string
+	line, column int
+	message      string
+}
+
+func (e *nodeError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.message)
+}
+
+// interpolate replaces the references to environment variables in the values of node, looked up with lookupEnv:
+//   - ${VAR} is the value of VAR, empty with a warning if VAR isn't set
+//   - ${VAR:-default} is default if VAR is empty or isn't set, ${VAR-default} only if VAR isn't set
+//   - ${VAR:?message} fails with message if VAR is empty or isn't set, ${VAR?message} only if VAR isn't set
+//   - $${ is a literal ${
+//
+// Keys aren't interpolated. Unquoted values are resolved again after interpolation, e.g. as numbers or booleans.
+func interpolate(file string, node *yaml.Node, lookupEnv func(string) (string, bool)) ([]*nodeError, error) {
+	var warnings []*nodeError
+	var visit func(node *yaml.Node) error
+	visit = func(node *yaml.Node) error {
+		switch node.Kind {
+		case yaml.DocumentNode, yaml.SequenceNode:
+			for _, child := range node.Content {
+				if err := visit(child); err != nil {
+					return err
+				}
+			}
+		case yaml.MappingNode:
+			for i := 1; i < len(node.Content); i += 2 {
+				if err := visit(node.Content[i]); err != nil {
+					return err
+				}
+			}
+		case yaml.ScalarNode:
+			if !strings.Contains(node.Value, "${") {
+				return nil
+			}
+			value, unset, err := expandEnv(node.Value, lookupEnv)
+			if err != nil {
+				return &nodeError{file: file, line: node.Line, column: node.Column, message: err.Error()}
+			}
+			for _, name := range unset {
+				warnings = append(warnings, &nodeError{
+					file:    file,
+					line:    node.Line,
+					column:  node.Column,
+					message: fmt.Sprintf("environment variable %s isn't set, it's replaced by an empty value", name),
+				})
+			}
+			if value != node.Value {
+				node.Value = value
+				if node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+					node.Tag = ""
+				}
+			}
+		}
+		return nil
+	}
+	if err := visit(node); err != nil {
+		return nil, err
+	}
+	return warnings, nil
+}
+
+// expandEnv replaces the references to environment variables in s, returning the variables that weren't set
+func expandEnv(s string, lookupEnv func(string) (string, bool)) (string, []string, error) {
+	var (
+		expanded strings.Builder
+		unset    []string
+	)
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			expanded.WriteString(s)
+			return expanded.String(), unset, nil
+		}
+		if start > 0 && s[start-1] == '$' {
+			expanded.WriteString(s[:start-1])
+			expanded.WriteString("${")
+			s = s[start+2:]
+			continue
+		}
+		expanded.WriteString(s[:start])
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return "", nil, fmt.Errorf("unclosed reference to an environment variable in %q", s[start:])
+		}
+		reference := s[start+2 : start+end]
+		s = s[start+end+1:]
+
+		name, operator, argument := splitReference(reference)
+		if !isEnvName(name) {
+			return "", nil, fmt.Errorf("invalid reference to an environment variable ${%s}", reference)
+		}
+		value, isSet := lookupEnv(name)
+		isEmpty := !isSet || (strings.HasPrefix(operator, ":") && value == "")
+		switch operator {
+		case "":
+			if !isSet {
+				unset = append(unset, name)
+			}
+		case ":-", "-":
+			if isEmpty {
+				value = argument
+			}
+		case ":?", "?":
+			if isEmpty {
+				if argument == "" {
+					return "", nil, fmt.Errorf("environment variable %s is required", name)
+				}
+				return "", nil, fmt.Errorf("environment variable %s is required: %s", name, argument)
+			}
+		}
+		expanded.WriteString(value)
+	}
+}
+
+// splitReference splits the reference VAR:-default into VAR, :- and default
+func splitReference(reference string) (name, operator, argument string) {
+	i := strings.IndexAny(reference, ":-?")
+	if i < 0 {
+		return reference, "", ""
+	}
+	name, rest := reference[:i], reference[i:]
+	for _, operator := range []string{":-", ":?", "-", "?"} {
+		if strings.HasPrefix(rest, operator) {
+			return name, operator, rest[len(operator):]
+		}
+	}
+	// An invalid operator makes an invalid name
+	return reference, "", ""
+}
+
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		isLetter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !isLetter && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{
+		"HOST":  "example.com",
+		"PORT":  "8080",
+		"EMPTY": "",
+	}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	tests := []struct {
+		input    string
+		expected string
+		unset    []string
+		err      string
+	}{
+		{input: "http://localhost:8080", expected: "http://localhost:8080"},
+		{input: "${HOST}", expected: "example.com"},
+		{input: "http://${HOST}:${PORT}/path", expected: "http://example.com:8080/path"},
+		{input: "${MISSING}", expected: "", unset: []string{"MISSING"}},
+		{input: "${EMPTY}", expected: ""},
+		{input: "${MISSING:-default}", expected: "default"},
+		{input: "${EMPTY:-default}", expected: "default"},
+		{input: "${EMPTY-default}", expected: ""},
+		{input: "${MISSING-default}", expected: "default"},
+		{input: "${PORT:-80}", expected: "8080"},
+		{input: "${MISSING:-}", expected: ""},
+		{input: "${HOST:?the hostname is required}", expected: "example.com"},
+		{input: "${EMPTY?}", expected: ""},
+		{input: "${MISSING:?the hostname is required}", err: "environment variable MISSING is required: the hostname is required"},
+		{input: "${EMPTY:?}", err: "environment variable EMPTY is required"},
+		{input: "${MISSING?}", err: "environment variable MISSING is required"},
+		{input: "$${HOST}", expected: "${HOST}"},
+		{input: "cost: $5 ${HOST}", expected: "cost: $5 example.com"},
+		{input: "${HOST", err: `unclosed reference to an environment variable in "${HOST"`},
+		{input: "${}", err: "invalid reference to an environment variable ${}"},
+		{input: "${1HOST}", err: "invalid reference to an environment variable ${1HOST}"},
+		{input: "${HOST:+alternative}", err: "invalid reference to an environment variable ${HOST:+alternative}"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			expanded, unset, err := expandEnv(test.input, lookupEnv)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, expanded)
+			assert.Equal(t, test.unset, unset)
+		})
+	}
+}
+
+func TestReadConfigurationInterpolation(t *testing.T) {
+	t.Setenv("TUNNEL_ID", "df5ed608-b8b4-4109-89f3-9f2cf199df64")
+	t.Setenv("ORIGIN_PORT", "8000")
+	t.Setenv("KEEP_ALIVE_CONNECTIONS", "10")
+	path := writeConfig(t, `tunnel: ${TUNNEL_ID}
+originRequest:
+  keepAliveConnections: ${KEEP_ALIVE_CONNECTIONS}
+  httpHostHeader: "${ORIGIN_HOST:-localhost}"
+ingress:
+  - hostname: ${HOSTNAME_PREFIX:-app}.example.com
+    service: http://localhost:${ORIGIN_PORT}
+  - service: '$${NOT_INTERPOLATED}'
+`)
+	conf, err := ReadConfiguration(path)
+	require.NoError(t, err)
+	assert.Equal(t, "df5ed608-b8b4-4109-89f3-9f2cf199df64", conf.TunnelID)
+	require.NotNil(t, conf.OriginRequest.KeepAliveConnections)
+	assert.Equal(t, 10, *conf.OriginRequest.KeepAliveConnections)
+	require.NotNil(t, conf.OriginRequest.HTTPHostHeader)
+	assert.Equal(t, "localhost", *conf.OriginRequest.HTTPHostHeader)
+	require.Len(t, conf.Ingress, 2)
+	assert.Equal(t, "app.example.com", conf.Ingress[0].Hostname)
+	assert.Equal(t, "http://localhost:8000", conf.Ingress[0].Service)
+	assert.Equal(t, "${NOT_INTERPOLATED}", conf.Ingress[1].Service)
+}
+
+func TestReadConfigurationRequiredVariable(t *testing.T) {
+	path := writeConfig(t, `tunnel: df5ed608-b8b4-4109-89f3-9f2cf199df64
+ingress:
+  - service: ${ORIGIN_SERVICE_NOT_SET:?set the origin service}
+`)
+	_, err := ReadConfiguration(path)
+	assert.EqualError(t, err, "error interpolating environment variables in config file at "+path+
+		": line 3: environment variable ORIGIN_SERVICE_NOT_SET is required: set the origin service")
+}
+
+func TestParseDocumentInterpolation(t *testing.T) {
+	path := writeConfig(t, `tunnel: ${TUNNEL_ID_NOT_SET}
+ingress:
+  - service: http_status:404
+`)
+	doc, problems, err := ParseDocument(path, nil)
+	require.NoError(t, err)
+	require.NotNil(t, doc)
+	assert.Equal(t, []Problem{{
+		File:    path,
+		Line:    1,
+		Column:  9,
+		Message: "environment variable TUNNEL_ID_NOT_SET isn't set, it's replaced by an empty value",
+		Warning: true,
+	}}, problems)
+
+	path = writeConfig(t, `tunnel: df5ed608-b8b4-4109-89f3-9f2cf199df64
+ingress:
+  - service: ${ORIGIN_SERVICE_NOT_SET?}
+`)
+	doc, problems, err = ParseDocument(path, nil)
+	require.NoError(t, err)
+	assert.Nil(t, doc)
+	assert.Equal(t, []Problem{{
+		File:    path,
+		Line:    3,
+		Column:  14,
+		Message: "environment variable ORIGIN_SERVICE_NOT_SET is required",
+	}}, problems)
+}
@@ -1,12 +1,8 @@
 package config
 
 import (
-	"io"
-	"os"
-
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
-	yaml "gopkg.in/yaml.v3"
 
 	"github.com/cloudflare/cloudflared/watcher"
 )
@@ -74,19 +70,18 @@ func readConfigFromPath(configPath string, log *zerolog.Logger) (Root, error) {
 		return Root{}, errors.New("unable to find config file")
 	}
 
-	file, err := os.Open(configPath)
+	file, err := readYAMLFile(configPath)
 	if err != nil {
 		return Root{}, err
 	}
-	defer file.Close()
+	if file.root == nil {
+		log.Error().Msgf("Configuration file %s was empty", configPath)
+		return Root{}, nil
+	}
 
 	var config Root
-	if err := yaml.NewDecoder(file).Decode(&config); err != nil {
-		if err == io.EOF {
-			log.Error().Msgf("Configuration file %s was empty", configPath)
-			return Root{}, nil
-		}
-		return Root{}, errors.Wrap(err, "error parsing YAML in config file at "+configPath)
+	if err := file.root.Decode(&config); err != nil {
+		return Root{}, errors.Wrapf(err, "error parsing %s in config file at %s", formatOf(configPath), configPath)
 	}
 
 	return config, nil
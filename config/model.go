@@ -15,7 +15,9 @@ type Forwarder struct {
 	Listener      string `json:"listener"`
 	TokenClientID string `json:"service_token_id" yaml:"serviceTokenID"`
 	TokenSecret   string `json:"secret_token_id" yaml:"serviceTokenSecret"`
-	Destination   string `json:"destination"`
+	// Optional file of service tokens re-read when rotated, instead of TokenClientID and TokenSecret
+	TokenFile   string `json:"service_token_file" yaml:"serviceTokenFile"`
+	Destination string `json:"destination"`
 }
 
 // Tunnel represents a tunnel that should be started
@@ -51,6 +53,7 @@ func (f *Forwarder) Hash() string {
 	io.WriteString(h, f.Listener)
 	io.WriteString(h, f.TokenClientID)
 	io.WriteString(h, f.TokenSecret)
+	io.WriteString(h, f.TokenFile)
 	io.WriteString(h, f.Destination)
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
@@ -0,0 +1,354 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yaml.v3 prefixes the errors of a position with its line
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// Problem is an error or a warning found in a configuration file
+type Problem struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+	// Suggestion tells how to fix the problem, when there's an obvious fix
+	Suggestion string
+	Warning    bool
+}
+
+func (p Problem) String() string {
+	severity := "error"
+	if p.Warning {
+		severity = "warning"
+	}
+	var s string
+	if p.Line > 0 {
+		s = fmt.Sprintf("%s:%d:%d: %s: %s", p.File, p.Line, p.Column, severity, p.Message)
+	} else {
+		// TOML files have no positions
+		s = fmt.Sprintf("%s: %s: %s", p.File, severity, p.Message)
+	}
+	if p.Suggestion != "" {
+		s += "\n    " + p.Suggestion
+	}
+	return s
+}
+
+// Document is a configuration file parsed along with the positions of its values, to report problems where they are
+type Document struct {
+	File          string
+	Configuration *Configuration
+	// Settings are the top level keys that aren't part of Configuration, i.e. the flags of cloudflared
+	Settings map[string]interface{}
+	root     *yaml.Node
+	// sources are the files of the nodes of root, which can come from included files
+	sources map[*yaml.Node]string
+}
+
+// ParseDocument parses the configuration file at path, and checks its keys and the types of its values. knownSettings
+// are the flags that can be set at the top level of the file. Problems are returned for invalid YAML, references to
+// environment variables that can't be replaced, unknown keys and values of the wrong type, err only if the file can't
+// be read.
+func ParseDocument(path string, knownSettings []string) (*Document, []Problem, error) {
+	doc := &Document{
+		File:          path,
+		Configuration: &Configuration{sourceFile: path},
+		Settings:      map[string]interface{}{},
+	}
+	file, err := readYAMLFile(path)
+	if err != nil {
+		if fileErr, ok := err.(*fileError); ok {
+			return nil, []Problem{fileErr.problem()}, nil
+		}
+		return nil, nil, err
+	}
+	if file.root == nil {
+		return doc, nil, nil
+	}
+	var problems []Problem
+	for _, unset := range file.warnings {
+		problems = append(problems, unset.problem(true))
+	}
+	doc.root = file.root.Content[0]
+	doc.sources = file.sources
+	if doc.root.Kind != yaml.MappingNode {
+		return nil, []Problem{doc.problemAt(doc.root, "the configuration file must be a mapping of keys to values", "", false)}, nil
+	}
+
+	var settings configFileSettings
+	if err := doc.root.Decode(&settings); err != nil {
+		if typeErr, ok := err.(*yaml.TypeError); ok {
+			for _, message := range typeErr.Errors {
+				problems = append(problems, doc.yamlProblem(fmt.Errorf("%s", message)))
+			}
+		} else {
+			problems = append(problems, doc.yamlProblem(err))
+		}
+	}
+	settings.sourceFile = path
+	doc.Configuration = &settings.Configuration
+	doc.Settings = settings.Settings
+
+	problems = append(problems, doc.checkKeys(doc.root, reflect.TypeOf(Configuration{}), knownSettings)...)
+	SortProblems(problems)
+	return doc, problems, nil
+}
+
+// SortProblems sorts problems by file and position
+func SortProblems(problems []Problem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Column < problems[j].Column
+	})
+}
+
+// Position returns the line and column of the value at path in the document, where path is made of keys of mappings
+// and indexes of sequences, e.g. ("ingress", 2, "service"). It's the position of the deepest parent in the document if
+// there's no such value.
+func (d *Document) Position(path ...interface{}) (line, column int) {
+	node := d.node(path...)
+	if node == nil {
+		return 1, 1
+	}
+	return node.Line, node.Column
+}
+
+// Problem returns a problem of the value at path in the document
+func (d *Document) Problem(message, suggestion string, warning bool, path ...interface{}) Problem {
+	node := d.node(path...)
+	if node == nil {
+		return Problem{File: d.File, Line: 1, Column: 1, Message: message, Suggestion: suggestion, Warning: warning}
+	}
+	return d.problemAt(node, message, suggestion, warning)
+}
+
+func (d *Document) node(path ...interface{}) *yaml.Node {
+	node := d.root
+	if node == nil {
+		return nil
+	}
+	for _, element := range path {
+		next := child(node, element)
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return node
+}
+
+func (d *Document) problemAt(node *yaml.Node, message, suggestion string, warning bool) Problem {
+	return Problem{File: d.fileOf(node), Line: node.Line, Column: node.Column, Message: message, Suggestion: suggestion, Warning: warning}
+}
+
+// fileOf returns the file of node, which is either the configuration file or a file it includes
+func (d *Document) fileOf(node *yaml.Node) string {
+	if file, ok := d.sources[node]; ok {
+		return file
+	}
+	return d.File
+}
+
+// yamlProblem converts an error of yaml.v3 to a problem at its line
+func (d *Document) yamlProblem(err error) Problem {
+	match := yamlErrorLine.FindStringSubmatch(err.Error())
+	if match == nil {
+		return Problem{File: d.File, Line: 1, Column: 1, Message: err.Error()}
+	}
+	line, _ := strconv.Atoi(match[1])
+	// yaml.v3 only reports lines, the value on the line is the most likely culprit. The line can be in any of the
+	// included files, the first one is the most likely.
+	var culprit *yaml.Node
+	walk(d.root, func(node *yaml.Node) {
+		if node.Line != line {
+			return
+		}
+		if culprit == nil || (d.fileOf(node) == d.fileOf(culprit) && node.Column > culprit.Column) {
+			culprit = node
+		}
+	})
+	if culprit == nil {
+		return Problem{File: d.File, Line: line, Column: 1, Message: match[2]}
+	}
+	return d.problemAt(culprit, match[2], "", false)
+}
+
+// problem converts the error of a file to a problem at its position
+func (e *fileError) problem() Problem {
+	if err, ok := e.err.(*nodeError); ok {
+		return err.problem(false)
+	}
+	line, message := 1, e.err.Error()
+	if match := yamlErrorLine.FindStringSubmatch(message); match != nil {
+		line, _ = strconv.Atoi(match[1])
+		message = match[2]
+	}
+	return Problem{File: e.file, Line: line, Column: 1, Message: message}
+}
+
+func (e *nodeError) problem(warning bool) Problem {
+	return Problem{File: e.file, Line: e.line, Column: e.column, Message: e.message, Warning: warning}
+}
+
+// checkKeys reports the keys of node that aren't fields of the struct t, nor in extraKeys
+func (d *Document) checkKeys(node *yaml.Node, t reflect.Type, extraKeys []string) []Problem {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var problems []Problem
+	switch {
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if fieldType, ok := fields[key.Value]; ok {
+				problems = append(problems, d.checkKeys(value, fieldType, nil)...)
+				continue
+			}
+			if containsString(extraKeys, key.Value) {
+				continue
+			}
+			candidates := append([]string{}, extraKeys...)
+			for name := range fields {
+				candidates = append(candidates, name)
+			}
+			var suggestion string
+			if match := ClosestMatch(key.Value, candidates); match != "" {
+				suggestion = fmt.Sprintf("did you mean %q?", match)
+			}
+			problems = append(problems, d.problemAt(key, fmt.Sprintf("unknown key %q", key.Value), suggestion, false))
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 1; i < len(node.Content); i += 2 {
+			problems = append(problems, d.checkKeys(node.Content[i], t.Elem(), nil)...)
+		}
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for _, element := range node.Content {
+			problems = append(problems, d.checkKeys(element, t.Elem(), nil)...)
+		}
+	}
+	return problems
+}
+
+// yamlFields returns the types of the fields of the struct t by their key in YAML documents
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		if containsString(tag[1:], "inline") {
+			if field.Type.Kind() == reflect.Struct {
+				for name, fieldType := range yamlFields(field.Type) {
+					fields[name] = fieldType
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func child(node *yaml.Node, element interface{}) *yaml.Node {
+	switch element := element.(type) {
+	case string:
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == element {
+					return node.Content[i+1]
+				}
+			}
+		}
+	case int:
+		if node.Kind == yaml.SequenceNode && element >= 0 && element < len(node.Content) {
+			return node.Content[element]
+		}
+	}
+	return nil
+}
+
+func walk(node *yaml.Node, visit func(*yaml.Node)) {
+	if node == nil {
+		return
+	}
+	visit(node)
+	for _, c := range node.Content {
+		walk(c, visit)
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ClosestMatch returns the candidate that's the closest to name, if it's close enough to be a typo of name
+func ClosestMatch(name string, candidates []string) string {
+	closest, closestDistance := "", len(name)/3+2
+	for _, candidate := range candidates {
+		d := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if d < closestDistance || (d == closestDistance && candidate < closest) {
+			closest, closestDistance = candidate, d
+		}
+	}
+	return closest
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
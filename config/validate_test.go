@@ -0,0 +1,75 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestParseDocument(t *testing.T) {
+	path := writeConfig(t, `tunnel: df5ed608-b8b4-4109-89f3-9f2cf199df64
+loglevel: debug
+protocl: quic
+originRequest:
+  connectTimeout: 10s
+  noTLSVerfy: true
+ingress:
+  - hostname: example.com
+    service: http://localhost:8000
+    originRequest:
+      keepAliveConnections: many
+  - service: http_status:404
+`)
+	doc, problems, err := ParseDocument(path, []string{"loglevel", "protocol"})
+	require.NoError(t, err)
+	assert.Equal(t, "df5ed608-b8b4-4109-89f3-9f2cf199df64", doc.Configuration.TunnelID)
+	assert.Equal(t, "debug", doc.Settings["loglevel"])
+	require.Len(t, doc.Configuration.Ingress, 2)
+
+	require.Len(t, problems, 3)
+	assert.Equal(t, Problem{File: path, Line: 3, Column: 1, Message: `unknown key "protocl"`, Suggestion: `did you mean "protocol"?`}, problems[0])
+	assert.Equal(t, Problem{File: path, Line: 6, Column: 3, Message: `unknown key "noTLSVerfy"`, Suggestion: `did you mean "noTLSVerify"?`}, problems[1])
+	assert.Equal(t, 11, problems[2].Line)
+	assert.Equal(t, 29, problems[2].Column)
+	assert.Contains(t, problems[2].Message, "cannot unmarshal !!str `many` into int")
+
+	line, column := doc.Position("ingress", 1, "service")
+	assert.Equal(t, 12, line)
+	assert.Equal(t, 14, column)
+	// Missing values are located at their deepest parent
+	line, column = doc.Position("ingress", 1, "originRequest", "caPool")
+	assert.Equal(t, 12, line)
+	assert.Equal(t, 5, column)
+}
+
+func TestParseDocumentInvalidYAML(t *testing.T) {
+	path := writeConfig(t, "tunnel: abc\nhostname: example.com: 8000\n")
+	doc, problems, err := ParseDocument(path, nil)
+	require.NoError(t, err)
+	assert.Nil(t, doc)
+	require.Len(t, problems, 1)
+	assert.Equal(t, 2, problems[0].Line)
+	assert.Equal(t, "mapping values are not allowed in this context", problems[0].Message)
+	assert.False(t, problems[0].Warning)
+
+	_, _, err = ParseDocument(filepath.Join(t.TempDir(), "missing.yml"), nil)
+	assert.Error(t, err)
+}
+
+func TestClosestMatch(t *testing.T) {
+	candidates := []string{"originRequest", "ingress", "tunnel", "warp-routing"}
+	assert.Equal(t, "originRequest", ClosestMatch("originrequest", candidates))
+	assert.Equal(t, "ingress", ClosestMatch("ingres", candidates))
+	assert.Equal(t, "warp-routing", ClosestMatch("warp_routing", candidates))
+	assert.Equal(t, "", ClosestMatch("credentials-file", candidates))
+	assert.Equal(t, "", ClosestMatch("ab", candidates))
+}
@@ -6,14 +6,17 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 
+	"github.com/cloudflare/cloudflared/ingress"
 	"github.com/cloudflare/cloudflared/tracing"
 	"github.com/cloudflare/cloudflared/tunnelrpc/pogs"
 	"github.com/cloudflare/cloudflared/websocket"
@@ -38,6 +41,24 @@ type NamedTunnelProperties struct {
 	Credentials    Credentials
 	Client         pogs.ClientInfo
 	QuickTunnelUrl string
+
+	// secretLock guards the secret of Credentials, which is refreshed while the tunnel runs
+	secretLock sync.RWMutex
+}
+
+// Auth returns the authentication the connections of the tunnel register with, with its latest secret
+func (p *NamedTunnelProperties) Auth() pogs.TunnelAuth {
+	p.secretLock.RLock()
+	defer p.secretLock.RUnlock()
+	return p.Credentials.Auth()
+}
+
+// RefreshSecret replaces the secret of the tunnel. The connections registered from now on authenticate with it, the
+// ones already registered are kept.
+func (p *NamedTunnelProperties) RefreshSecret(secret []byte) {
+	p.secretLock.Lock()
+	defer p.secretLock.Unlock()
+	p.Credentials.TunnelSecret = secret
 }
 
 // Credentials are stored in the credentials file and contain all info needed to run a tunnel.
@@ -61,6 +82,20 @@ type TunnelToken struct {
 	TunnelID     uuid.UUID `json:"t"`
 }
 
+// ParseTunnelToken parses the base64 encoded token of a tunnel
+func ParseTunnelToken(tokenStr string) (*TunnelToken, error) {
+	content, err := base64.StdEncoding.DecodeString(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var token TunnelToken
+	if err := json.Unmarshal(content, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
 func (t TunnelToken) Credentials() Credentials {
 	return Credentials{
 		AccountTag:   t.AccountTag,
@@ -125,6 +160,8 @@ func (t Type) String() string {
 type OriginProxy interface {
 	ProxyHTTP(w ResponseWriter, tr *tracing.TracedHTTPRequest, isWebsocket bool) error
 	ProxyTCP(ctx context.Context, rwa ReadWriteAcker, req *TCPRequest) error
+	// DialUDPSession dials the origin of a UDP session to dstIP:dstPort, unless it isn't allowed
+	DialUDPSession(sessionID uuid.UUID, dstIP net.IP, dstPort uint16) (ingress.UDPProxy, error)
 }
 
 // TCPRequest defines the input format needed to perform a TCP proxy.
@@ -192,6 +229,12 @@ type ResponseWriter interface {
 	io.Writer
 }
 
+// ResponseFlusher is implemented by the ResponseWriters that buffer what's written, to send it to the eyeball right
+// away
+type ResponseFlusher interface {
+	Flush()
+}
+
 type ConnectedFuse interface {
 	Connected()
 	IsConnected() bool
@@ -5,13 +5,16 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"net/http"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/cloudflare/cloudflared/ingress"
 	"github.com/cloudflare/cloudflared/tracing"
 	tunnelpogs "github.com/cloudflare/cloudflared/tunnelrpc/pogs"
 	"github.com/cloudflare/cloudflared/websocket"
@@ -103,6 +106,10 @@ func (moc *mockOriginProxy) ProxyTCP(
 	return nil
 }
 
+func (moc *mockOriginProxy) DialUDPSession(sessionID uuid.UUID, dstIP net.IP, dstPort uint16) (ingress.UDPProxy, error) {
+	return ingress.DialUDP(dstIP, dstPort)
+}
+
 type echoPipe struct {
 	reader *io.PipeReader
 	writer *io.PipeWriter
@@ -229,6 +236,16 @@ func TestIsEventStream(t *testing.T) {
 	}
 }
 
+func TestNamedTunnelRefreshSecret(t *testing.T) {
+	properties := &NamedTunnelProperties{
+		Credentials: Credentials{AccountTag: "account", TunnelSecret: []byte("secret"), TunnelID: uuid.New()},
+	}
+	assert.Equal(t, tunnelpogs.TunnelAuth{AccountTag: "account", TunnelSecret: []byte("secret")}, properties.Auth())
+
+	properties.RefreshSecret([]byte("refreshed"))
+	assert.Equal(t, tunnelpogs.TunnelAuth{AccountTag: "account", TunnelSecret: []byte("refreshed")}, properties.Auth())
+}
+
 func newHeader(key, value string) http.Header {
 	header := http.Header{}
 	header.Add(key, value)
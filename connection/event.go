@@ -1,12 +1,20 @@
 package connection
 
+import "net"
+
 // Event is something that happened to a connection, e.g. disconnection or registration.
 type Event struct {
 	Index     uint8
 	EventType Status
 	Location  string
-	Protocol  Protocol
-	URL       string
+	// EdgeAddress is the address of the edge a Connected connection is connected to, if it's known
+	EdgeAddress net.IP
+	Protocol    Protocol
+	URL         string
+	// Features is how the features of a Connected connection were negotiated, if it's a named tunnel
+	Features *FeatureNegotiation
+	// Err is the error a Disconnected connection failed with, if any
+	Err error
 }
 
 // Status is the status of a connection.
@@ -0,0 +1,57 @@
+package connection
+
+import (
+	tunnelpogs "github.com/cloudflare/cloudflared/tunnelrpc/pogs"
+)
+
+const (
+	// FeatureAllowRemoteConfig is the feature that lets the edge manage the configuration of the tunnel
+	FeatureAllowRemoteConfig = "allow_remote_config"
+
+	// datagramVersionV1 is the version of the datagrams QUIC connections proxy UDP with
+	datagramVersionV1 = "v1"
+)
+
+// FeatureNegotiation is which features a connection offered to the edge when it registered, and which of them the
+// edge negotiated or rejected, or which don't apply to the tunnel. The edge only acknowledges some features, the others
+// are in none of these.
+type FeatureNegotiation struct {
+	Offered    []string `json:"offered"`
+	Negotiated []string `json:"negotiated"`
+	Rejected   []string `json:"rejected"`
+	// NotApplicable are the features that don't apply to the tunnel, e.g. allow_remote_config when its configuration
+	// is managed locally
+	NotApplicable []string `json:"notApplicable"`
+	// DatagramVersion is the version of the datagrams the connection proxies UDP with, empty if it can't proxy UDP
+	DatagramVersion string `json:"datagramVersion,omitempty"`
+}
+
+// negotiateFeatures returns how the features offered in connOptions were negotiated by the edge, from the details of
+// the registration of a connection over protocol.
+func negotiateFeatures(protocol Protocol, connOptions *tunnelpogs.ConnectionOptions, details *tunnelpogs.ConnectionDetails) *FeatureNegotiation {
+	negotiation := &FeatureNegotiation{
+		Offered:       []string{},
+		Negotiated:    []string{},
+		Rejected:      []string{},
+		NotApplicable: []string{},
+	}
+	if connOptions != nil {
+		negotiation.Offered = append(negotiation.Offered, connOptions.Client.Features...)
+	}
+	for _, feature := range negotiation.Offered {
+		if feature != FeatureAllowRemoteConfig || details == nil {
+			continue
+		}
+		// The edge doesn't refuse to manage the configuration of a tunnel, it only does for the tunnels created to be
+		// managed remotely
+		if details.TunnelIsRemotelyManaged {
+			negotiation.Negotiated = append(negotiation.Negotiated, feature)
+		} else {
+			negotiation.NotApplicable = append(negotiation.NotApplicable, feature)
+		}
+	}
+	if protocol == QUIC {
+		negotiation.DatagramVersion = datagramVersionV1
+	}
+	return negotiation
+}
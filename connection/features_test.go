@@ -0,0 +1,32 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	tunnelpogs "github.com/cloudflare/cloudflared/tunnelrpc/pogs"
+)
+
+func TestNegotiateFeatures(t *testing.T) {
+	connOptions := &tunnelpogs.ConnectionOptions{
+		Client: tunnelpogs.ClientInfo{Features: []string{FeatureAllowRemoteConfig, "serialized_headers"}},
+	}
+
+	negotiation := negotiateFeatures(QUIC, connOptions, &tunnelpogs.ConnectionDetails{TunnelIsRemotelyManaged: true})
+	assert.Equal(t, &FeatureNegotiation{
+		Offered:         []string{FeatureAllowRemoteConfig, "serialized_headers"},
+		Negotiated:      []string{FeatureAllowRemoteConfig},
+		Rejected:        []string{},
+		NotApplicable:   []string{},
+		DatagramVersion: "v1",
+	}, negotiation)
+
+	negotiation = negotiateFeatures(HTTP2, connOptions, &tunnelpogs.ConnectionDetails{})
+	assert.Equal(t, &FeatureNegotiation{
+		Offered:       []string{FeatureAllowRemoteConfig, "serialized_headers"},
+		Negotiated:    []string{},
+		Rejected:      []string{},
+		NotApplicable: []string{FeatureAllowRemoteConfig},
+	}, negotiation)
+}
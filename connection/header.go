@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 
@@ -42,65 +43,82 @@ func mustInitRespMetaHeader(src string) string {
 
 var headerEncoding = base64.RawStdEncoding
 
-// IsControlResponseHeader is called in the direction of eyeball <- origin.
+// IsControlResponseHeader is called in the direction of eyeball <- origin. headerName is matched case-insensitively.
 func IsControlResponseHeader(headerName string) bool {
 	return strings.HasPrefix(headerName, ":") ||
-		strings.HasPrefix(headerName, "cf-int-") ||
-		strings.HasPrefix(headerName, "cf-cloudflared-")
+		hasPrefixFold(headerName, "cf-int-") ||
+		hasPrefixFold(headerName, "cf-cloudflared-")
 }
 
-// isWebsocketClientHeader returns true if the header name is required by the client to upgrade properly
+// isWebsocketClientHeader returns true if the header name is required by the client to upgrade properly. headerName is
+// matched case-insensitively.
 func IsWebsocketClientHeader(headerName string) bool {
-	return headerName == "sec-websocket-accept" ||
-		headerName == "connection" ||
-		headerName == "upgrade"
+	return strings.EqualFold(headerName, "sec-websocket-accept") ||
+		strings.EqualFold(headerName, "connection") ||
+		strings.EqualFold(headerName, "upgrade")
 }
 
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// headerBufferPool holds the buffers headers are serialized in, so that serializing the headers of each response
+// only allocates the resulting string
+var headerBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 1024)
+		return &buf
+	},
+}
+
+// maxPooledHeaderBufferSize is the capacity above which a buffer isn't returned to headerBufferPool, so that a few
+// responses with huge headers don't keep their buffers alive
+const maxPooledHeaderBufferSize = 64 * 1024
+
 // Serialize HTTP1.x headers by base64-encoding each header name and value,
 // and then joining them in the format of [key:value;]
 func SerializeHeaders(h1Headers http.Header) string {
-	// compute size of the fully serialized value and largest temp buffer we will need
-	serializedLen := 0
-	maxTempLen := 0
+	return serializeHeaders(h1Headers, nil)
+}
+
+// serializeHeaders serializes the headers for which include returns true, or all of them if include is nil
+func serializeHeaders(h1Headers http.Header, include func(headerName string) bool) string {
+	bufp := headerBufferPool.Get().(*[]byte)
+	buf := (*bufp)[:0]
 	for headerName, headerValues := range h1Headers {
+		if include != nil && !include(headerName) {
+			continue
+		}
 		for _, headerValue := range headerValues {
-			nameLen := headerEncoding.EncodedLen(len(headerName))
-			valueLen := headerEncoding.EncodedLen(len(headerValue))
-			const delims = 2
-			serializedLen += delims + nameLen + valueLen
-			if nameLen > maxTempLen {
-				maxTempLen = nameLen
-			}
-			if valueLen > maxTempLen {
-				maxTempLen = valueLen
+			if len(buf) > 0 {
+				buf = append(buf, ';')
 			}
+			buf = appendBase64(buf, headerName)
+			buf = append(buf, ':')
+			buf = appendBase64(buf, headerValue)
 		}
 	}
-	var buf strings.Builder
-	buf.Grow(serializedLen)
-
-	temp := make([]byte, maxTempLen)
-	writeB64 := func(s string) {
-		n := headerEncoding.EncodedLen(len(s))
-		if n > len(temp) {
-			temp = make([]byte, n)
-		}
-		headerEncoding.Encode(temp[:n], []byte(s))
-		buf.Write(temp[:n])
+	serialized := string(buf)
+	if cap(buf) <= maxPooledHeaderBufferSize {
+		*bufp = buf
+		headerBufferPool.Put(bufp)
 	}
+	return serialized
+}
 
-	for headerName, headerValues := range h1Headers {
-		for _, headerValue := range headerValues {
-			if buf.Len() > 0 {
-				buf.WriteByte(';')
-			}
-			writeB64(headerName)
-			buf.WriteByte(':')
-			writeB64(headerValue)
-		}
+// appendBase64 appends the base64 encoding of s to buf. s is encoded in chunks copied to the stack rather than
+// converted to a []byte, which would allocate.
+func appendBase64(buf []byte, s string) []byte {
+	// A multiple of 3 bytes, so that the encodings of the chunks have no padding and can be concatenated
+	var chunk [96]byte
+	for len(s) > 0 {
+		n := copy(chunk[:], s)
+		s = s[n:]
+		encodedLen := headerEncoding.EncodedLen(n)
+		buf = append(buf, make([]byte, encodedLen)...)
+		headerEncoding.Encode(buf[len(buf)-encodedLen:], chunk[:n])
 	}
-
-	return buf.String()
+	return buf
 }
 
 // Deserialize headers serialized by `SerializeHeader`
@@ -91,6 +91,9 @@ func TestIsControlResponseHeader(t *testing.T) {
 		"cf-cloudflared-sample-header",
 		// Any http2 pseudoheader
 		":sample-pseudo-header",
+		// Header names are case-insensitive
+		"Cf-Int-Sample-Header",
+		"CF-CLOUDFLARED-SAMPLE-HEADER",
 	}
 
 	for _, header := range controlResponseHeaders {
@@ -111,3 +114,18 @@ func TestIsNotControlResponseHeader(t *testing.T) {
 		assert.False(t, IsControlResponseHeader(header))
 	}
 }
+
+func BenchmarkSerializeHeaders(b *testing.B) {
+	headers := http.Header{
+		"Content-Type":   {"application/json; charset=utf-8"},
+		"Content-Length": {"1024"},
+		"Cache-Control":  {"private, max-age=0, no-cache"},
+		"Set-Cookie":     {"session=0123456789abcdef0123456789abcdef; Path=/; Secure; HttpOnly", "theme=dark; Path=/"},
+		"Date":           {"Tue, 15 Nov 1994 08:12:31 GMT"},
+		"Server":         {"nginx"},
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		SerializeHeaders(headers)
+	}
+}
@@ -2,6 +2,7 @@ package connection
 
 import (
 	"context"
+	"crypto/tls"
 	gojson "encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"runtime/debug"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -30,6 +32,31 @@ const (
 
 var errEdgeConnectionClosed = fmt.Errorf("connection with edge closed")
 
+// HTTP2Config tunes the HTTP/2 connections with the edge, for example to make use of high bandwidth-delay product
+// links. Zero values keep the defaults.
+type HTTP2Config struct {
+	// InitialConnectionWindowSize is the flow-control window of a connection, in bytes, for the data sent by the edge
+	InitialConnectionWindowSize int32
+	// InitialStreamWindowSize is the flow-control window of each stream, in bytes, for the data sent by the edge
+	InitialStreamWindowSize int32
+	// MaxConcurrentStreams is the maximum number of streams the edge can open on a connection
+	MaxConcurrentStreams uint32
+	// PingTimeout closes a connection when nothing, including pings, is received from the edge for this long
+	PingTimeout time.Duration
+}
+
+func (c HTTP2Config) server() *http2.Server {
+	maxConcurrentStreams := c.MaxConcurrentStreams
+	if maxConcurrentStreams == 0 {
+		maxConcurrentStreams = MaxConcurrentStreams
+	}
+	return &http2.Server{
+		MaxConcurrentStreams:         maxConcurrentStreams,
+		MaxUploadBufferPerConnection: c.InitialConnectionWindowSize,
+		MaxUploadBufferPerStream:     c.InitialStreamWindowSize,
+	}
+}
+
 // HTTP2Connection represents a net.Conn that uses HTTP2 frames to proxy traffic from the edge to cloudflared on the
 // origin.
 type HTTP2Connection struct {
@@ -54,16 +81,18 @@ func NewHTTP2Connection(
 	conn net.Conn,
 	orchestrator Orchestrator,
 	connOptions *tunnelpogs.ConnectionOptions,
+	http2Config HTTP2Config,
 	observer *Observer,
 	connIndex uint8,
 	controlStreamHandler ControlStreamHandler,
 	log *zerolog.Logger,
 ) *HTTP2Connection {
+	if http2Config.PingTimeout > 0 {
+		conn = newReadTimeoutConn(conn, http2Config.PingTimeout)
+	}
 	return &HTTP2Connection{
-		conn: conn,
-		server: &http2.Server{
-			MaxConcurrentStreams: MaxConcurrentStreams,
-		},
+		conn:                 conn,
+		server:               http2Config.server(),
 		orchestrator:         orchestrator,
 		connOptions:          connOptions,
 		observer:             observer,
@@ -189,6 +218,43 @@ func (c *HTTP2Connection) close() {
 	c.conn.Close()
 }
 
+// readTimeoutConn fails reads when nothing is received for timeout
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+// tlsReadTimeoutConn is a readTimeoutConn of a TLS connection, keeping its ConnectionState for the http2 server
+type tlsReadTimeoutConn struct {
+	*readTimeoutConn
+	tlsConn *tls.Conn
+}
+
+func newReadTimeoutConn(conn net.Conn, timeout time.Duration) net.Conn {
+	timeoutConn := &readTimeoutConn{
+		Conn:    conn,
+		timeout: timeout,
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		return &tlsReadTimeoutConn{
+			readTimeoutConn: timeoutConn,
+			tlsConn:         tlsConn,
+		}
+	}
+	return timeoutConn
+}
+
+func (c *tlsReadTimeoutConn) ConnectionState() tls.ConnectionState {
+	return c.tlsConn.ConnectionState()
+}
+
+func (c *readTimeoutConn) Read(p []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
+
 type http2RespWriter struct {
 	r           io.Reader
 	w           http.ResponseWriter
@@ -220,32 +286,22 @@ func NewHTTP2RespWriter(r *http.Request, w http.ResponseWriter, connType Type, l
 
 func (rp *http2RespWriter) WriteRespHeaders(status int, header http.Header) error {
 	dest := rp.w.Header()
-	userHeaders := make(http.Header, len(header))
 	for name, values := range header {
-		// Since these are http2 headers, they're required to be lowercase
-		h2name := strings.ToLower(name)
-
-		if h2name == "content-length" {
+		// Header names are case-insensitive, but these are compared without lowercasing them to not allocate
+		if strings.EqualFold(name, "content-length") {
 			// This header has meaning in HTTP/2 and will be used by the edge,
 			// so it should be sent *also* as an HTTP/2 response header.
 			dest[name] = values
 		}
 
-		if h2name == tracing.IntCloudflaredTracingHeader {
+		if strings.EqualFold(name, tracing.IntCloudflaredTracingHeader) {
 			// Add cf-int-cloudflared-tracing header outside of serialized userHeaders
-			rp.w.Header()[tracing.CanonicalCloudflaredTracingHeader] = values
-			continue
-		}
-
-		if !IsControlResponseHeader(h2name) || IsWebsocketClientHeader(h2name) {
-			// User headers, on the other hand, must all be serialized so that
-			// HTTP/2 header validation won't be applied to HTTP/1 header values
-			userHeaders[name] = values
+			dest[tracing.CanonicalCloudflaredTracingHeader] = values
 		}
 	}
 
 	// Perform user header serialization and set them in the single header
-	dest.Set(CanonicalResponseUserHeaders, SerializeHeaders(userHeaders))
+	dest.Set(CanonicalResponseUserHeaders, serializeHeaders(header, isUserResponseHeader))
 	rp.setResponseMetaHeader(responseMetaHeaderOrigin)
 	// HTTP2 removes support for 101 Switching Protocols https://tools.ietf.org/html/rfc7540#section-8.1.1
 	if status == http.StatusSwitchingProtocols {
@@ -261,6 +317,15 @@ func (rp *http2RespWriter) WriteRespHeaders(status int, header http.Header) erro
 	return nil
 }
 
+// isUserResponseHeader returns true for the headers of the origin that are serialized in the user headers of a response.
+// They must all be serialized so that HTTP/2 header validation won't be applied to HTTP/1 header values.
+func isUserResponseHeader(name string) bool {
+	if strings.EqualFold(name, tracing.IntCloudflaredTracingHeader) {
+		return false
+	}
+	return !IsControlResponseHeader(name) || IsWebsocketClientHeader(name)
+}
+
 func (rp *http2RespWriter) WriteErrorResponse() {
 	rp.setResponseMetaHeader(responseMetaHeaderCfd)
 	rp.w.WriteHeader(http.StatusBadGateway)
@@ -289,6 +354,15 @@ func (rp *http2RespWriter) Write(p []byte) (n int, err error) {
 	return n, err
 }
 
+func (rp *http2RespWriter) Flush() {
+	defer func() {
+		if r := recover(); r != nil {
+			rp.log.Debug().Msgf("Recover from http2 response writer panic, error %s", debug.Stack())
+		}
+	}()
+	rp.flusher.Flush()
+}
+
 func (rp *http2RespWriter) Close() error {
 	return nil
 }
@@ -30,6 +30,10 @@ var (
 )
 
 func newTestHTTP2Connection() (*HTTP2Connection, net.Conn) {
+	return newTestHTTP2ConnectionWithConfig(HTTP2Config{})
+}
+
+func newTestHTTP2ConnectionWithConfig(http2Config HTTP2Config) (*HTTP2Connection, net.Conn) {
 	edgeConn, cfdConn := net.Pipe()
 	var connIndex = uint8(0)
 	log := zerolog.Nop()
@@ -50,6 +54,7 @@ func newTestHTTP2Connection() (*HTTP2Connection, net.Conn) {
 		// OriginProxy is set in testConfigManager
 		testOrchestrator,
 		&pogs.ConnectionOptions{},
+		http2Config,
 		obs,
 		connIndex,
 		controlStream,
@@ -92,6 +97,54 @@ func TestHTTP2ConfigurationSet(t *testing.T) {
 
 }
 
+func TestHTTP2Config(t *testing.T) {
+	http2Conn, edgeConn := newTestHTTP2ConnectionWithConfig(HTTP2Config{
+		InitialConnectionWindowSize: 1 << 20,
+		InitialStreamWindowSize:     1 << 18,
+		MaxConcurrentStreams:        100,
+		PingTimeout:                 100 * time.Millisecond,
+	})
+
+	serveErrC := make(chan error, 1)
+	go func() {
+		serveErrC <- http2Conn.Serve(context.Background())
+	}()
+
+	go func() {
+		_, _ = edgeConn.Write([]byte(http2.ClientPreface))
+	}()
+	framer := http2.NewFramer(edgeConn, edgeConn)
+	frame, err := framer.ReadFrame()
+	require.NoError(t, err)
+	settings, ok := frame.(*http2.SettingsFrame)
+	require.True(t, ok)
+	maxConcurrentStreams, _ := settings.Value(http2.SettingMaxConcurrentStreams)
+	assert.Equal(t, uint32(100), maxConcurrentStreams)
+	streamWindowSize, _ := settings.Value(http2.SettingInitialWindowSize)
+	assert.Equal(t, uint32(1<<18), streamWindowSize)
+
+	frame, err = framer.ReadFrame()
+	require.NoError(t, err)
+	windowUpdate, ok := frame.(*http2.WindowUpdateFrame)
+	require.True(t, ok)
+	assert.Equal(t, uint32(1<<20-65535), windowUpdate.Increment)
+
+	// The edge stops sending anything after the preface
+	go func() {
+		for {
+			if _, err := framer.ReadFrame(); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-serveErrC:
+		assert.Equal(t, errEdgeConnectionClosed, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection wasn't closed after the ping timeout")
+	}
+}
+
 func TestServeHTTP(t *testing.T) {
 	tests := []testRequest{
 		{
@@ -538,6 +591,7 @@ func benchmarkServeHTTP(b *testing.B, test testRequest) {
 	edgeHTTP2Conn, err := testTransport.NewClientConn(edgeConn)
 	require.NoError(b, err)
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		b.StartTimer()
@@ -42,7 +42,7 @@ func (o *Observer) RegisterSink(sink EventSink) {
 }
 
 func (o *Observer) logServerInfo(connIndex uint8, location string, address net.IP, msg string) {
-	o.sendEvent(Event{Index: connIndex, EventType: Connected, Location: location})
+	o.sendEvent(Event{Index: connIndex, EventType: Connected, Location: location, EdgeAddress: address})
 	o.log.Info().
 		Uint8(LogFieldConnIndex, connIndex).
 		Str(LogFieldLocation, location).
@@ -55,8 +55,8 @@ func (o *Observer) sendRegisteringEvent(connIndex uint8) {
 	o.sendEvent(Event{Index: connIndex, EventType: RegisteringTunnel})
 }
 
-func (o *Observer) sendConnectedEvent(connIndex uint8, protocol Protocol, location string) {
-	o.sendEvent(Event{Index: connIndex, EventType: Connected, Protocol: protocol, Location: location})
+func (o *Observer) sendConnectedEvent(connIndex uint8, protocol Protocol, location string, edgeAddress net.IP, features *FeatureNegotiation) {
+	o.sendEvent(Event{Index: connIndex, EventType: Connected, Protocol: protocol, Location: location, EdgeAddress: edgeAddress, Features: features})
 }
 
 func (o *Observer) SendURL(url string) {
@@ -78,8 +78,9 @@ func (o *Observer) sendUnregisteringEvent(connIndex uint8) {
 	o.sendEvent(Event{Index: connIndex, EventType: Unregistering})
 }
 
-func (o *Observer) SendDisconnect(connIndex uint8) {
-	o.sendEvent(Event{Index: connIndex, EventType: Disconnected})
+// SendDisconnect reports that the connection was disconnected, with the error it failed with if any
+func (o *Observer) SendDisconnect(connIndex uint8, err error) {
+	o.sendEvent(Event{Index: connIndex, EventType: Disconnected, Err: err})
 }
 
 func (o *Observer) sendEvent(e Event) {
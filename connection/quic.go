@@ -18,7 +18,6 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/cloudflare/cloudflared/datagramsession"
-	"github.com/cloudflare/cloudflared/ingress"
 	quicpogs "github.com/cloudflare/cloudflared/quic"
 	"github.com/cloudflare/cloudflared/tracing"
 	tunnelpogs "github.com/cloudflare/cloudflared/tunnelrpc/pogs"
@@ -48,19 +47,34 @@ type QUICConnection struct {
 	datagramMuxer        *quicpogs.DatagramMuxer
 	controlStreamHandler ControlStreamHandler
 	connOptions          *tunnelpogs.ConnectionOptions
+	// packetConn is the socket of the connection, if it wasn't opened by quic-go
+	packetConn net.PacketConn
 }
 
-// NewQUICConnection returns a new instance of QUICConnection.
+// NewQUICConnection returns a new instance of QUICConnection. The connection uses packetConn, which is closed with
+// the connection, or a socket of its own if it's nil.
 func NewQUICConnection(
 	quicConfig *quic.Config,
 	edgeAddr net.Addr,
+	packetConn net.PacketConn,
 	tlsConfig *tls.Config,
 	orchestrator Orchestrator,
 	connOptions *tunnelpogs.ConnectionOptions,
 	controlStreamHandler ControlStreamHandler,
 	logger *zerolog.Logger,
 ) (*QUICConnection, error) {
-	session, err := quic.DialAddr(edgeAddr.String(), tlsConfig, quicConfig)
+	var (
+		session quic.Connection
+		err     error
+	)
+	if packetConn != nil {
+		session, err = quic.Dial(packetConn, edgeAddr, edgeAddr.String(), tlsConfig, quicConfig)
+		if err != nil {
+			_ = packetConn.Close()
+		}
+	} else {
+		session, err = quic.DialAddr(edgeAddr.String(), tlsConfig, quicConfig)
+	}
 	if err != nil {
 		return nil, &EdgeQuicDialError{Cause: err}
 	}
@@ -77,6 +91,7 @@ func NewQUICConnection(
 		datagramMuxer:        datagramMuxer,
 		controlStreamHandler: controlStreamHandler,
 		connOptions:          connOptions,
+		packetConn:           packetConn,
 	}, nil
 }
 
@@ -133,6 +148,9 @@ func (q *QUICConnection) serveControlStream(ctx context.Context, controlStream q
 // Close closes the session with no errors specified.
 func (q *QUICConnection) Close() {
 	q.session.CloseWithError(0, "")
+	if q.packetConn != nil {
+		_ = q.packetConn.Close()
+	}
 }
 
 func (q *QUICConnection) acceptStream(ctx context.Context) error {
@@ -236,7 +254,11 @@ func (q *QUICConnection) handleRPCStream(rpcStream *quicpogs.RPCServerStream) er
 func (q *QUICConnection) RegisterUdpSession(ctx context.Context, sessionID uuid.UUID, dstIP net.IP, dstPort uint16, closeAfterIdleHint time.Duration) error {
 	// Each session is a series of datagram from an eyeball to a dstIP:dstPort.
 	// (src port, dst IP, dst port) uniquely identifies a session, so it needs a dedicated connected socket.
-	originProxy, err := ingress.DialUDP(dstIP, dstPort)
+	proxy, err := q.orchestrator.GetOriginProxy()
+	if err != nil {
+		return err
+	}
+	originProxy, err := proxy.DialUDPSession(sessionID, dstIP, dstPort)
 	if err != nil {
 		q.logger.Err(err).Msgf("Failed to create udp proxy to %s:%d", dstIP, dstPort)
 		return err
@@ -327,11 +349,15 @@ func newHTTPResponseAdapter(s *quicpogs.RequestServerStream) httpResponseAdapter
 }
 
 func (hrw httpResponseAdapter) WriteRespHeaders(status int, header http.Header) error {
-	metadata := make([]quicpogs.Metadata, 0)
+	size := 1
+	for _, vv := range header {
+		size += len(vv)
+	}
+	metadata := make([]quicpogs.Metadata, 0, size)
 	metadata = append(metadata, quicpogs.Metadata{Key: "HttpStatus", Val: strconv.Itoa(status)})
 	for k, vv := range header {
+		httpHeaderKey := HTTPHeaderKey + ":" + k
 		for _, v := range vv {
-			httpHeaderKey := fmt.Sprintf("%s:%s", HTTPHeaderKey, k)
 			metadata = append(metadata, quicpogs.Metadata{Key: httpHeaderKey, Val: v})
 		}
 	}
@@ -348,10 +374,19 @@ func buildHTTPRequest(
 	body io.ReadCloser,
 	log *zerolog.Logger,
 ) (*tracing.TracedHTTPRequest, error) {
-	metadata := connectRequest.MetadataMap()
+	var method, host string
+	headers := 0
+	for _, metadata := range connectRequest.Metadata {
+		switch {
+		case metadata.Key == HTTPMethodKey:
+			method = metadata.Val
+		case metadata.Key == HTTPHostKey:
+			host = metadata.Val
+		case strings.Contains(metadata.Key, HTTPHeaderKey):
+			headers++
+		}
+	}
 	dest := connectRequest.Dest
-	method := metadata[HTTPMethodKey]
-	host := metadata[HTTPHostKey]
 	isWebsocket := connectRequest.Type == quicpogs.ConnectionTypeWebsocket
 
 	req, err := http.NewRequestWithContext(ctx, method, dest, body)
@@ -360,14 +395,15 @@ func buildHTTPRequest(
 	}
 
 	req.Host = host
+	req.Header = make(http.Header, headers)
 	for _, metadata := range connectRequest.Metadata {
 		if strings.Contains(metadata.Key, HTTPHeaderKey) {
 			// metadata.Key is off the format httpHeaderKey:<HTTPHeader>
-			httpHeaderKey := strings.Split(metadata.Key, ":")
-			if len(httpHeaderKey) != 2 {
+			_, httpHeaderKey, ok := strings.Cut(metadata.Key, ":")
+			if !ok || strings.Contains(httpHeaderKey, ":") {
 				return nil, fmt.Errorf("header Key: %s malformed", metadata.Key)
 			}
-			req.Header.Add(httpHeaderKey[1], metadata.Val)
+			req.Header.Add(httpHeaderKey, metadata.Val)
 		}
 	}
 	// Go's http.Client automatically sends chunked request body if this value is not set on the
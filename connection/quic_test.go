@@ -23,6 +23,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/cloudflare/cloudflared/datagramsession"
+	"github.com/cloudflare/cloudflared/ingress"
 	quicpogs "github.com/cloudflare/cloudflared/quic"
 	"github.com/cloudflare/cloudflared/tracing"
 	tunnelpogs "github.com/cloudflare/cloudflared/tunnelrpc/pogs"
@@ -489,12 +490,40 @@ func TestBuildHTTPRequest(t *testing.T) {
 	}
 }
 
+func BenchmarkBuildHTTPRequest(b *testing.B) {
+	connectRequest := &quicpogs.ConnectRequest{
+		Dest: "http://test.com/users",
+		Type: quicpogs.ConnectionTypeHTTP,
+		Metadata: []quicpogs.Metadata{
+			{Key: "HttpHeader:Accept", Val: "application/json"},
+			{Key: "HttpHeader:Accept-Encoding", Val: "gzip"},
+			{Key: "HttpHeader:Cf-Ray", Val: "76fd6bc7ad0f6d5c-LHR"},
+			{Key: "HttpHeader:Cf-Connecting-Ip", Val: "198.51.100.1"},
+			{Key: "HttpHeader:User-Agent", Val: "benchmark"},
+			{Key: "HttpHeader:X-Forwarded-Proto", Val: "https"},
+			{Key: "HttpHost", Val: "test.com"},
+			{Key: "HttpMethod", Val: "GET"},
+		},
+	}
+	log := zerolog.Nop()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := buildHTTPRequest(context.Background(), connectRequest, http.NoBody, &log); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func (moc *mockOriginProxyWithRequest) ProxyTCP(ctx context.Context, rwa ReadWriteAcker, tcpRequest *TCPRequest) error {
 	rwa.AckConnection("")
 	io.Copy(rwa, rwa)
 	return nil
 }
 
+func (moc *mockOriginProxyWithRequest) DialUDPSession(sessionID uuid.UUID, dstIP net.IP, dstPort uint16) (ingress.UDPProxy, error) {
+	return ingress.DialUDP(dstIP, dstPort)
+}
+
 func TestServeUDPSession(t *testing.T) {
 	// Start a UDP Listener for QUIC.
 	udpAddr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
@@ -638,6 +667,7 @@ func testQUICConnection(udpListenerAddr net.Addr, t *testing.T) *QUICConnection
 	qc, err := NewQUICConnection(
 		testQUICConfig,
 		udpListenerAddr,
+		nil,
 		tlsClientConfig,
 		&mockOrchestrator{originProxy: &mockOriginProxyWithRequest{}},
 		&tunnelpogs.ConnectionOptions{},
@@ -101,7 +101,7 @@ func (rsc *registrationServerClient) RegisterConnection(
 ) (*tunnelpogs.ConnectionDetails, error) {
 	conn, err := rsc.client.RegisterConnection(
 		ctx,
-		properties.Credentials.Auth(),
+		properties.Auth(),
 		properties.Credentials.TunnelID,
 		connIndex,
 		options,
@@ -295,7 +295,7 @@ func (h *h2muxConnection) registerNamedTunnel(
 		return err
 	}
 	h.observer.logServerInfo(h.connIndex, registrationDetails.Location, nil, fmt.Sprintf("Connection %s registered", registrationDetails.UUID))
-	h.observer.sendConnectedEvent(h.connIndex, H2mux, registrationDetails.Location)
+	h.observer.sendConnectedEvent(h.connIndex, H2mux, registrationDetails.Location, nil, negotiateFeatures(H2mux, connOptions, registrationDetails))
 
 	return nil
 }
@@ -0,0 +1,172 @@
+// Package docker publishes Docker containers through a tunnel from their labels, with a minimal client of the Docker
+// Engine API covering the few endpoints it uses.
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultHost is the Docker daemon used when DOCKER_HOST isn't set
+	DefaultHost = "unix:///var/run/docker.sock"
+	// The host of request URLs when the daemon is reached through a unix socket
+	unixSocketHost = "docker"
+)
+
+// Container is the subset of a container listed by the Docker daemon used to publish it
+type Container struct {
+	ID              string            `json:"Id"`
+	Names           []string          `json:"Names"`
+	Labels          map[string]string `json:"Labels"`
+	State           string            `json:"State"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+	HostConfig struct {
+		NetworkMode string `json:"NetworkMode"`
+	} `json:"HostConfig"`
+}
+
+// Name returns the name of the container, without the leading slash
+func (c *Container) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// Event is a change of a Docker object
+type Event struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID string `json:"ID"`
+	} `json:"Actor"`
+}
+
+// Client reads containers of a Docker daemon
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+}
+
+// NewClient creates a client of the Docker daemon at host, either unix:///path/to/socket or tcp://host:port. The
+// daemon of DOCKER_HOST, or DefaultHost, is used if host is empty.
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultHost
+	}
+	hostURL, err := url.Parse(host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid Docker host %s", host)
+	}
+
+	transport := &http.Transport{}
+	baseURL := &url.URL{Scheme: "http"}
+	switch hostURL.Scheme {
+	case "unix":
+		socket := hostURL.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		baseURL.Host = unixSocketHost
+	case "tcp", "http":
+		baseURL.Host = hostURL.Host
+	default:
+		return nil, fmt.Errorf("unsupported Docker host %s, use unix:// or tcp://", host)
+	}
+	return &Client{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Transport: transport},
+	}, nil
+}
+
+// ListContainers lists the running containers
+func (c *Client) ListContainers(ctx context.Context) ([]Container, error) {
+	resp, err := c.get(ctx, "/containers/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var containers []Container
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, errors.Wrap(err, "invalid Docker container list")
+	}
+	return containers, nil
+}
+
+// ContainerEvents streams the events of containers starting, stopping, pausing or resuming. Only events after it
+// returns are streamed, so containers listed afterwards are up to date until the first event.
+func (c *Client) ContainerEvents(ctx context.Context) (*EventStream, error) {
+	filters, err := json.Marshal(map[string][]string{
+		"type":  {"container"},
+		"event": {"start", "die", "pause", "unpause"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.get(ctx, "/events", url.Values{"filters": {string(filters)}})
+	if err != nil {
+		return nil, err
+	}
+	return &EventStream{body: resp.Body, decoder: json.NewDecoder(resp.Body)}, nil
+}
+
+// EventStream is a stream of events of the Docker daemon
+type EventStream struct {
+	body    io.Closer
+	decoder *json.Decoder
+}
+
+// Next waits for the next event, it returns io.EOF when the daemon ends the stream
+func (s *EventStream) Next() (Event, error) {
+	var event Event
+	err := s.decoder.Decode(&event)
+	return event, err
+}
+
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path = path
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("GET %s: %s", path, apiErr.Message)
+		}
+		return nil, fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,203 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/retry"
+)
+
+// Labels of containers to publish
+const (
+	// HostnameLabel is the hostname to publish the container at, containers without it aren't published
+	HostnameLabel = "cloudflared.hostname"
+	// PortLabel is the port of the container to publish
+	PortLabel = "cloudflared.port"
+	// PathLabel is an optional regular expression of the paths to publish, like the path of an ingress rule
+	PathLabel = "cloudflared.path"
+	// SchemeLabel is the scheme of the service of the container, http by default
+	SchemeLabel = "cloudflared.scheme"
+	// NetworkLabel is the network to reach the container through when it's attached to several
+	NetworkLabel = "cloudflared.network"
+)
+
+const (
+	// Served when no rule of the published containers matches a request
+	notFoundService = "http_status:404"
+	defaultScheme   = "http"
+
+	watchMaxRetries = 5
+	watchBaseTime   = time.Second
+)
+
+// ContainerIngressRules converts the labels of containers to rules of the tunnel ingress, followed by a rule serving
+// 404. Containers with invalid labels are left out, with an error for each of them.
+func ContainerIngressRules(containers []Container) ([]config.UnvalidatedIngressRule, []error) {
+	var rules []config.UnvalidatedIngressRule
+	var errs []error
+	for i := range containers {
+		container := &containers[i]
+		hostname := container.Labels[HostnameLabel]
+		if hostname == "" || container.State == "paused" {
+			continue
+		}
+		service, err := containerService(container)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("container %s: %w", container.Name(), err))
+			continue
+		}
+		path := container.Labels[PathLabel]
+		if _, err := regexp.Compile(path); err != nil {
+			errs = append(errs, fmt.Errorf("container %s: invalid %s label: %w", container.Name(), PathLabel, err))
+			continue
+		}
+		rules = append(rules, config.UnvalidatedIngressRule{
+			Hostname: hostname,
+			Path:     path,
+			Service:  service,
+		})
+	}
+
+	// Rules of the same hostname with longer paths are more specific, so they come first
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Hostname != rules[j].Hostname {
+			return rules[i].Hostname < rules[j].Hostname
+		}
+		return len(rules[i].Path) > len(rules[j].Path)
+	})
+	return append(rules, config.UnvalidatedIngressRule{Service: notFoundService}), errs
+}
+
+func containerService(container *Container) (string, error) {
+	port, err := strconv.ParseUint(container.Labels[PortLabel], 10, 16)
+	if err != nil || port == 0 {
+		return "", fmt.Errorf("invalid %s label %q", PortLabel, container.Labels[PortLabel])
+	}
+	scheme := container.Labels[SchemeLabel]
+	if scheme == "" {
+		scheme = defaultScheme
+	}
+
+	var ip string
+	if container.HostConfig.NetworkMode == "host" {
+		ip = "localhost"
+	} else if network := container.Labels[NetworkLabel]; network != "" {
+		settings, ok := container.NetworkSettings.Networks[network]
+		if !ok {
+			return "", fmt.Errorf("not attached to network %s", network)
+		}
+		ip = settings.IPAddress
+	} else {
+		networks := make([]string, 0, len(container.NetworkSettings.Networks))
+		for network := range container.NetworkSettings.Networks {
+			networks = append(networks, network)
+		}
+		sort.Strings(networks)
+		for _, network := range networks {
+			if ip = container.NetworkSettings.Networks[network].IPAddress; ip != "" {
+				break
+			}
+		}
+	}
+	if ip == "" {
+		return "", fmt.Errorf("no IP address, set the %s label", NetworkLabel)
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, ip, port), nil
+}
+
+// Provider publishes the containers of a Docker daemon through a tunnel from their labels, updating its ingress rules
+// and DNS routes as containers start and stop
+type Provider struct {
+	client *Client
+	// apply replaces the ingress rules of the tunnel
+	apply func([]config.UnvalidatedIngressRule) error
+	// router routes the hostnames of the rules to the tunnel
+	router *config.HostnameRouter
+	log    *zerolog.Logger
+
+	applied []config.UnvalidatedIngressRule
+}
+
+// NewProvider creates a provider publishing the containers of client
+func NewProvider(
+	client *Client,
+	apply func([]config.UnvalidatedIngressRule) error,
+	routeHostname func(hostname string) error,
+	log *zerolog.Logger,
+) *Provider {
+	return &Provider{
+		client: client,
+		apply:  apply,
+		router: config.NewHostnameRouter(routeHostname, log),
+		log:    log,
+	}
+}
+
+// Run publishes containers until ctx is done, listing them again whenever one starts or stops
+func (p *Provider) Run(ctx context.Context) error {
+	backoff := retry.BackoffHandler{MaxRetries: watchMaxRetries, RetryForever: true, BaseTime: watchBaseTime}
+	for {
+		err := p.watch(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		p.log.Err(err).Msg("Failed to watch Docker containers")
+		if !backoff.Backoff(ctx) {
+			return nil
+		}
+	}
+}
+
+func (p *Provider) watch(ctx context.Context) error {
+	// Subscribe before listing so no container starting in between is missed
+	events, err := p.client.ContainerEvents(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to watch Docker events")
+	}
+	defer events.Close()
+
+	if err := p.sync(ctx); err != nil {
+		return err
+	}
+	for {
+		event, err := events.Next()
+		if err != nil {
+			return errors.Wrap(err, "failed to read Docker events")
+		}
+		p.log.Debug().Str("container", event.Actor.ID).Str("event", event.Action).Msg("Docker container changed")
+		if err := p.sync(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// sync applies the rules of the running containers if they changed
+func (p *Provider) sync(ctx context.Context) error {
+	containers, err := p.client.ListContainers(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list Docker containers")
+	}
+	rules, errs := ContainerIngressRules(containers)
+	for _, err := range errs {
+		p.log.Err(err).Msg("Failed to publish Docker container")
+	}
+	if !reflect.DeepEqual(rules, p.applied) {
+		if err := p.apply(rules); err != nil {
+			p.log.Err(err).Msg("Failed to update tunnel ingress rules from Docker containers")
+			return nil
+		}
+		p.applied = rules
+		p.log.Info().Int("rules", len(rules)).Msg("Updated tunnel ingress rules from Docker containers")
+	}
+	p.router.RouteHostnames(rules)
+	return nil
+}
@@ -0,0 +1,146 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+func mustParseContainers(t *testing.T, raw string) []Container {
+	var containers []Container
+	require.NoError(t, json.Unmarshal([]byte(raw), &containers))
+	return containers
+}
+
+func TestContainerIngressRules(t *testing.T) {
+	containers := mustParseContainers(t, `[
+		{"Names": ["/web"], "Labels": {"cloudflared.hostname": "app.example.com", "cloudflared.port": "8080"},
+			"NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.2"}}}},
+		{"Names": ["/api"], "Labels": {"cloudflared.hostname": "app.example.com", "cloudflared.port": "443", "cloudflared.path": "^/api", "cloudflared.scheme": "https", "cloudflared.network": "backend"},
+			"NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.3"}, "backend": {"IPAddress": "172.18.0.3"}}}},
+		{"Names": ["/metrics"], "Labels": {"cloudflared.hostname": "metrics.example.com", "cloudflared.port": "9090"},
+			"HostConfig": {"NetworkMode": "host"}},
+		{"Names": ["/unlabeled"], "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.4"}}}},
+		{"Names": ["/paused"], "State": "paused", "Labels": {"cloudflared.hostname": "paused.example.com", "cloudflared.port": "80"},
+			"NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.5"}}}},
+		{"Names": ["/noport"], "Labels": {"cloudflared.hostname": "noport.example.com"},
+			"NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.6"}}}},
+		{"Names": ["/badpath"], "Labels": {"cloudflared.hostname": "badpath.example.com", "cloudflared.port": "80", "cloudflared.path": "("},
+			"NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.7"}}}},
+		{"Names": ["/nonetwork"], "Labels": {"cloudflared.hostname": "nonetwork.example.com", "cloudflared.port": "80", "cloudflared.network": "missing"},
+			"NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.8"}}}}
+	]`)
+
+	rules, errs := ContainerIngressRules(containers)
+	assert.Equal(t, []config.UnvalidatedIngressRule{
+		{Hostname: "app.example.com", Path: "^/api", Service: "https://172.18.0.3:443"},
+		{Hostname: "app.example.com", Service: "http://172.17.0.2:8080"},
+		{Hostname: "metrics.example.com", Service: "http://localhost:9090"},
+		{Service: "http_status:404"},
+	}, rules)
+	require.Len(t, errs, 3)
+	assert.Contains(t, errs[0].Error(), "container noport: invalid cloudflared.port label")
+	assert.Contains(t, errs[1].Error(), "container badpath: invalid cloudflared.path label")
+	assert.Contains(t, errs[2].Error(), "container nonetwork: not attached to network missing")
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := NewClient("unix:///run/docker.sock")
+	require.NoError(t, err)
+	assert.Equal(t, "http://docker", client.baseURL.String())
+
+	client, err = NewClient("tcp://127.0.0.1:2375")
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:2375", client.baseURL.String())
+
+	_, err = NewClient("ssh://user@host")
+	assert.Error(t, err)
+}
+
+func TestProvider(t *testing.T) {
+	var lock sync.Mutex
+	running := `[]`
+	startedC := make(chan struct{})
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/json":
+			lock.Lock()
+			defer lock.Unlock()
+			fmt.Fprint(w, running)
+		case "/events":
+			assert.Contains(t, r.URL.Query().Get("filters"), `"container"`)
+			w.(http.Flusher).Flush()
+			<-startedC
+			fmt.Fprint(w, `{"Type": "container", "Action": "start", "Actor": {"ID": "abc"}}`)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer daemon.Close()
+
+	client, err := NewClient("tcp://" + strings.TrimPrefix(daemon.URL, "http://"))
+	require.NoError(t, err)
+
+	var applied [][]config.UnvalidatedIngressRule
+	var routed []string
+	apply := func(rules []config.UnvalidatedIngressRule) error {
+		lock.Lock()
+		defer lock.Unlock()
+		applied = append(applied, rules)
+		return nil
+	}
+	routeHostname := func(hostname string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		routed = append(routed, hostname)
+		return nil
+	}
+
+	log := zerolog.Nop()
+	provider := NewProvider(client, apply, routeHostname, &log)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- provider.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(applied) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	lock.Lock()
+	running = `[{"Names": ["/web"], "Labels": {"cloudflared.hostname": "app.example.com", "cloudflared.port": "80"},
+		"NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.2"}}}}]`
+	lock.Unlock()
+	close(startedC)
+
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(applied) == 2
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.Equal(t, [][]config.UnvalidatedIngressRule{
+		{{Service: notFoundService}},
+		{{Hostname: "app.example.com", Service: "http://172.17.0.2:80"}, {Service: notFoundService}},
+	}, applied)
+	assert.Equal(t, []string{"app.example.com"}, routed)
+}
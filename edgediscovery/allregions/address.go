@@ -37,6 +37,21 @@ func (a AddrSet) GetUnusedIP(excluding *EdgeAddr) *EdgeAddr {
 	return nil
 }
 
+// getBestUnusedIP returns the unused address with the best score in this region, or a random one if scores is nil.
+// Returns nil if all addresses are in use.
+func (a AddrSet) getBestUnusedIP(excluding *EdgeAddr, scores *Scores) *EdgeAddr {
+	var best *EdgeAddr
+	for addr, usedby := range a {
+		if usedby.Used || addr == excluding {
+			continue
+		}
+		if best == nil || scores.better(addr, best) {
+			best = addr
+		}
+	}
+	return best
+}
+
 // Use the address, assigning it to a proxy connection.
 func (a AddrSet) Use(addr *EdgeAddr, connID int) {
 	if addr == nil {
@@ -62,3 +77,13 @@ func (a AddrSet) GiveBack(addr *EdgeAddr) (ok bool) {
 	a[addr] = Unused()
 	return true
 }
+
+// find returns the address of the set with the same IP and port as addr, or nil if there's none.
+func (a AddrSet) find(addr *EdgeAddr) *EdgeAddr {
+	for candidate := range a {
+		if candidate.UDP.IP.Equal(addr.UDP.IP) && candidate.UDP.Port == addr.UDP.Port {
+			return candidate
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package allregions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheVersion is bumped when the format of the cache changes, caches of other versions are ignored
+const cacheVersion = 1
+
+type edgeCache struct {
+	Version int `json:"version"`
+	// Region is the region the addresses were discovered for, empty for the global region
+	Region     string         `json:"region"`
+	ResolvedAt time.Time      `json:"resolvedAt"`
+	Regions    [][]cachedAddr `json:"regions"`
+}
+
+type cachedAddr struct {
+	IP   net.IP `json:"ip"`
+	Port int    `json:"port"`
+}
+
+// LoadCache reads the edge addresses of region cached in path, and when they were resolved. It fails if the cache
+// doesn't exist, is for another region or is older than maxAge.
+func LoadCache(path, region string, maxAge time.Duration) ([][]*EdgeAddr, time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var cache edgeCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse the edge address cache %s: %w", path, err)
+	}
+	if cache.Version != cacheVersion {
+		return nil, time.Time{}, fmt.Errorf("the edge address cache %s has version %d instead of %d", path, cache.Version, cacheVersion)
+	}
+	if cache.Region != region {
+		return nil, time.Time{}, fmt.Errorf("the edge address cache %s is for region %q instead of %q", path, cache.Region, region)
+	}
+	if age := time.Since(cache.ResolvedAt); age > maxAge {
+		return nil, time.Time{}, fmt.Errorf("the edge address cache %s is %v old, more than %v", path, age.Round(time.Second), maxAge)
+	}
+
+	regions := make([][]*EdgeAddr, 0, len(cache.Regions))
+	for _, cachedRegion := range cache.Regions {
+		addrs := make([]*EdgeAddr, 0, len(cachedRegion))
+		for _, addr := range cachedRegion {
+			if addr.IP == nil {
+				return nil, time.Time{}, fmt.Errorf("the edge address cache %s has an address without IP", path)
+			}
+			version := V6
+			if addr.IP.To4() != nil {
+				version = V4
+			}
+			addrs = append(addrs, &EdgeAddr{
+				TCP:       &net.TCPAddr{IP: addr.IP, Port: addr.Port},
+				UDP:       &net.UDPAddr{IP: addr.IP, Port: addr.Port},
+				IPVersion: version,
+			})
+		}
+		regions = append(regions, addrs)
+	}
+	return regions, cache.ResolvedAt, nil
+}
+
+// SaveCache writes the edge addresses of region to path. The file is replaced atomically, so connectors starting at
+// the same time never read a partial cache.
+func SaveCache(path, region string, regions [][]*EdgeAddr, resolvedAt time.Time) error {
+	cache := edgeCache{
+		Version:    cacheVersion,
+		Region:     region,
+		ResolvedAt: resolvedAt.UTC(),
+		Regions:    make([][]cachedAddr, 0, len(regions)),
+	}
+	for _, addrs := range regions {
+		cachedRegion := make([]cachedAddr, 0, len(addrs))
+		for _, addr := range addrs {
+			cachedRegion = append(cachedRegion, cachedAddr{IP: addr.UDP.IP, Port: addr.UDP.Port})
+		}
+		cache.Regions = append(cache.Regions, cachedRegion)
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
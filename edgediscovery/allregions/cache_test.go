@@ -0,0 +1,48 @@
+package allregions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "edge.json")
+	_, _, err := LoadCache(path, "", time.Hour)
+	assert.True(t, os.IsNotExist(err))
+
+	resolvedAt := time.Now().Add(-time.Minute).Round(time.Second)
+	regions := [][]*EdgeAddr{{&addr0, &addr4}, {&addr1, &addr5}}
+	require.NoError(t, SaveCache(path, "us", regions, resolvedAt))
+
+	loaded, loadedAt, err := LoadCache(path, "us", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, resolvedAt.Equal(loadedAt))
+	require.Len(t, loaded, 2)
+	for i := range regions {
+		require.Len(t, loaded[i], len(regions[i]))
+		for j, addr := range regions[i] {
+			assert.True(t, addr.UDP.IP.Equal(loaded[i][j].UDP.IP))
+			assert.True(t, addr.TCP.IP.Equal(loaded[i][j].TCP.IP))
+			assert.Equal(t, addr.UDP.Port, loaded[i][j].UDP.Port)
+			assert.Equal(t, addr.IPVersion, loaded[i][j].IPVersion)
+		}
+	}
+
+	_, _, err = LoadCache(path, "", time.Hour)
+	assert.Error(t, err, "the cache is for another region")
+	_, _, err = LoadCache(path, "us", time.Second)
+	assert.Error(t, err, "the cache is too old")
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+	_, _, err = LoadCache(path, "us", time.Hour)
+	assert.Error(t, err)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files are removed")
+}
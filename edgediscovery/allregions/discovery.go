@@ -2,7 +2,6 @@ package allregions
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net"
 	"time"
@@ -21,7 +20,8 @@ const (
 	// discover HA origintunneld servers (GitHub issue #75).
 	dotServerName = "cloudflare-dns.com"
 	dotServerAddr = "1.1.1.1:853"
-	dotTimeout    = 15 * time.Second
+	// lookupTimeout is how long each resolver has to discover the edge
+	lookupTimeout = 15 * time.Second
 
 	logFieldAddress = "address"
 )
@@ -68,18 +68,6 @@ type EdgeAddr struct {
 	IPVersion EdgeIPVersion
 }
 
-// If the call to net.LookupSRV fails, try to fall back to DoT from Cloudflare directly.
-//
-// Note: Instead of DoT, we could also have used DoH. Either of these:
-//     - directly via the JSON API (https://1.1.1.1/dns-query?ct=application/dns-json&name=_origintunneld._tcp.argotunnel.com&type=srv)
-//     - indirectly via `tunneldns.NewUpstreamHTTPS()`
-// But both of these cases miss out on a key feature from the stdlib:
-//     "The returned records are sorted by priority and randomized by weight within a priority."
-//     (https://golang.org/pkg/net/#Resolver.LookupSRV)
-// Does this matter? I don't know. It may someday. Let's use DoT so we don't need to worry about it.
-// See also: Go feature request for stdlib-supported DoH: https://github.com/golang/go/issues/27552
-var fallbackLookupSRV = lookupSRVWithDOT
-
 var friendlyDNSErrorLines = []string{
 	`Please try the following things to diagnose this issue:`,
 	`  1. ensure that argotunnel.com is returning "origintunneld" service records.`,
@@ -90,28 +78,50 @@ var friendlyDNSErrorLines = []string{
 	`     https://developers.cloudflare.com/1.1.1.1/setting-up-1.1.1.1/`,
 }
 
-// EdgeDiscovery implements HA service discovery lookup.
-func edgeDiscovery(log *zerolog.Logger, srvService string) ([][]*EdgeAddr, error) {
+// EdgeDiscovery implements HA service discovery lookup. The resolvers are tried in order until one of them finds the
+// edge, the default resolvers are used if there are none.
+func edgeDiscovery(log *zerolog.Logger, srvService string, resolvers []Resolver) ([][]*EdgeAddr, error) {
 	log.Debug().Str("domain", "_"+srvService+"._"+srvProto+"."+srvName).Msg("looking up edge SRV record")
+	if len(resolvers) == 0 {
+		resolvers = DefaultResolvers()
+	}
 
-	_, addrs, err := netLookupSRV(srvService, srvProto, srvName)
-	if err != nil {
-		_, fallbackAddrs, fallbackErr := fallbackLookupSRV(srvService, srvProto, srvName)
-		if fallbackErr != nil || len(fallbackAddrs) == 0 {
-			// use the original DNS error `err` in messages, not `fallbackErr`
-			log.Err(err).Msg("Error looking up Cloudflare edge IPs: the DNS query failed")
-			for _, s := range friendlyDNSErrorLines {
-				log.Error().Msg(s)
-			}
-			return nil, errors.Wrapf(err, "Could not lookup srv records on _%v._%v.%v", srvService, srvProto, srvName)
+	var firstErr error
+	for i, resolver := range resolvers {
+		resolvedAddrPerCNAME, err := discoverWith(resolver, srvService, log)
+		if err == nil {
+			return resolvedAddrPerCNAME, nil
+		}
+		if i < len(resolvers)-1 {
+			log.Debug().Err(err).Str("resolver", resolver.String()).Msg("edge discovery failed with a resolver, trying the next one")
+		}
+		if firstErr == nil {
+			firstErr = err
 		}
-		// Accept the fallback results and keep going
-		addrs = fallbackAddrs
+	}
+	// use the error of the first resolver in messages, which is the system's by default
+	log.Err(firstErr).Msg("Error looking up Cloudflare edge IPs: the DNS query failed")
+	for _, s := range friendlyDNSErrorLines {
+		log.Error().Msg(s)
+	}
+	return nil, errors.Wrapf(firstErr, "Could not lookup srv records on _%v._%v.%v", srvService, srvProto, srvName)
+}
+
+// discoverWith looks up the SRV records of the edge, and the IPs of their targets with resolver
+func discoverWith(resolver Resolver, srvService string, log *zerolog.Logger) ([][]*EdgeAddr, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	addrs, err := resolver.LookupSRV(ctx, srvService, srvProto, srvName)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%s found no SRV records", resolver)
 	}
 
 	var resolvedAddrPerCNAME [][]*EdgeAddr
 	for _, addr := range addrs {
-		edgeAddrs, err := resolveSRV(addr)
+		edgeAddrs, err := resolveSRV(ctx, resolver, addr)
 		if err != nil {
 			return nil, err
 		}
@@ -120,31 +130,11 @@ func edgeDiscovery(log *zerolog.Logger, srvService string) ([][]*EdgeAddr, error
 		}
 		resolvedAddrPerCNAME = append(resolvedAddrPerCNAME, edgeAddrs)
 	}
-
 	return resolvedAddrPerCNAME, nil
 }
 
-func lookupSRVWithDOT(srvService string, srvProto string, srvName string) (cname string, addrs []*net.SRV, err error) {
-	// Inspiration: https://github.com/artyom/dot/blob/master/dot.go
-	r := &net.Resolver{
-		PreferGo: true,
-		Dial: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
-			var dialer net.Dialer
-			conn, err := dialer.DialContext(ctx, "tcp", dotServerAddr)
-			if err != nil {
-				return nil, err
-			}
-			tlsConfig := &tls.Config{ServerName: dotServerName}
-			return tls.Client(conn, tlsConfig), nil
-		},
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), dotTimeout)
-	defer cancel()
-	return r.LookupSRV(ctx, srvService, srvProto, srvName)
-}
-
-func resolveSRV(srv *net.SRV) ([]*EdgeAddr, error) {
-	ips, err := netLookupIP(srv.Target)
+func resolveSRV(ctx context.Context, resolver Resolver, srv *net.SRV) ([]*EdgeAddr, error) {
+	ips, err := resolver.LookupIP(ctx, srv.Target)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Couldn't resolve SRV record %v", srv)
 	}
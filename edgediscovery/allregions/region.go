@@ -91,7 +91,13 @@ func (r Region) AvailableAddrs() int {
 // assigned to the connID excluding the provided EdgeAddr.
 // Returns nil if all addresses are in use for the region.
 func (r Region) AssignAnyAddress(connID int, excluding *EdgeAddr) *EdgeAddr {
-	if addr := r.active.GetUnusedIP(excluding); addr != nil {
+	return r.assignBestAddress(connID, excluding, nil)
+}
+
+// assignBestAddress returns the unused address with the best score in this region now assigned to the connID,
+// excluding the provided EdgeAddr. Returns nil if all addresses are in use for the region.
+func (r Region) assignBestAddress(connID int, excluding *EdgeAddr, scores *Scores) *EdgeAddr {
+	if addr := r.active.getBestUnusedIP(excluding, scores); addr != nil {
 		r.active.Use(addr, connID)
 		return addr
 	}
@@ -2,6 +2,8 @@ package allregions
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 
 	"github.com/rs/zerolog"
 )
@@ -17,12 +19,17 @@ type Regions struct {
 // Constructors
 // ------------------------------------
 
-// ResolveEdge resolves the Cloudflare edge, returning all regions discovered.
-func ResolveEdge(log *zerolog.Logger, region string, overrideIPVersion ConfigIPVersion) (*Regions, error) {
-	edgeAddrs, err := edgeDiscovery(log, getRegionalServiceName(region))
+// ResolveEdge resolves the Cloudflare edge with resolvers, returning all regions discovered.
+func ResolveEdge(log *zerolog.Logger, region string, overrideIPVersion ConfigIPVersion, resolvers []Resolver) (*Regions, error) {
+	edgeAddrs, err := edgeDiscovery(log, getRegionalServiceName(region), resolvers)
 	if err != nil {
 		return nil, err
 	}
+	return NewRegions(edgeAddrs, overrideIPVersion)
+}
+
+// NewRegions creates the regions of addresses discovered by DiscoverRegions, or loaded from a cache.
+func NewRegions(edgeAddrs [][]*EdgeAddr, overrideIPVersion ConfigIPVersion) (*Regions, error) {
 	if len(edgeAddrs) < 2 {
 		return nil, fmt.Errorf("expected at least 2 Cloudflare Regions regions, but SRV only returned %v", len(edgeAddrs))
 	}
@@ -32,6 +39,12 @@ func ResolveEdge(log *zerolog.Logger, region string, overrideIPVersion ConfigIPV
 	}, nil
 }
 
+// DiscoverRegions returns the addresses of each region of the Cloudflare edge, found with resolvers. The default
+// resolvers are used if there are none.
+func DiscoverRegions(log *zerolog.Logger, region string, resolvers []Resolver) ([][]*EdgeAddr, error) {
+	return edgeDiscovery(log, getRegionalServiceName(region), resolvers)
+}
+
 // StaticEdge creates a list of edge addresses from the list of hostnames.
 // Mainly used for testing connectivity.
 func StaticEdge(hostnames []string, log *zerolog.Logger) (*Regions, error) {
@@ -42,6 +55,45 @@ func StaticEdge(hostnames []string, log *zerolog.Logger) (*Regions, error) {
 	return NewNoResolve(resolved), nil
 }
 
+// ParseStaticRegions parses the IP:port addresses of each region of the edge, which are used instead of discovering
+// it. Hostnames aren't accepted, so that the addresses don't depend on DNS.
+func ParseStaticRegions(regionAddrs [][]string) ([][]*EdgeAddr, error) {
+	regions := make([][]*EdgeAddr, 0, len(regionAddrs))
+	total := 0
+	for i, addrs := range regionAddrs {
+		region := make([]*EdgeAddr, 0, len(addrs))
+		for _, addr := range addrs {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, fmt.Errorf("the edge address %q of region %d must be an IP and a port: %w", addr, i+1, err)
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return nil, fmt.Errorf("the edge address %q of region %d must be an IP and a port, not a hostname", addr, i+1)
+			}
+			portNumber, err := strconv.ParseUint(port, 10, 16)
+			if err != nil || portNumber == 0 {
+				return nil, fmt.Errorf("the edge address %q of region %d has an invalid port", addr, i+1)
+			}
+			version := V6
+			if ip.To4() != nil {
+				version = V4
+			}
+			region = append(region, &EdgeAddr{
+				TCP:       &net.TCPAddr{IP: ip, Port: int(portNumber)},
+				UDP:       &net.UDPAddr{IP: ip, Port: int(portNumber)},
+				IPVersion: version,
+			})
+		}
+		total += len(region)
+		regions = append(regions, region)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("there are no static edge addresses")
+	}
+	return regions, nil
+}
+
 // NewNoResolve doesn't resolve the edge. Instead it just uses the given addresses.
 // You probably only need this for testing.
 func NewNoResolve(addrs []*EdgeAddr) *Regions {
@@ -85,21 +137,26 @@ func (rs *Regions) AddrUsedBy(connID int) *EdgeAddr {
 // GetUnusedAddr gets an unused addr from the edge, excluding the given addr. Prefer to use addresses
 // evenly across both regions.
 func (rs *Regions) GetUnusedAddr(excluding *EdgeAddr, connID int) *EdgeAddr {
+	return rs.GetBestUnusedAddr(excluding, connID, nil)
+}
+
+// GetBestUnusedAddr is GetUnusedAddr, picking the address with the best score within a region.
+func (rs *Regions) GetBestUnusedAddr(excluding *EdgeAddr, connID int, scores *Scores) *EdgeAddr {
 	if rs.region1.AvailableAddrs() > rs.region2.AvailableAddrs() {
-		return getAddrs(excluding, connID, &rs.region1, &rs.region2)
+		return getAddrs(excluding, connID, &rs.region1, &rs.region2, scores)
 	}
 
-	return getAddrs(excluding, connID, &rs.region2, &rs.region1)
+	return getAddrs(excluding, connID, &rs.region2, &rs.region1, scores)
 }
 
 // getAddrs tries to grab address form `first` region, then `second` region
 // this is an unrolled loop over 2 element array
-func getAddrs(excluding *EdgeAddr, connID int, first *Region, second *Region) *EdgeAddr {
-	addr := first.AssignAnyAddress(connID, excluding)
+func getAddrs(excluding *EdgeAddr, connID int, first *Region, second *Region, scores *Scores) *EdgeAddr {
+	addr := first.assignBestAddress(connID, excluding, scores)
 	if addr != nil {
 		return addr
 	}
-	addr = second.AssignAnyAddress(connID, excluding)
+	addr = second.assignBestAddress(connID, excluding, scores)
 	if addr != nil {
 		return addr
 	}
@@ -121,6 +178,29 @@ func (rs *Regions) GiveBack(addr *EdgeAddr, hasConnectivityError bool) bool {
 	return rs.region2.GiveBack(addr, hasConnectivityError)
 }
 
+// CarryOver assigns the addresses of these regions that are also in old to the connections using them in old, when
+// these regions replace old after the edge is resolved again. Connections using addresses that aren't in these
+// regions anymore get a new address the next time they reconnect.
+func (rs *Regions) CarryOver(old *Regions) {
+	for _, oldSet := range old.addrSets() {
+		for oldAddr, usedBy := range oldSet {
+			if !usedBy.Used {
+				continue
+			}
+			for _, set := range rs.addrSets() {
+				if addr := set.find(oldAddr); addr != nil {
+					set.Use(addr, usedBy.ConnID)
+					break
+				}
+			}
+		}
+	}
+}
+
+func (rs *Regions) addrSets() []AddrSet {
+	return []AddrSet{rs.region1.primary, rs.region1.secondary, rs.region2.primary, rs.region2.secondary}
+}
+
 // Return regionalized service name if `region` isn't empty, otherwise return the global service name for origintunneld
 func getRegionalServiceName(region string) string {
 	if region != "" {
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func makeRegions(addrs []*EdgeAddr, mode ConfigIPVersion) Regions {
@@ -237,6 +238,44 @@ func TestNewNoResolveBalancesRegions(t *testing.T) {
 	}
 }
 
+func TestRegions_CarryOver(t *testing.T) {
+	old := makeRegions([]*EdgeAddr{&addr0, &addr1, &addr2, &addr3}, IPv4Only)
+	old.region1.active.Use(&addr0, 1)
+	old.region2.active.Use(&addr3, 2)
+
+	// Copies of the addresses, like the ones resolved again
+	addr0Copy, addr1Copy := addr0, addr1
+	fresh, err := NewRegions([][]*EdgeAddr{{&addr0Copy}, {&addr1Copy}}, IPv4Only)
+	require.NoError(t, err)
+	fresh.CarryOver(&old)
+	assert.Equal(t, &addr0Copy, fresh.AddrUsedBy(1))
+	assert.Nil(t, fresh.AddrUsedBy(2), "the address of connection 2 isn't resolved anymore")
+	assert.Equal(t, 1, fresh.AvailableAddrs())
+}
+
+func TestParseStaticRegions(t *testing.T) {
+	regions, err := ParseStaticRegions([][]string{{"198.41.192.7:7844", "[2606:4700:a0::1]:7844"}, {}})
+	require.NoError(t, err)
+	require.Len(t, regions, 2)
+	require.Len(t, regions[0], 2)
+	assert.Equal(t, "198.41.192.7:7844", regions[0][0].TCP.String())
+	assert.Equal(t, "198.41.192.7:7844", regions[0][0].UDP.String())
+	assert.Equal(t, V4, regions[0][0].IPVersion)
+	assert.Equal(t, V6, regions[0][1].IPVersion)
+	assert.Empty(t, regions[1])
+
+	for _, invalid := range [][][]string{
+		{{}, {}},
+		{{"198.41.192.7"}, {}},
+		{{"region1.v2.argotunnel.com:7844"}, {}},
+		{{"198.41.192.7:0"}, {}},
+		{{}, {"198.41.200.13:http"}},
+	} {
+		_, err := ParseStaticRegions(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
 func TestGetRegionalServiceName(t *testing.T) {
 	// Empty region should just go to origintunneld
 	globalServiceName := getRegionalServiceName("")
@@ -0,0 +1,248 @@
+package allregions
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// SystemResolver is the name of the resolver of the system in ParseResolvers
+	SystemResolver = "system"
+
+	dnsPort = "53"
+	dotPort = "853"
+	// maxDNSMessageSize is the largest DNS message, see RFC 1035
+	maxDNSMessageSize = 65535
+)
+
+// Resolver looks up the SRV records of the edge and the IPs of their targets
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) ([]*net.SRV, error)
+	LookupIP(ctx context.Context, host string) ([]net.IP, error)
+	String() string
+}
+
+// DefaultResolvers are the resolver of the system, and Cloudflare's 1.1.1.1 over TLS for hosts whose resolver fails to
+// look up the edge.
+//
+// Note: Instead of DoT, we could also have used DoH. But it would miss out on a key feature from the stdlib:
+//
+//	"The returned records are sorted by priority and randomized by weight within a priority."
+//	(https://golang.org/pkg/net/#Resolver.LookupSRV)
+//
+// Does this matter? I don't know. It may someday. Let's use DoT so we don't need to worry about it.
+func DefaultResolvers() []Resolver {
+	return []Resolver{systemResolver{}, newDNSResolver("tls://"+dotServerAddr, dotServerAddr, dotServerName)}
+}
+
+// ParseResolvers parses resolvers, in the order they're tried in. Each is one of:
+//   - system, for the resolver of the system
+//   - an IP with an optional port, for a DNS server
+//   - tls:// followed by an IP with an optional port, for a DNS over TLS server
+//   - an https:// URL, for a DNS over HTTPS server. Its host should be an IP, or it's resolved by the system.
+func ParseResolvers(specs []string) ([]Resolver, error) {
+	resolvers := make([]Resolver, 0, len(specs))
+	for _, spec := range specs {
+		switch {
+		case spec == SystemResolver:
+			resolvers = append(resolvers, systemResolver{})
+		case strings.HasPrefix(spec, "https://"):
+			endpoint, err := url.Parse(spec)
+			if err != nil || endpoint.Host == "" {
+				return nil, fmt.Errorf("invalid DNS over HTTPS resolver %q", spec)
+			}
+			resolvers = append(resolvers, newDOHResolver(endpoint))
+		case strings.HasPrefix(spec, "tls://"):
+			addr, err := resolverAddr(strings.TrimPrefix(spec, "tls://"), dotPort)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DNS over TLS resolver %q: %w", spec, err)
+			}
+			host, _, _ := net.SplitHostPort(addr)
+			resolvers = append(resolvers, newDNSResolver(spec, addr, host))
+		default:
+			addr, err := resolverAddr(spec, dnsPort)
+			if err != nil {
+				return nil, fmt.Errorf("invalid resolver %q, it must be %s, an IP, tls:// followed by an IP or an https:// URL: %w", spec, SystemResolver, err)
+			}
+			resolvers = append(resolvers, newDNSResolver(spec, addr, ""))
+		}
+	}
+	return resolvers, nil
+}
+
+// resolverAddr adds the default port to an IP without port
+func resolverAddr(addr, defaultPort string) (string, error) {
+	if ip := net.ParseIP(strings.Trim(addr, "[]")); ip != nil {
+		return net.JoinHostPort(ip.String(), defaultPort), nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("%s isn't an IP", host)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("%s isn't a port", port)
+	}
+	return addr, nil
+}
+
+// systemResolver is the resolver of the system
+type systemResolver struct{}
+
+func (systemResolver) LookupSRV(_ context.Context, service, proto, name string) ([]*net.SRV, error) {
+	_, addrs, err := netLookupSRV(service, proto, name)
+	return addrs, err
+}
+
+func (systemResolver) LookupIP(_ context.Context, host string) ([]net.IP, error) {
+	return netLookupIP(host)
+}
+
+func (systemResolver) String() string {
+	return SystemResolver
+}
+
+// dnsResolver queries a DNS server, over TLS if it has a server name
+type dnsResolver struct {
+	name     string
+	resolver *net.Resolver
+}
+
+func newDNSResolver(name, addr, tlsServerName string) *dnsResolver {
+	return &dnsResolver{
+		name: name,
+		resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				if tlsServerName == "" {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, network, addr)
+				}
+				// Inspiration: https://github.com/artyom/dot/blob/master/dot.go
+				dialer := tls.Dialer{Config: &tls.Config{ServerName: tlsServerName}}
+				return dialer.DialContext(ctx, "tcp", addr)
+			},
+		},
+	}
+}
+
+func (r *dnsResolver) LookupSRV(ctx context.Context, service, proto, name string) ([]*net.SRV, error) {
+	_, addrs, err := r.resolver.LookupSRV(ctx, service, proto, name)
+	return addrs, err
+}
+
+func (r *dnsResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	return r.resolver.LookupIP(ctx, "ip", host)
+}
+
+func (r *dnsResolver) String() string {
+	return r.name
+}
+
+// dohResolver queries a DNS over HTTPS server, see RFC 8484
+type dohResolver struct {
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func newDOHResolver(endpoint *url.URL) *dohResolver {
+	return &dohResolver{
+		endpoint: endpoint,
+		client:   &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, ForceAttemptHTTP2: true}},
+	}
+}
+
+// LookupSRV returns the SRV records sorted by priority, and by weight within a priority
+func (r *dohResolver) LookupSRV(ctx context.Context, service, proto, name string) ([]*net.SRV, error) {
+	answers, err := r.query(ctx, "_"+service+"._"+proto+"."+name, dns.TypeSRV)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []*net.SRV
+	for _, answer := range answers {
+		if srv, ok := answer.(*dns.SRV); ok {
+			addrs = append(addrs, &net.SRV{Target: srv.Target, Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight})
+		}
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		if addrs[i].Priority != addrs[j].Priority {
+			return addrs[i].Priority < addrs[j].Priority
+		}
+		return addrs[i].Weight > addrs[j].Weight
+	})
+	return addrs, nil
+}
+
+// LookupIP returns the IPv4 addresses of host followed by its IPv6 addresses
+func (r *dohResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		answers, err := r.query(ctx, host, qtype)
+		if err != nil {
+			return nil, err
+		}
+		for _, answer := range answers {
+			switch record := answer.(type) {
+			case *dns.A:
+				ips = append(ips, record.A)
+			case *dns.AAAA:
+				ips = append(ips, record.AAAA)
+			}
+		}
+	}
+	return ips, nil
+}
+
+func (r *dohResolver) query(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn(name), qtype)
+	// RFC 8484 recommends an ID of 0, so that responses can be cached
+	query.Id = 0
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint.String(), bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status code %d", r.endpoint, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDNSMessageSize))
+	if err != nil {
+		return nil, err
+	}
+	var answer dns.Msg
+	if err := answer.Unpack(body); err != nil {
+		return nil, fmt.Errorf("failed to parse the response of %s: %w", r.endpoint, err)
+	}
+	if answer.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("%s answered %s for %s", r.endpoint, dns.RcodeToString[answer.Rcode], name)
+	}
+	return answer.Answer, nil
+}
+
+func (r *dohResolver) String() string {
+	return r.endpoint.String()
+}
@@ -0,0 +1,122 @@
+package allregions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseResolvers(t *testing.T) {
+	resolvers, err := ParseResolvers([]string{"system", "9.9.9.9", "[2620:fe::fe]:5353", "tls://1.1.1.1", "https://1.1.1.1/dns-query"})
+	require.NoError(t, err)
+	var names []string
+	for _, resolver := range resolvers {
+		names = append(names, resolver.String())
+	}
+	assert.Equal(t, []string{"system", "9.9.9.9", "[2620:fe::fe]:5353", "tls://1.1.1.1", "https://1.1.1.1/dns-query"}, names)
+	assert.IsType(t, systemResolver{}, resolvers[0])
+	assert.IsType(t, &dnsResolver{}, resolvers[1])
+	assert.IsType(t, &dohResolver{}, resolvers[4])
+
+	for _, invalid := range []string{"dns.google", "tls://dns.google", "https://", "1.1.1.1:port"} {
+		_, err := ParseResolvers([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDOHResolver(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/dns-message", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var query dns.Msg
+		require.NoError(t, query.Unpack(body))
+		question := query.Question[0]
+		answer := new(dns.Msg)
+		answer.SetReply(&query)
+		header := dns.RR_Header{Name: question.Name, Rrtype: question.Qtype, Class: dns.ClassINET, Ttl: 60}
+		switch question.Qtype {
+		case dns.TypeSRV:
+			answer.Answer = []dns.RR{
+				&dns.SRV{Hdr: header, Priority: 2, Weight: 1, Port: 7844, Target: "region2.v2.argotunnel.com."},
+				&dns.SRV{Hdr: header, Priority: 1, Weight: 1, Port: 7844, Target: "region1.v2.argotunnel.com."},
+			}
+		case dns.TypeA:
+			if question.Name == "unknown.argotunnel.com." {
+				answer.Rcode = dns.RcodeNameError
+				break
+			}
+			answer.Answer = []dns.RR{&dns.A{Hdr: header, A: net.IPv4(198, 41, 192, 7)}}
+		case dns.TypeAAAA:
+			answer.Answer = []dns.RR{&dns.AAAA{Hdr: header, AAAA: net.ParseIP("2606:4700:a0::1")}}
+		}
+		packed, err := answer.Pack()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(packed)
+	}))
+	defer server.Close()
+	endpoint, err := url.Parse(server.URL + "/dns-query")
+	require.NoError(t, err)
+	resolver := newDOHResolver(endpoint)
+	resolver.client = server.Client()
+
+	addrs, err := resolver.LookupSRV(context.Background(), srvService, srvProto, srvName)
+	require.NoError(t, err)
+	require.Len(t, addrs, 2)
+	assert.Equal(t, "region1.v2.argotunnel.com.", addrs[0].Target)
+	assert.Equal(t, uint16(7844), addrs[0].Port)
+
+	ips, err := resolver.LookupIP(context.Background(), "region1.v2.argotunnel.com.")
+	require.NoError(t, err)
+	assert.Equal(t, []net.IP{net.IPv4(198, 41, 192, 7).To4(), net.ParseIP("2606:4700:a0::1")}, ips)
+
+	_, err = resolver.LookupIP(context.Background(), "unknown.argotunnel.com")
+	assert.Error(t, err)
+}
+
+// staticResolver resolves the edge to the same addresses every time, or fails
+type staticResolver struct {
+	name  string
+	addrs mockAddrs
+	err   error
+}
+
+func (r *staticResolver) LookupSRV(context.Context, string, string, string) ([]*net.SRV, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	_, srvs, err := mockNetLookupSRV(r.addrs)("", "", "")
+	return srvs, err
+}
+
+func (r *staticResolver) LookupIP(_ context.Context, host string) ([]net.IP, error) {
+	return mockNetLookupIP(r.addrs)(host)
+}
+
+func (r *staticResolver) String() string {
+	return r.name
+}
+
+func TestEdgeDiscoveryFallback(t *testing.T) {
+	log := zerolog.Nop()
+	failing := &staticResolver{name: "failing", err: fmt.Errorf("SERVFAIL")}
+	working := &staticResolver{name: "working", addrs: newMockAddrs(7844, 2, 3)}
+
+	addrLists, err := edgeDiscovery(&log, srvService, []Resolver{failing, working})
+	require.NoError(t, err)
+	assert.Len(t, addrLists, 2)
+
+	_, err = edgeDiscovery(&log, srvService, []Resolver{failing, failing})
+	assert.ErrorContains(t, err, "SERVFAIL")
+}
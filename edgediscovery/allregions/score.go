@@ -0,0 +1,118 @@
+package allregions
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// scoreHalfLife is how long it takes for the failures of an address to count half as much, so that addresses that
+	// failed a while ago are tried again
+	scoreHalfLife = 10 * time.Minute
+	// healthyFailures is the decayed failures under which an address is as good as one that never failed
+	healthyFailures = 0.5
+	// latencySmoothing is the weight of a new latency in the moving average of the latencies of an address
+	latencySmoothing = 0.3
+)
+
+// Scores tracks how the connections to each edge address went, so that connections prefer the addresses that failed
+// the least recently, and then the fastest ones, instead of an address that has failed repeatedly.
+// This is NOT thread-safe. Users of this package should use it with a lock, like Regions.
+type Scores struct {
+	addrs map[string]*addrScore
+	now   func() time.Time
+}
+
+type addrScore struct {
+	// failures is decayed to when it was updated
+	failures float64
+	// latency is zero until a connection to the address succeeded
+	latency time.Duration
+	updated time.Time
+}
+
+// NewScores returns the Scores of addresses that were never used.
+func NewScores() *Scores {
+	return &Scores{
+		addrs: make(map[string]*addrScore),
+		now:   time.Now,
+	}
+}
+
+// RecordFailure counts a failure of a connection to addr.
+func (s *Scores) RecordFailure(addr *EdgeAddr) {
+	if s == nil || addr == nil {
+		return
+	}
+	score := s.decayed(addr)
+	score.failures++
+}
+
+// RecordSuccess records a connection to addr that succeeded after latency, which halves its failures.
+func (s *Scores) RecordSuccess(addr *EdgeAddr, latency time.Duration) {
+	if s == nil || addr == nil {
+		return
+	}
+	score := s.decayed(addr)
+	score.failures /= 2
+	if score.latency == 0 {
+		score.latency = latency
+	} else {
+		score.latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(score.latency))
+	}
+}
+
+// Failures returns the decayed failures of addr.
+func (s *Scores) Failures(addr *EdgeAddr) float64 {
+	if s == nil {
+		return 0
+	}
+	score, ok := s.addrs[scoreKey(addr)]
+	if !ok {
+		return 0
+	}
+	return score.failures * decay(s.now().Sub(score.updated))
+}
+
+// better is whether a is a better address than b: it failed less, or it's faster. Addresses without latency yet are
+// considered the fastest, so that they get tried.
+func (s *Scores) better(a, b *EdgeAddr) bool {
+	if s == nil {
+		return false
+	}
+	aFailures, bFailures := s.Failures(a), s.Failures(b)
+	if aFailures >= healthyFailures || bFailures >= healthyFailures {
+		return aFailures < bFailures
+	}
+	return s.latency(a) < s.latency(b)
+}
+
+func (s *Scores) latency(addr *EdgeAddr) time.Duration {
+	if score, ok := s.addrs[scoreKey(addr)]; ok {
+		return score.latency
+	}
+	return 0
+}
+
+// decayed returns the score of addr, after decaying its failures to now
+func (s *Scores) decayed(addr *EdgeAddr) *addrScore {
+	now := s.now()
+	key := scoreKey(addr)
+	score, ok := s.addrs[key]
+	if !ok {
+		score = &addrScore{updated: now}
+		s.addrs[key] = score
+	}
+	score.failures *= decay(now.Sub(score.updated))
+	score.updated = now
+	return score
+}
+
+func decay(elapsed time.Duration) float64 {
+	return math.Pow(0.5, float64(elapsed)/float64(scoreHalfLife))
+}
+
+// scoreKey identifies an address by its IP and port, so that its score is kept when the edge is resolved again
+func scoreKey(addr *EdgeAddr) string {
+	return addr.UDP.String()
+}
@@ -0,0 +1,61 @@
+package allregions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScores(t *testing.T) {
+	scores := NewScores()
+	now := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	scores.now = func() time.Time { return now }
+
+	assert.Zero(t, scores.Failures(&addr0))
+	assert.False(t, scores.better(&addr0, &addr1))
+
+	scores.RecordFailure(&addr0)
+	scores.RecordFailure(&addr0)
+	assert.Equal(t, 2.0, scores.Failures(&addr0))
+	assert.True(t, scores.better(&addr1, &addr0))
+
+	// Failures decay with a half-life
+	now = now.Add(scoreHalfLife)
+	assert.InDelta(t, 1.0, scores.Failures(&addr0), 0.001)
+	now = now.Add(3 * scoreHalfLife)
+	assert.InDelta(t, 0.125, scores.Failures(&addr0), 0.001)
+
+	// Between healthy addresses, the fastest is better, and those without latency yet are tried first
+	scores.RecordSuccess(&addr0, 100*time.Millisecond)
+	scores.RecordSuccess(&addr1, 50*time.Millisecond)
+	assert.True(t, scores.better(&addr1, &addr0))
+	assert.True(t, scores.better(&addr2, &addr1))
+	scores.RecordSuccess(&addr1, 300*time.Millisecond)
+	assert.Equal(t, 125*time.Millisecond, scores.latency(&addr1))
+	assert.True(t, scores.better(&addr0, &addr1))
+
+	// The score is of the IP and port, not of the EdgeAddr
+	addr0Copy := addr0
+	assert.Equal(t, scores.latency(&addr0), scores.latency(&addr0Copy))
+
+	var nilScores *Scores
+	nilScores.RecordFailure(&addr0)
+	nilScores.RecordSuccess(&addr0, time.Second)
+	assert.Zero(t, nilScores.Failures(&addr0))
+}
+
+func TestRegions_GetBestUnusedAddr(t *testing.T) {
+	rs := makeRegions([]*EdgeAddr{&addr0, &addr1, &addr2, &addr3}, IPv4Only)
+	scores := NewScores()
+	// addr0 and addr2 are in region 1
+	scores.RecordFailure(&addr0)
+	scores.RecordSuccess(&addr1, 200*time.Millisecond)
+	scores.RecordSuccess(&addr3, 100*time.Millisecond)
+
+	// Connections are still balanced between the regions
+	assert.Equal(t, &addr3, rs.GetBestUnusedAddr(nil, 1, scores))
+	assert.Equal(t, &addr2, rs.GetBestUnusedAddr(nil, 2, scores))
+	assert.Equal(t, &addr1, rs.GetBestUnusedAddr(nil, 3, scores))
+	assert.Equal(t, &addr0, rs.GetBestUnusedAddr(nil, 4, scores))
+}
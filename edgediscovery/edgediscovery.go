@@ -1,7 +1,9 @@
 package edgediscovery
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 
@@ -15,6 +17,9 @@ const (
 
 var errNoAddressesLeft = ErrNoAddressesLeft{}
 
+// discoverRegions is overridden in tests
+var discoverRegions = allregions.DiscoverRegions
+
 type ErrNoAddressesLeft struct{}
 
 func (e ErrNoAddressesLeft) Error() string {
@@ -24,25 +29,76 @@ func (e ErrNoAddressesLeft) Error() string {
 // Edge finds addresses on the Cloudflare edge and hands them out to connections.
 type Edge struct {
 	regions *allregions.Regions
+	// scores are kept when the regions are replaced
+	scores *allregions.Scores
 	sync.Mutex
 	log *zerolog.Logger
 }
 
+func newEdge(log *zerolog.Logger, regions *allregions.Regions) *Edge {
+	return &Edge{
+		log:     log,
+		regions: regions,
+		scores:  allregions.NewScores(),
+	}
+}
+
 // ------------------------------------
 // Constructors
 // ------------------------------------
 
-// ResolveEdge runs the initial discovery of the Cloudflare edge, finding Addrs that can be allocated
-// to connections.
-func ResolveEdge(log *zerolog.Logger, region string, edgeIpVersion allregions.ConfigIPVersion) (*Edge, error) {
-	regions, err := allregions.ResolveEdge(log, region, edgeIpVersion)
+// ResolveEdge runs the initial discovery of the Cloudflare edge with resolvers, finding Addrs that can be allocated
+// to connections. The default resolvers are used if there are none.
+func ResolveEdge(
+	log *zerolog.Logger,
+	region string,
+	edgeIpVersion allregions.ConfigIPVersion,
+	resolvers []allregions.Resolver,
+) (*Edge, error) {
+	regions, err := allregions.ResolveEdge(log, region, edgeIpVersion, resolvers)
 	if err != nil {
 		return new(Edge), err
 	}
-	return &Edge{
-		log:     log,
-		regions: regions,
-	}, nil
+	return newEdge(log, regions), nil
+}
+
+// ResolveEdgeWithCache is ResolveEdge with the addresses cached in cachePath. If the cache is younger than maxAge, its
+// addresses are used right away and the edge is resolved again in the background, replacing them and the cache. It
+// saves connectors the time of resolving the edge when they start, which can be long on slow or flaky DNS resolvers.
+func ResolveEdgeWithCache(
+	log *zerolog.Logger,
+	region string,
+	edgeIpVersion allregions.ConfigIPVersion,
+	resolvers []allregions.Resolver,
+	cachePath string,
+	maxAge time.Duration,
+) (*Edge, error) {
+	discoverWith := discoverRegions
+	discover := func(log *zerolog.Logger, region string) ([][]*allregions.EdgeAddr, error) {
+		return discoverWith(log, region, resolvers)
+	}
+	cachedAddrs, resolvedAt, err := allregions.LoadCache(cachePath, region, maxAge)
+	if err == nil {
+		var regions *allregions.Regions
+		if regions, err = allregions.NewRegions(cachedAddrs, edgeIpVersion); err == nil {
+			log.Info().Str("cache", cachePath).Time("resolvedAt", resolvedAt).Msg("Using the cached edge addresses while resolving the edge again")
+			edge := newEdge(log, regions)
+			go edge.refresh(discover, region, edgeIpVersion, cachePath)
+			return edge, nil
+		}
+	}
+	log.Debug().Err(err).Msg("edgediscovery - the edge address cache can't be used")
+
+	edgeAddrs, err := discover(log, region)
+	if err != nil {
+		return new(Edge), err
+	}
+	regions, err := allregions.NewRegions(edgeAddrs, edgeIpVersion)
+	if err != nil {
+		return new(Edge), err
+	}
+	saveCache(log, cachePath, region, edgeAddrs)
+	return newEdge(log, regions), nil
 }
 
 // StaticEdge creates a list of edge addresses from the list of hostnames. Mainly used for testing connectivity.
@@ -51,10 +107,26 @@ func StaticEdge(log *zerolog.Logger, hostnames []string) (*Edge, error) {
 	if err != nil {
 		return new(Edge), err
 	}
-	return &Edge{
-		log:     log,
-		regions: regions,
-	}, nil
+	return newEdge(log, regions), nil
+}
+
+// StaticRegionsEdge creates the edge from the IP:port addresses of each of its two regions, without discovering it.
+func StaticRegionsEdge(log *zerolog.Logger, regionAddrs [][]string, edgeIpVersion allregions.ConfigIPVersion) (*Edge, error) {
+	if len(regionAddrs) != 2 {
+		return new(Edge), fmt.Errorf("expected the static edge addresses of 2 regions, got %d", len(regionAddrs))
+	}
+	edgeAddrs, err := allregions.ParseStaticRegions(regionAddrs)
+	if err != nil {
+		return new(Edge), err
+	}
+	regions, err := allregions.NewRegions(edgeAddrs, edgeIpVersion)
+	if err != nil {
+		return new(Edge), err
+	}
+	if regions.AvailableAddrs() == 0 {
+		return new(Edge), fmt.Errorf("none of the static edge addresses can be used with edge-ip-version %d", edgeIpVersion)
+	}
+	return newEdge(log, regions), nil
 }
 
 // ------------------------------------
@@ -84,8 +156,8 @@ func (ed *Edge) GetAddr(connIndex int) (*allregions.EdgeAddr, error) {
 		return addr, nil
 	}
 
-	// Otherwise, give it an unused one
-	addr := ed.regions.GetUnusedAddr(nil, connIndex)
+	// Otherwise, give it the best unused one
+	addr := ed.regions.GetBestUnusedAddr(nil, connIndex, ed.scores)
 	if addr == nil {
 		log.Debug().Msg("edgediscovery - GetAddr: No addresses left to give proxy connection")
 		return nil, errNoAddressesLeft
@@ -107,8 +179,9 @@ func (ed *Edge) GetDifferentAddr(connIndex int, hasConnectivityError bool) (*all
 	oldAddr := ed.regions.AddrUsedBy(connIndex)
 	if oldAddr != nil {
 		ed.regions.GiveBack(oldAddr, hasConnectivityError)
+		ed.scores.RecordFailure(oldAddr)
 	}
-	addr := ed.regions.GetUnusedAddr(oldAddr, connIndex)
+	addr := ed.regions.GetBestUnusedAddr(oldAddr, connIndex, ed.scores)
 	if addr == nil {
 		log.Debug().Msg("edgediscovery - GetDifferentAddr: No addresses left to give proxy connection")
 		// note: if oldAddr were not nil, it will become available on the next iteration
@@ -121,6 +194,19 @@ func (ed *Edge) GetDifferentAddr(connIndex int, hasConnectivityError bool) (*all
 	return addr, nil
 }
 
+// ReportConnected records that the connection to addr was registered after latency, which makes addr preferred over
+// slower addresses and ones that failed.
+func (ed *Edge) ReportConnected(addr *allregions.EdgeAddr, latency time.Duration) {
+	ed.Lock()
+	defer ed.Unlock()
+	ed.scores.RecordSuccess(addr, latency)
+	ed.log.Debug().
+		IPAddr(LogFieldIPAddress, addr.UDP.IP).
+		Dur("latency", latency).
+		Float64("failures", ed.scores.Failures(addr)).
+		Msg("edgediscovery - ReportConnected: Connection to address registered")
+}
+
 // AvailableAddrs returns how many unused addresses there are left.
 func (ed *Edge) AvailableAddrs() int {
 	ed.Lock()
@@ -138,3 +224,34 @@ func (ed *Edge) GiveBack(addr *allregions.EdgeAddr, hasConnectivityError bool) b
 	log.Debug().Msgf("edgediscovery - GiveBack: Address now unused")
 	return ed.regions.GiveBack(addr, hasConnectivityError)
 }
+
+// refresh resolves the edge again, and replaces the addresses and the cache with the result.
+func (ed *Edge) refresh(
+	discover func(*zerolog.Logger, string) ([][]*allregions.EdgeAddr, error),
+	region string,
+	edgeIpVersion allregions.ConfigIPVersion,
+	cachePath string,
+) {
+	edgeAddrs, err := discover(ed.log, region)
+	if err != nil {
+		ed.log.Warn().Err(err).Msg("Failed to resolve the edge, the cached edge addresses are used until cloudflared restarts")
+		return
+	}
+	regions, err := allregions.NewRegions(edgeAddrs, edgeIpVersion)
+	if err != nil {
+		ed.log.Warn().Err(err).Msg("Failed to resolve the edge, the cached edge addresses are used until cloudflared restarts")
+		return
+	}
+	ed.Lock()
+	regions.CarryOver(ed.regions)
+	ed.regions = regions
+	ed.Unlock()
+	ed.log.Debug().Msg("edgediscovery - replaced the cached edge addresses with the resolved ones")
+	saveCache(ed.log, cachePath, region, edgeAddrs)
+}
+
+func saveCache(log *zerolog.Logger, cachePath, region string, edgeAddrs [][]*allregions.EdgeAddr) {
+	if err := allregions.SaveCache(cachePath, region, edgeAddrs, time.Now()); err != nil {
+		log.Warn().Err(err).Str("cache", cachePath).Msg("Failed to write the edge address cache")
+	}
+}
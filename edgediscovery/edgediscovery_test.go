@@ -1,11 +1,15 @@
 package edgediscovery
 
 import (
+	"fmt"
 	"net"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/cloudflare/cloudflared/edgediscovery/allregions"
 )
@@ -256,8 +260,89 @@ func TestGetDifferentAddr(t *testing.T) {
 // MockEdge creates a Cloudflare Edge from arbitrary TCP addresses. Used for testing.
 func MockEdge(log *zerolog.Logger, addrs []*allregions.EdgeAddr) *Edge {
 	regions := allregions.NewNoResolve(addrs)
-	return &Edge{
-		log:     log,
-		regions: regions,
+	return newEdge(log, regions)
+}
+
+func TestResolveEdgeWithCache(t *testing.T) {
+	resolved := [][]*allregions.EdgeAddr{{&addr0, &addr2}, {&addr1, &addr3}}
+	resolveErr := error(nil)
+	discoverRegions = func(log *zerolog.Logger, region string, resolvers []allregions.Resolver) ([][]*allregions.EdgeAddr, error) {
+		return resolved, resolveErr
+	}
+	defer func() { discoverRegions = allregions.DiscoverRegions }()
+	cachePath := filepath.Join(t.TempDir(), "edge.json")
+
+	// Without a cache, the edge is resolved and cached
+	edge, err := ResolveEdgeWithCache(&testLogger, "", allregions.IPv4Only, nil, cachePath, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 4, edge.AvailableAddrs())
+	cached, _, err := allregions.LoadCache(cachePath, "", time.Hour)
+	require.NoError(t, err)
+	assert.Len(t, cached, 2)
+
+	// With a cache, its addresses are used even if the edge can't be resolved
+	resolveErr = fmt.Errorf("DNS is down")
+	edge, err = ResolveEdgeWithCache(&testLogger, "", allregions.IPv4Only, nil, cachePath, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 4, edge.AvailableAddrs())
+
+	// Without a cache of the region, resolving the edge has to succeed
+	_, err = ResolveEdgeWithCache(&testLogger, "us", allregions.IPv4Only, nil, cachePath, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestEdgeRefresh(t *testing.T) {
+	discover := func(log *zerolog.Logger, region string) ([][]*allregions.EdgeAddr, error) {
+		return [][]*allregions.EdgeAddr{{&addr0}, {&addr1}}, nil
+	}
+	cachePath := filepath.Join(t.TempDir(), "edge.json")
+
+	edge := MockEdge(&testLogger, []*allregions.EdgeAddr{&addr0, &addr1, &addr2, &addr3})
+	used, err := edge.GetAddr(0)
+	require.NoError(t, err)
+	edge.refresh(discover, "", allregions.IPv4Only, cachePath)
+
+	available := 2
+	if used == &addr0 || used == &addr1 {
+		// The connection keeps its address, since it's still resolved
+		assert.Equal(t, used, edge.regions.AddrUsedBy(0))
+		available = 1
 	}
+	assert.Equal(t, available, edge.AvailableAddrs())
+	cached, _, err := allregions.LoadCache(cachePath, "", time.Hour)
+	require.NoError(t, err)
+	assert.Len(t, cached, 2)
+}
+
+func TestStaticRegionsEdge(t *testing.T) {
+	regionAddrs := [][]string{{"198.41.192.7:7844", "198.41.192.27:7844"}, {"198.41.200.13:7844", "[2606:4700:a8::1]:7844"}}
+	edge, err := StaticRegionsEdge(&testLogger, regionAddrs, allregions.IPv4Only)
+	require.NoError(t, err)
+	assert.Equal(t, 3, edge.AvailableAddrs())
+
+	addr, err := edge.GetAddr(0)
+	require.NoError(t, err)
+	assert.Equal(t, allregions.V4, addr.IPVersion)
+
+	_, err = StaticRegionsEdge(&testLogger, [][]string{{"[2606:4700:a0::1]:7844"}, {}}, allregions.IPv4Only)
+	assert.Error(t, err, "no address is IPv4")
+	_, err = StaticRegionsEdge(&testLogger, [][]string{{"198.41.192.7:7844"}}, allregions.IPv4Only)
+	assert.Error(t, err)
+}
+
+func TestGetAddrAvoidsFailedAddrs(t *testing.T) {
+	// addr0 and addr2 are in the first region, which has the most addresses
+	edge := MockEdge(&testLogger, []*allregions.EdgeAddr{&addr0, &addr1, &addr2})
+	failed, err := edge.GetAddr(0)
+	require.NoError(t, err)
+	working, err := edge.GetDifferentAddr(0, true)
+	require.NoError(t, err)
+	assert.NotEqual(t, failed, working)
+	edge.ReportConnected(working, time.Millisecond)
+	edge.GiveBack(working, false)
+
+	// Another connection gets the address that worked, not the one that failed
+	addr, err := edge.GetAddr(1)
+	require.NoError(t, err)
+	assert.Equal(t, working, addr)
 }
@@ -0,0 +1,73 @@
+package features
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Override force enables or disables features until it expires, overriding the features negotiated with the edge to
+// debug them.
+type Override struct {
+	Enable  []string  `json:"enable,omitempty"`
+	Disable []string  `json:"disable,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// LoadOverride reads the override in path. It returns nil if there's no override.
+func LoadOverride(path string) (*Override, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var override Override
+	if err := json.Unmarshal(data, &override); err != nil {
+		return nil, fmt.Errorf("failed to parse the feature override file %s: %w", path, err)
+	}
+	return &override, nil
+}
+
+// SaveOverride writes override to path, creating its directory if needed.
+func SaveOverride(path string, override *Override) error {
+	data, err := json.MarshalIndent(override, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Expired is whether the override doesn't apply anymore at now.
+func (o *Override) Expired(now time.Time) bool {
+	return o == nil || !now.Before(o.Expires)
+}
+
+// Apply returns features with the override applied at now: the enabled features are added and the disabled ones are
+// removed, unless it expired.
+func (o *Override) Apply(features []string, now time.Time) []string {
+	if o.Expired(now) {
+		return features
+	}
+	disabled := make(map[string]bool, len(o.Disable))
+	for _, feature := range o.Disable {
+		disabled[feature] = true
+	}
+	seen := make(map[string]bool, len(features)+len(o.Enable))
+	var applied []string
+	for _, feature := range append(append([]string{}, features...), o.Enable...) {
+		if disabled[feature] || seen[feature] {
+			continue
+		}
+		seen[feature] = true
+		applied = append(applied, feature)
+	}
+	return applied
+}
@@ -0,0 +1,41 @@
+package features
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverrideApply(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	defaults := []string{"allow_remote_config", "serialized_headers"}
+	override := &Override{
+		Enable:  []string{"support_datagram_v2", "serialized_headers"},
+		Disable: []string{"allow_remote_config"},
+		Expires: now.Add(time.Hour),
+	}
+	assert.Equal(t, []string{"serialized_headers", "support_datagram_v2"}, override.Apply(defaults, now))
+	assert.Equal(t, defaults, override.Apply(defaults, now.Add(time.Hour)))
+
+	var noOverride *Override
+	assert.True(t, noOverride.Expired(now))
+	assert.Equal(t, defaults, noOverride.Apply(defaults, now))
+}
+
+func TestSaveLoadOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides", "features.json")
+	override, err := LoadOverride(path)
+	require.NoError(t, err)
+	assert.Nil(t, override)
+
+	expires := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, SaveOverride(path, &Override{Enable: []string{"support_datagram_v2"}, Expires: expires}))
+	override, err = LoadOverride(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"support_datagram_v2"}, override.Enable)
+	assert.Empty(t, override.Disable)
+	assert.True(t, expires.Equal(override.Expires))
+}
@@ -0,0 +1,68 @@
+package features
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Selector selects the features negotiated with the edge: the default ones, overridden by the override file until the
+// override expires. The file is read every time, so that an override applies to the next connections to the edge
+// without restarting cloudflared.
+type Selector struct {
+	defaults     []string
+	overrideFile string
+	log          *zerolog.Logger
+	now          func() time.Time
+}
+
+// NewSelector returns a Selector of the defaults features, overridden by overrideFile if it isn't empty.
+func NewSelector(defaults []string, overrideFile string, log *zerolog.Logger) *Selector {
+	return &Selector{
+		defaults:     defaults,
+		overrideFile: overrideFile,
+		log:          log,
+		now:          time.Now,
+	}
+}
+
+// Features returns the features in effect.
+func (s *Selector) Features() []string {
+	features, _ := s.selectFeatures()
+	return features
+}
+
+// selectFeatures returns the features in effect, and the override if it applies
+func (s *Selector) selectFeatures() ([]string, *Override) {
+	if s.overrideFile == "" {
+		return s.defaults, nil
+	}
+	override, err := LoadOverride(s.overrideFile)
+	if err != nil {
+		s.log.Err(err).Msg("Ignoring the feature override file")
+		return s.defaults, nil
+	}
+	if override.Expired(s.now()) {
+		return s.defaults, nil
+	}
+	return override.Apply(s.defaults, s.now()), override
+}
+
+type selectorStatus struct {
+	Features []string  `json:"features"`
+	Defaults []string  `json:"defaults"`
+	Override *Override `json:"override,omitempty"`
+}
+
+// ServeHTTP serves the features in effect, the default ones and the override that applies as JSON.
+func (s *Selector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	features, override := s.selectFeatures()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(selectorStatus{
+		Features: features,
+		Defaults: s.defaults,
+		Override: override,
+	})
+}
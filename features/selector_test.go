@@ -0,0 +1,43 @@
+package features
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelector(t *testing.T) {
+	log := zerolog.Nop()
+	path := filepath.Join(t.TempDir(), "features.json")
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	selector := NewSelector([]string{"serialized_headers"}, path, &log)
+	selector.now = func() time.Time { return now }
+	assert.Equal(t, []string{"serialized_headers"}, selector.Features())
+
+	// The override is read without creating the selector again, until it expires
+	require.NoError(t, SaveOverride(path, &Override{Enable: []string{"support_datagram_v2"}, Expires: now.Add(time.Minute)}))
+	assert.Equal(t, []string{"serialized_headers", "support_datagram_v2"}, selector.Features())
+
+	recorder := httptest.NewRecorder()
+	selector.ServeHTTP(recorder, httptest.NewRequest("GET", "/features", nil))
+	var status selectorStatus
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&status))
+	assert.Equal(t, []string{"serialized_headers", "support_datagram_v2"}, status.Features)
+	assert.Equal(t, []string{"serialized_headers"}, status.Defaults)
+	require.NotNil(t, status.Override)
+	assert.Equal(t, []string{"support_datagram_v2"}, status.Override.Enable)
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, []string{"serialized_headers"}, selector.Features())
+
+	// An invalid override is ignored
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+	assert.Equal(t, []string{"serialized_headers"}, selector.Features())
+}
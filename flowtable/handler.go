@@ -0,0 +1,88 @@
+package flowtable
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPerPage = 100
+	maxPerPage     = 1000
+)
+
+// ResultInfo is the pagination of a page of flows, like the one of the Cloudflare API
+type ResultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+	TotalPages int `json:"total_pages"`
+}
+
+// Page is a page of the active flows
+type Page struct {
+	Flows      []Snapshot `json:"flows"`
+	ResultInfo ResultInfo `json:"result_info"`
+}
+
+// Page returns the flows of page, starting at 1, with perPage flows by page
+func (t *Table) Page(protocol Protocol, page, perPage int) Page {
+	flows := t.List(protocol)
+	info := ResultInfo{
+		Page:       page,
+		PerPage:    perPage,
+		TotalCount: len(flows),
+		TotalPages: (len(flows) + perPage - 1) / perPage,
+	}
+	start := (page - 1) * perPage
+	if start > len(flows) {
+		start = len(flows)
+	}
+	end := start + perPage
+	if end > len(flows) {
+		end = len(flows)
+	}
+	info.Count = end - start
+	if flows == nil {
+		flows = []Snapshot{}
+	}
+	return Page{
+		Flows:      flows[start:end],
+		ResultInfo: info,
+	}
+}
+
+// ServeHTTP lists the active flows as JSON. The query parameters page and per_page paginate them, and protocol
+// filters them by protocol.
+func (t *Table) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, err := intParam(query.Get("page"), 1)
+	if err != nil || page < 1 {
+		http.Error(w, fmt.Sprintf("invalid page %q", query.Get("page")), http.StatusBadRequest)
+		return
+	}
+	perPage, err := intParam(query.Get("per_page"), defaultPerPage)
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		http.Error(w, fmt.Sprintf("invalid per_page %q, expected 1 to %d", query.Get("per_page"), maxPerPage), http.StatusBadRequest)
+		return
+	}
+	protocol := Protocol(query.Get("protocol"))
+	switch protocol {
+	case "", TCP, UDP:
+	default:
+		http.Error(w, fmt.Sprintf("invalid protocol %q, expected %s or %s", protocol, TCP, UDP), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(t.Page(protocol, page, perPage))
+}
+
+func intParam(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
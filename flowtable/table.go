@@ -0,0 +1,145 @@
+// Package flowtable tracks the active warp-routing flows of cloudflared: TCP flows and UDP sessions proxied from WARP
+// clients to private networks, with the bytes they transferred so far.
+package flowtable
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Protocol of a flow
+type Protocol string
+
+const (
+	TCP Protocol = "tcp"
+	UDP Protocol = "udp"
+)
+
+// Flow is an active flow. Src is the local address cloudflared uses to reach Dst, so the table reads like the table
+// of a NAT.
+type Flow struct {
+	// bytesToOrigin and bytesFromOrigin are first to be 64-bit aligned for atomic operations
+	bytesToOrigin   uint64
+	bytesFromOrigin uint64
+
+	ID       string
+	Protocol Protocol
+	Src      string
+	Dst      string
+	Start    time.Time
+}
+
+// AddBytesToOrigin counts n bytes sent to the origin
+func (f *Flow) AddBytesToOrigin(n int) {
+	if n > 0 {
+		atomic.AddUint64(&f.bytesToOrigin, uint64(n))
+	}
+}
+
+// AddBytesFromOrigin counts n bytes received from the origin
+func (f *Flow) AddBytesFromOrigin(n int) {
+	if n > 0 {
+		atomic.AddUint64(&f.bytesFromOrigin, uint64(n))
+	}
+}
+
+// Snapshot is the state of a flow at a point in time
+type Snapshot struct {
+	ID              string    `json:"id"`
+	Protocol        Protocol  `json:"protocol"`
+	Src             string    `json:"src"`
+	Dst             string    `json:"dst"`
+	StartedAt       time.Time `json:"started_at"`
+	Age             string    `json:"age"`
+	BytesToOrigin   uint64    `json:"bytes_to_origin"`
+	BytesFromOrigin uint64    `json:"bytes_from_origin"`
+}
+
+func (f *Flow) snapshot(now time.Time) Snapshot {
+	return Snapshot{
+		ID:              f.ID,
+		Protocol:        f.Protocol,
+		Src:             f.Src,
+		Dst:             f.Dst,
+		StartedAt:       f.Start,
+		Age:             now.Sub(f.Start).Truncate(time.Second).String(),
+		BytesToOrigin:   atomic.LoadUint64(&f.bytesToOrigin),
+		BytesFromOrigin: atomic.LoadUint64(&f.bytesFromOrigin),
+	}
+}
+
+// Table is the active flows. A nil Table tracks nothing.
+type Table struct {
+	lock  sync.RWMutex
+	flows map[*Flow]struct{}
+}
+
+func NewTable() *Table {
+	return &Table{
+		flows: make(map[*Flow]struct{}),
+	}
+}
+
+// Add tracks a new flow until it's removed
+func (t *Table) Add(protocol Protocol, id, src, dst string) *Flow {
+	flow := &Flow{
+		ID:       id,
+		Protocol: protocol,
+		Src:      src,
+		Dst:      dst,
+		Start:    time.Now(),
+	}
+	if t == nil {
+		return flow
+	}
+	t.lock.Lock()
+	t.flows[flow] = struct{}{}
+	t.lock.Unlock()
+	return flow
+}
+
+// Remove stops tracking a flow once it's closed
+func (t *Table) Remove(flow *Flow) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	delete(t.flows, flow)
+	t.lock.Unlock()
+}
+
+// Len is the number of active flows
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return len(t.flows)
+}
+
+// List returns the active flows of protocol, or of all protocols if it's empty, the oldest first
+func (t *Table) List(protocol Protocol) []Snapshot {
+	if t == nil {
+		return nil
+	}
+	now := time.Now()
+	t.lock.RLock()
+	snapshots := make([]Snapshot, 0, len(t.flows))
+	for flow := range t.flows {
+		if protocol == "" || flow.Protocol == protocol {
+			snapshots = append(snapshots, flow.snapshot(now))
+		}
+	}
+	t.lock.RUnlock()
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		if !snapshots[i].StartedAt.Equal(snapshots[j].StartedAt) {
+			return snapshots[i].StartedAt.Before(snapshots[j].StartedAt)
+		}
+		return snapshots[i].ID < snapshots[j].ID
+	})
+	return snapshots
+}
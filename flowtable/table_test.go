@@ -0,0 +1,99 @@
+package flowtable
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTable(t *testing.T) {
+	table := NewTable()
+	tcpFlow := table.Add(TCP, "flow1", "10.0.0.2:51000", "10.0.1.10:5432")
+	udpFlow := table.Add(UDP, "flow2", "10.0.0.2:52000", "10.0.1.53:53")
+	require.Equal(t, 2, table.Len())
+
+	tcpFlow.AddBytesToOrigin(100)
+	tcpFlow.AddBytesFromOrigin(2000)
+	tcpFlow.AddBytesFromOrigin(0)
+
+	flows := table.List("")
+	require.Len(t, flows, 2)
+	assert.Equal(t, "flow1", flows[0].ID)
+	assert.Equal(t, TCP, flows[0].Protocol)
+	assert.Equal(t, "10.0.0.2:51000", flows[0].Src)
+	assert.Equal(t, "10.0.1.10:5432", flows[0].Dst)
+	assert.Equal(t, uint64(100), flows[0].BytesToOrigin)
+	assert.Equal(t, uint64(2000), flows[0].BytesFromOrigin)
+	assert.Equal(t, "flow2", flows[1].ID)
+
+	flows = table.List(UDP)
+	require.Len(t, flows, 1)
+	assert.Equal(t, "flow2", flows[0].ID)
+
+	table.Remove(udpFlow)
+	table.Remove(udpFlow)
+	require.Equal(t, 1, table.Len())
+	table.Remove(tcpFlow)
+	require.Empty(t, table.List(""))
+}
+
+func TestNilTable(t *testing.T) {
+	var table *Table
+	flow := table.Add(TCP, "flow", "", "10.0.1.10:22")
+	flow.AddBytesToOrigin(10)
+	table.Remove(flow)
+	assert.Equal(t, 0, table.Len())
+	assert.Empty(t, table.List(""))
+	assert.Equal(t, []Snapshot{}, table.Page("", 1, 10).Flows)
+}
+
+func TestPage(t *testing.T) {
+	table := NewTable()
+	for i := 0; i < 5; i++ {
+		table.Add(TCP, fmt.Sprintf("flow%d", i), "", "10.0.1.10:22")
+	}
+
+	page := table.Page("", 2, 2)
+	assert.Equal(t, ResultInfo{Page: 2, PerPage: 2, Count: 2, TotalCount: 5, TotalPages: 3}, page.ResultInfo)
+	require.Len(t, page.Flows, 2)
+
+	page = table.Page("", 3, 2)
+	assert.Equal(t, 1, page.ResultInfo.Count)
+	require.Len(t, page.Flows, 1)
+
+	page = table.Page("", 4, 2)
+	assert.Equal(t, 0, page.ResultInfo.Count)
+	assert.Empty(t, page.Flows)
+
+	page = table.Page(UDP, 1, 2)
+	assert.Equal(t, ResultInfo{Page: 1, PerPage: 2}, page.ResultInfo)
+}
+
+func TestServeHTTP(t *testing.T) {
+	table := NewTable()
+	table.Add(TCP, "flow1", "10.0.0.2:51000", "10.0.1.10:5432")
+	table.Add(UDP, "flow2", "10.0.0.2:52000", "10.0.1.53:53")
+
+	get := func(query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		table.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/flows"+query, nil))
+		return recorder
+	}
+
+	resp := get("?protocol=udp&per_page=1")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var page Page
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+	require.Len(t, page.Flows, 1)
+	assert.Equal(t, "flow2", page.Flows[0].ID)
+	assert.Equal(t, 1, page.ResultInfo.TotalCount)
+
+	for _, query := range []string{"?page=0", "?page=a", "?per_page=0", "?per_page=1001", "?protocol=icmp"} {
+		assert.Equal(t, http.StatusBadRequest, get(query).Code, query)
+	}
+}
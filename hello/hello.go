@@ -6,10 +6,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -23,9 +27,26 @@ const (
 	WSRoute        = "/ws"
 	SSERoute       = "/sse"
 	HealthRoute    = "/_health"
+	EchoRoute      = "/echo"
 	defaultSSEFreq = time.Second * 10
+	// maxEchoBody is the size of the body of a request that's echoed, the rest is dropped
+	maxEchoBody = 1 << 20
 )
 
+// Config customizes the responses of the Hello World server
+type Config struct {
+	// ResponseTemplate renders the responses to any path but the routes of the server, instead of the built-in page.
+	// See ParseResponseTemplate.
+	ResponseTemplate ResponseTemplate
+	// Latency delays every response but the ones to HealthRoute, to test how slow origins are handled
+	Latency time.Duration
+}
+
+// ResponseTemplate is a Go template, its data has the ServerName, the Request and its Body
+type ResponseTemplate interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
 type templateData struct {
 	ServerName string
 	Request    *http.Request
@@ -99,7 +120,20 @@ const indexTemplate = `
 </html>
 `
 
-func StartHelloWorldServer(log *zerolog.Logger, listener net.Listener, shutdownC <-chan struct{}) error {
+// ParseResponseTemplate parses the template in path. It's an HTML template, escaped accordingly, if the file has an
+// .html extension, and a text template otherwise, e.g. to respond with JSON.
+func ParseResponseTemplate(path string) (ResponseTemplate, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".html") {
+		return template.New(filepath.Base(path)).Parse(string(content))
+	}
+	return texttemplate.New(filepath.Base(path)).Parse(string(content))
+}
+
+func StartHelloWorldServer(log *zerolog.Logger, listener net.Listener, shutdownC <-chan struct{}, config Config) error {
 	log.Info().Msgf("Starting Hello World server at %s", listener.Addr())
 	serverName := defaultServerName
 	if hostname, err := os.Hostname(); err == nil {
@@ -116,8 +150,13 @@ func StartHelloWorldServer(log *zerolog.Logger, listener net.Listener, shutdownC
 	muxer.HandleFunc(WSRoute, websocketHandler(log, upgrader))
 	muxer.HandleFunc(SSERoute, sseHandler(log))
 	muxer.HandleFunc(HealthRoute, healthHandler())
-	muxer.HandleFunc("/", rootHandler(serverName))
-	httpServer := &http.Server{Addr: listener.Addr().String(), Handler: muxer}
+	muxer.HandleFunc(EchoRoute, echoHandler())
+	responseTemplate := config.ResponseTemplate
+	if responseTemplate == nil {
+		responseTemplate = template.Must(template.New("index").Parse(indexTemplate))
+	}
+	muxer.HandleFunc("/", rootHandler(serverName, responseTemplate))
+	httpServer := &http.Server{Addr: listener.Addr().String(), Handler: withLatency(muxer, config.Latency)}
 	go func() {
 		<-shutdownC
 		_ = httpServer.Close()
@@ -229,8 +268,82 @@ func healthHandler() http.HandlerFunc {
 	}
 }
 
-func rootHandler(serverName string) http.HandlerFunc {
-	responseTemplate := template.Must(template.New("index").Parse(indexTemplate))
+// EchoResponse describes the request the echo route responds to
+type EchoResponse struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Host   string `json:"host"`
+	// Proto is the HTTP protocol of the request, and TLSProtocol the protocol negotiated with ALPN if any
+	Proto       string      `json:"proto"`
+	TLSProtocol string      `json:"tlsProtocol,omitempty"`
+	ClientIP    string      `json:"clientIP"`
+	Headers     http.Header `json:"headers"`
+	Body        string      `json:"body"`
+	// BodyTruncated is whether the body was larger than what's echoed
+	BodyTruncated bool `json:"bodyTruncated,omitempty"`
+}
+
+// echoHandler responds with the EchoResponse of the request as JSON
+func echoHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxEchoBody+1))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "error: %v", err)
+			return
+		}
+		resp := EchoResponse{
+			Method:        r.Method,
+			URL:           r.URL.String(),
+			Host:          r.Host,
+			Proto:         r.Proto,
+			ClientIP:      clientIP(r),
+			Headers:       r.Header,
+			Body:          string(body),
+			BodyTruncated: len(body) > maxEchoBody,
+		}
+		if resp.BodyTruncated {
+			resp.Body = string(body[:maxEchoBody])
+		}
+		if r.TLS != nil {
+			resp.TLSProtocol = r.TLS.NegotiatedProtocol
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// clientIP is the IP of the eyeball the edge forwards the request of, else the IP the request came from
+func clientIP(r *http.Request) string {
+	if ip := r.Header.Get("Cf-Connecting-Ip"); ip != "" {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// withLatency delays the responses of handler but the ones to HealthRoute by latency
+func withLatency(handler http.Handler, latency time.Duration) http.Handler {
+	if latency <= 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != HealthRoute {
+			timer := time.NewTimer(latency)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func rootHandler(serverName string, responseTemplate ResponseTemplate) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var buffer bytes.Buffer
 		var body string
@@ -1,7 +1,18 @@
 package hello
 
 import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateTLSListenerHostAndPortSuccess(t *testing.T) {
@@ -36,3 +47,68 @@ func TestCreateTLSListenerOnlyPortSuccess(t *testing.T) {
 		t.Fatal("Fail to find available port")
 	}
 }
+
+func TestEchoHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "https://hello.example.com/echo?a=b", strings.NewReader("ping"))
+	req.Header.Set("Cf-Connecting-Ip", "203.0.113.7")
+	req.Header.Set("X-Test", "1")
+	req.TLS = &tls.ConnectionState{NegotiatedProtocol: "h2"}
+	recorder := httptest.NewRecorder()
+	echoHandler()(recorder, req)
+
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var resp EchoResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&resp))
+	assert.Equal(t, http.MethodPost, resp.Method)
+	assert.Equal(t, "https://hello.example.com/echo?a=b", resp.URL)
+	assert.Equal(t, "hello.example.com", resp.Host)
+	assert.Equal(t, "HTTP/1.1", resp.Proto)
+	assert.Equal(t, "h2", resp.TLSProtocol)
+	assert.Equal(t, "203.0.113.7", resp.ClientIP)
+	assert.Equal(t, "1", resp.Headers.Get("X-Test"))
+	assert.Equal(t, "ping", resp.Body)
+	assert.False(t, resp.BodyTruncated)
+
+	req = httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(strings.Repeat("a", maxEchoBody+10)))
+	recorder = httptest.NewRecorder()
+	echoHandler()(recorder, req)
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&resp))
+	assert.Len(t, resp.Body, maxEchoBody)
+	assert.True(t, resp.BodyTruncated)
+	assert.Equal(t, "192.0.2.1", resp.ClientIP)
+}
+
+func TestResponseTemplate(t *testing.T) {
+	dir := t.TempDir()
+	textPath := filepath.Join(dir, "response.json")
+	require.NoError(t, os.WriteFile(textPath, []byte(`{"server":"{{.ServerName}}","path":"{{.Request.URL.Path}}"}`), 0600))
+	htmlPath := filepath.Join(dir, "response.html")
+	require.NoError(t, os.WriteFile(htmlPath, []byte(`<p>{{.Body}}</p>`), 0600))
+
+	textTemplate, err := ParseResponseTemplate(textPath)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	rootHandler("test", textTemplate)(recorder, httptest.NewRequest(http.MethodGet, "/a", nil))
+	assert.Equal(t, `{"server":"test","path":"/a"}`, recorder.Body.String())
+
+	htmlTemplate, err := ParseResponseTemplate(htmlPath)
+	require.NoError(t, err)
+	recorder = httptest.NewRecorder()
+	rootHandler("test", htmlTemplate)(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("<b>")))
+	assert.Equal(t, `<p>&lt;b&gt;</p>`, recorder.Body.String())
+
+	_, err = ParseResponseTemplate(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestWithLatency(t *testing.T) {
+	handler := withLatency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), 50*time.Millisecond)
+
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	start = time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, HealthRoute, nil))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
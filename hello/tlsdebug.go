@@ -0,0 +1,126 @@
+package hello
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/tlsconfig"
+)
+
+// TLSDebugResponse describes the TLS connection of the request the TLS debug server responds to
+type TLSDebugResponse struct {
+	Version            string `json:"version"`
+	CipherSuite        string `json:"cipherSuite"`
+	NegotiatedProtocol string `json:"negotiatedProtocol,omitempty"`
+	// ServerName is the SNI the client sent
+	ServerName string `json:"serverName,omitempty"`
+	DidResume  bool   `json:"didResume"`
+	// ClientCertificates is the chain the client presented, leaf first
+	ClientCertificates []CertificateDetails `json:"clientCertificates"`
+	Method             string               `json:"method"`
+	URL                string               `json:"url"`
+	Headers            http.Header          `json:"headers"`
+}
+
+// CertificateDetails describes a certificate
+type CertificateDetails struct {
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	SerialNumber      string    `json:"serialNumber"`
+	NotBefore         time.Time `json:"notBefore"`
+	NotAfter          time.Time `json:"notAfter"`
+	DNSNames          []string  `json:"dnsNames,omitempty"`
+	IPAddresses       []string  `json:"ipAddresses,omitempty"`
+	SHA256Fingerprint string    `json:"sha256Fingerprint"`
+}
+
+// CreateTLSDebugListener listens on address with the certificate of the Hello World server, requesting a certificate
+// from clients without requiring or verifying it, so that any chain is reported.
+func CreateTLSDebugListener(address string) (net.Listener, error) {
+	certificate, err := tlsconfig.GetHelloCertificate()
+	if err != nil {
+		return nil, err
+	}
+	return tls.Listen("tcp", address, &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientAuth:   tls.RequestClientCert,
+		NextProtos:   []string{"h2", "http/1.1"},
+	})
+}
+
+// StartTLSDebugServer serves the TLSDebugResponse of every request as JSON, to check the TLS settings of the
+// connections to origins end to end.
+func StartTLSDebugServer(log *zerolog.Logger, listener net.Listener, shutdownC <-chan struct{}) error {
+	log.Info().Msgf("Starting TLS debug server at %s", listener.Addr())
+	httpServer := &http.Server{Addr: listener.Addr().String(), Handler: tlsDebugHandler()}
+	go func() {
+		<-shutdownC
+		_ = httpServer.Close()
+	}()
+	return httpServer.Serve(listener)
+}
+
+func tlsDebugHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("the request wasn't sent over TLS"))
+			return
+		}
+		resp := TLSDebugResponse{
+			Version:            tlsVersionName(r.TLS.Version),
+			CipherSuite:        tls.CipherSuiteName(r.TLS.CipherSuite),
+			NegotiatedProtocol: r.TLS.NegotiatedProtocol,
+			ServerName:         r.TLS.ServerName,
+			DidResume:          r.TLS.DidResume,
+			ClientCertificates: []CertificateDetails{},
+			Method:             r.Method,
+			URL:                r.URL.String(),
+			Headers:            r.Header,
+		}
+		for _, cert := range r.TLS.PeerCertificates {
+			resp.ClientCertificates = append(resp.ClientCertificates, certificateDetails(cert))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func certificateDetails(cert *x509.Certificate) CertificateDetails {
+	fingerprint := sha256.Sum256(cert.Raw)
+	details := CertificateDetails{
+		Subject:           cert.Subject.String(),
+		Issuer:            cert.Issuer.String(),
+		SerialNumber:      cert.SerialNumber.String(),
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+		DNSNames:          cert.DNSNames,
+		SHA256Fingerprint: hex.EncodeToString(fingerprint[:]),
+	}
+	for _, ip := range cert.IPAddresses {
+		details.IPAddresses = append(details.IPAddresses, ip.String())
+	}
+	return details
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return "unknown"
+}
@@ -0,0 +1,59 @@
+package hello
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/tlsconfig"
+)
+
+func TestTLSDebugServer(t *testing.T) {
+	log := zerolog.Nop()
+	listener, err := CreateTLSDebugListener("127.0.0.1:")
+	require.NoError(t, err)
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	go func() {
+		_ = StartTLSDebugServer(&log, listener, shutdownC)
+	}()
+
+	certificate, err := tlsconfig.GetHelloCertificate()
+	require.NoError(t, err)
+	leaf, err := tlsconfig.GetHelloCertificateX509()
+	require.NoError(t, err)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(leaf)
+
+	request := func(clientCerts []tls.Certificate) TLSDebugResponse {
+		client := http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: rootCAs, Certificates: clientCerts},
+		}}
+		resp, err := client.Get("https://" + listener.Addr().String() + "/path")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var debug TLSDebugResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&debug))
+		return debug
+	}
+
+	debug := request(nil)
+	assert.Equal(t, "TLS 1.3", debug.Version)
+	assert.NotEmpty(t, debug.CipherSuite)
+	assert.Equal(t, http.MethodGet, debug.Method)
+	assert.Equal(t, "/path", debug.URL)
+	assert.Empty(t, debug.ClientCertificates)
+
+	debug = request([]tls.Certificate{certificate})
+	require.Len(t, debug.ClientCertificates, 1)
+	assert.Equal(t, leaf.Subject.String(), debug.ClientCertificates[0].Subject)
+	assert.Equal(t, leaf.SerialNumber.String(), debug.ClientCertificates[0].SerialNumber)
+	assert.Len(t, debug.ClientCertificates[0].SHA256Fingerprint, 64)
+}
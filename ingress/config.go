@@ -2,6 +2,8 @@ package ingress
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"time"
 
 	"github.com/urfave/cli/v2"
@@ -46,10 +48,22 @@ const (
 type WarpRoutingConfig struct {
 	Enabled        bool                  `yaml:"enabled" json:"enabled"`
 	ConnectTimeout config.CustomDuration `yaml:"connectTimeout" json:"connectTimeout,omitempty"`
-	TCPKeepAlive   config.CustomDuration `yaml:"tcpKeepAlive" json:"tcpKeepAlive,omitempty"`
+	// IdleTimeout closes TCP flows without traffic for that long, flows are never closed for being idle if it's 0
+	IdleTimeout  config.CustomDuration `yaml:"idleTimeout" json:"idleTimeout,omitempty"`
+	TCPKeepAlive config.CustomDuration `yaml:"tcpKeepAlive" json:"tcpKeepAlive,omitempty"`
+	// Overrides are the settings of the TCP flows to some networks
+	Overrides []WarpRoutingOverride `yaml:"overrides" json:"overrides,omitempty"`
 }
 
-func NewWarpRoutingConfig(raw *config.WarpRoutingConfig) WarpRoutingConfig {
+// WarpRoutingOverride is the settings of the TCP flows to a network
+type WarpRoutingOverride struct {
+	Network        *net.IPNet
+	ConnectTimeout config.CustomDuration
+	IdleTimeout    config.CustomDuration
+	TCPKeepAlive   config.CustomDuration
+}
+
+func NewWarpRoutingConfig(raw *config.WarpRoutingConfig) (WarpRoutingConfig, error) {
 	cfg := WarpRoutingConfig{
 		Enabled:        raw.Enabled,
 		ConnectTimeout: defaultWarpRoutingConnectTimeout,
@@ -58,10 +72,35 @@ func NewWarpRoutingConfig(raw *config.WarpRoutingConfig) WarpRoutingConfig {
 	if raw.ConnectTimeout != nil {
 		cfg.ConnectTimeout = *raw.ConnectTimeout
 	}
+	if raw.IdleTimeout != nil {
+		cfg.IdleTimeout = *raw.IdleTimeout
+	}
 	if raw.TCPKeepAlive != nil {
 		cfg.TCPKeepAlive = *raw.TCPKeepAlive
 	}
-	return cfg
+	for _, rawOverride := range raw.Overrides {
+		_, network, err := net.ParseCIDR(rawOverride.Network)
+		if err != nil {
+			return WarpRoutingConfig{}, fmt.Errorf("invalid warp-routing override network %q, expected a CIDR", rawOverride.Network)
+		}
+		override := WarpRoutingOverride{
+			Network:        network,
+			ConnectTimeout: cfg.ConnectTimeout,
+			IdleTimeout:    cfg.IdleTimeout,
+			TCPKeepAlive:   cfg.TCPKeepAlive,
+		}
+		if rawOverride.ConnectTimeout != nil {
+			override.ConnectTimeout = *rawOverride.ConnectTimeout
+		}
+		if rawOverride.IdleTimeout != nil {
+			override.IdleTimeout = *rawOverride.IdleTimeout
+		}
+		if rawOverride.TCPKeepAlive != nil {
+			override.TCPKeepAlive = *rawOverride.TCPKeepAlive
+		}
+		cfg.Overrides = append(cfg.Overrides, override)
+	}
+	return cfg, nil
 }
 
 func (c *WarpRoutingConfig) RawConfig() config.WarpRoutingConfig {
@@ -71,9 +110,21 @@ func (c *WarpRoutingConfig) RawConfig() config.WarpRoutingConfig {
 	if c.ConnectTimeout.Duration != defaultWarpRoutingConnectTimeout.Duration {
 		raw.ConnectTimeout = &c.ConnectTimeout
 	}
+	if c.IdleTimeout.Duration != 0 {
+		raw.IdleTimeout = &c.IdleTimeout
+	}
 	if c.TCPKeepAlive.Duration != defaultTCPKeepAlive.Duration {
 		raw.TCPKeepAlive = &c.TCPKeepAlive
 	}
+	for i := range c.Overrides {
+		override := &c.Overrides[i]
+		raw.Overrides = append(raw.Overrides, config.WarpRoutingOverride{
+			Network:        override.Network.String(),
+			ConnectTimeout: &override.ConnectTimeout,
+			IdleTimeout:    &override.IdleTimeout,
+			TCPKeepAlive:   &override.TCPKeepAlive,
+		})
+	}
 	return raw
 }
 
@@ -107,8 +158,13 @@ func (rc *RemoteConfig) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
+	warpRouting, err := NewWarpRoutingConfig(&rawConfig.WarpRouting)
+	if err != nil {
+		return err
+	}
+
 	rc.Ingress = ingress
-	rc.WarpRouting = NewWarpRoutingConfig(&rawConfig.WarpRouting)
+	rc.WarpRouting = warpRouting
 
 	return nil
 }
@@ -265,6 +321,105 @@ func originRequestFromConfig(c config.OriginRequestConfig) OriginRequestConfig {
 	if c.Http2Origin != nil {
 		out.Http2Origin = *c.Http2Origin
 	}
+	if c.WebSocketPingInterval != nil {
+		out.WebSocketPingInterval = *c.WebSocketPingInterval
+	}
+	if c.WebSocketPongTimeout != nil {
+		out.WebSocketPongTimeout = *c.WebSocketPongTimeout
+	}
+	if c.WebSocketMaxMessageSize != nil {
+		out.WebSocketMaxMessageSize = *c.WebSocketMaxMessageSize
+	}
+	if c.DisableWebSocketCompression != nil {
+		out.DisableWebSocketCompression = *c.DisableWebSocketCompression
+	}
+	if c.MaxConcurrentStreams != nil {
+		out.MaxConcurrentStreams = *c.MaxConcurrentStreams
+	}
+	if c.HelloWorldTemplate != nil {
+		out.HelloWorldTemplate = *c.HelloWorldTemplate
+	}
+	if c.HelloWorldLatency != nil {
+		out.HelloWorldLatency = *c.HelloWorldLatency
+	}
+	if c.ResponseHeaderTimeout != nil {
+		out.ResponseHeaderTimeout = *c.ResponseHeaderTimeout
+	}
+	if c.RequestTimeout != nil {
+		out.RequestTimeout = *c.RequestTimeout
+	}
+	if c.TCPIdleTimeout != nil {
+		out.TCPIdleTimeout = *c.TCPIdleTimeout
+	}
+	if c.TCPHalfClose != nil {
+		out.TCPHalfClose = *c.TCPHalfClose
+	}
+	if c.SlowOriginThreshold != nil {
+		out.SlowOriginThreshold = *c.SlowOriginThreshold
+	}
+	if c.SlowOriginPendingRequests != nil {
+		out.SlowOriginPendingRequests = *c.SlowOriginPendingRequests
+	}
+	if c.GRPCWeb != nil {
+		out.GRPCWeb = *c.GRPCWeb
+	}
+	if c.DisableResponseBuffering != nil {
+		out.DisableResponseBuffering = *c.DisableResponseBuffering
+	}
+	if c.FlushInterval != nil {
+		out.FlushInterval = *c.FlushInterval
+	}
+	if c.StreamTimeout != nil {
+		out.StreamTimeout = *c.StreamTimeout
+	}
+	if c.SourceAddress != nil {
+		out.SourceAddress = *c.SourceAddress
+	}
+	if c.HTTPSRedirect != nil {
+		out.HTTPSRedirect = *c.HTTPSRedirect
+	}
+	if c.HSTSMaxAge != nil {
+		out.HSTSMaxAge = *c.HSTSMaxAge
+	}
+	if c.HSTSIncludeSubdomains != nil {
+		out.HSTSIncludeSubdomains = *c.HSTSIncludeSubdomains
+	}
+	if c.MaintenanceStatus != nil {
+		out.MaintenanceStatus = *c.MaintenanceStatus
+	}
+	if c.MaintenancePage != nil {
+		out.MaintenancePage = *c.MaintenancePage
+	}
+	if c.DisableAccessLog != nil {
+		out.DisableAccessLog = *c.DisableAccessLog
+	}
+	if len(c.AccessLogFields) > 0 {
+		out.AccessLogFields = c.AccessLogFields
+	}
+	if c.WarmConnections != nil {
+		out.WarmConnections = *c.WarmConnections
+	}
+	if c.RevocationCheck != nil {
+		out.RevocationCheck = *c.RevocationCheck
+	}
+	if c.RevocationSoftFail != nil {
+		out.RevocationSoftFail = *c.RevocationSoftFail
+	}
+	if c.TLSMinVersion != nil {
+		out.TLSMinVersion = *c.TLSMinVersion
+	}
+	if c.TLSMaxVersion != nil {
+		out.TLSMaxVersion = *c.TLSMaxVersion
+	}
+	if len(c.TLSCipherSuites) > 0 {
+		out.TLSCipherSuites = c.TLSCipherSuites
+	}
+	if c.ForwardClientCert != nil {
+		out.ForwardClientCert = *c.ForwardClientCert
+	}
+	if c.HealthPath != nil {
+		out.HealthPath = *c.HealthPath
+	}
 	return out
 }
 
@@ -284,9 +439,9 @@ type OriginRequestConfig struct {
 	KeepAliveTimeout config.CustomDuration `yaml:"keepAliveTimeout" json:"keepAliveTimeout"`
 	// HTTP proxy maximum keepalive connection pool size
 	KeepAliveConnections int `yaml:"keepAliveConnections" json:"keepAliveConnections"`
-	// Sets the HTTP Host header for the local webserver.
+	// Sets the HTTP Host header for the local webserver. It can contain the variables of the matched request, e.g. ${1}.
 	HTTPHostHeader string `yaml:"httpHostHeader" json:"httpHostHeader"`
-	// Hostname on the origin server certificate.
+	// Hostname on the origin server certificate. It can contain the variables of the matched request, e.g. ${1}.internal.
 	OriginServerName string `yaml:"originServerName" json:"originServerName"`
 	// Path to the CA for the certificate of your origin.
 	// This option should be used only if your certificate is not signed by Cloudflare.
@@ -310,6 +465,108 @@ type OriginRequestConfig struct {
 	IPRules []ipaccess.Rule `yaml:"ipRules" json:"ipRules"`
 	// Attempt to connect to origin with HTTP/2
 	Http2Origin bool `yaml:"http2Origin" json:"http2Origin"`
+	// Interval of the pings sent to the origin of WebSocket connections, no pings are sent if it's 0
+	WebSocketPingInterval config.CustomDuration `yaml:"webSocketPingInterval" json:"webSocketPingInterval"`
+	// Timeout for the origin to answer a ping of a WebSocket connection, before closing the connection
+	WebSocketPongTimeout config.CustomDuration `yaml:"webSocketPongTimeout" json:"webSocketPongTimeout"`
+	// Maximum size in bytes of the messages of WebSocket connections, larger messages close the connection
+	WebSocketMaxMessageSize uint `yaml:"webSocketMaxMessageSize" json:"webSocketMaxMessageSize"`
+	// Disables the compression of WebSocket messages, which is negotiated between the client and origin otherwise.
+	// Compressed messages are limited by webSocketMaxMessageSize after compression.
+	DisableWebSocketCompression bool `yaml:"disableWebSocketCompression" json:"disableWebSocketCompression"`
+	// Maximum number of concurrent WebSocket and TCP streams to the origin of the rule, there is no maximum if it's 0.
+	// Streams over the maximum are answered with 503 Service Unavailable.
+	MaxConcurrentStreams uint `yaml:"maxConcurrentStreams" json:"maxConcurrentStreams"`
+	// File of the Go template of the responses of the hello_world service to any path but its built-in routes,
+	// instead of its built-in page. It's an HTML template if the file has an .html extension.
+	HelloWorldTemplate string `yaml:"helloWorldTemplate" json:"helloWorldTemplate"`
+	// Delay of the responses of the hello_world service, to test how slow origins are handled
+	HelloWorldLatency config.CustomDuration `yaml:"helloWorldLatency" json:"helloWorldLatency"`
+	// HTTP proxy timeout for the origin to send the headers of its response after the request was sent, there is no
+	// timeout if it's 0
+	ResponseHeaderTimeout config.CustomDuration `yaml:"responseHeaderTimeout" json:"responseHeaderTimeout"`
+	// HTTP proxy deadline of a whole request, from connecting to the origin to the end of its response, there is no
+	// deadline if it's 0. It doesn't apply to WebSocket connections once they are established.
+	RequestTimeout config.CustomDuration `yaml:"requestTimeout" json:"requestTimeout"`
+	// Timeout for closing the TCP connections to the origin of a tcp:// service without traffic in either direction,
+	// they are never closed for being idle if it's 0
+	TCPIdleTimeout config.CustomDuration `yaml:"tcpIdleTimeout" json:"tcpIdleTimeout"`
+	// Keeps the TCP connections to the origin of a tcp:// service open until both directions are done, instead of
+	// closing them as soon as one direction is done. Protocols like FTP and SMTP need the origin to keep responding
+	// after the client half-closed the connection.
+	TCPHalfClose bool `yaml:"tcpHalfClose" json:"tcpHalfClose"`
+	// Warns and counts in the slow_origin_warnings metric when the p99 latency of the latest requests to the origin,
+	// until its response headers, exceeds it. There are no such warnings if it's 0.
+	SlowOriginThreshold config.CustomDuration `yaml:"slowOriginThreshold" json:"slowOriginThreshold"`
+	// Warns and counts in the slow_origin_warnings metric when more requests than it are waiting for the response
+	// headers of the origin. There are no such warnings if it's 0.
+	SlowOriginPendingRequests uint `yaml:"slowOriginPendingRequests" json:"slowOriginPendingRequests"`
+	// Translates gRPC-web requests into gRPC requests to the origin, sent over h2c to http:// origins and over HTTP/2
+	// to https:// origins, and their responses back into gRPC-web responses. Other requests are sent as usual.
+	GRPCWeb bool `yaml:"grpcWeb" json:"grpcWeb"`
+	// Sends every write of the responses of the origin to the eyeball right away, instead of buffering them, like the
+	// responses that are Server-Sent Events. Long-poll and streaming endpoints that don't send Server-Sent Events need
+	// it for the eyeball to get their data as soon as it's sent.
+	DisableResponseBuffering bool `yaml:"disableResponseBuffering" json:"disableResponseBuffering"`
+	// Longest time the responses of the origin are buffered for before what was written is sent to the eyeball, they
+	// are only sent when the buffer is full if it's 0
+	FlushInterval config.CustomDuration `yaml:"flushInterval" json:"flushInterval"`
+	// HTTP proxy deadline of streaming responses, which are Server-Sent Events or any response when
+	// disableResponseBuffering is set, from their headers to their end. It replaces requestTimeout once their headers
+	// are received, so that they aren't cut short by it. There is no deadline if it's 0.
+	StreamTimeout config.CustomDuration `yaml:"streamTimeout" json:"streamTimeout"`
+	// Local IP the connections to the origin are dialed from, for origins that only allow some IPs of hosts with
+	// several of them. The system picks it if it's empty.
+	SourceAddress string `yaml:"sourceAddress" json:"sourceAddress"`
+	// Answers the requests the eyeball sent over plain HTTP, according to their X-Forwarded-Proto header, with a
+	// permanent redirect to the same URL over HTTPS instead of proxying them to the origin
+	HTTPSRedirect bool `yaml:"httpsRedirect" json:"httpsRedirect"`
+	// max-age of the Strict-Transport-Security header added to the responses to the requests the eyeball sent over
+	// HTTPS, unless the origin set one. The header isn't added if it's 0.
+	HSTSMaxAge config.CustomDuration `yaml:"hstsMaxAge" json:"hstsMaxAge"`
+	// Adds the includeSubDomains directive to the Strict-Transport-Security header added when hstsMaxAge is set
+	HSTSIncludeSubdomains bool `yaml:"hstsIncludeSubdomains" json:"hstsIncludeSubdomains"`
+	// Status code of the responses to the requests of the rule while it's in maintenance mode, instead of dialing its
+	// origin. It's 503 if it's 0.
+	MaintenanceStatus uint `yaml:"maintenanceStatus" json:"maintenanceStatus"`
+	// File served as the body of the responses to the requests of the rule while it's in maintenance mode, with the
+	// content type of its extension. A short text is served if it's empty.
+	MaintenancePage string `yaml:"maintenancePage" json:"maintenancePage"`
+	// Stops logging the requests and connections of the rule, e.g. for health checks that would flood the logs
+	DisableAccessLog bool `yaml:"disableAccessLog" json:"disableAccessLog"`
+	// Fields recorded in the logs of the requests and connections of the rule, among host, path, query, headers and
+	// client, for applications whose URLs or headers must not be logged. All of them are recorded if it's empty or
+	// all, which lets a rule record all of them when the top-level originRequest doesn't.
+	AccessLogFields []string `yaml:"accessLogFields" json:"accessLogFields"`
+	// Number of idle connections to the origin kept established, and over TLS past their handshake, ahead of requests,
+	// so that the first requests after an idle period don't wait for the origin to be dialed. They are replaced when
+	// the origin closes them or when they are older than keepAliveTimeout.
+	WarmConnections uint `yaml:"warmConnections" json:"warmConnections"`
+	// How the revocation of the certificate of the origin is checked once it's verified: stapled requires the origin
+	// to staple an OCSP response, ocsp uses the stapled response or queries the OCSP responder of the certificate, and
+	// crl downloads the CRLs of the certificate. It isn't checked if it's empty.
+	RevocationCheck string `yaml:"revocationCheck" json:"revocationCheck"`
+	// Trusts the certificate of the origin, with a warning, when its revocation can't be checked, e.g. because the
+	// OCSP responder is unreachable. Revoked certificates are never trusted.
+	RevocationSoftFail bool `yaml:"revocationSoftFail" json:"revocationSoftFail"`
+	// Minimum TLS version of the connections to the origin, from 1.0 to 1.3, for legacy origins that only support TLS
+	// 1.0 or 1.1. It's 1.2 if it's empty.
+	TLSMinVersion string `yaml:"tlsMinVersion" json:"tlsMinVersion"`
+	// Maximum TLS version of the connections to the origin, from 1.0 to 1.3. It's 1.3 if it's empty.
+	TLSMaxVersion string `yaml:"tlsMaxVersion" json:"tlsMaxVersion"`
+	// Cipher suites of the connections to the origin up to TLS 1.2, by their IANA names, e.g.
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. The cipher suites of TLS 1.3 can't be configured. The secure cipher suites
+	// of crypto/tls are used if it's empty.
+	TLSCipherSuites []string `yaml:"tlsCipherSuites" json:"tlsCipherSuites"`
+	// Forwards the subject, SHA-256 fingerprint and validity of the client certificate the eyeball presented to the edge
+	// to the origin, in the X-Client-Cert-* headers. It requires mTLS and the "Add TLS client auth headers" managed
+	// transform on the zone: the edge only replaces the Cf-Cert-* headers of eyeballs with them, so without it an
+	// eyeball can send its own and the X-Client-Cert-* headers can't be trusted.
+	ForwardClientCert bool `yaml:"forwardClientCert" json:"forwardClientCert"`
+	// Path whose requests cloudflared answers with the state of its connections to the edge, without proxying them to
+	// the origin, e.g. /_tunnel/healthz. It lets external monitors tell the issues of the tunnel from those of the
+	// origin.
+	HealthPath string `yaml:"healthPath" json:"healthPath"`
 }
 
 func (defaults *OriginRequestConfig) setConnectTimeout(overrides config.OriginRequestConfig) {
@@ -421,6 +678,204 @@ func (defaults *OriginRequestConfig) setHttp2Origin(overrides config.OriginReque
 	}
 }
 
+func (defaults *OriginRequestConfig) setWebSocketPingInterval(overrides config.OriginRequestConfig) {
+	if val := overrides.WebSocketPingInterval; val != nil {
+		defaults.WebSocketPingInterval = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setWebSocketPongTimeout(overrides config.OriginRequestConfig) {
+	if val := overrides.WebSocketPongTimeout; val != nil {
+		defaults.WebSocketPongTimeout = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setWebSocketMaxMessageSize(overrides config.OriginRequestConfig) {
+	if val := overrides.WebSocketMaxMessageSize; val != nil {
+		defaults.WebSocketMaxMessageSize = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setDisableWebSocketCompression(overrides config.OriginRequestConfig) {
+	if val := overrides.DisableWebSocketCompression; val != nil {
+		defaults.DisableWebSocketCompression = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setMaxConcurrentStreams(overrides config.OriginRequestConfig) {
+	if val := overrides.MaxConcurrentStreams; val != nil {
+		defaults.MaxConcurrentStreams = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setHelloWorldTemplate(overrides config.OriginRequestConfig) {
+	if val := overrides.HelloWorldTemplate; val != nil {
+		defaults.HelloWorldTemplate = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setHelloWorldLatency(overrides config.OriginRequestConfig) {
+	if val := overrides.HelloWorldLatency; val != nil {
+		defaults.HelloWorldLatency = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setResponseHeaderTimeout(overrides config.OriginRequestConfig) {
+	if val := overrides.ResponseHeaderTimeout; val != nil {
+		defaults.ResponseHeaderTimeout = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setRequestTimeout(overrides config.OriginRequestConfig) {
+	if val := overrides.RequestTimeout; val != nil {
+		defaults.RequestTimeout = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setTCPIdleTimeout(overrides config.OriginRequestConfig) {
+	if val := overrides.TCPIdleTimeout; val != nil {
+		defaults.TCPIdleTimeout = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setTCPHalfClose(overrides config.OriginRequestConfig) {
+	if val := overrides.TCPHalfClose; val != nil {
+		defaults.TCPHalfClose = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setSlowOriginThreshold(overrides config.OriginRequestConfig) {
+	if val := overrides.SlowOriginThreshold; val != nil {
+		defaults.SlowOriginThreshold = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setSlowOriginPendingRequests(overrides config.OriginRequestConfig) {
+	if val := overrides.SlowOriginPendingRequests; val != nil {
+		defaults.SlowOriginPendingRequests = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setGRPCWeb(overrides config.OriginRequestConfig) {
+	if val := overrides.GRPCWeb; val != nil {
+		defaults.GRPCWeb = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setDisableResponseBuffering(overrides config.OriginRequestConfig) {
+	if val := overrides.DisableResponseBuffering; val != nil {
+		defaults.DisableResponseBuffering = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setFlushInterval(overrides config.OriginRequestConfig) {
+	if val := overrides.FlushInterval; val != nil {
+		defaults.FlushInterval = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setStreamTimeout(overrides config.OriginRequestConfig) {
+	if val := overrides.StreamTimeout; val != nil {
+		defaults.StreamTimeout = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setSourceAddress(overrides config.OriginRequestConfig) {
+	if val := overrides.SourceAddress; val != nil {
+		defaults.SourceAddress = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setHTTPSRedirect(overrides config.OriginRequestConfig) {
+	if val := overrides.HTTPSRedirect; val != nil {
+		defaults.HTTPSRedirect = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setHSTSMaxAge(overrides config.OriginRequestConfig) {
+	if val := overrides.HSTSMaxAge; val != nil {
+		defaults.HSTSMaxAge = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setHSTSIncludeSubdomains(overrides config.OriginRequestConfig) {
+	if val := overrides.HSTSIncludeSubdomains; val != nil {
+		defaults.HSTSIncludeSubdomains = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setMaintenanceStatus(overrides config.OriginRequestConfig) {
+	if val := overrides.MaintenanceStatus; val != nil {
+		defaults.MaintenanceStatus = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setMaintenancePage(overrides config.OriginRequestConfig) {
+	if val := overrides.MaintenancePage; val != nil {
+		defaults.MaintenancePage = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setDisableAccessLog(overrides config.OriginRequestConfig) {
+	if val := overrides.DisableAccessLog; val != nil {
+		defaults.DisableAccessLog = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setAccessLogFields(overrides config.OriginRequestConfig) {
+	if val := overrides.AccessLogFields; len(val) > 0 {
+		defaults.AccessLogFields = val
+	}
+}
+
+func (defaults *OriginRequestConfig) setWarmConnections(overrides config.OriginRequestConfig) {
+	if val := overrides.WarmConnections; val != nil {
+		defaults.WarmConnections = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setRevocationCheck(overrides config.OriginRequestConfig) {
+	if val := overrides.RevocationCheck; val != nil {
+		defaults.RevocationCheck = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setRevocationSoftFail(overrides config.OriginRequestConfig) {
+	if val := overrides.RevocationSoftFail; val != nil {
+		defaults.RevocationSoftFail = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setTLSMinVersion(overrides config.OriginRequestConfig) {
+	if val := overrides.TLSMinVersion; val != nil {
+		defaults.TLSMinVersion = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setTLSMaxVersion(overrides config.OriginRequestConfig) {
+	if val := overrides.TLSMaxVersion; val != nil {
+		defaults.TLSMaxVersion = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setTLSCipherSuites(overrides config.OriginRequestConfig) {
+	if val := overrides.TLSCipherSuites; len(val) > 0 {
+		defaults.TLSCipherSuites = val
+	}
+}
+
+func (defaults *OriginRequestConfig) setForwardClientCert(overrides config.OriginRequestConfig) {
+	if val := overrides.ForwardClientCert; val != nil {
+		defaults.ForwardClientCert = *val
+	}
+}
+
+func (defaults *OriginRequestConfig) setHealthPath(overrides config.OriginRequestConfig) {
+	if val := overrides.HealthPath; val != nil {
+		defaults.HealthPath = *val
+	}
+}
+
 // SetConfig gets config for the requests that cloudflared sends to origins.
 // Each field has a setter method which sets a value for the field by trying to find:
 //   1. The user config for this rule
@@ -447,6 +902,39 @@ func setConfig(defaults OriginRequestConfig, overrides config.OriginRequestConfi
 	cfg.setProxyType(overrides)
 	cfg.setIPRules(overrides)
 	cfg.setHttp2Origin(overrides)
+	cfg.setWebSocketPingInterval(overrides)
+	cfg.setWebSocketPongTimeout(overrides)
+	cfg.setWebSocketMaxMessageSize(overrides)
+	cfg.setDisableWebSocketCompression(overrides)
+	cfg.setMaxConcurrentStreams(overrides)
+	cfg.setHelloWorldTemplate(overrides)
+	cfg.setHelloWorldLatency(overrides)
+	cfg.setResponseHeaderTimeout(overrides)
+	cfg.setRequestTimeout(overrides)
+	cfg.setTCPIdleTimeout(overrides)
+	cfg.setTCPHalfClose(overrides)
+	cfg.setSlowOriginThreshold(overrides)
+	cfg.setSlowOriginPendingRequests(overrides)
+	cfg.setGRPCWeb(overrides)
+	cfg.setDisableResponseBuffering(overrides)
+	cfg.setFlushInterval(overrides)
+	cfg.setStreamTimeout(overrides)
+	cfg.setSourceAddress(overrides)
+	cfg.setHTTPSRedirect(overrides)
+	cfg.setHSTSMaxAge(overrides)
+	cfg.setHSTSIncludeSubdomains(overrides)
+	cfg.setMaintenanceStatus(overrides)
+	cfg.setMaintenancePage(overrides)
+	cfg.setDisableAccessLog(overrides)
+	cfg.setAccessLogFields(overrides)
+	cfg.setWarmConnections(overrides)
+	cfg.setRevocationCheck(overrides)
+	cfg.setRevocationSoftFail(overrides)
+	cfg.setTLSMinVersion(overrides)
+	cfg.setTLSMaxVersion(overrides)
+	cfg.setTLSCipherSuites(overrides)
+	cfg.setForwardClientCert(overrides)
+	cfg.setHealthPath(overrides)
 	return cfg
 }
 
@@ -457,6 +945,16 @@ func ConvertToRawOriginConfig(c OriginRequestConfig) config.OriginRequestConfig
 	var keepAliveConnections *int
 	var keepAliveTimeout *config.CustomDuration
 	var proxyAddress *string
+	var webSocketPingInterval *config.CustomDuration
+	var webSocketPongTimeout *config.CustomDuration
+	var helloWorldLatency *config.CustomDuration
+	var responseHeaderTimeout *config.CustomDuration
+	var requestTimeout *config.CustomDuration
+	var tcpIdleTimeout *config.CustomDuration
+	var slowOriginThreshold *config.CustomDuration
+	var flushInterval *config.CustomDuration
+	var streamTimeout *config.CustomDuration
+	var hstsMaxAge *config.CustomDuration
 
 	if c.ConnectTimeout != defaultHTTPConnectTimeout {
 		connectTimeout = &c.ConnectTimeout
@@ -476,25 +974,88 @@ func ConvertToRawOriginConfig(c OriginRequestConfig) config.OriginRequestConfig
 	if c.ProxyAddress != defaultProxyAddress {
 		proxyAddress = &c.ProxyAddress
 	}
+	if c.WebSocketPingInterval.Duration != 0 {
+		webSocketPingInterval = &c.WebSocketPingInterval
+	}
+	if c.WebSocketPongTimeout.Duration != 0 {
+		webSocketPongTimeout = &c.WebSocketPongTimeout
+	}
+	if c.HelloWorldLatency.Duration != 0 {
+		helloWorldLatency = &c.HelloWorldLatency
+	}
+	if c.ResponseHeaderTimeout.Duration != 0 {
+		responseHeaderTimeout = &c.ResponseHeaderTimeout
+	}
+	if c.RequestTimeout.Duration != 0 {
+		requestTimeout = &c.RequestTimeout
+	}
+	if c.TCPIdleTimeout.Duration != 0 {
+		tcpIdleTimeout = &c.TCPIdleTimeout
+	}
+	if c.SlowOriginThreshold.Duration != 0 {
+		slowOriginThreshold = &c.SlowOriginThreshold
+	}
+	if c.FlushInterval.Duration != 0 {
+		flushInterval = &c.FlushInterval
+	}
+	if c.StreamTimeout.Duration != 0 {
+		streamTimeout = &c.StreamTimeout
+	}
+	if c.HSTSMaxAge.Duration != 0 {
+		hstsMaxAge = &c.HSTSMaxAge
+	}
 
 	return config.OriginRequestConfig{
-		ConnectTimeout:         connectTimeout,
-		TLSTimeout:             tlsTimeout,
-		TCPKeepAlive:           tcpKeepAlive,
-		NoHappyEyeballs:        defaultBoolToNil(c.NoHappyEyeballs),
-		KeepAliveConnections:   keepAliveConnections,
-		KeepAliveTimeout:       keepAliveTimeout,
-		HTTPHostHeader:         emptyStringToNil(c.HTTPHostHeader),
-		OriginServerName:       emptyStringToNil(c.OriginServerName),
-		CAPool:                 emptyStringToNil(c.CAPool),
-		NoTLSVerify:            defaultBoolToNil(c.NoTLSVerify),
-		DisableChunkedEncoding: defaultBoolToNil(c.DisableChunkedEncoding),
-		BastionMode:            defaultBoolToNil(c.BastionMode),
-		ProxyAddress:           proxyAddress,
-		ProxyPort:              zeroUIntToNil(c.ProxyPort),
-		ProxyType:              emptyStringToNil(c.ProxyType),
-		IPRules:                convertToRawIPRules(c.IPRules),
-		Http2Origin:            defaultBoolToNil(c.Http2Origin),
+		ConnectTimeout:              connectTimeout,
+		TLSTimeout:                  tlsTimeout,
+		TCPKeepAlive:                tcpKeepAlive,
+		NoHappyEyeballs:             defaultBoolToNil(c.NoHappyEyeballs),
+		KeepAliveConnections:        keepAliveConnections,
+		KeepAliveTimeout:            keepAliveTimeout,
+		HTTPHostHeader:              emptyStringToNil(c.HTTPHostHeader),
+		OriginServerName:            emptyStringToNil(c.OriginServerName),
+		CAPool:                      emptyStringToNil(c.CAPool),
+		NoTLSVerify:                 defaultBoolToNil(c.NoTLSVerify),
+		DisableChunkedEncoding:      defaultBoolToNil(c.DisableChunkedEncoding),
+		BastionMode:                 defaultBoolToNil(c.BastionMode),
+		ProxyAddress:                proxyAddress,
+		ProxyPort:                   zeroUIntToNil(c.ProxyPort),
+		ProxyType:                   emptyStringToNil(c.ProxyType),
+		IPRules:                     convertToRawIPRules(c.IPRules),
+		Http2Origin:                 defaultBoolToNil(c.Http2Origin),
+		WebSocketPingInterval:       webSocketPingInterval,
+		WebSocketPongTimeout:        webSocketPongTimeout,
+		WebSocketMaxMessageSize:     zeroUIntToNil(c.WebSocketMaxMessageSize),
+		DisableWebSocketCompression: defaultBoolToNil(c.DisableWebSocketCompression),
+		MaxConcurrentStreams:        zeroUIntToNil(c.MaxConcurrentStreams),
+		HelloWorldTemplate:          emptyStringToNil(c.HelloWorldTemplate),
+		HelloWorldLatency:           helloWorldLatency,
+		ResponseHeaderTimeout:       responseHeaderTimeout,
+		RequestTimeout:              requestTimeout,
+		TCPIdleTimeout:              tcpIdleTimeout,
+		TCPHalfClose:                defaultBoolToNil(c.TCPHalfClose),
+		SlowOriginThreshold:         slowOriginThreshold,
+		SlowOriginPendingRequests:   zeroUIntToNil(c.SlowOriginPendingRequests),
+		GRPCWeb:                     defaultBoolToNil(c.GRPCWeb),
+		DisableResponseBuffering:    defaultBoolToNil(c.DisableResponseBuffering),
+		FlushInterval:               flushInterval,
+		StreamTimeout:               streamTimeout,
+		SourceAddress:               emptyStringToNil(c.SourceAddress),
+		HTTPSRedirect:               defaultBoolToNil(c.HTTPSRedirect),
+		HSTSMaxAge:                  hstsMaxAge,
+		HSTSIncludeSubdomains:       defaultBoolToNil(c.HSTSIncludeSubdomains),
+		MaintenanceStatus:           zeroUIntToNil(c.MaintenanceStatus),
+		MaintenancePage:             emptyStringToNil(c.MaintenancePage),
+		DisableAccessLog:            defaultBoolToNil(c.DisableAccessLog),
+		AccessLogFields:             c.AccessLogFields,
+		WarmConnections:             zeroUIntToNil(c.WarmConnections),
+		RevocationCheck:             emptyStringToNil(c.RevocationCheck),
+		RevocationSoftFail:          defaultBoolToNil(c.RevocationSoftFail),
+		TLSMinVersion:               emptyStringToNil(c.TLSMinVersion),
+		TLSMaxVersion:               emptyStringToNil(c.TLSMaxVersion),
+		TLSCipherSuites:             c.TLSCipherSuites,
+		ForwardClientCert:           defaultBoolToNil(c.ForwardClientCert),
+		HealthPath:                  emptyStringToNil(c.HealthPath),
 	}
 }
 
@@ -538,3 +1099,46 @@ func zeroUIntToNil(v uint) *uint {
 
 	return &v
 }
+
+// sourceAddr returns the local address the connections to the origin are dialed from, or nil for the system to pick
+// it
+func (c *OriginRequestConfig) sourceAddr() net.Addr {
+	ip := net.ParseIP(c.SourceAddress)
+	if ip == nil {
+		return nil
+	}
+	return &net.TCPAddr{IP: ip}
+}
+
+// Fields of the access logs that accessLogFields selects
+const (
+	AccessLogFieldHost    = "host"
+	AccessLogFieldPath    = "path"
+	AccessLogFieldQuery   = "query"
+	AccessLogFieldHeaders = "headers"
+	AccessLogFieldClient  = "client"
+	// AccessLogFieldAll selects all the fields
+	AccessLogFieldAll = "all"
+)
+
+var accessLogFields = []string{
+	AccessLogFieldHost,
+	AccessLogFieldPath,
+	AccessLogFieldQuery,
+	AccessLogFieldHeaders,
+	AccessLogFieldClient,
+	AccessLogFieldAll,
+}
+
+// AccessLogs returns whether field is recorded in the access logs of the rule
+func (c *OriginRequestConfig) AccessLogs(field string) bool {
+	if len(c.AccessLogFields) == 0 {
+		return true
+	}
+	for _, f := range c.AccessLogFields {
+		if f == field || f == AccessLogFieldAll {
+			return true
+		}
+	}
+	return false
+}
@@ -68,6 +68,52 @@ func TestUnmarshalRemoteConfigOverridesGlobal(t *testing.T) {
 	require.True(t, remoteConfig.Ingress.Defaults.NoHappyEyeballs)
 }
 
+func TestWarpRoutingConfigOverrides(t *testing.T) {
+	rawYAML := `
+enabled: true
+connectTimeout: 10s
+idleTimeout: 30m
+overrides:
+- network: 10.1.0.0/16
+  idleTimeout: 0s
+  tcpKeepAlive: 5s
+- network: fd00::/8
+  connectTimeout: 1m
+`
+	var raw config.WarpRoutingConfig
+	require.NoError(t, yaml.Unmarshal([]byte(rawYAML), &raw))
+	warpRouting, err := NewWarpRoutingConfig(&raw)
+	require.NoError(t, err)
+
+	require.Equal(t, 10*time.Second, warpRouting.ConnectTimeout.Duration)
+	require.Equal(t, 30*time.Minute, warpRouting.IdleTimeout.Duration)
+	require.Equal(t, defaultTCPKeepAlive, warpRouting.TCPKeepAlive)
+	require.Len(t, warpRouting.Overrides, 2)
+
+	override := warpRouting.Overrides[0]
+	require.Equal(t, "10.1.0.0/16", override.Network.String())
+	require.Equal(t, 10*time.Second, override.ConnectTimeout.Duration)
+	require.Equal(t, time.Duration(0), override.IdleTimeout.Duration)
+	require.Equal(t, 5*time.Second, override.TCPKeepAlive.Duration)
+
+	override = warpRouting.Overrides[1]
+	require.Equal(t, "fd00::/8", override.Network.String())
+	require.Equal(t, time.Minute, override.ConnectTimeout.Duration)
+	require.Equal(t, 30*time.Minute, override.IdleTimeout.Duration)
+	require.Equal(t, defaultTCPKeepAlive, override.TCPKeepAlive)
+
+	// The raw config, as sent with remote configurations, gives the same config
+	rawConfig := warpRouting.RawConfig()
+	fromRaw, err := NewWarpRoutingConfig(&rawConfig)
+	require.NoError(t, err)
+	require.Equal(t, warpRouting, fromRaw)
+
+	_, err = NewWarpRoutingConfig(&config.WarpRoutingConfig{
+		Overrides: []config.WarpRoutingOverride{{Network: "10.1.0.0"}},
+	})
+	require.Error(t, err)
+}
+
 func TestOriginRequestConfigOverrides(t *testing.T) {
 	validate := func(ing Ingress) {
 		// Rule 0 didn't override anything, so it inherits the user-specified
@@ -93,6 +139,8 @@ func TestOriginRequestConfigOverrides(t *testing.T) {
 				newIPRule(t, "10.0.0.0/8", []int{80, 8080}, false),
 				newIPRule(t, "fc00::/7", []int{443, 4443}, true),
 			},
+			WebSocketPingInterval:   config.CustomDuration{Duration: 30 * time.Second},
+			WebSocketMaxMessageSize: 1024,
 		}
 		require.Equal(t, expected0, actual0)
 
@@ -118,6 +166,39 @@ func TestOriginRequestConfigOverrides(t *testing.T) {
 				newIPRule(t, "10.0.0.0/16", []int{3000, 3030}, false),
 				newIPRule(t, "192.16.0.0/24", []int{5000, 5050}, true),
 			},
+			WebSocketPingInterval:       config.CustomDuration{Duration: 10 * time.Second},
+			WebSocketPongTimeout:        config.CustomDuration{Duration: 5 * time.Second},
+			WebSocketMaxMessageSize:     2048,
+			DisableWebSocketCompression: true,
+			MaxConcurrentStreams:        50,
+			HelloWorldTemplate:          "/tmp/hello.json",
+			HelloWorldLatency:           config.CustomDuration{Duration: 2 * time.Second},
+			ResponseHeaderTimeout:       config.CustomDuration{Duration: 20 * time.Second},
+			RequestTimeout:              config.CustomDuration{Duration: time.Minute},
+			TCPIdleTimeout:              config.CustomDuration{Duration: 5 * time.Minute},
+			TCPHalfClose:                true,
+			SlowOriginThreshold:         config.CustomDuration{Duration: 3 * time.Second},
+			SlowOriginPendingRequests:   100,
+			GRPCWeb:                     true,
+			DisableResponseBuffering:    true,
+			FlushInterval:               config.CustomDuration{Duration: time.Second},
+			StreamTimeout:               config.CustomDuration{Duration: time.Hour},
+			SourceAddress:               "192.0.2.1",
+			HTTPSRedirect:               true,
+			HSTSMaxAge:                  config.CustomDuration{Duration: 365 * 24 * time.Hour},
+			HSTSIncludeSubdomains:       true,
+			MaintenanceStatus:           503,
+			MaintenancePage:             "/var/www/maintenance.html",
+			DisableAccessLog:            true,
+			AccessLogFields:             []string{"host", "path"},
+			WarmConnections:             4,
+			RevocationCheck:             "ocsp",
+			RevocationSoftFail:          true,
+			TLSMinVersion:               "1.0",
+			TLSMaxVersion:               "1.2",
+			TLSCipherSuites:             []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			ForwardClientCert:           true,
+			HealthPath:                  "/_tunnel/healthz",
 		}
 		require.Equal(t, expected1, actual1)
 	}
@@ -150,6 +231,8 @@ originRequest:
     - 443
     - 4443
     allow: true
+  webSocketPingInterval: 30s
+  webSocketMaxMessageSize: 1024
 ingress:
 - hostname: tun.example.com
   service: https://localhost:8000
@@ -182,6 +265,39 @@ ingress:
       - 5000
       - 5050
       allow: true
+    webSocketPingInterval: 10s
+    webSocketPongTimeout: 5s
+    webSocketMaxMessageSize: 2048
+    disableWebSocketCompression: true
+    maxConcurrentStreams: 50
+    helloWorldTemplate: /tmp/hello.json
+    helloWorldLatency: 2s
+    responseHeaderTimeout: 20s
+    requestTimeout: 1m
+    tcpIdleTimeout: 5m
+    tcpHalfClose: true
+    slowOriginThreshold: 3s
+    slowOriginPendingRequests: 100
+    grpcWeb: true
+    disableResponseBuffering: true
+    flushInterval: 1s
+    streamTimeout: 1h
+    sourceAddress: 192.0.2.1
+    httpsRedirect: true
+    hstsMaxAge: 8760h
+    hstsIncludeSubdomains: true
+    maintenanceStatus: 503
+    maintenancePage: /var/www/maintenance.html
+    disableAccessLog: true
+    accessLogFields: [host, path]
+    warmConnections: 4
+    revocationCheck: ocsp
+    revocationSoftFail: true
+    tlsMinVersion: "1.0"
+    tlsMaxVersion: "1.2"
+    tlsCipherSuites: [TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256]
+    forwardClientCert: true
+    healthPath: /_tunnel/healthz
 `
 
 	ing, err := ParseIngress(MustReadIngress(rulesYAML))
@@ -217,7 +333,9 @@ ingress:
 				"ports": [443, 4443],
 				"allow": true
 			}
-		]
+		],
+		"webSocketPingInterval": 30,
+		"webSocketMaxMessageSize": 1024
     },
     "ingress": [
         {
@@ -254,7 +372,40 @@ ingress:
 						"ports": [5000, 5050],
 						"allow": true
 					}
-				]
+				],
+				"webSocketPingInterval": 10,
+				"webSocketPongTimeout": 5,
+				"webSocketMaxMessageSize": 2048,
+				"disableWebSocketCompression": true,
+				"maxConcurrentStreams": 50,
+				"helloWorldTemplate": "/tmp/hello.json",
+				"helloWorldLatency": 2,
+				"responseHeaderTimeout": 20,
+				"requestTimeout": 60,
+				"tcpIdleTimeout": 300,
+				"tcpHalfClose": true,
+				"slowOriginThreshold": 3,
+				"slowOriginPendingRequests": 100,
+				"grpcWeb": true,
+				"disableResponseBuffering": true,
+				"flushInterval": 1,
+				"streamTimeout": 3600,
+				"sourceAddress": "192.0.2.1",
+				"httpsRedirect": true,
+				"hstsMaxAge": 31536000,
+				"hstsIncludeSubdomains": true,
+				"maintenanceStatus": 503,
+				"maintenancePage": "/var/www/maintenance.html",
+				"disableAccessLog": true,
+				"accessLogFields": ["host", "path"],
+				"warmConnections": 4,
+				"revocationCheck": "ocsp",
+				"revocationSoftFail": true,
+				"tlsMinVersion": "1.0",
+				"tlsMaxVersion": "1.2",
+				"tlsCipherSuites": ["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"],
+				"forwardClientCert": true,
+				"healthPath": "/_tunnel/healthz"
     		}
         }
     ],
@@ -415,6 +566,26 @@ func TestDefaultConfigFromCLI(t *testing.T) {
 	require.Equal(t, expected, actual)
 }
 
+func TestAccessLogFieldsOverride(t *testing.T) {
+	ing, err := ParseIngress(&config.Configuration{
+		OriginRequest: config.OriginRequestConfig{AccessLogFields: []string{AccessLogFieldHost}},
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Hostname:      "debug.example.com",
+				Service:       "http://localhost:8080",
+				OriginRequest: config.OriginRequestConfig{AccessLogFields: []string{AccessLogFieldAll}},
+			},
+			{
+				Service: "http://localhost:8081",
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, ing.Rules[0].Config.AccessLogs(AccessLogFieldClient))
+	require.True(t, ing.Rules[1].Config.AccessLogs(AccessLogFieldHost))
+	require.False(t, ing.Rules[1].Config.AccessLogs(AccessLogFieldClient))
+}
+
 func newIPRule(t *testing.T, prefix string, ports []int, allow bool) ipaccess.Rule {
 	rule, err := ipaccess.NewRuleByCIDR(&prefix, ports, allow)
 	require.NoError(t, err)
@@ -0,0 +1,344 @@
+package ingress
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	grpcContentType        = "application/grpc"
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+	// grpcWebTrailerFlag marks the frame of the trailers at the end of a gRPC-web response
+	grpcWebTrailerFlag = 0x80
+	// grpcWebReadBufferSize is how much of the body of a gRPC response is translated at once
+	grpcWebReadBufferSize = 32 * 1024
+)
+
+// grpcWebTransport translates gRPC-web requests into gRPC requests sent to the origin over HTTP/2, and their gRPC
+// responses back into gRPC-web responses, so that browsers can call gRPC origins. Other requests are sent with
+// transport.
+type grpcWebTransport struct {
+	transport http.RoundTripper
+	grpc      *http2.Transport
+	dialer    *net.Dialer
+	// proxy returns the proxy of the connections to the origin, like the Proxy of http.Transport
+	proxy func(*http.Request) (*url.URL, error)
+	// shutdown is set once the origin shuts down, its connections are closed once idle then
+	shutdown int32
+}
+
+// newGRPCWebTransport returns the gRPC-web transport of an origin, which is sent gRPC requests over h2c if plaintext,
+// or over HTTP/2 over TLS otherwise. Its idle connections are closed once shutdownC is closed.
+func newGRPCWebTransport(
+	transport http.RoundTripper,
+	plaintext bool,
+	cfg OriginRequestConfig,
+	log *zerolog.Logger,
+	shutdownC <-chan struct{},
+) (*grpcWebTransport, error) {
+	tlsConfig, err := originTLSConfig(cfg, log)
+	if err != nil {
+		return nil, err
+	}
+	if !hasMatchVars(cfg.OriginServerName) {
+		tlsConfig.ServerName = cfg.OriginServerName
+	}
+	t := &grpcWebTransport{
+		transport: transport,
+		dialer: &net.Dialer{
+			Timeout:   cfg.ConnectTimeout.Duration,
+			KeepAlive: cfg.TCPKeepAlive.Duration,
+			LocalAddr: cfg.sourceAddr(),
+		},
+		proxy: http.ProxyFromEnvironment,
+	}
+	scheme := "https"
+	if plaintext {
+		scheme = "http"
+	}
+	t.grpc = &http2.Transport{
+		AllowHTTP:       plaintext,
+		TLSClientConfig: tlsConfig,
+		DialTLS: func(network, addr string, tlsConfig *tls.Config) (net.Conn, error) {
+			conn, err := t.dial(scheme, addr)
+			if err != nil || plaintext {
+				return conn, err
+			}
+			tlsConn := tls.Client(conn, tlsConfig)
+			if timeout := cfg.TLSTimeout.Duration; timeout > 0 {
+				_ = tlsConn.SetDeadline(time.Now().Add(timeout))
+			}
+			if err := tlsConn.Handshake(); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+			_ = tlsConn.SetDeadline(time.Time{})
+			return tlsConn, nil
+		},
+	}
+	go func() {
+		<-shutdownC
+		atomic.StoreInt32(&t.shutdown, 1)
+		t.grpc.CloseIdleConnections()
+	}()
+	return t, nil
+}
+
+// dial connects to the origin at addr, through the proxy of the origin if there's one
+func (t *grpcWebTransport) dial(scheme, addr string) (net.Conn, error) {
+	proxyURL, err := t.proxy(&http.Request{URL: &url.URL{Scheme: scheme, Host: addr}})
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return t.dialer.Dial("tcp", addr)
+	}
+	switch proxyURL.Scheme {
+	case "socks5":
+		dialer, err := proxy.FromURL(proxyURL, t.dialer)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.Dial("tcp", addr)
+	case "http", "https":
+		return t.dialConnect(proxyURL, addr)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %s", proxyURL.Scheme)
+	}
+}
+
+// dialConnect connects to addr through the HTTP proxy at proxyURL, with a CONNECT request
+func (t *grpcWebTransport) dialConnect(proxyURL *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	conn, err := t.dialer.Dial("tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if timeout := t.dialer.Timeout; timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+	}
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrapf(err, "failed to connect to the proxy %s", proxyURL.Host)
+		}
+		conn = tlsConn
+	}
+	connect := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		connect.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := connect.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, connect)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("the proxy %s refused to connect to %s: %s", proxyURL.Host, addr, resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	// The origin may have sent data already, e.g. the settings of HTTP/2
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// bufferedConn is a connection whose data is read through reader, which may have buffered some already
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// closeIdleIfShutdown closes the connections to the origin that are idle if it shut down, e.g. once the requests
+// still running when the configuration was replaced are done
+func (t *grpcWebTransport) closeIdleIfShutdown() {
+	if atomic.LoadInt32(&t.shutdown) == 1 {
+		t.grpc.CloseIdleConnections()
+	}
+}
+
+func (t *grpcWebTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	contentType := req.Header.Get("Content-Type")
+	text := strings.HasPrefix(contentType, grpcWebTextContentType)
+	if !text && !strings.HasPrefix(contentType, grpcWebContentType) {
+		return t.transport.RoundTrip(req)
+	}
+
+	grpcReq := req.Clone(req.Context())
+	if text {
+		grpcReq.Header.Set("Content-Type", grpcContentType+strings.TrimPrefix(contentType, grpcWebTextContentType))
+		grpcReq.Body = &grpcWebTextRequestBody{src: bufio.NewReader(req.Body), Closer: req.Body}
+		grpcReq.ContentLength = -1
+	} else {
+		grpcReq.Header.Set("Content-Type", grpcContentType+strings.TrimPrefix(contentType, grpcWebContentType))
+	}
+	for _, header := range []string{"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade", "Content-Length"} {
+		grpcReq.Header.Del(header)
+	}
+	grpcReq.Header.Set("Te", "trailers")
+	grpcReq.TransferEncoding = nil
+
+	resp, err := t.grpc.RoundTrip(grpcReq)
+	if err != nil {
+		t.closeIdleIfShutdown()
+		return nil, err
+	}
+	webContentType := grpcWebContentType
+	if text {
+		webContentType = grpcWebTextContentType
+	}
+	if respContentType := resp.Header.Get("Content-Type"); strings.HasPrefix(respContentType, grpcContentType) {
+		resp.Header.Set("Content-Type", webContentType+strings.TrimPrefix(respContentType, grpcContentType))
+	}
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Body = &grpcWebResponseBody{
+		transport: t,
+		resp:      resp,
+		body:      resp.Body,
+		text:      text,
+		buf:       make([]byte, grpcWebReadBufferSize),
+	}
+	return resp, nil
+}
+
+// grpcWebTextRequestBody decodes the body of a grpc-web-text request, which is base64 in chunks that may each be
+// padded
+type grpcWebTextRequestBody struct {
+	src *bufio.Reader
+	io.Closer
+	quantum [4]byte
+	buf     [3]byte
+	decoded []byte
+}
+
+func (b *grpcWebTextRequestBody) Read(p []byte) (int, error) {
+	for len(b.decoded) == 0 {
+		if _, err := io.ReadFull(b.src, b.quantum[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return 0, errors.New("the base64 of the gRPC-web request is truncated")
+			}
+			return 0, err
+		}
+		n, err := base64.StdEncoding.Decode(b.buf[:], b.quantum[:])
+		if err != nil {
+			return 0, errors.Wrap(err, "invalid base64 in the gRPC-web request")
+		}
+		b.decoded = b.buf[:n]
+	}
+	n := copy(p, b.decoded)
+	b.decoded = b.decoded[n:]
+	return n, nil
+}
+
+// grpcWebResponseBody is the body of a gRPC response followed by the frame of its trailers, in base64 if text
+type grpcWebResponseBody struct {
+	transport *grpcWebTransport
+	resp      *http.Response
+	body      io.ReadCloser
+	text      bool
+	buf       []byte
+	pending   []byte
+	done      bool
+}
+
+func (b *grpcWebResponseBody) Read(p []byte) (int, error) {
+	for len(b.pending) == 0 {
+		if b.done {
+			return 0, io.EOF
+		}
+		n, err := b.body.Read(b.buf)
+		b.pending = b.encode(b.buf[:n])
+		if err == io.EOF {
+			// The trailers are known once the body is read
+			b.pending = append(b.pending, b.encode(grpcWebTrailerFrame(b.resp.Trailer))...)
+			b.resp.Trailer = nil
+			b.done = true
+		} else if err != nil && len(b.pending) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+func (b *grpcWebResponseBody) encode(data []byte) []byte {
+	if !b.text || len(data) == 0 {
+		return data
+	}
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(encoded, data)
+	return encoded
+}
+
+func (b *grpcWebResponseBody) Close() error {
+	err := b.body.Close()
+	b.transport.closeIdleIfShutdown()
+	return err
+}
+
+// grpcWebTrailerFrame returns the frame of trailer at the end of a gRPC-web response, nil if there are no trailers
+// like in trailers-only responses, whose trailers are headers.
+func grpcWebTrailerFrame(trailer http.Header) []byte {
+	if len(trailer) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(trailer))
+	for key := range trailer {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var block bytes.Buffer
+	for _, key := range keys {
+		for _, value := range trailer[key] {
+			fmt.Fprintf(&block, "%s: %s\r\n", strings.ToLower(key), value)
+		}
+	}
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+	return append(frame, block.Bytes()...)
+}
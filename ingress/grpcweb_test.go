@@ -0,0 +1,208 @@
+package ingress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+// grpcFrame returns a gRPC message frame of message
+func grpcFrame(message string) []byte {
+	return append([]byte{0, 0, 0, 0, byte(len(message))}, message...)
+}
+
+// startGRPCEchoOrigin starts an h2c origin answering gRPC requests with the message they were sent
+func startGRPCEchoOrigin(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/grpc+proto", r.Header.Get("Content-Type"))
+		assert.Equal(t, "trailers", r.Header.Get("Te"))
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		_, _ = w.Write(body)
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Grpc-Message", "OK")
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go (&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+		}
+	}()
+	return listener
+}
+
+func TestGRPCWebTransport(t *testing.T) {
+	listener := startGRPCEchoOrigin(t)
+	defer listener.Close()
+
+	originURL, err := url.Parse("http://" + listener.Addr().String())
+	require.NoError(t, err)
+	service := &httpService{url: originURL}
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	require.NoError(t, service.start(testLogger, shutdownC, OriginRequestConfig{GRPCWeb: true}))
+
+	trailers := []byte("grpc-message: OK\r\ngrpc-status: 0\r\n")
+	expected := append(grpcFrame("hello"), grpcWebTrailerFlag, 0, 0, 0, byte(len(trailers)))
+	expected = append(expected, trailers...)
+
+	tests := []struct {
+		contentType         string
+		body                []byte
+		expectedContentType string
+		expectedBody        []byte
+	}{
+		{
+			contentType:         "application/grpc-web+proto",
+			body:                grpcFrame("hello"),
+			expectedContentType: "application/grpc-web+proto",
+			expectedBody:        expected,
+		},
+		{
+			// Clients may send base64 in padded chunks
+			contentType:         "application/grpc-web-text+proto",
+			body:                []byte(base64.StdEncoding.EncodeToString(grpcFrame("hello")[:5]) + base64.StdEncoding.EncodeToString([]byte("hello"))),
+			expectedContentType: "application/grpc-web-text+proto",
+			expectedBody:        expected,
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodPost, "http://grpc.example.com/echo.Echo/Echo", bytes.NewReader(test.body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", test.contentType)
+		req.Header.Set("Connection", "keep-alive")
+
+		resp, err := service.RoundTrip(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, test.expectedContentType, resp.Header.Get("Content-Type"))
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		if test.contentType == "application/grpc-web-text+proto" {
+			// Each chunk of the response is padded
+			var decoded []byte
+			for len(body) > 0 {
+				chunk := make([]byte, 3)
+				n, err := base64.StdEncoding.Decode(chunk, body[:4])
+				require.NoError(t, err)
+				decoded = append(decoded, chunk[:n]...)
+				body = body[4:]
+			}
+			body = decoded
+		}
+		assert.Equal(t, test.expectedBody, body, test.contentType)
+	}
+}
+
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestGRPCWebTransportOtherRequests(t *testing.T) {
+	transport := &recordingTransport{}
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	grpcWeb, err := newGRPCWebTransport(transport, true, OriginRequestConfig{}, testLogger, shutdownC)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	_, err = grpcWeb.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, []*http.Request{req}, transport.requests)
+}
+
+func TestGRPCWebTransportProxy(t *testing.T) {
+	origin := startGRPCEchoOrigin(t)
+	defer origin.Close()
+
+	// HTTP proxy tunneling CONNECT requests, which signals closedC once the client closes a tunnel
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer proxyListener.Close()
+	connectC := make(chan *http.Request, 1)
+	closedC := make(chan struct{}, 1)
+	go func() {
+		for {
+			conn, err := proxyListener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				connectC <- req
+				originConn, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					return
+				}
+				defer originConn.Close()
+				_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go func() {
+					_, _ = io.Copy(conn, originConn)
+				}()
+				_, _ = io.Copy(originConn, conn)
+				closedC <- struct{}{}
+			}()
+		}
+	}()
+
+	shutdownC := make(chan struct{})
+	grpcWeb, err := newGRPCWebTransport(nil, true, OriginRequestConfig{}, testLogger, shutdownC)
+	require.NoError(t, err)
+	grpcWeb.proxy = http.ProxyURL(&url.URL{Scheme: "http", User: url.UserPassword("user", "secret"), Host: proxyListener.Addr().String()})
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+origin.Addr().String()+"/echo.Echo/Echo", bytes.NewReader(grpcFrame("hello")))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	resp, err := grpcWeb.RoundTrip(req)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	connect := <-connectC
+	assert.Equal(t, http.MethodConnect, connect.Method)
+	assert.Equal(t, origin.Addr().String(), connect.Host)
+	assert.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("user:secret")), connect.Header.Get("Proxy-Authorization"))
+
+	// The idle connection is closed once the origin shuts down
+	close(shutdownC)
+	select {
+	case <-closedC:
+	case <-time.After(time.Second):
+		t.Fatal("the idle connection to the origin wasn't closed on shutdown")
+	}
+}
+
+func TestGRPCWebTrailerFrame(t *testing.T) {
+	assert.Nil(t, grpcWebTrailerFrame(nil))
+	trailer := http.Header{"Grpc-Status": []string{"5"}}
+	assert.Equal(t, append([]byte{grpcWebTrailerFlag, 0, 0, 0, 16}, "grpc-status: 5\r\n"...), grpcWebTrailerFrame(trailer))
+}
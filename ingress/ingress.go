@@ -14,6 +14,7 @@ import (
 
 	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/ipaccess"
+	"github.com/cloudflare/cloudflared/tlsconfig"
 )
 
 var (
@@ -39,9 +40,15 @@ func (ing Ingress) FindMatchingRule(hostname, path string) (*Rule, int) {
 	if err == nil {
 		hostname = host
 	}
-	for i, rule := range ing.Rules {
-		if rule.Matches(hostname, path) {
-			return &rule, i
+	if ing.matcher != nil {
+		if i := ing.matcher.match(hostname, path); i >= 0 {
+			return &ing.Rules[i], i
+		}
+	} else {
+		for i, rule := range ing.Rules {
+			if rule.Matches(hostname, path) {
+				return &rule, i
+			}
 		}
 	}
 
@@ -66,6 +73,8 @@ func matchHost(ruleHost, reqHost string) bool {
 type Ingress struct {
 	Rules    []Rule              `json:"ingress"`
 	Defaults OriginRequestConfig `json:"originRequest"`
+	// matcher indexes Rules when they are validated, FindMatchingRule evaluates the rules one by one without it
+	matcher *ruleMatcher
 }
 
 // NewSingleOrigin constructs an Ingress set with only one rule, constructed from
@@ -98,15 +107,28 @@ type WarpRoutingService struct {
 }
 
 func NewWarpRoutingService(config WarpRoutingConfig) *WarpRoutingService {
-	svc := &rawTCPService{
+	svc := &warpRoutingTCPService{
+		defaultService: newWarpRoutingTCPService(config.ConnectTimeout, config.TCPKeepAlive, config.IdleTimeout),
+	}
+	for _, override := range config.Overrides {
+		svc.overrides = append(svc.overrides, warpRoutingOverrideService{
+			network: override.Network,
+			service: newWarpRoutingTCPService(override.ConnectTimeout, override.TCPKeepAlive, override.IdleTimeout),
+		})
+	}
+
+	return &WarpRoutingService{Proxy: svc}
+}
+
+func newWarpRoutingTCPService(connectTimeout, tcpKeepAlive, idleTimeout config.CustomDuration) *rawTCPService {
+	return &rawTCPService{
 		name: ServiceWarpRouting,
 		dialer: net.Dialer{
-			Timeout:   config.ConnectTimeout.Duration,
-			KeepAlive: config.TCPKeepAlive.Duration,
+			Timeout:   connectTimeout.Duration,
+			KeepAlive: tcpKeepAlive.Duration,
 		},
+		idleTimeout: idleTimeout.Duration,
 	}
-
-	return &WarpRoutingService{Proxy: svc}
 }
 
 // Get a single origin service from the CLI/config.
@@ -172,80 +194,54 @@ func validateIngress(ingress []config.UnvalidatedIngressRule, defaults OriginReq
 	rules := make([]Rule, len(ingress))
 	for i, r := range ingress {
 		cfg := setConfig(defaults, r.OriginRequest)
-		var service OriginService
-
-		if prefix := "unix:"; strings.HasPrefix(r.Service, prefix) {
-			// No validation necessary for unix socket filepath services
-			path := strings.TrimPrefix(r.Service, prefix)
-			service = &unixSocketPath{path: path, scheme: "http"}
-		} else if prefix := "unix+tls:"; strings.HasPrefix(r.Service, prefix) {
-			path := strings.TrimPrefix(r.Service, prefix)
-			service = &unixSocketPath{path: path, scheme: "https"}
-		} else if prefix := "http_status:"; strings.HasPrefix(r.Service, prefix) {
-			status, err := strconv.Atoi(strings.TrimPrefix(r.Service, prefix))
-			if err != nil {
-				return Ingress{}, errors.Wrap(err, "invalid HTTP status")
-			}
-			srv := newStatusCode(status)
-			service = &srv
-		} else if r.Service == HelloWorldService || r.Service == "hello-world" || r.Service == "helloworld" {
-			service = new(helloWorld)
-		} else if r.Service == ServiceSocksProxy {
-			rules := make([]ipaccess.Rule, len(r.OriginRequest.IPRules))
-
-			for i, ipRule := range r.OriginRequest.IPRules {
-				rule, err := ipaccess.NewRuleByCIDR(ipRule.Prefix, ipRule.Ports, ipRule.Allow)
-				if err != nil {
-					return Ingress{}, fmt.Errorf("unable to create ip rule for %s: %s", r.Service, err)
-				}
-				rules[i] = rule
-			}
+		service, err := parseService(r, &cfg)
+		if err != nil {
+			return Ingress{}, err
+		}
 
-			accessPolicy, err := ipaccess.NewPolicy(false, rules)
-			if err != nil {
-				return Ingress{}, fmt.Errorf("unable to create ip access policy for %s: %s", r.Service, err)
-			}
+		if err := validateHostname(r, i, len(ingress)); err != nil {
+			return Ingress{}, err
+		}
 
-			service = newSocksProxyOverWSService(accessPolicy)
-		} else if r.Service == ServiceBastion || cfg.BastionMode {
-			// Bastion mode will always start a Websocket proxy server, which will
-			// overwrite the localService.URL field when `start` is called. So,
-			// leave the URL field empty for now.
-			cfg.BastionMode = true
-			service = newBastionService()
-		} else {
-			// Validate URL services
-			u, err := url.Parse(r.Service)
-			if err != nil {
-				return Ingress{}, err
-			}
+		if err := validateSourceAddress(cfg, i); err != nil {
+			return Ingress{}, err
+		}
 
-			if u.Scheme == "" || u.Hostname() == "" {
-				return Ingress{}, fmt.Errorf("%s is an invalid address, please make sure it has a scheme and a hostname", r.Service)
-			}
+		if err := validateMaintenanceStatus(cfg, i); err != nil {
+			return Ingress{}, err
+		}
 
-			if u.Path != "" {
-				return Ingress{}, fmt.Errorf("%s is an invalid address, ingress rules don't support proxying to a different path on the origin service. The path will be the same as the eyeball request's path", r.Service)
-			}
-			if isHTTPService(u) {
-				service = &httpService{url: u}
-			} else {
-				service = newTCPOverWSService(u)
-			}
+		if err := validateAccessLogFields(cfg, i); err != nil {
+			return Ingress{}, err
 		}
 
-		if err := validateHostname(r, i, len(ingress)); err != nil {
+		if err := validateRevocationCheck(cfg, i); err != nil {
 			return Ingress{}, err
 		}
 
-		var pathRegexp *Regexp
-		if r.Path != "" {
-			var err error
-			regex, err := regexp.Compile(r.Path)
-			if err != nil {
-				return Ingress{}, errors.Wrapf(err, "Rule #%d has an invalid regex", i+1)
-			}
-			pathRegexp = &Regexp{Regexp: regex}
+		if err := validateTLSVersion(cfg.TLSMinVersion, "tlsMinVersion", i); err != nil {
+			return Ingress{}, err
+		}
+
+		if err := validateTLSVersion(cfg.TLSMaxVersion, "tlsMaxVersion", i); err != nil {
+			return Ingress{}, err
+		}
+
+		if err := validateTLSVersionRange(cfg, i); err != nil {
+			return Ingress{}, err
+		}
+
+		if err := validateTLSCipherSuites(cfg, i); err != nil {
+			return Ingress{}, err
+		}
+
+		if err := validateHealthPath(cfg, i); err != nil {
+			return Ingress{}, err
+		}
+
+		pathRegexp, err := parsePath(r, i)
+		if err != nil {
+			return Ingress{}, err
 		}
 
 		rules[i] = Rule{
@@ -255,7 +251,88 @@ func validateIngress(ingress []config.UnvalidatedIngressRule, defaults OriginReq
 			Config:   cfg,
 		}
 	}
-	return Ingress{Rules: rules, Defaults: defaults}, nil
+	return Ingress{Rules: rules, Defaults: defaults, matcher: newRuleMatcher(rules)}, nil
+}
+
+// parseService returns the origin service of the rule r, cfg being its settings
+func parseService(r config.UnvalidatedIngressRule, cfg *OriginRequestConfig) (OriginService, error) {
+	if prefix := "unix:"; strings.HasPrefix(r.Service, prefix) {
+		// No validation necessary for unix socket filepath services
+		path := strings.TrimPrefix(r.Service, prefix)
+		return &unixSocketPath{path: path, scheme: "http"}, nil
+	} else if prefix := "unix+tls:"; strings.HasPrefix(r.Service, prefix) {
+		path := strings.TrimPrefix(r.Service, prefix)
+		return &unixSocketPath{path: path, scheme: "https"}, nil
+	} else if isDiscoveredService(r.Service) {
+		srv, err := parseDiscoveredService(r.Service)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid service %s", r.Service)
+		}
+		return srv, nil
+	} else if prefix := "http_status:"; strings.HasPrefix(r.Service, prefix) {
+		status, err := strconv.Atoi(strings.TrimPrefix(r.Service, prefix))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid HTTP status")
+		}
+		srv := newStatusCode(status)
+		return &srv, nil
+	} else if r.Service == HelloWorldService || r.Service == "hello-world" || r.Service == "helloworld" {
+		return new(helloWorld), nil
+	} else if r.Service == TLSDebugService {
+		return new(tlsDebug), nil
+	} else if r.Service == ServiceSocksProxy {
+		rules := make([]ipaccess.Rule, len(r.OriginRequest.IPRules))
+
+		for i, ipRule := range r.OriginRequest.IPRules {
+			rule, err := ipaccess.NewRuleByCIDR(ipRule.Prefix, ipRule.Ports, ipRule.Allow)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create ip rule for %s: %s", r.Service, err)
+			}
+			rules[i] = rule
+		}
+
+		accessPolicy, err := ipaccess.NewPolicy(false, rules)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create ip access policy for %s: %s", r.Service, err)
+		}
+
+		return newSocksProxyOverWSService(accessPolicy), nil
+	} else if r.Service == ServiceBastion || cfg.BastionMode {
+		// Bastion mode will always start a Websocket proxy server, which will
+		// overwrite the localService.URL field when `start` is called. So,
+		// leave the URL field empty for now.
+		cfg.BastionMode = true
+		return newBastionService(), nil
+	}
+
+	// Validate URL services
+	u, err := url.Parse(r.Service)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Hostname() == "" {
+		return nil, fmt.Errorf("%s is an invalid address, please make sure it has a scheme and a hostname", r.Service)
+	}
+
+	if u.Path != "" {
+		return nil, fmt.Errorf("%s is an invalid address, ingress rules don't support proxying to a different path on the origin service. The path will be the same as the eyeball request's path", r.Service)
+	}
+	if isHTTPService(u) {
+		return &httpService{url: u}, nil
+	}
+	return newTCPOverWSService(u), nil
+}
+
+func parsePath(r config.UnvalidatedIngressRule, ruleIndex int) (*Regexp, error) {
+	if r.Path == "" {
+		return nil, nil
+	}
+	regex, err := regexp.Compile(r.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Rule #%d has an invalid regex", ruleIndex+1)
+	}
+	return &Regexp{Regexp: regex}, nil
 }
 
 func validateHostname(r config.UnvalidatedIngressRule, ruleIndex, totalRules int) error {
@@ -283,6 +360,72 @@ func validateHostname(r config.UnvalidatedIngressRule, ruleIndex, totalRules int
 	return nil
 }
 
+func validateSourceAddress(cfg OriginRequestConfig, ruleIndex int) error {
+	if cfg.SourceAddress != "" && net.ParseIP(cfg.SourceAddress) == nil {
+		return fmt.Errorf("Rule #%d has an invalid sourceAddress %q, it must be an IP", ruleIndex+1, cfg.SourceAddress)
+	}
+	return nil
+}
+
+func validateMaintenanceStatus(cfg OriginRequestConfig, ruleIndex int) error {
+	if status := cfg.MaintenanceStatus; status != 0 && (status < 200 || status > 599) {
+		return fmt.Errorf("Rule #%d has an invalid maintenanceStatus %d, it must be an HTTP status code from 200 to 599", ruleIndex+1, status)
+	}
+	return nil
+}
+
+func validateAccessLogFields(cfg OriginRequestConfig, ruleIndex int) error {
+	for _, field := range cfg.AccessLogFields {
+		valid := false
+		for _, f := range accessLogFields {
+			valid = valid || f == field
+		}
+		if !valid {
+			return fmt.Errorf("Rule #%d has an invalid accessLogFields field %q, it must be one of %s", ruleIndex+1, field, strings.Join(accessLogFields, ", "))
+		}
+	}
+	return nil
+}
+
+func validateRevocationCheck(cfg OriginRequestConfig, ruleIndex int) error {
+	switch cfg.RevocationCheck {
+	case "", RevocationCheckStapled, RevocationCheckOCSP, RevocationCheckCRL:
+		return nil
+	default:
+		return fmt.Errorf("Rule #%d has an invalid revocationCheck %q, it must be %s, %s or %s", ruleIndex+1, cfg.RevocationCheck, RevocationCheckStapled, RevocationCheckOCSP, RevocationCheckCRL)
+	}
+}
+
+func validateTLSVersion(version, key string, ruleIndex int) error {
+	if _, err := tlsconfig.ParseTLSVersion(version); err != nil {
+		return fmt.Errorf("Rule #%d has an invalid %s: %w", ruleIndex+1, key, err)
+	}
+	return nil
+}
+
+func validateTLSVersionRange(cfg OriginRequestConfig, ruleIndex int) error {
+	min, _ := tlsconfig.ParseTLSVersion(cfg.TLSMinVersion)
+	max, _ := tlsconfig.ParseTLSVersion(cfg.TLSMaxVersion)
+	if min != 0 && max != 0 && min > max {
+		return fmt.Errorf("Rule #%d has a tlsMaxVersion %s below its tlsMinVersion %s", ruleIndex+1, cfg.TLSMaxVersion, cfg.TLSMinVersion)
+	}
+	return nil
+}
+
+func validateTLSCipherSuites(cfg OriginRequestConfig, ruleIndex int) error {
+	if _, err := tlsconfig.ParseCipherSuites(cfg.TLSCipherSuites); err != nil {
+		return fmt.Errorf("Rule #%d has invalid tlsCipherSuites: %w", ruleIndex+1, err)
+	}
+	return nil
+}
+
+func validateHealthPath(cfg OriginRequestConfig, ruleIndex int) error {
+	if cfg.HealthPath != "" && !strings.HasPrefix(cfg.HealthPath, "/") {
+		return fmt.Errorf("Rule #%d has an invalid healthPath %q, it must start with /", ruleIndex+1, cfg.HealthPath)
+	}
+	return nil
+}
+
 type errRuleShouldNotBeCatchAll struct {
 	index    int
 	hostname string
@@ -0,0 +1,129 @@
+package ingress
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxServerNameTransports is how many server names an originServerName template keeps connections to origins for,
+// connections of the other server names aren't reused
+const maxServerNameTransports = 1000
+
+// matchVarPattern is a variable of httpHostHeader and originServerName, e.g. ${1}
+var matchVarPattern = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+
+type matchVarsKey struct{}
+
+// hasMatchVars is whether value contains variables of the request that matched a rule
+func hasMatchVars(value string) bool {
+	return matchVarPattern.MatchString(value)
+}
+
+// UsesMatchVars is whether httpHostHeader or originServerName contain variables of the request that matched the rule.
+func (c *OriginRequestConfig) UsesMatchVars() bool {
+	return hasMatchVars(c.HTTPHostHeader) || hasMatchVars(c.OriginServerName)
+}
+
+// MatchVars returns the variables httpHostHeader and originServerName can contain, from the request to hostname and
+// path that matched the rule:
+//   - ${host} is hostname
+//   - ${1}, ${2}... are the part of hostname the wildcard of the rule matched, if it has one, followed by the capture
+//     groups of the path of the rule
+//   - ${name} is the capture group of the path named name
+func (r *Rule) MatchVars(hostname, path string) map[string]string {
+	if host, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = host
+	}
+	vars := map[string]string{"host": hostname}
+	var groups []string
+	if strings.HasPrefix(r.Hostname, "*.") {
+		groups = append(groups, strings.TrimSuffix(hostname, strings.TrimPrefix(r.Hostname, "*")))
+	}
+	if r.Path != nil && r.Path.Regexp != nil {
+		if match := r.Path.Regexp.FindStringSubmatch(path); match != nil {
+			groups = append(groups, match[1:]...)
+			for i, name := range r.Path.Regexp.SubexpNames() {
+				if name != "" {
+					vars[name] = match[i]
+				}
+			}
+		}
+	}
+	for i, group := range groups {
+		vars[strconv.Itoa(i+1)] = group
+	}
+	return vars
+}
+
+// WithMatchVars returns a context with the MatchVars of the rule a request matched, for its origin to expand them.
+func WithMatchVars(ctx context.Context, vars map[string]string) context.Context {
+	return context.WithValue(ctx, matchVarsKey{}, vars)
+}
+
+// expandMatchVars replaces the variables of value by the ones of the rule req matched. Unknown variables are removed.
+func expandMatchVars(value string, req *http.Request) string {
+	if !hasMatchVars(value) {
+		return value
+	}
+	vars, _ := req.Context().Value(matchVarsKey{}).(map[string]string)
+	return matchVarPattern.ReplaceAllStringFunc(value, func(variable string) string {
+		return vars[matchVarPattern.FindStringSubmatch(variable)[1]]
+	})
+}
+
+// setHostHeader sends req with hostHeader as Host header if it's set, and the original one as X-Forwarded-Host
+func setHostHeader(req *http.Request, hostHeader string) {
+	if hostHeader == "" {
+		return
+	}
+	// For incoming requests, the Host header is promoted to the Request.Host field and removed from the Header map.
+	// Pass the original Host header as X-Forwarded-Host.
+	req.Header.Set("X-Forwarded-Host", req.Host)
+	req.Host = expandMatchVars(hostHeader, req)
+}
+
+// serverNameTransports sends requests with the server name an originServerName template expands to. Each server name
+// has its own clone of the transport, since a transport reuses its connections regardless of their server name.
+type serverNameTransports struct {
+	template   string
+	base       *http.Transport
+	lock       sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func newServerNameTransports(template string, base *http.Transport) *serverNameTransports {
+	return &serverNameTransports{
+		template:   template,
+		base:       base,
+		transports: make(map[string]*http.Transport),
+	}
+}
+
+func (t *serverNameTransports) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.transport(expandMatchVars(t.template, req)).RoundTrip(req)
+}
+
+func (t *serverNameTransports) transport(serverName string) *http.Transport {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if transport, ok := t.transports[serverName]; ok {
+		return transport
+	}
+	transport := t.base.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.ServerName = serverName
+	if len(t.transports) >= maxServerNameTransports {
+		transport.DisableKeepAlives = true
+		return transport
+	}
+	t.transports[serverName] = transport
+	return transport
+}
@@ -0,0 +1,78 @@
+package ingress
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleMatchVars(t *testing.T) {
+	rule := Rule{
+		Hostname: "*.example.com",
+		Path:     &Regexp{Regexp: regexp.MustCompile(`^/(?P<app>[a-z]+)/(v[0-9])`)},
+	}
+	assert.Equal(t, map[string]string{
+		"host": "tenant.example.com",
+		"1":    "tenant",
+		"2":    "shop",
+		"3":    "v2",
+		"app":  "shop",
+	}, rule.MatchVars("tenant.example.com:443", "/shop/v2/cart"))
+
+	rule = Rule{Hostname: "example.com"}
+	assert.Equal(t, map[string]string{"host": "example.com"}, rule.MatchVars("example.com", "/"))
+}
+
+func TestExpandMatchVars(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://tenant.example.com", nil)
+	require.NoError(t, err)
+	assert.Equal(t, ".internal", expandMatchVars("${1}.internal", req))
+	assert.Equal(t, "origin.internal", expandMatchVars("origin.internal", req))
+
+	req = req.WithContext(WithMatchVars(req.Context(), map[string]string{"host": "tenant.example.com", "1": "tenant"}))
+	assert.Equal(t, "tenant.internal", expandMatchVars("${1}.internal", req))
+	assert.Equal(t, "tenant.example.com/tenant", expandMatchVars("${host}/${1}", req))
+	assert.Equal(t, ".internal", expandMatchVars("${2}.internal", req))
+}
+
+func TestHTTPServiceMatchVars(t *testing.T) {
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + r.TLS.ServerName))
+	}))
+	defer origin.Close()
+	originURL, err := url.Parse(origin.URL)
+	require.NoError(t, err)
+
+	cfg := OriginRequestConfig{
+		HTTPHostHeader:   "${1}.internal",
+		OriginServerName: "${1}.origin.internal",
+		NoTLSVerify:      true,
+	}
+	require.True(t, cfg.UsesMatchVars())
+	httpService := &httpService{url: originURL}
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	require.NoError(t, httpService.start(testLogger, shutdownC, cfg))
+
+	rule := Rule{Hostname: "*.example.com"}
+	for _, tenant := range []string{"a", "b", "a"} {
+		req, err := http.NewRequest(http.MethodGet, "https://"+tenant+".example.com", nil)
+		require.NoError(t, err)
+		req = req.WithContext(WithMatchVars(req.Context(), rule.MatchVars(req.Host, req.URL.Path)))
+
+		resp, err := httpService.RoundTrip(req)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, tenant+".internal "+tenant+".origin.internal", string(body))
+		assert.Equal(t, tenant+".example.com", req.Header.Get("X-Forwarded-Host"))
+	}
+	assert.Len(t, httpService.transport.(*serverNameTransports).transports, 2)
+}
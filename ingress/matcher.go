@@ -0,0 +1,175 @@
+package ingress
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ruleMatcher finds the first rule matching a request without evaluating every rule, so that configurations with
+// thousands of rules are matched quickly. Rules are indexed by the hostnames they match: exact hostnames in a map,
+// wildcard hostnames in a trie of their suffixes, and the rules matching any hostname in a list. A request is only
+// matched against the paths of the rules of its hostname, in the order of the rules.
+type ruleMatcher struct {
+	exact    map[string]*ruleList
+	wildcard *suffixNode
+	anyHost  *ruleList
+	paths    []pathMatcher
+}
+
+// ruleList are the indexes of the rules of a hostname pattern, in ascending order
+type ruleList struct {
+	rules []int
+	// final is set once a rule without path is added, since the rules after it are never matched
+	final bool
+}
+
+func (l *ruleList) add(i int, rule *Rule) {
+	if l.final {
+		return
+	}
+	l.rules = append(l.rules, i)
+	l.final = rule.Path == nil || rule.Path.Regexp == nil
+}
+
+// suffixNode is a node of a radix trie of the suffixes of wildcard hostnames, walked from their last byte to their
+// first
+type suffixNode struct {
+	// suffix is the part of the suffixes between the parent of the node and the node
+	suffix string
+	// children are keyed by the last byte of their suffix
+	children map[byte]*suffixNode
+	// rules of the wildcard hostnames whose suffix ends at this node
+	rules ruleList
+}
+
+// insert returns the node of suffix, adding it to the trie if needed
+func (n *suffixNode) insert(suffix string) *suffixNode {
+	node := n
+	for len(suffix) > 0 {
+		key := suffix[len(suffix)-1]
+		child, ok := node.children[key]
+		if !ok {
+			child = &suffixNode{suffix: suffix}
+			node.addChild(child)
+			return child
+		}
+		common := commonSuffixLen(child.suffix, suffix)
+		if common < len(child.suffix) {
+			// Split the child at the end of the common suffix
+			parent := &suffixNode{suffix: child.suffix[len(child.suffix)-common:]}
+			child.suffix = child.suffix[:len(child.suffix)-common]
+			parent.addChild(child)
+			node.children[key] = parent
+			child = parent
+		}
+		suffix = suffix[:len(suffix)-common]
+		node = child
+	}
+	return node
+}
+
+func (n *suffixNode) addChild(child *suffixNode) {
+	if n.children == nil {
+		n.children = make(map[byte]*suffixNode)
+	}
+	n.children[child.suffix[len(child.suffix)-1]] = child
+}
+
+func commonSuffixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[len(a)-1-i] == b[len(b)-1-i] {
+		i++
+	}
+	return i
+}
+
+// pathMatcher matches the path of a rule, with strings.Contains if the path regex is a literal string
+type pathMatcher struct {
+	regexp    *regexp.Regexp
+	literal   string
+	isLiteral bool
+}
+
+func (p *pathMatcher) match(path string) bool {
+	if p.regexp == nil {
+		return true
+	}
+	if p.isLiteral {
+		return strings.Contains(path, p.literal)
+	}
+	return p.regexp.MatchString(path)
+}
+
+func newRuleMatcher(rules []Rule) *ruleMatcher {
+	m := &ruleMatcher{
+		exact:    make(map[string]*ruleList),
+		wildcard: &suffixNode{},
+		anyHost:  &ruleList{},
+		paths:    make([]pathMatcher, len(rules)),
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Path != nil && rule.Path.Regexp != nil {
+			m.paths[i].regexp = rule.Path.Regexp
+			m.paths[i].literal, m.paths[i].isLiteral = rule.Path.Regexp.LiteralPrefix()
+		}
+
+		switch {
+		case rule.Hostname == "" || rule.Hostname == "*":
+			m.anyHost.add(i, rule)
+		case strings.HasPrefix(rule.Hostname, "*."):
+			m.wildcard.insert(strings.TrimPrefix(rule.Hostname, "*.")).rules.add(i, rule)
+		default:
+			list, ok := m.exact[rule.Hostname]
+			if !ok {
+				list = &ruleList{}
+				m.exact[rule.Hostname] = list
+			}
+			list.add(i, rule)
+		}
+	}
+	return m
+}
+
+// match returns the index of the first rule matching hostname and path, or -1 if none does
+func (m *ruleMatcher) match(hostname, path string) int {
+	// Candidate rules are in the lists of the exact hostname, of each wildcard suffix of the hostname and of any
+	// hostname. Since each rule is in one list, merging the lists visits the candidates in the order of the rules.
+	var listsBuf [8][]int
+	lists := listsBuf[:0]
+	if list, ok := m.exact[hostname]; ok {
+		lists = append(lists, list.rules)
+	}
+	node, rest := m.wildcard, hostname
+	for {
+		if len(node.rules.rules) > 0 {
+			lists = append(lists, node.rules.rules)
+		}
+		if rest == "" {
+			break
+		}
+		child, ok := node.children[rest[len(rest)-1]]
+		if !ok || !strings.HasSuffix(rest, child.suffix) {
+			break
+		}
+		node, rest = child, rest[:len(rest)-len(child.suffix)]
+	}
+	lists = append(lists, m.anyHost.rules)
+
+	for {
+		next := -1
+		for l := range lists {
+			if len(lists[l]) > 0 && (next < 0 || lists[l][0] < lists[next][0]) {
+				next = l
+			}
+		}
+		if next < 0 {
+			return -1
+		}
+		i := lists[next][0]
+		lists[next] = lists[next][1:]
+		if m.paths[i].match(path) {
+			return i
+		}
+	}
+}
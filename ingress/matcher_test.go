@@ -0,0 +1,155 @@
+package ingress
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+// linearMatch is the rule index FindMatchingRule returns without a matcher
+func linearMatch(rules []Rule, hostname, path string) int {
+	for i, rule := range rules {
+		if rule.Matches(hostname, path) {
+			return i
+		}
+	}
+	return len(rules) - 1
+}
+
+func TestRuleMatcher(t *testing.T) {
+	rulesYAML := `
+ingress:
+ - hostname: api.example.com
+   path: /v1/
+   service: http://localhost:8000
+ - hostname: "*.example.com"
+   path: ^/admin
+   service: http://localhost:8001
+ - hostname: api.example.com
+   service: http://localhost:8002
+ - hostname: api.example.com
+   path: /v2/
+   service: http://localhost:8003
+ - hostname: "*.api.example.com"
+   service: http://localhost:8004
+ - path: \.(jpg|png)$
+   service: http://localhost:8005
+ - hostname: "*.example.com"
+   service: http://localhost:8006
+ - hostname: "*.org"
+   path: /static/
+   service: http://localhost:8007
+ - hostname: example.org
+   service: http://localhost:8008
+ - service: http://localhost:8009
+`
+	ing, err := ParseIngress(MustReadIngress(rulesYAML))
+	require.NoError(t, err)
+	require.NotNil(t, ing.matcher)
+
+	tests := []struct {
+		host          string
+		path          string
+		wantRuleIndex int
+	}{
+		{host: "api.example.com", path: "/v1/users", wantRuleIndex: 0},
+		{host: "api.example.com", path: "/admin/v1/", wantRuleIndex: 0},
+		{host: "api.example.com", path: "/admin", wantRuleIndex: 1},
+		{host: "api.example.com", path: "/v2/users", wantRuleIndex: 2},
+		{host: "api.example.com:443", path: "/", wantRuleIndex: 2},
+		{host: "eu.api.example.com", path: "/", wantRuleIndex: 4},
+		{host: "eu.api.example.com", path: "/admin", wantRuleIndex: 1},
+		{host: "www.example.com", path: "/logo.png", wantRuleIndex: 5},
+		{host: "www.example.com", path: "/", wantRuleIndex: 6},
+		// Wildcards match any suffix of the hostname
+		{host: "badexample.com", path: "/", wantRuleIndex: 6},
+		{host: "example.org", path: "/static/app.js", wantRuleIndex: 7},
+		{host: "example.org", path: "/", wantRuleIndex: 8},
+		{host: "www.example.org", path: "/", wantRuleIndex: 9},
+		{host: "example.net", path: "/logo.jpg", wantRuleIndex: 5},
+		{host: "", path: "/", wantRuleIndex: 9},
+	}
+	for _, test := range tests {
+		_, ruleIndex := ing.FindMatchingRule(test.host, test.path)
+		assert.Equal(t, test.wantRuleIndex, ruleIndex, "host=%s, path=%s", test.host, test.path)
+		hostname := strings.TrimSuffix(test.host, ":443")
+		assert.Equal(t, linearMatch(ing.Rules, hostname, test.path), ruleIndex, "host=%s, path=%s", test.host, test.path)
+	}
+}
+
+func TestRuleMatcherGenerated(t *testing.T) {
+	const n = 100
+	ing := generatedIngress(t, n)
+	for i := -1; i <= n; i++ {
+		for _, host := range []string{
+			fmt.Sprintf("app-%d.example.com", i),
+			fmt.Sprintf("www.app-%d.example.com", i),
+			fmt.Sprintf("xapp-%d.example.com", i),
+		} {
+			for _, path := range []string{"/", "/api/users", "/v1/api/"} {
+				_, ruleIndex := ing.FindMatchingRule(host, path)
+				require.Equal(t, linearMatch(ing.Rules, host, path), ruleIndex, "host=%s, path=%s", host, path)
+			}
+		}
+	}
+}
+
+// generatedIngress returns an ingress with the rules of n hostnames, like the configurations generated by automation
+func generatedIngress(t testing.TB, n int) Ingress {
+	rules := make([]config.UnvalidatedIngressRule, 0, n+1)
+	for i := 0; i < n; i++ {
+		hostname := fmt.Sprintf("app-%d.example.com", i)
+		switch i % 4 {
+		case 0:
+			rules = append(rules, config.UnvalidatedIngressRule{
+				Hostname: hostname,
+				Path:     "^/api/",
+				Service:  fmt.Sprintf("http://localhost:%d", 10000+i),
+			})
+		case 1:
+			hostname = "*." + hostname
+		}
+		rules = append(rules, config.UnvalidatedIngressRule{
+			Hostname: hostname,
+			Service:  fmt.Sprintf("http://localhost:%d", 20000+i),
+		})
+	}
+	rules = append(rules, config.UnvalidatedIngressRule{Service: "http_status:404"})
+	ing, err := ParseIngress(&config.Configuration{Ingress: rules})
+	require.NoError(t, err)
+	return ing
+}
+
+func BenchmarkFindMatchingRule(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		ing := generatedIngress(b, n)
+		linear := Ingress{Rules: ing.Rules, Defaults: ing.Defaults}
+		requests := []struct {
+			name string
+			host string
+			path string
+		}{
+			{name: "first", host: "app-0.example.com", path: "/api/users"},
+			{name: "last", host: fmt.Sprintf("app-%d.example.com", n-1), path: "/"},
+			{name: "wildcard", host: fmt.Sprintf("www.app-%d.example.com", (n-4)/4*4+1), path: "/"},
+			{name: "catchAll", host: "unknown.example.net", path: "/"},
+		}
+		for _, req := range requests {
+			b.Run(fmt.Sprintf("compiled/%d/%s", n, req.name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					ing.FindMatchingRule(req.host, req.path)
+				}
+			})
+			b.Run(fmt.Sprintf("linear/%d/%s", n, req.name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					linear.FindMatchingRule(req.host, req.path)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package ingress
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "cloudflared"
+	metricsSubsystem = "tunnel"
+)
+
+var (
+	warmConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "warm_origin_connections",
+			Help:      "Idle connections established ahead of requests to each origin with warmConnections",
+		},
+		[]string{"origin"},
+	)
+	warmPoolDials = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "warm_origin_dials",
+			Help:      "Count of the new connections to each origin with warmConnections, by whether a warm connection was used (hit) or the origin was dialed (miss)",
+		},
+		[]string{"origin", "pool"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(warmConnections, warmPoolDials)
+}
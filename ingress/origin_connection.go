@@ -2,8 +2,12 @@ package ingress
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog"
 
@@ -20,6 +24,13 @@ type OriginConnection interface {
 	Close()
 }
 
+// RawOriginConnection is an OriginConnection that can also stream a plain TCP connection instead of a WebSocket, like
+// the connections accepted by the local TCP listeners of cloudflared
+type RawOriginConnection interface {
+	OriginConnection
+	StreamRaw(ctx context.Context, conn io.ReadWriter, log *zerolog.Logger)
+}
+
 type streamHandlerFunc func(originConn io.ReadWriter, remoteConn net.Conn, log *zerolog.Logger)
 
 // DefaultStreamHandler is an implementation of streamHandlerFunc that
@@ -28,6 +39,12 @@ func DefaultStreamHandler(originConn io.ReadWriter, remoteConn net.Conn, log *ze
 	websocket.Stream(originConn, remoteConn, log)
 }
 
+// HalfCloseStreamHandler is an implementation of streamHandlerFunc that performs a two way io.Copy between originConn
+// and remoteConn, until both directions are done.
+func HalfCloseStreamHandler(originConn io.ReadWriter, remoteConn net.Conn, log *zerolog.Logger) {
+	websocket.StreamHalfClose(originConn, remoteConn, log)
+}
+
 // tcpConnection is an OriginConnection that directly streams to raw TCP.
 type tcpConnection struct {
 	conn net.Conn
@@ -41,6 +58,11 @@ func (tc *tcpConnection) Close() {
 	tc.conn.Close()
 }
 
+// LocalAddr is the address of cloudflared's end of the connection
+func (tc *tcpConnection) LocalAddr() net.Addr {
+	return tc.conn.LocalAddr()
+}
+
 // tcpOverWSConnection is an OriginConnection that streams to TCP over WS.
 type tcpOverWSConnection struct {
 	conn          net.Conn
@@ -56,6 +78,10 @@ func (wc *tcpOverWSConnection) Stream(ctx context.Context, tunnelConn io.ReadWri
 	wsConn.Close()
 }
 
+func (wc *tcpOverWSConnection) StreamRaw(_ context.Context, conn io.ReadWriter, log *zerolog.Logger) {
+	wc.streamHandler(conn, wc.conn, log)
+}
+
 func (wc *tcpOverWSConnection) Close() {
 	wc.conn.Close()
 }
@@ -78,3 +104,68 @@ func (sp *socksProxyOverWSConnection) Stream(ctx context.Context, tunnelConn io.
 
 func (sp *socksProxyOverWSConnection) Close() {
 }
+
+// idleTimeoutConn is a net.Conn closed once nothing was read from or written to it for timeout
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+	// lastActivity is the time of the last read or write, in nanoseconds since the epoch
+	lastActivity int64
+
+	timerLock sync.Mutex
+	timer     *time.Timer
+}
+
+func newIdleTimeoutConn(conn net.Conn, timeout time.Duration) *idleTimeoutConn {
+	c := &idleTimeoutConn{
+		Conn:         conn,
+		timeout:      timeout,
+		lastActivity: time.Now().UnixNano(),
+	}
+	c.timerLock.Lock()
+	c.timer = time.AfterFunc(timeout, c.checkIdle)
+	c.timerLock.Unlock()
+	return c
+}
+
+func (c *idleTimeoutConn) checkIdle() {
+	idle := time.Since(time.Unix(0, atomic.LoadInt64(&c.lastActivity)))
+	if idle >= c.timeout {
+		_ = c.Conn.Close()
+		return
+	}
+	c.timerLock.Lock()
+	c.timer.Reset(c.timeout - idle)
+	c.timerLock.Unlock()
+}
+
+func (c *idleTimeoutConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		atomic.StoreInt64(&c.lastActivity, time.Now().UnixNano())
+	}
+	return n, err
+}
+
+func (c *idleTimeoutConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		atomic.StoreInt64(&c.lastActivity, time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// CloseWrite half-closes the connection if it supports it, like *net.TCPConn
+func (c *idleTimeoutConn) CloseWrite() error {
+	if conn, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return conn.CloseWrite()
+	}
+	return errors.New("the connection can't be half-closed")
+}
+
+func (c *idleTimeoutConn) Close() error {
+	c.timerLock.Lock()
+	c.timer.Stop()
+	c.timerLock.Unlock()
+	return c.Conn.Close()
+}
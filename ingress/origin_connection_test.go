@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	gobwas "github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 	gorillaWS "github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
@@ -69,6 +70,33 @@ func TestStreamTCPConnection(t *testing.T) {
 	require.NoError(t, errGroup.Wait())
 }
 
+func TestIdleTimeoutConn(t *testing.T) {
+	const idleTimeout = 100 * time.Millisecond
+	originConn, peer := net.Pipe()
+	defer peer.Close()
+	conn := newIdleTimeoutConn(originConn, idleTimeout)
+
+	// Traffic keeps the connection open past the idle timeout
+	go func() {
+		buf := make([]byte, 4)
+		for {
+			if _, err := peer.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		_, err := conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		time.Sleep(idleTimeout / 2)
+	}
+
+	start := time.Now()
+	_, err := conn.Read(make([]byte, 4))
+	require.Error(t, err)
+	require.Less(t, time.Since(start), testStreamTimeout)
+}
+
 func TestDefaultStreamWSOverTCPConnection(t *testing.T) {
 	cfdConn, originConn := net.Pipe()
 	tcpOverWSConn := tcpOverWSConnection{
@@ -96,6 +124,59 @@ func TestDefaultStreamWSOverTCPConnection(t *testing.T) {
 	require.NoError(t, errGroup.Wait())
 }
 
+func TestHalfCloseStreamWSOverTCPConnection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testStreamTimeout)
+	defer cancel()
+	errGroup, ctx := errgroup.WithContext(ctx)
+	errGroup.Go(func() error {
+		originConn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		defer originConn.Close()
+		// The origin only responds once the eyeball is done sending, like an SMTP server after QUIT
+		request, err := io.ReadAll(originConn)
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, testMessage, request)
+		_, err = originConn.Write(testResponse)
+		return err
+	})
+
+	cfdConn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	tcpOverWSConn := tcpOverWSConnection{
+		conn:          cfdConn,
+		streamHandler: HalfCloseStreamHandler,
+	}
+	eyeballConn, edgeConn := net.Pipe()
+	responseC := make(chan []byte, 1)
+	go func() {
+		_ = wsutil.WriteClientBinary(eyeballConn, testMessage)
+		_ = wsutil.WriteClientMessage(eyeballConn, gobwas.OpClose, gobwas.NewCloseFrameBody(gobwas.StatusNormalClosure, ""))
+		for {
+			frame, err := gobwas.ReadFrame(eyeballConn)
+			if err != nil {
+				close(responseC)
+				return
+			}
+			if frame.Header.OpCode == gobwas.OpBinary {
+				responseC <- frame.Payload
+			}
+		}
+	}()
+
+	tcpOverWSConn.Stream(ctx, edgeConn, testLogger)
+	require.NoError(t, errGroup.Wait())
+	edgeConn.Close()
+	assert.Equal(t, testResponse, <-responseC)
+}
+
 // TestSocksStreamWSOverTCPConnection simulates proxying in socks mode.
 // Eyeball side runs cloudflared access tcp with --url flag to start a websocket forwarder which
 // wraps SOCKS5 traffic in websocket
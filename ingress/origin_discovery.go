@@ -0,0 +1,542 @@
+package ingress
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/retry"
+)
+
+const (
+	consulAddrEnv     = "CONSUL_HTTP_ADDR"
+	consulTokenEnv    = "CONSUL_HTTP_TOKEN"
+	consulAddrDefault = "127.0.0.1:8500"
+	// How long Consul holds a blocking query open when the instances don't change
+	consulWaitTime = 5 * time.Minute
+
+	etcdEndpointEnv     = "ETCDCTL_ENDPOINTS"
+	etcdEndpointDefault = "http://127.0.0.1:2379"
+	// etcd is polled, as its JSON gateway can't be relied on to stream watches
+	etcdPollInterval = 10 * time.Second
+
+	// SRV records are resolved again periodically, as their TTL isn't known
+	srvResolveInterval = 30 * time.Second
+
+	discoveryMaxRetries = 5
+)
+
+// originInstance is an instance of a service found by service discovery
+type originInstance struct {
+	addr string
+	// Instances of the lowest priority are used, in proportion to their weight, like SRV records
+	priority uint16
+	weight   uint16
+}
+
+func (i originInstance) String() string {
+	return i.addr
+}
+
+// equalInstances returns instances of the same priority and weight at addrs
+func equalInstances(addrs []string) []originInstance {
+	instances := make([]originInstance, len(addrs))
+	for i, addr := range addrs {
+		instances[i] = originInstance{addr: addr, weight: 1}
+	}
+	return instances
+}
+
+// instanceResolver finds the healthy instances of a service
+type instanceResolver interface {
+	String() string
+	// watch calls update with the instances each time they change, until ctx is done
+	watch(ctx context.Context, update func([]originInstance), log *zerolog.Logger)
+}
+
+// discoveredService is an OriginService load balancing HTTP requests across the instances found by a service
+// discovery backend, following them as they change
+type discoveredService struct {
+	// As configured, e.g. consul:web
+	service    string
+	scheme     string
+	resolver   instanceResolver
+	hostHeader string
+	transport  http.RoundTripper
+	// Underlying value is []originInstance, sorted by priority
+	instances atomic.Value
+	next      uint32
+}
+
+// discoveryPrefixes are the prefixes of services found by service discovery, e.g. consul:web, etcd+tls:/services/web
+// or srv+http://_web._tcp.example.internal
+var discoveryPrefixes = []string{"consul:", "consul+tls:", "etcd:", "etcd+tls:", "srv+http://", "srv+https://"}
+
+func isDiscoveredService(service string) bool {
+	for _, prefix := range discoveryPrefixes {
+		if strings.HasPrefix(service, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDiscoveredService parses a Consul service name or etcd key prefix, served over HTTPS with a +tls suffix, or an
+// SRV record name with the scheme of the origin
+func parseDiscoveredService(service string) (*discoveredService, error) {
+	backend, name := splitDiscoveredService(service)
+	scheme := "http"
+	if strings.HasSuffix(backend, "+tls") {
+		scheme = "https"
+		backend = strings.TrimSuffix(backend, "+tls")
+	}
+
+	var resolver instanceResolver
+	var err error
+	switch backend {
+	case "consul":
+		resolver, err = newConsulResolver(name)
+	case "etcd":
+		resolver, err = newEtcdResolver(name)
+	case "srv+http", "srv+https":
+		scheme = strings.TrimPrefix(backend, "srv+")
+		resolver, err = newSRVResolver(strings.TrimPrefix(name, "//"))
+	default:
+		return nil, fmt.Errorf("unknown service discovery backend %s", backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &discoveredService{
+		service:  service,
+		scheme:   scheme,
+		resolver: resolver,
+	}, nil
+}
+
+func splitDiscoveredService(service string) (backend, name string) {
+	if i := strings.Index(service, ":"); i >= 0 {
+		return service[:i], service[i+1:]
+	}
+	return service, ""
+}
+
+func (o *discoveredService) String() string {
+	return o.service
+}
+
+func (o *discoveredService) start(log *zerolog.Logger, shutdownC <-chan struct{}, cfg OriginRequestConfig) error {
+	transport, err := newHTTPTransport(o, cfg, log)
+	if err != nil {
+		return err
+	}
+	o.hostHeader = cfg.HTTPHostHeader
+	o.transport = transport
+	o.instances.Store([]originInstance(nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-shutdownC
+		cancel()
+	}()
+	go o.resolver.watch(ctx, func(instances []originInstance) {
+		sort.SliceStable(instances, func(i, j int) bool {
+			return instances[i].priority < instances[j].priority
+		})
+		addrs := make([]string, len(instances))
+		for i, instance := range instances {
+			addrs[i] = instance.addr
+		}
+		log.Info().Str("service", o.resolver.String()).Strs("instances", addrs).Msg("Origin instances changed")
+		o.instances.Store(instances)
+	}, log)
+	return nil
+}
+
+func (o *discoveredService) RoundTrip(req *http.Request) (*http.Response, error) {
+	instances, _ := o.instances.Load().([]originInstance)
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no healthy instance of %s", o.resolver)
+	}
+	req.URL.Host = o.pickInstance(instances).addr
+	req.URL.Scheme = o.scheme
+
+	setHostHeader(req, o.hostHeader)
+	return o.transport.RoundTrip(req)
+}
+
+// pickInstance picks one of the instances of the lowest priority, round robin when they weigh the same, or randomly in
+// proportion to their weights otherwise
+func (o *discoveredService) pickInstance(instances []originInstance) originInstance {
+	group := instances
+	for i, instance := range instances {
+		if instance.priority != instances[0].priority {
+			group = instances[:i]
+			break
+		}
+	}
+
+	sameWeight := true
+	totalWeight := 0
+	for _, instance := range group {
+		sameWeight = sameWeight && instance.weight == group[0].weight
+		totalWeight += int(instance.weight)
+	}
+	if sameWeight || totalWeight == 0 {
+		return group[int(atomic.AddUint32(&o.next, 1)-1)%len(group)]
+	}
+	n := rand.Intn(totalWeight)
+	for _, instance := range group {
+		if n < int(instance.weight) {
+			return instance
+		}
+		n -= int(instance.weight)
+	}
+	return group[len(group)-1]
+}
+
+func (o *discoveredService) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.String())
+}
+
+// consulResolver finds the instances of a Consul service passing their health checks, with blocking queries of the
+// Consul agent of CONSUL_HTTP_ADDR
+type consulResolver struct {
+	name     string
+	agentURL *url.URL
+	token    string
+	client   *http.Client
+}
+
+func newConsulResolver(name string) (*consulResolver, error) {
+	if name == "" {
+		return nil, fmt.Errorf("missing Consul service name")
+	}
+	addr := os.Getenv(consulAddrEnv)
+	if addr == "" {
+		addr = consulAddrDefault
+	}
+	agentURL, err := parseDiscoveryEndpoint(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", consulAddrEnv)
+	}
+	return &consulResolver{
+		name:     name,
+		agentURL: agentURL,
+		token:    os.Getenv(consulTokenEnv),
+		client:   http.DefaultClient,
+	}, nil
+}
+
+func (r *consulResolver) String() string {
+	return "Consul service " + r.name
+}
+
+func (r *consulResolver) watch(ctx context.Context, update func([]originInstance), log *zerolog.Logger) {
+	backoff := retry.BackoffHandler{MaxRetries: discoveryMaxRetries, RetryForever: true}
+	var index uint64
+	var current []string
+	for {
+		instances, newIndex, err := r.resolve(ctx, index)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Err(err).Str("service", r.name).Msg("Failed to resolve Consul service")
+			// Start over with a non blocking query
+			index = 0
+			if !retry.GlobalBudget().Wait(ctx, retry.OriginRetries) || !backoff.Backoff(ctx) {
+				return
+			}
+			continue
+		}
+		backoff = retry.BackoffHandler{MaxRetries: discoveryMaxRetries, RetryForever: true}
+		// The index must be reset if it goes backwards, e.g. when the Consul servers are restored from a snapshot, and
+		// must not be 0 or the next query wouldn't block
+		if newIndex < index {
+			newIndex = 0
+		} else if newIndex == 0 {
+			newIndex = 1
+		}
+		index = newIndex
+		if !reflect.DeepEqual(instances, current) {
+			current = instances
+			update(equalInstances(instances))
+		}
+	}
+}
+
+type consulServiceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+// resolve returns the instances of the service once they change from index, or after the wait time of Consul
+func (r *consulResolver) resolve(ctx context.Context, index uint64) ([]string, uint64, error) {
+	u := *r.agentURL
+	u.Path = "/v1/health/service/" + url.PathEscape(r.name)
+	query := url.Values{"passing": {"1"}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", consulWaitTime.String())
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if r.token != "" {
+		req.Header.Set("X-Consul-Token", r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("Consul responded with %s", resp.Status)
+	}
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, errors.Wrap(err, "invalid Consul response")
+	}
+	newIndex, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "invalid X-Consul-Index")
+	}
+
+	instances := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		instances = append(instances, net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)))
+	}
+	sort.Strings(instances)
+	return instances, newIndex, nil
+}
+
+// etcdResolver finds the instances of a service registered as the host:port values of the keys under a prefix, with
+// the JSON gateway of the etcd endpoint of ETCDCTL_ENDPOINTS
+type etcdResolver struct {
+	prefix   string
+	endpoint *url.URL
+	client   *http.Client
+	interval time.Duration
+}
+
+func newEtcdResolver(prefix string) (*etcdResolver, error) {
+	if prefix == "" {
+		return nil, fmt.Errorf("missing etcd key prefix")
+	}
+	endpoints := os.Getenv(etcdEndpointEnv)
+	if endpoints == "" {
+		endpoints = etcdEndpointDefault
+	}
+	// Only the first endpoint is used, the gateway of any member serves the whole cluster
+	endpoint, err := parseDiscoveryEndpoint(strings.Split(endpoints, ",")[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", etcdEndpointEnv)
+	}
+	return &etcdResolver{
+		prefix:   prefix,
+		endpoint: endpoint,
+		client:   http.DefaultClient,
+		interval: etcdPollInterval,
+	}, nil
+}
+
+func (r *etcdResolver) String() string {
+	return "etcd prefix " + r.prefix
+}
+
+func (r *etcdResolver) watch(ctx context.Context, update func([]originInstance), log *zerolog.Logger) {
+	var current []string
+	for {
+		instances, err := r.resolve(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Err(err).Str("prefix", r.prefix).Msg("Failed to resolve etcd prefix")
+		} else if !reflect.DeepEqual(instances, current) {
+			current = instances
+			update(equalInstances(instances))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+func (r *etcdResolver) resolve(ctx context.Context) ([]string, error) {
+	body, err := json.Marshal(map[string][]byte{
+		"key":       []byte(r.prefix),
+		"range_end": prefixRangeEnd([]byte(r.prefix)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	u := *r.endpoint
+	u.Path = "/v3/kv/range"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("etcd responded with %s", resp.Status)
+	}
+	// Keys and values are base64 encoded, which []byte fields decode
+	var rangeResp struct {
+		Kvs []struct {
+			Key   []byte `json:"key"`
+			Value []byte `json:"value"`
+		} `json:"kvs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rangeResp); err != nil {
+		return nil, errors.Wrap(err, "invalid etcd response")
+	}
+
+	instances := make([]string, 0, len(rangeResp.Kvs))
+	for _, kv := range rangeResp.Kvs {
+		instance := strings.TrimSpace(string(kv.Value))
+		if _, _, err := net.SplitHostPort(instance); err != nil {
+			return nil, fmt.Errorf("value of etcd key %s isn't host:port", kv.Key)
+		}
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+	return instances, nil
+}
+
+// srvResolver finds the instances of a service from its SRV records
+type srvResolver struct {
+	name      string
+	lookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	interval  time.Duration
+}
+
+func newSRVResolver(name string) (*srvResolver, error) {
+	if name == "" || strings.ContainsAny(name, "/:") {
+		return nil, fmt.Errorf("invalid SRV record name %q", name)
+	}
+	return &srvResolver{
+		name:      name,
+		lookupSRV: net.DefaultResolver.LookupSRV,
+		interval:  srvResolveInterval,
+	}, nil
+}
+
+func (r *srvResolver) String() string {
+	return "SRV records of " + r.name
+}
+
+func (r *srvResolver) watch(ctx context.Context, update func([]originInstance), log *zerolog.Logger) {
+	var current []originInstance
+	for {
+		instances, err := r.resolve(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		// The last instances are kept when the records can't be resolved
+		if err != nil {
+			log.Err(err).Str("name", r.name).Msg("Failed to resolve SRV records")
+		} else if !reflect.DeepEqual(instances, current) {
+			current = instances
+			update(instances)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+func (r *srvResolver) resolve(ctx context.Context) ([]originInstance, error) {
+	_, records, err := r.lookupSRV(ctx, "", "", r.name)
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]originInstance, 0, len(records))
+	for _, record := range records {
+		// A target of . means the service isn't available at this name
+		target := strings.TrimSuffix(record.Target, ".")
+		if target == "" {
+			continue
+		}
+		instances = append(instances, originInstance{
+			addr:     net.JoinHostPort(target, strconv.Itoa(int(record.Port))),
+			priority: record.Priority,
+			weight:   record.Weight,
+		})
+	}
+	// Records are shuffled by weight when they are looked up, so they are sorted to tell whether they changed
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].priority != instances[j].priority {
+			return instances[i].priority < instances[j].priority
+		}
+		return instances[i].addr < instances[j].addr
+	})
+	return instances, nil
+}
+
+// prefixRangeEnd returns the end of the range of keys starting with prefix
+func prefixRangeEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// All keys are greater than a prefix of only 0xff bytes
+	return []byte{0}
+}
+
+// parseDiscoveryEndpoint parses the address of a service discovery backend, defaulting to http
+func parseDiscoveryEndpoint(addr string) (*url.URL, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%s has no host", addr)
+	}
+	return u, nil
+}
@@ -0,0 +1,252 @@
+package ingress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+func TestParseDiscoveredService(t *testing.T) {
+	t.Setenv(consulAddrEnv, "consul.internal:8500")
+	t.Setenv(etcdEndpointEnv, "https://etcd-1:2379,https://etcd-2:2379")
+
+	tests := []struct {
+		service  string
+		scheme   string
+		resolver string
+		endpoint string
+	}{
+		{"consul:web", "http", "Consul service web", "http://consul.internal:8500"},
+		{"consul+tls:web", "https", "Consul service web", "http://consul.internal:8500"},
+		{"etcd:/services/web/", "http", "etcd prefix /services/web/", "https://etcd-1:2379"},
+		{"etcd+tls:/services/web/", "https", "etcd prefix /services/web/", "https://etcd-1:2379"},
+		{"srv+http://_web._tcp.example.internal", "http", "SRV records of _web._tcp.example.internal", ""},
+		{"srv+https://_web._tcp.example.internal", "https", "SRV records of _web._tcp.example.internal", ""},
+	}
+	for _, test := range tests {
+		service, err := parseDiscoveredService(test.service)
+		require.NoError(t, err, test.service)
+		assert.Equal(t, test.service, service.String())
+		assert.Equal(t, test.scheme, service.scheme)
+		assert.Equal(t, test.resolver, service.resolver.String())
+		switch resolver := service.resolver.(type) {
+		case *consulResolver:
+			assert.Equal(t, test.endpoint, resolver.agentURL.String())
+		case *etcdResolver:
+			assert.Equal(t, test.endpoint, resolver.endpoint.String())
+		}
+	}
+
+	_, err := parseDiscoveredService("consul:")
+	assert.Error(t, err)
+	_, err = parseDiscoveredService("etcd:")
+	assert.Error(t, err)
+}
+
+func TestParseIngressDiscoveredService(t *testing.T) {
+	ing, err := ParseIngress(&config.Configuration{Ingress: []config.UnvalidatedIngressRule{
+		{Hostname: "app.example.com", Service: "consul:web"},
+		{Service: "http_status:404"},
+	}})
+	require.NoError(t, err)
+	assert.IsType(t, &discoveredService{}, ing.Rules[0].Service)
+	assert.Equal(t, "consul:web", ing.Rules[0].Service.String())
+}
+
+func TestPrefixRangeEnd(t *testing.T) {
+	assert.Equal(t, []byte("/services/web0"), prefixRangeEnd([]byte("/services/web/")))
+	assert.Equal(t, []byte("b"), prefixRangeEnd([]byte{'a', 0xff}))
+	assert.Equal(t, []byte{0}, prefixRangeEnd([]byte{0xff}))
+}
+
+func TestConsulResolver(t *testing.T) {
+	var lock sync.Mutex
+	instances := `[{"Node": {"Address": "10.0.0.1"}, "Service": {"Port": 8080}}]`
+	index := 10
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/health/service/web", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("passing"))
+		assert.Equal(t, "secret", r.Header.Get("X-Consul-Token"))
+		if r.URL.Query().Get("index") == "10" {
+			// Instances changed while the query was blocked
+			lock.Lock()
+			instances = `[{"Node": {"Address": "10.0.0.1"}, "Service": {"Address": "10.0.1.2", "Port": 8080}},
+				{"Node": {"Address": "10.0.0.1"}, "Service": {"Port": 8080}}]`
+			index = 11
+			lock.Unlock()
+		} else if r.URL.Query().Get("index") == "11" {
+			<-r.Context().Done()
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		w.Header().Set("X-Consul-Index", fmt.Sprint(index))
+		fmt.Fprint(w, instances)
+	}))
+	defer consul.Close()
+	t.Setenv(consulAddrEnv, consul.URL)
+	t.Setenv(consulTokenEnv, "secret")
+
+	resolver, err := newConsulResolver("web")
+	require.NoError(t, err)
+	updates := make(chan []originInstance)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := zerolog.Nop()
+	go resolver.watch(ctx, func(instances []originInstance) {
+		updates <- instances
+	}, &log)
+
+	assert.Equal(t, equalInstances([]string{"10.0.0.1:8080"}), <-updates)
+	assert.Equal(t, equalInstances([]string{"10.0.0.1:8080", "10.0.1.2:8080"}), <-updates)
+}
+
+func TestEtcdResolver(t *testing.T) {
+	etcd := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v3/kv/range", r.URL.Path)
+		var req map[string][]byte
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "/services/web/", string(req["key"]))
+		assert.Equal(t, "/services/web0", string(req["range_end"]))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"kvs": []map[string][]byte{
+				{"key": []byte("/services/web/b"), "value": []byte("10.0.0.2:80")},
+				{"key": []byte("/services/web/a"), "value": []byte("10.0.0.1:80\n")},
+			},
+		})
+	}))
+	defer etcd.Close()
+	t.Setenv(etcdEndpointEnv, etcd.URL)
+
+	resolver, err := newEtcdResolver("/services/web/")
+	require.NoError(t, err)
+	instances, err := resolver.resolve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.2:80"}, instances)
+}
+
+func TestSRVResolver(t *testing.T) {
+	resolver, err := newSRVResolver("_web._tcp.example.internal")
+	require.NoError(t, err)
+	resolver.lookupSRV = func(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		assert.Equal(t, "_web._tcp.example.internal", name)
+		return "", []*net.SRV{
+			{Target: "web-3.example.internal.", Port: 8080, Priority: 20, Weight: 1},
+			{Target: "web-2.example.internal.", Port: 8080, Priority: 10, Weight: 20},
+			{Target: ".", Port: 0, Priority: 10, Weight: 0},
+			{Target: "web-1.example.internal.", Port: 8081, Priority: 10, Weight: 80},
+		}, nil
+	}
+
+	instances, err := resolver.resolve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []originInstance{
+		{addr: "web-1.example.internal:8081", priority: 10, weight: 80},
+		{addr: "web-2.example.internal:8080", priority: 10, weight: 20},
+		{addr: "web-3.example.internal:8080", priority: 20, weight: 1},
+	}, instances)
+
+	_, err = newSRVResolver("_web._tcp.example.internal:80")
+	assert.Error(t, err)
+}
+
+func TestPickInstance(t *testing.T) {
+	service := &discoveredService{}
+
+	equal := []originInstance{
+		{addr: "a", priority: 1, weight: 5},
+		{addr: "b", priority: 1, weight: 5},
+		{addr: "backup", priority: 2, weight: 5},
+	}
+	var picked []string
+	for i := 0; i < 4; i++ {
+		picked = append(picked, service.pickInstance(equal).addr)
+	}
+	assert.Equal(t, []string{"a", "b", "a", "b"}, picked)
+
+	weighted := []originInstance{
+		{addr: "heavy", priority: 1, weight: 90},
+		{addr: "light", priority: 1, weight: 10},
+		{addr: "backup", priority: 2, weight: 100},
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		counts[service.pickInstance(weighted).addr]++
+	}
+	assert.Zero(t, counts["backup"])
+	assert.Greater(t, counts["heavy"], counts["light"])
+	assert.NotZero(t, counts["light"])
+}
+
+// staticResolver resolves to fixed instances
+type staticResolver []string
+
+func (r staticResolver) String() string {
+	return "static"
+}
+
+func (r staticResolver) watch(_ context.Context, update func([]originInstance), _ *zerolog.Logger) {
+	update(equalInstances(r))
+}
+
+func TestDiscoveredServiceRoundTrip(t *testing.T) {
+	var origins []string
+	for i := 0; i < 2; i++ {
+		name := fmt.Sprintf("origin%d", i)
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name)
+		}))
+		defer origin.Close()
+		origins = append(origins, strings.TrimPrefix(origin.URL, "http://"))
+	}
+
+	service := &discoveredService{service: "static", scheme: "http", resolver: staticResolver(origins)}
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	log := zerolog.Nop()
+	require.NoError(t, service.start(&log, shutdownC, originRequestFromConfig(config.OriginRequestConfig{})))
+	require.Eventually(t, func() bool {
+		instances, _ := service.instances.Load().([]originInstance)
+		return len(instances) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	var responses []string
+	for i := 0; i < 4; i++ {
+		req, err := http.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+		require.NoError(t, err)
+		resp, err := service.RoundTrip(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		responses = append(responses, string(body))
+	}
+	assert.Equal(t, []string{"origin0", "origin1", "origin0", "origin1"}, responses)
+}
+
+func TestDiscoveredServiceNoInstance(t *testing.T) {
+	service := &discoveredService{service: "static", scheme: "http", resolver: staticResolver(nil)}
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	log := zerolog.Nop()
+	require.NoError(t, service.start(&log, shutdownC, originRequestFromConfig(config.OriginRequestConfig{})))
+
+	req, err := http.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	require.NoError(t, err)
+	_, err = service.RoundTrip(req)
+	assert.EqualError(t, err, "no healthy instance of static")
+}
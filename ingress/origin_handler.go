@@ -0,0 +1,248 @@
+package ingress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// HandlerService is the service of ingress rules served in-process by an http.Handler
+const HandlerService = "http_handler"
+
+// handlerService is an OriginService serving requests with an http.Handler of the program embedding cloudflared,
+// instead of proxying them to an origin over the network. Responses are streamed as the handler writes them.
+type handlerService struct {
+	handler http.Handler
+	log     *zerolog.Logger
+}
+
+// NewHandlerService returns an OriginService serving requests with handler. Handlers can't hijack connections, so
+// websockets aren't supported.
+func NewHandlerService(handler http.Handler) OriginService {
+	return &handlerService{handler: handler}
+}
+
+func (o *handlerService) String() string {
+	return HandlerService
+}
+
+func (o *handlerService) start(log *zerolog.Logger, _ <-chan struct{}, _ OriginRequestConfig) error {
+	o.log = log
+	return nil
+}
+
+func (o handlerService) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.String())
+}
+
+func (o *handlerService) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil {
+		req.Body = http.NoBody
+	}
+	bodyReader, bodyWriter := io.Pipe()
+	w := &pipeResponseWriter{
+		header:   make(http.Header),
+		body:     bodyWriter,
+		headersC: make(chan struct{}),
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				o.log.Error().Interface("panic", r).Str("path", req.URL.Path).Msg("HTTP handler panicked")
+				w.closeWithError(fmt.Errorf("HTTP handler panicked: %v", r))
+				return
+			}
+			w.closeWithError(nil)
+		}()
+		o.handler.ServeHTTP(w, req)
+	}()
+
+	select {
+	case <-w.headersC:
+	case <-req.Context().Done():
+		_ = bodyReader.Close()
+		return nil, req.Context().Err()
+	}
+	if w.err != nil {
+		return nil, w.err
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode: w.status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     w.sentHeader,
+		Body:       bodyReader,
+		Request:    req,
+	}, nil
+}
+
+// pipeResponseWriter is an http.ResponseWriter writing the response body to a pipe
+type pipeResponseWriter struct {
+	header http.Header
+	body   *io.PipeWriter
+
+	lock sync.Mutex
+	// Closed once the status and headers are sent, or the handler failed before sending them
+	headersC   chan struct{}
+	status     int
+	sentHeader http.Header
+	err        error
+}
+
+func (w *pipeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeResponseWriter) WriteHeader(status int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.writeHeaderLocked(status)
+}
+
+func (w *pipeResponseWriter) writeHeaderLocked(status int) {
+	if w.sentHeader != nil {
+		return
+	}
+	w.status = status
+	// Headers changed after they are sent are ignored, like with net/http
+	w.sentHeader = w.header.Clone()
+	close(w.headersC)
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	w.writeHeaderLocked(http.StatusOK)
+	w.lock.Unlock()
+	return w.body.Write(p)
+}
+
+// Flush implements http.Flusher, writes are unbuffered so they are sent as soon as they are read
+func (w *pipeResponseWriter) Flush() {}
+
+func (w *pipeResponseWriter) closeWithError(err error) {
+	w.lock.Lock()
+	if w.sentHeader == nil {
+		if err != nil {
+			w.err = err
+			close(w.headersC)
+		} else {
+			w.writeHeaderLocked(http.StatusOK)
+		}
+	}
+	w.lock.Unlock()
+	_ = w.body.CloseWithError(err)
+}
+
+// ListenerService is the service of ingress rules served in-process by a server accepting connections from a Listener
+const ListenerService = "http_listener"
+
+// listenerHost is the host of requests to a listenerService, the Host header of requests is unchanged
+const listenerHost = "listener.cloudflared.invalid"
+
+// listenerService is an OriginService proxying requests to an HTTP server of the program embedding cloudflared through
+// an in-memory Listener, instead of through a TCP or unix socket
+type listenerService struct {
+	listener   *Listener
+	hostHeader string
+	transport  http.RoundTripper
+}
+
+// NewListenerService returns an OriginService proxying requests to the HTTP server serving listener, e.g. with
+// http.Serve(listener, handler). Unlike NewHandlerService, websockets are supported.
+func NewListenerService(listener *Listener) OriginService {
+	return &listenerService{listener: listener}
+}
+
+func (o *listenerService) String() string {
+	return ListenerService
+}
+
+func (o *listenerService) start(log *zerolog.Logger, _ <-chan struct{}, cfg OriginRequestConfig) error {
+	transport, err := newHTTPTransport(o, cfg, log)
+	if err != nil {
+		return err
+	}
+	o.hostHeader = cfg.HTTPHostHeader
+	o.transport = transport
+	return nil
+}
+
+func (o listenerService) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.String())
+}
+
+func (o *listenerService) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = "http"
+	req.URL.Host = listenerHost
+	setHostHeader(req, o.hostHeader)
+	return o.transport.RoundTrip(req)
+}
+
+// Listener is an in-memory net.Listener, accepting the connections cloudflared makes to a listenerService
+type Listener struct {
+	connC   chan net.Conn
+	closeC  chan struct{}
+	closing sync.Once
+}
+
+// NewListener returns a Listener, to be served by the program and given to NewListenerService
+func NewListener() *Listener {
+	return &Listener{
+		connC:  make(chan net.Conn),
+		closeC: make(chan struct{}),
+	}
+}
+
+// Accept waits for cloudflared to connect to the listener
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.connC:
+		return conn, nil
+	case <-l.closeC:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the listener, connections already accepted stay open
+func (l *Listener) Close() error {
+	l.closing.Do(func() {
+		close(l.closeC)
+	})
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return listenerAddr{}
+}
+
+// DialContext connects to the listener, waiting for the connection to be accepted
+func (l *Listener) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	clientConn, serverConn := net.Pipe()
+	select {
+	case l.connC <- serverConn:
+		return clientConn, nil
+	case <-l.closeC:
+		return nil, fmt.Errorf("dial %s: %w", ListenerService, net.ErrClosed)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type listenerAddr struct{}
+
+func (listenerAddr) Network() string {
+	return "memory"
+}
+
+func (listenerAddr) String() string {
+	return ListenerService
+}
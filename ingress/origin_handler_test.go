@@ -0,0 +1,163 @@
+package ingress
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+func startHandlerService(t *testing.T, handler http.Handler) *handlerService {
+	service := NewHandlerService(handler).(*handlerService)
+	log := zerolog.Nop()
+	require.NoError(t, service.start(&log, nil, originRequestFromConfig(config.OriginRequestConfig{})))
+	return service
+}
+
+func TestHandlerService(t *testing.T) {
+	service := startHandlerService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		// Set after the headers are sent
+		w.Header().Set("X-Late", "true")
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.Host + r.URL.Path + " " + string(body)))
+	}))
+
+	req, err := http.NewRequest(http.MethodPost, "http://app.example.com/items", strings.NewReader("hello"))
+	require.NoError(t, err)
+	resp, err := service.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("X-Late"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "app.example.com/items hello", string(body))
+}
+
+func TestHandlerServiceStreams(t *testing.T) {
+	nextC := make(chan struct{})
+	service := startHandlerService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: 1\n"))
+		w.(http.Flusher).Flush()
+		<-nextC
+		_, _ = w.Write([]byte("data: 2\n"))
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "http://app.example.com/events", nil)
+	require.NoError(t, err)
+	resp, err := service.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: 1\n", line)
+	close(nextC)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: 2\n", line)
+}
+
+func TestHandlerServiceWithoutBody(t *testing.T) {
+	service := startHandlerService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req, err := http.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	require.NoError(t, err)
+	resp, err := service.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Empty(t, body)
+}
+
+func TestHandlerServicePanic(t *testing.T) {
+	service := startHandlerService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("broken")
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	require.NoError(t, err)
+	_, err = service.RoundTrip(req)
+	assert.EqualError(t, err, "HTTP handler panicked: broken")
+}
+
+func TestListenerService(t *testing.T) {
+	listener := NewListener()
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") == "websocket" {
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			defer conn.Close()
+			_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+			_ = rw.Flush()
+			// Echoes a line
+			line, _ := rw.ReadString('\n')
+			_, _ = rw.WriteString(line)
+			_ = rw.Flush()
+			return
+		}
+		_, _ = w.Write([]byte(r.Host + r.URL.Path))
+	})}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Close()
+
+	service := NewListenerService(listener).(*listenerService)
+	log := zerolog.Nop()
+	require.NoError(t, service.start(&log, nil, originRequestFromConfig(config.OriginRequestConfig{})))
+
+	req, err := http.NewRequest(http.MethodGet, "https://app.example.com/items", nil)
+	require.NoError(t, err)
+	resp, err := service.RoundTrip(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, "app.example.com/items", string(body))
+
+	req, err = http.NewRequest(http.MethodGet, "https://app.example.com/ws", nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	resp, err = service.RoundTrip(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	stream, ok := resp.Body.(io.ReadWriteCloser)
+	require.True(t, ok)
+	defer stream.Close()
+	_, err = stream.Write([]byte("ping\n"))
+	require.NoError(t, err)
+	line, err := bufio.NewReader(stream).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "ping\n", line)
+}
+
+func TestListenerClose(t *testing.T) {
+	listener := NewListener()
+	require.NoError(t, listener.Close())
+	require.NoError(t, listener.Close())
+
+	_, err := listener.Accept()
+	assert.ErrorIs(t, err, net.ErrClosed)
+	_, err = listener.DialContext(context.Background(), "tcp", "")
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
@@ -23,7 +23,12 @@ func (o *unixSocketPath) RoundTrip(req *http.Request) (*http.Response, error) {
 }
 
 func (o *httpService) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Rewrite the request URL so that it goes to the origin service.
+	o.rewrite(req, o.hostHeader)
+	return o.transport.RoundTrip(req)
+}
+
+// rewrite rewrites req so that it goes to the origin service, with hostHeader as Host header if it's set
+func (o *httpService) rewrite(req *http.Request, hostHeader string) {
 	req.URL.Host = o.url.Host
 	switch o.url.Scheme {
 	case "ws":
@@ -34,13 +39,7 @@ func (o *httpService) RoundTrip(req *http.Request) (*http.Response, error) {
 		req.URL.Scheme = o.url.Scheme
 	}
 
-	if o.hostHeader != "" {
-		// For incoming requests, the Host header is promoted to the Request.Host field and removed from the Header map.
-		// Pass the original Host header as X-Forwarded-Host.
-		req.Header.Set("X-Forwarded-Host", req.Host)
-		req.Host = o.hostHeader
-	}
-	return o.transport.RoundTrip(req)
+	setHostHeader(req, hostHeader)
 }
 
 func (o *statusCode) RoundTrip(_ *http.Request) (*http.Response, error) {
@@ -59,12 +58,20 @@ func (o *rawTCPService) EstablishConnection(ctx context.Context, dest string) (O
 		return nil, err
 	}
 
+	if o.idleTimeout > 0 {
+		conn = newIdleTimeoutConn(conn, o.idleTimeout)
+	}
+
 	originConn := &tcpConnection{
 		conn: conn,
 	}
 	return originConn, nil
 }
 
+func (o *warpRoutingTCPService) EstablishConnection(ctx context.Context, dest string) (OriginConnection, error) {
+	return o.serviceFor(dest).EstablishConnection(ctx, dest)
+}
+
 func (o *tcpOverWSService) EstablishConnection(ctx context.Context, dest string) (OriginConnection, error) {
 	var err error
 	if !o.isBastion {
@@ -75,6 +82,9 @@ func (o *tcpOverWSService) EstablishConnection(ctx context.Context, dest string)
 	if err != nil {
 		return nil, err
 	}
+	if o.idleTimeout > 0 {
+		conn = newIdleTimeoutConn(conn, o.idleTimeout)
+	}
 	originConn := &tcpOverWSConnection{
 		conn:          conn,
 		streamHandler: o.streamHandler,
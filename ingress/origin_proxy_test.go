@@ -2,6 +2,7 @@ package ingress
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -9,11 +10,13 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/cloudflare/cloudflared/carrier"
+	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/websocket"
 )
 
@@ -40,6 +43,34 @@ func TestRawTCPServiceEstablishConnection(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestWarpRoutingTCPServiceOverrides(t *testing.T) {
+	_, network, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	_, subnet, err := net.ParseCIDR("10.1.0.0/16")
+	require.NoError(t, err)
+	warpRouting := WarpRoutingConfig{
+		Enabled:        true,
+		ConnectTimeout: defaultWarpRoutingConnectTimeout,
+		TCPKeepAlive:   defaultTCPKeepAlive,
+		Overrides: []WarpRoutingOverride{
+			{Network: subnet, ConnectTimeout: config.CustomDuration{Duration: time.Minute}},
+			{Network: network, ConnectTimeout: config.CustomDuration{Duration: time.Second}},
+		},
+	}
+	svc := NewWarpRoutingService(warpRouting).Proxy.(*warpRoutingTCPService)
+
+	tests := map[string]time.Duration{
+		"10.1.2.3:5432":    time.Minute,
+		"10.2.2.3:5432":    time.Second,
+		"192.168.1.1:5432": defaultWarpRoutingConnectTimeout.Duration,
+		"[fd00::1]:5432":   defaultWarpRoutingConnectTimeout.Duration,
+		"localhost:5432":   defaultWarpRoutingConnectTimeout.Duration,
+	}
+	for dest, timeout := range tests {
+		assert.Equal(t, timeout, svc.serviceFor(dest).dialer.Timeout, dest)
+	}
+}
+
 func TestTCPOverWSServiceEstablishConnection(t *testing.T) {
 	originListener, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
@@ -146,6 +177,73 @@ func TestHTTPServiceHostHeaderOverride(t *testing.T) {
 	require.Equal(t, respBody, []byte(originURL.Host))
 }
 
+func TestHTTPServiceSourceAddress(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.RemoteAddr))
+	}))
+	defer origin.Close()
+	originURL, err := url.Parse(origin.URL)
+	require.NoError(t, err)
+
+	roundTrip := func(sourceAddress string) (*http.Response, error) {
+		httpService := &httpService{url: originURL}
+		require.NoError(t, httpService.start(testLogger, make(chan struct{}), OriginRequestConfig{SourceAddress: sourceAddress}))
+		req, err := http.NewRequest(http.MethodGet, originURL.String(), nil)
+		require.NoError(t, err)
+		return httpService.RoundTrip(req)
+	}
+
+	resp, err := roundTrip("127.0.0.1")
+	require.NoError(t, err)
+	respBody, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	host, _, err := net.SplitHostPort(string(respBody))
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", host)
+
+	// The origin can't be dialed from an address of another IP version
+	_, err = roundTrip("::1")
+	assert.Error(t, err)
+}
+
+func TestHTTPServiceTLSVersions(t *testing.T) {
+	origin := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(tls.CipherSuiteName(r.TLS.CipherSuite)))
+	}))
+	// An origin that doesn't support TLS 1.3 yet
+	origin.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	origin.StartTLS()
+	defer origin.Close()
+	originURL, err := url.Parse(origin.URL)
+	require.NoError(t, err)
+
+	roundTrip := func(cfg OriginRequestConfig) (*http.Response, error) {
+		cfg.NoTLSVerify = true
+		httpService := &httpService{url: originURL}
+		require.NoError(t, httpService.start(testLogger, make(chan struct{}), cfg))
+		req, err := http.NewRequest(http.MethodGet, originURL.String(), nil)
+		require.NoError(t, err)
+		return httpService.RoundTrip(req)
+	}
+
+	resp, err := roundTrip(OriginRequestConfig{})
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	_, err = roundTrip(OriginRequestConfig{TLSMinVersion: "1.3"})
+	assert.Error(t, err)
+
+	resp, err = roundTrip(OriginRequestConfig{TLSMaxVersion: "1.2", TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}})
+	require.NoError(t, err)
+	respBody, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", string(respBody))
+
+	// The origin doesn't support the cipher suite, as its certificate is an RSA one
+	_, err = roundTrip(OriginRequestConfig{TLSCipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"}})
+	assert.Error(t, err)
+}
+
 // TestHTTPServiceUsesIngressRuleScheme makes sure httpService uses scheme defined in ingress rule and not by eyeball request
 func TestHTTPServiceUsesIngressRuleScheme(t *testing.T) {
 	handler := func(w http.ResponseWriter, r *http.Request) {
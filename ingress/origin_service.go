@@ -22,6 +22,7 @@ import (
 
 const (
 	HelloWorldService = "hello_world"
+	TLSDebugService   = "tls_debug"
 	HttpStatusService = "http_status"
 )
 
@@ -40,7 +41,7 @@ type OriginService interface {
 type unixSocketPath struct {
 	path      string
 	scheme    string
-	transport *http.Transport
+	transport http.RoundTripper
 }
 
 func (o *unixSocketPath) String() string {
@@ -67,16 +68,22 @@ func (o unixSocketPath) MarshalJSON() ([]byte, error) {
 type httpService struct {
 	url        *url.URL
 	hostHeader string
-	transport  *http.Transport
+	transport  http.RoundTripper
 }
 
-func (o *httpService) start(log *zerolog.Logger, _ <-chan struct{}, cfg OriginRequestConfig) error {
+func (o *httpService) start(log *zerolog.Logger, shutdownC <-chan struct{}, cfg OriginRequestConfig) error {
 	transport, err := newHTTPTransport(o, cfg, log)
 	if err != nil {
 		return err
 	}
+	startWarmPool(transport, o.url, cfg, log, shutdownC)
 	o.hostHeader = cfg.HTTPHostHeader
 	o.transport = transport
+	if cfg.GRPCWeb {
+		if o.transport, err = newGRPCWebTransport(transport, o.url.Scheme == "http", cfg, log, shutdownC); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -93,6 +100,39 @@ func (o httpService) MarshalJSON() ([]byte, error) {
 type rawTCPService struct {
 	name   string
 	dialer net.Dialer
+	// idleTimeout closes connections without traffic for that long, if it's not 0
+	idleTimeout time.Duration
+}
+
+// warpRoutingTCPService dials TCP with the settings of the most specific override matching the destination, or
+// the settings of defaultService
+type warpRoutingTCPService struct {
+	defaultService *rawTCPService
+	overrides      []warpRoutingOverrideService
+}
+
+type warpRoutingOverrideService struct {
+	network *net.IPNet
+	service *rawTCPService
+}
+
+// serviceFor returns the service dialing dest
+func (o *warpRoutingTCPService) serviceFor(dest string) *rawTCPService {
+	host, _, err := net.SplitHostPort(dest)
+	if err != nil {
+		return o.defaultService
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return o.defaultService
+	}
+	service, longestPrefix := o.defaultService, -1
+	for _, override := range o.overrides {
+		if prefix, _ := override.network.Mask.Size(); override.network.Contains(ip) && prefix > longestPrefix {
+			service, longestPrefix = override.service, prefix
+		}
+	}
+	return service
 }
 
 func (o *rawTCPService) String() string {
@@ -115,6 +155,8 @@ type tcpOverWSService struct {
 	isBastion     bool
 	streamHandler streamHandlerFunc
 	dialer        net.Dialer
+	// idleTimeout closes connections without traffic for that long, if it's not 0
+	idleTimeout time.Duration
 }
 
 type socksProxyOverWSService struct {
@@ -173,13 +215,18 @@ func (o *tcpOverWSService) String() string {
 }
 
 func (o *tcpOverWSService) start(log *zerolog.Logger, _ <-chan struct{}, cfg OriginRequestConfig) error {
-	if cfg.ProxyType == socksProxy {
+	switch {
+	case cfg.ProxyType == socksProxy:
 		o.streamHandler = socks.StreamHandler
-	} else {
+	case cfg.TCPHalfClose:
+		o.streamHandler = HalfCloseStreamHandler
+	default:
 		o.streamHandler = DefaultStreamHandler
 	}
 	o.dialer.Timeout = cfg.ConnectTimeout.Duration
 	o.dialer.KeepAlive = cfg.TCPKeepAlive.Duration
+	o.dialer.LocalAddr = cfg.sourceAddr()
+	o.idleTimeout = cfg.TCPIdleTimeout.Duration
 	return nil
 }
 
@@ -220,11 +267,19 @@ func (o *helloWorld) start(
 		return err
 	}
 
+	helloConfig := hello.Config{Latency: cfg.HelloWorldLatency.Duration}
+	if cfg.HelloWorldTemplate != "" {
+		responseTemplate, err := hello.ParseResponseTemplate(cfg.HelloWorldTemplate)
+		if err != nil {
+			return errors.Wrap(err, "Cannot parse the template of the Hello World Server")
+		}
+		helloConfig.ResponseTemplate = responseTemplate
+	}
 	helloListener, err := hello.CreateTLSListener("127.0.0.1:")
 	if err != nil {
 		return errors.Wrap(err, "Cannot start Hello World Server")
 	}
-	go hello.StartHelloWorldServer(log, helloListener, shutdownC)
+	go hello.StartHelloWorldServer(log, helloListener, shutdownC, helloConfig)
 	o.server = helloListener
 
 	o.httpService.url = &url.URL{
@@ -239,6 +294,46 @@ func (o helloWorld) MarshalJSON() ([]byte, error) {
 	return json.Marshal(o.String())
 }
 
+// tlsDebug is an OriginService for the built-in TLS debug server, which responds with the details of the TLS
+// connection to it, including the client certificates cloudflared presented.
+type tlsDebug struct {
+	httpService
+	server net.Listener
+}
+
+func (o *tlsDebug) String() string {
+	return TLSDebugService
+}
+
+// Start starts a TLS debug server and stores its address in the Service receiver.
+func (o *tlsDebug) start(
+	log *zerolog.Logger,
+	shutdownC <-chan struct{},
+	cfg OriginRequestConfig,
+) error {
+	if err := o.httpService.start(log, shutdownC, cfg); err != nil {
+		return err
+	}
+
+	listener, err := hello.CreateTLSDebugListener("127.0.0.1:")
+	if err != nil {
+		return errors.Wrap(err, "Cannot start TLS debug server")
+	}
+	go hello.StartTLSDebugServer(log, listener, shutdownC)
+	o.server = listener
+
+	o.httpService.url = &url.URL{
+		Scheme: "https",
+		Host:   o.server.Addr().String(),
+	}
+
+	return nil
+}
+
+func (o tlsDebug) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.String())
+}
+
 // statusCode is an OriginService that just responds with a given HTTP status.
 // Typical use-case is "user wants the catch-all rule to just respond 404".
 type statusCode struct {
@@ -276,10 +371,12 @@ func (nrc *NopReadCloser) Close() error {
 	return nil
 }
 
-func newHTTPTransport(service OriginService, cfg OriginRequestConfig, log *zerolog.Logger) (*http.Transport, error) {
-	originCertPool, err := tlsconfig.LoadOriginCA(cfg.CAPool, log)
+// newHTTPTransport returns the transport of the requests to service. If originServerName contains variables of the
+// requests, the transport sends each request with the server name they expand to.
+func newHTTPTransport(service OriginService, cfg OriginRequestConfig, log *zerolog.Logger) (http.RoundTripper, error) {
+	tlsConfig, err := originTLSConfig(cfg, log)
 	if err != nil {
-		return nil, errors.Wrap(err, "Error loading cert pool")
+		return nil, err
 	}
 
 	httpTransport := http.Transport{
@@ -288,13 +385,20 @@ func newHTTPTransport(service OriginService, cfg OriginRequestConfig, log *zerol
 		MaxIdleConnsPerHost:   cfg.KeepAliveConnections,
 		IdleConnTimeout:       cfg.KeepAliveTimeout.Duration,
 		TLSHandshakeTimeout:   cfg.TLSTimeout.Duration,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout.Duration,
 		ExpectContinueTimeout: 1 * time.Second,
-		TLSClientConfig:       &tls.Config{RootCAs: originCertPool, InsecureSkipVerify: cfg.NoTLSVerify},
+		TLSClientConfig:       tlsConfig,
 		ForceAttemptHTTP2:     cfg.Http2Origin,
 	}
-	if _, isHelloWorld := service.(*helloWorld); !isHelloWorld && cfg.OriginServerName != "" {
+	_, isHelloWorld := service.(*helloWorld)
+	serverNameTemplate := !isHelloWorld && hasMatchVars(cfg.OriginServerName)
+	if !isHelloWorld && !serverNameTemplate && cfg.OriginServerName != "" {
 		httpTransport.TLSClientConfig.ServerName = cfg.OriginServerName
 	}
+	if isHelloWorld {
+		// The certificate of the hello_world service is issued by cloudflared, and can't be revoked
+		httpTransport.TLSClientConfig.VerifyConnection = nil
+	}
 
 	dialer := &net.Dialer{
 		Timeout:   cfg.ConnectTimeout.Duration,
@@ -314,14 +418,46 @@ func newHTTPTransport(service OriginService, cfg OriginRequestConfig, log *zerol
 			return dialContext(ctx, "unix", service.path)
 		}
 
+	// If this origin is served in-process, connect through its listener.
+	case *listenerService:
+		httpTransport.DialContext = service.listener.DialContext
+		// Connections never leave the process
+		httpTransport.Proxy = nil
+
 	// Otherwise, use the regular network config.
 	default:
+		dialer.LocalAddr = cfg.sourceAddr()
 		httpTransport.DialContext = dialContext
 	}
 
+	if serverNameTemplate {
+		return newServerNameTransports(cfg.OriginServerName, &httpTransport), nil
+	}
 	return &httpTransport, nil
 }
 
+// originTLSConfig returns the TLS config of the connections to the origin, without their server name
+func originTLSConfig(cfg OriginRequestConfig, log *zerolog.Logger) (*tls.Config, error) {
+	originCertPool, err := tlsconfig.LoadOriginCA(cfg.CAPool, log)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error loading cert pool")
+	}
+	tlsConfig := &tls.Config{RootCAs: originCertPool, InsecureSkipVerify: cfg.NoTLSVerify}
+	if tlsConfig.MinVersion, err = tlsconfig.ParseTLSVersion(cfg.TLSMinVersion); err != nil {
+		return nil, err
+	}
+	if tlsConfig.MaxVersion, err = tlsconfig.ParseTLSVersion(cfg.TLSMaxVersion); err != nil {
+		return nil, err
+	}
+	if tlsConfig.CipherSuites, err = tlsconfig.ParseCipherSuites(cfg.TLSCipherSuites); err != nil {
+		return nil, err
+	}
+	if cfg.RevocationCheck != "" {
+		tlsConfig.VerifyConnection = newRevocationChecker(cfg, log).verifyConnection
+	}
+	return tlsConfig, nil
+}
+
 // MockOriginHTTPService should only be used by other packages to mock OriginService. Set Transport to configure desired RoundTripper behavior.
 type MockOriginHTTPService struct {
 	Transport http.RoundTripper
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"net"
+
+	"github.com/cloudflare/cloudflared/iouring"
 )
 
 type UDPProxy interface {
@@ -30,3 +32,15 @@ func DialUDP(dstIP net.IP, dstPort uint16) (UDPProxy, error) {
 
 	return &udpProxy{udpConn}, nil
 }
+
+// DialUDPRing is DialUDP with the reads and writes of the socket going through ring
+func DialUDPRing(ring *iouring.Ring, dstIP net.IP, dstPort uint16) (UDPProxy, error) {
+	udpConn, err := ring.DialUDP(&net.UDPAddr{
+		IP:   dstIP,
+		Port: int(dstPort),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create UDP proxy to origin (%v:%v): %w", dstIP, dstPort, err)
+	}
+	return udpConn, nil
+}
@@ -0,0 +1,237 @@
+package ingress
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/ocsp"
+)
+
+// Values of revocationCheck
+const (
+	// RevocationCheckStapled requires the origin to staple an OCSP response to its certificate
+	RevocationCheckStapled = "stapled"
+	// RevocationCheckOCSP uses the OCSP response stapled by the origin, or queries the OCSP responder of its certificate
+	RevocationCheckOCSP = "ocsp"
+	// RevocationCheckCRL downloads the CRLs of the certificate of the origin
+	RevocationCheckCRL = "crl"
+)
+
+const (
+	revocationFetchTimeout = 10 * time.Second
+	// maxRevocationResponseSize bounds the size of the OCSP responses and CRLs that are downloaded
+	maxRevocationResponseSize = 10 * 1024 * 1024
+)
+
+var errCertificateRevoked = errors.New("the certificate of the origin is revoked")
+
+// revocationChecker checks that the certificate of the origin isn't revoked after it was verified, according to
+// revocationCheck. The OCSP responses and CRLs that are downloaded are cached until their next update.
+type revocationChecker struct {
+	mode     string
+	softFail bool
+	client   *http.Client
+	log      *zerolog.Logger
+	now      func() time.Time
+
+	lock      sync.Mutex
+	responses map[[sha256.Size]byte]*ocsp.Response
+	crls      map[string]*pkix.CertificateList
+}
+
+func newRevocationChecker(cfg OriginRequestConfig, log *zerolog.Logger) *revocationChecker {
+	return &revocationChecker{
+		mode:     cfg.RevocationCheck,
+		softFail: cfg.RevocationSoftFail,
+		client: &http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+			Timeout:   revocationFetchTimeout,
+		},
+		log:       log,
+		now:       time.Now,
+		responses: make(map[[sha256.Size]byte]*ocsp.Response),
+		crls:      make(map[string]*pkix.CertificateList),
+	}
+}
+
+// verifyConnection is the VerifyConnection of the TLS config of the origin. A revoked certificate always fails the
+// handshake, a certificate whose revocation can't be checked only fails it without revocationSoftFail.
+func (c *revocationChecker) verifyConnection(cs tls.ConnectionState) error {
+	// The chains are only verified without noTLSVerify, and self-signed certificates can't be revoked
+	if len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) < 2 {
+		return nil
+	}
+	leaf, issuer := cs.VerifiedChains[0][0], cs.VerifiedChains[0][1]
+	err := c.check(cs, leaf, issuer)
+	if err == nil || err == errCertificateRevoked {
+		return err
+	}
+	err = errors.Wrap(err, "failed to check the revocation of the certificate of the origin")
+	if c.softFail {
+		c.log.Warn().Err(err).Str("serverName", cs.ServerName).Msg("Trusting the certificate of the origin, since revocationSoftFail is set")
+		return nil
+	}
+	return err
+}
+
+func (c *revocationChecker) check(cs tls.ConnectionState, leaf, issuer *x509.Certificate) error {
+	switch c.mode {
+	case RevocationCheckStapled:
+		if len(cs.OCSPResponse) == 0 {
+			return errors.New("the origin didn't staple an OCSP response to its certificate")
+		}
+		return c.checkOCSPResponse(cs.OCSPResponse, leaf, issuer)
+	case RevocationCheckOCSP:
+		if len(cs.OCSPResponse) > 0 {
+			return c.checkOCSPResponse(cs.OCSPResponse, leaf, issuer)
+		}
+		return c.queryOCSP(leaf, issuer)
+	case RevocationCheckCRL:
+		return c.checkCRLs(leaf, issuer)
+	default:
+		return nil
+	}
+}
+
+func (c *revocationChecker) checkOCSPResponse(raw []byte, leaf, issuer *x509.Certificate) error {
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return errors.Wrap(err, "invalid OCSP response")
+	}
+	return c.ocspStatus(resp)
+}
+
+func (c *revocationChecker) ocspStatus(resp *ocsp.Response) error {
+	if !resp.NextUpdate.IsZero() && c.now().After(resp.NextUpdate) {
+		return fmt.Errorf("the OCSP response expired at %s", resp.NextUpdate.Format(time.RFC3339))
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return errCertificateRevoked
+	default:
+		return errors.New("the OCSP responder doesn't know the certificate")
+	}
+}
+
+func (c *revocationChecker) queryOCSP(leaf, issuer *x509.Certificate) error {
+	key := sha256.Sum256(leaf.Raw)
+	c.lock.Lock()
+	cached, ok := c.responses[key]
+	c.lock.Unlock()
+	if ok && c.now().Before(cached.NextUpdate) {
+		return c.ocspStatus(cached)
+	}
+
+	if len(leaf.OCSPServer) == 0 {
+		return errors.New("the certificate has no OCSP responder")
+	}
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, server := range leaf.OCSPServer {
+		raw, err := c.fetch(http.MethodPost, server, "application/ocsp-request", req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+		if err != nil {
+			lastErr = errors.Wrapf(err, "invalid OCSP response from %s", server)
+			continue
+		}
+		if !resp.NextUpdate.IsZero() {
+			c.lock.Lock()
+			c.responses[key] = resp
+			c.lock.Unlock()
+		}
+		return c.ocspStatus(resp)
+	}
+	return lastErr
+}
+
+func (c *revocationChecker) checkCRLs(leaf, issuer *x509.Certificate) error {
+	var lastErr error
+	for _, url := range leaf.CRLDistributionPoints {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			continue
+		}
+		crl, err := c.crl(url, issuer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, revoked := range crl.TBSCertList.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+				return errCertificateRevoked
+			}
+		}
+		return nil
+	}
+	if lastErr == nil {
+		return errors.New("the certificate has no CRL distribution point over HTTP")
+	}
+	return lastErr
+}
+
+// crl returns the CRL at url signed by issuer, from the cache until its next update
+func (c *revocationChecker) crl(url string, issuer *x509.Certificate) (*pkix.CertificateList, error) {
+	c.lock.Lock()
+	cached, ok := c.crls[url]
+	c.lock.Unlock()
+	if ok && !cached.HasExpired(c.now()) {
+		return cached, nil
+	}
+
+	raw, err := c.fetch(http.MethodGet, url, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	crl, err := x509.ParseCRL(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid CRL at %s", url)
+	}
+	if err := issuer.CheckCRLSignature(crl); err != nil {
+		return nil, errors.Wrapf(err, "the CRL at %s isn't signed by the issuer of the certificate", url)
+	}
+	if crl.HasExpired(c.now()) {
+		return nil, fmt.Errorf("the CRL at %s expired at %s", url, crl.TBSCertList.NextUpdate.Format(time.RFC3339))
+	}
+	c.lock.Lock()
+	c.crls[url] = crl
+	c.lock.Unlock()
+	return crl, nil
+}
+
+func (c *revocationChecker) fetch(method, url, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status code %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRevocationResponseSize))
+}
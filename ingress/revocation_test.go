@@ -0,0 +1,195 @@
+package ingress
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64, ocspServer, crlURL string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "origin.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if ocspServer != "" {
+		template.OCSPServer = []string{ocspServer}
+	}
+	if crlURL != "" {
+		template.CRLDistributionPoints = []string{crlURL}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func (ca *testCA) ocspResponse(t *testing.T, cert *x509.Certificate, status int) []byte {
+	resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+		Status:       status,
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, ca.key)
+	require.NoError(t, err)
+	return resp
+}
+
+func (ca *testCA) crl(t *testing.T, revoked ...*x509.Certificate) []byte {
+	var revokedCerts []pkix.RevokedCertificate
+	for _, cert := range revoked {
+		revokedCerts = append(revokedCerts, pkix.RevokedCertificate{SerialNumber: cert.SerialNumber, RevocationTime: time.Now()})
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(1),
+		ThisUpdate:          time.Now().Add(-time.Minute),
+		NextUpdate:          time.Now().Add(time.Hour),
+		RevokedCertificates: revokedCerts,
+	}, ca.cert, ca.key)
+	require.NoError(t, err)
+	return crl
+}
+
+func connectionState(cert *x509.Certificate, ca *testCA, staple []byte) tls.ConnectionState {
+	return tls.ConnectionState{
+		ServerName:     "origin.example.com",
+		VerifiedChains: [][]*x509.Certificate{{cert, ca.cert}},
+		OCSPResponse:   staple,
+	}
+}
+
+func TestRevocationCheckStapled(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, 2, "", "")
+	checker := newRevocationChecker(OriginRequestConfig{RevocationCheck: RevocationCheckStapled}, testLogger)
+
+	assert.NoError(t, checker.verifyConnection(connectionState(cert, ca, ca.ocspResponse(t, cert, ocsp.Good))))
+	assert.Equal(t, errCertificateRevoked, checker.verifyConnection(connectionState(cert, ca, ca.ocspResponse(t, cert, ocsp.Revoked))))
+	assert.Error(t, checker.verifyConnection(connectionState(cert, ca, nil)))
+
+	// A response signed by another CA isn't trusted
+	otherCA := newTestCA(t)
+	assert.Error(t, checker.verifyConnection(connectionState(cert, ca, otherCA.ocspResponse(t, cert, ocsp.Good))))
+
+	checker.softFail = true
+	assert.NoError(t, checker.verifyConnection(connectionState(cert, ca, nil)))
+	assert.Equal(t, errCertificateRevoked, checker.verifyConnection(connectionState(cert, ca, ca.ocspResponse(t, cert, ocsp.Revoked))))
+
+	// Connections without verified chains, with noTLSVerify, aren't checked
+	assert.NoError(t, checker.verifyConnection(tls.ConnectionState{}))
+}
+
+func TestRevocationCheckOCSP(t *testing.T) {
+	ca := newTestCA(t)
+	var queries int32
+	revokedSerial := big.NewInt(3)
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		assert.Equal(t, "application/ocsp-request", r.Header.Get("Content-Type"))
+		status := ocsp.Good
+		if r.URL.Path == "/revoked" {
+			status = ocsp.Revoked
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+			Status:       status,
+			SerialNumber: revokedSerial,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, ca.key)
+		require.NoError(t, err)
+		_, _ = w.Write(resp)
+	}))
+	defer responder.Close()
+
+	checker := newRevocationChecker(OriginRequestConfig{RevocationCheck: RevocationCheckOCSP}, testLogger)
+	good := ca.issue(t, 3, responder.URL+"/good", "")
+	assert.NoError(t, checker.verifyConnection(connectionState(good, ca, nil)))
+	// The response is cached until its next update
+	assert.NoError(t, checker.verifyConnection(connectionState(good, ca, nil)))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&queries))
+
+	revoked := ca.issue(t, 3, responder.URL+"/revoked", "")
+	assert.Equal(t, errCertificateRevoked, checker.verifyConnection(connectionState(revoked, ca, nil)))
+
+	// The stapled response is used instead of querying the responder
+	assert.NoError(t, checker.verifyConnection(connectionState(revoked, ca, ca.ocspResponse(t, revoked, ocsp.Good))))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&queries))
+
+	unreachable := ca.issue(t, 4, "http://127.0.0.1:1/", "")
+	assert.Error(t, checker.verifyConnection(connectionState(unreachable, ca, nil)))
+	checker.softFail = true
+	assert.NoError(t, checker.verifyConnection(connectionState(unreachable, ca, nil)))
+}
+
+func TestRevocationCheckCRL(t *testing.T) {
+	ca := newTestCA(t)
+	revoked := ca.issue(t, 5, "", "")
+	var downloads int32
+	crl := ca.crl(t, revoked)
+	distributionPoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		_, _ = w.Write(crl)
+	}))
+	defer distributionPoint.Close()
+
+	checker := newRevocationChecker(OriginRequestConfig{RevocationCheck: RevocationCheckCRL}, testLogger)
+	good := ca.issue(t, 6, "", distributionPoint.URL)
+	assert.NoError(t, checker.verifyConnection(connectionState(good, ca, nil)))
+	revoked = ca.issue(t, 5, "", distributionPoint.URL)
+	assert.Equal(t, errCertificateRevoked, checker.verifyConnection(connectionState(revoked, ca, nil)))
+	// The CRL is cached until its next update
+	assert.Equal(t, int32(1), atomic.LoadInt32(&downloads))
+
+	// Certificates without distribution point can't be checked
+	assert.Error(t, checker.verifyConnection(connectionState(ca.issue(t, 7, "", ""), ca, nil)))
+
+	// A CRL signed by another CA isn't trusted
+	otherCA := newTestCA(t)
+	crl = otherCA.crl(t)
+	checker = newRevocationChecker(OriginRequestConfig{RevocationCheck: RevocationCheckCRL}, testLogger)
+	assert.Error(t, checker.verifyConnection(connectionState(good, ca, nil)))
+}
@@ -182,25 +182,25 @@ func TestMarshalJSON(t *testing.T) {
 		{
 			name:     "Nil",
 			path:     nil,
-			expected: `{"hostname":"example.com","path":null,"service":"https://localhost:8000","originRequest":{"connectTimeout":30,"tlsTimeout":10,"tcpKeepAlive":30,"noHappyEyeballs":false,"keepAliveTimeout":90,"keepAliveConnections":100,"httpHostHeader":"","originServerName":"","caPool":"","noTLSVerify":false,"disableChunkedEncoding":false,"bastionMode":false,"proxyAddress":"127.0.0.1","proxyPort":0,"proxyType":"","ipRules":null,"http2Origin":false}}`,
+			expected: `{"hostname":"example.com","path":null,"service":"https://localhost:8000","originRequest":{"connectTimeout":30,"tlsTimeout":10,"tcpKeepAlive":30,"noHappyEyeballs":false,"keepAliveTimeout":90,"keepAliveConnections":100,"httpHostHeader":"","originServerName":"","caPool":"","noTLSVerify":false,"disableChunkedEncoding":false,"bastionMode":false,"proxyAddress":"127.0.0.1","proxyPort":0,"proxyType":"","ipRules":null,"http2Origin":false,"webSocketPingInterval":0,"webSocketPongTimeout":0,"webSocketMaxMessageSize":0,"disableWebSocketCompression":false,"maxConcurrentStreams":0,"helloWorldTemplate":"","helloWorldLatency":0,"responseHeaderTimeout":0,"requestTimeout":0,"tcpIdleTimeout":0,"tcpHalfClose":false,"slowOriginThreshold":0,"slowOriginPendingRequests":0,"grpcWeb":false,"disableResponseBuffering":false,"flushInterval":0,"streamTimeout":0,"sourceAddress":"","httpsRedirect":false,"hstsMaxAge":0,"hstsIncludeSubdomains":false,"maintenanceStatus":0,"maintenancePage":"","disableAccessLog":false,"accessLogFields":null,"warmConnections":0,"revocationCheck":"","revocationSoftFail":false,"tlsMinVersion":"","tlsMaxVersion":"","tlsCipherSuites":null,"forwardClientCert":false,"healthPath":""}}`,
 			want:     true,
 		},
 		{
 			name:     "Nil regex",
 			path:     &Regexp{Regexp: nil},
-			expected: `{"hostname":"example.com","path":null,"service":"https://localhost:8000","originRequest":{"connectTimeout":30,"tlsTimeout":10,"tcpKeepAlive":30,"noHappyEyeballs":false,"keepAliveTimeout":90,"keepAliveConnections":100,"httpHostHeader":"","originServerName":"","caPool":"","noTLSVerify":false,"disableChunkedEncoding":false,"bastionMode":false,"proxyAddress":"127.0.0.1","proxyPort":0,"proxyType":"","ipRules":null,"http2Origin":false}}`,
+			expected: `{"hostname":"example.com","path":null,"service":"https://localhost:8000","originRequest":{"connectTimeout":30,"tlsTimeout":10,"tcpKeepAlive":30,"noHappyEyeballs":false,"keepAliveTimeout":90,"keepAliveConnections":100,"httpHostHeader":"","originServerName":"","caPool":"","noTLSVerify":false,"disableChunkedEncoding":false,"bastionMode":false,"proxyAddress":"127.0.0.1","proxyPort":0,"proxyType":"","ipRules":null,"http2Origin":false,"webSocketPingInterval":0,"webSocketPongTimeout":0,"webSocketMaxMessageSize":0,"disableWebSocketCompression":false,"maxConcurrentStreams":0,"helloWorldTemplate":"","helloWorldLatency":0,"responseHeaderTimeout":0,"requestTimeout":0,"tcpIdleTimeout":0,"tcpHalfClose":false,"slowOriginThreshold":0,"slowOriginPendingRequests":0,"grpcWeb":false,"disableResponseBuffering":false,"flushInterval":0,"streamTimeout":0,"sourceAddress":"","httpsRedirect":false,"hstsMaxAge":0,"hstsIncludeSubdomains":false,"maintenanceStatus":0,"maintenancePage":"","disableAccessLog":false,"accessLogFields":null,"warmConnections":0,"revocationCheck":"","revocationSoftFail":false,"tlsMinVersion":"","tlsMaxVersion":"","tlsCipherSuites":null,"forwardClientCert":false,"healthPath":""}}`,
 			want:     true,
 		},
 		{
 			name:     "Empty",
 			path:     &Regexp{Regexp: regexp.MustCompile("")},
-			expected: `{"hostname":"example.com","path":"","service":"https://localhost:8000","originRequest":{"connectTimeout":30,"tlsTimeout":10,"tcpKeepAlive":30,"noHappyEyeballs":false,"keepAliveTimeout":90,"keepAliveConnections":100,"httpHostHeader":"","originServerName":"","caPool":"","noTLSVerify":false,"disableChunkedEncoding":false,"bastionMode":false,"proxyAddress":"127.0.0.1","proxyPort":0,"proxyType":"","ipRules":null,"http2Origin":false}}`,
+			expected: `{"hostname":"example.com","path":"","service":"https://localhost:8000","originRequest":{"connectTimeout":30,"tlsTimeout":10,"tcpKeepAlive":30,"noHappyEyeballs":false,"keepAliveTimeout":90,"keepAliveConnections":100,"httpHostHeader":"","originServerName":"","caPool":"","noTLSVerify":false,"disableChunkedEncoding":false,"bastionMode":false,"proxyAddress":"127.0.0.1","proxyPort":0,"proxyType":"","ipRules":null,"http2Origin":false,"webSocketPingInterval":0,"webSocketPongTimeout":0,"webSocketMaxMessageSize":0,"disableWebSocketCompression":false,"maxConcurrentStreams":0,"helloWorldTemplate":"","helloWorldLatency":0,"responseHeaderTimeout":0,"requestTimeout":0,"tcpIdleTimeout":0,"tcpHalfClose":false,"slowOriginThreshold":0,"slowOriginPendingRequests":0,"grpcWeb":false,"disableResponseBuffering":false,"flushInterval":0,"streamTimeout":0,"sourceAddress":"","httpsRedirect":false,"hstsMaxAge":0,"hstsIncludeSubdomains":false,"maintenanceStatus":0,"maintenancePage":"","disableAccessLog":false,"accessLogFields":null,"warmConnections":0,"revocationCheck":"","revocationSoftFail":false,"tlsMinVersion":"","tlsMaxVersion":"","tlsCipherSuites":null,"forwardClientCert":false,"healthPath":""}}`,
 			want:     true,
 		},
 		{
 			name:     "Basic",
 			path:     &Regexp{Regexp: regexp.MustCompile("/echo")},
-			expected: `{"hostname":"example.com","path":"/echo","service":"https://localhost:8000","originRequest":{"connectTimeout":30,"tlsTimeout":10,"tcpKeepAlive":30,"noHappyEyeballs":false,"keepAliveTimeout":90,"keepAliveConnections":100,"httpHostHeader":"","originServerName":"","caPool":"","noTLSVerify":false,"disableChunkedEncoding":false,"bastionMode":false,"proxyAddress":"127.0.0.1","proxyPort":0,"proxyType":"","ipRules":null,"http2Origin":false}}`,
+			expected: `{"hostname":"example.com","path":"/echo","service":"https://localhost:8000","originRequest":{"connectTimeout":30,"tlsTimeout":10,"tcpKeepAlive":30,"noHappyEyeballs":false,"keepAliveTimeout":90,"keepAliveConnections":100,"httpHostHeader":"","originServerName":"","caPool":"","noTLSVerify":false,"disableChunkedEncoding":false,"bastionMode":false,"proxyAddress":"127.0.0.1","proxyPort":0,"proxyType":"","ipRules":null,"http2Origin":false,"webSocketPingInterval":0,"webSocketPongTimeout":0,"webSocketMaxMessageSize":0,"disableWebSocketCompression":false,"maxConcurrentStreams":0,"helloWorldTemplate":"","helloWorldLatency":0,"responseHeaderTimeout":0,"requestTimeout":0,"tcpIdleTimeout":0,"tcpHalfClose":false,"slowOriginThreshold":0,"slowOriginPendingRequests":0,"grpcWeb":false,"disableResponseBuffering":false,"flushInterval":0,"streamTimeout":0,"sourceAddress":"","httpsRedirect":false,"hstsMaxAge":0,"hstsIncludeSubdomains":false,"maintenanceStatus":0,"maintenancePage":"","disableAccessLog":false,"accessLogFields":null,"warmConnections":0,"revocationCheck":"","revocationSoftFail":false,"tlsMinVersion":"","tlsMaxVersion":"","tlsCipherSuites":null,"forwardClientCert":false,"healthPath":""}}`,
 			want:     true,
 		},
 	}
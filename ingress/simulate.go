@@ -0,0 +1,45 @@
+package ingress
+
+import (
+	"net/http"
+)
+
+// SimulatedRequest is how cloudflared proxies a request, as computed without starting the origins
+type SimulatedRequest struct {
+	// RuleIndex is the index of the rule the request matched
+	RuleIndex int
+	// OriginRequest is the request sent to the origin after its rewrites, or nil if the service of the rule isn't an
+	// HTTP origin
+	OriginRequest *http.Request
+	// ServerName is the TLS server name of the connection to the origin, or empty if it isn't over TLS
+	ServerName string
+}
+
+// Simulate returns how req is proxied to the origin of the rule it matches. It's meant to debug the rules offline, the
+// origins don't need to be started.
+func (ing Ingress) Simulate(req *http.Request) SimulatedRequest {
+	rule, i := ing.FindMatchingRule(req.Host, req.URL.Path)
+	simulated := SimulatedRequest{RuleIndex: i}
+	ctx := req.Context()
+	if rule.Config.UsesMatchVars() {
+		ctx = WithMatchVars(ctx, rule.MatchVars(req.Host, req.URL.Path))
+	}
+	originReq := req.Clone(ctx)
+
+	switch service := rule.Service.(type) {
+	case *httpService:
+		service.rewrite(originReq, rule.Config.HTTPHostHeader)
+	case *unixSocketPath:
+		originReq.URL.Scheme = service.scheme
+	default:
+		return simulated
+	}
+	simulated.OriginRequest = originReq
+	if originReq.URL.Scheme == "https" {
+		simulated.ServerName = originReq.URL.Hostname()
+		if rule.Config.OriginServerName != "" {
+			simulated.ServerName = expandMatchVars(rule.Config.OriginServerName, originReq)
+		}
+	}
+	return simulated
+}
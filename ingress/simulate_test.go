@@ -0,0 +1,64 @@
+package ingress
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+func TestSimulate(t *testing.T) {
+	hostHeader := "${1}.internal"
+	serverName := "${1}.origin.internal"
+	ing, err := ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Hostname:      "*.example.com",
+				Path:          "^/api/",
+				Service:       "https://localhost:8443",
+				OriginRequest: config.OriginRequestConfig{HTTPHostHeader: &hostHeader, OriginServerName: &serverName},
+			},
+			{Hostname: "sock.example.com", Service: "unix+tls:/tmp/origin.sock"},
+			{Hostname: "ssh.example.com", Service: "ssh://localhost:22"},
+			{Service: "http://localhost:8000"},
+		},
+	})
+	require.NoError(t, err)
+
+	simulate := func(url string) SimulatedRequest {
+		req, err := http.NewRequest(http.MethodPost, url, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Test", "1")
+		return ing.Simulate(req)
+	}
+
+	simulated := simulate("http://app.example.com/api/users?page=2")
+	assert.Equal(t, 0, simulated.RuleIndex)
+	require.NotNil(t, simulated.OriginRequest)
+	assert.Equal(t, http.MethodPost, simulated.OriginRequest.Method)
+	assert.Equal(t, "https://localhost:8443/api/users?page=2", simulated.OriginRequest.URL.String())
+	assert.Equal(t, "app.internal", simulated.OriginRequest.Host)
+	assert.Equal(t, "app.example.com", simulated.OriginRequest.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "1", simulated.OriginRequest.Header.Get("X-Test"))
+	assert.Equal(t, "app.origin.internal", simulated.ServerName)
+
+	simulated = simulate("http://sock.example.com/")
+	assert.Equal(t, 1, simulated.RuleIndex)
+	require.NotNil(t, simulated.OriginRequest)
+	assert.Equal(t, "https://sock.example.com/", simulated.OriginRequest.URL.String())
+	assert.Equal(t, "sock.example.com", simulated.ServerName)
+
+	simulated = simulate("http://ssh.example.com/")
+	assert.Equal(t, 2, simulated.RuleIndex)
+	assert.Nil(t, simulated.OriginRequest)
+
+	simulated = simulate("http://other.example.org/api/users")
+	assert.Equal(t, 3, simulated.RuleIndex)
+	require.NotNil(t, simulated.OriginRequest)
+	assert.Equal(t, "http://localhost:8000/api/users", simulated.OriginRequest.URL.String())
+	assert.Equal(t, "other.example.org", simulated.OriginRequest.Host)
+	assert.Empty(t, simulated.ServerName)
+}
@@ -0,0 +1,276 @@
+package ingress
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+// Kinds of origin services, to check which settings of originRequest apply to them
+type serviceKind int
+
+const (
+	httpOrigin serviceKind = iota
+	httpsOrigin
+	tcpOrigin
+	statusCodeOrigin
+	helloWorldOrigin
+	socksOrigin
+	bastionOrigin
+)
+
+var (
+	// Schemes of URL services, other schemes are proxied as TCP
+	knownSchemes = []string{"http", "https", "ws", "wss", "tcp", "ssh", "rdp", "smb"}
+	// Services that aren't URLs
+	namedServices = []string{HelloWorldService, TLSDebugService, ServiceBastion, ServiceSocksProxy, "http_status:404"}
+)
+
+// RuleProblem is a problem of an ingress rule found by ValidateRules
+type RuleProblem struct {
+	// Index of the rule
+	Index int
+	// Field is the path of the value with the problem in the rule, e.g. service or originRequest, noTLSVerify
+	Field []string
+	// Message describes the problem
+	Message string
+	// Suggestion tells how to fix the problem, when there's an obvious fix
+	Suggestion string
+	Warning    bool
+}
+
+// ValidateRules checks all the ingress rules of conf, unlike ParseIngress which stops at the first invalid rule.
+// Besides the errors of ParseIngress, it warns about schemes of services cloudflared doesn't know, and settings of the
+// originRequest of rules that don't apply to their service.
+func ValidateRules(conf *config.Configuration) []RuleProblem {
+	var problems []RuleProblem
+	defaults := originRequestFromConfig(conf.OriginRequest)
+	for i, r := range conf.Ingress {
+		cfg := setConfig(defaults, r.OriginRequest)
+		if _, err := parseService(r, &cfg); err != nil {
+			problems = append(problems, RuleProblem{Index: i, Field: []string{"service"}, Message: err.Error(), Suggestion: serviceSuggestion(r.Service)})
+		} else if problem := checkScheme(r.Service); problem != "" {
+			problems = append(problems, RuleProblem{Index: i, Field: []string{"service"}, Message: problem, Suggestion: serviceSuggestion(r.Service), Warning: true})
+		}
+
+		if err := validateHostname(r, i, len(conf.Ingress)); err != nil {
+			problem := RuleProblem{Index: i, Field: []string{"hostname"}, Message: err.Error()}
+			switch err {
+			case errLastRuleNotCatchAll:
+				problem.Suggestion = "add a last rule without hostname and path, e.g. \"- service: http_status:404\""
+			case errHostnameContainsPort:
+				problem.Suggestion = "set the port in the service instead"
+			}
+			if _, ok := err.(errRuleShouldNotBeCatchAll); ok {
+				problem.Suggestion = "move the rule to the end of the ingress rules"
+			}
+			problems = append(problems, problem)
+		}
+
+		if _, err := parsePath(r, i); err != nil {
+			problems = append(problems, RuleProblem{Index: i, Field: []string{"path"}, Message: err.Error()})
+		}
+
+		if err := validateSourceAddress(cfg, i); err != nil {
+			problems = append(problems, RuleProblem{Index: i, Field: []string{"originRequest", "sourceAddress"}, Message: err.Error()})
+		}
+
+		if err := validateMaintenanceStatus(cfg, i); err != nil {
+			problems = append(problems, RuleProblem{Index: i, Field: []string{"originRequest", "maintenanceStatus"}, Message: err.Error()})
+		}
+
+		if err := validateAccessLogFields(cfg, i); err != nil {
+			problems = append(problems, RuleProblem{Index: i, Field: []string{"originRequest", "accessLogFields"}, Message: err.Error()})
+		}
+
+		if err := validateRevocationCheck(cfg, i); err != nil {
+			problems = append(problems, RuleProblem{Index: i, Field: []string{"originRequest", "revocationCheck"}, Message: err.Error()})
+		}
+
+		if err := validateTLSVersion(cfg.TLSMinVersion, "tlsMinVersion", i); err != nil {
+			problems = append(problems, RuleProblem{Index: i, Field: []string{"originRequest", "tlsMinVersion"}, Message: err.Error()})
+		}
+
+		if err := validateTLSVersion(cfg.TLSMaxVersion, "tlsMaxVersion", i); err != nil {
+			problems = append(problems, RuleProblem{Index: i, Field: []string{"originRequest", "tlsMaxVersion"}, Message: err.Error()})
+		}
+
+		if err := validateTLSVersionRange(cfg, i); err != nil {
+			problems = append(problems, RuleProblem{Index: i, Field: []string{"originRequest", "tlsMaxVersion"}, Message: err.Error()})
+		}
+
+		if err := validateTLSCipherSuites(cfg, i); err != nil {
+			problems = append(problems, RuleProblem{Index: i, Field: []string{"originRequest", "tlsCipherSuites"}, Message: err.Error()})
+		}
+
+		if err := validateHealthPath(cfg, i); err != nil {
+			problems = append(problems, RuleProblem{Index: i, Field: []string{"originRequest", "healthPath"}, Message: err.Error()})
+		}
+
+		for _, problem := range checkOriginRequest(r) {
+			problem.Index = i
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+func kindOfService(r config.UnvalidatedIngressRule) serviceKind {
+	service := r.Service
+	switch {
+	case r.OriginRequest.BastionMode != nil && *r.OriginRequest.BastionMode, service == ServiceBastion:
+		return bastionOrigin
+	case service == ServiceSocksProxy:
+		return socksOrigin
+	case strings.HasPrefix(service, "http_status:"):
+		return statusCodeOrigin
+	case service == HelloWorldService || service == "hello-world" || service == "helloworld":
+		return helloWorldOrigin
+	case service == TLSDebugService, strings.HasPrefix(service, "unix+tls:"), strings.HasPrefix(service, "consul+tls:"),
+		strings.HasPrefix(service, "etcd+tls:"), strings.HasPrefix(service, "srv+https://"):
+		return httpsOrigin
+	case strings.HasPrefix(service, "unix:"), isDiscoveredService(service):
+		return httpOrigin
+	}
+	u, err := url.Parse(service)
+	if err != nil {
+		return tcpOrigin
+	}
+	switch u.Scheme {
+	case "https", "wss":
+		return httpsOrigin
+	case "http", "ws":
+		return httpOrigin
+	}
+	return tcpOrigin
+}
+
+// checkScheme returns a problem if service is a URL with a scheme cloudflared doesn't know
+func checkScheme(service string) string {
+	if kindOfService(config.UnvalidatedIngressRule{Service: service}) != tcpOrigin {
+		return ""
+	}
+	u, err := url.Parse(service)
+	if err != nil || u.Scheme == "" {
+		return ""
+	}
+	for _, scheme := range knownSchemes {
+		if u.Scheme == scheme {
+			return ""
+		}
+	}
+	return fmt.Sprintf("unknown scheme %q, the service will be proxied as TCP", u.Scheme)
+}
+
+// serviceSuggestion suggests a valid service close to service, if any
+func serviceSuggestion(service string) string {
+	if scheme, rest, ok := strings.Cut(service, "://"); ok {
+		if match := config.ClosestMatch(scheme, knownSchemes); match != "" && match != scheme {
+			return fmt.Sprintf("did you mean %q?", match+"://"+rest)
+		}
+		return ""
+	}
+	if match := config.ClosestMatch(service, namedServices); match != "" && match != service {
+		return fmt.Sprintf("did you mean %q?", match)
+	}
+	if u, err := url.Parse("http://" + service); err == nil && u.Hostname() != "" && u.Path == "" {
+		return fmt.Sprintf("did you mean %q?", "http://"+service)
+	}
+	return ""
+}
+
+// checkOriginRequest warns about the settings of the originRequest of r that don't apply to its service
+func checkOriginRequest(r config.UnvalidatedIngressRule) []RuleProblem {
+	kind := kindOfService(r)
+	settings := r.OriginRequest
+	var problems []RuleProblem
+	ignored := func(isSet bool, key, reason string) {
+		if isSet {
+			problems = append(problems, RuleProblem{
+				Field:   []string{"originRequest", key},
+				Message: fmt.Sprintf("%s is ignored, %s", key, reason),
+				Warning: true,
+			})
+		}
+	}
+
+	if kind != httpsOrigin && kind != helloWorldOrigin {
+		reason := "the service of the rule doesn't use TLS"
+		ignored(settings.NoTLSVerify != nil, "noTLSVerify", reason)
+		ignored(settings.OriginServerName != nil, "originServerName", reason)
+		ignored(settings.CAPool != nil, "caPool", reason)
+		ignored(settings.TLSTimeout != nil, "tlsTimeout", reason)
+		ignored(settings.RevocationCheck != nil, "revocationCheck", reason)
+		ignored(settings.TLSMinVersion != nil, "tlsMinVersion", reason)
+		ignored(settings.TLSMaxVersion != nil, "tlsMaxVersion", reason)
+		ignored(len(settings.TLSCipherSuites) > 0, "tlsCipherSuites", reason)
+		ignored(settings.Http2Origin != nil && *settings.Http2Origin, "http2Origin", "HTTP/2 is only used with origins over TLS")
+	}
+	if kind != httpOrigin && kind != httpsOrigin && kind != helloWorldOrigin {
+		reason := "the service of the rule isn't an HTTP origin"
+		ignored(settings.HTTPHostHeader != nil, "httpHostHeader", reason)
+		ignored(settings.DisableChunkedEncoding != nil, "disableChunkedEncoding", reason)
+		ignored(settings.KeepAliveConnections != nil, "keepAliveConnections", reason)
+		ignored(settings.KeepAliveTimeout != nil, "keepAliveTimeout", reason)
+		ignored(settings.WebSocketPingInterval != nil, "webSocketPingInterval", reason)
+		ignored(settings.WebSocketPongTimeout != nil, "webSocketPongTimeout", reason)
+		ignored(settings.WebSocketMaxMessageSize != nil, "webSocketMaxMessageSize", reason)
+		ignored(settings.DisableWebSocketCompression != nil, "disableWebSocketCompression", reason)
+		ignored(settings.ResponseHeaderTimeout != nil, "responseHeaderTimeout", reason)
+		ignored(settings.RequestTimeout != nil, "requestTimeout", reason)
+		ignored(settings.SlowOriginThreshold != nil, "slowOriginThreshold", reason)
+		ignored(settings.SlowOriginPendingRequests != nil, "slowOriginPendingRequests", reason)
+		ignored(settings.DisableResponseBuffering != nil, "disableResponseBuffering", reason)
+		ignored(settings.FlushInterval != nil, "flushInterval", reason)
+		ignored(settings.StreamTimeout != nil, "streamTimeout", reason)
+		ignored(settings.ForwardClientCert != nil, "forwardClientCert", reason)
+	}
+	if !strings.HasPrefix(r.Service, "http://") && !strings.HasPrefix(r.Service, "https://") {
+		ignored(settings.GRPCWeb != nil, "grpcWeb", "it only applies to http:// and https:// origins")
+		ignored(settings.WarmConnections != nil, "warmConnections", "it only applies to http:// and https:// origins")
+	}
+	if kind != helloWorldOrigin {
+		reason := fmt.Sprintf("it only applies to the %s service", HelloWorldService)
+		ignored(settings.HelloWorldTemplate != nil, "helloWorldTemplate", reason)
+		ignored(settings.HelloWorldLatency != nil, "helloWorldLatency", reason)
+	}
+	if kind != tcpOrigin && kind != bastionOrigin {
+		reason := "the service of the rule isn't a TCP origin"
+		ignored(settings.TCPIdleTimeout != nil, "tcpIdleTimeout", reason)
+		ignored(settings.TCPHalfClose != nil, "tcpHalfClose", reason)
+	}
+	if kind == statusCodeOrigin || kind == helloWorldOrigin || kind == socksOrigin ||
+		strings.HasPrefix(r.Service, "unix:") || strings.HasPrefix(r.Service, "unix+tls:") {
+		ignored(settings.SourceAddress != nil, "sourceAddress", "the service of the rule isn't dialed over the network")
+	}
+	if kind == tcpOrigin || kind == socksOrigin || kind == bastionOrigin {
+		reason := "the service of the rule isn't proxied over HTTP"
+		ignored(settings.HTTPSRedirect != nil, "httpsRedirect", reason)
+		ignored(settings.HSTSMaxAge != nil, "hstsMaxAge", reason)
+		ignored(settings.HSTSIncludeSubdomains != nil, "hstsIncludeSubdomains", reason)
+		ignored(settings.HealthPath != nil, "healthPath", reason)
+	}
+	if kind == httpsOrigin && settings.NoTLSVerify != nil && *settings.NoTLSVerify {
+		ignored(settings.RevocationCheck != nil, "revocationCheck", "noTLSVerify disables the verification of the certificate of the origin")
+	}
+	if settings.RevocationCheck == nil {
+		ignored(settings.RevocationSoftFail != nil, "revocationSoftFail", "revocationCheck isn't set")
+	}
+	if settings.DisableAccessLog != nil && *settings.DisableAccessLog {
+		ignored(len(settings.AccessLogFields) > 0, "accessLogFields", "disableAccessLog stops logging the rule")
+	}
+	if kind != socksOrigin {
+		ignored(len(settings.IPRules) > 0, "ipRules", fmt.Sprintf("it only applies to the %s service", ServiceSocksProxy))
+	}
+	if settings.BastionMode != nil && *settings.BastionMode && r.Service != ServiceBastion && r.Service != "" {
+		problems = append(problems, RuleProblem{
+			Field:      []string{"originRequest", "bastionMode"},
+			Message:    fmt.Sprintf("bastionMode replaces the service %s of the rule with a bastion", r.Service),
+			Suggestion: fmt.Sprintf("set the service to %s", ServiceBastion),
+			Warning:    true,
+		})
+	}
+	return problems
+}
@@ -0,0 +1,204 @@
+package ingress
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+func TestValidateRules(t *testing.T) {
+	noTLSVerify := true
+	hostHeader := "example.com"
+	conf := &config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{Hostname: "a.example.com", Service: "https://localhost:8443", OriginRequest: config.OriginRequestConfig{NoTLSVerify: &noTLSVerify}},
+			{Hostname: "b.example.com", Service: "htps://localhost:8443"},
+			{Hostname: "c.example.com", Service: "localhost:8000"},
+			{Hostname: "d.example.com", Service: "ssh://localhost", OriginRequest: config.OriginRequestConfig{HTTPHostHeader: &hostHeader}},
+			{Hostname: "e.example.com", Service: "http://localhost:8000", OriginRequest: config.OriginRequestConfig{NoTLSVerify: &noTLSVerify}},
+			{Hostname: "f.example.com:443", Service: "hello-wrld"},
+			{Hostname: "g.example.com", Path: "[", Service: "http_status:404"},
+		},
+	}
+	problems := ValidateRules(conf)
+	require.Equal(t, []RuleProblem{
+		{
+			Index:      1,
+			Field:      []string{"service"},
+			Message:    `unknown scheme "htps", the service will be proxied as TCP`,
+			Suggestion: `did you mean "https://localhost:8443"?`,
+			Warning:    true,
+		},
+		{
+			Index:      2,
+			Field:      []string{"service"},
+			Message:    "localhost:8000 is an invalid address, please make sure it has a scheme and a hostname",
+			Suggestion: `did you mean "http://localhost:8000"?`,
+		},
+		{
+			Index:   3,
+			Field:   []string{"originRequest", "httpHostHeader"},
+			Message: "httpHostHeader is ignored, the service of the rule isn't an HTTP origin",
+			Warning: true,
+		},
+		{
+			Index:   4,
+			Field:   []string{"originRequest", "noTLSVerify"},
+			Message: "noTLSVerify is ignored, the service of the rule doesn't use TLS",
+			Warning: true,
+		},
+		{
+			Index:      5,
+			Field:      []string{"service"},
+			Message:    `hello-wrld is an invalid address, please make sure it has a scheme and a hostname`,
+			Suggestion: `did you mean "hello_world"?`,
+		},
+		{
+			Index:      5,
+			Field:      []string{"hostname"},
+			Message:    errHostnameContainsPort.Error(),
+			Suggestion: "set the port in the service instead",
+		},
+		{
+			Index:      6,
+			Field:      []string{"hostname"},
+			Message:    errLastRuleNotCatchAll.Error(),
+			Suggestion: `add a last rule without hostname and path, e.g. "- service: http_status:404"`,
+		},
+		{
+			Index:   6,
+			Field:   []string{"path"},
+			Message: "Rule #7 has an invalid regex: error parsing regexp: missing closing ]: `[`",
+		},
+	}, problems)
+
+	sourceAddress := "192.0.2.1"
+	invalidSourceAddress := "localhost"
+	conf.Ingress = []config.UnvalidatedIngressRule{
+		{Hostname: "a.example.com", Service: "unix:/tmp/origin.sock", OriginRequest: config.OriginRequestConfig{SourceAddress: &sourceAddress}},
+		{Service: "http://localhost:8000", OriginRequest: config.OriginRequestConfig{SourceAddress: &invalidSourceAddress}},
+	}
+	assert.Equal(t, []RuleProblem{
+		{
+			Index:   0,
+			Field:   []string{"originRequest", "sourceAddress"},
+			Message: "sourceAddress is ignored, the service of the rule isn't dialed over the network",
+			Warning: true,
+		},
+		{
+			Index:   1,
+			Field:   []string{"originRequest", "sourceAddress"},
+			Message: `Rule #2 has an invalid sourceAddress "localhost", it must be an IP`,
+		},
+	}, ValidateRules(conf))
+
+	disableAccessLog := true
+	conf.Ingress = []config.UnvalidatedIngressRule{
+		{Hostname: "a.example.com", Service: "http://localhost:8000", OriginRequest: config.OriginRequestConfig{DisableAccessLog: &disableAccessLog, AccessLogFields: []string{"host"}}},
+		{Service: "http://localhost:8000", OriginRequest: config.OriginRequestConfig{AccessLogFields: []string{"host", "body"}}},
+	}
+	assert.Equal(t, []RuleProblem{
+		{
+			Index:   0,
+			Field:   []string{"originRequest", "accessLogFields"},
+			Message: "accessLogFields is ignored, disableAccessLog stops logging the rule",
+			Warning: true,
+		},
+		{
+			Index:   1,
+			Field:   []string{"originRequest", "accessLogFields"},
+			Message: `Rule #2 has an invalid accessLogFields field "body", it must be one of host, path, query, headers, client, all`,
+		},
+	}, ValidateRules(conf))
+
+	revocationCheck := RevocationCheckOCSP
+	invalidRevocationCheck := "always"
+	revocationSoftFail := true
+	conf.Ingress = []config.UnvalidatedIngressRule{
+		{Hostname: "a.example.com", Service: "https://localhost:8443", OriginRequest: config.OriginRequestConfig{RevocationCheck: &revocationCheck, NoTLSVerify: &noTLSVerify}},
+		{Hostname: "b.example.com", Service: "https://localhost:8443", OriginRequest: config.OriginRequestConfig{RevocationSoftFail: &revocationSoftFail}},
+		{Service: "https://localhost:8443", OriginRequest: config.OriginRequestConfig{RevocationCheck: &invalidRevocationCheck}},
+	}
+	assert.Equal(t, []RuleProblem{
+		{
+			Index:   0,
+			Field:   []string{"originRequest", "revocationCheck"},
+			Message: "revocationCheck is ignored, noTLSVerify disables the verification of the certificate of the origin",
+			Warning: true,
+		},
+		{
+			Index:   1,
+			Field:   []string{"originRequest", "revocationSoftFail"},
+			Message: "revocationSoftFail is ignored, revocationCheck isn't set",
+			Warning: true,
+		},
+		{
+			Index:   2,
+			Field:   []string{"originRequest", "revocationCheck"},
+			Message: `Rule #3 has an invalid revocationCheck "always", it must be stapled, ocsp or crl`,
+		},
+	}, ValidateRules(conf))
+
+	tlsMinVersion := "1.2"
+	tlsMaxVersion := "1.1"
+	invalidTLSVersion := "1.4"
+	conf.Ingress = []config.UnvalidatedIngressRule{
+		{Hostname: "a.example.com", Service: "http://localhost:8000", OriginRequest: config.OriginRequestConfig{TLSMinVersion: &tlsMinVersion}},
+		{Hostname: "b.example.com", Service: "https://localhost:8443", OriginRequest: config.OriginRequestConfig{TLSMinVersion: &tlsMinVersion, TLSMaxVersion: &tlsMaxVersion}},
+		{Hostname: "c.example.com", Service: "https://localhost:8443", OriginRequest: config.OriginRequestConfig{TLSMaxVersion: &invalidTLSVersion}},
+		{Service: "https://localhost:8443", OriginRequest: config.OriginRequestConfig{TLSCipherSuites: []string{"TLS_AES_128_GCM_SHA256"}}},
+	}
+	assert.Equal(t, []RuleProblem{
+		{
+			Index:   0,
+			Field:   []string{"originRequest", "tlsMinVersion"},
+			Message: "tlsMinVersion is ignored, the service of the rule doesn't use TLS",
+			Warning: true,
+		},
+		{
+			Index:   1,
+			Field:   []string{"originRequest", "tlsMaxVersion"},
+			Message: "Rule #2 has a tlsMaxVersion 1.1 below its tlsMinVersion 1.2",
+		},
+		{
+			Index:   2,
+			Field:   []string{"originRequest", "tlsMaxVersion"},
+			Message: `Rule #3 has an invalid tlsMaxVersion: invalid TLS version "1.4", it must be 1.0, 1.1, 1.2 or 1.3`,
+		},
+		{
+			Index:   3,
+			Field:   []string{"originRequest", "tlsCipherSuites"},
+			Message: `Rule #4 has invalid tlsCipherSuites: the cipher suite TLS_AES_128_GCM_SHA256 of TLS 1.3 can't be configured`,
+		},
+	}, ValidateRules(conf))
+
+	healthPath := "_tunnel/healthz"
+	conf.Ingress = []config.UnvalidatedIngressRule{
+		{Hostname: "a.example.com", Service: "tcp://localhost:22", OriginRequest: config.OriginRequestConfig{HealthPath: &healthPath}},
+		{Service: "http://localhost:8000", OriginRequest: config.OriginRequestConfig{HealthPath: &healthPath}},
+	}
+	assert.Equal(t, []RuleProblem{
+		{
+			Index:   0,
+			Field:   []string{"originRequest", "healthPath"},
+			Message: `Rule #1 has an invalid healthPath "_tunnel/healthz", it must start with /`,
+		},
+		{
+			Index:   0,
+			Field:   []string{"originRequest", "healthPath"},
+			Message: "healthPath is ignored, the service of the rule isn't proxied over HTTP",
+			Warning: true,
+		},
+		{
+			Index:   1,
+			Field:   []string{"originRequest", "healthPath"},
+			Message: `Rule #2 has an invalid healthPath "_tunnel/healthz", it must start with /`,
+		},
+	}, ValidateRules(conf))
+
+	conf.Ingress = []config.UnvalidatedIngressRule{{Service: "http_status:404"}}
+	assert.Empty(t, ValidateRules(conf))
+}
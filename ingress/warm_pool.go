@@ -0,0 +1,259 @@
+package ingress
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// warmPoolCheckInterval is how often the warm connections are checked, to replace those the origin closed
+	warmPoolCheckInterval = 5 * time.Second
+)
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// warmPool keeps idle connections to an origin established ahead of requests, so that the first requests after an
+// idle period don't wait for the origin to be dialed and, over TLS, for the handshake. The connections are handed to
+// the transport when it dials the origin, which then keeps them in its own pool of idle connections.
+type warmPool struct {
+	size   int
+	addr   string
+	dial   dialFunc
+	maxAge time.Duration
+	log    *zerolog.Logger
+
+	gauge prometheus.Gauge
+	hits  prometheus.Counter
+	miss  prometheus.Counter
+
+	lock   sync.Mutex
+	conns  []warmConn
+	refill chan struct{}
+}
+
+type warmConn struct {
+	net.Conn
+	established time.Time
+}
+
+// startWarmPool makes transport dial the origin at originURL through a pool of cfg.WarmConnections warm connections,
+// which runs until shutdownC is closed. The connections are TLS connections past their handshake for https origins,
+// unless the server name depends on the request. The built-in servers of hello_world and tls_debug have no pool: they
+// are local, and their URL is only known once they're started after their transport.
+func startWarmPool(transport http.RoundTripper, originURL *url.URL, cfg OriginRequestConfig, log *zerolog.Logger, shutdownC <-chan struct{}) {
+	if cfg.WarmConnections == 0 || originURL == nil {
+		return
+	}
+	var httpTransport *http.Transport
+	withTLS := false
+	switch transport := transport.(type) {
+	case *http.Transport:
+		httpTransport = transport
+		withTLS = originURL.Scheme == "https"
+	case *serverNameTransports:
+		httpTransport = transport.base
+	default:
+		return
+	}
+
+	dial := dialFunc(httpTransport.DialContext)
+	if withTLS {
+		dial = tlsDialer(dial, httpTransport.TLSClientConfig, cfg.Http2Origin, cfg.TLSTimeout.Duration)
+	}
+	pool := newWarmPool(originURL, int(cfg.WarmConnections), dial, cfg.KeepAliveTimeout.Duration, log)
+	if withTLS {
+		httpTransport.DialTLSContext = pool.DialContext
+	} else {
+		httpTransport.DialContext = pool.DialContext
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-shutdownC
+		cancel()
+	}()
+	go pool.run(ctx)
+}
+
+func newWarmPool(originURL *url.URL, size int, dial dialFunc, maxAge time.Duration, log *zerolog.Logger) *warmPool {
+	port := originURL.Port()
+	if port == "" {
+		port = "80"
+		if originURL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	origin := originURL.String()
+	return &warmPool{
+		size:   size,
+		addr:   net.JoinHostPort(originURL.Hostname(), port),
+		dial:   dial,
+		maxAge: maxAge,
+		log:    log,
+		gauge:  warmConnections.WithLabelValues(origin),
+		hits:   warmPoolDials.WithLabelValues(origin, "hit"),
+		miss:   warmPoolDials.WithLabelValues(origin, "miss"),
+		refill: make(chan struct{}, 1),
+	}
+}
+
+// tlsDialer returns a dialer of TLS connections past their handshake, that the transport uses as they are
+func tlsDialer(dial dialFunc, config *tls.Config, http2 bool, handshakeTimeout time.Duration) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig := config.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		if http2 {
+			tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+		}
+		if handshakeTimeout != 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, handshakeTimeout)
+			defer cancel()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+// DialContext hands a warm connection to the origin if there is one, and dials addr otherwise
+func (p *warmPool) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if addr != p.addr {
+		return p.dial(ctx, network, addr)
+	}
+	if conn := p.take(); conn != nil {
+		p.hits.Inc()
+		return conn, nil
+	}
+	p.miss.Inc()
+	return p.dial(ctx, network, addr)
+}
+
+// take returns the most recently established warm connection the origin didn't close, or nil if there is none
+func (p *warmPool) take() net.Conn {
+	defer p.requestRefill()
+	for {
+		conn, ok := p.pop()
+		if !ok {
+			return nil
+		}
+		if p.usable(conn) {
+			return conn.Conn
+		}
+		conn.Close()
+	}
+}
+
+func (p *warmPool) pop() (warmConn, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.conns) == 0 {
+		return warmConn{}, false
+	}
+	last := len(p.conns) - 1
+	conn := p.conns[last]
+	p.conns = p.conns[:last]
+	p.gauge.Dec()
+	return conn, true
+}
+
+func (p *warmPool) requestRefill() {
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
+
+func (p *warmPool) run(ctx context.Context) {
+	ticker := time.NewTicker(warmPoolCheckInterval)
+	defer ticker.Stop()
+	for {
+		p.fill(ctx)
+		select {
+		case <-ctx.Done():
+			p.closeAll()
+			return
+		case <-ticker.C:
+			p.prune()
+		case <-p.refill:
+		}
+	}
+}
+
+// fill dials the origin until the pool is full. It gives up until the next check if the origin can't be dialed.
+func (p *warmPool) fill(ctx context.Context) {
+	for {
+		p.lock.Lock()
+		missing := p.size - len(p.conns)
+		p.lock.Unlock()
+		if missing <= 0 || ctx.Err() != nil {
+			return
+		}
+		conn, err := p.dial(ctx, "tcp", p.addr)
+		if err != nil {
+			p.log.Debug().Err(err).Str("originAddr", p.addr).Msg("Failed to establish a warm connection to the origin")
+			return
+		}
+		p.lock.Lock()
+		p.conns = append(p.conns, warmConn{Conn: conn, established: time.Now()})
+		p.gauge.Inc()
+		p.lock.Unlock()
+	}
+}
+
+// prune closes the warm connections that can't be used anymore
+func (p *warmPool) prune() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	usable := p.conns[:0]
+	for _, conn := range p.conns {
+		if p.usable(conn) {
+			usable = append(usable, conn)
+		} else {
+			conn.Close()
+			p.gauge.Dec()
+		}
+	}
+	p.conns = usable
+}
+
+func (p *warmPool) closeAll() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, conn := range p.conns {
+		conn.Close()
+		p.gauge.Dec()
+	}
+	p.conns = nil
+}
+
+// usable returns whether conn isn't older than keepAliveTimeout and the origin didn't close it
+func (p *warmPool) usable(conn warmConn) bool {
+	if p.maxAge != 0 && time.Since(conn.established) > p.maxAge {
+		return false
+	}
+	// TLS connections are checked without reading from them, since the origin may have sent records over them, like
+	// the settings of HTTP/2
+	tcpConn := conn.Conn
+	if tlsConn, ok := tcpConn.(*tls.Conn); ok {
+		tcpConn = tlsConn.NetConn()
+	}
+	return !peerClosed(tcpConn)
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd
+// +build !linux,!darwin,!freebsd,!openbsd,!netbsd
+
+package ingress
+
+import "net"
+
+// peerClosed can't tell whether the peer closed conn without reading from it on this platform, the warm connections
+// are only replaced when they are older than keepAliveTimeout
+func peerClosed(conn net.Conn) bool {
+	return false
+}
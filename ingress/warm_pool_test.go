@@ -0,0 +1,85 @@
+package ingress
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPServiceWarmConnections(t *testing.T) {
+	tests := []struct {
+		withTLS bool
+		http2   bool
+	}{
+		{},
+		{withTLS: true},
+		{withTLS: true, http2: true},
+	}
+	for _, test := range tests {
+		var newConns int32
+		origin := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		origin.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt32(&newConns, 1)
+			}
+		}
+		if test.withTLS {
+			origin.EnableHTTP2 = test.http2
+			origin.StartTLS()
+		} else {
+			origin.Start()
+		}
+
+		originURL, err := url.Parse(origin.URL)
+		require.NoError(t, err)
+		service := &httpService{url: originURL}
+		shutdownC := make(chan struct{})
+		require.NoError(t, service.start(testLogger, shutdownC, OriginRequestConfig{NoTLSVerify: true, Http2Origin: test.http2, WarmConnections: 2}))
+
+		// The connections are established before any request
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&newConns) == 2 }, time.Second, 10*time.Millisecond)
+		hits := warmPoolDials.WithLabelValues(originURL.String(), "hit")
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(warmConnections.WithLabelValues(originURL.String())) == 2
+		}, time.Second, 10*time.Millisecond)
+
+		req, err := http.NewRequest(http.MethodGet, origin.URL, nil)
+		require.NoError(t, err)
+		resp, err := service.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, float64(1), testutil.ToFloat64(hits), "%+v", test)
+		if test.http2 {
+			assert.Equal(t, 2, resp.ProtoMajor)
+		}
+
+		// The used connection is replaced
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&newConns) == 3 }, time.Second, 10*time.Millisecond)
+
+		close(shutdownC)
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(warmConnections.WithLabelValues(originURL.String())) == 0
+		}, time.Second, 10*time.Millisecond)
+		origin.Close()
+	}
+}
+
+func TestBuiltInServicesWithoutWarmConnections(t *testing.T) {
+	shutdownC := make(chan struct{})
+	defer close(shutdownC)
+	cfg := OriginRequestConfig{WarmConnections: 2}
+	for _, service := range []OriginService{new(helloWorld), new(tlsDebug)} {
+		require.NoError(t, service.start(testLogger, shutdownC, cfg), service.String())
+	}
+}
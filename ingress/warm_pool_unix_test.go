@@ -0,0 +1,60 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd
+// +build linux darwin freebsd openbsd netbsd
+
+package ingress
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmPoolReplacesClosedConnections(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	accepted := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	var dialer net.Dialer
+	originURL := &url.URL{Scheme: "http", Host: listener.Addr().String()}
+	log := zerolog.Nop()
+	pool := newWarmPool(originURL, 1, dialer.DialContext, 0, &log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.fill(ctx)
+	require.Len(t, pool.conns, 1)
+
+	// The origin closes the idle connection
+	(<-accepted).Close()
+	require.Eventually(t, func() bool {
+		pool.prune()
+		return len(pool.conns) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	pool.fill(ctx)
+	require.Len(t, pool.conns, 1)
+	conn, err := pool.DialContext(ctx, "tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Empty(t, pool.conns)
+	assert.False(t, peerClosed(conn))
+
+	// Other addresses are dialed as usual
+	_, err = pool.DialContext(ctx, "tcp", "127.0.0.1:1")
+	assert.Error(t, err)
+}
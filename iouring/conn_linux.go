@@ -0,0 +1,490 @@
+package iouring
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// UDPConn is a UDP socket whose reads and writes go through a Ring. It implements net.PacketConn, and net.Conn once
+// it's connected with DialUDP.
+type UDPConn struct {
+	ring   *Ring
+	fd     int
+	family int
+	laddr  *net.UDPAddr
+	raddr  *net.UDPAddr
+
+	readDeadline  deadline
+	writeDeadline deadline
+
+	lock     sync.Mutex
+	closed   bool
+	inFlight map[uint64]struct{}
+	// ops counts the operations in flight, the socket is closed once they all completed
+	ops sync.WaitGroup
+}
+
+// ListenUDP opens a UDP socket bound to laddr. The socket is an IPv6 socket also accepting IPv4, unless laddr is an
+// IPv4 address.
+func (r *Ring) ListenUDP(laddr *net.UDPAddr) (*UDPConn, error) {
+	c, err := r.newUDPConn(familyOf(laddr.IP))
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Bind(c.fd, toSockaddr(laddr, c.family)); err != nil {
+		_ = unix.Close(c.fd)
+		return nil, opError("listen", laddr, nil, os.NewSyscallError("bind", err))
+	}
+	if err := c.setAddrs(); err != nil {
+		_ = unix.Close(c.fd)
+		return nil, err
+	}
+	return c, nil
+}
+
+// DialUDP opens a UDP socket connected to raddr
+func (r *Ring) DialUDP(raddr *net.UDPAddr) (*UDPConn, error) {
+	c, err := r.newUDPConn(familyOf(raddr.IP))
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Connect(c.fd, toSockaddr(raddr, c.family)); err != nil {
+		_ = unix.Close(c.fd)
+		return nil, opError("dial", nil, raddr, os.NewSyscallError("connect", err))
+	}
+	if err := c.setAddrs(); err != nil {
+		_ = unix.Close(c.fd)
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *Ring) newUDPConn(family int) (*UDPConn, error) {
+	fd, err := unix.Socket(family, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.IPPROTO_UDP)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if family == unix.AF_INET6 {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_V6ONLY, 0); err != nil {
+			_ = unix.Close(fd)
+			return nil, os.NewSyscallError("setsockopt", err)
+		}
+	}
+	return &UDPConn{
+		ring:          r,
+		fd:            fd,
+		family:        family,
+		readDeadline:  makeDeadline(),
+		writeDeadline: makeDeadline(),
+		inFlight:      make(map[uint64]struct{}),
+	}, nil
+}
+
+func (c *UDPConn) setAddrs() error {
+	sa, err := unix.Getsockname(c.fd)
+	if err != nil {
+		return os.NewSyscallError("getsockname", err)
+	}
+	c.laddr = fromSockaddr(sa)
+	if sa, err := unix.Getpeername(c.fd); err == nil {
+		c.raddr = fromSockaddr(sa)
+	}
+	return nil
+}
+
+// Read reads a packet of a connected socket
+func (c *UDPConn) Read(p []byte) (int, error) {
+	o := &op{
+		opcode: opRecv,
+		buf:    p,
+		len:    uint32(len(p)),
+	}
+	if len(p) > 0 {
+		o.addr = uint64(uintptr(unsafe.Pointer(&p[0])))
+	}
+	n, err := c.do(o, &c.readDeadline)
+	if err != nil {
+		return 0, opError("read", c.laddr, c.raddr, syscallError("recv", err))
+	}
+	return n, nil
+}
+
+// ReadFrom reads a packet and the address it's from
+func (c *UDPConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	o := c.msgOp(opRecvmsg, p, &unix.RawSockaddrAny{})
+	n, err := c.do(o, &c.readDeadline)
+	if err != nil {
+		return 0, nil, opError("read", c.laddr, nil, syscallError("recvmsg", err))
+	}
+	return n, fromRawSockaddr(o.sa), nil
+}
+
+// Write writes a packet to a connected socket
+func (c *UDPConn) Write(p []byte) (int, error) {
+	o := &op{
+		opcode: opSend,
+		buf:    p,
+		len:    uint32(len(p)),
+	}
+	if len(p) > 0 {
+		o.addr = uint64(uintptr(unsafe.Pointer(&p[0])))
+	}
+	n, err := c.do(o, &c.writeDeadline)
+	if err != nil {
+		return 0, opError("write", c.laddr, c.raddr, syscallError("send", err))
+	}
+	return n, nil
+}
+
+// WriteTo writes a packet to addr
+func (c *UDPConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, opError("write", c.laddr, addr, syscall.EINVAL)
+	}
+	o := c.msgOp(opSendmsg, p, toRawSockaddr(udpAddr, c.family))
+	n, err := c.do(o, &c.writeDeadline)
+	if err != nil {
+		return 0, opError("write", c.laddr, addr, syscallError("sendmsg", err))
+	}
+	return n, nil
+}
+
+// msgOp is a RECVMSG or SENDMSG operation of one buffer
+func (c *UDPConn) msgOp(opcode uint8, p []byte, sa *unix.RawSockaddrAny) *op {
+	o := &op{
+		opcode: opcode,
+		buf:    p,
+		msg:    &unix.Msghdr{},
+		iov:    &unix.Iovec{},
+		sa:     sa,
+		len:    1,
+	}
+	if len(p) > 0 {
+		o.iov.Base = &p[0]
+	}
+	o.iov.SetLen(len(p))
+	o.msg.Name = (*byte)(unsafe.Pointer(sa))
+	o.msg.Namelen = unix.SizeofSockaddrAny
+	o.msg.Iov = o.iov
+	o.msg.SetIovlen(1)
+	o.addr = uint64(uintptr(unsafe.Pointer(o.msg)))
+	return o
+}
+
+// do runs o on the socket until it completes, or it's cancelled because the deadline passed or the socket is closed
+func (c *UDPConn) do(o *op, d *deadline) (int, error) {
+	o.fd = int32(c.fd)
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return 0, net.ErrClosed
+	}
+	c.ops.Add(1)
+	c.lock.Unlock()
+	defer c.ops.Done()
+
+	expired := d.wait()
+	if isClosed(expired) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	if err := c.ring.submit(o); err != nil {
+		return 0, err
+	}
+	c.lock.Lock()
+	c.inFlight[o.id] = struct{}{}
+	closed := c.closed
+	c.lock.Unlock()
+	if closed {
+		// The socket was closed while o was submitted
+		c.ring.cancel(o.id)
+	}
+
+	timedOut := false
+	select {
+	case <-o.done:
+	case <-expired:
+		timedOut = true
+		c.ring.cancel(o.id)
+		<-o.done
+	}
+
+	c.lock.Lock()
+	delete(c.inFlight, o.id)
+	closed = c.closed
+	c.lock.Unlock()
+
+	switch {
+	case o.res >= 0:
+		return int(o.res), nil
+	case o.res != -int32(unix.ECANCELED):
+		return 0, syscall.Errno(-o.res)
+	case closed:
+		return 0, net.ErrClosed
+	case timedOut:
+		return 0, os.ErrDeadlineExceeded
+	default:
+		return 0, ErrRingClosed
+	}
+}
+
+// syscallError wraps the errno of a syscall with its name, like the net package
+func syscallError(syscallName string, err error) error {
+	if errno, ok := err.(syscall.Errno); ok {
+		return os.NewSyscallError(syscallName, errno)
+	}
+	return err
+}
+
+// Close cancels the pending reads and writes, and closes the socket once they completed
+func (c *UDPConn) Close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return net.ErrClosed
+	}
+	c.closed = true
+	for id := range c.inFlight {
+		c.ring.cancel(id)
+	}
+	c.lock.Unlock()
+
+	c.ops.Wait()
+	return os.NewSyscallError("close", unix.Close(c.fd))
+}
+
+func (c *UDPConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+// RemoteAddr is the address of a connected socket, or nil
+func (c *UDPConn) RemoteAddr() net.Addr {
+	if c.raddr == nil {
+		return nil
+	}
+	return c.raddr
+}
+
+func (c *UDPConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *UDPConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *UDPConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// SetReadBuffer sets the size of the receive buffer of the socket
+func (c *UDPConn) SetReadBuffer(bytes int) error {
+	return os.NewSyscallError("setsockopt", unix.SetsockoptInt(c.fd, unix.SOL_SOCKET, unix.SO_RCVBUF, bytes))
+}
+
+// SetWriteBuffer sets the size of the send buffer of the socket
+func (c *UDPConn) SetWriteBuffer(bytes int) error {
+	return os.NewSyscallError("setsockopt", unix.SetsockoptInt(c.fd, unix.SOL_SOCKET, unix.SO_SNDBUF, bytes))
+}
+
+// SyscallConn gives access to the socket to set options, for example the DF bit QUIC needs. It can't be used to read
+// or write.
+func (c *UDPConn) SyscallConn() (syscall.RawConn, error) {
+	return rawConn{fd: c.fd}, nil
+}
+
+var errRawIO = errors.New("reads and writes go through io_uring")
+
+type rawConn struct {
+	fd int
+}
+
+func (rc rawConn) Control(f func(fd uintptr)) error {
+	f(uintptr(rc.fd))
+	return nil
+}
+
+func (rc rawConn) Read(func(fd uintptr) bool) error {
+	return errRawIO
+}
+
+func (rc rawConn) Write(func(fd uintptr) bool) error {
+	return errRawIO
+}
+
+func opError(op string, source, addr net.Addr, err error) error {
+	if source == (*net.UDPAddr)(nil) {
+		source = nil
+	}
+	if addr == (*net.UDPAddr)(nil) {
+		addr = nil
+	}
+	return &net.OpError{
+		Op:     op,
+		Net:    "udp",
+		Source: source,
+		Addr:   addr,
+		Err:    err,
+	}
+}
+
+func familyOf(ip net.IP) int {
+	if ip.To4() != nil {
+		return unix.AF_INET
+	}
+	return unix.AF_INET6
+}
+
+func toSockaddr(addr *net.UDPAddr, family int) unix.Sockaddr {
+	if family == unix.AF_INET {
+		sa := &unix.SockaddrInet4{Port: addr.Port}
+		copy(sa.Addr[:], addr.IP.To4())
+		return sa
+	}
+	sa := &unix.SockaddrInet6{Port: addr.Port}
+	// IPv4 addresses are mapped to IPv6 ones
+	copy(sa.Addr[:], addr.IP.To16())
+	if addr.Zone != "" {
+		if iface, err := net.InterfaceByName(addr.Zone); err == nil {
+			sa.ZoneId = uint32(iface.Index)
+		}
+	}
+	return sa
+}
+
+func fromSockaddr(sa unix.Sockaddr) *net.UDPAddr {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return &net.UDPAddr{IP: net.IP(append([]byte(nil), sa.Addr[:]...)), Port: sa.Port}
+	case *unix.SockaddrInet6:
+		return udpAddr6(sa.Addr, sa.Port, sa.ZoneId)
+	}
+	return &net.UDPAddr{}
+}
+
+func udpAddr6(addr [16]byte, port int, zoneID uint32) *net.UDPAddr {
+	udpAddr := &net.UDPAddr{IP: net.IP(append([]byte(nil), addr[:]...)), Port: port}
+	if ip4 := udpAddr.IP.To4(); ip4 != nil {
+		udpAddr.IP = ip4
+	}
+	if zoneID != 0 {
+		if iface, err := net.InterfaceByIndex(int(zoneID)); err == nil {
+			udpAddr.Zone = iface.Name
+		}
+	}
+	return udpAddr
+}
+
+// toRawSockaddr is toSockaddr in the memory layout the kernel reads
+func toRawSockaddr(addr *net.UDPAddr, family int) *unix.RawSockaddrAny {
+	raw := &unix.RawSockaddrAny{}
+	if family == unix.AF_INET {
+		sa := (*unix.RawSockaddrInet4)(unsafe.Pointer(raw))
+		sa.Family = unix.AF_INET
+		putPort(&sa.Port, addr.Port)
+		copy(sa.Addr[:], addr.IP.To4())
+		return raw
+	}
+	sa := (*unix.RawSockaddrInet6)(unsafe.Pointer(raw))
+	sa.Family = unix.AF_INET6
+	putPort(&sa.Port, addr.Port)
+	copy(sa.Addr[:], addr.IP.To16())
+	if s, ok := toSockaddr(addr, family).(*unix.SockaddrInet6); ok {
+		sa.Scope_id = s.ZoneId
+	}
+	return raw
+}
+
+func fromRawSockaddr(raw *unix.RawSockaddrAny) *net.UDPAddr {
+	switch raw.Addr.Family {
+	case unix.AF_INET:
+		sa := (*unix.RawSockaddrInet4)(unsafe.Pointer(raw))
+		return &net.UDPAddr{IP: net.IP(append([]byte(nil), sa.Addr[:]...)), Port: getPort(&sa.Port)}
+	case unix.AF_INET6:
+		sa := (*unix.RawSockaddrInet6)(unsafe.Pointer(raw))
+		return udpAddr6(sa.Addr, getPort(&sa.Port), sa.Scope_id)
+	}
+	return &net.UDPAddr{}
+}
+
+// putPort writes a port in network byte order
+func putPort(dst *uint16, port int) {
+	b := (*[2]byte)(unsafe.Pointer(dst))
+	b[0] = byte(port >> 8)
+	b[1] = byte(port)
+}
+
+func getPort(src *uint16) int {
+	b := (*[2]byte)(unsafe.Pointer(src))
+	return int(b[0])<<8 | int(b[1])
+}
+
+// deadline is a read or write deadline, whose channel is closed once it passed. It's like the deadline of net.Pipe:
+// operations waiting on the channel see a deadline moved while they wait.
+type deadline struct {
+	lock    sync.Mutex
+	timer   *time.Timer
+	expired chan struct{}
+}
+
+func makeDeadline() deadline {
+	return deadline{expired: make(chan struct{})}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		// The timer fired, wait for it to close the channel
+		<-d.expired
+	}
+	d.timer = nil
+
+	closed := isClosed(d.expired)
+	if t.IsZero() {
+		if closed {
+			d.expired = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.expired = make(chan struct{})
+		}
+		expired := d.expired
+		d.timer = time.AfterFunc(dur, func() {
+			close(expired)
+		})
+		return
+	}
+	if !closed {
+		close(d.expired)
+	}
+}
+
+func (d *deadline) wait() chan struct{} {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.expired
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,226 @@
+package iouring
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRing(t *testing.T) *Ring {
+	ring, err := NewRing(DefaultEntries)
+	if err == ErrUnsupported {
+		t.Skip("io_uring is not supported")
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, ring.Close())
+	})
+	return ring
+}
+
+func TestListenUDP(t *testing.T) {
+	ring := newTestRing(t)
+	conn, err := ring.ListenUDP(&net.UDPAddr{IP: net.IPv6unspecified})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	peer, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer peer.Close()
+
+	// IPv4 addresses are reachable from the IPv6 socket
+	n, err := conn.WriteTo([]byte("ping"), peer.LocalAddr())
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	buf := make([]byte, 16)
+	n, from, err := peer.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf[:n]))
+	assert.Equal(t, conn.LocalAddr().(*net.UDPAddr).Port, from.(*net.UDPAddr).Port)
+
+	_, err = peer.WriteTo([]byte("pong"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: from.(*net.UDPAddr).Port})
+	require.NoError(t, err)
+	n, from, err = conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(buf[:n]))
+	assert.Equal(t, peer.LocalAddr().String(), from.String())
+}
+
+func TestDialUDP(t *testing.T) {
+	ring := newTestRing(t)
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer peer.Close()
+
+	conn, err := ring.DialUDP(peer.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, peer.LocalAddr().String(), conn.RemoteAddr().String())
+
+	// Packets are sent and received concurrently
+	const packets = 100
+	go func() {
+		for i := 0; i < packets; i++ {
+			_, _ = conn.Write([]byte{byte(i)})
+		}
+	}()
+	buf := make([]byte, 16)
+	for i := 0; i < packets; i++ {
+		n, from, err := peer.ReadFrom(buf)
+		require.NoError(t, err)
+		_, err = peer.WriteTo(buf[:n], from)
+		require.NoError(t, err)
+	}
+	received := make(map[byte]bool)
+	for i := 0; i < packets; i++ {
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+		received[buf[0]] = true
+	}
+	assert.Len(t, received, packets)
+}
+
+func TestReadDeadline(t *testing.T) {
+	ring := newTestRing(t)
+	conn, err := ring.ListenUDP(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, _, err = conn.ReadFrom(make([]byte, 16))
+	require.True(t, errors.Is(err, os.ErrDeadlineExceeded), err)
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr))
+	assert.True(t, netErr.Timeout())
+
+	// Reads fail right away while the deadline is in the past
+	_, _, err = conn.ReadFrom(make([]byte, 16))
+	require.True(t, errors.Is(err, os.ErrDeadlineExceeded), err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Time{}))
+	peer, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer peer.Close()
+	_, err = peer.Write([]byte("ping"))
+	require.NoError(t, err)
+	_, _, err = conn.ReadFrom(make([]byte, 16))
+	require.NoError(t, err)
+}
+
+func TestCloseUnblocksRead(t *testing.T) {
+	ring := newTestRing(t)
+	conn, err := ring.ListenUDP(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+
+	errC := make(chan error)
+	go func() {
+		_, _, err := conn.ReadFrom(make([]byte, 16))
+		errC <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, conn.Close())
+	select {
+	case err := <-errC:
+		require.True(t, errors.Is(err, net.ErrClosed), err)
+	case <-time.After(time.Second):
+		t.Fatal("read wasn't unblocked")
+	}
+	_, _, err = conn.ReadFrom(make([]byte, 16))
+	require.True(t, errors.Is(err, net.ErrClosed), err)
+}
+
+func TestParkedReadsDontStarveWrites(t *testing.T) {
+	ring, err := NewRing(4)
+	if err == ErrUnsupported {
+		t.Skip("io_uring is not supported")
+	}
+	require.NoError(t, err)
+	defer ring.Close()
+	conn, err := ring.ListenUDP(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+
+	// More reads than the completion queue has room for wait for a packet
+	readers := cap(ring.recvSlots) * 2
+	errC := make(chan error, readers)
+	for i := 0; i < readers; i++ {
+		go func() {
+			_, _, err := conn.ReadFrom(make([]byte, 16))
+			errC <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer peer.Close()
+	require.NoError(t, conn.SetWriteDeadline(time.Now().Add(time.Second)))
+	_, err = conn.WriteTo([]byte("ping"), peer.LocalAddr())
+	require.NoError(t, err)
+
+	// The reads in flight are all cancelled
+	require.NoError(t, conn.Close())
+	for i := 0; i < readers; i++ {
+		require.True(t, errors.Is(<-errC, net.ErrClosed))
+	}
+}
+
+func TestRingClose(t *testing.T) {
+	ring, err := NewRing(DefaultEntries)
+	if err == ErrUnsupported {
+		t.Skip("io_uring is not supported")
+	}
+	require.NoError(t, err)
+	conn, err := ring.ListenUDP(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	errC := make(chan error)
+	go func() {
+		_, _, err := conn.ReadFrom(make([]byte, 16))
+		errC <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, ring.Close())
+	require.True(t, errors.Is(<-errC, ErrRingClosed))
+
+	_, err = conn.WriteTo([]byte("ping"), conn.LocalAddr())
+	require.True(t, errors.Is(err, ErrRingClosed))
+}
+
+func TestRingFailure(t *testing.T) {
+	failC := make(chan struct{})
+	waitCompletions = func(int) syscall.Errno {
+		<-failC
+		return syscall.EBADF
+	}
+	defer func() { waitCompletions = defaultWaitCompletions }()
+	ring := newTestRing(t)
+	conn, err := ring.ListenUDP(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	errC := make(chan error)
+	go func() {
+		_, _, err := conn.ReadFrom(make([]byte, 16))
+		errC <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// The read fails with the error of io_uring_enter instead of waiting forever
+	close(failC)
+	select {
+	case err := <-errC:
+		require.True(t, errors.Is(err, syscall.EBADF), err)
+	case <-time.After(time.Second):
+		t.Fatal("the read wasn't failed")
+	}
+
+	_, err = conn.WriteTo([]byte("ping"), conn.LocalAddr())
+	require.True(t, errors.Is(err, ErrRingClosed))
+}
@@ -0,0 +1,21 @@
+// Package iouring is an io_uring backend for the UDP sockets of cloudflared on Linux: the socket behind QUIC
+// connections to the edge and the origin sockets of datagram sessions.
+//
+// A Ring batches the operations of all its sockets: operations submitted while the previous batch is being submitted
+// are submitted together with a single io_uring_enter, and all the completions available are reaped at once. This
+// saves syscalls and scheduler wakeups on connectors proxying many packets per second.
+package iouring
+
+import (
+	"errors"
+)
+
+var (
+	// ErrUnsupported is returned by NewRing when io_uring, or a feature of it that Ring needs, is unavailable
+	ErrUnsupported = errors.New("io_uring is not supported")
+	// ErrRingClosed is returned by the operations of a closed Ring
+	ErrRingClosed = errors.New("io_uring ring is closed")
+)
+
+// DefaultEntries is the default size of the submission queue of a Ring
+const DefaultEntries = 256
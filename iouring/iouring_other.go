@@ -0,0 +1,32 @@
+//go:build !linux
+
+package iouring
+
+import (
+	"net"
+)
+
+// Ring is only supported on Linux
+type Ring struct{}
+
+// UDPConn is only supported on Linux
+type UDPConn struct {
+	*net.UDPConn
+}
+
+// NewRing returns ErrUnsupported, io_uring is specific to Linux
+func NewRing(entries uint32) (*Ring, error) {
+	return nil, ErrUnsupported
+}
+
+func (r *Ring) ListenUDP(laddr *net.UDPAddr) (*UDPConn, error) {
+	return nil, ErrUnsupported
+}
+
+func (r *Ring) DialUDP(raddr *net.UDPAddr) (*UDPConn, error) {
+	return nil, ErrUnsupported
+}
+
+func (r *Ring) Close() error {
+	return nil
+}
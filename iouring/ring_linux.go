@@ -0,0 +1,521 @@
+package iouring
+
+import (
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Constants of linux/io_uring.h
+const (
+	opNop         = 0
+	opSendmsg     = 9
+	opRecvmsg     = 10
+	opAsyncCancel = 14
+	opSend        = 26
+	opRecv        = 27
+
+	setupCQSize = 1 << 3
+
+	enterGetEvents = 1 << 0
+
+	featSingleMmap = 1 << 0
+	featNoDrop     = 1 << 1
+	featFastPoll   = 1 << 5
+
+	offSQRing = 0
+	offSQEs   = 0x10000000
+
+	sqeSize = 64
+	cqeSize = 16
+)
+
+// cqEntriesBySQEntry is the size of the completion queue relative to the submission queue. Receive operations stay
+// in flight until a packet arrives, so there are many more operations in flight than operations being submitted.
+const cqEntriesBySQEntry = 128
+
+// maxCQEntries is IORING_MAX_CQ_ENTRIES
+const maxCQEntries = 65536
+
+// closeUserData is the user data of the NOP stopping the completion loop, operations start at 1
+const closeUserData = 0
+
+type sqRingOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	flags       uint32
+	dropped     uint32
+	array       uint32
+	resv1       uint32
+	resv2       uint64
+}
+
+type cqRingOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	overflow    uint32
+	cqes        uint32
+	flags       uint32
+	resv1       uint32
+	resv2       uint64
+}
+
+type params struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFD         uint32
+	resv         [3]uint32
+	sqOff        sqRingOffsets
+	cqOff        cqRingOffsets
+}
+
+// sqe is struct io_uring_sqe, with the fields Ring uses
+type sqe struct {
+	opcode   uint8
+	flags    uint8
+	ioprio   uint16
+	fd       int32
+	off      uint64
+	addr     uint64
+	len      uint32
+	opFlags  uint32
+	userData uint64
+	_        [24]byte
+}
+
+type cqe struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// op is an operation of a Ring. The memory the kernel reads or writes is referenced by the op until it completes, so
+// it isn't garbage collected in the meantime.
+type op struct {
+	id      uint64
+	opcode  uint8
+	fd      int32
+	addr    uint64
+	len     uint32
+	opFlags uint32
+
+	buf []byte
+	msg *unix.Msghdr
+	iov *unix.Iovec
+	sa  *unix.RawSockaddrAny
+
+	// slots is the budget the operation holds a slot of until it completes, nil if it isn't counted
+	slots chan struct{}
+	// res is the result of the operation, a negative errno if it failed
+	res  int32
+	done chan struct{}
+}
+
+// Ring is an io_uring instance shared by sockets
+type Ring struct {
+	fd int
+
+	ringMmap []byte
+	sqesMmap []byte
+	sqes     []sqe
+
+	sqHead    *uint32
+	sqTail    *uint32
+	sqMask    uint32
+	sqArray   []uint32
+	sqEntries uint32
+	cqHead    *uint32
+	cqTail    *uint32
+	cqMask    uint32
+	cqes      []cqe
+
+	// submitC wakes up the submit loop when operations are pending
+	submitC chan struct{}
+	// slots and recvSlots limit the operations in flight, so the completion queue never overflows even when all of
+	// them are cancelled. Receive operations stay in flight until a packet arrives, they have their own budget so
+	// parked receives never starve writes and cancellations.
+	slots     chan struct{}
+	recvSlots chan struct{}
+
+	lock sync.Mutex
+	ops  map[uint64]*op
+	// pending are the operations queued for the submit loop, in order
+	pending []*op
+	nextID  uint64
+	closed  bool
+	// failed is set once io_uring_enter failed fatally, completions aren't reaped anymore
+	failed      bool
+	closedC     chan struct{}
+	closeOnce   sync.Once
+	stoppedC    chan struct{}
+	reapedC     chan struct{}
+	submitDoneC chan struct{}
+}
+
+// waitCompletions waits for at least one completion of the ring fd, it's replaced in tests
+var waitCompletions = defaultWaitCompletions
+
+func defaultWaitCompletions(fd int) syscall.Errno {
+	_, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(fd), 0, 1, enterGetEvents, 0, 0)
+	return errno
+}
+
+// NewRing sets up an io_uring instance with a submission queue of entries operations. It returns ErrUnsupported if
+// the kernel doesn't support io_uring, or is older than Linux 5.7 which polls sockets internally.
+func NewRing(entries uint32) (*Ring, error) {
+	cqEntries := entries * cqEntriesBySQEntry
+	if cqEntries > maxCQEntries {
+		cqEntries = maxCQEntries
+	}
+	p := params{
+		flags:     setupCQSize,
+		cqEntries: cqEntries,
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		if errno == unix.ENOSYS || errno == unix.EPERM {
+			return nil, ErrUnsupported
+		}
+		return nil, errno
+	}
+	const features = featSingleMmap | featNoDrop | featFastPoll
+	if p.features&features != features {
+		_ = unix.Close(int(fd))
+		return nil, ErrUnsupported
+	}
+
+	r := &Ring{
+		fd:          int(fd),
+		ops:         make(map[uint64]*op),
+		closedC:     make(chan struct{}),
+		stoppedC:    make(chan struct{}),
+		reapedC:     make(chan struct{}),
+		submitDoneC: make(chan struct{}),
+	}
+	if err := r.mmap(&p); err != nil {
+		_ = unix.Close(r.fd)
+		return nil, err
+	}
+	r.submitC = make(chan struct{}, 1)
+	// Half of the completion queue is left for the cancellations of Close and its NOP
+	r.slots = make(chan struct{}, len(r.cqes)/4-1)
+	r.recvSlots = make(chan struct{}, len(r.cqes)/4)
+
+	go r.submitLoop()
+	go r.reapLoop()
+	return r, nil
+}
+
+func (r *Ring) mmap(p *params) error {
+	sqRingSize := int(p.sqOff.array + p.sqEntries*4)
+	cqRingSize := int(p.cqOff.cqes + p.cqEntries*cqeSize)
+	// With IORING_FEAT_SINGLE_MMAP, both rings are in the same mapping
+	ringSize := sqRingSize
+	if cqRingSize > ringSize {
+		ringSize = cqRingSize
+	}
+	ring, err := unix.Mmap(r.fd, offSQRing, ringSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return err
+	}
+	sqes, err := unix.Mmap(r.fd, offSQEs, int(p.sqEntries)*sqeSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		_ = unix.Munmap(ring)
+		return err
+	}
+
+	r.ringMmap = ring
+	r.sqesMmap = sqes
+	r.sqes = unsafe.Slice((*sqe)(unsafe.Pointer(&sqes[0])), p.sqEntries)
+	r.sqHead = (*uint32)(unsafe.Pointer(&ring[p.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&ring[p.sqOff.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&ring[p.sqOff.ringMask]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&ring[p.sqOff.array])), p.sqEntries)
+	r.sqEntries = p.sqEntries
+	r.cqHead = (*uint32)(unsafe.Pointer(&ring[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&ring[p.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&ring[p.cqOff.ringMask]))
+	r.cqes = unsafe.Slice((*cqe)(unsafe.Pointer(&ring[p.cqOff.cqes])), p.cqEntries)
+	return nil
+}
+
+// submit submits o, once there is room for it in the completion queue. o.done is closed once it completes.
+func (r *Ring) submit(o *op) error {
+	slots := r.slots
+	if o.opcode == opRecv || o.opcode == opRecvmsg {
+		slots = r.recvSlots
+	}
+	if !r.acquire(slots) {
+		return ErrRingClosed
+	}
+	o.slots = slots
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed || r.failed {
+		<-slots
+		return ErrRingClosed
+	}
+	r.enqueueLocked(o)
+	return nil
+}
+
+// acquire takes a slot of the budget slots, it returns false if the ring is closed in the meantime
+func (r *Ring) acquire(slots chan struct{}) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-r.closedC:
+		return false
+	}
+}
+
+// enqueueLocked registers o and queues it for the submit loop. Operations are submitted in the order they're queued,
+// so an operation is always submitted before the cancellation of it.
+func (r *Ring) enqueueLocked(o *op) {
+	r.nextID++
+	o.id = r.nextID
+	o.done = make(chan struct{})
+	r.ops[o.id] = o
+	r.queueLocked(o)
+}
+
+// queueLocked appends o to the pending operations and wakes up the submit loop. It never blocks, the submit loop
+// can be waiting for completions reaped by a goroutine waiting for the lock.
+func (r *Ring) queueLocked(o *op) {
+	r.pending = append(r.pending, o)
+	select {
+	case r.submitC <- struct{}{}:
+	default:
+	}
+}
+
+// cancel asks the kernel to cancel the operation id, which completes with -ECANCELED unless it completed already
+func (r *Ring) cancel(id uint64) {
+	if !r.acquire(r.slots) {
+		// Close cancels all the operations
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.ops[id]; !ok || r.closed || r.failed {
+		<-r.slots
+		return
+	}
+	r.enqueueLocked(&op{
+		opcode: opAsyncCancel,
+		fd:     -1,
+		addr:   id,
+		slots:  r.slots,
+	})
+}
+
+// Close cancels the operations in flight, waits for them to complete and releases the ring
+func (r *Ring) Close() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.closeOnce.Do(func() { close(r.closedC) })
+	// Once the ring failed, the reap loop stopped and the operations were failed already
+	if !r.failed {
+		var inFlight []uint64
+		for id, o := range r.ops {
+			if o.opcode != opAsyncCancel {
+				inFlight = append(inFlight, id)
+			}
+		}
+		for _, id := range inFlight {
+			r.enqueueLocked(&op{
+				opcode: opAsyncCancel,
+				fd:     -1,
+				addr:   id,
+			})
+		}
+		// The NOP is queued last, the reap loop stops once it and all the operations completed
+		r.queueLocked(&op{
+			opcode: opNop,
+			fd:     -1,
+			id:     closeUserData,
+		})
+	}
+	r.lock.Unlock()
+
+	<-r.reapedC
+	close(r.stoppedC)
+	// The submit loop may be writing to the submission queue until it stops
+	<-r.submitDoneC
+	_ = unix.Munmap(r.ringMmap)
+	_ = unix.Munmap(r.sqesMmap)
+	return unix.Close(r.fd)
+}
+
+// submitLoop writes the pending operations to the submission queue, and submits them in batches
+func (r *Ring) submitLoop() {
+	defer close(r.submitDoneC)
+	for {
+		select {
+		case <-r.submitC:
+		case <-r.stoppedC:
+			return
+		}
+		for batch := r.nextBatch(); len(batch) > 0; batch = r.nextBatch() {
+			for _, o := range batch {
+				r.prepare(o)
+			}
+			r.enter(uint32(len(batch)))
+		}
+	}
+}
+
+// nextBatch takes the pending operations that fit in the submission queue
+func (r *Ring) nextBatch() []*op {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	n := len(r.pending)
+	if n > int(r.sqEntries) {
+		n = int(r.sqEntries)
+	}
+	batch := r.pending[:n]
+	r.pending = r.pending[n:]
+	if len(r.pending) == 0 {
+		r.pending = nil
+	}
+	return batch
+}
+
+func (r *Ring) prepare(o *op) {
+	// Only this goroutine writes the tail, and the queue is empty after each enter
+	tail := *r.sqTail
+	index := tail & r.sqMask
+	r.sqes[index] = sqe{
+		opcode:   o.opcode,
+		fd:       o.fd,
+		addr:     o.addr,
+		len:      o.len,
+		opFlags:  o.opFlags,
+		userData: o.id,
+	}
+	r.sqArray[index] = index
+	atomic.StoreUint32(r.sqTail, tail+1)
+}
+
+// enter submits the n operations written to the submission queue. The kernel consumes submission queue entries when
+// it's entered, the ones left are submitted again.
+func (r *Ring) enter(n uint32) {
+	for n > 0 {
+		submitted, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(n), 0, 0, 0, 0)
+		switch errno {
+		case 0:
+			n -= uint32(submitted)
+		case unix.EINTR:
+		case unix.EAGAIN, unix.EBUSY:
+			// The kernel is short of memory, or completions must be reaped first
+			time.Sleep(time.Millisecond)
+		default:
+			// The ring is unusable, fail the operations that weren't submitted
+			r.failUnsubmitted(errno)
+			return
+		}
+	}
+}
+
+// failUnsubmitted fails the operations the kernel didn't consume, and removes them from the submission queue: their
+// memory is released once they completed, the kernel must never read them.
+func (r *Ring) failUnsubmitted(errno syscall.Errno) {
+	head := atomic.LoadUint32(r.sqHead)
+	tail := *r.sqTail
+	ids := make([]uint64, 0, tail-head)
+	for i := head; i != tail; i++ {
+		ids = append(ids, r.sqes[i&r.sqMask].userData)
+	}
+	atomic.StoreUint32(r.sqTail, head)
+	for _, id := range ids {
+		r.complete(id, -int32(errno))
+	}
+}
+
+// reapLoop waits for completions and dispatches all the ones available at once
+func (r *Ring) reapLoop() {
+	defer close(r.reapedC)
+	stopping := false
+	for {
+		head := *r.cqHead
+		tail := atomic.LoadUint32(r.cqTail)
+		if head == tail {
+			if stopping && r.inFlight() == 0 {
+				return
+			}
+			errno := waitCompletions(r.fd)
+			if errno != 0 && errno != unix.EINTR && errno != unix.EAGAIN && errno != unix.EBUSY {
+				// The ring is unusable
+				r.fail(errno)
+				return
+			}
+			continue
+		}
+		for ; head != tail; head++ {
+			c := r.cqes[head&r.cqMask]
+			if c.userData == closeUserData {
+				stopping = true
+				continue
+			}
+			r.complete(c.userData, c.res)
+		}
+		atomic.StoreUint32(r.cqHead, head)
+	}
+}
+
+// fail is called once the completions of the ring can't be reaped anymore: the operations in flight complete with
+// errno, so that nothing waits for them forever, and new operations fail with ErrRingClosed
+func (r *Ring) fail(errno syscall.Errno) {
+	r.lock.Lock()
+	r.failed = true
+	r.closeOnce.Do(func() { close(r.closedC) })
+	ops := r.ops
+	r.ops = make(map[uint64]*op)
+	r.pending = nil
+	r.lock.Unlock()
+
+	for _, o := range ops {
+		o.res = -int32(errno)
+		close(o.done)
+		if o.slots != nil {
+			<-o.slots
+		}
+	}
+}
+
+func (r *Ring) complete(id uint64, res int32) {
+	r.lock.Lock()
+	o, ok := r.ops[id]
+	delete(r.ops, id)
+	r.lock.Unlock()
+	if !ok {
+		return
+	}
+	o.res = res
+	close(o.done)
+	if o.slots != nil {
+		<-o.slots
+	}
+}
+
+func (r *Ring) inFlight() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.ops)
+}
@@ -0,0 +1,185 @@
+// Package kubernetes publishes Kubernetes Ingress resources through a tunnel, with a minimal client of the
+// Kubernetes API covering the few resources it reads.
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	ingressesPath     = "/apis/networking.k8s.io/v1"
+)
+
+// errWatchExpired is returned by Watch when the resource version to watch from is too old, and resources must be
+// listed again
+var errWatchExpired = errors.New("watch expired")
+
+// apiStatus is the status the API server responds with on failure
+type apiStatus struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+// Client reads resources of the Kubernetes API
+type Client struct {
+	apiURL *url.URL
+	// Read for each request, as service account tokens are rotated
+	tokenFile  string
+	httpClient *http.Client
+}
+
+// NewInClusterClient creates a client authenticated with the service account of the pod it runs in
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	ca, err := ioutil.ReadFile(path.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the Kubernetes API certificate authority")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("invalid Kubernetes API certificate authority")
+	}
+	apiURL := &url.URL{Scheme: "https", Host: net.JoinHostPort(host, port)}
+	return NewClient(apiURL, path.Join(serviceAccountDir, "token"), &tls.Config{RootCAs: pool}), nil
+}
+
+// NewClient creates a client of the API at apiURL, authenticated with the bearer token of tokenFile if it isn't empty
+func NewClient(apiURL *url.URL, tokenFile string, tlsConfig *tls.Config) *Client {
+	return &Client{
+		apiURL:    apiURL,
+		tokenFile: tokenFile,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}
+}
+
+// ListIngresses lists the ingresses of namespace, or of all namespaces if it's empty
+func (c *Client) ListIngresses(ctx context.Context, namespace string) (*IngressList, error) {
+	var list IngressList
+	if err := c.getJSON(ctx, resourcePath(ingressesPath, namespace, "ingresses"), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// WatchIngresses calls handle with the changes of ingresses of namespace after resourceVersion, until the API server
+// ends the watch, handle returns an error or ctx is done
+func (c *Client) WatchIngresses(ctx context.Context, namespace, resourceVersion string, handle func(IngressEvent) error) error {
+	query := url.Values{
+		"watch":               {"1"},
+		"resourceVersion":     {resourceVersion},
+		"allowWatchBookmarks": {"true"},
+	}
+	resp, err := c.get(ctx, resourcePath(ingressesPath, namespace, "ingresses"), query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event IngressEvent
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "failed to read ingress watch")
+		}
+		if event.Type == "ERROR" {
+			var status apiStatus
+			if err := json.Unmarshal(event.RawObject, &status); err == nil && status.Code == http.StatusGone {
+				return errWatchExpired
+			}
+			return fmt.Errorf("ingress watch failed: %s", event.RawObject)
+		}
+		if err := json.Unmarshal(event.RawObject, &event.Object); err != nil {
+			return errors.Wrap(err, "invalid ingress watch event")
+		}
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+}
+
+// GetService gets the service name of namespace
+func (c *Client) GetService(ctx context.Context, namespace, name string) (*Service, error) {
+	var service Service
+	servicePath := path.Join(resourcePath("/api/v1", namespace, "services"), name)
+	if err := c.getJSON(ctx, servicePath, nil, &service); err != nil {
+		return nil, err
+	}
+	return &service, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, resourcePath string, query url.Values, v interface{}) error {
+	resp, err := c.get(ctx, resourcePath, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrapf(err, "invalid response to %s", resourcePath)
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, resourcePath string, query url.Values) (*http.Response, error) {
+	u := *c.apiURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + resourcePath
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.tokenFile != "" {
+		token, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the Kubernetes API token")
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var status apiStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err == nil && status.Message != "" {
+			return nil, fmt.Errorf("GET %s: %s", resourcePath, status.Message)
+		}
+		return nil, fmt.Errorf("GET %s: %s", resourcePath, resp.Status)
+	}
+	return resp, nil
+}
+
+func resourcePath(group, namespace, resource string) string {
+	if namespace == "" {
+		return path.Join(group, resource)
+	}
+	return path.Join(group, "namespaces", namespace, resource)
+}
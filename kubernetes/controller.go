@@ -0,0 +1,181 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/retry"
+)
+
+const (
+	watchMaxRetries = 5
+	watchBaseTime   = time.Second
+)
+
+// skippedResyncInterval is how often ingresses are listed again while some of their backends are skipped, since
+// services aren't watched. It's lowered in tests.
+var skippedResyncInterval = 30 * time.Second
+
+// Controller publishes the ingresses of an ingress class through a tunnel, updating its ingress rules and DNS routes
+// as ingresses change
+type Controller struct {
+	client    *Client
+	class     string
+	namespace string
+	// apply replaces the ingress rules of the tunnel
+	apply func([]config.UnvalidatedIngressRule) error
+	// router routes the hostnames of the rules to the tunnel
+	router *config.HostnameRouter
+	log    *zerolog.Logger
+
+	ingresses map[string]Ingress
+	applied   []config.UnvalidatedIngressRule
+}
+
+// NewController creates a controller publishing the ingresses of class in namespace, or in all namespaces if it's
+// empty
+func NewController(
+	client *Client,
+	class, namespace string,
+	apply func([]config.UnvalidatedIngressRule) error,
+	routeHostname func(hostname string) error,
+	log *zerolog.Logger,
+) *Controller {
+	return &Controller{
+		client:    client,
+		class:     class,
+		namespace: namespace,
+		apply:     apply,
+		router:    config.NewHostnameRouter(routeHostname, log),
+		log:       log,
+	}
+}
+
+// Run lists and watches ingresses until ctx is done, listing them again whenever the watch fails
+func (c *Controller) Run(ctx context.Context) error {
+	backoff := retry.BackoffHandler{MaxRetries: watchMaxRetries, RetryForever: true, BaseTime: watchBaseTime}
+	for {
+		err := c.listAndWatch(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		// The API server ends watches after a while
+		if err == nil || err == errWatchExpired {
+			c.log.Debug().Err(err).Msg("Ingress watch ended, listing ingresses again")
+			continue
+		}
+		c.log.Err(err).Msg("Failed to watch Kubernetes ingresses")
+		if !backoff.Backoff(ctx) {
+			return nil
+		}
+	}
+}
+
+func (c *Controller) listAndWatch(ctx context.Context) error {
+	list, err := c.client.ListIngresses(ctx, c.namespace)
+	if err != nil {
+		return errors.Wrap(err, "failed to list ingresses")
+	}
+	c.ingresses = make(map[string]Ingress, len(list.Items))
+	for _, ing := range list.Items {
+		c.ingresses[ingressKey(&ing)] = ing
+	}
+
+	// The watch ends to list ingresses again after skippedResyncInterval once a backend is skipped
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	defer cancelWatch()
+	var resync *time.Timer
+	defer func() {
+		if resync != nil {
+			resync.Stop()
+		}
+	}()
+	syncRules := func() {
+		if !c.sync(ctx) && resync == nil {
+			resync = time.AfterFunc(skippedResyncInterval, cancelWatch)
+		}
+	}
+	syncRules()
+
+	err = c.client.WatchIngresses(watchCtx, c.namespace, list.Metadata.ResourceVersion, func(event IngressEvent) error {
+		key := ingressKey(&event.Object)
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			c.ingresses[key] = event.Object
+		case "DELETED":
+			delete(c.ingresses, key)
+		default:
+			return nil
+		}
+		c.log.Debug().Str("ingress", key).Str("event", event.Type).Msg("Kubernetes ingress changed")
+		syncRules()
+		return nil
+	})
+	if watchCtx.Err() != nil && ctx.Err() == nil {
+		c.log.Debug().Msg("Listing ingresses again to resolve the skipped backends")
+		return nil
+	}
+	return err
+}
+
+// sync applies the rules of the current ingresses if they changed, without the backends that can't be converted. It
+// returns false if some were skipped or the rules couldn't be applied, to try again later.
+func (c *Controller) sync(ctx context.Context) bool {
+	keys := make([]string, 0, len(c.ingresses))
+	for key, ing := range c.ingresses {
+		if ing.MatchesClass(c.class) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	ingresses := make([]Ingress, 0, len(keys))
+	for _, key := range keys {
+		ingresses = append(ingresses, c.ingresses[key])
+	}
+
+	rules, skipped := TunnelIngressRules(ctx, ingresses, c.resolveService)
+	for _, err := range skipped {
+		c.log.Warn().Err(err).Msg("Skipped a backend of a Kubernetes ingress that can't be converted to a tunnel ingress rule")
+	}
+	if !reflect.DeepEqual(rules, c.applied) {
+		if err := c.apply(rules); err != nil {
+			c.log.Err(err).Msg("Failed to update tunnel ingress rules from Kubernetes ingresses")
+			return false
+		}
+		c.applied = rules
+		c.log.Info().Int("ingresses", len(ingresses)).Int("rules", len(rules)).Msg("Updated tunnel ingress rules from Kubernetes ingresses")
+	}
+	c.router.RouteHostnames(rules)
+	return len(skipped) == 0
+}
+
+func (c *Controller) resolveService(ctx context.Context, namespace string, backend *IngressBackend) (string, error) {
+	if backend.Service == nil {
+		return "", fmt.Errorf("only service backends are supported")
+	}
+	port := backend.Service.Port
+	if port.Number != 0 {
+		return serviceURL(namespace, backend, port)
+	}
+	service, err := c.client.GetService(ctx, namespace, backend.Service.Name)
+	if err != nil {
+		return "", err
+	}
+	for _, servicePort := range service.Spec.Ports {
+		if servicePort.Name == port.Name {
+			return serviceURL(namespace, backend, ServicePort{Name: servicePort.Name, Number: servicePort.Port})
+		}
+	}
+	return serviceURL(namespace, backend, port)
+}
+
+func ingressKey(ing *Ingress) string {
+	return ing.Metadata.Namespace + "/" + ing.Metadata.Name
+}
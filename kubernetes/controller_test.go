@@ -0,0 +1,207 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+const (
+	testIngressList = `{
+		"metadata": {"resourceVersion": "10"},
+		"items": [
+			{"metadata": {"name": "web", "namespace": "prod"}, "spec": {"ingressClassName": "cloudflared", "rules": [
+				{"host": "app.example.com", "http": {"paths": [{"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "app", "port": {"name": "https"}}}}]}}
+			]}},
+			{"metadata": {"name": "other", "namespace": "prod"}, "spec": {"ingressClassName": "nginx", "rules": [
+				{"host": "other.example.com", "http": {"paths": [{"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "other", "port": {"number": 80}}}}]}}
+			]}}
+		]
+	}`
+	testIngressEvents = `{"type": "BOOKMARK", "object": {"metadata": {"resourceVersion": "11"}}}
+{"type": "ADDED", "object": {"metadata": {"name": "docs", "namespace": "prod"}, "spec": {"ingressClassName": "cloudflared", "rules": [
+	{"host": "docs.example.com", "http": {"paths": [{"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "docs", "port": {"number": 80}}}}]}}
+]}}}
+{"type": "DELETED", "object": {"metadata": {"name": "web", "namespace": "prod"}}}
+`
+	testService = `{"metadata": {"name": "app", "namespace": "prod"}, "spec": {"ports": [{"name": "https", "port": 8443}]}}`
+)
+
+func newTestAPIServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/apis/networking.k8s.io/v1/namespaces/prod/ingresses" && r.URL.Query().Get("watch") == "":
+			fmt.Fprint(w, testIngressList)
+		case r.URL.Path == "/apis/networking.k8s.io/v1/namespaces/prod/ingresses":
+			assert.Equal(t, "10", r.URL.Query().Get("resourceVersion"))
+			fmt.Fprint(w, testIngressEvents)
+			w.(http.Flusher).Flush()
+			// Keep the watch open like the API server does
+			<-r.Context().Done()
+		case r.URL.Path == "/api/v1/namespaces/prod/services/app":
+			fmt.Fprint(w, testService)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind": "Status", "message": "not found", "code": 404}`)
+		}
+	}))
+}
+
+func TestController(t *testing.T) {
+	server := newTestAPIServer(t)
+	defer server.Close()
+	apiURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	var lock sync.Mutex
+	var applied [][]config.UnvalidatedIngressRule
+	var routed []string
+	apply := func(rules []config.UnvalidatedIngressRule) error {
+		lock.Lock()
+		defer lock.Unlock()
+		applied = append(applied, rules)
+		return nil
+	}
+	routeHostname := func(hostname string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		routed = append(routed, hostname)
+		return nil
+	}
+
+	log := zerolog.Nop()
+	controller := NewController(NewClient(apiURL, "", nil), "cloudflared", "prod", apply, routeHostname, &log)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- controller.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(applied) == 3
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.Equal(t, [][]config.UnvalidatedIngressRule{
+		{
+			{Hostname: "app.example.com", Service: "https://app.prod.svc:8443"},
+			{Service: notFoundService},
+		},
+		{
+			{Hostname: "docs.example.com", Service: "http://docs.prod.svc:80"},
+			{Hostname: "app.example.com", Service: "https://app.prod.svc:8443"},
+			{Service: notFoundService},
+		},
+		{
+			{Hostname: "docs.example.com", Service: "http://docs.prod.svc:80"},
+			{Service: notFoundService},
+		},
+	}, applied)
+	assert.Equal(t, []string{"app.example.com", "docs.example.com"}, routed)
+}
+
+func TestClientError(t *testing.T) {
+	server := newTestAPIServer(t)
+	defer server.Close()
+	apiURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	_, err = NewClient(apiURL, "", nil).GetService(context.Background(), "prod", "missing")
+	assert.EqualError(t, err, "GET /api/v1/namespaces/prod/services/missing: not found")
+}
+
+func TestControllerSkipsBrokenIngress(t *testing.T) {
+	const ingressList = `{
+		"metadata": {"resourceVersion": "10"},
+		"items": [
+			{"metadata": {"name": "broken", "namespace": "prod"}, "spec": {"ingressClassName": "cloudflared", "rules": [
+				{"host": "bucket.example.com", "http": {"paths": [{"path": "/", "pathType": "Prefix", "backend": {"resource": {"kind": "StorageBucket", "name": "assets"}}}]}},
+				{"host": "pending.example.com", "http": {"paths": [{"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "pending", "port": {"name": "http"}}}}]}}
+			]}},
+			{"metadata": {"name": "web", "namespace": "prod"}, "spec": {"ingressClassName": "cloudflared", "rules": [
+				{"host": "app.example.com", "http": {"paths": [{"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "app", "port": {"number": 80}}}}]}}
+			]}}
+		]
+	}`
+	// The pending service is created after the ingress referencing it
+	var serviceCreated int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/apis/networking.k8s.io/v1/namespaces/prod/ingresses" && r.URL.Query().Get("watch") == "":
+			fmt.Fprint(w, ingressList)
+		case r.URL.Path == "/apis/networking.k8s.io/v1/namespaces/prod/ingresses":
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		case r.URL.Path == "/api/v1/namespaces/prod/services/pending" && atomic.LoadInt32(&serviceCreated) == 1:
+			fmt.Fprint(w, `{"metadata": {"name": "pending", "namespace": "prod"}, "spec": {"ports": [{"name": "http", "port": 8080}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind": "Status", "message": "not found", "code": 404}`)
+		}
+	}))
+	defer server.Close()
+	apiURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	skippedResyncInterval = 50 * time.Millisecond
+	defer func() { skippedResyncInterval = 30 * time.Second }()
+
+	var lock sync.Mutex
+	var applied [][]config.UnvalidatedIngressRule
+	apply := func(rules []config.UnvalidatedIngressRule) error {
+		lock.Lock()
+		defer lock.Unlock()
+		applied = append(applied, rules)
+		return nil
+	}
+	appliedRules := func() [][]config.UnvalidatedIngressRule {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([][]config.UnvalidatedIngressRule(nil), applied...)
+	}
+
+	log := zerolog.Nop()
+	controller := NewController(NewClient(apiURL, "", nil), "cloudflared", "prod", apply, func(string) error { return nil }, &log)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- controller.Run(ctx)
+	}()
+
+	// The valid ingress is published without the backends of the broken one
+	require.Eventually(t, func() bool {
+		return len(appliedRules()) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []config.UnvalidatedIngressRule{
+		{Hostname: "app.example.com", Service: "http://app.prod.svc:80"},
+		{Service: notFoundService},
+	}, appliedRules()[0])
+
+	// The skipped backend is published once its service exists, without any ingress event
+	atomic.StoreInt32(&serviceCreated, 1)
+	require.Eventually(t, func() bool {
+		return len(appliedRules()) == 2
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, []config.UnvalidatedIngressRule{
+		{Hostname: "pending.example.com", Service: "http://pending.prod.svc:8080"},
+		{Hostname: "app.example.com", Service: "http://app.prod.svc:80"},
+		{Service: notFoundService},
+	}, appliedRules()[1])
+}
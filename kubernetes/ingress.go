@@ -0,0 +1,201 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+const (
+	ingressClassAnnotation = "kubernetes.io/ingress.class"
+	// Served when no rule of the published ingresses matches a request
+	notFoundService = "http_status:404"
+
+	pathTypeExact = "Exact"
+)
+
+// ObjectMeta is the metadata of a Kubernetes resource
+type ObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Annotations     map[string]string `json:"annotations"`
+}
+
+// IngressList is a list of networking.k8s.io/v1 ingresses
+type IngressList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []Ingress `json:"items"`
+}
+
+// IngressEvent is a change of an ingress, Type is one of ADDED, MODIFIED, DELETED or BOOKMARK
+type IngressEvent struct {
+	Type      string          `json:"type"`
+	RawObject json.RawMessage `json:"object"`
+	Object    Ingress         `json:"-"`
+}
+
+// Ingress is the subset of a networking.k8s.io/v1 ingress used to publish it through a tunnel
+type Ingress struct {
+	Metadata ObjectMeta  `json:"metadata"`
+	Spec     IngressSpec `json:"spec"`
+}
+
+type IngressSpec struct {
+	IngressClassName *string         `json:"ingressClassName"`
+	DefaultBackend   *IngressBackend `json:"defaultBackend"`
+	Rules            []IngressRule   `json:"rules"`
+}
+
+type IngressRule struct {
+	Host string `json:"host"`
+	HTTP *struct {
+		Paths []HTTPIngressPath `json:"paths"`
+	} `json:"http"`
+}
+
+type HTTPIngressPath struct {
+	Path     string         `json:"path"`
+	PathType string         `json:"pathType"`
+	Backend  IngressBackend `json:"backend"`
+}
+
+type IngressBackend struct {
+	Service *struct {
+		Name string      `json:"name"`
+		Port ServicePort `json:"port"`
+	} `json:"service"`
+}
+
+// ServicePort refers to a port of the service of an ingress backend by name or number
+type ServicePort struct {
+	Name   string `json:"name"`
+	Number int32  `json:"number"`
+}
+
+// Service is the subset of a v1 service used to resolve named ports
+type Service struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Ports []struct {
+			Name string `json:"name"`
+			Port int32  `json:"port"`
+		} `json:"ports"`
+	} `json:"spec"`
+}
+
+// MatchesClass returns whether the ingress is of class, set either by its class name or by the legacy annotation
+func (ing *Ingress) MatchesClass(class string) bool {
+	if ing.Spec.IngressClassName != nil {
+		return *ing.Spec.IngressClassName == class
+	}
+	return ing.Metadata.Annotations[ingressClassAnnotation] == class
+}
+
+// serviceResolver resolves the port of a service of namespace
+type serviceResolver func(ctx context.Context, namespace string, backend *IngressBackend) (string, error)
+
+// ingressRule is a rule of the tunnel ingress, with what is needed to sort it
+type ingressRule struct {
+	config.UnvalidatedIngressRule
+	exact      bool
+	pathLength int
+}
+
+// TunnelIngressRules converts ingresses to rules of the tunnel ingress. Rules with a hostname come before rules
+// without one, exact paths before prefixes, and longer prefixes before shorter ones, following the precedence of
+// Kubernetes ingress. The last rule serves the first default backend, or 404 if no ingress has one.
+// Backends whose service can't be resolved are skipped, so that one broken ingress doesn't hold back the others, and
+// returned as errors.
+func TunnelIngressRules(ctx context.Context, ingresses []Ingress, resolve serviceResolver) ([]config.UnvalidatedIngressRule, []error) {
+	var rules []ingressRule
+	var catchAll string
+	var skipped []error
+	for i := range ingresses {
+		ing := &ingresses[i]
+		namespace := ing.Metadata.Namespace
+		if ing.Spec.DefaultBackend != nil && catchAll == "" {
+			service, err := resolve(ctx, namespace, ing.Spec.DefaultBackend)
+			if err != nil {
+				skipped = append(skipped, fmt.Errorf("ingress %s/%s: default backend: %w", namespace, ing.Metadata.Name, err))
+			} else {
+				catchAll = service
+			}
+		}
+		for _, rule := range ing.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				service, err := resolve(ctx, namespace, &path.Backend)
+				if err != nil {
+					skipped = append(skipped, fmt.Errorf("ingress %s/%s: path %q of host %q: %w", namespace, ing.Metadata.Name, path.Path, rule.Host, err))
+					continue
+				}
+				rules = append(rules, ingressRule{
+					UnvalidatedIngressRule: config.UnvalidatedIngressRule{
+						Hostname: rule.Host,
+						Path:     pathRegexp(path.Path, path.PathType),
+						Service:  service,
+					},
+					exact:      path.PathType == pathTypeExact,
+					pathLength: len(path.Path),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		if (rules[i].Hostname != "") != (rules[j].Hostname != "") {
+			return rules[i].Hostname != ""
+		}
+		if rules[i].exact != rules[j].exact {
+			return rules[i].exact
+		}
+		return rules[i].pathLength > rules[j].pathLength
+	})
+
+	if catchAll == "" {
+		catchAll = notFoundService
+	}
+	converted := make([]config.UnvalidatedIngressRule, 0, len(rules)+1)
+	for _, rule := range rules {
+		converted = append(converted, rule.UnvalidatedIngressRule)
+	}
+	return append(converted, config.UnvalidatedIngressRule{Service: catchAll}), skipped
+}
+
+// pathRegexp converts the path of an ingress to the path regular expression of a tunnel ingress rule. Prefixes
+// match whole path elements, and paths of ImplementationSpecific type are treated as prefixes.
+func pathRegexp(path, pathType string) string {
+	if path == "" || (path == "/" && pathType != pathTypeExact) {
+		return ""
+	}
+	if pathType == pathTypeExact {
+		return "^" + regexp.QuoteMeta(path) + "$"
+	}
+	// A trailing slash of a prefix is ignored, /foo/ matches /foo
+	return "^" + regexp.QuoteMeta(strings.TrimSuffix(path, "/")) + "(/|$)"
+}
+
+// serviceURL returns the URL of the service of backend, using HTTPS for port 443 or a port named https
+func serviceURL(namespace string, backend *IngressBackend, port ServicePort) (string, error) {
+	if backend.Service == nil {
+		return "", fmt.Errorf("only service backends are supported")
+	}
+	if port.Number == 0 {
+		return "", fmt.Errorf("service %s has no port %q", backend.Service.Name, port.Name)
+	}
+	scheme := "http"
+	if port.Number == 443 || port.Name == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s.%s.svc:%d", scheme, backend.Service.Name, namespace, port.Number), nil
+}
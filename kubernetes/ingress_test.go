@@ -0,0 +1,119 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+func mustParseIngress(t *testing.T, raw string) Ingress {
+	var ing Ingress
+	require.NoError(t, json.Unmarshal([]byte(raw), &ing))
+	return ing
+}
+
+func numberedPorts(_ context.Context, namespace string, backend *IngressBackend) (string, error) {
+	return serviceURL(namespace, backend, backend.Service.Port)
+}
+
+func TestMatchesClass(t *testing.T) {
+	byName := mustParseIngress(t, `{"spec": {"ingressClassName": "cloudflared"}}`)
+	byAnnotation := mustParseIngress(t, `{"metadata": {"annotations": {"kubernetes.io/ingress.class": "cloudflared"}}}`)
+	// The class name takes precedence over the annotation
+	other := mustParseIngress(t, `{"metadata": {"annotations": {"kubernetes.io/ingress.class": "cloudflared"}}, "spec": {"ingressClassName": "nginx"}}`)
+
+	assert.True(t, byName.MatchesClass("cloudflared"))
+	assert.True(t, byAnnotation.MatchesClass("cloudflared"))
+	assert.False(t, other.MatchesClass("cloudflared"))
+	assert.False(t, byName.MatchesClass("nginx"))
+}
+
+func TestTunnelIngressRules(t *testing.T) {
+	ing := mustParseIngress(t, `{
+		"metadata": {"name": "web", "namespace": "prod"},
+		"spec": {
+			"defaultBackend": {"service": {"name": "fallback", "port": {"number": 80}}},
+			"rules": [
+				{"http": {"paths": [{"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "any", "port": {"number": 80}}}}]}},
+				{"host": "app.example.com", "http": {"paths": [
+					{"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "app", "port": {"number": 8080}}}},
+					{"path": "/api/", "pathType": "Prefix", "backend": {"service": {"name": "api", "port": {"number": 443}}}},
+					{"path": "/health", "pathType": "Exact", "backend": {"service": {"name": "health", "port": {"number": 8081}}}}
+				]}}
+			]
+		}
+	}`)
+
+	rules, skipped := TunnelIngressRules(context.Background(), []Ingress{ing}, numberedPorts)
+	require.Empty(t, skipped)
+	assert.Equal(t, []config.UnvalidatedIngressRule{
+		{Hostname: "app.example.com", Path: `^/health$`, Service: "http://health.prod.svc:8081"},
+		{Hostname: "app.example.com", Path: `^/api(/|$)`, Service: "https://api.prod.svc:443"},
+		{Hostname: "app.example.com", Service: "http://app.prod.svc:8080"},
+		{Service: "http://any.prod.svc:80"},
+		{Service: "http://fallback.prod.svc:80"},
+	}, rules)
+}
+
+func TestTunnelIngressRulesNotFound(t *testing.T) {
+	rules, skipped := TunnelIngressRules(context.Background(), nil, numberedPorts)
+	require.Empty(t, skipped)
+	assert.Equal(t, []config.UnvalidatedIngressRule{{Service: "http_status:404"}}, rules)
+}
+
+func TestTunnelIngressRulesResolveError(t *testing.T) {
+	broken := mustParseIngress(t, `{
+		"metadata": {"name": "broken", "namespace": "prod"},
+		"spec": {
+			"defaultBackend": {"service": {"name": "missing"}},
+			"rules": [{"host": "broken.example.com", "http": {"paths": [{"path": "/", "backend": {}}]}}]
+		}
+	}`)
+	ing := mustParseIngress(t, `{
+		"metadata": {"name": "web", "namespace": "prod"},
+		"spec": {"rules": [{"host": "app.example.com", "http": {"paths": [
+			{"path": "/", "backend": {"service": {"name": "app", "port": {"number": 80}}}}
+		]}}]}
+	}`)
+	resolve := func(ctx context.Context, namespace string, backend *IngressBackend) (string, error) {
+		if backend.Service == nil || backend.Service.Port.Number == 0 {
+			return "", fmt.Errorf("no service")
+		}
+		return numberedPorts(ctx, namespace, backend)
+	}
+
+	// The backends of the broken ingress are skipped, the other ingress is still converted
+	rules, skipped := TunnelIngressRules(context.Background(), []Ingress{broken, ing}, resolve)
+	assert.Equal(t, []config.UnvalidatedIngressRule{
+		{Hostname: "app.example.com", Service: "http://app.prod.svc:80"},
+		{Service: notFoundService},
+	}, rules)
+	require.Len(t, skipped, 2)
+	assert.EqualError(t, skipped[0], "ingress prod/broken: default backend: no service")
+	assert.EqualError(t, skipped[1], `ingress prod/broken: path "/" of host "broken.example.com": no service`)
+}
+
+func TestPathRegexp(t *testing.T) {
+	tests := []struct {
+		path     string
+		pathType string
+		expected string
+	}{
+		{"", "Prefix", ""},
+		{"/", "Prefix", ""},
+		{"/", "Exact", `^/$`},
+		{"/foo", "Prefix", `^/foo(/|$)`},
+		{"/foo/", "Prefix", `^/foo(/|$)`},
+		{"/foo", "ImplementationSpecific", `^/foo(/|$)`},
+		{"/v1.0", "Exact", `^/v1\.0$`},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, pathRegexp(test.path, test.pathType), test.path)
+	}
+}
@@ -0,0 +1,105 @@
+package l4policy
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/watcher"
+)
+
+var decisions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "cloudflared",
+		Subsystem: "warp_routing",
+		Name:      "policy_decisions_total",
+		Help:      "Count of flows of WARP clients allowed and denied by the connector policy",
+	},
+	[]string{"protocol", "decision"},
+)
+
+func init() {
+	prometheus.MustRegister(decisions)
+}
+
+// Engine evaluates flows with the policy of a file, reloaded when the file changes
+type Engine struct {
+	path   string
+	policy atomic.Value
+	log    *zerolog.Logger
+}
+
+// NewEngine loads the policy of path. Call Run to reload it when the file changes.
+func NewEngine(path string, log *zerolog.Logger) (*Engine, error) {
+	policy, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &Engine{
+		path: path,
+		log:  log,
+	}
+	e.policy.Store(policy)
+	return e, nil
+}
+
+// Allowed decides whether a flow to ip:port is allowed, counting the decision. A nil Engine allows all flows.
+func (e *Engine) Allowed(protocol Protocol, ip net.IP, port uint16) bool {
+	if e == nil {
+		return true
+	}
+	decision := e.policy.Load().(*Policy).Evaluate(protocol, ip, port)
+	if decision.Allowed {
+		decisions.WithLabelValues(string(protocol), actionAllow).Inc()
+		return true
+	}
+	decisions.WithLabelValues(string(protocol), actionDeny).Inc()
+	e.log.Debug().
+		Str("protocol", string(protocol)).
+		Str("dest", net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))).
+		Int("rule", decision.Rule).
+		Msg("Flow denied by the warp-routing policy")
+	return false
+}
+
+// Run reloads the policy when its file changes, until ctx is done. An invalid policy is logged and the previous
+// policy is kept.
+func (e *Engine) Run(ctx context.Context) error {
+	fileWatcher, err := watcher.NewFile()
+	if err != nil {
+		return err
+	}
+	if err := fileWatcher.Add(e.path); err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		fileWatcher.Shutdown()
+	}()
+	fileWatcher.Start(e)
+	return nil
+}
+
+// WatcherItemDidChange reloads the policy
+func (e *Engine) WatcherItemDidChange(_ string) {
+	e.reload()
+}
+
+// WatcherDidError logs errors watching the policy file
+func (e *Engine) WatcherDidError(err error) {
+	e.log.Err(err).Msg("warp-routing policy watcher encountered an error")
+}
+
+func (e *Engine) reload() {
+	policy, err := Load(e.path)
+	if err != nil {
+		e.log.Err(err).Str("path", e.path).Msg("Failed to reload the warp-routing policy, keeping the previous one")
+		return
+	}
+	e.policy.Store(policy)
+	e.log.Info().Str("path", e.path).Msg("Reloaded the warp-routing policy")
+}
@@ -0,0 +1,51 @@
+package l4policy
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("default: allow\n"), 0600))
+	log := zerolog.Nop()
+	engine, err := NewEngine(path, &log)
+	require.NoError(t, err)
+
+	ip := net.ParseIP("10.0.0.1")
+	denied := testutil.ToFloat64(decisions.WithLabelValues("tcp", "deny"))
+	assert.True(t, engine.Allowed(TCP, ip, 22))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = engine.Run(ctx)
+	}()
+
+	// Invalid policies are ignored
+	require.Eventually(t, func() bool {
+		require.NoError(t, os.WriteFile(path, []byte("default: nope\n"), 0600))
+		require.NoError(t, os.WriteFile(path, []byte("default: deny\n"), 0600))
+		return !engine.Allowed(TCP, ip, 22)
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Greater(t, testutil.ToFloat64(decisions.WithLabelValues("tcp", "deny")), denied)
+
+	engine.WatcherItemDidChange(path)
+	require.NoError(t, os.WriteFile(path, []byte("default: nope\n"), 0600))
+	engine.reload()
+	assert.False(t, engine.Allowed(TCP, ip, 22))
+}
+
+func TestNilEngineAllows(t *testing.T) {
+	var engine *Engine
+	assert.True(t, engine.Allowed(UDP, net.ParseIP("10.0.0.1"), 53))
+}
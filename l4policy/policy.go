@@ -0,0 +1,212 @@
+// Package l4policy evaluates allow and deny rules for the private network traffic of WARP clients, before cloudflared
+// dials the destinations. The rules are defense in depth below the policies of the Zero Trust dashboard.
+//
+// Flows are matched by protocol, destination IP and port. The edge doesn't send the virtual network of flows to
+// cloudflared, so a policy applies to the flows of all the virtual networks routed to the tunnel.
+package l4policy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Protocol of a flow
+type Protocol string
+
+const (
+	TCP Protocol = "tcp"
+	UDP Protocol = "udp"
+)
+
+const (
+	actionAllow = "allow"
+	actionDeny  = "deny"
+)
+
+// Policy is an ordered list of rules, the first rule matching a flow decides whether it's allowed. Flows matching
+// no rule are denied, unless the default is allow.
+type Policy struct {
+	defaultAllow bool
+	rules        []rule
+}
+
+type rule struct {
+	allow        bool
+	destinations []*net.IPNet
+	ports        []portRange
+	protocols    []Protocol
+}
+
+type portRange struct {
+	first, last uint16
+}
+
+// policyFile is the YAML format of a policy:
+//
+//	default: deny
+//	rules:
+//	  - action: allow
+//	    destinations: [10.0.0.0/8]
+//	    ports: ["443", "8000-8999"]
+//	    protocols: [tcp]
+type policyFile struct {
+	Default string `yaml:"default"`
+	Rules   []struct {
+		Action       string   `yaml:"action"`
+		Destinations []string `yaml:"destinations"`
+		Ports        []string `yaml:"ports"`
+		Protocols    []string `yaml:"protocols"`
+	} `yaml:"rules"`
+}
+
+// Load reads a policy from a YAML file
+func Load(path string) (*Policy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(content)
+}
+
+// Parse parses a policy in YAML. Rules without destinations, ports or protocols match all of them.
+func Parse(content []byte) (*Policy, error) {
+	var file policyFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, errors.Wrap(err, "invalid policy")
+	}
+
+	policy := &Policy{}
+	switch file.Default {
+	case "", actionDeny:
+	case actionAllow:
+		policy.defaultAllow = true
+	default:
+		return nil, fmt.Errorf("invalid default %q, expected %s or %s", file.Default, actionAllow, actionDeny)
+	}
+
+	for i, fileRule := range file.Rules {
+		var r rule
+		switch fileRule.Action {
+		case actionAllow:
+			r.allow = true
+		case actionDeny:
+		default:
+			return nil, fmt.Errorf("rule #%d: invalid action %q, expected %s or %s", i+1, fileRule.Action, actionAllow, actionDeny)
+		}
+		for _, destination := range fileRule.Destinations {
+			network, err := parseDestination(destination)
+			if err != nil {
+				return nil, errors.Wrapf(err, "rule #%d", i+1)
+			}
+			r.destinations = append(r.destinations, network)
+		}
+		for _, ports := range fileRule.Ports {
+			ports, err := parsePortRange(ports)
+			if err != nil {
+				return nil, errors.Wrapf(err, "rule #%d", i+1)
+			}
+			r.ports = append(r.ports, ports)
+		}
+		for _, protocol := range fileRule.Protocols {
+			switch p := Protocol(strings.ToLower(protocol)); p {
+			case TCP, UDP:
+				r.protocols = append(r.protocols, p)
+			default:
+				return nil, fmt.Errorf("rule #%d: invalid protocol %q, expected %s or %s", i+1, protocol, TCP, UDP)
+			}
+		}
+		policy.rules = append(policy.rules, r)
+	}
+	return policy, nil
+}
+
+// parseDestination parses a CIDR, or an IP as a network of only that IP
+func parseDestination(destination string) (*net.IPNet, error) {
+	if _, network, err := net.ParseCIDR(destination); err == nil {
+		return network, nil
+	}
+	ip := net.ParseIP(destination)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid destination %q, expected a CIDR or an IP", destination)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// parsePortRange parses a port, or a range of ports as first-last
+func parsePortRange(ports string) (portRange, error) {
+	firstStr, lastStr, isRange := strings.Cut(ports, "-")
+	first, err := strconv.ParseUint(strings.TrimSpace(firstStr), 10, 16)
+	if err != nil || first == 0 {
+		return portRange{}, fmt.Errorf("invalid port %q", ports)
+	}
+	last := first
+	if isRange {
+		last, err = strconv.ParseUint(strings.TrimSpace(lastStr), 10, 16)
+		if err != nil || last < first {
+			return portRange{}, fmt.Errorf("invalid port range %q", ports)
+		}
+	}
+	return portRange{first: uint16(first), last: uint16(last)}, nil
+}
+
+// Decision of a policy about a flow
+type Decision struct {
+	Allowed bool
+	// Rule is the number of the rule matching the flow, starting at 1, or 0 if the flow matched no rule
+	Rule int
+}
+
+// Evaluate decides whether a flow to ip:port is allowed
+func (p *Policy) Evaluate(protocol Protocol, ip net.IP, port uint16) Decision {
+	for i, r := range p.rules {
+		if r.matches(protocol, ip, port) {
+			return Decision{Allowed: r.allow, Rule: i + 1}
+		}
+	}
+	return Decision{Allowed: p.defaultAllow}
+}
+
+func (r *rule) matches(protocol Protocol, ip net.IP, port uint16) bool {
+	if len(r.protocols) > 0 && !containsProtocol(r.protocols, protocol) {
+		return false
+	}
+	if len(r.destinations) > 0 {
+		matched := false
+		for _, destination := range r.destinations {
+			if destination.Contains(ip) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.ports) > 0 {
+		for _, ports := range r.ports {
+			if ports.first <= port && port <= ports.last {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsProtocol(protocols []Protocol, protocol Protocol) bool {
+	for _, p := range protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package l4policy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+default: allow
+rules:
+  - action: allow
+    destinations: [10.0.1.10]
+    ports: ["22"]
+    protocols: [tcp]
+  - action: deny
+    destinations: [10.0.1.0/24, "fd00::/8"]
+  - action: deny
+    ports: ["3389", "5900-5999"]
+  - action: deny
+    protocols: [udp]
+    ports: ["53"]
+`
+
+func TestEvaluate(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+
+	tests := []struct {
+		protocol Protocol
+		ip       string
+		port     uint16
+		expected Decision
+	}{
+		{TCP, "10.0.1.10", 22, Decision{Allowed: true, Rule: 1}},
+		{UDP, "10.0.1.10", 22, Decision{Allowed: false, Rule: 2}},
+		{TCP, "10.0.1.10", 443, Decision{Allowed: false, Rule: 2}},
+		{TCP, "fd00::1", 443, Decision{Allowed: false, Rule: 2}},
+		{TCP, "10.0.2.1", 3389, Decision{Allowed: false, Rule: 3}},
+		{UDP, "10.0.2.1", 5999, Decision{Allowed: false, Rule: 3}},
+		{TCP, "10.0.2.1", 6000, Decision{Allowed: true}},
+		{UDP, "10.0.2.1", 53, Decision{Allowed: false, Rule: 4}},
+		{TCP, "10.0.2.1", 53, Decision{Allowed: true}},
+	}
+	for _, test := range tests {
+		decision := policy.Evaluate(test.protocol, net.ParseIP(test.ip), test.port)
+		assert.Equal(t, test.expected, decision, "%s %s:%d", test.protocol, test.ip, test.port)
+	}
+}
+
+func TestDefaultDeny(t *testing.T) {
+	policy, err := Parse([]byte(`
+rules:
+  - action: allow
+    destinations: [192.168.0.0/16]
+`))
+	require.NoError(t, err)
+	assert.True(t, policy.Evaluate(TCP, net.ParseIP("192.168.1.1"), 80).Allowed)
+	assert.False(t, policy.Evaluate(TCP, net.ParseIP("10.0.0.1"), 80).Allowed)
+
+	policy, err = Parse(nil)
+	require.NoError(t, err)
+	assert.False(t, policy.Evaluate(UDP, net.ParseIP("10.0.0.1"), 53).Allowed)
+}
+
+func TestParseInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"default: maybe":            `invalid default "maybe"`,
+		"rules: [{action: reject}]": `rule #1: invalid action "reject"`,
+		"rules: [{action: deny, destinations: [10.0.0.0/33]}]":        `rule #1: invalid destination "10.0.0.0/33"`,
+		"rules: [{action: deny, ports: ['0']}]":                       `rule #1: invalid port "0"`,
+		"rules: [{action: deny, ports: ['65536']}]":                   `rule #1: invalid port "65536"`,
+		"rules: [{action: deny, ports: ['90-80']}]":                   `rule #1: invalid port range "90-80"`,
+		"rules: [{action: allow}, {action: deny, protocols: [icmp]}]": `rule #2: invalid protocol "icmp"`,
+	}
+	for content, expected := range invalid {
+		_, err := Parse([]byte(content))
+		require.Error(t, err, content)
+		assert.Contains(t, err.Error(), expected, content)
+	}
+}
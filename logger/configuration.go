@@ -11,6 +11,10 @@ type Config struct {
 	ConsoleConfig *ConsoleConfig // If nil, the logger will not log into the console
 	FileConfig    *FileConfig    // If nil, the logger will not use an individual log file
 	RollingConfig *RollingConfig // If nil, the logger will not use a rolling log
+	SyslogConfig  *SyslogConfig  // If nil, the logger will not log into syslog
+
+	RedactionConfig *RedactionConfig // If nil, sensitive values will not be masked in the log output
+	DedupConfig     *DedupConfig     // If nil, identical recurring errors will not be collapsed
 
 	MinLevel string // debug | info | error | fatal
 }
@@ -37,6 +41,11 @@ type RollingConfig struct {
 	maxAge     int // days
 }
 
+// SyslogConfig logs into the syslog of the system, which is forwarded to the unified logging system on macOS
+type SyslogConfig struct {
+	Tag string
+}
+
 func createDefaultConfig() Config {
 	const minLevel = "info"
 
@@ -60,7 +69,8 @@ func createDefaultConfig() Config {
 			maxBackups: RollingMaxBackups,
 			maxAge:     RollingMaxAge,
 		},
-		MinLevel: minLevel,
+		RedactionConfig: createRedactionConfig(nil, nil),
+		MinLevel:        minLevel,
 	}
 }
 
@@ -91,6 +101,8 @@ func CreateConfig(
 		FileConfig:    file,
 		RollingConfig: rolling,
 
+		RedactionConfig: defaultConfig.RedactionConfig,
+
 		MinLevel: minLevel,
 	}
 }
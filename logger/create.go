@@ -26,6 +26,15 @@ const (
 	LogDirectoryFlag      = "log-directory"
 	LogTransportLevelFlag = "transport-loglevel"
 
+	LogErrorSummaryIntervalFlag          = "log-error-summary-interval"
+	LogTransportErrorSummaryIntervalFlag = "transport-log-error-summary-interval"
+
+	LogRedactHeaderFlag     = "log-redact-header"
+	LogRedactQueryParamFlag = "log-redact-query-param"
+	LogDisableRedactionFlag = "log-disable-redaction"
+
+	LogSyslogFlag = "log-syslog"
+
 	LogSSHDirectoryFlag = "log-directory"
 	LogSSHLevelFlag     = "log-level"
 
@@ -91,7 +100,22 @@ func newZerolog(loggerConfig *Config) *zerolog.Logger {
 		writers = append(writers, rollingLogger)
 	}
 
-	multi := resilientMultiWriter{writers}
+	if loggerConfig.SyslogConfig != nil {
+		syslogWriter, err := createSyslogWriter(*loggerConfig.SyslogConfig)
+		if err != nil {
+			return fallbackLogger(err)
+		}
+
+		writers = append(writers, syslogWriter)
+	}
+
+	var multi io.Writer = resilientMultiWriter{writers}
+	if loggerConfig.RedactionConfig != nil {
+		multi = newRedactingWriter(multi, *loggerConfig.RedactionConfig)
+	}
+	if loggerConfig.DedupConfig != nil && loggerConfig.DedupConfig.Interval > 0 {
+		multi = newDedupWriter(multi, *loggerConfig.DedupConfig)
+	}
 
 	level, levelErr := zerolog.ParseLevel(loggerConfig.MinLevel)
 	if levelErr != nil {
@@ -107,21 +131,22 @@ func newZerolog(loggerConfig *Config) *zerolog.Logger {
 }
 
 func CreateTransportLoggerFromContext(c *cli.Context, disableTerminal bool) *zerolog.Logger {
-	return createFromContext(c, LogTransportLevelFlag, LogDirectoryFlag, disableTerminal)
+	return createFromContext(c, LogTransportLevelFlag, LogDirectoryFlag, LogTransportErrorSummaryIntervalFlag, disableTerminal)
 }
 
 func CreateLoggerFromContext(c *cli.Context, disableTerminal bool) *zerolog.Logger {
-	return createFromContext(c, LogLevelFlag, LogDirectoryFlag, disableTerminal)
+	return createFromContext(c, LogLevelFlag, LogDirectoryFlag, LogErrorSummaryIntervalFlag, disableTerminal)
 }
 
 func CreateSSHLoggerFromContext(c *cli.Context, disableTerminal bool) *zerolog.Logger {
-	return createFromContext(c, LogSSHLevelFlag, LogSSHDirectoryFlag, disableTerminal)
+	return createFromContext(c, LogSSHLevelFlag, LogSSHDirectoryFlag, LogErrorSummaryIntervalFlag, disableTerminal)
 }
 
 func createFromContext(
 	c *cli.Context,
 	logLevelFlagName,
-	logDirectoryFlagName string,
+	logDirectoryFlagName,
+	errorSummaryIntervalFlagName string,
 	disableTerminal bool,
 ) *zerolog.Logger {
 	logLevel := c.String(logLevelFlagName)
@@ -134,6 +159,17 @@ func createFromContext(
 		logDirectory,
 		logFile,
 	)
+	if c.Bool(LogDisableRedactionFlag) {
+		loggerConfig.RedactionConfig = nil
+	} else {
+		loggerConfig.RedactionConfig = createRedactionConfig(c.StringSlice(LogRedactHeaderFlag), c.StringSlice(LogRedactQueryParamFlag))
+	}
+	if c.Bool(LogSyslogFlag) {
+		loggerConfig.SyslogConfig = &SyslogConfig{Tag: "cloudflared"}
+	}
+	if interval := c.Duration(errorSummaryIntervalFlagName); interval > 0 {
+		loggerConfig.DedupConfig = &DedupConfig{Interval: interval}
+	}
 
 	log := newZerolog(loggerConfig)
 	if incompatibleFlagsSet := logFile != "" && logDirectory != ""; incompatibleFlagsSet {
@@ -145,10 +181,9 @@ func createFromContext(
 func Create(loggerConfig *Config) *zerolog.Logger {
 	if loggerConfig == nil {
 		loggerConfig = &Config{
-			defaultConfig.ConsoleConfig,
-			nil,
-			nil,
-			defaultConfig.MinLevel,
+			ConsoleConfig:   defaultConfig.ConsoleConfig,
+			RedactionConfig: defaultConfig.RedactionConfig,
+			MinLevel:        defaultConfig.MinLevel,
 		}
 	}
 	return newZerolog(loggerConfig)
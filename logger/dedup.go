@@ -0,0 +1,124 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// Upper bound of distinct events tracked at once, further events are written as is.
+	maxTrackedEvents = 1000
+
+	occurrencesField   = "occurrences"
+	summaryPeriodField = "summaryPeriod"
+)
+
+var dedupLevels = [][]byte{
+	[]byte(`"level":"warn"`),
+	[]byte(`"level":"error"`),
+}
+
+type DedupConfig struct {
+	// Interval during which identical warn/error events are counted instead of written.
+	Interval time.Duration
+}
+
+type trackedEvent struct {
+	fields      map[string]interface{}
+	occurrences int
+}
+
+// dedupWriter collapses identical warn and error events. The first occurrence is written immediately, further
+// occurrences within the interval are only counted and reported as one summary event when the interval elapses.
+// Events are identical when all their fields but the timestamp are equal.
+type dedupWriter struct {
+	writer   io.Writer
+	interval time.Duration
+
+	lock   sync.Mutex
+	events map[string]*trackedEvent
+}
+
+func newDedupWriter(w io.Writer, config DedupConfig) io.Writer {
+	return &dedupWriter{
+		writer:   w,
+		interval: config.Interval,
+		events:   make(map[string]*trackedEvent),
+	}
+}
+
+func (dw *dedupWriter) Write(p []byte) (int, error) {
+	if !shouldDedup(p) {
+		return dw.writer.Write(p)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(p, &fields); err != nil {
+		return dw.writer.Write(p)
+	}
+	delete(fields, zerolog.TimestampFieldName)
+	// json.Marshal sorts map keys, so this is a stable key for the event
+	key, err := json.Marshal(fields)
+	if err != nil {
+		return dw.writer.Write(p)
+	}
+
+	dw.lock.Lock()
+	if event, ok := dw.events[string(key)]; ok {
+		event.occurrences++
+		dw.lock.Unlock()
+		return len(p), nil
+	}
+	if len(dw.events) < maxTrackedEvents {
+		dw.events[string(key)] = &trackedEvent{fields: fields}
+		time.AfterFunc(dw.interval, func() { dw.summarize(string(key)) })
+	}
+	dw.lock.Unlock()
+
+	return dw.writer.Write(p)
+}
+
+// summarize writes a summary of the occurrences suppressed during the last interval. The event stays tracked
+// while it keeps recurring, and is forgotten after a quiet interval so that the next occurrence is written as is.
+func (dw *dedupWriter) summarize(key string) {
+	dw.lock.Lock()
+	event, ok := dw.events[key]
+	if !ok {
+		dw.lock.Unlock()
+		return
+	}
+	occurrences := event.occurrences
+	if occurrences == 0 {
+		delete(dw.events, key)
+		dw.lock.Unlock()
+		return
+	}
+	event.occurrences = 0
+	time.AfterFunc(dw.interval, func() { dw.summarize(key) })
+	dw.lock.Unlock()
+
+	summary := make(map[string]interface{}, len(event.fields)+3)
+	for k, v := range event.fields {
+		summary[k] = v
+	}
+	summary[zerolog.TimestampFieldName] = utcNow().Format(zerolog.TimeFieldFormat)
+	summary[occurrencesField] = occurrences
+	summary[summaryPeriodField] = dw.interval.String()
+	if out, err := json.Marshal(summary); err == nil {
+		_, _ = dw.writer.Write(append(out, '\n'))
+	}
+}
+
+func shouldDedup(p []byte) bool {
+	for _, level := range dedupLevels {
+		if bytes.Contains(p, level) {
+			return true
+		}
+	}
+	return false
+}
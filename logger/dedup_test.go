@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) events(t *testing.T) []map[string]interface{} {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(sb.buf.Bytes()))
+	for scanner.Scan() {
+		var event map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestDedupWriter(t *testing.T) {
+	var out syncBuffer
+	dw := newDedupWriter(&out, DedupConfig{Interval: time.Hour}).(*dedupWriter)
+	log := zerolog.New(dw).With().Timestamp().Logger()
+
+	for i := 0; i < 5; i++ {
+		log.Error().Str("originService", "http://localhost:8080").Msg("connection refused")
+	}
+	log.Error().Str("originService", "http://localhost:9090").Msg("connection refused")
+	log.Info().Msg("request served")
+	log.Info().Msg("request served")
+
+	events := out.events(t)
+	require.Len(t, events, 4)
+	assert.Equal(t, "http://localhost:8080", events[0]["originService"])
+	assert.Equal(t, "http://localhost:9090", events[1]["originService"])
+	assert.Equal(t, "request served", events[2]["message"])
+
+	for key := range dw.events {
+		dw.summarize(key)
+	}
+	events = out.events(t)
+	require.Len(t, events, 5)
+	assert.Equal(t, "connection refused", events[4]["message"])
+	assert.Equal(t, "http://localhost:8080", events[4]["originService"])
+	assert.Equal(t, float64(4), events[4][occurrencesField])
+	assert.Equal(t, "1h0m0s", events[4][summaryPeriodField])
+
+	// The event without occurrences is forgotten, and written again on its next occurrence
+	for key := range dw.events {
+		dw.summarize(key)
+	}
+	assert.Empty(t, dw.events)
+	log.Error().Str("originService", "http://localhost:8080").Msg("connection refused")
+	require.Len(t, out.events(t), 6)
+}
+
+func TestDedupWriterSummaryTimer(t *testing.T) {
+	var out syncBuffer
+	log := zerolog.New(newDedupWriter(&out, DedupConfig{Interval: 10 * time.Millisecond}))
+
+	log.Warn().Msg("origin is slow")
+	log.Warn().Msg("origin is slow")
+
+	require.Eventually(t, func() bool {
+		events := out.events(t)
+		return len(events) == 2 && events[1][occurrencesField] == float64(1)
+	}, time.Second, 5*time.Millisecond)
+}
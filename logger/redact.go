@@ -0,0 +1,100 @@
+package logger
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+const redactedValue = "REDACTED"
+
+var (
+	// Headers that carry credentials and are always masked unless redaction is disabled.
+	defaultRedactedHeaders = []string{
+		"Authorization",
+		"Proxy-Authorization",
+		"Cookie",
+		"Set-Cookie",
+		"Cf-Access-Token",
+		"Cf-Access-Jwt-Assertion",
+		"Cf-Access-Client-Secret",
+	}
+	// Query parameters that carry credentials and are always masked unless redaction is disabled.
+	defaultRedactedQueryParams = []string{
+		"token",
+		"access_token",
+		"id_token",
+		"refresh_token",
+		"client_secret",
+	}
+)
+
+type RedactionConfig struct {
+	Headers     []string
+	QueryParams []string
+}
+
+func createRedactionConfig(extraHeaders, extraQueryParams []string) *RedactionConfig {
+	return &RedactionConfig{
+		Headers:     append(append([]string{}, defaultRedactedHeaders...), extraHeaders...),
+		QueryParams: append(append([]string{}, defaultRedactedQueryParams...), extraQueryParams...),
+	}
+}
+
+// redactor masks the values of sensitive headers and query parameters in serialized log events. It works on the
+// raw bytes zerolog emits, so it covers structured fields, formatted messages, Go header maps (`map[Cookie:[..]]`)
+// and HTTP dumps (`Cookie: ..\r\n`) alike.
+type redactor struct {
+	headerPattern *regexp.Regexp
+	queryPattern  *regexp.Regexp
+}
+
+func newRedactor(config RedactionConfig) *redactor {
+	return &redactor{
+		headerPattern: compileRedactionPattern(config.Headers, `(?i)((?:^|[^\w-]|\\[nrt])(?:%s)"?\s*:\s*\[?"?)([^\]\\"\r\n]+)`),
+		queryPattern:  compileRedactionPattern(config.QueryParams, `(?i)([?&](?:%s)=)([^&\s"\\#\]]+)`),
+	}
+}
+
+func compileRedactionPattern(names []string, format string) *regexp.Regexp {
+	var quoted []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			quoted = append(quoted, regexp.QuoteMeta(name))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(strings.Replace(format, "%s", strings.Join(quoted, "|"), 1))
+}
+
+func (r *redactor) redact(p []byte) []byte {
+	for _, pattern := range []*regexp.Regexp{r.headerPattern, r.queryPattern} {
+		if pattern != nil {
+			p = pattern.ReplaceAll(p, []byte("${1}"+redactedValue))
+		}
+	}
+	return p
+}
+
+// redactingWriter applies a redactor to every log event before handing it to the underlying writer.
+type redactingWriter struct {
+	redactor *redactor
+	writer   io.Writer
+}
+
+func newRedactingWriter(w io.Writer, config RedactionConfig) io.Writer {
+	return &redactingWriter{
+		redactor: newRedactor(config),
+		writer:   w,
+	}
+}
+
+func (rw *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := rw.writer.Write(rw.redactor.redact(p)); err != nil {
+		return 0, err
+	}
+	// Report the original length, otherwise zerolog treats the (possibly shorter) redacted write as a short write.
+	return len(p), nil
+}
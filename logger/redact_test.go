@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor(t *testing.T) {
+	r := newRedactor(*createRedactionConfig([]string{"X-Api-Key"}, []string{"sig"}))
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "header map",
+			input:    `{"Header":"map[Accept:[*/*] Authorization:[Bearer abc] Cookie:[CF_Authorization=xyz; other=1]]"}`,
+			expected: `{"Header":"map[Accept:[*/*] Authorization:[REDACTED] Cookie:[REDACTED]]"}`,
+		},
+		{
+			name:     "request dump",
+			input:    `{"message":"GET / HTTP/1.1\r\nHost: example.com\r\nCf-Access-Token: eyJhbGciOi\r\n\r\n"}`,
+			expected: `{"message":"GET / HTTP/1.1\r\nHost: example.com\r\nCf-Access-Token: REDACTED\r\n\r\n"}`,
+		},
+		{
+			name:     "structured field",
+			input:    `{"x-api-key":"secret","host":"example.com"}`,
+			expected: `{"x-api-key":"REDACTED","host":"example.com"}`,
+		},
+		{
+			name:     "query parameters",
+			input:    `{"message":"GET https://example.com/path?token=abc&page=2&sig=def HTTP/1.1"}`,
+			expected: `{"message":"GET https://example.com/path?token=REDACTED&page=2&sig=REDACTED HTTP/1.1"}`,
+		},
+		{
+			name:     "nothing sensitive",
+			input:    `{"message":"Registered tunnel connection","connIndex":0}`,
+			expected: `{"message":"Registered tunnel connection","connIndex":0}`,
+		},
+		{
+			name:     "header prefix is not matched",
+			input:    `{"X-Authorization-Hint":"keep"}`,
+			expected: `{"X-Authorization-Hint":"keep"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, string(r.redact([]byte(test.input))))
+		})
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	log := zerolog.New(newRedactingWriter(&buf, *createRedactionConfig(nil, nil)))
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer abc")
+	log.Info().Str("Header", fmt.Sprintf("%+v", header)).Msg("Inbound request")
+
+	assert.NotContains(t, buf.String(), "abc")
+	var event map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &event))
+	assert.Equal(t, "map[Authorization:[REDACTED]]", event["Header"])
+}
@@ -0,0 +1,85 @@
+//go:build !windows
+
+package logger
+
+import (
+	"bytes"
+	"io"
+	"log/syslog"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// syslogWriter writes the logs to syslog in the format of the console, at the priority of their level. The timestamp
+// is left to syslog.
+type syslogWriter struct {
+	lock    sync.Mutex
+	buf     bytes.Buffer
+	console zerolog.ConsoleWriter
+	writer  *syslog.Writer
+}
+
+func createSyslogWriter(config SyslogConfig) (io.Writer, error) {
+	writer, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, config.Tag)
+	if err != nil {
+		return nil, err
+	}
+	w := &syslogWriter{writer: writer}
+	w.console = zerolog.ConsoleWriter{
+		Out:        &w.buf,
+		NoColor:    true,
+		PartsOrder: []string{zerolog.LevelFieldName, zerolog.MessageFieldName},
+	}
+	return w, nil
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.buf.Reset()
+	if _, err := w.console.Write(p); err != nil {
+		return 0, err
+	}
+	msg := w.buf.String()
+	var err error
+	switch eventLevel(p) {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		err = w.writer.Debug(msg)
+	case zerolog.WarnLevel:
+		err = w.writer.Warning(msg)
+	case zerolog.ErrorLevel:
+		err = w.writer.Err(msg)
+	case zerolog.FatalLevel:
+		err = w.writer.Crit(msg)
+	case zerolog.PanicLevel:
+		err = w.writer.Emerg(msg)
+	default:
+		err = w.writer.Info(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+var levelFieldPrefix = []byte(`"` + zerolog.LevelFieldName + `":"`)
+
+// eventLevel returns the level of a JSON log event, without decoding it
+func eventLevel(p []byte) zerolog.Level {
+	i := bytes.Index(p, levelFieldPrefix)
+	if i < 0 {
+		return zerolog.NoLevel
+	}
+	value := p[i+len(levelFieldPrefix):]
+	end := bytes.IndexByte(value, '"')
+	if end < 0 {
+		return zerolog.NoLevel
+	}
+	level, err := zerolog.ParseLevel(string(value[:end]))
+	if err != nil {
+		return zerolog.NoLevel
+	}
+	return level
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package logger
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventLevel(t *testing.T) {
+	tests := []struct {
+		event    string
+		expected zerolog.Level
+	}{
+		{event: `{"level":"debug","message":"test"}`, expected: zerolog.DebugLevel},
+		{event: `{"time":"2022-06-01T00:00:00Z","level":"warn","message":"test"}`, expected: zerolog.WarnLevel},
+		{event: `{"level":"error","error":"failed","message":"test"}`, expected: zerolog.ErrorLevel},
+		{event: `{"message":"test"}`, expected: zerolog.NoLevel},
+		{event: `{"level":"unknown"}`, expected: zerolog.NoLevel},
+		{event: `{"level":"info`, expected: zerolog.NoLevel},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, eventLevel([]byte(test.event)), test.event)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package logger
+
+import (
+	"fmt"
+	"io"
+)
+
+func createSyslogWriter(config SyslogConfig) (io.Writer, error) {
+	return nil, fmt.Errorf("syslog isn't supported on Windows, use the event log of the service instead")
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/tunnelstate"
+)
+
+// ConnectorState is the state of the connections of the connector to the edge, served at /connections
+type ConnectorState struct {
+	ConnectorID uuid.UUID         `json:"connectorId"`
+	Connections []ConnectionState `json:"connections"`
+}
+
+type ConnectionState struct {
+	Index       uint8  `json:"index"`
+	IsConnected bool   `json:"isConnected"`
+	Location    string `json:"location,omitempty"`
+	Protocol    string `json:"protocol,omitempty"`
+	EdgeAddress string `json:"edgeAddress,omitempty"`
+	// ConnectedAt and UptimeSeconds are only set while the connection is connected
+	ConnectedAt   *time.Time                    `json:"connectedAt,omitempty"`
+	UptimeSeconds int64                         `json:"uptimeSeconds,omitempty"`
+	RecentErrors  []tunnelstate.ConnectionError `json:"recentErrors,omitempty"`
+	// Features is how the features offered by the connection were negotiated by the edge, while it's connected
+	Features *connection.FeatureNegotiation `json:"features,omitempty"`
+}
+
+// ServeConnections responds with the ConnectorState of the connector.
+func (rs *ReadyServer) ServeConnections(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rs.connectorState(time.Now()))
+}
+
+func (rs *ReadyServer) connectorState(now time.Time) ConnectorState {
+	state := ConnectorState{
+		ConnectorID: rs.clientID,
+		Connections: []ConnectionState{},
+	}
+	for index, ci := range rs.tracker.Connections() {
+		connection := ConnectionState{
+			Index:        index,
+			IsConnected:  ci.IsConnected,
+			RecentErrors: ci.RecentErrors,
+		}
+		if ci.IsConnected {
+			connectedAt := ci.ConnectedAt
+			connection.Location = ci.Location
+			connection.Protocol = ci.Protocol.String()
+			if len(ci.EdgeAddress) > 0 {
+				connection.EdgeAddress = ci.EdgeAddress.String()
+			}
+			connection.ConnectedAt = &connectedAt
+			connection.Features = ci.Features
+			connection.UptimeSeconds = int64(now.Sub(connectedAt).Seconds())
+		}
+		state.Connections = append(state.Connections, connection)
+	}
+	sort.Slice(state.Connections, func(i, j int) bool {
+		return state.Connections[i].Index < state.Connections[j].Index
+	})
+	return state
+}
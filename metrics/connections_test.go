@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/connection"
+)
+
+func TestConnectorState(t *testing.T) {
+	nopLogger := zerolog.Nop()
+	connectorID := uuid.New()
+	rs := NewReadyServer(&nopLogger, connectorID)
+
+	rs.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Connected, Location: "lax01"})
+	features := &connection.FeatureNegotiation{Offered: []string{"serialized_headers"}, DatagramVersion: "v1"}
+	rs.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Connected, Location: "lax01", Protocol: connection.QUIC, EdgeAddress: net.IPv4(198, 41, 192, 7), Features: features})
+	for i := 0; i < 7; i++ {
+		rs.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected, Location: "sjc05", Protocol: connection.HTTP2})
+		rs.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Disconnected, Err: fmt.Errorf("error %d", i)})
+	}
+	rs.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Reconnecting})
+
+	state := rs.connectorState(time.Now().Add(time.Minute))
+	assert.Equal(t, connectorID, state.ConnectorID)
+	require.Len(t, state.Connections, 2)
+
+	disconnected := state.Connections[0]
+	assert.Equal(t, uint8(0), disconnected.Index)
+	assert.False(t, disconnected.IsConnected)
+	assert.Empty(t, disconnected.Location)
+	assert.Nil(t, disconnected.ConnectedAt)
+	assert.Nil(t, disconnected.Features)
+	var messages []string
+	for _, err := range disconnected.RecentErrors {
+		messages = append(messages, err.Message)
+	}
+	assert.Equal(t, []string{"error 2", "error 3", "error 4", "error 5", "error 6"}, messages)
+
+	connected := state.Connections[1]
+	assert.Equal(t, uint8(1), connected.Index)
+	assert.True(t, connected.IsConnected)
+	assert.Equal(t, "lax01", connected.Location)
+	assert.Equal(t, "quic", connected.Protocol)
+	assert.Equal(t, "198.41.192.7", connected.EdgeAddress)
+	require.NotNil(t, connected.ConnectedAt)
+	assert.InDelta(t, 60, connected.UptimeSeconds, 1)
+	assert.Empty(t, connected.RecentErrors)
+	assert.Equal(t, features, connected.Features)
+
+	rs.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Disconnected, Err: errors.New("connection closed")})
+	state = rs.connectorState(time.Now())
+	assert.False(t, state.Connections[1].IsConnected)
+	require.Len(t, state.Connections[1].RecentErrors, 1)
+	assert.Equal(t, "connection closed", state.Connections[1].RecentErrors[0].Message)
+}
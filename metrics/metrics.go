@@ -15,6 +15,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"golang.org/x/net/trace"
+
+	"github.com/cloudflare/cloudflared/features"
+	"github.com/cloudflare/cloudflared/flowtable"
 )
 
 const (
@@ -26,12 +29,21 @@ type orchestrator interface {
 	GetVersionedConfigJSON() ([]byte, error)
 }
 
-func newMetricsHandler(
-	readyServer *ReadyServer,
-	quickTunnelHostname string,
-	orchestrator orchestrator,
-	log *zerolog.Logger,
-) *mux.Router {
+// Config is what the metrics server serves besides metrics, the zero value of a field leaves its endpoint out
+type Config struct {
+	// ReadyServer serves /ready and /connections
+	ReadyServer *ReadyServer
+	// QuickTunnelHostname is served on /quicktunnel
+	QuickTunnelHostname string
+	// Orchestrator serves its configuration on /config
+	Orchestrator orchestrator
+	// Flows serves the table of flows on /flows
+	Flows *flowtable.Table
+	// FeatureSelector serves the features on /features
+	FeatureSelector *features.Selector
+}
+
+func newMetricsHandler(config Config, log *zerolog.Logger) *mux.Router {
 	router := mux.NewRouter()
 	router.PathPrefix("/debug/").Handler(http.DefaultServeMux)
 
@@ -39,13 +51,14 @@ func newMetricsHandler(
 	router.HandleFunc("/healthcheck", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = fmt.Fprintf(w, "OK\n")
 	})
-	if readyServer != nil {
+	if readyServer := config.ReadyServer; readyServer != nil {
 		router.Handle("/ready", readyServer)
+		router.HandleFunc("/connections", readyServer.ServeConnections)
 	}
 	router.HandleFunc("/quicktunnel", func(w http.ResponseWriter, r *http.Request) {
-		_, _ = fmt.Fprintf(w, `{"hostname":"%s"}`, quickTunnelHostname)
+		_, _ = fmt.Fprintf(w, `{"hostname":"%s"}`, config.QuickTunnelHostname)
 	})
-	if orchestrator != nil {
+	if orchestrator := config.Orchestrator; orchestrator != nil {
 		router.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
 			json, err := orchestrator.GetVersionedConfigJSON()
 			if err != nil {
@@ -57,16 +70,19 @@ func newMetricsHandler(
 			_, _ = w.Write(json)
 		})
 	}
-
+	if config.Flows != nil {
+		router.Handle("/flows", config.Flows)
+	}
+	if config.FeatureSelector != nil {
+		router.Handle("/features", config.FeatureSelector)
+	}
 	return router
 }
 
 func ServeMetrics(
 	l net.Listener,
 	shutdownC <-chan struct{},
-	readyServer *ReadyServer,
-	quickTunnelHostname string,
-	orchestrator orchestrator,
+	config Config,
 	log *zerolog.Logger,
 ) (err error) {
 	var wg sync.WaitGroup
@@ -74,7 +90,7 @@ func ServeMetrics(
 	trace.AuthRequest = func(*http.Request) (bool, bool) { return true, true }
 	// TODO: parameterize ReadTimeout and WriteTimeout. The maximum time we can
 	// profile CPU usage depends on WriteTimeout
-	h := newMetricsHandler(readyServer, quickTunnelHostname, orchestrator, log)
+	h := newMetricsHandler(config, log)
 	server := &http.Server{
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
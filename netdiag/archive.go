@@ -0,0 +1,49 @@
+package netdiag
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteArchive writes a zip archive of the report to attach to support tickets: report.json, and the output of the
+// tools of each trace and MTU probe.
+func WriteArchive(w io.Writer, report *Report) error {
+	archive := zip.NewWriter(w)
+	now := time.Now()
+	add := func(name string, data []byte) error {
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(data)
+		return err
+	}
+
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := add("report.json", reportJSON); err != nil {
+		return err
+	}
+	for _, trace := range report.Traces {
+		if err := add(fmt.Sprintf("traces/%s-%s.txt", fileName(trace.Target), trace.Mode), []byte(trace.Output)); err != nil {
+			return err
+		}
+	}
+	for _, mtu := range report.MTUs {
+		if err := add(fmt.Sprintf("mtu/%s.txt", fileName(mtu.Target)), []byte(mtu.Output)); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// fileName replaces the colons of IPv6 addresses, which aren't allowed in file names on Windows
+func fileName(address string) string {
+	return strings.ReplaceAll(address, ":", "_")
+}
@@ -0,0 +1,117 @@
+package netdiag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// minMTU is the minimum MTU of IPv6, which QUIC connections also need to fit their 1200 bytes packets
+	minMTU = 1280
+	maxMTU = 1500
+
+	ipv4Headers = 20 + 8
+	ipv6Headers = 40 + 8
+)
+
+// MTU is the largest packet that reaches a target without being fragmented, between 1280 and 1500 bytes
+type MTU struct {
+	Target string `json:"target"`
+	// MTU is 0 if even packets of 1280 bytes don't reach the target
+	MTU  int    `json:"mtu,omitempty"`
+	Tool string `json:"tool,omitempty"`
+	// Output is the output of each probe, which goes in archives
+	Output string `json:"-"`
+	Error  string `json:"error,omitempty"`
+}
+
+// probeMTU searches the MTU by pinging target with packets that can't be fragmented
+func probeMTU(ctx context.Context, target net.IP) (result MTU) {
+	result.Target = target.String()
+	tool, args, err := pingCommand(target)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Tool = tool
+	headers := ipv4Headers
+	if target.To4() == nil {
+		headers = ipv6Headers
+	}
+
+	var (
+		output   strings.Builder
+		notFound error
+	)
+	fits := func(mtu int) bool {
+		pingArgs := args(mtu - headers)
+		pingOutput, err := runCommand(ctx, tool, pingArgs...)
+		fmt.Fprintf(&output, "$ %s %s\n%s\n", tool, strings.Join(pingArgs, " "), pingOutput)
+		if errors.Is(err, exec.ErrNotFound) {
+			notFound = err
+		}
+		return err == nil
+	}
+	defer func() {
+		result.Output = output.String()
+	}()
+
+	if !fits(minMTU) {
+		if notFound != nil {
+			result.Error = fmt.Sprintf("%s failed: %v", tool, notFound)
+		} else {
+			result.Error = fmt.Sprintf("packets of %d bytes don't reach the target, or it doesn't answer pings", minMTU)
+		}
+		return result
+	}
+	if fits(maxMTU) {
+		result.MTU = maxMTU
+		return result
+	}
+	// The MTU is at least low and less than high
+	low, high := minMTU, maxMTU
+	for high-low > 1 && ctx.Err() == nil {
+		mid := (low + high) / 2
+		if fits(mid) {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	result.MTU = low
+	return result
+}
+
+// pingCommand returns the ping of the system and its arguments to send a packet of a payload size, which isn't
+// fragmented
+func pingCommand(target net.IP) (string, func(size int) []string, error) {
+	ipv4 := target.To4() != nil
+	switch runtime.GOOS {
+	case "linux":
+		return "ping", func(size int) []string {
+			return []string{"-n", "-c", "1", "-W", "1", "-M", "do", "-s", strconv.Itoa(size), target.String()}
+		}, nil
+	case "windows":
+		return "ping", func(size int) []string {
+			args := []string{"-n", "1", "-w", "1000", "-l", strconv.Itoa(size)}
+			// IPv6 packets are never fragmented on their path
+			if ipv4 {
+				args = append(args, "-f")
+			}
+			return append(args, target.String())
+		}, nil
+	default:
+		if !ipv4 {
+			return "", nil, fmt.Errorf("probing the MTU to IPv6 addresses isn't supported on %s", runtime.GOOS)
+		}
+		return "ping", func(size int) []string {
+			return []string{"-n", "-c", "1", "-t", "1", "-D", "-s", strconv.Itoa(size), target.String()}
+		}, nil
+	}
+}
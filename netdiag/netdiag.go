@@ -0,0 +1,93 @@
+// Package netdiag traces the network path to the Cloudflare edge with the mtr, traceroute or tracert tool of the
+// system, and probes its MTU with ping, for support tickets about the connectivity of connectors.
+package netdiag
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"sync"
+)
+
+const (
+	ICMP = "icmp"
+	UDP  = "udp"
+	TCP  = "tcp"
+
+	// EdgePort is the port of the edge that connections to it use, which is traced with UDP and TCP
+	EdgePort = 7844
+)
+
+// Modes are the protocols of the probes of traces
+var Modes = []string{ICMP, UDP, TCP}
+
+// Redeclared so they can be overridden in tests
+var (
+	runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		return exec.CommandContext(ctx, name, args...).CombinedOutput()
+	}
+	lookPath = exec.LookPath
+)
+
+// Config is what to diagnose
+type Config struct {
+	Targets []net.IP
+	// Modes are the protocols the path to each target is traced with
+	Modes   []string
+	MaxHops int
+	// Count is how many probes are sent to each hop
+	Count int
+}
+
+func (c *Config) validate() error {
+	if len(c.Targets) == 0 {
+		return fmt.Errorf("there must be at least one target")
+	}
+	for _, mode := range c.Modes {
+		if mode != ICMP && mode != UDP && mode != TCP {
+			return fmt.Errorf("%s isn't a mode, it must be one of %s, %s or %s", mode, ICMP, UDP, TCP)
+		}
+	}
+	if c.MaxHops <= 0 || c.Count <= 0 {
+		return fmt.Errorf("the maximum number of hops and the count of probes must be positive")
+	}
+	return nil
+}
+
+// Report is the result of the diagnostics
+type Report struct {
+	Traces []Trace `json:"traces"`
+	MTUs   []MTU   `json:"mtus"`
+}
+
+// Run traces the path to each target with each mode, and probes the MTU of the path to each target.
+func Run(ctx context.Context, config Config) (*Report, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	report := &Report{
+		Traces: make([]Trace, len(config.Targets)*len(config.Modes)),
+		MTUs:   make([]MTU, len(config.Targets)),
+	}
+	var wg sync.WaitGroup
+	for i, target := range config.Targets {
+		for j, mode := range config.Modes {
+			wg.Add(1)
+			go func(index int, target net.IP, mode string) {
+				defer wg.Done()
+				report.Traces[index] = trace(ctx, target, mode, &config)
+			}(i*len(config.Modes)+j, target, mode)
+		}
+		wg.Add(1)
+		go func(index int, target net.IP) {
+			defer wg.Done()
+			report.MTUs[index] = probeMTU(ctx, target)
+		}(i, target)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return report, nil
+}
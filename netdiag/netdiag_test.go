@@ -0,0 +1,156 @@
+package netdiag
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mtrOutput = `{
+  "report": {
+    "mtr": {"src": "host", "dst": "198.41.192.7", "tos": 0, "tests": 10, "psize": "64", "bitpattern": "0x00"},
+    "hubs": [
+      {"count": 1, "host": "192.168.1.1", "Loss%": 0.0, "Snt": 10, "Last": 0.5, "Avg": 0.6, "Best": 0.4, "Wrst": 1.1, "StDev": 0.2},
+      {"count": 2, "host": "???", "Loss%": 100.0, "Snt": 10, "Last": 0.0, "Avg": 0.0, "Best": 0.0, "Wrst": 0.0, "StDev": 0.0},
+      {"count": 3, "host": "198.41.192.7", "Loss%": 10.0, "Snt": 10, "Last": 9.8, "Avg": 10.2, "Best": 9.5, "Wrst": 12.0, "StDev": 0.7}
+    ]
+  }
+}`
+
+func TestParseMTR(t *testing.T) {
+	hops, err := parseMTR([]byte(mtrOutput))
+	require.NoError(t, err)
+	assert.Equal(t, []Hop{
+		{Number: 1, Host: "192.168.1.1", Sent: 10, Best: 0.4, Avg: 0.6, Worst: 1.1},
+		{Number: 2, Sent: 10, LossPercent: 100},
+		{Number: 3, Host: "198.41.192.7", Sent: 10, LossPercent: 10, Best: 9.5, Avg: 10.2, Worst: 12},
+	}, hops)
+
+	_, err = parseMTR([]byte("mtr: unable to get raw sockets"))
+	assert.Error(t, err)
+}
+
+func TestParseTraceroute(t *testing.T) {
+	traceroute := `traceroute to 198.41.192.7 (198.41.192.7), 30 hops max, 60 byte packets
+ 1  192.168.1.1  0.512 ms  0.400 ms  0.600 ms
+ 2  * * *
+ 3  10.10.0.1  3.000 ms *  5.000 ms
+ 4  198.41.192.7  9.000 ms  10.000 ms  11.000 ms
+`
+	hops, err := parseTraceroute([]byte(traceroute))
+	require.NoError(t, err)
+	require.Len(t, hops, 4)
+	assert.Equal(t, Hop{Number: 1, Host: "192.168.1.1", Sent: 3, Best: 0.4, Avg: 0.504, Worst: 0.6}, roundHop(hops[0]))
+	assert.Equal(t, Hop{Number: 2, Sent: 3, LossPercent: 100}, hops[1])
+	assert.Equal(t, Hop{Number: 3, Host: "10.10.0.1", Sent: 3, LossPercent: 100.0 / 3, Best: 3, Avg: 4, Worst: 5}, hops[2])
+	assert.Equal(t, "198.41.192.7", hops[3].Host)
+
+	tracert := `
+Tracing route to 198.41.192.7 over a maximum of 30 hops
+
+  1    <1 ms    <1 ms    <1 ms  192.168.1.1
+  2     *        *        *     Request timed out.
+  3    12 ms    11 ms    10 ms  198.41.192.7
+
+Trace complete.
+`
+	hops, err = parseTraceroute([]byte(tracert))
+	require.NoError(t, err)
+	require.Len(t, hops, 3)
+	assert.Equal(t, Hop{Number: 1, Host: "192.168.1.1", Sent: 3, Best: 1, Avg: 1, Worst: 1}, hops[0])
+	assert.Equal(t, Hop{Number: 2, Sent: 3, LossPercent: 100}, hops[1])
+	assert.Equal(t, Hop{Number: 3, Host: "198.41.192.7", Sent: 3, Best: 10, Avg: 11, Worst: 12}, hops[2])
+
+	_, err = parseTraceroute([]byte("traceroute: unknown host"))
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	const pathMTU = 1400
+	runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		switch name {
+		case "mtr":
+			return []byte(mtrOutput), nil
+		case "ping":
+			for i, arg := range args {
+				if arg == "-s" || arg == "-l" {
+					size, err := strconv.Atoi(args[i+1])
+					require.NoError(t, err)
+					if size+ipv4Headers > pathMTU {
+						return []byte("message too long"), fmt.Errorf("exit status 1")
+					}
+					return []byte("1 packets transmitted, 1 received"), nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("unexpected command %s", name)
+	}
+	lookPath = func(file string) (string, error) {
+		return "/usr/bin/" + file, nil
+	}
+	defer func() {
+		runCommand = defaultRunCommand
+		lookPath = defaultLookPath
+	}()
+
+	_, err := Run(context.Background(), Config{Targets: []net.IP{net.IPv4(198, 41, 192, 7)}, Modes: []string{"sctp"}, MaxHops: 30, Count: 10})
+	assert.Error(t, err)
+
+	targets := []net.IP{net.IPv4(198, 41, 192, 7), net.IPv4(198, 41, 200, 13)}
+	report, err := Run(context.Background(), Config{Targets: targets, Modes: Modes, MaxHops: 30, Count: 10})
+	require.NoError(t, err)
+	require.Len(t, report.Traces, 6)
+	assert.Equal(t, "198.41.192.7", report.Traces[0].Target)
+	assert.Equal(t, ICMP, report.Traces[0].Mode)
+	assert.Equal(t, "198.41.200.13", report.Traces[5].Target)
+	assert.Equal(t, TCP, report.Traces[5].Mode)
+	for _, trace := range report.Traces {
+		assert.Equal(t, "mtr", trace.Tool)
+		assert.Empty(t, trace.Error)
+		assert.Len(t, trace.Hops, 3)
+	}
+	require.Len(t, report.MTUs, 2)
+	for _, mtu := range report.MTUs {
+		assert.Equal(t, pathMTU, mtu.MTU)
+		assert.Contains(t, mtu.Output, "message too long")
+	}
+
+	var archive bytes.Buffer
+	require.NoError(t, WriteArchive(&archive, report))
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	require.NoError(t, err)
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{
+		"mtu/198.41.192.7.txt",
+		"mtu/198.41.200.13.txt",
+		"report.json",
+		"traces/198.41.192.7-icmp.txt",
+		"traces/198.41.192.7-tcp.txt",
+		"traces/198.41.192.7-udp.txt",
+		"traces/198.41.200.13-icmp.txt",
+		"traces/198.41.200.13-tcp.txt",
+		"traces/198.41.200.13-udp.txt",
+	}, names)
+}
+
+var (
+	defaultRunCommand = runCommand
+	defaultLookPath   = lookPath
+)
+
+func roundHop(hop Hop) Hop {
+	hop.Avg = float64(int(hop.Avg*1000+0.5)) / 1000
+	return hop
+}
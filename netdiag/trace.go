@@ -0,0 +1,193 @@
+package netdiag
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Trace is the path to a target, hop by hop
+type Trace struct {
+	Target string `json:"target"`
+	Mode   string `json:"mode"`
+	// Tool is the command that traced the path
+	Tool string `json:"tool,omitempty"`
+	Hops []Hop  `json:"hops,omitempty"`
+	// Output is the output of the tool, which goes in archives
+	Output string `json:"-"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Hop is a router on the path to a target. Its round trip times are in milliseconds.
+type Hop struct {
+	Number int `json:"number"`
+	// Host is empty if no probe to the hop was answered
+	Host        string  `json:"host,omitempty"`
+	Sent        int     `json:"sent"`
+	LossPercent float64 `json:"lossPercent"`
+	Best        float64 `json:"best"`
+	Avg         float64 `json:"avg"`
+	Worst       float64 `json:"worst"`
+}
+
+type parseFunc func(output []byte) ([]Hop, error)
+
+func trace(ctx context.Context, target net.IP, mode string, config *Config) Trace {
+	result := Trace{Target: target.String(), Mode: mode}
+	tool, args, parse, err := traceCommand(target, mode, config)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Tool = tool
+	output, err := runCommand(ctx, tool, args...)
+	result.Output = fmt.Sprintf("$ %s %s\n%s", tool, strings.Join(args, " "), output)
+	if err != nil {
+		result.Error = fmt.Sprintf("%s failed: %v", tool, err)
+	}
+	hops, parseErr := parse(output)
+	if parseErr != nil && err == nil {
+		result.Error = fmt.Sprintf("failed to parse the output of %s: %v", tool, parseErr)
+	}
+	result.Hops = hops
+	return result
+}
+
+// traceCommand picks mtr if it's installed, or the traceroute of the system
+func traceCommand(target net.IP, mode string, config *Config) (string, []string, parseFunc, error) {
+	count, maxHops, port := strconv.Itoa(config.Count), strconv.Itoa(config.MaxHops), strconv.Itoa(EdgePort)
+	if _, err := lookPath("mtr"); err == nil {
+		args := []string{"--report", "--json", "--no-dns", "--report-cycles", count, "--max-ttl", maxHops}
+		switch mode {
+		case UDP:
+			args = append(args, "--udp", "--port", port)
+		case TCP:
+			args = append(args, "--tcp", "--port", port)
+		}
+		return "mtr", append(args, target.String()), parseMTR, nil
+	}
+
+	if runtime.GOOS == "windows" {
+		if mode != ICMP {
+			return "", nil, nil, fmt.Errorf("tracing with %s needs mtr on Windows, tracert only traces with %s", mode, ICMP)
+		}
+		return "tracert", []string{"-d", "-h", maxHops, "-w", "2000", target.String()}, parseTraceroute, nil
+	}
+	args := []string{"-n", "-q", count, "-m", maxHops, "-w", "2"}
+	if runtime.GOOS == "linux" {
+		switch mode {
+		case ICMP:
+			args = append(args, "-I")
+		case UDP:
+			args = append(args, "-U", "-p", port)
+		case TCP:
+			args = append(args, "-T", "-p", port)
+		}
+	} else {
+		args = append(args, "-P", mode)
+		if mode != ICMP {
+			args = append(args, "-p", port)
+		}
+	}
+	return "traceroute", append(args, target.String()), parseTraceroute, nil
+}
+
+type mtrReport struct {
+	Report struct {
+		Hubs []struct {
+			Host  string  `json:"host"`
+			Loss  float64 `json:"Loss%"`
+			Sent  int     `json:"Snt"`
+			Best  float64 `json:"Best"`
+			Avg   float64 `json:"Avg"`
+			Worst float64 `json:"Wrst"`
+		} `json:"hubs"`
+	} `json:"report"`
+}
+
+func parseMTR(output []byte) ([]Hop, error) {
+	var report mtrReport
+	if err := json.Unmarshal(output, &report); err != nil {
+		return nil, err
+	}
+	hops := make([]Hop, 0, len(report.Report.Hubs))
+	for i, hub := range report.Report.Hubs {
+		hop := Hop{
+			Number:      i + 1,
+			Sent:        hub.Sent,
+			LossPercent: hub.Loss,
+			Best:        hub.Best,
+			Avg:         hub.Avg,
+			Worst:       hub.Worst,
+		}
+		// mtr shows the hops that didn't answer as ???
+		if hub.Host != "???" {
+			hop.Host = hub.Host
+		}
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
+
+// parseTraceroute parses the output of traceroute and tracert, whose hops are lines starting with their number
+// followed by the address of the hop, a round trip time in ms or * for each probe
+func parseTraceroute(output []byte) ([]Hop, error) {
+	var hops []Hop
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		number, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		hop := Hop{Number: number}
+		var rtts []float64
+		lost := 0
+		for i := 1; i < len(fields); i++ {
+			field := fields[i]
+			if field == "*" {
+				lost++
+				continue
+			}
+			if i+1 < len(fields) && fields[i+1] == "ms" {
+				// tracert shows round trip times under a millisecond as <1
+				rtt, err := strconv.ParseFloat(strings.TrimPrefix(field, "<"), 64)
+				if err == nil {
+					rtts = append(rtts, rtt)
+				}
+				i++
+				continue
+			}
+			if ip := net.ParseIP(strings.Trim(field, "()[]")); ip != nil && hop.Host == "" {
+				hop.Host = ip.String()
+			}
+		}
+		hop.Sent = lost + len(rtts)
+		if hop.Sent > 0 {
+			hop.LossPercent = float64(lost) * 100 / float64(hop.Sent)
+		}
+		for i, rtt := range rtts {
+			if i == 0 || rtt < hop.Best {
+				hop.Best = rtt
+			}
+			if rtt > hop.Worst {
+				hop.Worst = rtt
+			}
+			hop.Avg += rtt / float64(len(rtts))
+		}
+		hops = append(hops, hop)
+	}
+	if len(hops) == 0 {
+		return nil, fmt.Errorf("there are no hops")
+	}
+	return hops, scanner.Err()
+}
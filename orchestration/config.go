@@ -3,8 +3,13 @@ package orchestration
 import (
 	"encoding/json"
 
+	"github.com/cloudflare/cloudflared/chaos"
 	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/flowtable"
 	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/iouring"
+	"github.com/cloudflare/cloudflared/l4policy"
+	"github.com/cloudflare/cloudflared/proxy"
 )
 
 type newRemoteConfig struct {
@@ -17,10 +22,34 @@ type newLocalConfig struct {
 	ConfigurationFlags map[string]string `json:"__configuration_flags,omitempty"`
 }
 
+// ReloadNotifier is notified before and after the Orchestrator applies a new configuration
+type ReloadNotifier interface {
+	Reloading()
+	// Reloaded is called whether the configuration was applied or not
+	Reloaded()
+}
+
 // Config is the original config as read and parsed by cloudflared.
 type Config struct {
 	Ingress     *ingress.Ingress
 	WarpRouting ingress.WarpRoutingConfig
+	// WarpRoutingPolicy filters warp-routing traffic. It's local to this instance, so remote configurations don't
+	// change it.
+	WarpRoutingPolicy *l4policy.Engine
+	// Flows tracks the active warp-routing flows, if it's not nil
+	Flows *flowtable.Table
+	// UDPRing is the io_uring of the origin sockets of datagram sessions, they use standard sockets if it's nil
+	UDPRing *iouring.Ring
+	// Chaos injects faults in the traffic to origins, if it's not nil
+	Chaos *chaos.Injector
+	// HostnameRequests counts the requests by hostname, if it's not nil
+	HostnameRequests *proxy.HostnameRequests
+	// Maintenance has the ingress rules in maintenance mode, if it's not nil
+	Maintenance *proxy.Maintenance
+	// ConnectorHealth answers the requests to the healthPath of the ingress rules, if it's not nil
+	ConnectorHealth *proxy.ConnectorHealth
+	// ReloadNotifier is notified when the configuration is reloaded, if it's not nil
+	ReloadNotifier ReloadNotifier
 
 	// Extra settings used to configure this instance but that are not eligible for remotely management
 	// ie. (--protocol, --loglevel, ...)
@@ -68,6 +68,8 @@ func (o *Orchestrator) UpdateConfig(version int32, config []byte) *tunnelpogs.Up
 			LastAppliedVersion: o.currentVersion,
 		}
 	}
+	defer o.notifyReloading()()
+
 	var newConf newRemoteConfig
 	if err := json.Unmarshal(config, &newConf); err != nil {
 		o.log.Err(err).
@@ -102,6 +104,26 @@ func (o *Orchestrator) UpdateConfig(version int32, config []byte) *tunnelpogs.Up
 	}
 }
 
+// UpdateLocalIngress creates a new proxy with ingress rules managed locally, e.g. from Kubernetes ingresses. The
+// version is left as is, so a newer remote configuration still replaces them.
+func (o *Orchestrator) UpdateLocalIngress(ingressRules ingress.Ingress) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	defer o.notifyReloading()()
+
+	return o.updateIngress(ingressRules, o.config.WarpRouting)
+}
+
+// notifyReloading notifies the ReloadNotifier that the configuration is being reloaded, and returns the func to call
+// once it's reloaded
+func (o *Orchestrator) notifyReloading() func() {
+	if o.config.ReloadNotifier == nil {
+		return func() {}
+	}
+	o.config.ReloadNotifier.Reloading()
+	return o.config.ReloadNotifier.Reloaded
+}
+
 // The caller is responsible to make sure there is no concurrent access
 func (o *Orchestrator) updateIngress(ingressRules ingress.Ingress, warpRouting ingress.WarpRoutingConfig) error {
 	select {
@@ -118,8 +140,20 @@ func (o *Orchestrator) updateIngress(ingressRules ingress.Ingress, warpRouting i
 	if err := ingressRules.StartOrigins(o.log, proxyShutdownC); err != nil {
 		return errors.Wrap(err, "failed to start origin")
 	}
-	newProxy := proxy.NewOriginProxy(ingressRules, warpRouting, o.tags, o.log)
+	newProxy := proxy.NewOriginProxy(ingressRules, warpRouting, o.tags, o.log, proxy.Options{
+		WarpPolicy:  o.config.WarpRoutingPolicy,
+		Flows:       o.config.Flows,
+		UDPRing:     o.config.UDPRing,
+		Faults:      o.config.Chaos,
+		Hostnames:   o.config.HostnameRequests,
+		Maintenance: o.config.Maintenance,
+		Health:      o.config.ConnectorHealth,
+	})
+	previousProxy, _ := o.proxy.Load().(*proxy.Proxy)
 	o.proxy.Store(newProxy)
+	if previousProxy != nil {
+		previousProxy.ReplacedBy(newProxy)
+	}
 	o.config.Ingress = &ingressRules
 	o.config.WarpRouting = warpRouting
 
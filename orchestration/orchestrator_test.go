@@ -40,6 +40,47 @@ var (
 	}
 )
 
+type countingReloadNotifier struct {
+	reloading, reloaded int
+}
+
+func (n *countingReloadNotifier) Reloading() {
+	n.reloading++
+}
+
+func (n *countingReloadNotifier) Reloaded() {
+	n.reloaded++
+}
+
+func TestReloadNotifier(t *testing.T) {
+	notifier := &countingReloadNotifier{}
+	initConfig := &Config{
+		Ingress:        &ingress.Ingress{},
+		ReloadNotifier: notifier,
+	}
+	orchestrator, err := NewOrchestrator(context.Background(), initConfig, testTags, &testLogger)
+	require.NoError(t, err)
+	// The initial configuration isn't a reload
+	require.Equal(t, countingReloadNotifier{}, *notifier)
+
+	configJSON := []byte(`{"ingress": [{"service": "http_status:404"}]}`)
+	resp := orchestrator.UpdateConfig(1, configJSON)
+	require.NoError(t, resp.Err)
+	require.Equal(t, countingReloadNotifier{reloading: 1, reloaded: 1}, *notifier)
+
+	// Failed reloads are notified too
+	resp = orchestrator.UpdateConfig(2, []byte(`{"ingress": [{"hostname": "test.example.com", "service": "http_status:404"}]}`))
+	require.Error(t, resp.Err)
+	require.Equal(t, countingReloadNotifier{reloading: 2, reloaded: 2}, *notifier)
+
+	// Old versions aren't
+	orchestrator.UpdateConfig(1, configJSON)
+	require.Equal(t, countingReloadNotifier{reloading: 2, reloaded: 2}, *notifier)
+
+	require.NoError(t, orchestrator.UpdateLocalIngress(*initConfig.Ingress))
+	require.Equal(t, countingReloadNotifier{reloading: 3, reloaded: 3}, *notifier)
+}
+
 // TestUpdateConfiguration tests that
 // - configurations can be deserialized
 // - proxy can be updated
@@ -719,3 +760,50 @@ func (rrw *respReadWriteFlusher) WriteHeader(statusCode int) {
 		close(rrw.hasStatus)
 	})
 }
+
+func TestServeTCPListener(t *testing.T) {
+	origin, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer origin.Close()
+	go func() {
+		conn, err := origin.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	orchestrator, err := NewOrchestrator(ctx, &Config{Ingress: &ingress.Ingress{}}, testTags, &testLogger)
+	require.NoError(t, err)
+	ingressRules, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{Hostname: "tcp.example.com", Service: "tcp://" + origin.Addr().String()},
+			{Service: "http_status:404"},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, orchestrator.UpdateLocalIngress(ingressRules))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	errC := make(chan error)
+	go func() {
+		errC <- orchestrator.ServeTCPListener(ctx, listener, "tcp.example.com")
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	pong := make([]byte, 4)
+	_, err = io.ReadFull(conn, pong)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(pong))
+
+	cancel()
+	require.NoError(t, <-errC)
+}
@@ -0,0 +1,39 @@
+package orchestration
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+
+	"github.com/cloudflare/cloudflared/proxy"
+)
+
+// ServeTCPListener forwards the connections accepted by listener to the origin of the ingress rule matching
+// hostname, with the proxy of the configuration current when they're accepted. It closes listener and returns nil
+// once ctx is done.
+func (o *Orchestrator) ServeTCPListener(ctx context.Context, listener net.Listener, hostname string) error {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	o.log.Info().Str(proxy.LogFieldListener, listener.Addr().String()).Str("hostname", hostname).Msg("Forwarding local TCP connections")
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrapf(err, "failed to accept connections on %s", listener.Addr())
+		}
+		originProxy, ok := o.proxy.Load().(*proxy.Proxy)
+		if !ok {
+			o.log.Error().Str(proxy.LogFieldListener, listener.Addr().String()).Msg("Closed local TCP connection, the origin proxy isn't configured")
+			_ = conn.Close()
+			continue
+		}
+		go func() {
+			_ = originProxy.ProxyLocalTCP(ctx, conn, hostname)
+		}()
+	}
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/cloudflared/chaos"
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+// chaosHTTPOriginProxy delays the requests to an HTTPOriginProxy, and fails some of them, as configured by its injector
+type chaosHTTPOriginProxy struct {
+	ingress.HTTPOriginProxy
+	faults *chaos.Injector
+}
+
+func (p *chaosHTTPOriginProxy) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := p.faults.Dial(req.Context()); err != nil {
+		return nil, err
+	}
+	return p.HTTPOriginProxy.RoundTrip(req)
+}
+
+// chaosOriginProxy delays the connections of a StreamBasedOriginProxy, and fails some of them, as configured by its
+// injector
+type chaosOriginProxy struct {
+	ingress.StreamBasedOriginProxy
+	faults *chaos.Injector
+}
+
+func (p *chaosOriginProxy) EstablishConnection(ctx context.Context, dest string) (ingress.OriginConnection, error) {
+	if err := p.faults.Dial(ctx); err != nil {
+		return nil, err
+	}
+	return p.StreamBasedOriginProxy.EstablishConnection(ctx, dest)
+}
+
+// chaosUDPProxy delays the datagrams sent to the origin of a UDP session, and drops some of them in both directions,
+// as configured by its injector
+type chaosUDPProxy struct {
+	ingress.UDPProxy
+	faults *chaos.Injector
+}
+
+func (p *chaosUDPProxy) Read(b []byte) (int, error) {
+	for {
+		n, err := p.UDPProxy.Read(b)
+		if err != nil || !p.faults.DropDatagram() {
+			return n, err
+		}
+	}
+}
+
+func (p *chaosUDPProxy) Write(b []byte) (int, error) {
+	if p.faults.DropDatagram() {
+		return len(b), nil
+	}
+	delay := p.faults.Delay()
+	if delay <= 0 {
+		return p.UDPProxy.Write(b)
+	}
+	// The caller may reuse b once Write returns
+	datagram := append([]byte(nil), b...)
+	time.AfterFunc(delay, func() {
+		_, _ = p.UDPProxy.Write(datagram)
+	})
+	return len(b), nil
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Headers the edge adds to the requests of eyeballs that present a client certificate, with mTLS and the managed
+// transform adding the TLS client auth headers
+const (
+	edgeCertPresentedHeader   = "Cf-Cert-Presented"
+	edgeCertVerifiedHeader    = "Cf-Cert-Verified"
+	edgeCertRevokedHeader     = "Cf-Cert-Revoked"
+	edgeCertSubjectHeader     = "Cf-Cert-Subject-Dn-Rfc2253"
+	edgeCertFingerprintHeader = "Cf-Cert-Fingerprint-Sha256"
+	edgeCertNotBeforeHeader   = "Cf-Cert-Not-Before"
+	edgeCertNotAfterHeader    = "Cf-Cert-Not-After"
+
+	// edgeCertTimeLayout is the format of the validity of the certificate in the headers of the edge
+	edgeCertTimeLayout = "Jan _2 15:04:05 2006 MST"
+)
+
+// Headers forwarded to the origin with forwardClientCert
+const (
+	// ClientCertVerifiedHeader is true if the edge verified the client certificate and it isn't revoked
+	ClientCertVerifiedHeader = "X-Client-Cert-Verified"
+	// ClientCertSubjectHeader is the subject of the client certificate, as an RFC 2253 distinguished name
+	ClientCertSubjectHeader = "X-Client-Cert-Subject"
+	// ClientCertFingerprintHeader is the SHA-256 fingerprint of the client certificate, in lowercase hex
+	ClientCertFingerprintHeader = "X-Client-Cert-Fingerprint-Sha256"
+	// ClientCertNotBeforeHeader is the start of the validity of the client certificate, in RFC 3339
+	ClientCertNotBeforeHeader = "X-Client-Cert-Not-Before"
+	// ClientCertNotAfterHeader is the end of the validity of the client certificate, in RFC 3339
+	ClientCertNotAfterHeader = "X-Client-Cert-Not-After"
+)
+
+var clientCertHeaders = []string{
+	ClientCertVerifiedHeader,
+	ClientCertSubjectHeader,
+	ClientCertFingerprintHeader,
+	ClientCertNotBeforeHeader,
+	ClientCertNotAfterHeader,
+}
+
+// forwardClientCert replaces the client certificate headers of header with the details of the certificate the eyeball
+// presented to the edge. The client certificate headers the eyeball sent are always removed. The Cf-Cert-* headers
+// they're made from can only be trusted when the managed transform adding them is enabled, as the edge doesn't remove
+// the ones the eyeball sent otherwise: cloudflared can't tell them apart.
+func forwardClientCert(header http.Header) {
+	for _, name := range clientCertHeaders {
+		header.Del(name)
+	}
+	if !strings.EqualFold(header.Get(edgeCertPresentedHeader), "true") {
+		return
+	}
+
+	verified := strings.EqualFold(header.Get(edgeCertVerifiedHeader), "true") &&
+		!strings.EqualFold(header.Get(edgeCertRevokedHeader), "true")
+	if verified {
+		header.Set(ClientCertVerifiedHeader, "true")
+	} else {
+		header.Set(ClientCertVerifiedHeader, "false")
+	}
+	if subject := header.Get(edgeCertSubjectHeader); subject != "" {
+		header.Set(ClientCertSubjectHeader, subject)
+	}
+	if fingerprint := header.Get(edgeCertFingerprintHeader); fingerprint != "" {
+		fingerprint = strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+		header.Set(ClientCertFingerprintHeader, fingerprint)
+	}
+	setClientCertTime(header, ClientCertNotBeforeHeader, header.Get(edgeCertNotBeforeHeader))
+	setClientCertTime(header, ClientCertNotAfterHeader, header.Get(edgeCertNotAfterHeader))
+}
+
+// setClientCertTime sets the header name to value in RFC 3339, unless value isn't in the format of the edge
+func setClientCertTime(header http.Header, name, value string) {
+	t, err := time.Parse(edgeCertTimeLayout, value)
+	if err != nil {
+		return
+	}
+	header.Set(name, t.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/tracing"
+)
+
+func TestForwardClientCert(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected map[string]string
+	}{
+		{
+			name: "verified certificate",
+			header: http.Header{
+				edgeCertPresentedHeader:   {"true"},
+				edgeCertVerifiedHeader:    {"true"},
+				edgeCertRevokedHeader:     {"false"},
+				edgeCertSubjectHeader:     {"CN=client.example.com,O=Example"},
+				edgeCertFingerprintHeader: {"6B:4E:C8:5F"},
+				edgeCertNotBeforeHeader:   {"Dec  2 19:39:00 2022 GMT"},
+				edgeCertNotAfterHeader:    {"Dec 22 19:39:00 2023 GMT"},
+			},
+			expected: map[string]string{
+				ClientCertVerifiedHeader:    "true",
+				ClientCertSubjectHeader:     "CN=client.example.com,O=Example",
+				ClientCertFingerprintHeader: "6b4ec85f",
+				ClientCertNotBeforeHeader:   "2022-12-02T19:39:00Z",
+				ClientCertNotAfterHeader:    "2023-12-22T19:39:00Z",
+			},
+		},
+		{
+			name: "revoked certificate",
+			header: http.Header{
+				edgeCertPresentedHeader: {"true"},
+				edgeCertVerifiedHeader:  {"true"},
+				edgeCertRevokedHeader:   {"true"},
+				edgeCertNotAfterHeader:  {"invalid"},
+			},
+			expected: map[string]string{
+				ClientCertVerifiedHeader: "false",
+			},
+		},
+		{
+			name: "spoofed headers without certificate",
+			header: http.Header{
+				edgeCertPresentedHeader:  {"false"},
+				ClientCertVerifiedHeader: {"true"},
+				ClientCertSubjectHeader:  {"CN=admin"},
+			},
+			expected: map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forwardClientCert(test.header)
+			for _, name := range clientCertHeaders {
+				assert.Equal(t, test.expected[name], test.header.Get(name), name)
+			}
+		})
+	}
+}
+
+func TestProxyForwardClientCert(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(r.Header)
+	}))
+	defer origin.Close()
+
+	enabled := true
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{Hostname: "mtls.example.com", Service: origin.URL, OriginRequest: config.OriginRequestConfig{ForwardClientCert: &enabled}},
+			{Service: origin.URL},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ing.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log, Options{})
+
+	originHeader := func(url string) http.Header {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		req.Header.Set(edgeCertPresentedHeader, "true")
+		req.Header.Set(edgeCertVerifiedHeader, "true")
+		req.Header.Set(edgeCertSubjectHeader, "CN=client.example.com")
+		req.Header.Set(ClientCertSubjectHeader, "CN=admin")
+		responseWriter := newMockHTTPRespWriter()
+		require.NoError(t, proxy.ProxyHTTP(responseWriter, tracing.NewTracedHTTPRequest(req, &log), false))
+		var header http.Header
+		require.NoError(t, json.NewDecoder(responseWriter.Body).Decode(&header))
+		return header
+	}
+
+	header := originHeader("http://mtls.example.com")
+	assert.Equal(t, "true", header.Get(ClientCertVerifiedHeader))
+	assert.Equal(t, "CN=client.example.com", header.Get(ClientCertSubjectHeader))
+
+	// Rules without forwardClientCert proxy the headers as they are
+	header = originHeader("http://other.example.com")
+	assert.Empty(t, header.Get(ClientCertVerifiedHeader))
+	assert.Equal(t, "CN=admin", header.Get(ClientCertSubjectHeader))
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/flowtable"
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+// flowTrackingOriginProxy tracks the TCP flows of a StreamBasedOriginProxy while they are streamed
+type flowTrackingOriginProxy struct {
+	ingress.StreamBasedOriginProxy
+	flows  *flowtable.Table
+	flowID string
+}
+
+func (p *flowTrackingOriginProxy) EstablishConnection(ctx context.Context, dest string) (ingress.OriginConnection, error) {
+	originConn, err := p.StreamBasedOriginProxy.EstablishConnection(ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+	return &flowTrackingConnection{
+		OriginConnection: originConn,
+		flows:            p.flows,
+		flowID:           p.flowID,
+		dest:             dest,
+	}, nil
+}
+
+type flowTrackingConnection struct {
+	ingress.OriginConnection
+	flows  *flowtable.Table
+	flowID string
+	dest   string
+}
+
+func (c *flowTrackingConnection) Stream(ctx context.Context, tunnelConn io.ReadWriter, log *zerolog.Logger) {
+	src := ""
+	if conn, ok := c.OriginConnection.(interface{ LocalAddr() net.Addr }); ok {
+		src = conn.LocalAddr().String()
+	}
+	flow := c.flows.Add(flowtable.TCP, c.flowID, src, c.dest)
+	defer c.flows.Remove(flow)
+	c.OriginConnection.Stream(ctx, &flowCountingReadWriter{ReadWriter: tunnelConn, flow: flow}, log)
+}
+
+// flowCountingReadWriter counts the bytes of a flow on the tunnel side: what's read is sent to the origin, and what's
+// written was received from the origin
+type flowCountingReadWriter struct {
+	io.ReadWriter
+	flow *flowtable.Flow
+}
+
+func (rw *flowCountingReadWriter) Read(p []byte) (int, error) {
+	n, err := rw.ReadWriter.Read(p)
+	rw.flow.AddBytesToOrigin(n)
+	return n, err
+}
+
+func (rw *flowCountingReadWriter) Write(p []byte) (int, error) {
+	n, err := rw.ReadWriter.Write(p)
+	rw.flow.AddBytesFromOrigin(n)
+	return n, err
+}
+
+// flowTrackingUDPProxy tracks the flow of a UDP session until it's closed
+type flowTrackingUDPProxy struct {
+	ingress.UDPProxy
+	flows     *flowtable.Table
+	flow      *flowtable.Flow
+	closeOnce sync.Once
+}
+
+func (p *flowTrackingUDPProxy) Read(b []byte) (int, error) {
+	n, err := p.UDPProxy.Read(b)
+	p.flow.AddBytesFromOrigin(n)
+	return n, err
+}
+
+func (p *flowTrackingUDPProxy) Write(b []byte) (int, error) {
+	n, err := p.UDPProxy.Write(b)
+	p.flow.AddBytesToOrigin(n)
+	return n, err
+}
+
+func (p *flowTrackingUDPProxy) Close() error {
+	p.closeOnce.Do(func() {
+		p.flows.Remove(p.flow)
+	})
+	return p.UDPProxy.Close()
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflared/connection"
+)
+
+// flushWriter sends every write to the eyeball right away
+type flushWriter struct {
+	w       io.Writer
+	flusher connection.ResponseFlusher
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if err == nil {
+		fw.flusher.Flush()
+	}
+	return n, err
+}
+
+// intervalFlushWriter sends the writes to the eyeball at most interval after they're written. It only schedules a
+// flush when something was written, so idle responses don't wake it up.
+type intervalFlushWriter struct {
+	w        io.Writer
+	flusher  connection.ResponseFlusher
+	interval time.Duration
+
+	lock         sync.Mutex
+	flushPending bool
+	timer        *time.Timer
+	stopped      bool
+}
+
+func (fw *intervalFlushWriter) Write(p []byte) (int, error) {
+	fw.lock.Lock()
+	defer fw.lock.Unlock()
+	n, err := fw.w.Write(p)
+	if err != nil || fw.flushPending || fw.stopped {
+		return n, err
+	}
+	fw.flushPending = true
+	if fw.timer == nil {
+		fw.timer = time.AfterFunc(fw.interval, fw.delayedFlush)
+	} else {
+		fw.timer.Reset(fw.interval)
+	}
+	return n, err
+}
+
+func (fw *intervalFlushWriter) delayedFlush() {
+	fw.lock.Lock()
+	defer fw.lock.Unlock()
+	if !fw.flushPending || fw.stopped {
+		return
+	}
+	fw.flusher.Flush()
+	fw.flushPending = false
+}
+
+// stop cancels the pending flush, the response writer mustn't be used once the proxy returns
+func (fw *intervalFlushWriter) stop() {
+	fw.lock.Lock()
+	defer fw.lock.Unlock()
+	fw.stopped = true
+	if fw.timer != nil {
+		fw.timer.Stop()
+	}
+}
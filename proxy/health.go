@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/tunnelstate"
+)
+
+// ConnectorHealth tracks the connections of cloudflared to the edge, to answer the requests to the healthPath of the
+// ingress rules without proxying them to the origin. It lets monitors tell the issues of the tunnel from those of the
+// origin.
+type ConnectorHealth struct {
+	tracker *tunnelstate.ConnTracker
+	started time.Time
+}
+
+// HealthStatus is the body of the answers to the requests to healthPath
+type HealthStatus struct {
+	Status           string             `json:"status"`
+	ReadyConnections uint               `json:"readyConnections"`
+	Connections      []HealthConnection `json:"connections"`
+	Uptime           float64            `json:"uptimeSeconds"`
+}
+
+// HealthConnection is the state of a connection to the edge in HealthStatus
+type HealthConnection struct {
+	Index       uint8      `json:"index"`
+	Connected   bool       `json:"connected"`
+	Protocol    string     `json:"protocol,omitempty"`
+	Location    string     `json:"location,omitempty"`
+	ConnectedAt *time.Time `json:"connectedAt,omitempty"`
+}
+
+func NewConnectorHealth(log *zerolog.Logger) *ConnectorHealth {
+	return &ConnectorHealth{
+		tracker: tunnelstate.NewConnTracker(log),
+		started: time.Now(),
+	}
+}
+
+// OnTunnelEvent implements connection.EventSink
+func (h *ConnectorHealth) OnTunnelEvent(event connection.Event) {
+	h.tracker.OnTunnelEvent(event)
+}
+
+// Status returns the state of the connections to the edge. cloudflared is healthy if at least one is connected.
+func (h *ConnectorHealth) Status() HealthStatus {
+	status := HealthStatus{
+		Status:      "healthy",
+		Connections: []HealthConnection{},
+		Uptime:      time.Since(h.started).Seconds(),
+	}
+	for index, info := range h.tracker.Connections() {
+		conn := HealthConnection{
+			Index:     index,
+			Connected: info.IsConnected,
+			Location:  info.Location,
+		}
+		if info.IsConnected {
+			status.ReadyConnections++
+			conn.Protocol = info.Protocol.String()
+			connectedAt := info.ConnectedAt
+			conn.ConnectedAt = &connectedAt
+		}
+		status.Connections = append(status.Connections, conn)
+	}
+	sort.Slice(status.Connections, func(i, j int) bool {
+		return status.Connections[i].Index < status.Connections[j].Index
+	})
+	if status.ReadyConnections == 0 {
+		status.Status = "unhealthy"
+	}
+	return status
+}
+
+// isHealthRequest is whether req is to the healthPath of its rule, and should be answered by writeHealth
+func (p *Proxy) isHealthRequest(req *http.Request, healthPath string) bool {
+	return p.health != nil && healthPath != "" && req.URL.Path == healthPath
+}
+
+// writeHealth answers a request to the healthPath of a rule with the health of cloudflared, with 200 OK if it's
+// healthy and 503 Service Unavailable otherwise
+func (p *Proxy) writeHealth(w connection.ResponseWriter) error {
+	status := p.health.Status()
+	code := http.StatusOK
+	if status.ReadyConnections == 0 {
+		code = http.StatusServiceUnavailable
+	}
+	body, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	incrementResponseByCode(code)
+	header := http.Header{
+		"Content-Type":  {"application/json"},
+		"Cache-Control": {"no-store"},
+	}
+	if err := w.WriteRespHeaders(code, header); err != nil {
+		return err
+	}
+	_, _ = w.Write(body)
+	return nil
+}
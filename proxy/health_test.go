@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/tracing"
+)
+
+func TestProxyHealthPath(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer origin.Close()
+
+	healthPath := "/_tunnel/healthz"
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{Hostname: "monitored.example.com", Service: origin.URL, OriginRequest: config.OriginRequestConfig{HealthPath: &healthPath}},
+			{Service: origin.URL},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ing.StartOrigins(&log, ctx.Done()))
+	health := NewConnectorHealth(&log)
+	maintenance := NewMaintenance(&log)
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log, Options{Maintenance: maintenance, Health: health})
+
+	proxyRequest := func(url string) *mockHTTPRespWriter {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		responseWriter := newMockHTTPRespWriter()
+		require.NoError(t, proxy.ProxyHTTP(responseWriter, tracing.NewTracedHTTPRequest(req, &log), false))
+		return responseWriter
+	}
+
+	responseWriter := proxyRequest("http://monitored.example.com/_tunnel/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, responseWriter.Code)
+	var status HealthStatus
+	require.NoError(t, json.NewDecoder(responseWriter.Body).Decode(&status))
+	assert.Equal(t, "unhealthy", status.Status)
+
+	health.OnTunnelEvent(connection.Event{Index: 0, EventType: connection.Connected, Protocol: connection.QUIC, Location: "lhr01"})
+	health.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Connected, Protocol: connection.QUIC, Location: "cdg01"})
+	health.OnTunnelEvent(connection.Event{Index: 1, EventType: connection.Reconnecting})
+	// The health is answered during maintenance, since it's about the tunnel rather than the origin
+	maintenance.Enable("monitored.example.com")
+	responseWriter = proxyRequest("http://monitored.example.com/_tunnel/healthz")
+	assert.Equal(t, http.StatusOK, responseWriter.Code)
+	assert.Equal(t, "no-store", responseWriter.Header().Get("Cache-Control"))
+	status = HealthStatus{}
+	require.NoError(t, json.NewDecoder(responseWriter.Body).Decode(&status))
+	assert.Equal(t, "healthy", status.Status)
+	assert.Equal(t, uint(1), status.ReadyConnections)
+	require.Len(t, status.Connections, 2)
+	assert.Equal(t, "quic", status.Connections[0].Protocol)
+	assert.Equal(t, "lhr01", status.Connections[0].Location)
+	assert.NotNil(t, status.Connections[0].ConnectedAt)
+	assert.False(t, status.Connections[1].Connected)
+	assert.Nil(t, status.Connections[1].ConnectedAt)
+	maintenance.Disable("monitored.example.com")
+
+	// Other paths and rules without healthPath are proxied to the origin
+	assert.Equal(t, http.StatusTeapot, proxyRequest("http://monitored.example.com/").Code)
+	assert.Equal(t, http.StatusTeapot, proxyRequest("http://other.example.com/_tunnel/healthz").Code)
+}
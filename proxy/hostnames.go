@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"container/list"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// otherHostnames is the label of the requests to the hostnames that don't have their own label
+	otherHostnames = "other"
+	// hostnameLabelIdle is how long a hostname has to go without requests for another hostname to take its label
+	hostnameLabelIdle = 10 * time.Minute
+)
+
+// HostnameRequests counts the requests by hostname in the requests_by_hostname metric. At most limit hostnames have
+// their own label, so that the metric stays bounded when a wildcard rule serves many hostnames. Once they are all
+// taken, a new hostname takes the label of the least recently requested hostname if it's been idle for
+// hostnameLabelIdle, and is counted as "other" otherwise.
+type HostnameRequests struct {
+	limit int
+	now   func() time.Time
+
+	lock sync.Mutex
+	// recent has the hostnames with a label, from the most recently requested
+	recent    *list.List
+	hostnames map[string]*list.Element
+}
+
+type hostnameLabel struct {
+	hostname      string
+	lastRequested time.Time
+}
+
+// NewHostnameRequests returns the counter of the requests of up to limit hostnames, or nil if limit is 0.
+func NewHostnameRequests(limit int) *HostnameRequests {
+	if limit <= 0 {
+		return nil
+	}
+	return &HostnameRequests{
+		limit:     limit,
+		now:       time.Now,
+		recent:    list.New(),
+		hostnames: make(map[string]*list.Element),
+	}
+}
+
+// Inc counts a request to hostname, which may have a port.
+func (h *HostnameRequests) Inc(hostname string) {
+	if h == nil {
+		return
+	}
+	requestsByHostname.WithLabelValues(h.label(hostname)).Inc()
+}
+
+func (h *HostnameRequests) label(hostname string) string {
+	if host, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = host
+	}
+	hostname = strings.ToLower(hostname)
+	if hostname == "" {
+		return otherHostnames
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	now := h.now()
+	if element, ok := h.hostnames[hostname]; ok {
+		element.Value.(*hostnameLabel).lastRequested = now
+		h.recent.MoveToFront(element)
+		return hostname
+	}
+	if h.recent.Len() >= h.limit {
+		oldest := h.recent.Back()
+		label := oldest.Value.(*hostnameLabel)
+		if now.Sub(label.lastRequested) < hostnameLabelIdle {
+			return otherHostnames
+		}
+		h.recent.Remove(oldest)
+		delete(h.hostnames, label.hostname)
+		requestsByHostname.DeleteLabelValues(label.hostname)
+	}
+	h.hostnames[hostname] = h.recent.PushFront(&hostnameLabel{hostname: hostname, lastRequested: now})
+	return hostname
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostnameRequests(t *testing.T) {
+	assert.Nil(t, NewHostnameRequests(0))
+	var disabled *HostnameRequests
+	disabled.Inc("example.com")
+
+	hostnames := NewHostnameRequests(2)
+	now := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	hostnames.now = func() time.Time { return now }
+	requests := func(hostname string) float64 {
+		return testutil.ToFloat64(requestsByHostname.WithLabelValues(hostname))
+	}
+	others := requests(otherHostnames)
+
+	hostnames.Inc("a.example.com")
+	hostnames.Inc("B.example.com:443")
+	hostnames.Inc("a.example.com")
+	assert.Equal(t, 2.0, requests("a.example.com"))
+	assert.Equal(t, 1.0, requests("b.example.com"))
+
+	// The labels are all taken by hostnames that were requested recently
+	now = now.Add(hostnameLabelIdle / 2)
+	hostnames.Inc("a.example.com")
+	hostnames.Inc("c.example.com")
+	assert.Equal(t, others+1, requests(otherHostnames))
+
+	// b.example.com went idle, so c.example.com takes its label
+	now = now.Add(hostnameLabelIdle / 2)
+	hostnames.Inc("c.example.com")
+	assert.Equal(t, 1.0, requests("c.example.com"))
+	assert.Equal(t, 3.0, requests("a.example.com"))
+	assert.Equal(t, 0.0, requests("b.example.com"), "the label of b.example.com was deleted")
+	assert.Equal(t, others+1, requests(otherHostnames))
+}
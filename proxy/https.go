@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+const (
+	// forwardedProtoHeader is the scheme the eyeball sent its request over, as set by the edge
+	forwardedProtoHeader = "X-Forwarded-Proto"
+	hstsHeader           = "Strict-Transport-Security"
+)
+
+// isPlainHTTP is whether the eyeball sent req over plain HTTP. Requests without X-Forwarded-Proto aren't, since their
+// scheme is unknown.
+func isPlainHTTP(req *http.Request) bool {
+	return req.Header.Get(forwardedProtoHeader) == "http"
+}
+
+// redirectToHTTPS answers req with a permanent redirect to its URL over HTTPS. 308 keeps the method and body of the
+// request, unlike 301.
+func redirectToHTTPS(w connection.ResponseWriter, req *http.Request) error {
+	incrementResponseByCode(http.StatusPermanentRedirect)
+	return w.WriteRespHeaders(http.StatusPermanentRedirect, http.Header{"Location": {httpsLocation(req)}})
+}
+
+// httpsLocation is the URL of req over HTTPS
+func httpsLocation(req *http.Request) string {
+	host := req.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	location := url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     req.URL.Path,
+		RawPath:  req.URL.RawPath,
+		RawQuery: req.URL.RawQuery,
+	}
+	return location.String()
+}
+
+// setHSTS adds the Strict-Transport-Security header of cfg to header, the response to req, if the eyeball sent req
+// over HTTPS and the origin didn't set its own
+func setHSTS(header http.Header, req *http.Request, cfg ingress.OriginRequestConfig) {
+	maxAge := cfg.HSTSMaxAge.Duration
+	if maxAge <= 0 || req.Header.Get(forwardedProtoHeader) != "https" || header.Get(hstsHeader) != "" {
+		return
+	}
+	value := fmt.Sprintf("max-age=%d", int64(maxAge.Seconds()))
+	if cfg.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	header.Set(hstsHeader, value)
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/tracing"
+)
+
+func TestProxyHTTPSRedirectAndHSTS(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/own-hsts" {
+			w.Header().Set(hstsHeader, "max-age=60")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer origin.Close()
+
+	enabled := true
+	maxAge := config.CustomDuration{Duration: 365 * 24 * time.Hour}
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Service: origin.URL,
+				OriginRequest: config.OriginRequestConfig{
+					HTTPSRedirect:         &enabled,
+					HSTSMaxAge:            &maxAge,
+					HSTSIncludeSubdomains: &enabled,
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ing.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log, Options{})
+
+	proxyRequest := func(url, proto string) *mockHTTPRespWriter {
+		req, err := http.NewRequest(http.MethodPost, url, nil)
+		require.NoError(t, err)
+		req.Header.Set(forwardedProtoHeader, proto)
+		responseWriter := newMockHTTPRespWriter()
+		require.NoError(t, proxy.ProxyHTTP(responseWriter, tracing.NewTracedHTTPRequest(req, &log), false))
+		return responseWriter
+	}
+
+	responseWriter := proxyRequest("http://example.com:80/path?query=1", "http")
+	assert.Equal(t, http.StatusPermanentRedirect, responseWriter.Code)
+	assert.Equal(t, "https://example.com/path?query=1", responseWriter.Header().Get("Location"))
+	assert.Empty(t, responseWriter.Header().Get(hstsHeader))
+
+	responseWriter = proxyRequest("http://example.com/path", "https")
+	assert.Equal(t, http.StatusOK, responseWriter.Code)
+	assert.Equal(t, "max-age=31536000; includeSubDomains", responseWriter.Header().Get(hstsHeader))
+
+	// The header set by the origin is kept
+	responseWriter = proxyRequest("http://example.com/own-hsts", "https")
+	assert.Equal(t, "max-age=60", responseWriter.Header().Get(hstsHeader))
+
+	// Requests of unknown scheme are neither redirected nor get the header
+	responseWriter = proxyRequest("http://example.com/path", "")
+	assert.Equal(t, http.StatusOK, responseWriter.Code)
+	assert.Empty(t, responseWriter.Header().Get(hstsHeader))
+}
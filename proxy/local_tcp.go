@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+// LogFieldListener is the local address of a TCP listener in the access logs of its connections
+const LogFieldListener = "listener"
+
+// ProxyLocalTCP forwards conn, accepted by a local TCP listener of cloudflared, to the origin of the ingress rule
+// matching hostname, as plain TCP. The origin must be a TCP service. The connection is logged when it's closed, with
+// how much was sent in each direction, unless the rule disables its access logs.
+func (p *Proxy) ProxyLocalTCP(ctx context.Context, conn net.Conn, hostname string) error {
+	incrementRequests()
+	defer decrementConcurrentRequests()
+	defer conn.Close()
+
+	rule, ruleNum := p.ingressRules.FindMatchingRule(hostname, "")
+	ruleID, srv := ruleField(p.ingressRules, ruleNum)
+	originProxy, ok := rule.Service.(ingress.StreamBasedOriginProxy)
+	if !ok || rule.Service.String() == ingress.ServiceBastion {
+		err := fmt.Errorf("the origin %s of the ingress rule matching %s isn't a TCP service", srv, hostname)
+		p.logRequestError(err, "", "", ruleID, srv)
+		return err
+	}
+	if !p.streams[ruleNum].acquire() {
+		p.log.Debug().Int(LogFieldRule, ruleNum).Msg("Rejected local TCP connection, the ingress rule reached maxConcurrentStreams")
+		return nil
+	}
+	defer p.streams[ruleNum].release()
+	if p.faults != nil {
+		originProxy = &chaosOriginProxy{StreamBasedOriginProxy: originProxy, faults: p.faults}
+	}
+
+	start := time.Now()
+	originConn, err := originProxy.EstablishConnection(ctx, srv)
+	if err != nil {
+		p.logRequestError(err, "", "", ruleID, srv)
+		return err
+	}
+	defer originConn.Close()
+	rawConn, ok := originConn.(ingress.RawOriginConnection)
+	if !ok {
+		err := fmt.Errorf("the origin %s of the ingress rule matching %s doesn't accept plain TCP", srv, hostname)
+		p.logRequestError(err, "", "", ruleID, srv)
+		return err
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// streamCtx is done if ctx is cancelled or if StreamRaw returns
+		<-streamCtx.Done()
+		originConn.Close()
+	}()
+	localConn := &localTCPConn{Conn: conn}
+	rawConn.StreamRaw(streamCtx, localConn, p.log)
+	if rule.Config.DisableAccessLog {
+		return nil
+	}
+	log := p.log.Info().Str(LogFieldListener, conn.LocalAddr().String())
+	if rule.Config.AccessLogs(ingress.AccessLogFieldClient) {
+		log = log.Str("client", conn.RemoteAddr().String())
+	}
+	log.Str(LogFieldRule, ruleID).
+		Str(LogFieldOriginService, srv).
+		Dur("duration", time.Since(start)).
+		Uint64("bytesReceived", atomic.LoadUint64(&localConn.received)).
+		Uint64("bytesSent", atomic.LoadUint64(&localConn.sent)).
+		Msg("Local TCP connection closed")
+	return nil
+}
+
+// localTCPConn is a connection accepted by a local TCP listener, which counts the bytes received from the client and
+// sent to it
+type localTCPConn struct {
+	net.Conn
+	received uint64
+	sent     uint64
+}
+
+func (c *localTCPConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddUint64(&c.received, uint64(n))
+	return n, err
+}
+
+func (c *localTCPConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddUint64(&c.sent, uint64(n))
+	return n, err
+}
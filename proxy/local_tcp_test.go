@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+func TestProxyLocalTCP(t *testing.T) {
+	origin, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer origin.Close()
+	go func() {
+		conn, err := origin.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{Hostname: "tcp.example.com", Service: "tcp://" + origin.Addr().String()},
+			{Service: "http_status:404"},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ing.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log, Options{})
+
+	client, conn := net.Pipe()
+	errC := make(chan error)
+	go func() {
+		errC <- proxy.ProxyLocalTCP(ctx, conn, "tcp.example.com")
+	}()
+	_, err = client.Write([]byte("ping"))
+	require.NoError(t, err)
+	pong := make([]byte, 4)
+	_, err = io.ReadFull(client, pong)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(pong))
+	require.NoError(t, client.Close())
+	assert.NoError(t, <-errC)
+
+	// Only TCP services can be forwarded to
+	client, conn = net.Pipe()
+	defer client.Close()
+	assert.Error(t, proxy.ProxyLocalTCP(ctx, conn, "other.example.com"))
+}
@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+const (
+	// defaultMaintenanceStatus answers the requests to rules in maintenance mode without maintenanceStatus
+	defaultMaintenanceStatus = http.StatusServiceUnavailable
+	defaultMaintenanceBody   = "The service is down for maintenance.\n"
+
+	// MaintenanceRequestHeader must be set on the requests toggling maintenance mode. Browsers don't send custom
+	// headers across origins without a CORS preflight, so web pages can't toggle it.
+	MaintenanceRequestHeader = "Cloudflared-Maintenance"
+)
+
+// Maintenance is the set of the ingress rules in maintenance mode, by hostname. Their requests are answered with the
+// maintenance page of the rule instead of being proxied to its origin. It's kept across configuration updates, and
+// toggled on the /maintenance endpoint of the maintenance socket.
+type Maintenance struct {
+	now func() time.Time
+	log *zerolog.Logger
+
+	lock sync.RWMutex
+	// hostnames has when each hostname was put in maintenance mode
+	hostnames map[string]time.Time
+}
+
+// MaintenanceStatus is the state of a hostname in maintenance mode, as served by the /maintenance endpoint
+type MaintenanceStatus struct {
+	Hostname string    `json:"hostname"`
+	Since    time.Time `json:"since"`
+}
+
+func NewMaintenance(log *zerolog.Logger) *Maintenance {
+	return &Maintenance{
+		now:       time.Now,
+		log:       log,
+		hostnames: make(map[string]time.Time),
+	}
+}
+
+// maintenanceKey normalizes the hostname of a rule, the catch-all rule being *
+func maintenanceKey(hostname string) string {
+	if hostname == "" {
+		return "*"
+	}
+	return strings.ToLower(hostname)
+}
+
+// Enable puts the rules with hostname in maintenance mode. hostname is the hostname of the rules as configured, e.g.
+// *.example.com for a wildcard rule, or * for the catch-all rule.
+func (m *Maintenance) Enable(hostname string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := maintenanceKey(hostname)
+	if _, ok := m.hostnames[key]; !ok {
+		m.hostnames[key] = m.now()
+		m.log.Info().Str("hostname", key).Msg("Enabled maintenance mode")
+	}
+}
+
+// Disable takes the rules with hostname out of maintenance mode. It returns false if they weren't in maintenance mode.
+func (m *Maintenance) Disable(hostname string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := maintenanceKey(hostname)
+	if _, ok := m.hostnames[key]; !ok {
+		return false
+	}
+	delete(m.hostnames, key)
+	m.log.Info().Str("hostname", key).Msg("Disabled maintenance mode")
+	return true
+}
+
+// Enabled is whether the rules with hostname are in maintenance mode
+func (m *Maintenance) Enabled(hostname string) bool {
+	if m == nil {
+		return false
+	}
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	_, ok := m.hostnames[maintenanceKey(hostname)]
+	return ok
+}
+
+// Status returns the hostnames in maintenance mode, sorted
+func (m *Maintenance) Status() []MaintenanceStatus {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	status := make([]MaintenanceStatus, 0, len(m.hostnames))
+	for hostname, since := range m.hostnames {
+		status = append(status, MaintenanceStatus{Hostname: hostname, Since: since})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Hostname < status[j].Hostname
+	})
+	return status
+}
+
+// ServeHTTP serves the hostnames in maintenance mode as JSON. POST with the hostname query parameter puts its rules in
+// maintenance mode, and DELETE takes them out of it, both with the MaintenanceRequestHeader.
+func (m *Maintenance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		if r.Header.Get(MaintenanceRequestHeader) == "" {
+			http.Error(w, "the "+MaintenanceRequestHeader+" header is missing", http.StatusForbidden)
+			return
+		}
+		hostname := r.URL.Query().Get("hostname")
+		if hostname == "" {
+			http.Error(w, "the hostname query parameter is missing", http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			m.Enable(hostname)
+		} else if !m.Disable(hostname) {
+			http.Error(w, hostname+" isn't in maintenance mode", http.StatusNotFound)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(m.Status())
+}
+
+// writeMaintenance answers a request to a rule in maintenance mode with the maintenance page of cfg. The page is read
+// for every request, so that it can be edited during the maintenance.
+func (p *Proxy) writeMaintenance(w connection.ResponseWriter, cfg ingress.OriginRequestConfig) error {
+	status := defaultMaintenanceStatus
+	if cfg.MaintenanceStatus != 0 {
+		status = int(cfg.MaintenanceStatus)
+	}
+	body := []byte(defaultMaintenanceBody)
+	contentType := "text/plain; charset=utf-8"
+	if path := cfg.MaintenancePage; path != "" {
+		if page, err := os.ReadFile(path); err != nil {
+			p.log.Err(err).Str("page", path).Msg("Failed to read the maintenance page, answering with the default one")
+		} else {
+			body = page
+			if contentType = mime.TypeByExtension(filepath.Ext(path)); contentType == "" {
+				contentType = http.DetectContentType(page)
+			}
+		}
+	}
+	incrementResponseByCode(status)
+	header := http.Header{
+		"Content-Type":  {contentType},
+		"Cache-Control": {"no-store"},
+	}
+	if err := w.WriteRespHeaders(status, header); err != nil {
+		return err
+	}
+	_, _ = w.Write(body)
+	return nil
+}
@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/tracing"
+)
+
+func TestMaintenanceToggle(t *testing.T) {
+	log := zerolog.Nop()
+	maintenance := NewMaintenance(&log)
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	maintenance.now = func() time.Time { return now }
+
+	assert.False(t, maintenance.Enabled("example.com"))
+	maintenance.Enable("Example.com")
+	maintenance.Enable("")
+	assert.True(t, maintenance.Enabled("example.com"))
+	assert.True(t, maintenance.Enabled("*"))
+	assert.False(t, maintenance.Enabled("other.example.com"))
+	assert.Equal(t, []MaintenanceStatus{{Hostname: "*", Since: now}, {Hostname: "example.com", Since: now}}, maintenance.Status())
+
+	assert.True(t, maintenance.Disable("example.com"))
+	assert.False(t, maintenance.Disable("example.com"))
+	assert.False(t, maintenance.Enabled("example.com"))
+
+	var nilMaintenance *Maintenance
+	assert.False(t, nilMaintenance.Enabled("example.com"))
+}
+
+func TestMaintenanceServeHTTP(t *testing.T) {
+	log := zerolog.Nop()
+	maintenance := NewMaintenance(&log)
+
+	serve := func(method, target string) (*httptest.ResponseRecorder, []MaintenanceStatus) {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set(MaintenanceRequestHeader, "true")
+		maintenance.ServeHTTP(recorder, req)
+		var status []MaintenanceStatus
+		if recorder.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&status))
+		}
+		return recorder, status
+	}
+
+	recorder, status := serve(http.MethodPost, "/maintenance?hostname=example.com")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	require.Len(t, status, 1)
+	assert.Equal(t, "example.com", status[0].Hostname)
+
+	recorder, status = serve(http.MethodGet, "/maintenance")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, status, 1)
+
+	recorder, _ = serve(http.MethodPost, "/maintenance")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder, status = serve(http.MethodDelete, "/maintenance?hostname=example.com")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, status)
+
+	recorder, _ = serve(http.MethodDelete, "/maintenance?hostname=example.com")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder, _ = serve(http.MethodPut, "/maintenance?hostname=example.com")
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+
+	// Without the header, e.g. in a cross-origin request of a web page, maintenance mode isn't toggled
+	recorder = httptest.NewRecorder()
+	maintenance.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/maintenance?hostname=example.com", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.False(t, maintenance.Enabled("example.com"))
+}
+
+func TestProxyMaintenance(t *testing.T) {
+	var originRequests int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&originRequests, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer origin.Close()
+
+	page := filepath.Join(t.TempDir(), "maintenance.html")
+	require.NoError(t, os.WriteFile(page, []byte("<h1>Back soon</h1>"), 0600))
+	maintenanceStatus := uint(http.StatusOK)
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Hostname: "page.example.com",
+				Service:  origin.URL,
+				OriginRequest: config.OriginRequestConfig{
+					MaintenanceStatus: &maintenanceStatus,
+					MaintenancePage:   &page,
+				},
+			},
+			{
+				Service: origin.URL,
+			},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ing.StartOrigins(&log, ctx.Done()))
+	maintenance := NewMaintenance(&log)
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log, Options{Maintenance: maintenance})
+
+	proxyRequest := func(url string) *mockHTTPRespWriter {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		responseWriter := newMockHTTPRespWriter()
+		require.NoError(t, proxy.ProxyHTTP(responseWriter, tracing.NewTracedHTTPRequest(req, &log), false))
+		return responseWriter
+	}
+
+	maintenance.Enable("page.example.com")
+	maintenance.Enable("*")
+
+	responseWriter := proxyRequest("http://page.example.com/")
+	assert.Equal(t, http.StatusOK, responseWriter.Code)
+	assert.Equal(t, "text/html; charset=utf-8", responseWriter.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", responseWriter.Header().Get("Cache-Control"))
+	assert.Equal(t, "<h1>Back soon</h1>", responseWriter.Body.String())
+
+	responseWriter = proxyRequest("http://other.example.com/")
+	assert.Equal(t, http.StatusServiceUnavailable, responseWriter.Code)
+	assert.Equal(t, defaultMaintenanceBody, responseWriter.Body.String())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&originRequests))
+
+	maintenance.Disable("*")
+	responseWriter = proxyRequest("http://other.example.com/")
+	assert.Equal(t, http.StatusOK, responseWriter.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&originRequests))
+}
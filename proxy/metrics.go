@@ -1,14 +1,21 @@
 package proxy
 
 import (
+	"strconv"
+
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/ingress"
 )
 
 // Metrics uses connection.MetricsNamespace(aka cloudflared) as namespace and connection.TunnelSubsystem
 // (tunnel) as subsystem to keep them consistent with the previous qualifier.
 
+// ruleLabels are the labels of the metrics of an ingress rule. Its index isn't one, as it changes when rules are added
+// or removed.
+var ruleLabels = []string{"hostname", "path", "service"}
+
 var (
 	totalRequests = prometheus.NewCounter(
 		prometheus.CounterOpts{
@@ -43,6 +50,69 @@ var (
 			Help:      "Count of error proxying to origin",
 		},
 	)
+	requestsByHostname = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: connection.MetricsNamespace,
+			Subsystem: connection.TunnelSubsystem,
+			Name:      "requests_by_hostname",
+			Help:      "Count of requests by requested hostname, for a bounded number of hostnames and \"other\" for the rest",
+		},
+		[]string{"hostname"},
+	)
+	activeRuleStreams = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: connection.MetricsNamespace,
+			Subsystem: connection.TunnelSubsystem,
+			Name:      "active_rule_streams",
+			Help:      "Concurrent WebSocket and TCP streams proxied to the origin of each ingress rule",
+		},
+		ruleLabels,
+	)
+	originTimeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: connection.MetricsNamespace,
+			Subsystem: connection.TunnelSubsystem,
+			Name:      "origin_timeouts",
+			Help:      "Count of requests answered with 504 Gateway Timeout, by the timeout of the origin that expired",
+		},
+		[]string{"cause"},
+	)
+	pendingRuleRequests = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: connection.MetricsNamespace,
+			Subsystem: connection.TunnelSubsystem,
+			Name:      "pending_rule_requests",
+			Help:      "Requests waiting for the response headers of the origin of each ingress rule with slow origin detection",
+		},
+		ruleLabels,
+	)
+	originLatencyP99 = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: connection.MetricsNamespace,
+			Subsystem: connection.TunnelSubsystem,
+			Name:      "origin_latency_p99_seconds",
+			Help:      "p99 latency until the response headers of the latest requests to the origin of each ingress rule with slow origin detection",
+		},
+		ruleLabels,
+	)
+	slowOriginWarnings = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: connection.MetricsNamespace,
+			Subsystem: connection.TunnelSubsystem,
+			Name:      "slow_origin_warnings",
+			Help:      "Count of warnings about slow origins by ingress rule, because of their latency or of their pending requests",
+		},
+		append(ruleLabels, "reason"),
+	)
+	rejectedRuleStreams = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: connection.MetricsNamespace,
+			Subsystem: connection.TunnelSubsystem,
+			Name:      "rejected_rule_streams",
+			Help:      "Count of WebSocket and TCP streams rejected because the ingress rule reached maxConcurrentStreams",
+		},
+		ruleLabels,
+	)
 )
 
 func init() {
@@ -51,9 +121,36 @@ func init() {
 		concurrentRequests,
 		responseByCode,
 		requestErrors,
+		requestsByHostname,
+		activeRuleStreams,
+		rejectedRuleStreams,
+		originTimeouts,
+		pendingRuleRequests,
+		originLatencyP99,
+		slowOriginWarnings,
 	)
 }
 
+// ruleLabelValues are the values of ruleLabels for rule
+func ruleLabelValues(rule *ingress.Rule) []string {
+	path := ""
+	if rule.Path != nil && rule.Path.Regexp != nil {
+		path = rule.Path.String()
+	}
+	return []string{rule.Hostname, path, rule.Service.String()}
+}
+
+// deleteRuleMetrics deletes the metrics of the ingress rule with labelValues, once it's removed from the configuration
+func deleteRuleMetrics(labelValues []string) {
+	activeRuleStreams.DeleteLabelValues(labelValues...)
+	rejectedRuleStreams.DeleteLabelValues(labelValues...)
+	pendingRuleRequests.DeleteLabelValues(labelValues...)
+	originLatencyP99.DeleteLabelValues(labelValues...)
+	for _, reason := range []string{slowOriginLatency, slowOriginPending} {
+		slowOriginWarnings.DeleteLabelValues(append(labelValues[:len(labelValues):len(labelValues)], reason)...)
+	}
+}
+
 func incrementRequests() {
 	totalRequests.Inc()
 	concurrentRequests.Inc()
@@ -62,3 +159,22 @@ func incrementRequests() {
 func decrementConcurrentRequests() {
 	concurrentRequests.Dec()
 }
+
+// statusCodeLabels are the labels of responseByCode for the valid status codes, so that counting a response doesn't
+// format its status code
+var statusCodeLabels = func() (labels [600]string) {
+	for code := range labels {
+		labels[code] = strconv.Itoa(code)
+	}
+	return labels
+}()
+
+func incrementResponseByCode(statusCode int) {
+	var label string
+	if statusCode >= 0 && statusCode < len(statusCodeLabels) {
+		label = statusCodeLabels[statusCode]
+	} else {
+		label = strconv.Itoa(statusCode)
+	}
+	responseByCode.WithLabelValues(label).Inc()
+}
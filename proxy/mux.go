@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/h2mux"
+	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/tracing"
+	"github.com/cloudflare/cloudflared/websocket"
+)
+
+// muxResponseWriter accepts the multiplexing subprotocol offered by the client in the response to its WebSocket
+// request
+type muxResponseWriter struct {
+	connection.ResponseWriter
+}
+
+func (w *muxResponseWriter) WriteRespHeaders(status int, header http.Header) error {
+	if status == http.StatusSwitchingProtocols {
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set("Sec-WebSocket-Protocol", websocket.MuxSubprotocol)
+	}
+	return w.ResponseWriter.WriteRespHeaders(status, header)
+}
+
+// proxyMuxedStreams serves the streams a client such as the access daemon multiplexes over a WebSocket, each one with
+// its own connection to the origin, until the WebSocket is closed. Every stream counts towards maxConcurrentStreams
+// of the rule.
+func (p *Proxy) proxyMuxedStreams(
+	tr *tracing.TracedContext,
+	w connection.ResponseWriter,
+	req *http.Request,
+	ruleNum int,
+	dest string,
+	originProxy ingress.StreamBasedOriginProxy,
+) error {
+	rwa := connection.NewHTTPResponseReadWriterAcker(&muxResponseWriter{ResponseWriter: w}, req)
+	if err := rwa.AckConnection(tr.GetSpans()); err != nil {
+		return err
+	}
+
+	ctx := tr.Context
+	wsConn := websocket.NewConn(ctx, rwa, p.log)
+	defer wsConn.Close()
+	muxer, err := websocket.NewServerMuxer(wsConn, h2mux.MuxedStreamFunc(func(stream *h2mux.MuxedStream) error {
+		if !p.streams[ruleNum].acquire() {
+			p.log.Debug().Int(LogFieldRule, ruleNum).Msg("Rejected multiplexed stream, the ingress rule reached maxConcurrentStreams")
+			return stream.WriteHeaders(websocket.MuxFailedHeaders)
+		}
+		defer p.streams[ruleNum].release()
+
+		originConn, err := originProxy.EstablishConnection(ctx, dest)
+		if err != nil {
+			p.log.Err(err).Int(LogFieldRule, ruleNum).Msg("Failed to connect a multiplexed stream to the origin")
+			return stream.WriteHeaders(websocket.MuxFailedHeaders)
+		}
+		defer originConn.Close()
+		rawConn, ok := originConn.(ingress.RawOriginConnection)
+		if !ok {
+			_ = stream.WriteHeaders(websocket.MuxFailedHeaders)
+			return fmt.Errorf("the origin %s can't carry multiplexed streams", dest)
+		}
+		if err := stream.WriteHeaders(websocket.MuxConnectedHeaders); err != nil {
+			return err
+		}
+		rawConn.StreamRaw(ctx, stream, p.log)
+		return nil
+	}), p.log)
+	if err != nil {
+		return err
+	}
+	return muxer.Serve(ctx)
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	gorillaWS "github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/tracing"
+	"github.com/cloudflare/cloudflared/websocket"
+)
+
+// rawRespWriter writes the response to conn as HTTP/1.1, like the edge answers the client of a WebSocket
+type rawRespWriter struct {
+	conn net.Conn
+}
+
+func (w *rawRespWriter) WriteRespHeaders(status int, header http.Header) error {
+	if _, err := fmt.Fprintf(w.conn, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status)); err != nil {
+		return err
+	}
+	if err := header.Write(w.conn); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.conn, "\r\n")
+	return err
+}
+
+func (w *rawRespWriter) Write(p []byte) (int, error) {
+	return w.conn.Write(p)
+}
+
+func TestProxyMuxedStreams(t *testing.T) {
+	origin, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer origin.Close()
+	go func() {
+		for {
+			conn, err := origin.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	log := zerolog.Nop()
+	ingressRule := createSingleIngressConfig(t, "tcp://"+origin.Addr().String())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ingressRule.StartOrigins(&log, ctx.Done())
+	proxy := NewOriginProxy(ingressRule, noWarpRouting, testTags, &log, Options{})
+
+	edgeConn, clientConn := net.Pipe()
+	go func() {
+		reader := bufio.NewReader(edgeConn)
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		req.Body = io.NopCloser(reader)
+		_ = proxy.ProxyHTTP(&rawRespWriter{conn: edgeConn}, tracing.NewTracedHTTPRequest(req, &log), true)
+		_ = edgeConn.Close()
+	}()
+
+	dialer := gorillaWS.Dialer{
+		NetDial: func(network, addr string) (net.Conn, error) {
+			return clientConn, nil
+		},
+		Subprotocols: []string{websocket.MuxSubprotocol},
+	}
+	conn, resp, err := dialer.Dial("ws://ssh.example.com", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, websocket.MuxSubprotocol, conn.Subprotocol())
+
+	muxer, err := websocket.NewClientMuxer(websocket.NewGorillaConn(conn, &log), &log)
+	require.NoError(t, err)
+	go func() {
+		_ = muxer.Serve(ctx)
+	}()
+	// Each stream has its own connection to the origin
+	for _, message := range []string{"SSH-2.0-first\n", "SSH-2.0-second\n"} {
+		stream, err := muxer.OpenStream(ctx, websocket.MuxRequestHeaders, nil)
+		require.NoError(t, err)
+		require.True(t, websocket.IsMuxStreamConnected(stream))
+		_, err = stream.Write([]byte(message))
+		require.NoError(t, err)
+		echo, err := bufio.NewReader(stream).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, message, echo)
+		require.NoError(t, stream.Close())
+	}
+}
@@ -5,9 +5,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"go.opentelemetry.io/otel/attribute"
@@ -15,8 +20,12 @@ import (
 
 	"github.com/cloudflare/cloudflared/carrier"
 	"github.com/cloudflare/cloudflared/cfio"
+	"github.com/cloudflare/cloudflared/chaos"
 	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/flowtable"
 	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/iouring"
+	"github.com/cloudflare/cloudflared/l4policy"
 	"github.com/cloudflare/cloudflared/tracing"
 	tunnelpogs "github.com/cloudflare/cloudflared/tunnelrpc/pogs"
 	"github.com/cloudflare/cloudflared/websocket"
@@ -29,25 +38,63 @@ const (
 	LogFieldRule          = "ingressRule"
 	LogFieldOriginService = "originService"
 	LogFieldFlowID        = "flowID"
+	LogFieldTimeoutCause  = "timeoutCause"
 )
 
 // Proxy represents a means to Proxy between cloudflared and the origin services.
 type Proxy struct {
 	ingressRules ingress.Ingress
 	warpRouting  *ingress.WarpRoutingService
+	warpPolicy   *l4policy.Engine
+	flows        *flowtable.Table
+	udpRing      *iouring.Ring
+	faults       *chaos.Injector
+	hostnames    *HostnameRequests
+	maintenance  *Maintenance
+	health       *ConnectorHealth
+	streams      []*streamLimiter
+	slowOrigins  []*slowOriginDetector
 	tags         []tunnelpogs.Tag
 	log          *zerolog.Logger
 }
 
+// Options are the optional features of the proxy, each one is disabled when its field is nil
+type Options struct {
+	// WarpPolicy filters the flows of WARP routing
+	WarpPolicy *l4policy.Engine
+	// Flows tracks the flows of WARP routing
+	Flows *flowtable.Table
+	// UDPRing proxies UDP sessions with io_uring
+	UDPRing *iouring.Ring
+	// Faults injects faults in requests and streams
+	Faults *chaos.Injector
+	// Hostnames counts the requests of each hostname
+	Hostnames *HostnameRequests
+	// Maintenance answers the requests of the rules in maintenance mode with their maintenance page
+	Maintenance *Maintenance
+	// Health answers the requests to the healthPath of the rules
+	Health *ConnectorHealth
+}
+
 // NewOriginProxy returns a new instance of the Proxy struct.
 func NewOriginProxy(
 	ingressRules ingress.Ingress,
 	warpRouting ingress.WarpRoutingConfig,
 	tags []tunnelpogs.Tag,
 	log *zerolog.Logger,
+	options Options,
 ) *Proxy {
 	proxy := &Proxy{
 		ingressRules: ingressRules,
+		warpPolicy:   options.WarpPolicy,
+		flows:        options.Flows,
+		udpRing:      options.UDPRing,
+		faults:       options.Faults,
+		hostnames:    options.Hostnames,
+		maintenance:  options.Maintenance,
+		health:       options.Health,
+		streams:      newStreamLimiters(ingressRules),
+		slowOrigins:  newSlowOriginDetectors(ingressRules, log),
 		tags:         tags,
 		log:          log,
 	}
@@ -59,6 +106,21 @@ func NewOriginProxy(
 	return proxy
 }
 
+// ReplacedBy is called once next replaced p to proxy requests, it deletes the metrics of the ingress rules of p that
+// next doesn't have
+func (p *Proxy) ReplacedBy(next *Proxy) {
+	kept := make(map[string]bool, len(next.ingressRules.Rules))
+	for i := range next.ingressRules.Rules {
+		kept[strings.Join(ruleLabelValues(&next.ingressRules.Rules[i]), "\x00")] = true
+	}
+	for i := range p.ingressRules.Rules {
+		labelValues := ruleLabelValues(&p.ingressRules.Rules[i])
+		if !kept[strings.Join(labelValues, "\x00")] {
+			deleteRuleMetrics(labelValues)
+		}
+	}
+}
+
 // ProxyHTTP further depends on ingress rules to establish a connection with the origin service. This may be
 // a simple roundtrip or a tcp/websocket dial depending on ingres rule setup.
 func (p *Proxy) ProxyHTTP(
@@ -70,6 +132,7 @@ func (p *Proxy) ProxyHTTP(
 	defer decrementConcurrentRequests()
 
 	req := tr.Request
+	p.hostnames.Inc(req.Host)
 	cfRay := connection.FindCfRayHeader(req)
 	lbProbe := connection.IsLBProbeRequest(req)
 	p.appendTagHeaders(req)
@@ -81,22 +144,52 @@ func (p *Proxy) ProxyHTTP(
 		cfRay:   cfRay,
 		lbProbe: lbProbe,
 		rule:    ruleNum,
+		config:  &rule.Config,
 	}
 	p.logRequest(req, logFields)
 	ruleSpan.SetAttributes(attribute.Int("rule-num", ruleNum))
 	ruleSpan.End()
 
+	switch p.localResponse(req, rule, isWebsocket) {
+	case healthResponse:
+		return p.writeHealth(w)
+	case maintenanceResponse:
+		return p.writeMaintenance(w, rule.Config)
+	case httpsRedirectResponse:
+		return redirectToHTTPS(w, req)
+	}
+
 	switch originProxy := rule.Service.(type) {
 	case ingress.HTTPOriginProxy:
+		if p.faults != nil {
+			originProxy = &chaosHTTPOriginProxy{HTTPOriginProxy: originProxy, faults: p.faults}
+		}
+		if slowOrigin := p.slowOrigins[ruleNum]; slowOrigin != nil {
+			originProxy = &slowOriginHTTPOriginProxy{HTTPOriginProxy: originProxy, detector: slowOrigin}
+		}
+		if isWebsocket {
+			if !p.acquireStream(w, ruleNum, logFields) {
+				return nil
+			}
+			defer p.streams[ruleNum].release()
+		}
+		if rule.Config.UsesMatchVars() {
+			tr.Request = tr.Request.WithContext(ingress.WithMatchVars(tr.Request.Context(), rule.MatchVars(req.Host, req.URL.Path)))
+		}
 		if err := p.proxyHTTPRequest(
 			w,
 			tr,
 			originProxy,
 			isWebsocket,
-			rule.Config.DisableChunkedEncoding,
+			rule.Config,
 			logFields,
 		); err != nil {
 			rule, srv := ruleField(p.ingressRules, ruleNum)
+			var timeoutErr *originTimeoutError
+			if errors.As(err, &timeoutErr) {
+				p.writeOriginTimeout(w, timeoutErr, cfRay, rule, srv)
+				return nil
+			}
 			p.logRequestError(err, cfRay, "", rule, srv)
 			return err
 		}
@@ -107,6 +200,23 @@ func (p *Proxy) ProxyHTTP(
 			return err
 		}
 
+		if p.faults != nil {
+			originProxy = &chaosOriginProxy{StreamBasedOriginProxy: originProxy, faults: p.faults}
+		}
+		if isWebsocket && websocket.IsMuxRequest(req) && rule.Service.String() != ingress.ServiceSocksProxy {
+			if err := p.proxyMuxedStreams(tr.ToTracedContext(), w, req, ruleNum, dest, originProxy); err != nil {
+				rule, srv := ruleField(p.ingressRules, ruleNum)
+				p.logRequestError(err, cfRay, "", rule, srv)
+				return err
+			}
+			return nil
+		}
+
+		if !p.acquireStream(w, ruleNum, logFields) {
+			return nil
+		}
+		defer p.streams[ruleNum].release()
+
 		rws := connection.NewHTTPResponseReadWriterAcker(w, req)
 		if err := p.proxyStream(tr.ToTracedContext(), rws, dest, originProxy); err != nil {
 			rule, srv := ruleField(p.ingressRules, ruleNum)
@@ -134,6 +244,11 @@ func (p *Proxy) ProxyTCP(
 		return err
 	}
 
+	if err := p.checkWarpPolicy(l4policy.TCP, req.Dest); err != nil {
+		p.logRequestError(err, req.CFRay, req.FlowID, "", ingress.ServiceWarpRouting)
+		return err
+	}
+
 	serveCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -141,7 +256,24 @@ func (p *Proxy) ProxyTCP(
 
 	p.log.Debug().Str(LogFieldFlowID, req.FlowID).Msg("tcp proxy stream started")
 
-	if err := p.proxyStream(tracedCtx, rwa, req.Dest, p.warpRouting.Proxy); err != nil {
+	var originProxy ingress.StreamBasedOriginProxy = p.warpRouting.Proxy
+	if p.flows != nil {
+		flowID := req.FlowID
+		if flowID == "" {
+			// Only QUIC connections have flow IDs
+			flowID = uuid.NewString()
+		}
+		originProxy = &flowTrackingOriginProxy{
+			StreamBasedOriginProxy: originProxy,
+			flows:                  p.flows,
+			flowID:                 flowID,
+		}
+	}
+	if p.faults != nil {
+		originProxy = &chaosOriginProxy{StreamBasedOriginProxy: originProxy, faults: p.faults}
+	}
+
+	if err := p.proxyStream(tracedCtx, rwa, req.Dest, originProxy); err != nil {
 		p.logRequestError(err, req.CFRay, req.FlowID, "", ingress.ServiceWarpRouting)
 		return err
 	}
@@ -151,6 +283,76 @@ func (p *Proxy) ProxyTCP(
 	return nil
 }
 
+// DialUDPSession dials the origin of a UDP session to dstIP:dstPort, if the warp-routing policy allows it
+func (p *Proxy) DialUDPSession(sessionID uuid.UUID, dstIP net.IP, dstPort uint16) (ingress.UDPProxy, error) {
+	dst := net.JoinHostPort(dstIP.String(), strconv.Itoa(int(dstPort)))
+	if err := p.checkWarpPolicy(l4policy.UDP, dst); err != nil {
+		return nil, err
+	}
+	var (
+		originProxy ingress.UDPProxy
+		err         error
+	)
+	if p.udpRing != nil {
+		originProxy, err = ingress.DialUDPRing(p.udpRing, dstIP, dstPort)
+	} else {
+		originProxy, err = ingress.DialUDP(dstIP, dstPort)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.faults != nil {
+		originProxy = &chaosUDPProxy{UDPProxy: originProxy, faults: p.faults}
+	}
+	if p.flows == nil {
+		return originProxy, nil
+	}
+	return &flowTrackingUDPProxy{
+		UDPProxy: originProxy,
+		flows:    p.flows,
+		flow:     p.flows.Add(flowtable.UDP, sessionID.String(), originProxy.LocalAddr().String(), dst),
+	}, nil
+}
+
+func (p *Proxy) checkWarpPolicy(protocol l4policy.Protocol, dest string) error {
+	if p.warpPolicy == nil {
+		return nil
+	}
+	host, portStr, err := net.SplitHostPort(dest)
+	if err != nil {
+		return errors.Wrapf(err, "invalid destination %s", dest)
+	}
+	ip := net.ParseIP(host)
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if ip == nil || err != nil {
+		return fmt.Errorf("invalid destination %s", dest)
+	}
+	if !p.warpPolicy.Allowed(protocol, ip, uint16(port)) {
+		return fmt.Errorf("%s to %s is denied by the warp-routing policy", protocol, dest)
+	}
+	return nil
+}
+
+// acquireStream counts a WebSocket or TCP stream to the origin of rule ruleNum. If the rule reached its
+// maxConcurrentStreams, the stream is answered with 503 Service Unavailable and false is returned.
+func (p *Proxy) acquireStream(w connection.ResponseWriter, ruleNum int, fields logFields) bool {
+	if p.streams[ruleNum].acquire() {
+		return true
+	}
+	p.log.Debug().Str(LogFieldCFRay, fields.cfRay).Int(LogFieldRule, ruleNum).Msg("Rejected stream, the ingress rule reached maxConcurrentStreams")
+	incrementResponseByCode(http.StatusServiceUnavailable)
+	_ = w.WriteRespHeaders(http.StatusServiceUnavailable, http.Header{})
+	return false
+}
+
+func webSocketOptions(cfg ingress.OriginRequestConfig) websocket.FrameStreamOptions {
+	return websocket.FrameStreamOptions{
+		PingInterval:   cfg.WebSocketPingInterval.Duration,
+		PongTimeout:    cfg.WebSocketPongTimeout.Duration,
+		MaxMessageSize: int64(cfg.WebSocketMaxMessageSize),
+	}
+}
+
 func ruleField(ing ingress.Ingress, ruleNum int) (ruleID string, srv string) {
 	srv = ing.Rules[ruleNum].Service.String()
 	if ing.IsSingleRule() {
@@ -165,39 +367,23 @@ func (p *Proxy) proxyHTTPRequest(
 	tr *tracing.TracedHTTPRequest,
 	httpService ingress.HTTPOriginProxy,
 	isWebsocket bool,
-	disableChunkedEncoding bool,
+	cfg ingress.OriginRequestConfig,
 	fields logFields,
 ) error {
-	roundTripReq := tr.Request
-	if isWebsocket {
-		roundTripReq = tr.Clone(tr.Request.Context())
-		roundTripReq.Header.Set("Connection", "Upgrade")
-		roundTripReq.Header.Set("Upgrade", "websocket")
-		roundTripReq.Header.Set("Sec-Websocket-Version", "13")
-		roundTripReq.ContentLength = 0
-		roundTripReq.Body = nil
-	} else {
-		// Support for WSGI Servers by switching transfer encoding from chunked to gzip/deflate
-		if disableChunkedEncoding {
-			roundTripReq.TransferEncoding = []string{"gzip", "deflate"}
-			cLength, err := strconv.Atoi(tr.Request.Header.Get("Content-Length"))
-			if err == nil {
-				roundTripReq.ContentLength = int64(cLength)
-			}
-		}
-		// Request origin to keep connection alive to improve performance
-		roundTripReq.Header.Set("Connection", "keep-alive")
-	}
+	roundTripReq := prepareOriginRequest(tr.Request, isWebsocket, cfg)
 
-	// Set the User-Agent as an empty string if not provided to avoid inserting golang default UA
-	if roundTripReq.Header.Get("User-Agent") == "" {
-		roundTripReq.Header.Set("User-Agent", "")
-	}
+	eyeballCtx := roundTripReq.Context()
+	deadline := newRequestDeadline(eyeballCtx, cfg.RequestTimeout.Duration)
+	defer deadline.stop()
+	roundTripReq = roundTripReq.WithContext(deadline.ctx)
 
 	_, ttfbSpan := tr.Tracer().Start(tr.Context(), "ttfb_origin")
 	resp, err := httpService.RoundTrip(roundTripReq)
 	if err != nil {
 		tracing.EndWithErrorStatus(ttfbSpan, err)
+		if timeoutErr := originTimeout(err, deadline.hasExpired(), eyeballCtx); timeoutErr != nil {
+			return timeoutErr
+		}
 		if err := roundTripReq.Context().Err(); err != nil {
 			return errors.Wrap(err, "Incoming request ended abruptly")
 		}
@@ -214,6 +400,14 @@ func (p *Proxy) proxyHTTPRequest(
 
 	// Add spans to response header (if available)
 	tr.AddSpans(resp.Header)
+	setHSTS(resp.Header, tr.Request, cfg)
+
+	isEventStream := connection.IsServerSentEvent(resp.Header)
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		deadline.reset(0)
+	} else if isEventStream || cfg.DisableResponseBuffering {
+		deadline.reset(cfg.StreamTimeout.Duration)
+	}
 
 	err = w.WriteRespHeaders(resp.StatusCode, resp.Header)
 	if err != nil {
@@ -232,13 +426,26 @@ func (p *Proxy) proxyHTTPRequest(
 			reader: tr.Request.Body,
 		}
 
+		if wsOptions := webSocketOptions(cfg); wsOptions.Enabled() {
+			if err := websocket.StreamFrames(eyeballStream, rwc, wsOptions, p.log); err == websocket.ErrMessageTooBig || err == websocket.ErrPongTimeout {
+				p.log.Debug().Err(err).Str(LogFieldCFRay, fields.cfRay).Msg("Closed websocket connection")
+			}
+			return nil
+		}
 		websocket.Stream(eyeballStream, rwc, p.log)
 		return nil
 	}
 
-	if connection.IsServerSentEvent(resp.Header) {
+	if isEventStream {
 		p.log.Debug().Msg("Detected Server-Side Events from Origin")
 		p.writeEventStream(w, resp.Body)
+	} else if flusher, ok := w.(connection.ResponseFlusher); ok && cfg.DisableResponseBuffering {
+		flusher.Flush()
+		_, _ = cfio.Copy(&flushWriter{w: w, flusher: flusher}, resp.Body)
+	} else if ok && cfg.FlushInterval.Duration > 0 {
+		writer := &intervalFlushWriter{w: w, flusher: flusher, interval: cfg.FlushInterval.Duration}
+		_, _ = cfio.Copy(writer, resp.Body)
+		writer.stop()
 	} else {
 		_, _ = cfio.Copy(w, resp.Body)
 	}
@@ -247,6 +454,45 @@ func (p *Proxy) proxyHTTPRequest(
 	return nil
 }
 
+// prepareOriginRequest returns req with the changes made before it's proxied to an HTTP origin. WebSocket requests are
+// cloned, other requests are changed in place.
+func prepareOriginRequest(req *http.Request, isWebsocket bool, cfg ingress.OriginRequestConfig) *http.Request {
+	roundTripReq := req
+	if isWebsocket {
+		roundTripReq = req.Clone(req.Context())
+		roundTripReq.Header.Set("Connection", "Upgrade")
+		roundTripReq.Header.Set("Upgrade", "websocket")
+		roundTripReq.Header.Set("Sec-Websocket-Version", "13")
+		roundTripReq.ContentLength = 0
+		roundTripReq.Body = nil
+		// Extensions offered by the client are negotiated with the origin, unless they are disabled
+		if cfg.DisableWebSocketCompression {
+			websocket.RemoveExtension(roundTripReq.Header, websocket.PerMessageDeflate)
+		}
+	} else {
+		// Support for WSGI Servers by switching transfer encoding from chunked to gzip/deflate
+		if cfg.DisableChunkedEncoding {
+			roundTripReq.TransferEncoding = []string{"gzip", "deflate"}
+			cLength, err := strconv.Atoi(req.Header.Get("Content-Length"))
+			if err == nil {
+				roundTripReq.ContentLength = int64(cLength)
+			}
+		}
+		// Request origin to keep connection alive to improve performance
+		roundTripReq.Header.Set("Connection", "keep-alive")
+	}
+
+	if cfg.ForwardClientCert {
+		forwardClientCert(roundTripReq.Header)
+	}
+
+	// Set the User-Agent as an empty string if not provided to avoid inserting golang default UA
+	if roundTripReq.Header.Get("User-Agent") == "" {
+		roundTripReq.Header.Set("User-Agent", "")
+	}
+	return roundTripReq
+}
+
 // proxyStream proxies type TCP and other underlying types if the connection is defined as a stream oriented
 // ingress rule.
 func (p *Proxy) proxyStream(
@@ -296,8 +542,20 @@ func (wr *bidirectionalStream) Write(p []byte) (n int, err error) {
 	return wr.writer.Write(p)
 }
 
+// eventStreamReaderPool holds the readers of the lines of server-sent events
+var eventStreamReaderPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReader(nil)
+	},
+}
+
 func (p *Proxy) writeEventStream(w connection.ResponseWriter, respBody io.ReadCloser) {
-	reader := bufio.NewReader(respBody)
+	reader := eventStreamReaderPool.Get().(*bufio.Reader)
+	reader.Reset(respBody)
+	defer func() {
+		reader.Reset(nil)
+		eventStreamReaderPool.Put(reader)
+	}()
 	for {
 		line, readErr := reader.ReadBytes('\n')
 
@@ -327,23 +585,77 @@ type logFields struct {
 	lbProbe bool
 	rule    interface{}
 	flowID  string
+	// config has the access log settings of the rule, everything is logged if it's nil
+	config *ingress.OriginRequestConfig
+}
+
+// accessLogged returns whether the rule logs its requests
+func (f logFields) accessLogged() bool {
+	return f.config == nil || !f.config.DisableAccessLog
+}
+
+// logs returns whether field is recorded in the logs of the requests of the rule
+func (f logFields) logs(field string) bool {
+	return f.config == nil || f.config.AccessLogs(field)
+}
+
+// clientHeaders are the request headers with the address of the client, which are only logged with the client field
+var clientHeaders = []string{"Cf-Connecting-Ip", "Cf-Connecting-Ipv6", "True-Client-Ip", "X-Forwarded-For", "X-Real-Ip"}
+
+// loggedHeader returns header without the headers the rule doesn't record in its logs
+func (f logFields) loggedHeader(header http.Header) http.Header {
+	if f.logs(ingress.AccessLogFieldClient) {
+		return header
+	}
+	logged := header.Clone()
+	for _, name := range clientHeaders {
+		logged.Del(name)
+	}
+	return logged
+}
+
+// loggedURL returns u without the parts the rule doesn't record in its logs
+func (f logFields) loggedURL(u *url.URL) string {
+	logged := *u
+	if !f.logs(ingress.AccessLogFieldHost) {
+		logged.Scheme = ""
+		logged.User = nil
+		logged.Host = ""
+	}
+	if !f.logs(ingress.AccessLogFieldPath) {
+		logged.Path = ""
+		logged.RawPath = ""
+	}
+	if !f.logs(ingress.AccessLogFieldQuery) {
+		logged.RawQuery = ""
+		logged.ForceQuery = false
+	}
+	return logged.String()
 }
 
 func (p *Proxy) logRequest(r *http.Request, fields logFields) {
+	if !p.debugEnabled() || !fields.accessLogged() {
+		return
+	}
+	target := fields.loggedURL(r.URL)
 	if fields.cfRay != "" {
-		p.log.Debug().Msgf("CF-RAY: %s %s %s %s", fields.cfRay, r.Method, r.URL, r.Proto)
+		p.log.Debug().Msgf("CF-RAY: %s %s %s %s", fields.cfRay, r.Method, target, r.Proto)
 	} else if fields.lbProbe {
-		p.log.Debug().Msgf("CF-RAY: %s Load Balancer health check %s %s %s", fields.cfRay, r.Method, r.URL, r.Proto)
+		p.log.Debug().Msgf("CF-RAY: %s Load Balancer health check %s %s %s", fields.cfRay, r.Method, target, r.Proto)
 	} else {
-		p.log.Debug().Msgf("All requests should have a CF-RAY header. Please open a support ticket with Cloudflare. %s %s %s ", r.Method, r.URL, r.Proto)
+		p.log.Debug().Msgf("All requests should have a CF-RAY header. Please open a support ticket with Cloudflare. %s %s %s ", r.Method, target, r.Proto)
+	}
+	log := p.log.Debug().Str("CF-RAY", fields.cfRay)
+	if fields.logs(ingress.AccessLogFieldHeaders) {
+		log = log.Str("Header", fmt.Sprintf("%+v", fields.loggedHeader(r.Header)))
+	}
+	if fields.logs(ingress.AccessLogFieldHost) {
+		log = log.Str("host", r.Host)
 	}
-	p.log.Debug().
-		Str("CF-RAY", fields.cfRay).
-		Str("Header", fmt.Sprintf("%+v", r.Header)).
-		Str("host", r.Host).
-		Str("path", r.URL.Path).
-		Interface("rule", fields.rule).
-		Msg("Inbound request")
+	if fields.logs(ingress.AccessLogFieldPath) {
+		log = log.Str("path", r.URL.Path)
+	}
+	log.Interface("rule", fields.rule).Msg("Inbound request")
 
 	if contentLen := r.ContentLength; contentLen == -1 {
 		p.log.Debug().Msgf("CF-RAY: %s Request Content length unknown", fields.cfRay)
@@ -352,8 +664,17 @@ func (p *Proxy) logRequest(r *http.Request, fields logFields) {
 	}
 }
 
+// debugEnabled returns true if debug logs are written. The debug logs of each request and response are skipped
+// otherwise, since their arguments are evaluated, and their headers formatted, even if the logs are discarded.
+func (p *Proxy) debugEnabled() bool {
+	return p.log.GetLevel() <= zerolog.DebugLevel && zerolog.GlobalLevel() <= zerolog.DebugLevel
+}
+
 func (p *Proxy) logOriginResponse(resp *http.Response, fields logFields) {
-	responseByCode.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	incrementResponseByCode(resp.StatusCode)
+	if !p.debugEnabled() || !fields.accessLogged() {
+		return
+	}
 	if fields.cfRay != "" {
 		p.log.Debug().Msgf("CF-RAY: %s Status: %s served by ingress %d", fields.cfRay, resp.Status, fields.rule)
 	} else if fields.lbProbe {
@@ -361,7 +682,9 @@ func (p *Proxy) logOriginResponse(resp *http.Response, fields logFields) {
 	} else {
 		p.log.Debug().Msgf("Status: %s served by ingress %v", resp.Status, fields.rule)
 	}
-	p.log.Debug().Msgf("CF-RAY: %s Response Headers %+v", fields.cfRay, resp.Header)
+	if fields.logs(ingress.AccessLogFieldHeaders) {
+		p.log.Debug().Msgf("CF-RAY: %s Response Headers %+v", fields.cfRay, resp.Header)
+	}
 
 	if contentLen := resp.ContentLength; contentLen == -1 {
 		p.log.Debug().Msgf("CF-RAY: %s Response content length unknown", fields.cfRay)
@@ -370,6 +693,16 @@ func (p *Proxy) logOriginResponse(resp *http.Response, fields logFields) {
 	}
 }
 
+// writeOriginTimeout answers a request whose origin timed out with 504 Gateway Timeout
+func (p *Proxy) writeOriginTimeout(w connection.ResponseWriter, err *originTimeoutError, cfRay, rule, service string) {
+	requestErrors.Inc()
+	originTimeouts.WithLabelValues(err.cause).Inc()
+	responseByCode.WithLabelValues(strconv.Itoa(http.StatusGatewayTimeout)).Inc()
+	_ = w.WriteRespHeaders(http.StatusGatewayTimeout, http.Header{})
+	p.log.Error().Err(err).Str(LogFieldTimeoutCause, err.cause).Str(LogFieldCFRay, cfRay).
+		Str(LogFieldRule, rule).Str(LogFieldOriginService, service).Msg("")
+}
+
 func (p *Proxy) logRequestError(err error, cfRay string, flowID string, rule, service string) {
 	requestErrors.Inc()
 	log := p.log.Error().Err(err)
@@ -9,23 +9,31 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/gobwas/ws/wsutil"
+	"github.com/google/uuid"
 	gorillaWS "github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/cloudflare/cloudflared/chaos"
 	"github.com/cloudflare/cloudflared/config"
 	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/flowtable"
 	"github.com/cloudflare/cloudflared/hello"
 	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/l4policy"
 	"github.com/cloudflare/cloudflared/logger"
 	"github.com/cloudflare/cloudflared/tracing"
 	tunnelpogs "github.com/cloudflare/cloudflared/tunnelrpc/pogs"
@@ -143,7 +151,7 @@ func TestProxySingleOrigin(t *testing.T) {
 
 	require.NoError(t, ingressRule.StartOrigins(&log, ctx.Done()))
 
-	proxy := NewOriginProxy(ingressRule, noWarpRouting, testTags, &log)
+	proxy := NewOriginProxy(ingressRule, noWarpRouting, testTags, &log, Options{})
 	t.Run("testProxyHTTP", testProxyHTTP(proxy))
 	t.Run("testProxyWebsocket", testProxyWebsocket(proxy))
 	t.Run("testProxySSE", testProxySSE(proxy))
@@ -232,6 +240,144 @@ func testProxyWebsocket(proxy connection.OriginProxy) func(t *testing.T) {
 	}
 }
 
+func TestProxyWebsocketCompression(t *testing.T) {
+	extensionsC := make(chan string, 1)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extensionsC <- r.Header.Get("Sec-WebSocket-Extensions")
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer origin.Close()
+
+	disableCompression := true
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Hostname: "compressed.example.com",
+				Service:  origin.URL,
+			},
+			{
+				Hostname:      "*",
+				Service:       origin.URL,
+				OriginRequest: config.OriginRequestConfig{DisableWebSocketCompression: &disableCompression},
+			},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ing.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log, Options{})
+
+	const offer = "permessage-deflate; client_max_window_bits, x-webkit-deflate-frame"
+	tests := map[string]string{
+		"compressed.example.com": offer,
+		"other.example.com":      "x-webkit-deflate-frame",
+	}
+	for host, expected := range tests {
+		req, err := http.NewRequest(http.MethodGet, "http://"+host, nil)
+		require.NoError(t, err)
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Sec-WebSocket-Extensions", offer)
+
+		responseWriter := newMockHTTPRespWriter()
+		require.NoError(t, proxy.ProxyHTTP(responseWriter, tracing.NewTracedHTTPRequest(req, &log), true))
+		assert.Equal(t, expected, <-extensionsC, host)
+		assert.Equal(t, http.StatusBadRequest, responseWriter.Code)
+	}
+}
+
+func TestProxyMaxConcurrentStreams(t *testing.T) {
+	receivedC := make(chan struct{})
+	releaseC := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedC <- struct{}{}
+		<-releaseC
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer origin.Close()
+
+	maxConcurrentStreams := uint(1)
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Service:       origin.URL,
+				OriginRequest: config.OriginRequestConfig{MaxConcurrentStreams: &maxConcurrentStreams},
+			},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ing.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log, Options{})
+
+	proxyWebsocket := func() *mockHTTPRespWriter {
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		require.NoError(t, err)
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		responseWriter := newMockHTTPRespWriter()
+		require.NoError(t, proxy.ProxyHTTP(responseWriter, tracing.NewTracedHTTPRequest(req, &log), true))
+		return responseWriter
+	}
+
+	firstC := make(chan *mockHTTPRespWriter)
+	go func() {
+		firstC <- proxyWebsocket()
+	}()
+	<-receivedC
+
+	// The rule already has a stream
+	assert.Equal(t, http.StatusServiceUnavailable, proxyWebsocket().Code)
+
+	close(releaseC)
+	assert.Equal(t, http.StatusBadRequest, (<-firstC).Code)
+
+	// The first stream is done
+	go func() {
+		<-receivedC
+	}()
+	assert.Equal(t, http.StatusBadRequest, proxyWebsocket().Code)
+}
+
+func TestProxyReplacedByDeletesRuleMetrics(t *testing.T) {
+	threshold := config.CustomDuration{Duration: time.Second}
+	slowOriginRule := func(hostname string) config.UnvalidatedIngressRule {
+		return config.UnvalidatedIngressRule{
+			Hostname:      hostname,
+			Service:       "http://localhost:8080",
+			OriginRequest: config.OriginRequestConfig{SlowOriginThreshold: &threshold},
+		}
+	}
+	previousIngress, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			slowOriginRule("removed.example.com"),
+			slowOriginRule("kept.example.com"),
+			{Service: "http_status:404"},
+		},
+	})
+	require.NoError(t, err)
+	nextIngress, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			slowOriginRule("kept.example.com"),
+			{Service: "http_status:404"},
+		},
+	})
+	require.NoError(t, err)
+
+	log := zerolog.Nop()
+	previous := NewOriginProxy(previousIngress, noWarpRouting, testTags, &log, Options{})
+	streams := testutil.CollectAndCount(activeRuleStreams)
+	pending := testutil.CollectAndCount(pendingRuleRequests)
+	next := NewOriginProxy(nextIngress, noWarpRouting, testTags, &log, Options{})
+	previous.ReplacedBy(next)
+
+	// Only the metrics of the removed rule are deleted, though the kept rules moved to other indexes
+	assert.Equal(t, streams-1, testutil.CollectAndCount(activeRuleStreams))
+	assert.Equal(t, pending-1, testutil.CollectAndCount(pendingRuleRequests))
+}
+
 func testProxySSE(proxy connection.OriginProxy) func(t *testing.T) {
 	return func(t *testing.T) {
 		var (
@@ -335,6 +481,48 @@ func TestProxyMultipleOrigins(t *testing.T) {
 	runIngressTestScenarios(t, unvalidatedIngress, tests)
 }
 
+// discardRespWriter is a connection.ResponseWriter discarding the response, to benchmark the proxy alone
+type discardRespWriter struct{}
+
+func (discardRespWriter) WriteRespHeaders(status int, header http.Header) error {
+	return nil
+}
+
+func (discardRespWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func BenchmarkProxyHTTP(b *testing.B) {
+	ingress, err := ingress.ParseIngress(&config.Configuration{
+		TunnelID: b.Name(),
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Hostname: "api.example.com",
+				Service:  "http_status:200",
+			},
+			{
+				Service: "http_status:404",
+			},
+		},
+	})
+	require.NoError(b, err)
+	log := zerolog.Nop()
+	proxy := NewOriginProxy(ingress, noWarpRouting, testTags, &log, Options{})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req, err := http.NewRequest(http.MethodGet, "http://api.example.com/users", nil)
+		require.NoError(b, err)
+		req.Header.Set("Cf-Ray", "76fd6bc7ad0f6d5c-LHR")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", "benchmark")
+		if err := proxy.ProxyHTTP(discardRespWriter{}, tracing.NewTracedHTTPRequest(req, &log), false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 type MultipleIngressTest struct {
 	url            string
 	expectedStatus int
@@ -353,7 +541,7 @@ func runIngressTestScenarios(t *testing.T, unvalidatedIngress []config.Unvalidat
 	ctx, cancel := context.WithCancel(context.Background())
 	require.NoError(t, ingress.StartOrigins(&log, ctx.Done()))
 
-	proxy := NewOriginProxy(ingress, noWarpRouting, testTags, &log)
+	proxy := NewOriginProxy(ingress, noWarpRouting, testTags, &log, Options{})
 
 	for _, test := range tests {
 		responseWriter := newMockHTTPRespWriter()
@@ -380,12 +568,247 @@ func (ma mockAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte("Created"))
 }
 
+func TestProxyOriginTimeouts(t *testing.T) {
+	releaseC := make(chan struct{})
+	defer close(releaseC)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-releaseC:
+		case <-r.Context().Done():
+		}
+	}))
+	defer origin.Close()
+
+	timeout := config.CustomDuration{Duration: 50 * time.Millisecond}
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Hostname:      "header.example.com",
+				Service:       origin.URL,
+				OriginRequest: config.OriginRequestConfig{ResponseHeaderTimeout: &timeout},
+			},
+			{
+				Service:       origin.URL,
+				OriginRequest: config.OriginRequestConfig{RequestTimeout: &timeout},
+			},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ing.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log, Options{})
+
+	for host, cause := range map[string]string{
+		"header.example.com":  timeoutResponseHeader,
+		"request.example.com": timeoutRequest,
+	} {
+		timeouts := testutil.ToFloat64(originTimeouts.WithLabelValues(cause))
+		req, err := http.NewRequest(http.MethodGet, "http://"+host, nil)
+		require.NoError(t, err)
+		responseWriter := newMockHTTPRespWriter()
+		require.NoError(t, proxy.ProxyHTTP(responseWriter, tracing.NewTracedHTTPRequest(req, &log), false))
+		assert.Equal(t, http.StatusGatewayTimeout, responseWriter.Code, host)
+		assert.Equal(t, timeouts+1, testutil.ToFloat64(originTimeouts.WithLabelValues(cause)), host)
+	}
+}
+
+func TestOriginTimeoutCause(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	assert.Equal(t, timeoutConnect, originTimeout(dialErr, false, context.Background()).cause)
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	assert.Nil(t, originTimeout(readErr, false, context.Background()))
+	assert.Equal(t, timeoutRequest, originTimeout(readErr, true, context.Background()).cause)
+	tlsErr := fmt.Errorf("net/http: TLS handshake timeout")
+	assert.Equal(t, timeoutTLSHandshake, originTimeout(tlsErr, false, context.Background()).cause)
+
+	// Requests that ended before the origin responded aren't timeouts of the origin
+	eyeballCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Nil(t, originTimeout(dialErr, true, eyeballCtx))
+}
+
+// flushRecorder records what was written when it was flushed
+type flushRecorder struct {
+	*mockHTTPRespWriter
+	lock    sync.Mutex
+	flushed []string
+}
+
+func (w *flushRecorder) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.mockHTTPRespWriter.Write(p)
+}
+
+func (w *flushRecorder) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.flushed = append(w.flushed, w.Body.String())
+}
+
+func TestProxyStreamingResponses(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte("second"))
+	}))
+	defer origin.Close()
+
+	enabled := true
+	requestTimeout := config.CustomDuration{Duration: 100 * time.Millisecond}
+	flushInterval := config.CustomDuration{Duration: 10 * time.Millisecond}
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Hostname: "unbuffered.example.com",
+				Service:  origin.URL,
+				OriginRequest: config.OriginRequestConfig{
+					DisableResponseBuffering: &enabled,
+					RequestTimeout:           &requestTimeout,
+				},
+			},
+			{
+				Hostname: "interval.example.com",
+				Service:  origin.URL,
+				OriginRequest: config.OriginRequestConfig{
+					FlushInterval: &flushInterval,
+				},
+			},
+			{
+				Service:       origin.URL,
+				OriginRequest: config.OriginRequestConfig{RequestTimeout: &requestTimeout},
+			},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ing.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log, Options{})
+
+	proxyRequest := func(host string) *flushRecorder {
+		req, err := http.NewRequest(http.MethodGet, "http://"+host, nil)
+		require.NoError(t, err)
+		responseWriter := &flushRecorder{mockHTTPRespWriter: newMockHTTPRespWriter()}
+		require.NoError(t, proxy.ProxyHTTP(responseWriter, tracing.NewTracedHTTPRequest(req, &log), false))
+		return responseWriter
+	}
+
+	// The response is flushed as soon as it's written, and it isn't cut short by requestTimeout
+	responseWriter := proxyRequest("unbuffered.example.com")
+	assert.Equal(t, "firstsecond", responseWriter.Body.String())
+	assert.Equal(t, []string{"", "first", "firstsecond"}, responseWriter.flushed)
+
+	responseWriter = proxyRequest("interval.example.com")
+	assert.Equal(t, "firstsecond", responseWriter.Body.String())
+	assert.Contains(t, responseWriter.flushed, "first")
+
+	// Responses that aren't streamed are cut short by requestTimeout
+	responseWriter = proxyRequest("buffered.example.com")
+	assert.Equal(t, "first", responseWriter.Body.String())
+	assert.Empty(t, responseWriter.flushed)
+}
+
 type errorOriginTransport struct{}
 
 func (errorOriginTransport) RoundTrip(*http.Request) (*http.Response, error) {
 	return nil, fmt.Errorf("Proxy error")
 }
 
+func TestLogFieldsLoggedURL(t *testing.T) {
+	u, err := url.Parse("https://user@example.com/secret/path?token=abc")
+	require.NoError(t, err)
+	tests := []struct {
+		fields   []string
+		expected string
+	}{
+		{fields: nil, expected: "https://user@example.com/secret/path?token=abc"},
+		{fields: []string{ingress.AccessLogFieldHost, ingress.AccessLogFieldPath}, expected: "https://user@example.com/secret/path"},
+		{fields: []string{ingress.AccessLogFieldHost}, expected: "https://user@example.com"},
+		{fields: []string{ingress.AccessLogFieldPath, ingress.AccessLogFieldQuery}, expected: "/secret/path?token=abc"},
+		{fields: []string{ingress.AccessLogFieldHeaders}, expected: ""},
+	}
+	for _, test := range tests {
+		fields := logFields{config: &ingress.OriginRequestConfig{AccessLogFields: test.fields}}
+		assert.Equal(t, test.expected, fields.loggedURL(u), "%v", test.fields)
+	}
+	assert.Equal(t, u.String(), logFields{}.loggedURL(u))
+}
+
+func TestProxyAccessLog(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Origin-Header", "origin")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer origin.Close()
+
+	disableAccessLog := true
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Hostname:      "health.example.com",
+				Service:       origin.URL,
+				OriginRequest: config.OriginRequestConfig{DisableAccessLog: &disableAccessLog},
+			},
+			{
+				Hostname:      "private.example.com",
+				Service:       origin.URL,
+				OriginRequest: config.OriginRequestConfig{AccessLogFields: []string{ingress.AccessLogFieldHost}},
+			},
+			{
+				Hostname:      "anonymous.example.com",
+				Service:       origin.URL,
+				OriginRequest: config.OriginRequestConfig{AccessLogFields: []string{ingress.AccessLogFieldHeaders}},
+			},
+			{
+				Service: origin.URL,
+			},
+		},
+	})
+	require.NoError(t, err)
+	var logs bytes.Buffer
+	log := zerolog.New(&logs).Level(zerolog.DebugLevel)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ing.StartOrigins(&log, ctx.Done()))
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log, Options{})
+
+	proxyRequest := func(url string) string {
+		logs.Reset()
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Eyeball-Header", "eyeball")
+		req.Header.Set("Cf-Connecting-Ip", "203.0.113.7")
+		responseWriter := newMockHTTPRespWriter()
+		require.NoError(t, proxy.ProxyHTTP(responseWriter, tracing.NewTracedHTTPRequest(req, &log), false))
+		assert.Equal(t, http.StatusOK, responseWriter.Code)
+		return logs.String()
+	}
+
+	assert.Empty(t, proxyRequest("http://health.example.com/health"))
+
+	logged := proxyRequest("http://private.example.com/secret/path?token=abc")
+	assert.Contains(t, logged, "http://private.example.com")
+	assert.NotContains(t, logged, "secret")
+	assert.NotContains(t, logged, "token")
+	assert.NotContains(t, logged, "eyeball")
+	assert.NotContains(t, logged, "X-Origin-Header")
+
+	logged = proxyRequest("http://anonymous.example.com/path")
+	assert.Contains(t, logged, "eyeball")
+	assert.NotContains(t, logged, "203.0.113.7")
+
+	logged = proxyRequest("http://other.example.com/path?query=1")
+	assert.Contains(t, logged, "http://other.example.com/path?query=1")
+	assert.Contains(t, logged, "eyeball")
+	assert.Contains(t, logged, "203.0.113.7")
+	assert.Contains(t, logged, "X-Origin-Header")
+}
+
 func TestProxyError(t *testing.T) {
 	ing := ingress.Ingress{
 		Rules: []ingress.Rule{
@@ -401,7 +824,7 @@ func TestProxyError(t *testing.T) {
 
 	log := zerolog.Nop()
 
-	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log)
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log, Options{})
 
 	responseWriter := newMockHTTPRespWriter()
 	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1", nil)
@@ -660,7 +1083,8 @@ func TestConnections(t *testing.T) {
 
 			ingressRule := createSingleIngressConfig(t, test.args.ingressServiceScheme+ln.Addr().String())
 			ingressRule.StartOrigins(logger, ctx.Done())
-			proxy := NewOriginProxy(ingressRule, testWarpRouting, testTags, logger)
+			flows := flowtable.NewTable()
+			proxy := NewOriginProxy(ingressRule, testWarpRouting, testTags, logger, Options{Flows: flows})
 			proxy.warpRouting = test.args.warpRoutingService
 
 			dest := ln.Addr().String()
@@ -690,6 +1114,8 @@ func TestConnections(t *testing.T) {
 			}
 
 			cancel()
+			// Flows are removed once they end
+			assert.Equal(t, 0, flows.Len())
 			assert.Equal(t, test.want.err, err != nil)
 			assert.Equal(t, test.want.message, replayer.Bytes())
 			respPrinter := respWriter.(responsePrinter)
@@ -942,3 +1368,84 @@ func runEchoWSService(t *testing.T, l net.Listener) {
 		require.NoError(t, err)
 	}()
 }
+
+func TestDialUDPSession(t *testing.T) {
+	origin, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer origin.Close()
+	originAddr := origin.LocalAddr().(*net.UDPAddr)
+
+	policyPath := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(policyPath, []byte(fmt.Sprintf(`
+default: allow
+rules:
+  - action: deny
+    protocols: [udp]
+    ports: ["%d"]
+`, originAddr.Port+1)), 0600))
+	log := zerolog.Nop()
+	policy, err := l4policy.NewEngine(policyPath, &log)
+	require.NoError(t, err)
+
+	flows := flowtable.NewTable()
+	proxy := NewOriginProxy(ingress.Ingress{}, testWarpRouting, testTags, &log, Options{WarpPolicy: policy, Flows: flows})
+
+	_, err = proxy.DialUDPSession(uuid.New(), originAddr.IP, uint16(originAddr.Port+1))
+	require.Error(t, err)
+	require.Equal(t, 0, flows.Len())
+
+	sessionID := uuid.New()
+	originProxy, err := proxy.DialUDPSession(sessionID, originAddr.IP, uint16(originAddr.Port))
+	require.NoError(t, err)
+	_, err = originProxy.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	sessionFlows := flows.List(flowtable.UDP)
+	require.Len(t, sessionFlows, 1)
+	assert.Equal(t, sessionID.String(), sessionFlows[0].ID)
+	assert.Equal(t, originProxy.LocalAddr().String(), sessionFlows[0].Src)
+	assert.Equal(t, originAddr.String(), sessionFlows[0].Dst)
+	assert.Equal(t, uint64(4), sessionFlows[0].BytesToOrigin)
+
+	require.NoError(t, originProxy.Close())
+	require.Equal(t, 0, flows.Len())
+}
+
+func TestProxyChaos(t *testing.T) {
+	ing := ingress.Ingress{
+		Rules: []ingress.Rule{
+			{
+				Hostname: "*",
+				Service: ingress.MockOriginHTTPService{
+					Transport: errorOriginTransport{},
+				},
+			},
+		},
+	}
+	log := zerolog.Nop()
+	faults, err := chaos.NewInjector(chaos.Config{DatagramDropRate: 1, DialFailureRate: 1})
+	require.NoError(t, err)
+	proxy := NewOriginProxy(ing, testWarpRouting, testTags, &log, Options{Faults: faults})
+
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1", nil)
+	require.NoError(t, err)
+	err = proxy.ProxyHTTP(newMockHTTPRespWriter(), tracing.NewTracedHTTPRequest(req, &log), false)
+	assert.ErrorIs(t, err, chaos.ErrInjectedDialFailure)
+
+	origin, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer origin.Close()
+	originAddr := origin.LocalAddr().(*net.UDPAddr)
+
+	originProxy, err := proxy.DialUDPSession(uuid.New(), originAddr.IP, uint16(originAddr.Port))
+	require.NoError(t, err)
+	defer originProxy.Close()
+	n, err := originProxy.Write([]byte("ping"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	// The datagram was dropped, so it never reaches the origin
+	require.NoError(t, origin.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, _, err = origin.ReadFrom(make([]byte, 4))
+	assert.True(t, os.IsTimeout(err))
+}
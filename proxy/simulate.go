@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+// localResponse is how cloudflared answers a request itself instead of proxying it to the origin of its rule
+type localResponse int
+
+const (
+	// The request is proxied to the origin
+	noLocalResponse localResponse = iota
+	// The request is to the healthPath of the rule, see writeHealth
+	healthResponse
+	// The hostname of the rule is in maintenance mode, see writeMaintenance
+	maintenanceResponse
+	// The rule redirects plain HTTP requests to HTTPS, see redirectToHTTPS
+	httpsRedirectResponse
+)
+
+// localResponse returns whether req, which matched rule, is answered by cloudflared itself
+func (p *Proxy) localResponse(req *http.Request, rule *ingress.Rule, isWebsocket bool) localResponse {
+	if p.isHealthRequest(req, rule.Config.HealthPath) {
+		return healthResponse
+	}
+	if p.maintenance.Enabled(rule.Hostname) {
+		return maintenanceResponse
+	}
+	if _, ok := rule.Service.(ingress.HTTPOriginProxy); ok && rule.Config.HTTPSRedirect && !isWebsocket && isPlainHTTP(req) {
+		return httpsRedirectResponse
+	}
+	return noLocalResponse
+}
+
+// SimulatedRequest is how cloudflared answers a request, as computed without starting the origins
+type SimulatedRequest struct {
+	ingress.SimulatedRequest
+	// LocalResponse describes the response cloudflared answers the request with itself, or is empty if the request is
+	// proxied to the origin
+	LocalResponse string
+}
+
+// Simulate returns how req is answered, going through the same steps as ProxyHTTP without proxying it. It's meant to
+// debug the rules offline, the origins don't need to be started.
+func (p *Proxy) Simulate(req *http.Request, isWebsocket bool) SimulatedRequest {
+	req = req.Clone(req.Context())
+	p.appendTagHeaders(req)
+	rule, ruleNum := p.ingressRules.FindMatchingRule(req.Host, req.URL.Path)
+	simulated := SimulatedRequest{SimulatedRequest: ingress.SimulatedRequest{RuleIndex: ruleNum}}
+
+	switch p.localResponse(req, rule, isWebsocket) {
+	case healthResponse:
+		simulated.LocalResponse = "the health of cloudflared, with 200 OK if a connection to the edge is ready and 503 Service Unavailable otherwise"
+	case maintenanceResponse:
+		status := defaultMaintenanceStatus
+		if rule.Config.MaintenanceStatus != 0 {
+			status = int(rule.Config.MaintenanceStatus)
+		}
+		simulated.LocalResponse = fmt.Sprintf("the maintenance page, with %d %s", status, http.StatusText(status))
+	case httpsRedirectResponse:
+		simulated.LocalResponse = fmt.Sprintf("a redirect to %s, with %d %s", httpsLocation(req), http.StatusPermanentRedirect, http.StatusText(http.StatusPermanentRedirect))
+	default:
+		if _, ok := rule.Service.(ingress.HTTPOriginProxy); ok {
+			req = prepareOriginRequest(req, isWebsocket, rule.Config)
+		}
+		simulated.SimulatedRequest = p.ingressRules.Simulate(req)
+	}
+	return simulated
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+func TestSimulate(t *testing.T) {
+	healthPath := "/_tunnel/healthz"
+	enabled := true
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Hostname: "app.example.com",
+				Service:  "https://localhost:8443",
+				OriginRequest: config.OriginRequestConfig{
+					HealthPath:        &healthPath,
+					HTTPSRedirect:     &enabled,
+					ForwardClientCert: &enabled,
+				},
+			},
+			{Hostname: "down.example.com", Service: "http://localhost:8000"},
+			{Service: "http_status:404"},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	maintenance := NewMaintenance(&log)
+	maintenance.Enable("down.example.com")
+	proxy := NewOriginProxy(ing, noWarpRouting, testTags, &log, Options{Maintenance: maintenance, Health: NewConnectorHealth(&log)})
+
+	simulate := func(url string, header http.Header) SimulatedRequest {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		req.Header = header
+		return proxy.Simulate(req, false)
+	}
+
+	simulated := simulate("https://app.example.com/users", http.Header{
+		forwardedProtoHeader:     {"https"},
+		ClientCertVerifiedHeader: {"true"},
+	})
+	assert.Equal(t, 0, simulated.RuleIndex)
+	assert.Empty(t, simulated.LocalResponse)
+	require.NotNil(t, simulated.OriginRequest)
+	assert.Equal(t, "https://localhost:8443/users", simulated.OriginRequest.URL.String())
+	assert.Equal(t, "value", simulated.OriginRequest.Header.Get(TagHeaderNamePrefix+"Name"))
+	assert.Equal(t, "keep-alive", simulated.OriginRequest.Header.Get("Connection"))
+	// The client certificate headers sent by the client are removed
+	assert.Empty(t, simulated.OriginRequest.Header.Get(ClientCertVerifiedHeader))
+
+	simulated = simulate("http://app.example.com/users?page=2", http.Header{forwardedProtoHeader: {"http"}})
+	assert.Equal(t, 0, simulated.RuleIndex)
+	assert.Equal(t, "a redirect to https://app.example.com/users?page=2, with 308 Permanent Redirect", simulated.LocalResponse)
+	assert.Nil(t, simulated.OriginRequest)
+
+	simulated = simulate("https://app.example.com/_tunnel/healthz", http.Header{})
+	assert.Contains(t, simulated.LocalResponse, "the health of cloudflared")
+
+	simulated = simulate("https://down.example.com/", http.Header{})
+	assert.Equal(t, 1, simulated.RuleIndex)
+	assert.Equal(t, "the maintenance page, with 503 Service Unavailable", simulated.LocalResponse)
+
+	simulated = simulate("https://other.example.com/", http.Header{})
+	assert.Equal(t, 2, simulated.RuleIndex)
+	assert.Empty(t, simulated.LocalResponse)
+	assert.Nil(t, simulated.OriginRequest)
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+const (
+	// latencyWindow is how many of the latest requests to the origin of a rule its p99 latency is computed over
+	latencyWindow = 200
+	// minLatencySamples is how many requests to the origin of a rule its p99 latency needs to be meaningful
+	minLatencySamples = 100
+	// latencyCheckInterval is how many requests to the origin of a rule the p99 latency is computed every
+	latencyCheckInterval = 20
+	// slowOriginWarnInterval is how often slow origins are warned about at most, by rule and reason
+	slowOriginWarnInterval = time.Minute
+
+	slowOriginLatency = "latency"
+	slowOriginPending = "pending"
+)
+
+// slowOriginHTTPOriginProxy reports the requests to an HTTPOriginProxy to its slowOriginDetector
+type slowOriginHTTPOriginProxy struct {
+	ingress.HTTPOriginProxy
+	detector *slowOriginDetector
+}
+
+func (p *slowOriginHTTPOriginProxy) RoundTrip(req *http.Request) (*http.Response, error) {
+	p.detector.start()
+	start := p.detector.now()
+	resp, err := p.HTTPOriginProxy.RoundTrip(req)
+	if err != nil {
+		p.detector.done(0)
+		return nil, err
+	}
+	p.detector.done(p.detector.now().Sub(start))
+	return resp, nil
+}
+
+// slowOriginDetector tracks the latency until the response headers and the pending requests of the origin of an
+// ingress rule, and warns when they exceed the slowOriginThreshold or slowOriginPendingRequests of the rule.
+type slowOriginDetector struct {
+	rule             string
+	service          string
+	latencyThreshold time.Duration
+	pendingThreshold int64
+	pending          int64
+	log              *zerolog.Logger
+	now              func() time.Time
+
+	pendingGauge   prometheus.Gauge
+	p99Gauge       prometheus.Gauge
+	latencyWarning prometheus.Counter
+	pendingWarning prometheus.Counter
+
+	lock      sync.Mutex
+	latencies []time.Duration
+	next      int
+	// sinceCheck is how many latencies were recorded since the p99 latency was computed
+	sinceCheck int
+	lastWarned map[string]time.Time
+}
+
+// newSlowOriginDetectors returns a detector by rule of ingressRules, nil for the rules that don't set a threshold.
+// Like the stream limiters, they start over with each configuration.
+func newSlowOriginDetectors(ingressRules ingress.Ingress, log *zerolog.Logger) []*slowOriginDetector {
+	detectors := make([]*slowOriginDetector, len(ingressRules.Rules))
+	for i := range ingressRules.Rules {
+		rule := &ingressRules.Rules[i]
+		cfg := rule.Config
+		if cfg.SlowOriginThreshold.Duration <= 0 && cfg.SlowOriginPendingRequests == 0 {
+			continue
+		}
+		labelValues := ruleLabelValues(rule)
+		detectors[i] = &slowOriginDetector{
+			rule:             strconv.Itoa(i),
+			service:          rule.Service.String(),
+			latencyThreshold: cfg.SlowOriginThreshold.Duration,
+			pendingThreshold: int64(cfg.SlowOriginPendingRequests),
+			log:              log,
+			now:              time.Now,
+			pendingGauge:     pendingRuleRequests.WithLabelValues(labelValues...),
+			p99Gauge:         originLatencyP99.WithLabelValues(labelValues...),
+			latencyWarning:   slowOriginWarnings.WithLabelValues(append(labelValues, slowOriginLatency)...),
+			pendingWarning:   slowOriginWarnings.WithLabelValues(append(labelValues, slowOriginPending)...),
+			latencies:        make([]time.Duration, 0, latencyWindow),
+			lastWarned:       make(map[string]time.Time),
+		}
+	}
+	return detectors
+}
+
+// start counts a pending request to the origin, it must be followed by done
+func (d *slowOriginDetector) start() {
+	pending := atomic.AddInt64(&d.pending, 1)
+	d.pendingGauge.Inc()
+	if d.pendingThreshold > 0 && pending > d.pendingThreshold && d.shouldWarn(slowOriginPending) {
+		d.log.Warn().Str(LogFieldRule, d.rule).Str(LogFieldOriginService, d.service).
+			Int64("pendingRequests", pending).Int64("threshold", d.pendingThreshold).
+			Msg("Requests are queuing up for the origin, it may be slow or overloaded")
+	}
+}
+
+// done records the latency of a request to the origin until its response headers, 0 if it failed
+func (d *slowOriginDetector) done(latency time.Duration) {
+	atomic.AddInt64(&d.pending, -1)
+	d.pendingGauge.Dec()
+	if latency <= 0 {
+		return
+	}
+	p99, samples, ok := d.record(latency)
+	if !ok {
+		return
+	}
+	d.p99Gauge.Set(p99.Seconds())
+	if d.latencyThreshold > 0 && p99 > d.latencyThreshold && d.shouldWarn(slowOriginLatency) {
+		d.log.Warn().Str(LogFieldRule, d.rule).Str(LogFieldOriginService, d.service).
+			Dur("p99", p99).Dur("threshold", d.latencyThreshold).Int("samples", samples).
+			Msg("The origin is slow to respond, its p99 latency exceeds slowOriginThreshold")
+	}
+}
+
+// record adds latency to the window, and returns the p99 latency of the window and its size when it's time to
+// check it and there are enough samples
+func (d *slowOriginDetector) record(latency time.Duration) (time.Duration, int, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.latencies) < latencyWindow {
+		d.latencies = append(d.latencies, latency)
+	} else {
+		d.latencies[d.next] = latency
+		d.next = (d.next + 1) % latencyWindow
+	}
+	d.sinceCheck++
+	if d.sinceCheck < latencyCheckInterval || len(d.latencies) < minLatencySamples {
+		return 0, 0, false
+	}
+	d.sinceCheck = 0
+	sorted := make([]time.Duration, len(d.latencies))
+	copy(sorted, d.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[(len(sorted)*99-1)/100], len(sorted), true
+}
+
+// shouldWarn is whether it's been slowOriginWarnInterval since the origin was warned about for reason
+func (d *slowOriginDetector) shouldWarn(reason string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	now := d.now()
+	if last, ok := d.lastWarned[reason]; ok && now.Sub(last) < slowOriginWarnInterval {
+		return false
+	}
+	d.lastWarned[reason] = now
+	if reason == slowOriginLatency {
+		d.latencyWarning.Inc()
+	} else {
+		d.pendingWarning.Inc()
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+func TestSlowOriginDetector(t *testing.T) {
+	threshold := config.CustomDuration{Duration: 100 * time.Millisecond}
+	pending := uint(2)
+	ing, err := ingress.ParseIngress(&config.Configuration{
+		Ingress: []config.UnvalidatedIngressRule{
+			{
+				Hostname:      "slow.example.com",
+				Service:       "http://localhost:8080",
+				OriginRequest: config.OriginRequestConfig{SlowOriginThreshold: &threshold, SlowOriginPendingRequests: &pending},
+			},
+			{
+				Service: "http://localhost:8081",
+			},
+		},
+	})
+	require.NoError(t, err)
+	log := zerolog.Nop()
+	detectors := newSlowOriginDetectors(ing, &log)
+	require.Len(t, detectors, 2)
+	assert.Nil(t, detectors[1], "rules without thresholds aren't tracked")
+
+	detector := detectors[0]
+	now := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	detector.now = func() time.Time { return now }
+	labelValues := []string{"slow.example.com", "", "http://localhost:8080"}
+	latencyWarnings := slowOriginWarnings.WithLabelValues(append(labelValues, slowOriginLatency)...)
+	pendingWarnings := slowOriginWarnings.WithLabelValues(append(labelValues, slowOriginPending)...)
+	latencyWarned := testutil.ToFloat64(latencyWarnings)
+	pendingWarned := testutil.ToFloat64(pendingWarnings)
+
+	// One slow request in a hundred is under the p99
+	for i := 0; i < minLatencySamples; i++ {
+		latency := 10 * time.Millisecond
+		if i == 0 {
+			latency = time.Second
+		}
+		detector.start()
+		detector.done(latency)
+	}
+	assert.Equal(t, latencyWarned, testutil.ToFloat64(latencyWarnings))
+	assert.Equal(t, 0.01, testutil.ToFloat64(originLatencyP99.WithLabelValues(labelValues...)))
+
+	// Two are over it, but the warning isn't repeated until slowOriginWarnInterval is over
+	for i := 0; i < latencyCheckInterval*2; i++ {
+		detector.start()
+		detector.done(time.Second)
+	}
+	assert.Equal(t, latencyWarned+1, testutil.ToFloat64(latencyWarnings))
+	now = now.Add(slowOriginWarnInterval)
+	for i := 0; i < latencyCheckInterval; i++ {
+		detector.start()
+		detector.done(time.Second)
+	}
+	assert.Equal(t, latencyWarned+2, testutil.ToFloat64(latencyWarnings))
+
+	// Failed requests aren't latencies, but they were pending
+	for i := 0; i < 3; i++ {
+		detector.start()
+	}
+	assert.Equal(t, pendingWarned+1, testutil.ToFloat64(pendingWarnings))
+	assert.Equal(t, 3.0, testutil.ToFloat64(pendingRuleRequests.WithLabelValues(labelValues...)))
+	for i := 0; i < 3; i++ {
+		detector.done(0)
+	}
+	assert.Equal(t, 0.0, testutil.ToFloat64(pendingRuleRequests.WithLabelValues(labelValues...)))
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+// streamLimiter counts the concurrent WebSocket and TCP streams of an ingress rule, and caps them to the
+// maxConcurrentStreams of the rule
+type streamLimiter struct {
+	limit  int64
+	active int64
+	gauge  prometheus.Gauge
+	reject prometheus.Counter
+}
+
+// newStreamLimiters returns a limiter by rule of ingressRules. Their count starts at 0 with each configuration, so
+// streams still running from a previous configuration don't count towards the limit.
+func newStreamLimiters(ingressRules ingress.Ingress) []*streamLimiter {
+	limiters := make([]*streamLimiter, len(ingressRules.Rules))
+	for i := range ingressRules.Rules {
+		rule := &ingressRules.Rules[i]
+		labelValues := ruleLabelValues(rule)
+		limiters[i] = &streamLimiter{
+			limit:  int64(rule.Config.MaxConcurrentStreams),
+			gauge:  activeRuleStreams.WithLabelValues(labelValues...),
+			reject: rejectedRuleStreams.WithLabelValues(labelValues...),
+		}
+	}
+	return limiters
+}
+
+// acquire counts a new stream, returning false without counting it if the limit is reached. Streams that are
+// counted must be released once done.
+func (l *streamLimiter) acquire() bool {
+	if active := atomic.AddInt64(&l.active, 1); l.limit > 0 && active > l.limit {
+		atomic.AddInt64(&l.active, -1)
+		l.reject.Inc()
+		return false
+	}
+	l.gauge.Inc()
+	return true
+}
+
+func (l *streamLimiter) release() {
+	atomic.AddInt64(&l.active, -1)
+	l.gauge.Dec()
+}
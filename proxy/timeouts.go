@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Causes of the requests the proxy answers with 504 Gateway Timeout
+const (
+	timeoutConnect        = "connect"
+	timeoutTLSHandshake   = "tls_handshake"
+	timeoutResponseHeader = "response_header"
+	timeoutRequest        = "request"
+)
+
+// originTimeoutError is a request to the origin that timed out before the origin responded
+type originTimeoutError struct {
+	cause string
+	err   error
+}
+
+func (e *originTimeoutError) Error() string {
+	return fmt.Sprintf("the origin timed out (%s): %v", e.cause, e.err)
+}
+
+func (e *originTimeoutError) Unwrap() error {
+	return e.err
+}
+
+// originTimeout returns the originTimeoutError of err if the request to the origin timed out, or nil. deadlineExpired
+// is whether the requestDeadline of the request to the origin expired, and eyeballCtx is the context of the request
+// it proxies.
+func originTimeout(err error, deadlineExpired bool, eyeballCtx context.Context) *originTimeoutError {
+	if eyeballCtx.Err() != nil {
+		return nil
+	}
+	if deadlineExpired {
+		return &originTimeoutError{cause: timeoutRequest, err: err}
+	}
+	// The errors of the timeouts of http.Transport aren't exported
+	switch msg := err.Error(); {
+	case strings.Contains(msg, "timeout awaiting response headers"):
+		return &originTimeoutError{cause: timeoutResponseHeader, err: err}
+	case strings.Contains(msg, "TLS handshake timeout"):
+		return &originTimeoutError{cause: timeoutTLSHandshake, err: err}
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout() {
+		return &originTimeoutError{cause: timeoutConnect, err: err}
+	}
+	return nil
+}
+
+// requestDeadline cancels the context of a request to the origin when its deadline expires. Unlike
+// context.WithTimeout, the deadline can be moved once the request is sent, for streaming responses to get another
+// deadline than requestTimeout.
+type requestDeadline struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timer   *time.Timer
+	expired int32
+}
+
+func newRequestDeadline(parent context.Context, timeout time.Duration) *requestDeadline {
+	d := &requestDeadline{}
+	d.ctx, d.cancel = context.WithCancel(parent)
+	d.reset(timeout)
+	return d
+}
+
+// reset moves the deadline to timeout from now, there is no deadline if it's 0
+func (d *requestDeadline) reset(timeout time.Duration) {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if timeout > 0 {
+		d.timer = time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&d.expired, 1)
+			d.cancel()
+		})
+	}
+}
+
+func (d *requestDeadline) hasExpired() bool {
+	return atomic.LoadInt32(&d.expired) == 1
+}
+
+// stop cancels the request, it must be called once the request is done
+func (d *requestDeadline) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.cancel()
+}
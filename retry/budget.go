@@ -0,0 +1,125 @@
+package retry
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Subsystems that retry, which label the metrics of the retry budget
+const (
+	// EdgeReconnects are the reconnects of the tunnel connections to the edge, including the first one
+	EdgeReconnects = "edge"
+	// OriginRetries are the retries of the discovery of origins, e.g. from Consul
+	OriginRetries = "origin"
+	// APIRetries are the retries of the calls to the Cloudflare API
+	APIRetries = "api"
+)
+
+var globalBudget atomic.Value
+
+// Budget is a token bucket of retries shared by the subsystems of cloudflared, so that a widespread outage causes a
+// bounded number of retries instead of every subsystem retrying on its own. Each retry takes a token, and a token is
+// added back every refill interval, up to the capacity of the budget.
+// A nil Budget is unlimited.
+type Budget struct {
+	capacity       float64
+	refillInterval time.Duration
+
+	lock    sync.Mutex
+	tokens  float64
+	updated time.Time
+}
+
+// NewBudget returns a full budget of capacity retries, refilled with a retry every refillInterval.
+func NewBudget(capacity int, refillInterval time.Duration) *Budget {
+	return &Budget{
+		capacity:       float64(capacity),
+		refillInterval: refillInterval,
+		tokens:         float64(capacity),
+		updated:        Clock.Now(),
+	}
+}
+
+// SetGlobalBudget sets the budget of the retries of all subsystems, nil for unlimited retries.
+func SetGlobalBudget(b *Budget) {
+	globalBudget.Store(b)
+}
+
+// GlobalBudget returns the budget of the retries of all subsystems, nil if they're unlimited.
+func GlobalBudget() *Budget {
+	b, _ := globalBudget.Load().(*Budget)
+	return b
+}
+
+// Take takes a token for a retry of subsystem. It returns false if the budget is exhausted, in which case the retry
+// should be given up.
+func (b *Budget) Take(subsystem string) bool {
+	if b == nil {
+		return true
+	}
+	if _, ok := b.take(); !ok {
+		budgetExhausted.WithLabelValues(subsystem).Inc()
+		return false
+	}
+	budgetConsumed.WithLabelValues(subsystem).Inc()
+	return true
+}
+
+// Wait takes a token for a retry of subsystem, waiting for one to be refilled if the budget is exhausted. It returns
+// false if ctx is done first.
+func (b *Budget) Wait(ctx context.Context, subsystem string) bool {
+	if b == nil {
+		return true
+	}
+	exhausted := false
+	for {
+		wait, ok := b.take()
+		if ok {
+			budgetConsumed.WithLabelValues(subsystem).Inc()
+			return true
+		}
+		if !exhausted {
+			exhausted = true
+			budgetExhausted.WithLabelValues(subsystem).Inc()
+		}
+		select {
+		case <-Clock.After(wait):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Available returns the number of retries left in the budget.
+func (b *Budget) Available() float64 {
+	if b == nil {
+		return math.Inf(1)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill()
+	return b.tokens
+}
+
+// take takes a token if there's one, else it returns how long until there's one
+func (b *Budget) take() (time.Duration, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill()
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) * float64(b.refillInterval)), false
+}
+
+func (b *Budget) refill() {
+	now := Clock.Now()
+	if b.refillInterval > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+float64(now.Sub(b.updated))/float64(b.refillInterval))
+	}
+	b.updated = now
+}
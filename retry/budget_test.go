@@ -0,0 +1,65 @@
+package retry
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgetTake(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	defer func(c clock) { Clock = c }(Clock)
+	Clock.Now = func() time.Time { return now }
+
+	budget := NewBudget(2, time.Second)
+	consumed := testutil.ToFloat64(budgetConsumed.WithLabelValues(APIRetries))
+	exhausted := testutil.ToFloat64(budgetExhausted.WithLabelValues(APIRetries))
+	assert.True(t, budget.Take(APIRetries))
+	assert.True(t, budget.Take(APIRetries))
+	assert.False(t, budget.Take(APIRetries))
+	assert.Equal(t, consumed+2, testutil.ToFloat64(budgetConsumed.WithLabelValues(APIRetries)))
+	assert.Equal(t, exhausted+1, testutil.ToFloat64(budgetExhausted.WithLabelValues(APIRetries)))
+
+	// Tokens are refilled over time, up to the capacity
+	now = now.Add(1500 * time.Millisecond)
+	assert.Equal(t, 1.5, budget.Available())
+	assert.True(t, budget.Take(APIRetries))
+	assert.False(t, budget.Take(APIRetries))
+	now = now.Add(time.Hour)
+	assert.Equal(t, 2.0, budget.Available())
+}
+
+func TestBudgetWait(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	defer func(c clock) { Clock = c }(Clock)
+	Clock.Now = func() time.Time { return now }
+	var waits []time.Duration
+	Clock.After = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return immediateTimeAfter(d)
+	}
+
+	budget := NewBudget(1, 4*time.Second)
+	assert.True(t, budget.Wait(context.Background(), EdgeReconnects))
+	now = now.Add(time.Second)
+	assert.True(t, budget.Wait(context.Background(), EdgeReconnects))
+	assert.Equal(t, []time.Duration{3 * time.Second}, waits)
+
+	Clock.After = func(time.Duration) <-chan time.Time { return make(chan time.Time) }
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, budget.Wait(ctx, EdgeReconnects))
+}
+
+func TestNilBudget(t *testing.T) {
+	var budget *Budget
+	assert.True(t, budget.Take(OriginRetries))
+	assert.True(t, budget.Wait(context.Background(), OriginRetries))
+	assert.Equal(t, math.Inf(1), budget.Available())
+	assert.Nil(t, GlobalBudget())
+}
@@ -0,0 +1,44 @@
+package retry
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "cloudflared"
+	metricsSubsystem = "retry_budget"
+)
+
+var (
+	budgetConsumed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "consumed_total",
+			Help:      "Number of retries that took a token of the retry budget, by subsystem",
+		},
+		[]string{"subsystem"},
+	)
+	budgetExhausted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "exhausted_total",
+			Help:      "Number of retries that were delayed or given up because the retry budget was exhausted, by subsystem",
+		},
+		[]string{"subsystem"},
+	)
+	budgetAvailable = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "available_tokens",
+			Help:      "Number of retries left in the retry budget, +Inf if it's unlimited",
+		},
+		func() float64 { return GlobalBudget().Available() },
+	)
+)
+
+func init() {
+	prometheus.MustRegister(budgetConsumed, budgetExhausted, budgetAvailable)
+}
@@ -0,0 +1,223 @@
+package runtimelimits
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	cgroupRoot     = "/sys/fs/cgroup"
+	procSelfCgroup = "/proc/self/cgroup"
+
+	// cgroupV1Unlimited is the smallest memory.limit_in_bytes considered unlimited, the kernel reports
+	// unlimited as the largest multiple of the page size
+	cgroupV1Unlimited = 1 << 62
+)
+
+// cgroupLimits are the limits of a cgroup, they are 0 if there's none
+type cgroupLimits struct {
+	cpus   float64
+	memory int64
+}
+
+// readCgroupLimits returns the limits of the cgroup of the process from cgroup v1 or v2 hierarchies mounted at root.
+// Since the limits of ancestors apply to their descendants, the lowest limit from the cgroup of the process up to
+// root is returned. The cgroup of the process may not be visible from root, like when its own cgroup is mounted at
+// root in a container, in which case the limits of root are returned.
+func readCgroupLimits(root, procCgroup string) (cgroupLimits, error) {
+	v1Paths, v2Path, err := parseProcCgroup(procCgroup)
+	if os.IsNotExist(err) {
+		// Not on Linux
+		return cgroupLimits{}, nil
+	}
+	if err != nil {
+		return cgroupLimits{}, err
+	}
+
+	var limits cgroupLimits
+	if cgroupPath, ok := v1Paths["cpu"]; ok {
+		err = walkCgroup(filepath.Join(root, "cpu"), cgroupPath, minCPUs(&limits.cpus, readCPUQuotaV1))
+	} else if v2Path != "" {
+		err = walkCgroup(root, v2Path, minCPUs(&limits.cpus, readCPUQuotaV2))
+	}
+	if err != nil {
+		return cgroupLimits{}, err
+	}
+
+	if cgroupPath, ok := v1Paths["memory"]; ok {
+		err = walkCgroup(filepath.Join(root, "memory"), cgroupPath, minMemory(&limits.memory, readMemoryLimitV1))
+	} else if v2Path != "" {
+		err = walkCgroup(root, v2Path, minMemory(&limits.memory, readMemoryLimitV2))
+	}
+	if err != nil {
+		return cgroupLimits{}, err
+	}
+	return limits, nil
+}
+
+// parseProcCgroup returns the path of the cgroup of each cgroup v1 controller, and the path of the cgroup v2 cgroup,
+// from /proc/<pid>/cgroup
+func parseProcCgroup(procCgroup string) (v1Paths map[string]string, v2Path string, err error) {
+	f, err := os.Open(procCgroup)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	v1Paths = make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Lines are hierarchy-ID:controller-list:cgroup-path, the controller list of cgroup v2 is empty
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "0" && fields[1] == "" {
+			v2Path = fields[2]
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			v1Paths[controller] = fields[2]
+		}
+	}
+	return v1Paths, v2Path, scanner.Err()
+}
+
+// walkCgroup calls readLimit with the directory of cgroupPath under root, and of each of its ancestors that exist
+func walkCgroup(root, cgroupPath string, readLimit func(dir string) error) error {
+	cgroupPath = path.Clean("/" + cgroupPath)
+	for {
+		dir := filepath.Join(root, filepath.FromSlash(cgroupPath))
+		if _, err := os.Stat(dir); err == nil {
+			if err := readLimit(dir); err != nil {
+				return err
+			}
+		}
+		if cgroupPath == "/" {
+			return nil
+		}
+		cgroupPath = path.Dir(cgroupPath)
+	}
+}
+
+// minCPUs returns a readLimit of walkCgroup keeping the lowest CPU quota in cpus
+func minCPUs(cpus *float64, read func(dir string) (float64, error)) func(dir string) error {
+	return func(dir string) error {
+		limit, err := read(dir)
+		if err != nil {
+			return err
+		}
+		if limit > 0 && (*cpus == 0 || limit < *cpus) {
+			*cpus = limit
+		}
+		return nil
+	}
+}
+
+// minMemory returns a readLimit of walkCgroup keeping the lowest memory limit in memory
+func minMemory(memory *int64, read func(dir string) (int64, error)) func(dir string) error {
+	return func(dir string) error {
+		limit, err := read(dir)
+		if err != nil {
+			return err
+		}
+		if limit > 0 && (*memory == 0 || limit < *memory) {
+			*memory = limit
+		}
+		return nil
+	}
+}
+
+// readCPUQuotaV2 reads cpu.max, which is "$MAX $PERIOD", where $MAX is "max" without a quota
+func readCPUQuotaV2(dir string) (float64, error) {
+	content, ok, err := readCgroupFile(dir, "cpu.max")
+	if !ok || err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(content)
+	if len(fields) != 2 {
+		return 0, errors.Errorf("invalid cpu.max %q in %s", content, dir)
+	}
+	if fields[0] == "max" {
+		return 0, nil
+	}
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid cpu.max %q in %s", content, dir)
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period <= 0 {
+		return 0, errors.Errorf("invalid cpu.max %q in %s", content, dir)
+	}
+	return quota / period, nil
+}
+
+// readCPUQuotaV1 reads cpu.cfs_quota_us, which is -1 without a quota, and cpu.cfs_period_us
+func readCPUQuotaV1(dir string) (float64, error) {
+	quota, ok, err := readCgroupInt(dir, "cpu.cfs_quota_us")
+	if !ok || err != nil || quota <= 0 {
+		return 0, err
+	}
+	period, ok, err := readCgroupInt(dir, "cpu.cfs_period_us")
+	if !ok || err != nil {
+		return 0, err
+	}
+	if period <= 0 {
+		return 0, errors.Errorf("invalid cpu.cfs_period_us %d in %s", period, dir)
+	}
+	return float64(quota) / float64(period), nil
+}
+
+// readMemoryLimitV2 reads memory.max, which is "max" without a limit
+func readMemoryLimitV2(dir string) (int64, error) {
+	content, ok, err := readCgroupFile(dir, "memory.max")
+	if !ok || err != nil || content == "max" {
+		return 0, err
+	}
+	limit, err := strconv.ParseInt(content, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid memory.max %q in %s", content, dir)
+	}
+	return limit, nil
+}
+
+// readMemoryLimitV1 reads memory.limit_in_bytes
+func readMemoryLimitV1(dir string) (int64, error) {
+	limit, ok, err := readCgroupInt(dir, "memory.limit_in_bytes")
+	if !ok || err != nil || limit >= cgroupV1Unlimited {
+		return 0, err
+	}
+	return limit, nil
+}
+
+func readCgroupInt(dir, file string) (int64, bool, error) {
+	content, ok, err := readCgroupFile(dir, file)
+	if !ok || err != nil {
+		return 0, ok, err
+	}
+	n, err := strconv.ParseInt(content, 10, 64)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "invalid %s %q in %s", file, content, dir)
+	}
+	return n, true, nil
+}
+
+// readCgroupFile returns the trimmed content of a file of a cgroup, or false if the file doesn't exist because the
+// controller isn't enabled in the cgroup
+func readCgroupFile(dir, file string) (string, bool, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, file))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSpace(string(content)), true, nil
+}
@@ -0,0 +1,106 @@
+package runtimelimits
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCgroupFiles writes files, keyed by their path relative to root, and returns root
+func writeCgroupFiles(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return root
+}
+
+func TestReadCgroupLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected cgroupLimits
+	}{
+		{
+			name: "cgroup v2",
+			files: map[string]string{
+				"proc":                        "0::/system.slice/cloudflared.service\n",
+				"sys/system.slice/cpu.max":    "max 100000\n",
+				"sys/system.slice/memory.max": "1073741824\n",
+				"sys/system.slice/cloudflared.service/cpu.max":    "250000 100000\n",
+				"sys/system.slice/cloudflared.service/memory.max": "max\n",
+			},
+			expected: cgroupLimits{cpus: 2.5, memory: 1 << 30},
+		},
+		{
+			name: "cgroup v2 without limits",
+			files: map[string]string{
+				"proc":           "0::/\n",
+				"sys/cpu.max":    "max 100000\n",
+				"sys/memory.max": "max\n",
+			},
+		},
+		{
+			name: "cgroup v2 namespace",
+			files: map[string]string{
+				// The cgroup of the process is the root of its cgroup namespace
+				"proc":           "0::/\n",
+				"sys/cpu.max":    "50000 100000\n",
+				"sys/memory.max": "268435456\n",
+			},
+			expected: cgroupLimits{cpus: 0.5, memory: 256 << 20},
+		},
+		{
+			name: "cgroup v1",
+			files: map[string]string{
+				"proc":                                        "12:memory:/docker/abc\n4:cpu,cpuacct:/docker/abc\n0::/\n",
+				"sys/cpu/docker/abc/cpu.cfs_quota_us":         "200000\n",
+				"sys/cpu/docker/abc/cpu.cfs_period_us":        "100000\n",
+				"sys/cpu/cpu.cfs_quota_us":                    "-1\n",
+				"sys/cpu/cpu.cfs_period_us":                   "100000\n",
+				"sys/memory/docker/abc/memory.limit_in_bytes": "536870912\n",
+				"sys/memory/memory.limit_in_bytes":            "9223372036854771712\n",
+			},
+			expected: cgroupLimits{cpus: 2, memory: 512 << 20},
+		},
+		{
+			name: "cgroup v1 mounted at the cgroup of the process",
+			files: map[string]string{
+				"proc":                             "12:memory:/docker/abc\n4:cpu,cpuacct:/docker/abc\n",
+				"sys/cpu/cpu.cfs_quota_us":         "150000\n",
+				"sys/cpu/cpu.cfs_period_us":        "100000\n",
+				"sys/memory/memory.limit_in_bytes": "536870912\n",
+			},
+			expected: cgroupLimits{cpus: 1.5, memory: 512 << 20},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := writeCgroupFiles(t, test.files)
+			limits, err := readCgroupLimits(filepath.Join(dir, "sys"), filepath.Join(dir, "proc"))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, limits)
+		})
+	}
+}
+
+func TestReadCgroupLimitsInvalid(t *testing.T) {
+	dir := writeCgroupFiles(t, map[string]string{
+		"proc":        "0::/\n",
+		"sys/cpu.max": "100000\n",
+	})
+	_, err := readCgroupLimits(filepath.Join(dir, "sys"), filepath.Join(dir, "proc"))
+	require.Error(t, err)
+}
+
+func TestReadCgroupLimitsNoCgroup(t *testing.T) {
+	dir := t.TempDir()
+	limits, err := readCgroupLimits(filepath.Join(dir, "sys"), filepath.Join(dir, "proc"))
+	require.NoError(t, err)
+	assert.Equal(t, cgroupLimits{}, limits)
+}
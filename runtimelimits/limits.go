@@ -0,0 +1,133 @@
+// Package runtimelimits sizes the Go runtime to the CPU and memory limits of the container cloudflared runs in, so
+// that it isn't throttled by running more threads than its CPU quota allows, or OOM-killed because the garbage
+// collector doesn't know about the memory limit.
+package runtimelimits
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// memoryLimitRatio is the share of the memory limit of the cgroup given to the Go runtime, the rest is left for
+	// memory the runtime doesn't account for, like thread stacks and the page cache
+	memoryLimitRatio = 0.9
+
+	maxProcsEnv    = "GOMAXPROCS"
+	memoryLimitEnv = "GOMEMLIMIT"
+)
+
+// Config overrides the limits detected from the cgroup of the process
+type Config struct {
+	// MaxProcs is the GOMAXPROCS to set, it's detected from the CPU quota if it's 0
+	MaxProcs int
+	// MemoryLimit is the soft memory limit in bytes to set, it's detected from the memory limit if it's 0
+	MemoryLimit int64
+}
+
+// Limits are the effective limits of the runtime
+type Limits struct {
+	MaxProcs int
+	// MaxProcsSource describes where MaxProcs comes from
+	MaxProcsSource string
+	// MemoryLimit is math.MaxInt64 if there's no memory limit
+	MemoryLimit int64
+	// MemoryLimitSource describes where MemoryLimit comes from
+	MemoryLimitSource string
+}
+
+// Set sets GOMAXPROCS and the soft memory limit of the runtime. The values of config take precedence, followed by the
+// GOMAXPROCS and GOMEMLIMIT environment variables, and then the limits of the cgroup of the process.
+func Set(config Config) (Limits, error) {
+	cgroup, err := readCgroupLimits(cgroupRoot, procSelfCgroup)
+	if err != nil {
+		// Config and the environment variables are still applied
+		cgroup = cgroupLimits{}
+		err = errors.Wrap(err, "failed to read the limits of the cgroup")
+	}
+
+	limits := Limits{
+		MaxProcs:          runtime.GOMAXPROCS(0),
+		MaxProcsSource:    "default",
+		MemoryLimit:       memoryLimit(),
+		MemoryLimitSource: "default",
+	}
+	switch {
+	case config.MaxProcs > 0:
+		limits.MaxProcs, limits.MaxProcsSource = config.MaxProcs, "flag"
+	case os.Getenv(maxProcsEnv) != "":
+		limits.MaxProcsSource = "environment"
+	case cgroup.cpus > 0:
+		limits.MaxProcs, limits.MaxProcsSource = maxProcs(cgroup.cpus), "cgroup"
+	}
+	runtime.GOMAXPROCS(limits.MaxProcs)
+
+	switch {
+	case config.MemoryLimit > 0:
+		limits.MemoryLimit, limits.MemoryLimitSource = config.MemoryLimit, "flag"
+	case os.Getenv(memoryLimitEnv) != "":
+		limits.MemoryLimitSource = "environment"
+	case cgroup.memory > 0:
+		limits.MemoryLimit, limits.MemoryLimitSource = int64(float64(cgroup.memory)*memoryLimitRatio), "cgroup"
+	}
+	if limits.MemoryLimitSource == "flag" || limits.MemoryLimitSource == "cgroup" {
+		if !setMemoryLimit(limits.MemoryLimit) {
+			limits.MemoryLimit, limits.MemoryLimitSource = memoryLimit(), "unsupported"
+		}
+	}
+	return limits, err
+}
+
+// maxProcs rounds a CPU quota down to a number of threads, between 1 and the number of CPUs
+func maxProcs(cpus float64) int {
+	procs := int(math.Floor(cpus))
+	if procs < 1 {
+		return 1
+	}
+	if procs > runtime.NumCPU() {
+		return runtime.NumCPU()
+	}
+	return procs
+}
+
+// ParseMemoryLimit parses a size in bytes, in the format of GOMEMLIMIT: a number with an optional B, KiB, MiB, GiB or
+// TiB suffix
+func ParseMemoryLimit(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		// B has to be last, since it's a suffix of all the others
+		{"KiB", 1 << 10},
+		{"MiB", 1 << 20},
+		{"GiB", 1 << 30},
+		{"TiB", 1 << 40},
+		{"B", 1},
+	}
+	unit := int64(1)
+	number := s
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			number, unit = strings.TrimSuffix(s, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid memory limit %q, it should be a number of bytes with an optional B, KiB, MiB, GiB or TiB suffix", s)
+	}
+	if n > math.MaxInt64/unit {
+		return 0, errors.Errorf("memory limit %q is too large", s)
+	}
+	return n * unit, nil
+}
+
+// MemoryLimit returns the soft memory limit of the runtime, math.MaxInt64 if there's none
+func MemoryLimit() int64 {
+	return memoryLimit()
+}
@@ -0,0 +1,59 @@
+package runtimelimits
+
+import (
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMemoryLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{input: "0", expected: 0},
+		{input: "1024", expected: 1024},
+		{input: "1024B", expected: 1024},
+		{input: "64KiB", expected: 64 << 10},
+		{input: "512MiB", expected: 512 << 20},
+		{input: "2GiB", expected: 2 << 30},
+		{input: "1TiB", expected: 1 << 40},
+	}
+	for _, test := range tests {
+		limit, err := ParseMemoryLimit(test.input)
+		require.NoError(t, err, test.input)
+		assert.Equal(t, test.expected, limit, test.input)
+	}
+
+	for _, input := range []string{"", "MiB", "-1MiB", "1.5GiB", "1GB", "512M", "9999999TiB"} {
+		_, err := ParseMemoryLimit(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestMaxProcs(t *testing.T) {
+	assert.Equal(t, 1, maxProcs(0.5))
+	assert.Equal(t, 1, maxProcs(1.9))
+	assert.Equal(t, runtime.NumCPU(), maxProcs(math.MaxInt32))
+}
+
+func TestSetOverrides(t *testing.T) {
+	t.Setenv(maxProcsEnv, "")
+	t.Setenv(memoryLimitEnv, "")
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	originalMemoryLimit := memoryLimit()
+	defer setMemoryLimit(originalMemoryLimit)
+
+	limits, _ := Set(Config{MaxProcs: 3, MemoryLimit: 128 << 20})
+	assert.Equal(t, 3, limits.MaxProcs)
+	assert.Equal(t, "flag", limits.MaxProcsSource)
+	assert.Equal(t, 3, runtime.GOMAXPROCS(0))
+	if limits.MemoryLimitSource != "unsupported" {
+		assert.Equal(t, "flag", limits.MemoryLimitSource)
+		assert.Equal(t, int64(128<<20), limits.MemoryLimit)
+		assert.Equal(t, int64(128<<20), memoryLimit())
+	}
+}
@@ -0,0 +1,17 @@
+//go:build go1.19
+
+package runtimelimits
+
+import (
+	"runtime/debug"
+)
+
+func setMemoryLimit(limit int64) bool {
+	debug.SetMemoryLimit(limit)
+	return true
+}
+
+// memoryLimit returns the current soft memory limit of the runtime
+func memoryLimit() int64 {
+	return debug.SetMemoryLimit(-1)
+}
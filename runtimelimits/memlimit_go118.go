@@ -0,0 +1,16 @@
+//go:build !go1.19
+
+package runtimelimits
+
+import (
+	"math"
+)
+
+// setMemoryLimit can't set a limit before Go 1.19, which introduced the soft memory limit
+func setMemoryLimit(limit int64) bool {
+	return false
+}
+
+func memoryLimit() int64 {
+	return math.MaxInt64
+}
@@ -0,0 +1,37 @@
+package runtimelimits
+
+import (
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "cloudflared"
+	metricsSubsystem = "runtime"
+)
+
+var (
+	maxProcsGauge = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "max_procs",
+			Help:      "Effective GOMAXPROCS of the Go runtime",
+		},
+		func() float64 { return float64(runtime.GOMAXPROCS(0)) },
+	)
+	memoryLimitGauge = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "memory_limit_bytes",
+			Help:      "Effective soft memory limit of the Go runtime, math.MaxInt64 if there's none",
+		},
+		func() float64 { return float64(memoryLimit()) },
+	)
+)
+
+func init() {
+	prometheus.MustRegister(maxProcsGauge, memoryLimitGauge)
+}
@@ -0,0 +1,252 @@
+package secretprovider
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+const awsTimestamp = "20060102T150405Z"
+
+// Address of the instance metadata service of EC2, replaced in tests
+var ec2MetadataAddress = "http://169.254.169.254"
+
+// awsClient calls the JSON APIs of an AWS service. It authenticates with the credentials of the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables, or with the ones of the IAM role of the EC2
+// instance.
+type awsClient struct {
+	client   *http.Client
+	service  string
+	region   string
+	endpoint string
+}
+
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+}
+
+// newAWSClient returns a client of service in region, AWS_REGION if it's empty. Requests are sent to endpoint if it's
+// set, e.g. a VPC endpoint, or to the public endpoint of the service otherwise.
+func newAWSClient(service, region, endpoint string, client *http.Client) (*awsClient, error) {
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region == "" {
+			region = os.Getenv(env)
+		}
+	}
+	if region == "" {
+		return nil, errors.New("the AWS region is required, set it in the configuration or with AWS_REGION")
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com", service, region)
+	}
+	return &awsClient{
+		client:   client,
+		service:  service,
+		region:   region,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+	}, nil
+}
+
+// call sends the action target of the API with the JSON of input, and decodes its response into output
+func (a *awsClient) call(ctx context.Context, target string, input, output interface{}) error {
+	credentials, err := a.credentials(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signAWSRequest(req, body, credentials, a.region, a.service, time.Now())
+	return doJSON(a.client, req, output)
+}
+
+// awsSecretsManager reads secrets of AWS Secrets Manager
+type awsSecretsManager struct {
+	aws      *awsClient
+	secretID string
+	field    string
+}
+
+func newAWSSecretsManager(source config.SecretSource, client *http.Client) (Provider, error) {
+	aws, err := newAWSClient("secretsmanager", source.Region, source.Address, client)
+	if err != nil {
+		return nil, err
+	}
+	return &awsSecretsManager{
+		aws:      aws,
+		secretID: source.Name,
+		field:    source.Field,
+	}, nil
+}
+
+func (a *awsSecretsManager) Description() string {
+	return fmt.Sprintf("AWS secret %s", a.secretID)
+}
+
+func (a *awsSecretsManager) Fetch(ctx context.Context) ([]byte, error) {
+	var resp struct {
+		SecretString *string
+		SecretBinary []byte
+	}
+	if err := a.aws.call(ctx, "secretsmanager.GetSecretValue", map[string]string{"SecretId": a.secretID}, &resp); err != nil {
+		return nil, err
+	}
+	secret := resp.SecretBinary
+	if resp.SecretString != nil {
+		secret = []byte(*resp.SecretString)
+	}
+	return selectField(secret, a.field)
+}
+
+func (a *awsClient) credentials(ctx context.Context) (*awsCredentials, error) {
+	if accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID"); accessKeyID != "" {
+		return &awsCredentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			Token:           os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	credentials, err := a.instanceCredentials(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the AWS credentials of the EC2 instance, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return credentials, nil
+}
+
+// instanceCredentials gets the credentials of the IAM role of the EC2 instance with IMDSv2
+func (a *awsClient) instanceCredentials(ctx context.Context) (*awsCredentials, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, ec2MetadataAddress+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := a.metadata(req)
+	if err != nil {
+		return nil, err
+	}
+
+	rolesPath := ec2MetadataAddress + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, rolesPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	roles, err := a.metadata(req)
+	if err != nil {
+		return nil, err
+	}
+	role := strings.TrimSpace(strings.SplitN(roles, "\n", 2)[0])
+	if role == "" {
+		return nil, errors.New("the instance has no IAM role")
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, rolesPath+role, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	var credentials awsCredentials
+	if err := doJSON(a.client, req, &credentials); err != nil {
+		return nil, err
+	}
+	return &credentials, nil
+}
+
+func (a *awsClient) metadata(req *http.Request) (string, error) {
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s %s returned %s", req.Method, req.URL, resp.Status)
+	}
+	return string(body), nil
+}
+
+// signAWSRequest signs req with version 4 of the AWS signature, all its headers are signed
+func signAWSRequest(req *http.Request, body []byte, credentials *awsCredentials, region, service string, now time.Time) {
+	timestamp := now.UTC().Format(awsTimestamp)
+	date := timestamp[:8]
+	req.Header.Set("X-Amz-Date", timestamp)
+	if credentials.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.Token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(headers[name]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", timestamp, scope, hexSHA256([]byte(canonicalRequest))}, "\n")
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hexSHA256(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,51 @@
+package secretprovider
+
+import (
+	"context"
+	"net/http"
+)
+
+// AWSKMS encrypts and decrypts small secrets, such as the keys of encrypted files, with keys of AWS KMS. It
+// authenticates like the AWS secret provider.
+type AWSKMS struct {
+	aws *awsClient
+}
+
+// NewAWSKMS returns a client of AWS KMS in region, AWS_REGION if it's empty. Requests are sent to endpoint if it's set,
+// or to the public endpoint of KMS otherwise.
+func NewAWSKMS(region, endpoint string) (*AWSKMS, error) {
+	aws, err := newAWSClient("kms", region, endpoint, &http.Client{Timeout: fetchTimeout})
+	if err != nil {
+		return nil, err
+	}
+	return &AWSKMS{aws: aws}, nil
+}
+
+// Encrypt encrypts plaintext with the KMS key keyID, an ID, ARN or alias of the key
+func (k *AWSKMS) Encrypt(ctx context.Context, keyID string, plaintext []byte) ([]byte, error) {
+	input := struct {
+		KeyID     string `json:"KeyId"`
+		Plaintext []byte
+	}{KeyID: keyID, Plaintext: plaintext}
+	var output struct {
+		CiphertextBlob []byte
+	}
+	if err := k.aws.call(ctx, "TrentService.Encrypt", input, &output); err != nil {
+		return nil, err
+	}
+	return output.CiphertextBlob, nil
+}
+
+// Decrypt decrypts ciphertext, returned by Encrypt. The KMS key is found from the ciphertext.
+func (k *AWSKMS) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	input := struct {
+		CiphertextBlob []byte
+	}{CiphertextBlob: ciphertext}
+	var output struct {
+		Plaintext []byte
+	}
+	if err := k.aws.call(ctx, "TrentService.Decrypt", input, &output); err != nil {
+		return nil, err
+	}
+	return output.Plaintext, nil
+}
@@ -0,0 +1,126 @@
+package secretprovider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+// The get-vanilla case of the test suite of the AWS signature version 4
+func TestSignAWSRequest(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+	credentials := &awsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	signAWSRequest(req, nil, credentials, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			_, _ = w.Write([]byte("imds-token"))
+		case r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" && strings.HasPrefix(r.URL.Path, "/latest/"):
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			_, _ = w.Write([]byte("cloudflared-role\n"))
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/cloudflared-role":
+			_, _ = w.Write([]byte(`{"AccessKeyId": "AKID", "SecretAccessKey": "secret", "Token": "session"}`))
+		case r.URL.Path == "/":
+			if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+				r.Header.Get("X-Amz-Security-Token") != "session" ||
+				!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+				!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/secretsmanager/aws4_request") {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			var req struct {
+				SecretID string `json:"SecretId"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			switch req.SecretID {
+			case "cloudflared":
+				_, _ = w.Write([]byte(`{"SecretString": "{\"token\": \"abc\"}"}`))
+			case "cert":
+				_, _ = w.Write([]byte(`{"SecretBinary": "cGVt"}`))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type": "ResourceNotFoundException"}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ec2MetadataAddress = server.URL
+	defer func() {
+		ec2MetadataAddress = "http://169.254.169.254"
+	}()
+
+	source := config.SecretSource{Provider: "aws", Name: "cloudflared", Field: "token", Address: server.URL, Region: "eu-west-1"}
+	secret, err := Fetch(context.Background(), source)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(secret))
+
+	source = config.SecretSource{Provider: "aws", Name: "cert", Address: server.URL, Region: "eu-west-1"}
+	secret, err = Fetch(context.Background(), source)
+	require.NoError(t, err)
+	assert.Equal(t, "pem", string(secret))
+
+	source = config.SecretSource{Provider: "aws", Name: "missing", Address: server.URL, Region: "eu-west-1"}
+	_, err = Fetch(context.Background(), source)
+	assert.Error(t, err)
+}
+
+func TestAWSKMS(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	// Fake KMS that "encrypts" by prefixing the plaintext
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "/us-east-1/kms/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var req struct {
+			KeyID          string `json:"KeyId"`
+			Plaintext      []byte
+			CiphertextBlob []byte
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Encrypt":
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"CiphertextBlob": append([]byte(req.KeyID+":"), req.Plaintext...)})
+		case "TrentService.Decrypt":
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"Plaintext": []byte(strings.TrimPrefix(string(req.CiphertextBlob), "alias/cloudflared:"))})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	kms, err := NewAWSKMS("us-east-1", server.URL)
+	require.NoError(t, err)
+	ciphertext, err := kms.Encrypt(context.Background(), "alias/cloudflared", []byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, "alias/cloudflared:key", string(ciphertext))
+	plaintext, err := kms.Decrypt(context.Background(), ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "key", string(plaintext))
+}
@@ -0,0 +1,91 @@
+package secretprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+const gcpSecretManagerEndpoint = "https://secretmanager.googleapis.com"
+
+// Address of the metadata server of Google Cloud, replaced in tests
+var gcpMetadataAddress = "http://metadata.google.internal"
+
+// gcpSecretManager reads secrets of Google Cloud Secret Manager. It authenticates with the access token of
+// GOOGLE_OAUTH_ACCESS_TOKEN, or with the one of the service account of the instance.
+type gcpSecretManager struct {
+	client   *http.Client
+	endpoint string
+	version  string
+	field    string
+}
+
+func newGCPSecretManager(source config.SecretSource, client *http.Client) (Provider, error) {
+	version := strings.Trim(source.Name, "/")
+	if !strings.HasPrefix(version, "projects/") || !strings.Contains(version, "/secrets/") {
+		return nil, fmt.Errorf("the name of the GCP secret must be like projects/PROJECT/secrets/SECRET, got %q", source.Name)
+	}
+	if !strings.Contains(version, "/versions/") {
+		version += "/versions/latest"
+	}
+	endpoint := source.Address
+	if endpoint == "" {
+		endpoint = gcpSecretManagerEndpoint
+	}
+	return &gcpSecretManager{
+		client:   client,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		version:  version,
+		field:    source.Field,
+	}, nil
+}
+
+func (g *gcpSecretManager) Description() string {
+	return fmt.Sprintf("GCP secret %s", g.version)
+}
+
+func (g *gcpSecretManager) Fetch(ctx context.Context) ([]byte, error) {
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v1/%s:access", g.endpoint, g.version), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var resp struct {
+		Payload struct {
+			Data []byte `json:"data"`
+		} `json:"payload"`
+	}
+	if err := doJSON(g.client, req, &resp); err != nil {
+		return nil, err
+	}
+	return selectField(resp.Payload.Data, g.field)
+}
+
+func (g *gcpSecretManager) accessToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		gcpMetadataAddress+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := doJSON(g.client, req, &token); err != nil {
+		return "", errors.Wrap(err, "failed to get the access token of the service account of the instance, set GOOGLE_OAUTH_ACCESS_TOKEN")
+	}
+	return token.AccessToken, nil
+}
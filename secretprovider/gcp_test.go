@@ -0,0 +1,58 @@
+package secretprovider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+func TestGCPSecretManager(t *testing.T) {
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/service-accounts/default/token":
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token": "gcp-token", "expires_in": 3600, "token_type": "Bearer"}`))
+		case "/v1/projects/project/secrets/cloudflared/versions/latest:access":
+			if r.Header.Get("Authorization") != "Bearer gcp-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"name": "projects/1/secrets/cloudflared/versions/2", "payload": {"data": "eyJ0b2tlbiI6ICJhYmMifQ=="}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	gcpMetadataAddress = server.URL
+	defer func() {
+		gcpMetadataAddress = "http://metadata.google.internal"
+	}()
+
+	source := config.SecretSource{Provider: "gcp", Name: "projects/project/secrets/cloudflared", Address: server.URL}
+	secret, err := Fetch(context.Background(), source)
+	require.NoError(t, err)
+	assert.Equal(t, `{"token": "abc"}`, string(secret))
+
+	source.Field = "token"
+	secret, err = Fetch(context.Background(), source)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(secret))
+
+	source.Name = "projects/project/secrets/missing/versions/1"
+	_, err = Fetch(context.Background(), source)
+	assert.Error(t, err)
+
+	source.Name = "cloudflared"
+	_, err = Fetch(context.Background(), source)
+	assert.Error(t, err)
+}
@@ -0,0 +1,164 @@
+// Package secretprovider fetches secrets such as tunnel credentials and tokens from secret managers, so that they
+// don't have to be stored in plaintext files on the hosts running cloudflared.
+package secretprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+const (
+	// Bounds the time to fetch a secret, including getting the credentials of the provider
+	fetchTimeout = 30 * time.Second
+	// Secrets bigger than this are rejected, the biggest secrets of cloudflared are origin certificates of a few KB
+	maxSecretSize = 1 << 20
+)
+
+// Provider fetches a secret from a secret manager
+type Provider interface {
+	// Fetch returns the current value of the secret
+	Fetch(ctx context.Context) ([]byte, error)
+	// Description describes the secret for users, e.g. in logs
+	Description() string
+}
+
+// Factory creates the Provider of a secret
+type Factory func(source config.SecretSource, client *http.Client) (Provider, error)
+
+var (
+	factoriesLock sync.RWMutex
+	factories     = map[string]Factory{
+		"vault": newVault,
+		"aws":   newAWSSecretsManager,
+		"gcp":   newGCPSecretManager,
+	}
+)
+
+// Register makes a provider available to configuration files under name, replacing any provider with the same name
+func Register(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	factories[name] = factory
+}
+
+// New returns the Provider of the secret located by source
+func New(source config.SecretSource) (Provider, error) {
+	factoriesLock.RLock()
+	factory, ok := factories[source.Provider]
+	factoriesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown secret provider %q, expected one of %s", source.Provider, strings.Join(providerNames(), ", "))
+	}
+	if source.Name == "" {
+		return nil, fmt.Errorf("the name of the %s secret is required", source.Provider)
+	}
+	return factory(source, &http.Client{Timeout: fetchTimeout})
+}
+
+func providerNames() []string {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Fetch returns the value of the secret located by source
+func Fetch(ctx context.Context, source config.SecretSource) ([]byte, error) {
+	provider, err := New(source)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	secret, err := provider.Fetch(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %s", provider.Description())
+	}
+	return secret, nil
+}
+
+// Watch fetches the secret of provider every interval until ctx is done, and calls onChange with its new value each
+// time it's different from the last one. Failures are logged, the last value is kept until the secret can be fetched
+// again.
+func Watch(ctx context.Context, provider Provider, current []byte, interval time.Duration, onChange func([]byte), log *zerolog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		secret, err := provider.Fetch(fetchCtx)
+		cancel()
+		if err != nil {
+			log.Err(err).Str("secret", provider.Description()).Msg("Failed to refresh secret")
+			continue
+		}
+		if !bytes.Equal(secret, current) {
+			current = secret
+			onChange(secret)
+		}
+	}
+}
+
+// selectField returns the field of secret if it's set, secret being a JSON object. Values that aren't strings are
+// returned as JSON.
+func selectField(secret []byte, field string) ([]byte, error) {
+	if field == "" {
+		return secret, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(secret, &fields); err != nil {
+		return nil, errors.Wrapf(err, "the secret must be a JSON object to select its field %q", field)
+	}
+	return fieldValue(fields, field)
+}
+
+func fieldValue(fields map[string]json.RawMessage, field string) ([]byte, error) {
+	value, ok := fields[field]
+	if !ok {
+		return nil, fmt.Errorf("the secret has no field %q", field)
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return []byte(s), nil
+	}
+	return value, nil
+}
+
+// doJSON sends req and decodes its JSON response into v, failing on statuses other than 200
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSecretSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s returned %s: %s", req.Method, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,117 @@
+package secretprovider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+func TestSelectField(t *testing.T) {
+	secret := []byte(`{"token": "abc", "credentials": {"TunnelID": "id"}}`)
+
+	value, err := selectField(secret, "")
+	require.NoError(t, err)
+	assert.Equal(t, secret, value)
+
+	value, err = selectField(secret, "token")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(value))
+
+	value, err = selectField(secret, "credentials")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"TunnelID": "id"}`, string(value))
+
+	_, err = selectField(secret, "missing")
+	assert.Error(t, err)
+
+	_, err = selectField([]byte("not json"), "token")
+	assert.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(config.SecretSource{Provider: "unknown", Name: "secret"})
+	assert.EqualError(t, err, `unknown secret provider "unknown", expected one of aws, gcp, vault`)
+
+	_, err = New(config.SecretSource{Provider: "vault"})
+	assert.Error(t, err)
+}
+
+type staticProvider struct {
+	lock   sync.Mutex
+	secret []byte
+	err    error
+}
+
+func (p *staticProvider) set(secret []byte, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.secret, p.err = secret, err
+}
+
+func (p *staticProvider) Fetch(context.Context) ([]byte, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.secret, p.err
+}
+
+func (p *staticProvider) Description() string {
+	return "static secret"
+}
+
+func TestRegister(t *testing.T) {
+	provider := &staticProvider{secret: []byte("secret")}
+	Register("static", func(source config.SecretSource, client *http.Client) (Provider, error) {
+		return provider, nil
+	})
+	defer func() {
+		factoriesLock.Lock()
+		delete(factories, "static")
+		factoriesLock.Unlock()
+	}()
+
+	secret, err := Fetch(context.Background(), config.SecretSource{Provider: "static", Name: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(secret))
+}
+
+func TestWatch(t *testing.T) {
+	provider := &staticProvider{secret: []byte("v1")}
+	changes := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	doneC := make(chan struct{})
+	log := zerolog.Nop()
+	go func() {
+		Watch(ctx, provider, []byte("v1"), 10*time.Millisecond, func(secret []byte) {
+			changes <- string(secret)
+		}, &log)
+		close(doneC)
+	}()
+
+	// Failures keep the last value, so the secret isn't reported as changed once it can be fetched again
+	provider.set(nil, errors.New("unavailable"))
+	time.Sleep(50 * time.Millisecond)
+	provider.set([]byte("v1"), nil)
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, changes)
+
+	provider.set([]byte("v2"), nil)
+	select {
+	case secret := <-changes:
+		assert.Equal(t, "v2", secret)
+	case <-time.After(time.Second):
+		t.Fatal("the change of the secret wasn't reported")
+	}
+
+	cancel()
+	<-doneC
+	assert.Empty(t, changes)
+}
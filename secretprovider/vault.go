@@ -0,0 +1,110 @@
+package secretprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+// vault reads secrets of the KV secrets engine of HashiCorp Vault, authenticating with the token of VAULT_TOKEN or of
+// the token helper file written by `vault login`
+type vault struct {
+	client    *http.Client
+	address   string
+	path      string
+	field     string
+	namespace string
+}
+
+func newVault(source config.SecretSource, client *http.Client) (Provider, error) {
+	address := source.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, errors.New("the address of the Vault server is required, set it in the secret or with VAULT_ADDR")
+	}
+	return &vault{
+		client:    client,
+		address:   strings.TrimSuffix(address, "/"),
+		path:      strings.Trim(source.Name, "/"),
+		field:     source.Field,
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+	}, nil
+}
+
+func (v *vault) Description() string {
+	return fmt.Sprintf("Vault secret %s", v.path)
+}
+
+func (v *vault) Fetch(ctx context.Context) ([]byte, error) {
+	token, err := vaultToken()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v1/%s", v.address, v.path), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	var resp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := doJSON(v.client, req, &resp); err != nil {
+		return nil, err
+	}
+	fields := resp.Data
+	// Version 2 of the KV secrets engine nests the secret in data, along with its metadata
+	if nested, ok := fields["data"]; ok {
+		if _, hasMetadata := fields["metadata"]; hasMetadata {
+			fields = nil
+			if err := json.Unmarshal(nested, &fields); err != nil {
+				return nil, errors.Wrap(err, "invalid KV secret")
+			}
+		}
+	}
+	if v.field != "" {
+		return fieldValue(fields, v.field)
+	}
+	if len(fields) != 1 {
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("the secret has the fields %s, select one with field", strings.Join(keys, ", "))
+	}
+	for key := range fields {
+		return fieldValue(fields, key)
+	}
+	return nil, nil
+}
+
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to find the Vault token, set VAULT_TOKEN")
+	}
+	token, err := ioutil.ReadFile(filepath.Join(home, ".vault-token"))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to find the Vault token, set VAULT_TOKEN or run vault login")
+	}
+	return strings.TrimSpace(string(token)), nil
+}
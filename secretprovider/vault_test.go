@@ -0,0 +1,74 @@
+package secretprovider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+func TestVault(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	t.Setenv("VAULT_NAMESPACE", "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/cloudflared":
+			_, _ = w.Write([]byte(`{"data": {"data": {"token": "abc", "cert": "pem"}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/cloudflared":
+			_, _ = w.Write([]byte(`{"data": {"token": "def"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		source   config.SecretSource
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "KV version 2 with field",
+			source:   config.SecretSource{Name: "secret/data/cloudflared", Field: "token"},
+			expected: "abc",
+		},
+		{
+			name:    "KV version 2 without field",
+			source:  config.SecretSource{Name: "secret/data/cloudflared"},
+			wantErr: true,
+		},
+		{
+			name:     "KV version 1 with a single key",
+			source:   config.SecretSource{Name: "/kv/cloudflared"},
+			expected: "def",
+		},
+		{
+			name:    "missing secret",
+			source:  config.SecretSource{Name: "secret/data/missing"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.source.Provider = "vault"
+			test.source.Address = server.URL + "/"
+			secret, err := Fetch(context.Background(), test.source)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(secret))
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package secretstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/cloudflare/cloudflared/secretprovider"
+)
+
+// Sources of the keys of sealed secrets
+const (
+	// KeySourcePassphrase derives the key from a passphrase with PBKDF2-SHA256
+	KeySourcePassphrase = "passphrase"
+	// KeySourceAWSKMS encrypts the key with a key of AWS KMS
+	KeySourceAWSKMS = "aws-kms"
+	// KeySourceTPM encrypts the key with the TPM of the host, with systemd-creds
+	KeySourceTPM = "tpm"
+)
+
+// Size of the AES-256 keys of sealed secrets
+const keySize = 32
+
+// Name bound to the keys encrypted with systemd-creds, so that they can't be used as other credentials of the host
+const systemdCredentialName = "cloudflared-secret-key"
+
+var (
+	// ErrPassphraseRequired is returned when opening a secret sealed with a passphrase without one
+	ErrPassphraseRequired = errors.New("the secret is encrypted with a passphrase")
+	// Iterations of PBKDF2 for new secrets, lowered in tests
+	passphraseIterations = 600000
+	// systemdCreds runs systemd-creds with stdin, replaced in tests
+	systemdCreds = func(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "systemd-creds", args...)
+		cmd.Stdin = bytes.NewReader(stdin)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, errors.Wrapf(err, "systemd-creds %s failed: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return stdout.Bytes(), nil
+	}
+)
+
+// SealOptions choose the key encrypting a secret
+type SealOptions struct {
+	// KeySource is the source of the key, one of the KeySource constants
+	KeySource string
+	// Passphrase the key is derived from with KeySourcePassphrase
+	Passphrase string
+	// KMSKeyID is the ID, ARN or alias of the AWS KMS key with KeySourceAWSKMS
+	KMSKeyID string
+	// KMSRegion is the region of the AWS KMS key, AWS_REGION if empty
+	KMSRegion string
+}
+
+// Envelope is a secret sealed with a key that's unlocked when the secret is opened, it's a JSON object when encoded
+type Envelope struct {
+	Encryption Encryption
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// Encryption describes how to unlock the key of an Envelope
+type Encryption struct {
+	KeySource string
+	// Salt and Iterations of PBKDF2 with KeySourcePassphrase
+	Salt       []byte `json:",omitempty"`
+	Iterations int    `json:",omitempty"`
+	// WrappedKey is the key encrypted with AWS KMS or the TPM
+	WrappedKey []byte `json:",omitempty"`
+	// KMSRegion is the region of the AWS KMS key
+	KMSRegion string `json:",omitempty"`
+}
+
+// IsSealed returns whether data is a secret sealed with Seal
+func IsSealed(data []byte) bool {
+	var envelope struct {
+		Encryption *Encryption
+	}
+	return json.Unmarshal(data, &envelope) == nil && envelope.Encryption != nil && envelope.Encryption.KeySource != ""
+}
+
+// Seal encrypts secret with AES-GCM, with a key unlocked as configured by options
+func Seal(ctx context.Context, secret []byte, options SealOptions) ([]byte, error) {
+	envelope := Envelope{Encryption: Encryption{KeySource: options.KeySource}}
+	key := make([]byte, keySize)
+	switch options.KeySource {
+	case KeySourcePassphrase:
+		if options.Passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		envelope.Encryption.Salt = make([]byte, 16)
+		if _, err := io.ReadFull(rand.Reader, envelope.Encryption.Salt); err != nil {
+			return nil, err
+		}
+		envelope.Encryption.Iterations = passphraseIterations
+		key = deriveKey(options.Passphrase, &envelope.Encryption)
+	case KeySourceAWSKMS:
+		if options.KMSKeyID == "" {
+			return nil, errors.New("the AWS KMS key is required")
+		}
+		kms, err := secretprovider.NewAWSKMS(options.KMSRegion, "")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		if envelope.Encryption.WrappedKey, err = kms.Encrypt(ctx, options.KMSKeyID, key); err != nil {
+			return nil, errors.Wrap(err, "failed to encrypt the key with AWS KMS")
+		}
+		envelope.Encryption.KMSRegion = options.KMSRegion
+	case KeySourceTPM:
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		wrappedKey, err := systemdCreds(ctx, key, "encrypt", "--with-key=tpm2", "--name="+systemdCredentialName, "-", "-")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encrypt the key with the TPM")
+		}
+		envelope.Encryption.WrappedKey = wrappedKey
+	default:
+		return nil, fmt.Errorf("unknown key source %q, expected %s, %s or %s", options.KeySource, KeySourcePassphrase, KeySourceAWSKMS, KeySourceTPM)
+	}
+
+	aead, additionalData, err := envelopeCipher(key, &envelope.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	envelope.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, envelope.Nonce); err != nil {
+		return nil, err
+	}
+	envelope.Ciphertext = aead.Seal(nil, envelope.Nonce, secret, additionalData)
+	return json.MarshalIndent(envelope, "", "  ")
+}
+
+// Open decrypts a secret sealed with Seal. passphrase is only needed for secrets sealed with a passphrase.
+func Open(ctx context.Context, data []byte, passphrase string) ([]byte, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, errors.Wrap(err, "invalid encrypted secret")
+	}
+	var key []byte
+	switch envelope.Encryption.KeySource {
+	case KeySourcePassphrase:
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		key = deriveKey(passphrase, &envelope.Encryption)
+	case KeySourceAWSKMS:
+		kms, err := secretprovider.NewAWSKMS(envelope.Encryption.KMSRegion, "")
+		if err != nil {
+			return nil, err
+		}
+		if key, err = kms.Decrypt(ctx, envelope.Encryption.WrappedKey); err != nil {
+			return nil, errors.Wrap(err, "failed to decrypt the key with AWS KMS")
+		}
+	case KeySourceTPM:
+		var err error
+		if key, err = systemdCreds(ctx, envelope.Encryption.WrappedKey, "decrypt", "--name="+systemdCredentialName, "-", "-"); err != nil {
+			return nil, errors.Wrap(err, "failed to decrypt the key with the TPM")
+		}
+	default:
+		return nil, fmt.Errorf("unknown key source %q", envelope.Encryption.KeySource)
+	}
+
+	aead, additionalData, err := envelopeCipher(key, &envelope.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid encrypted secret nonce")
+	}
+	secret, err := aead.Open(nil, envelope.Nonce, envelope.Ciphertext, additionalData)
+	if err != nil {
+		if envelope.Encryption.KeySource == KeySourcePassphrase {
+			return nil, errors.New("failed to decrypt the secret, the passphrase is wrong or the secret was modified")
+		}
+		return nil, errors.Wrap(err, "failed to decrypt the secret")
+	}
+	return secret, nil
+}
+
+func deriveKey(passphrase string, encryption *Encryption) []byte {
+	return pbkdf2.Key([]byte(passphrase), encryption.Salt, encryption.Iterations, keySize, sha256.New)
+}
+
+// envelopeCipher returns the cipher of key, and the additional data authenticating the encryption settings so that
+// they can't be tampered with, e.g. to lower the iterations of PBKDF2
+func envelopeCipher(key []byte, encryption *Encryption) (cipher.AEAD, []byte, error) {
+	if len(key) != keySize {
+		return nil, nil, errors.New("invalid key size")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	additionalData, err := json.Marshal(encryption)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, additionalData, nil
+}
@@ -0,0 +1,81 @@
+package secretstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var credentials = []byte(`{"AccountTag":"account","TunnelSecret":"c2VjcmV0","TunnelID":"c1744f8b-faa1-48a4-9e5c-02ac921467fa"}`)
+
+func TestSealWithPassphrase(t *testing.T) {
+	passphraseIterations = 1000
+	defer func() {
+		passphraseIterations = 600000
+	}()
+
+	sealed, err := Seal(context.Background(), credentials, SealOptions{KeySource: KeySourcePassphrase, Passphrase: "correct horse"})
+	require.NoError(t, err)
+	assert.True(t, IsSealed(sealed))
+	assert.False(t, IsSealed(credentials))
+	assert.NotContains(t, string(sealed), "account")
+
+	opened, err := Open(context.Background(), sealed, "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, credentials, opened)
+
+	_, err = Open(context.Background(), sealed, "")
+	assert.Equal(t, ErrPassphraseRequired, err)
+	_, err = Open(context.Background(), sealed, "wrong")
+	assert.Error(t, err)
+
+	// The encryption settings are authenticated
+	var envelope Envelope
+	require.NoError(t, json.Unmarshal(sealed, &envelope))
+	envelope.Encryption.Iterations = 1
+	tampered, err := json.Marshal(envelope)
+	require.NoError(t, err)
+	_, err = Open(context.Background(), tampered, "correct horse")
+	assert.Error(t, err)
+
+	_, err = Seal(context.Background(), credentials, SealOptions{KeySource: KeySourcePassphrase})
+	assert.Equal(t, ErrPassphraseRequired, err)
+}
+
+func TestSealWithTPM(t *testing.T) {
+	// Fake systemd-creds that "encrypts" by reversing the key
+	originalSystemdCreds := systemdCreds
+	systemdCreds = func(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+		assert.Contains(t, args, "--name="+systemdCredentialName)
+		reversed := make([]byte, len(stdin))
+		for i, b := range stdin {
+			reversed[len(stdin)-1-i] = b
+		}
+		return reversed, nil
+	}
+	defer func() {
+		systemdCreds = originalSystemdCreds
+	}()
+
+	sealed, err := Seal(context.Background(), credentials, SealOptions{KeySource: KeySourceTPM})
+	require.NoError(t, err)
+	var envelope Envelope
+	require.NoError(t, json.Unmarshal(sealed, &envelope))
+	assert.Len(t, envelope.Encryption.WrappedKey, keySize)
+	assert.False(t, bytes.Contains(envelope.Ciphertext, []byte("account")))
+
+	opened, err := Open(context.Background(), sealed, "")
+	require.NoError(t, err)
+	assert.Equal(t, credentials, opened)
+}
+
+func TestSealUnknownKeySource(t *testing.T) {
+	_, err := Seal(context.Background(), credentials, SealOptions{KeySource: "hsm"})
+	assert.Error(t, err)
+	_, err = Open(context.Background(), []byte(`{"Encryption": {"KeySource": "hsm"}}`), "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+//go:build darwin
+// +build darwin
+
+package secretstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Exit code of the security tool when an item isn't found
+const errSecItemNotFound = 44
+
+// keychain stores secrets in the login keychain of the user with the security tool
+type keychain struct{}
+
+func newKeyring(dir string) Store {
+	if _, err := exec.LookPath("security"); err != nil {
+		return nil
+	}
+	return keychain{}
+}
+
+// Get implements Store
+func (keychain) Get(name string) ([]byte, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	out, err := exec.Command("security", "find-generic-password", "-s", serviceName, "-a", name, "-w").Output()
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read secret from the keychain")
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+}
+
+// Set implements Store
+func (keychain) Set(name string, secret []byte) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	// Commands are read from stdin so that the secret doesn't show up in the arguments of the process
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		serviceName, name, base64.StdEncoding.EncodeToString(secret)))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil || stderr.Len() > 0 {
+		return errors.Errorf("failed to write secret to the keychain: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Delete implements Store
+func (keychain) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	err := exec.Command("security", "delete-generic-password", "-s", serviceName, "-a", name).Run()
+	if err != nil && !isNotFound(err) {
+		return errors.Wrap(err, "failed to delete secret from the keychain")
+	}
+	return nil
+}
+
+// Description implements Store
+func (keychain) Description() string {
+	return "the macOS keychain"
+}
+
+func isNotFound(err error) bool {
+	exitErr, ok := err.(*exec.ExitError)
+	return ok && exitErr.ExitCode() == errSecItemNotFound
+}
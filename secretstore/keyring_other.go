@@ -0,0 +1,8 @@
+//go:build !windows && !darwin && !linux && !netbsd && !freebsd && !openbsd
+// +build !windows,!darwin,!linux,!netbsd,!freebsd,!openbsd
+
+package secretstore
+
+func newKeyring(dir string) Store {
+	return nil
+}
@@ -0,0 +1,78 @@
+//go:build linux || freebsd || openbsd || netbsd
+// +build linux freebsd openbsd netbsd
+
+package secretstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// secretService stores secrets in the Secret Service of the desktop session, e.g. GNOME Keyring or KWallet, with the
+// secret-tool of libsecret
+type secretService struct{}
+
+func newKeyring(dir string) Store {
+	// Servers have no session bus to reach a Secret Service
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil
+	}
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil
+	}
+	return secretService{}
+}
+
+// Get implements Store
+func (secretService) Get(name string) ([]byte, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", serviceName, "account", name)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	// secret-tool exits with 1 without output when there's no such secret
+	if _, ok := err.(*exec.ExitError); ok && len(out) == 0 && stderr.Len() == 0 {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, errors.Errorf("failed to read secret from the Secret Service: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+}
+
+// Set implements Store
+func (secretService) Set(name string, secret []byte) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	cmd := exec.Command("secret-tool", "store", "--label", serviceName+" "+name, "service", serviceName, "account", name)
+	cmd.Stdin = strings.NewReader(base64.StdEncoding.EncodeToString(secret))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Errorf("failed to write secret to the Secret Service: %v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Delete implements Store
+func (secretService) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	// secret-tool exits with 1 when there's no such secret, which isn't an error here
+	out, err := exec.Command("secret-tool", "clear", "service", serviceName, "account", name).CombinedOutput()
+	if _, ok := err.(*exec.ExitError); err != nil && !(ok && len(out) == 0) {
+		return errors.Errorf("failed to delete secret from the Secret Service: %v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Description implements Store
+func (secretService) Description() string {
+	return "the Secret Service keyring"
+}
@@ -0,0 +1,116 @@
+//go:build windows
+// +build windows
+
+package secretstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+const dpapiFileSuffix = ".dpapi"
+
+// dpapiStore encrypts secrets with the Data Protection API, with a key bound to the Windows account of the user, in
+// files of a directory
+type dpapiStore struct {
+	dir string
+}
+
+func newKeyring(dir string) Store {
+	return &dpapiStore{dir: dir}
+}
+
+// Get implements Store
+func (s *dpapiStore) Get(name string) ([]byte, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	ciphertext, err := ioutil.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(newBlob(ciphertext), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt secret %s", name)
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return copyBlob(&out), nil
+}
+
+// Set implements Store
+func (s *dpapiStore) Set(name string, secret []byte) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(newBlob(secret), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return errors.Wrapf(err, "failed to encrypt secret %s", name)
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return writeFileAtomic(s.path(name), copyBlob(&out))
+}
+
+// Delete implements Store
+func (s *dpapiStore) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Description implements Store
+func (s *dpapiStore) Description() string {
+	return "files of " + s.dir + " encrypted with the Windows Data Protection API"
+}
+
+func (s *dpapiStore) path(name string) string {
+	return filepath.Join(s.dir, name+dpapiFileSuffix)
+}
+
+func newBlob(data []byte) *windows.DataBlob {
+	if len(data) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+}
+
+func copyBlob(blob *windows.DataBlob) []byte {
+	data := make([]byte, blob.Size)
+	copy(data, unsafe.Slice(blob.Data, blob.Size))
+	return data
+}
+
+// writeFileAtomic writes a file only readable by the user, without leaving it half written if interrupted
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,72 @@
+// Package secretstore keeps secrets such as Access tokens and origin certificates in the keyring of the OS, and seals
+// secrets with keys that aren't stored next to them.
+package secretstore
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+
+	"github.com/cloudflare/cloudflared/config"
+)
+
+// Name of the service secrets are stored under in keyrings
+const serviceName = "cloudflared"
+
+var (
+	// ErrNotFound is returned when there's no secret with a name
+	ErrNotFound = errors.New("secret not found")
+	// ErrNoKeyring is returned when the OS has no keyring to store secrets in, e.g. on servers without a desktop
+	// session. Secrets are then only protected by the permissions of their files.
+	ErrNoKeyring = errors.New("no keyring of the OS is available")
+)
+
+// Store keeps named secrets
+type Store interface {
+	// Get returns the secret with name, or ErrNotFound
+	Get(name string) ([]byte, error)
+	// Set creates or replaces the secret with name
+	Set(name string, secret []byte) error
+	// Delete removes the secret with name, if any
+	Delete(name string) error
+	// Description describes where secrets are stored, for users
+	Description() string
+}
+
+// New returns the keyring of the OS, with files in dir if the keyring needs any, or ErrNoKeyring
+func New(dir string) (Store, error) {
+	if keyring := newKeyring(dir); keyring != nil {
+		return keyring, nil
+	}
+	return nil, ErrNoKeyring
+}
+
+var (
+	defaultStore     Store
+	defaultStoreErr  error
+	defaultStoreOnce sync.Once
+)
+
+// Default returns the keyring of the user, with files in the default cloudflared directory of the user if needed, or
+// ErrNoKeyring
+func Default() (Store, error) {
+	defaultStoreOnce.Do(func() {
+		dir, err := homedir.Expand(config.DefaultConfigSearchDirectories()[0])
+		if err != nil {
+			defaultStoreErr = errors.Wrap(err, "failed to find the cloudflared directory")
+			return
+		}
+		defaultStore, defaultStoreErr = New(dir)
+	})
+	return defaultStore, defaultStoreErr
+}
+
+func validateName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid secret name %q", name)
+	}
+	return nil
+}
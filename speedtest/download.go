@@ -0,0 +1,225 @@
+package speedtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/quicvarint"
+	"github.com/pkg/errors"
+
+	"github.com/cloudflare/cloudflared/connection"
+)
+
+const (
+	h3ALPN = "h3"
+	// h3NoError is the H3_NO_ERROR code the connection is closed with
+	h3NoError = 0x100
+
+	h3StreamTypeControl = 0x00
+	h3FrameData         = 0x00
+	h3FrameHeaders      = 0x01
+	h3FrameSettings     = 0x04
+
+	// Indexes of the QPACK static table, see https://www.rfc-editor.org/rfc/rfc9204#appendix-A
+	qpackAuthority   = 0
+	qpackPath        = 1
+	qpackMethodGET   = 17
+	qpackSchemeHTTPS = 23
+)
+
+// download measures the throughput of a download of DownloadSize bytes over protocol. The time starts once the
+// connection is established, so it's only the time of the transfer.
+func download(ctx context.Context, protocol connection.Protocol, config *Config) Download {
+	result := Download{Protocol: protocol.String()}
+	downloadURL, err := url.Parse(config.DownloadURL)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	query := downloadURL.Query()
+	query.Set("bytes", strconv.FormatInt(config.DownloadSize, 10))
+	downloadURL.RawQuery = query.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+	var elapsed time.Duration
+	switch protocol {
+	case connection.QUIC:
+		result.Bytes, elapsed, err = downloadHTTP3(ctx, downloadURL, config.DownloadRootCAs)
+	default:
+		result.Colo, result.Bytes, elapsed, err = downloadHTTP2(ctx, downloadURL, config.DownloadRootCAs)
+	}
+	if err == nil && result.Bytes != config.DownloadSize {
+		err = fmt.Errorf("downloaded %d bytes instead of %d", result.Bytes, config.DownloadSize)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Seconds = elapsed.Seconds()
+	if result.Seconds > 0 {
+		result.Mbps = float64(result.Bytes) * 8 / result.Seconds / 1e6
+	}
+	return result
+}
+
+func downloadHTTP2(ctx context.Context, downloadURL *url.URL, rootCAs *x509.CertPool) (colo string, received int64, elapsed time.Duration, err error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: rootCAs},
+			ForceAttemptHTTP2: true,
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	var start time.Time
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) {
+			start = time.Now()
+		},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL.String(), nil)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		return "", 0, 0, fmt.Errorf("the download was over %s instead of HTTP/2", resp.Proto)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, 0, fmt.Errorf("the download failed with status %s", resp.Status)
+	}
+	received, err = io.Copy(ioutil.Discard, resp.Body)
+	return responseColo(resp.Header), received, time.Since(start), err
+}
+
+// responseColo returns the colo that served a response, from its cf-meta-colo header or the suffix of its cf-ray
+func responseColo(header http.Header) string {
+	if colo := header.Get("cf-meta-colo"); colo != "" {
+		return colo
+	}
+	if i := strings.LastIndex(header.Get("cf-ray"), "-"); i >= 0 {
+		return header.Get("cf-ray")[i+1:]
+	}
+	return ""
+}
+
+// downloadHTTP3 downloads over HTTP/3 with a minimal client: it only sends GET requests, and counts the bytes of the
+// body without decoding the headers of the response.
+func downloadHTTP3(ctx context.Context, downloadURL *url.URL, rootCAs *x509.CertPool) (received int64, elapsed time.Duration, err error) {
+	address := downloadURL.Host
+	if downloadURL.Port() == "" {
+		address = net.JoinHostPort(downloadURL.Hostname(), "443")
+	}
+	tlsConfig := &tls.Config{
+		ServerName: downloadURL.Hostname(),
+		RootCAs:    rootCAs,
+		NextProtos: []string{h3ALPN},
+	}
+	conn, err := quic.DialAddrContext(ctx, address, tlsConfig, &quic.Config{HandshakeIdleTimeout: timeUntilDeadline(ctx)})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.CloseWithError(h3NoError, "")
+	start := time.Now()
+
+	// The control stream starts with its type and the settings of the client, which are all defaults
+	control, err := conn.OpenUniStream()
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := control.Write([]byte{h3StreamTypeControl, h3FrameSettings, 0}); err != nil {
+		return 0, 0, err
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+	headers := qpackRequestHeaders(downloadURL)
+	var request bytes.Buffer
+	quicvarint.Write(&request, h3FrameHeaders)
+	quicvarint.Write(&request, uint64(len(headers)))
+	request.Write(headers)
+	if _, err := stream.Write(request.Bytes()); err != nil {
+		return 0, 0, err
+	}
+	_ = stream.Close()
+
+	reader := bufio.NewReader(stream)
+	for {
+		frameType, err := quicvarint.Read(reader)
+		if err == io.EOF {
+			return received, time.Since(start), nil
+		}
+		if err != nil {
+			return received, 0, err
+		}
+		length, err := quicvarint.Read(reader)
+		if err != nil {
+			return received, 0, errors.Wrap(err, "failed to read the length of an HTTP/3 frame")
+		}
+		n, err := io.CopyN(ioutil.Discard, reader, int64(length))
+		if frameType == h3FrameData {
+			received += n
+		}
+		if err != nil {
+			return received, 0, err
+		}
+	}
+}
+
+// qpackRequestHeaders encodes the headers of a GET request of u, without the dynamic table
+func qpackRequestHeaders(u *url.URL) []byte {
+	// The Required Insert Count and the Delta Base are 0 without the dynamic table
+	b := []byte{0, 0}
+	b = appendQPACKInt(b, 0xc0, 6, qpackMethodGET)
+	b = appendQPACKInt(b, 0xc0, 6, qpackSchemeHTTPS)
+	b = appendQPACKLiteral(b, qpackAuthority, u.Host)
+	b = appendQPACKLiteral(b, qpackPath, u.RequestURI())
+	return b
+}
+
+// appendQPACKLiteral appends a literal field line with a reference to the name of a static table entry
+func appendQPACKLiteral(b []byte, nameIndex uint64, value string) []byte {
+	b = appendQPACKInt(b, 0x50, 4, nameIndex)
+	// The value isn't Huffman encoded
+	b = appendQPACKInt(b, 0, 7, uint64(len(value)))
+	return append(b, value...)
+}
+
+// appendQPACKInt appends i as an integer with a prefix of prefixBits, the bits above it in the first byte being flags
+func appendQPACKInt(b []byte, flags byte, prefixBits uint, i uint64) []byte {
+	max := uint64(1)<<prefixBits - 1
+	if i < max {
+		return append(b, flags|byte(i))
+	}
+	b = append(b, flags|byte(max))
+	i -= max
+	for i >= 0x80 {
+		b = append(b, byte(i&0x7f)|0x80)
+		i >>= 7
+	}
+	return append(b, byte(i))
+}
@@ -0,0 +1,359 @@
+// Package speedtest measures the round trip time and loss of the paths to the Cloudflare edge over QUIC and HTTP/2,
+// and the throughput of downloads from the nearest colo over both, to help choose the protocol and region of tunnels.
+package speedtest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/edgediscovery/allregions"
+)
+
+const (
+	// DefaultDownloadURL serves downloads of the size of its bytes parameter from the nearest colo
+	DefaultDownloadURL = "https://speed.cloudflare.com/__down"
+
+	// downloadTimeout bounds each download, whatever the timeout of probes
+	downloadTimeout = time.Minute
+)
+
+// Protocols are the protocols compared, in the order of the report
+var Protocols = []connection.Protocol{connection.QUIC, connection.HTTP2}
+
+// discoverRegions is overridden in tests
+var discoverRegions = allregions.DiscoverRegions
+
+// Config is what to measure
+type Config struct {
+	// Regions are the values of --region to compare, "" being the global region
+	Regions   []string
+	IPVersion allregions.ConfigIPVersion
+	// AddrsPerRegion is how many addresses of each region of the edge are probed
+	AddrsPerRegion int
+	// Probes is how many handshakes are made with each address over each protocol
+	Probes int
+	// Timeout is the time a handshake has to complete before it's counted as lost
+	Timeout time.Duration
+	// TLSConfigs are the TLS configurations of the connections to the edge by protocol
+	TLSConfigs map[connection.Protocol]*tls.Config
+
+	// DownloadURL is downloaded to measure the throughput, with the size of the download as its bytes parameter
+	DownloadURL string
+	// DownloadSize is the size in bytes of the downloads, they're skipped if it's 0
+	DownloadSize int64
+	// DownloadRootCAs are trusted by downloads instead of the system's, if they're not nil
+	DownloadRootCAs *x509.CertPool
+}
+
+func (c *Config) validate() error {
+	if len(c.Regions) == 0 {
+		return fmt.Errorf("there must be at least one region")
+	}
+	if c.AddrsPerRegion <= 0 || c.Probes <= 0 {
+		return fmt.Errorf("the number of addresses per region and of probes must be positive")
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("the timeout must be positive")
+	}
+	if c.DownloadSize < 0 {
+		return fmt.Errorf("the download size can't be negative")
+	}
+	for _, protocol := range Protocols {
+		if c.TLSConfigs[protocol] == nil {
+			return fmt.Errorf("there's no TLS configuration for %s", protocol)
+		}
+	}
+	return nil
+}
+
+// Report is the result of a speed test
+type Report struct {
+	Paths     []Path     `json:"paths"`
+	Downloads []Download `json:"downloads,omitempty"`
+	// Suggestion is nil if no path to the edge could be measured
+	Suggestion *Suggestion `json:"suggestion,omitempty"`
+}
+
+// Path is the quality of the path to an address of the edge over a protocol
+type Path struct {
+	// Region is the value of --region, "" being the global region
+	Region string `json:"region"`
+	// EdgeRegion is the region of the edge the address is in
+	EdgeRegion  string  `json:"edgeRegion"`
+	Address     string  `json:"address"`
+	Protocol    string  `json:"protocol"`
+	Probes      int     `json:"probes"`
+	Lost        int     `json:"lost"`
+	LossPercent float64 `json:"lossPercent"`
+	// RTT is the round trip time of the handshakes that weren't lost
+	RTT RTT `json:"rttMs"`
+	// Error is the error of the last handshake that was lost
+	Error string `json:"error,omitempty"`
+}
+
+// RTT is in milliseconds
+type RTT struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+}
+
+// Download is the throughput of a download from the nearest colo over a protocol
+type Download struct {
+	Protocol string `json:"protocol"`
+	// Colo is the colo that served the download, if it's known
+	Colo    string  `json:"colo,omitempty"`
+	Bytes   int64   `json:"bytes"`
+	Seconds float64 `json:"seconds"`
+	Mbps    float64 `json:"mbps"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Suggestion is the protocol and region with the least loss, then the lowest round trip time
+type Suggestion struct {
+	Protocol string `json:"protocol"`
+	// Region is the value of --region, "" being the global region
+	Region      string  `json:"region"`
+	LossPercent float64 `json:"lossPercent"`
+	AvgRTT      float64 `json:"avgRttMs"`
+}
+
+// probeFunc makes a handshake with an address of the edge and returns the round trip time it measured
+type probeFunc func(ctx context.Context, addr *allregions.EdgeAddr, tlsConfig *tls.Config) (time.Duration, error)
+
+var probes = map[connection.Protocol]probeFunc{
+	connection.QUIC:  probeQUIC,
+	connection.HTTP2: probeHTTP2,
+}
+
+type target struct {
+	region     string
+	edgeRegion string
+	addr       *allregions.EdgeAddr
+	protocol   connection.Protocol
+}
+
+// Run probes the addresses of the edge of each region over each protocol, then downloads from the nearest colo over
+// each protocol, until it's done or ctx is.
+func Run(ctx context.Context, config Config, log *zerolog.Logger) (*Report, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	var targets []target
+	for _, region := range config.Regions {
+		regionAddrs, err := discoverRegions(log, region, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to discover the edge addresses of the %s region", RegionName(region))
+		}
+		for i, addrs := range regionAddrs {
+			for _, addr := range selectAddrs(addrs, config.IPVersion, config.AddrsPerRegion) {
+				for _, protocol := range Protocols {
+					targets = append(targets, target{
+						region:     region,
+						edgeRegion: fmt.Sprintf("region%d", i+1),
+						addr:       addr,
+						protocol:   protocol,
+					})
+				}
+			}
+		}
+	}
+
+	// Paths are probed concurrently, so addresses that time out don't hold the others back
+	report := &Report{Paths: make([]Path, len(targets))}
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			report.Paths[i] = probePath(ctx, t, &config)
+		}(i, t)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	report.Suggestion = suggest(report.Paths)
+
+	// Downloads are sequential, so they don't compete for bandwidth
+	if config.DownloadSize > 0 {
+		for _, protocol := range Protocols {
+			report.Downloads = append(report.Downloads, download(ctx, protocol, &config))
+		}
+	}
+	return report, nil
+}
+
+// RegionName is how region is shown
+func RegionName(region string) string {
+	if region == "" {
+		return "global"
+	}
+	return region
+}
+
+// selectAddrs selects up to limit addresses of the IP version, the system preference being the version of the first
+// address with Auto
+func selectAddrs(addrs []*allregions.EdgeAddr, ipVersion allregions.ConfigIPVersion, limit int) []*allregions.EdgeAddr {
+	version := allregions.V4
+	switch ipVersion {
+	case allregions.IPv6Only:
+		version = allregions.V6
+	case allregions.Auto:
+		if len(addrs) > 0 {
+			version = addrs[0].IPVersion
+		}
+	}
+	var selected []*allregions.EdgeAddr
+	for _, addr := range addrs {
+		if addr.IPVersion == version && len(selected) < limit {
+			selected = append(selected, addr)
+		}
+	}
+	return selected
+}
+
+func probePath(ctx context.Context, t target, config *Config) Path {
+	path := Path{
+		Region:     t.region,
+		EdgeRegion: t.edgeRegion,
+		Address:    t.addr.TCP.IP.String(),
+		Protocol:   t.protocol.String(),
+		Probes:     config.Probes,
+	}
+	var rtts []time.Duration
+	for i := 0; i < config.Probes && ctx.Err() == nil; i++ {
+		probeCtx, cancel := context.WithTimeout(ctx, config.Timeout)
+		rtt, err := probes[t.protocol](probeCtx, t.addr, config.TLSConfigs[t.protocol])
+		cancel()
+		if err != nil {
+			path.Lost++
+			path.Error = err.Error()
+			continue
+		}
+		rtts = append(rtts, rtt)
+	}
+	path.LossPercent = float64(path.Lost) / float64(path.Probes) * 100
+	path.RTT = rttStats(rtts)
+	return path
+}
+
+func rttStats(rtts []time.Duration) RTT {
+	if len(rtts) == 0 {
+		return RTT{}
+	}
+	sort.Slice(rtts, func(i, j int) bool {
+		return rtts[i] < rtts[j]
+	})
+	var sum time.Duration
+	for _, rtt := range rtts {
+		sum += rtt
+	}
+	return RTT{
+		Min: milliseconds(rtts[0]),
+		Avg: milliseconds(sum / time.Duration(len(rtts))),
+		Max: milliseconds(rtts[len(rtts)-1]),
+	}
+}
+
+// probeQUIC measures the QUIC handshake, which takes a round trip
+func probeQUIC(ctx context.Context, addr *allregions.EdgeAddr, tlsConfig *tls.Config) (time.Duration, error) {
+	start := time.Now()
+	conn, err := quic.DialAddrContext(ctx, addr.UDP.String(), tlsConfig, &quic.Config{
+		HandshakeIdleTimeout: timeUntilDeadline(ctx),
+	})
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	_ = conn.CloseWithError(0, "")
+	return rtt, nil
+}
+
+// probeHTTP2 measures the TCP handshake, which takes a round trip, then checks the TLS handshake of HTTP/2 connections
+// completes
+func probeHTTP2(ctx context.Context, addr *allregions.EdgeAddr, tlsConfig *tls.Config) (time.Duration, error) {
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", addr.TCP.String())
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	defer conn.Close()
+	if err := tls.Client(conn, tlsConfig).HandshakeContext(ctx); err != nil {
+		return 0, errors.Wrap(err, "TLS handshake with edge error")
+	}
+	return rtt, nil
+}
+
+func timeUntilDeadline(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return 0
+}
+
+// suggest picks the protocol and region with the least loss, then the lowest average round trip time
+func suggest(paths []Path) *Suggestion {
+	type key struct {
+		protocol string
+		region   string
+	}
+	type total struct {
+		probes, lost int
+		rttSum       float64
+		measured     int
+	}
+	totals := make(map[key]*total)
+	var keys []key
+	for _, path := range paths {
+		k := key{protocol: path.Protocol, region: path.Region}
+		t, ok := totals[k]
+		if !ok {
+			t = &total{}
+			totals[k] = t
+			keys = append(keys, k)
+		}
+		t.probes += path.Probes
+		t.lost += path.Lost
+		if path.Lost < path.Probes {
+			t.rttSum += path.RTT.Avg
+			t.measured++
+		}
+	}
+
+	var best *Suggestion
+	for _, k := range keys {
+		t := totals[k]
+		if t.measured == 0 {
+			continue
+		}
+		candidate := &Suggestion{
+			Protocol:    k.protocol,
+			Region:      k.region,
+			LossPercent: float64(t.lost) / float64(t.probes) * 100,
+			AvgRTT:      t.rttSum / float64(t.measured),
+		}
+		if best == nil || candidate.LossPercent < best.LossPercent ||
+			(candidate.LossPercent == best.LossPercent && candidate.AvgRTT < best.AvgRTT) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,244 @@
+package speedtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/quicvarint"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/edgediscovery/allregions"
+)
+
+func TestRun(t *testing.T) {
+	cert, rootCAs := generateCertificate(t)
+	const downloadSize = 100000
+
+	// The download server serves HTTP/2 over TCP, and HTTP/3 over QUIC on the same port
+	downloadServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, err := strconv.Atoi(r.URL.Query().Get("bytes"))
+		require.NoError(t, err)
+		w.Header().Set("cf-ray", "7a1b2c3d4e5f6a7b-SJC")
+		_, _ = w.Write(make([]byte, size))
+	}))
+	downloadServer.EnableHTTP2 = true
+	downloadServer.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	downloadServer.StartTLS()
+	defer downloadServer.Close()
+	downloadAddr := downloadServer.Listener.Addr().(*net.TCPAddr)
+	quicListener, err := quic.ListenAddr(downloadAddr.String(), &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"argotunnel", h3ALPN},
+	}, nil)
+	require.NoError(t, err)
+	defer quicListener.Close()
+	go serveQUIC(t, quicListener)
+
+	// The edge is the same listeners in the first region, and closed ports in the second
+	edgeTCP, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	defer edgeTCP.Close()
+	go func() {
+		for {
+			conn, err := edgeTCP.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = conn.(*tls.Conn).Handshake()
+				_ = conn.Close()
+			}()
+		}
+	}()
+	reachable := &allregions.EdgeAddr{
+		TCP:       edgeTCP.Addr().(*net.TCPAddr),
+		UDP:       quicListener.Addr().(*net.UDPAddr),
+		IPVersion: allregions.V4,
+	}
+	closed := &allregions.EdgeAddr{
+		TCP:       &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1},
+		UDP:       &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1},
+		IPVersion: allregions.V4,
+	}
+	ipv6 := &allregions.EdgeAddr{
+		TCP:       &net.TCPAddr{IP: net.IPv6loopback, Port: 1},
+		UDP:       &net.UDPAddr{IP: net.IPv6loopback, Port: 1},
+		IPVersion: allregions.V6,
+	}
+	discoverRegions = func(log *zerolog.Logger, region string, resolvers []allregions.Resolver) ([][]*allregions.EdgeAddr, error) {
+		if region != "" {
+			return nil, fmt.Errorf("no region %s", region)
+		}
+		return [][]*allregions.EdgeAddr{{reachable, ipv6}, {closed}}, nil
+	}
+	defer func() { discoverRegions = allregions.DiscoverRegions }()
+
+	config := Config{
+		Regions:        []string{""},
+		IPVersion:      allregions.IPv4Only,
+		AddrsPerRegion: 2,
+		Probes:         3,
+		Timeout:        500 * time.Millisecond,
+		TLSConfigs: map[connection.Protocol]*tls.Config{
+			connection.QUIC:  {RootCAs: rootCAs, ServerName: "localhost", NextProtos: []string{"argotunnel"}},
+			connection.HTTP2: {RootCAs: rootCAs, ServerName: "localhost"},
+		},
+		DownloadURL:     downloadServer.URL + "/__down",
+		DownloadSize:    downloadSize,
+		DownloadRootCAs: rootCAs,
+	}
+	log := zerolog.Nop()
+	report, err := Run(context.Background(), config, &log)
+	require.NoError(t, err)
+
+	require.Len(t, report.Paths, 4)
+	for _, path := range report.Paths[:2] {
+		assert.Equal(t, "region1", path.EdgeRegion)
+		assert.Equal(t, "127.0.0.1", path.Address)
+		assert.Equal(t, 0, path.Lost, path.Error)
+		assert.Greater(t, path.RTT.Avg, 0.0)
+	}
+	for _, path := range report.Paths[2:] {
+		assert.Equal(t, "region2", path.EdgeRegion)
+		assert.Equal(t, 3, path.Lost)
+		assert.Equal(t, 100.0, path.LossPercent)
+		assert.NotEmpty(t, path.Error)
+	}
+	assert.Equal(t, "quic", report.Paths[0].Protocol)
+	assert.Equal(t, "http2", report.Paths[1].Protocol)
+
+	require.NotNil(t, report.Suggestion)
+	assert.Equal(t, "", report.Suggestion.Region)
+	assert.Equal(t, 50.0, report.Suggestion.LossPercent)
+
+	require.Len(t, report.Downloads, 2)
+	for _, download := range report.Downloads {
+		assert.Empty(t, download.Error)
+		assert.Equal(t, int64(downloadSize), download.Bytes)
+		assert.Greater(t, download.Mbps, 0.0)
+	}
+	assert.Equal(t, "quic", report.Downloads[0].Protocol)
+	assert.Equal(t, "http2", report.Downloads[1].Protocol)
+	assert.Equal(t, "SJC", report.Downloads[1].Colo)
+
+	config.Regions = []string{"", "us"}
+	_, err = Run(context.Background(), config, &log)
+	assert.Error(t, err)
+}
+
+func TestSuggest(t *testing.T) {
+	paths := []Path{
+		{Region: "", Protocol: "quic", Probes: 2, Lost: 1, RTT: RTT{Avg: 10}},
+		{Region: "", Protocol: "http2", Probes: 2, Lost: 0, RTT: RTT{Avg: 30}},
+		{Region: "us", Protocol: "http2", Probes: 2, Lost: 0, RTT: RTT{Avg: 20}},
+		{Region: "us", Protocol: "quic", Probes: 2, Lost: 2},
+	}
+	assert.Equal(t, &Suggestion{Protocol: "http2", Region: "us", AvgRTT: 20}, suggest(paths))
+	assert.Nil(t, suggest(paths[3:]))
+}
+
+func TestQPACKRequestHeaders(t *testing.T) {
+	u, err := url.Parse("https://speed.cloudflare.com/__down?bytes=100")
+	require.NoError(t, err)
+	expected := []byte{0, 0, 0xd1, 0xd7, 0x50, 20}
+	expected = append(expected, "speed.cloudflare.com"...)
+	expected = append(expected, 0x51, 17)
+	expected = append(expected, "/__down?bytes=100"...)
+	assert.Equal(t, expected, qpackRequestHeaders(u))
+
+	assert.Equal(t, []byte{0x0f, 0x10}, appendQPACKInt(nil, 0, 4, 31))
+	assert.Equal(t, []byte{0x7f, 0x81, 0x01}, appendQPACKInt(nil, 0, 7, 256))
+}
+
+// serveQUIC accepts the connections of probes, and serves downloads of HTTP/3 connections
+func serveQUIC(t *testing.T, listener quic.Listener) {
+	for {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		if conn.ConnectionState().TLS.NegotiatedProtocol != h3ALPN {
+			continue
+		}
+		go func() {
+			stream, err := conn.AcceptStream(context.Background())
+			if err != nil {
+				return
+			}
+			defer stream.Close()
+			reader := bufio.NewReader(stream)
+			frameType, err := quicvarint.Read(reader)
+			require.NoError(t, err)
+			require.Equal(t, uint64(h3FrameHeaders), frameType)
+			length, err := quicvarint.Read(reader)
+			require.NoError(t, err)
+			headers := make([]byte, length)
+			_, err = io.ReadFull(reader, headers)
+			require.NoError(t, err)
+			require.True(t, bytes.Contains(headers, []byte("/__down?bytes=")))
+			size, err := strconv.Atoi(string(headers[bytes.LastIndexByte(headers, '=')+1:]))
+			require.NoError(t, err)
+
+			var response bytes.Buffer
+			// :status 200 is the 25th entry of the static table
+			quicvarint.Write(&response, h3FrameHeaders)
+			quicvarint.Write(&response, 3)
+			response.Write([]byte{0, 0, 0xd9})
+			for size > 0 {
+				chunk := 16384
+				if size < chunk {
+					chunk = size
+				}
+				quicvarint.Write(&response, h3FrameData)
+				quicvarint.Write(&response, uint64(chunk))
+				response.Write(make([]byte, chunk))
+				size -= chunk
+			}
+			_, _ = stream.Write(response.Bytes())
+		}()
+	}
+}
+
+func generateCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
@@ -0,0 +1,149 @@
+package sshgen
+
+import (
+	"io/ioutil"
+	"net/url"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	cfpath "github.com/cloudflare/cloudflared/token"
+)
+
+// minRenewInterval keeps renewals from hammering the sign endpoint when certificates are issued already expired, e.g.
+// because of clock skew
+const minRenewInterval = 10 * time.Second
+
+// ReadShortLivedCertificate reads the short lived certificate stored for appURL
+func ReadShortLivedCertificate(appURL *url.URL) (*gossh.Certificate, error) {
+	fullName, err := cfpath.GenerateSSHCertFilePathFromURL(appURL, keyName)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readKey(fullName + "-cert.pub")
+	if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := gossh.ParseAuthorizedKey(content)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse short lived certificate")
+	}
+	cert, ok := pub.(*gossh.Certificate)
+	if !ok {
+		return nil, errors.New("short lived certificate file doesn't contain a certificate")
+	}
+	return cert, nil
+}
+
+// AddShortLivedCertificateToAgent adds the key and short lived certificate stored for appURL to sshAgent, until the
+// certificate expires
+func AddShortLivedCertificateToAgent(appURL *url.URL, sshAgent agent.Agent) error {
+	fullName, err := cfpath.GenerateSSHCertFilePathFromURL(appURL, keyName)
+	if err != nil {
+		return err
+	}
+	cert, err := ReadShortLivedCertificate(appURL)
+	if err != nil {
+		return err
+	}
+	content, err := readKey(fullName)
+	if err != nil {
+		return err
+	}
+	key, err := gossh.ParseRawPrivateKey(content)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse short lived certificate key")
+	}
+
+	addedKey := agent.AddedKey{
+		PrivateKey:  key,
+		Certificate: cert,
+		Comment:     "cloudflared " + appURL.Hostname(),
+	}
+	if cert.ValidBefore != gossh.CertTimeInfinity {
+		lifetime := time.Until(certificateExpiry(cert))
+		if lifetime <= 0 {
+			return errors.New("short lived certificate has expired")
+		}
+		// Rounded up as a lifetime of 0 means the key never expires
+		addedKey.LifetimeSecs = uint32(lifetime/time.Second) + 1
+	}
+	return sshAgent.Add(addedKey)
+}
+
+// RenewShortLivedCertificate signs a new short lived certificate for appURL each time the current one reaches two
+// thirds of its lifetime, with the Access token returned by getToken, until shutdownC is closed. onRenew is called
+// after each renewal, e.g. to add the certificate to an SSH agent.
+func RenewShortLivedCertificate(
+	appURL *url.URL,
+	getToken func() (string, error),
+	onRenew func() error,
+	shutdownC <-chan struct{},
+	log *zerolog.Logger,
+) error {
+	for {
+		wait := minRenewInterval
+		if cert, err := ReadShortLivedCertificate(appURL); err == nil {
+			wait = renewInterval(cert, time.Now())
+			log.Debug().Time("expiry", certificateExpiry(cert)).Dur("renewIn", wait).Msg("Waiting to renew short lived certificate")
+		} else {
+			log.Err(err).Msg("Failed to read short lived certificate")
+		}
+
+		select {
+		case <-shutdownC:
+			return nil
+		case <-time.After(wait):
+		}
+
+		token, err := getToken()
+		if err != nil {
+			log.Err(err).Msg("Failed to get Access token to renew short lived certificate")
+			continue
+		}
+		if err := GenerateShortLivedCertificate(appURL, token); err != nil {
+			log.Err(err).Msg("Failed to renew short lived certificate")
+			continue
+		}
+		log.Info().Str("hostname", appURL.Hostname()).Msg("Renewed short lived certificate")
+		if onRenew != nil {
+			if err := onRenew(); err != nil {
+				log.Err(err).Msg("Failed to use renewed short lived certificate")
+			}
+		}
+	}
+}
+
+// renewInterval returns how long to wait before renewing cert, once two thirds of its lifetime have elapsed
+func renewInterval(cert *gossh.Certificate, now time.Time) time.Duration {
+	validAfter := time.Unix(int64(cert.ValidAfter), 0)
+	// Certificates valid since forever are renewed two thirds of the way to their expiry from now
+	if cert.ValidAfter == 0 {
+		validAfter = now
+	}
+	lifetime := certificateExpiry(cert).Sub(validAfter)
+	wait := validAfter.Add(lifetime / 3 * 2).Sub(now)
+	if wait < minRenewInterval {
+		return minRenewInterval
+	}
+	return wait
+}
+
+func certificateExpiry(cert *gossh.Certificate) time.Time {
+	if cert.ValidBefore == gossh.CertTimeInfinity {
+		return time.Unix(1<<62, 0)
+	}
+	return time.Unix(int64(cert.ValidBefore), 0)
+}
+
+func readKey(filename string) ([]byte, error) {
+	filepath, err := homedir.Expand(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filepath)
+}
@@ -4,6 +4,8 @@
 package sshgen
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,6 +19,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 	"gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/jwt"
 
@@ -118,3 +122,57 @@ func tokenGenerator() string {
 
 	return signedToken
 }
+
+func TestRenewInterval(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	cert := &gossh.Certificate{ValidAfter: uint64(now.Unix() - 60), ValidBefore: uint64(now.Unix() + 120)}
+	assert.Equal(t, time.Minute, renewInterval(cert, now))
+
+	// Certificates past two thirds of their lifetime are renewed soon, but not in a loop
+	cert = &gossh.Certificate{ValidAfter: uint64(now.Unix() - 150), ValidBefore: uint64(now.Unix() + 30)}
+	assert.Equal(t, minRenewInterval, renewInterval(cert, now))
+
+	cert = &gossh.Certificate{ValidBefore: uint64(now.Unix() + 180)}
+	assert.Equal(t, 2*time.Minute, renewInterval(cert, now))
+}
+
+func TestAddShortLivedCertificateToAgent(t *testing.T) {
+	appURL, _ := url.Parse("https://cf-test-agent.com")
+	fullName, err := cfpath.GenerateSSHCertFilePathFromURL(appURL, keyName)
+	assert.NoError(t, err)
+	defer func() {
+		os.Remove(fullName)
+		os.Remove(fullName + ".pub")
+		os.Remove(fullName + "-cert.pub")
+	}()
+
+	pub, err := generateKeyPair(fullName)
+	assert.NoError(t, err)
+	userKey, _, _, _, err := gossh.ParseAuthorizedKey(pub)
+	assert.NoError(t, err)
+
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	caSigner, err := gossh.NewSignerFromKey(caKey)
+	assert.NoError(t, err)
+	cert := &gossh.Certificate{
+		Key:             userKey,
+		CertType:        gossh.UserCert,
+		ValidPrincipals: []string{"user"},
+		ValidAfter:      uint64(time.Now().Unix()),
+		ValidBefore:     uint64(time.Now().Add(3 * time.Minute).Unix()),
+	}
+	assert.NoError(t, cert.SignCert(rand.Reader, caSigner))
+	assert.NoError(t, writeKey(fullName+"-cert.pub", gossh.MarshalAuthorizedKey(cert)))
+
+	stored, err := ReadShortLivedCertificate(appURL)
+	assert.NoError(t, err)
+	assert.Equal(t, cert.ValidBefore, stored.ValidBefore)
+
+	keyring := agent.NewKeyring()
+	assert.NoError(t, AddShortLivedCertificateToAgent(appURL, keyring))
+	keys, err := keyring.List()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, gossh.MarshalAuthorizedKey(cert), gossh.MarshalAuthorizedKey(keys[0]))
+}
@@ -0,0 +1,71 @@
+package stress
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// maxDatagramSize is the size of the largest UDP payload
+const maxDatagramSize = 65507
+
+// ServeEcho serves TCP and UDP echo servers at address, to be the origin of the load of Run with TCP and UDP, until
+// ctx is done.
+func ServeEcho(ctx context.Context, address string, log *zerolog.Logger) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	// The UDP echo server is on the same port, which may have been picked by the TCP listener
+	packetConn, err := net.ListenPacket("udp", listener.Addr().String())
+	if err != nil {
+		_ = listener.Close()
+		return err
+	}
+	log.Info().Msgf("Echoing TCP and UDP at %s", listener.Addr())
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+		_ = packetConn.Close()
+	}()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		echoDatagrams(packetConn)
+	}()
+	err = echoConnections(listener)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func echoConnections(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			_, _ = io.Copy(conn, conn)
+		}()
+	}
+}
+
+func echoDatagrams(conn net.PacketConn) {
+	buffer := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		_, _ = conn.WriteTo(buffer[:n], addr)
+	}
+}
@@ -0,0 +1,365 @@
+// Package stress generates HTTP, TCP or UDP load through a tunnel and measures its throughput and latency.
+package stress
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	HTTP = "http"
+	TCP  = "tcp"
+	UDP  = "udp"
+
+	// maxErrorMessages is how many distinct error messages a report keeps
+	maxErrorMessages = 10
+)
+
+// Config is the load to generate
+type Config struct {
+	// Protocol is HTTP, TCP or UDP
+	Protocol string
+	// Target is a URL with HTTP, and the address of an echo server otherwise
+	Target string
+	// Concurrency is how many requests are in flight at once
+	Concurrency int
+	// Duration bounds how long the load is generated
+	Duration time.Duration
+	// Requests bounds how many requests are sent, there's no bound if it's 0
+	Requests int64
+	// PayloadSize is the size of the body of HTTP requests, and of the messages sent to echo servers
+	PayloadSize int
+	// Method is the method of HTTP requests
+	Method  string
+	Timeout time.Duration
+}
+
+func (c *Config) validate() error {
+	switch c.Protocol {
+	case HTTP:
+	case TCP, UDP:
+		if c.PayloadSize <= 0 {
+			return fmt.Errorf("the payload size must be positive with %s", c.Protocol)
+		}
+		if _, _, err := net.SplitHostPort(c.Target); err != nil {
+			return fmt.Errorf("%s target %s must be an address host:port", c.Protocol, c.Target)
+		}
+	default:
+		return fmt.Errorf("%s isn't a protocol, it must be one of %s, %s or %s", c.Protocol, HTTP, TCP, UDP)
+	}
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("the concurrency must be positive")
+	}
+	if c.Duration <= 0 && c.Requests <= 0 {
+		return fmt.Errorf("either the duration or the number of requests must be positive")
+	}
+	return nil
+}
+
+// Report is the result of generating load
+type Report struct {
+	Protocol string `json:"protocol"`
+	Target   string `json:"target"`
+	// Requests counts requests, or round trips of messages to echo servers, including the failed ones
+	Requests int64   `json:"requests"`
+	Errors   int64   `json:"errors"`
+	Seconds  float64 `json:"seconds"`
+	// RequestsPerSecond counts the successful requests
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	BytesSent         int64   `json:"bytesSent"`
+	BytesReceived     int64   `json:"bytesReceived"`
+	// Latency is in milliseconds, of the successful requests
+	Latency Latency `json:"latencyMs"`
+	// StatusCodes counts the responses to HTTP requests by status code
+	StatusCodes map[int]int64 `json:"statusCodes,omitempty"`
+	// ErrorMessages counts the errors by message
+	ErrorMessages map[string]int64 `json:"errorMessages,omitempty"`
+}
+
+type Latency struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// Run generates the load of config until its duration elapses, its requests are sent, or ctx is done.
+func Run(ctx context.Context, config Config) (*Report, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if config.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Duration)
+		defer cancel()
+	}
+	payload := make([]byte, config.PayloadSize)
+	if _, err := rand.Read(payload); err != nil {
+		return nil, err
+	}
+
+	var newWorker func() worker
+	switch config.Protocol {
+	case HTTP:
+		client := &http.Client{
+			Timeout: config.Timeout,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				MaxIdleConnsPerHost: config.Concurrency,
+			},
+		}
+		newWorker = func() worker {
+			return &httpWorker{client: client, config: &config, payload: payload}
+		}
+	default:
+		newWorker = func() worker {
+			return &echoWorker{config: &config, payload: payload}
+		}
+	}
+
+	r := newRecorder(config)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < config.Concurrency; i++ {
+		wg.Add(1)
+		go func(w worker) {
+			defer wg.Done()
+			defer w.close()
+			for ctx.Err() == nil && r.next() {
+				requestStart := time.Now()
+				result := w.do(ctx)
+				// Requests interrupted at the end of the load aren't counted
+				if result.err != nil && ctx.Err() != nil {
+					r.cancel()
+					return
+				}
+				r.record(result, time.Since(requestStart))
+			}
+		}(newWorker())
+	}
+	wg.Wait()
+	return r.report(time.Since(start)), nil
+}
+
+type result struct {
+	sent, received int64
+	statusCode     int
+	err            error
+}
+
+type worker interface {
+	do(ctx context.Context) result
+	close()
+}
+
+type httpWorker struct {
+	client  *http.Client
+	config  *Config
+	payload []byte
+}
+
+func (w *httpWorker) do(ctx context.Context) result {
+	var body io.Reader
+	if len(w.payload) > 0 {
+		body = bytes.NewReader(w.payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, w.config.Method, w.config.Target, body)
+	if err != nil {
+		return result{err: err}
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return result{sent: int64(len(w.payload)), err: err}
+	}
+	defer resp.Body.Close()
+	received, err := io.Copy(ioutil.Discard, resp.Body)
+	res := result{sent: int64(len(w.payload)), received: received, statusCode: resp.StatusCode, err: err}
+	if err == nil && resp.StatusCode >= http.StatusBadRequest {
+		res.err = fmt.Errorf("status %s", resp.Status)
+	}
+	return res
+}
+
+func (w *httpWorker) close() {}
+
+// echoWorker sends the payload to an echo server over a connection it keeps, and reads it back
+type echoWorker struct {
+	config  *Config
+	payload []byte
+	conn    net.Conn
+	buffer  []byte
+}
+
+func (w *echoWorker) do(ctx context.Context) result {
+	if w.conn == nil {
+		dialer := net.Dialer{Timeout: w.config.Timeout}
+		conn, err := dialer.DialContext(ctx, w.config.Protocol, w.config.Target)
+		if err != nil {
+			return result{err: err}
+		}
+		w.conn = conn
+		w.buffer = make([]byte, len(w.payload))
+	}
+	res := w.roundTrip(ctx)
+	// The connection of a failed round trip may have the response yet to be read, so it's replaced
+	if res.err != nil {
+		w.close()
+	}
+	return res
+}
+
+func (w *echoWorker) roundTrip(ctx context.Context) result {
+	deadline := time.Time{}
+	if w.config.Timeout > 0 {
+		deadline = time.Now().Add(w.config.Timeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+	if err := w.conn.SetDeadline(deadline); err != nil {
+		return result{err: err}
+	}
+	sent, err := w.conn.Write(w.payload)
+	if err != nil {
+		return result{sent: int64(sent), err: err}
+	}
+	var received int
+	if w.config.Protocol == UDP {
+		received, err = w.conn.Read(w.buffer)
+		if err == nil && received != len(w.payload) {
+			err = fmt.Errorf("received a datagram of %d bytes instead of %d", received, len(w.payload))
+		}
+	} else {
+		received, err = io.ReadFull(w.conn, w.buffer)
+	}
+	if err == nil && !bytes.Equal(w.buffer[:received], w.payload) {
+		err = fmt.Errorf("received a message different from the one sent")
+	}
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return result{sent: int64(sent), received: int64(received), err: err}
+}
+
+func (w *echoWorker) close() {
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// recorder collects the results of the workers
+type recorder struct {
+	config Config
+	// started counts the requests that workers started
+	started int64
+
+	lock          sync.Mutex
+	requests      int64
+	errors        int64
+	sent          int64
+	received      int64
+	latencies     []time.Duration
+	statusCodes   map[int]int64
+	errorMessages map[string]int64
+}
+
+func newRecorder(config Config) *recorder {
+	return &recorder{
+		config:        config,
+		statusCodes:   make(map[int]int64),
+		errorMessages: make(map[string]int64),
+	}
+}
+
+// next reports whether a worker can start another request
+func (r *recorder) next() bool {
+	started := atomic.AddInt64(&r.started, 1)
+	return r.config.Requests <= 0 || started <= r.config.Requests
+}
+
+// cancel takes back a request that was started but not recorded
+func (r *recorder) cancel() {
+	atomic.AddInt64(&r.started, -1)
+}
+
+func (r *recorder) record(res result, latency time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.requests++
+	r.sent += res.sent
+	r.received += res.received
+	if res.statusCode != 0 {
+		r.statusCodes[res.statusCode]++
+	}
+	if res.err != nil {
+		r.errors++
+		message := res.err.Error()
+		if _, ok := r.errorMessages[message]; ok || len(r.errorMessages) < maxErrorMessages {
+			r.errorMessages[message]++
+		}
+		return
+	}
+	r.latencies = append(r.latencies, latency)
+}
+
+func (r *recorder) report(elapsed time.Duration) *Report {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	report := &Report{
+		Protocol:      r.config.Protocol,
+		Target:        r.config.Target,
+		Requests:      r.requests,
+		Errors:        r.errors,
+		Seconds:       elapsed.Seconds(),
+		BytesSent:     r.sent,
+		BytesReceived: r.received,
+		Latency:       latencyPercentiles(r.latencies),
+	}
+	if elapsed > 0 {
+		report.RequestsPerSecond = float64(len(r.latencies)) / elapsed.Seconds()
+	}
+	if len(r.statusCodes) > 0 {
+		report.StatusCodes = r.statusCodes
+	}
+	if len(r.errorMessages) > 0 {
+		report.ErrorMessages = r.errorMessages
+	}
+	return report
+}
+
+func latencyPercentiles(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	percentile := func(p float64) float64 {
+		index := int(p*float64(len(latencies))+0.5) - 1
+		if index < 0 {
+			index = 0
+		}
+		return milliseconds(latencies[index])
+	}
+	return Latency{
+		P50: percentile(0.5),
+		P90: percentile(0.9),
+		P99: percentile(0.99),
+		Max: milliseconds(latencies[len(latencies)-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,127 @@
+package stress
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunEcho(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	log := zerolog.Nop()
+	served := make(chan error)
+	go func() {
+		served <- ServeEcho(ctx, address, &log)
+	}()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-served)
+	}()
+
+	for _, protocol := range []string{TCP, UDP} {
+		t.Run(protocol, func(t *testing.T) {
+			var report *Report
+			require.Eventually(t, func() bool {
+				report, err = Run(context.Background(), Config{
+					Protocol:    protocol,
+					Target:      address,
+					Concurrency: 4,
+					Requests:    100,
+					PayloadSize: 512,
+					Timeout:     time.Second,
+				})
+				return err == nil && report.Errors == 0
+			}, 5*time.Second, 50*time.Millisecond)
+			assert.Equal(t, int64(100), report.Requests)
+			assert.Equal(t, int64(100*512), report.BytesSent)
+			assert.Equal(t, int64(100*512), report.BytesReceived)
+			assert.Greater(t, report.RequestsPerSecond, 0.0)
+			assert.LessOrEqual(t, report.Latency.P50, report.Latency.P99)
+			assert.LessOrEqual(t, report.Latency.P99, report.Latency.Max)
+		})
+	}
+}
+
+func TestRunHTTP(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests%2 == 0 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	report, err := Run(context.Background(), Config{
+		Protocol:    HTTP,
+		Target:      server.URL,
+		Concurrency: 1,
+		Requests:    10,
+		Method:      http.MethodGet,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), report.Requests)
+	assert.Equal(t, int64(5), report.Errors)
+	assert.Equal(t, int64(50), report.BytesReceived)
+	assert.Equal(t, map[int]int64{http.StatusOK: 5, http.StatusBadGateway: 5}, report.StatusCodes)
+	assert.Equal(t, map[string]int64{"status 502 Bad Gateway": 5}, report.ErrorMessages)
+}
+
+func TestRunDuration(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	start := time.Now()
+	report, err := Run(context.Background(), Config{
+		Protocol:    HTTP,
+		Target:      server.URL,
+		Concurrency: 2,
+		Duration:    200 * time.Millisecond,
+		Method:      http.MethodGet,
+	})
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Greater(t, report.Requests, int64(0))
+	// Requests interrupted when the duration elapses aren't failures
+	assert.Zero(t, report.Errors)
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := Config{Protocol: TCP, Target: "localhost:9000", Concurrency: 1, Duration: time.Second, PayloadSize: 1}
+	assert.NoError(t, valid.validate())
+
+	tests := []func(c *Config){
+		func(c *Config) { c.Protocol = "sctp" },
+		func(c *Config) { c.Target = "localhost" },
+		func(c *Config) { c.PayloadSize = 0 },
+		func(c *Config) { c.Concurrency = 0 },
+		func(c *Config) { c.Duration = 0 },
+	}
+	for _, modify := range tests {
+		config := valid
+		modify(&config)
+		assert.Error(t, config.validate())
+	}
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, Latency{P50: 50, P90: 90, P99: 99, Max: 100}, latencyPercentiles(latencies))
+	assert.Equal(t, Latency{}, latencyPercentiles(nil))
+}
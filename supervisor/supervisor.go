@@ -76,13 +76,17 @@ func NewSupervisor(config *TunnelConfig, orchestrator *orchestration.Orchestrato
 		return nil, fmt.Errorf("failed to generate cloudflared instance ID: %w", err)
 	}
 
-	isStaticEdge := len(config.EdgeAddrs) > 0
+	isStaticEdge := config.isStaticEdge()
 
 	var edgeIPs *edgediscovery.Edge
-	if isStaticEdge { // static edge addresses
+	if len(config.EdgeRegionAddrs) > 0 {
+		edgeIPs, err = edgediscovery.StaticRegionsEdge(config.Log, config.EdgeRegionAddrs, config.EdgeIPVersion)
+	} else if isStaticEdge { // static edge addresses
 		edgeIPs, err = edgediscovery.StaticEdge(config.Log, config.EdgeAddrs)
+	} else if config.EdgeAddrCache != "" {
+		edgeIPs, err = edgediscovery.ResolveEdgeWithCache(config.Log, config.Region, config.EdgeIPVersion, config.EdgeResolvers, config.EdgeAddrCache, config.EdgeAddrCacheMaxAge)
 	} else {
-		edgeIPs, err = edgediscovery.ResolveEdge(config.Log, config.Region, config.EdgeIPVersion)
+		edgeIPs, err = edgediscovery.ResolveEdge(config.Log, config.Region, config.EdgeIPVersion, config.EdgeResolvers)
 	}
 	if err != nil {
 		return nil, err
@@ -168,9 +172,15 @@ func (s *Supervisor) Run(
 		}
 	}
 
+	heartbeat := s.config.Watchdog.Register("supervisor")
+	defer heartbeat.Stop()
+
 	shuttingDown := false
 	for {
 		select {
+		// Tell the watchdog the loop isn't stalled
+		case <-heartbeat.C():
+			heartbeat.Beat()
 		// Context cancelled
 		case <-ctx.Done():
 			for tunnelsActive > 0 {
@@ -210,7 +220,7 @@ func (s *Supervisor) Run(
 		case <-backoffTimer:
 			backoffTimer = nil
 			for _, index := range tunnelsWaiting {
-				go s.startTunnel(ctx, index, s.newConnectedTunnelSignal(index))
+				go s.restartTunnel(ctx, index, s.newConnectedTunnelSignal(index))
 			}
 			tunnelsActive += len(tunnelsWaiting)
 			tunnelsWaiting = nil
@@ -292,13 +302,17 @@ func (s *Supervisor) startFirstTunnel(
 		err error
 	)
 	const firstConnIndex = 0
-	isStaticEdge := len(s.config.EdgeAddrs) > 0
+	isStaticEdge := s.config.isStaticEdge()
 	defer func() {
 		s.tunnelErrors <- tunnelError{index: firstConnIndex, err: err}
 	}()
 
-	// If the first tunnel disconnects, keep restarting it.
-	for {
+	// If the first tunnel disconnects, keep restarting it once the retry budget allows it.
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && !retry.GlobalBudget().Wait(ctx, retry.EdgeReconnects) {
+			err = ctx.Err()
+			return
+		}
 		err = s.edgeTunnelServer.Serve(ctx, firstConnIndex, s.tunnelsProtocolFallback[firstConnIndex], connectedSignal)
 		if ctx.Err() != nil {
 			return
@@ -350,6 +364,19 @@ func (s *Supervisor) startTunnel(
 	err = s.edgeTunnelServer.Serve(ctx, uint8(index), s.tunnelsProtocolFallback[index], connectedSignal)
 }
 
+// restartTunnel starts a tunnel connection again after it failed, once the retry budget allows it.
+func (s *Supervisor) restartTunnel(
+	ctx context.Context,
+	index int,
+	connectedSignal *signal.Signal,
+) {
+	if !retry.GlobalBudget().Wait(ctx, retry.EdgeReconnects) {
+		s.tunnelErrors <- tunnelError{index: index, err: ctx.Err()}
+		return
+	}
+	s.startTunnel(ctx, index, connectedSignal)
+}
+
 func (s *Supervisor) newConnectedTunnelSignal(index int) *signal.Signal {
 	sig := make(chan struct{})
 	s.tunnelsConnecting[index] = sig
@@ -19,7 +19,9 @@ import (
 	"github.com/cloudflare/cloudflared/connection"
 	"github.com/cloudflare/cloudflared/edgediscovery"
 	"github.com/cloudflare/cloudflared/edgediscovery/allregions"
+	"github.com/cloudflare/cloudflared/features"
 	"github.com/cloudflare/cloudflared/h2mux"
+	"github.com/cloudflare/cloudflared/iouring"
 	"github.com/cloudflare/cloudflared/orchestration"
 	quicpogs "github.com/cloudflare/cloudflared/quic"
 	"github.com/cloudflare/cloudflared/retry"
@@ -27,13 +29,14 @@ import (
 	"github.com/cloudflare/cloudflared/tunnelrpc"
 	tunnelpogs "github.com/cloudflare/cloudflared/tunnelrpc/pogs"
 	"github.com/cloudflare/cloudflared/tunnelstate"
+	"github.com/cloudflare/cloudflared/watchdog"
 )
 
 const (
 	dialTimeout              = 15 * time.Second
 	FeatureSerializedHeaders = "serialized_headers"
 	FeatureQuickReconnects   = "quick_reconnects"
-	FeatureAllowRemoteConfig = "allow_remote_config"
+	FeatureAllowRemoteConfig = connection.FeatureAllowRemoteConfig
 	FeatureDatagramV2        = "support_datagram_v2"
 )
 
@@ -44,25 +47,46 @@ type TunnelConfig struct {
 	ClientID        string
 	CloseConnOnce   *sync.Once // Used to close connectedSignal no more than once
 	EdgeAddrs       []string
+	// EdgeRegionAddrs are the IP:port addresses of each of the two regions of the edge, which are connected to
+	// instead of discovering the edge
+	EdgeRegionAddrs [][]string
 	Region          string
 	EdgeIPVersion   allregions.ConfigIPVersion
-	HAConnections   int
-	IncidentLookup  IncidentLookup
-	IsAutoupdated   bool
-	LBPool          string
-	Tags            []tunnelpogs.Tag
-	Log             *zerolog.Logger
-	LogTransport    *zerolog.Logger
-	Observer        *connection.Observer
-	ReportedVersion string
-	Retries         uint
-	RunFromTerminal bool
+	// EdgeResolvers are the resolvers the edge is discovered with, in fallback order
+	EdgeResolvers []allregions.Resolver
+	// EdgeAddrCache is the file the resolved edge addresses are cached in, they aren't cached if it's empty
+	EdgeAddrCache string
+	// EdgeAddrCacheMaxAge is how old the cache can be to be used
+	EdgeAddrCacheMaxAge time.Duration
+	HAConnections       int
+	IncidentLookup      IncidentLookup
+	IsAutoupdated       bool
+	LBPool              string
+	Tags                []tunnelpogs.Tag
+	Log                 *zerolog.Logger
+	LogTransport        *zerolog.Logger
+	Observer            *connection.Observer
+	ReportedVersion     string
+	Retries             uint
+	RunFromTerminal     bool
 
 	NamedTunnel      *connection.NamedTunnelProperties
 	ClassicTunnel    *connection.ClassicTunnelProperties
 	MuxerConfig      *connection.MuxerConfig
 	ProtocolSelector connection.ProtocolSelector
 	EdgeTLSConfigs   map[connection.Protocol]*tls.Config
+	HTTP2Config      connection.HTTP2Config
+	// UDPRing is the io_uring of the sockets of QUIC connections, they use standard sockets if it's nil
+	UDPRing *iouring.Ring
+	// FeatureSelector overrides the features of the client info of NamedTunnel, they're used as is if it's nil
+	FeatureSelector *features.Selector
+	// Watchdog watches the supervisor and connection loops for stalls, they aren't watched if it's nil
+	Watchdog *watchdog.Watchdog
+}
+
+// isStaticEdge is whether the edge addresses are configured instead of discovered
+func (c *TunnelConfig) isStaticEdge() bool {
+	return len(c.EdgeAddrs) > 0 || len(c.EdgeRegionAddrs) > 0
 }
 
 func (c *TunnelConfig) registrationOptions(connectionID uint8, OriginLocalIP string, uuid uuid.UUID) *tunnelpogs.RegistrationOptions {
@@ -92,8 +116,12 @@ func (c *TunnelConfig) connectionOptions(originLocalAddr string, numPreviousAtte
 	host, _, _ := net.SplitHostPort(originLocalAddr)
 	originIP := net.ParseIP(host)
 
+	client := c.NamedTunnel.Client
+	if c.FeatureSelector != nil {
+		client.Features = c.FeatureSelector.Features()
+	}
 	return &tunnelpogs.ConnectionOptions{
-		Client:              c.NamedTunnel.Client,
+		Client:              client,
 		OriginLocalIP:       originIP,
 		ReplaceExisting:     c.ReplaceExisting,
 		CompressionQuality:  uint8(c.MuxerConfig.CompressionSetting),
@@ -219,6 +247,13 @@ func (e EdgeTunnelServer) Serve(ctx context.Context, connIndex uint8, protocolFa
 	default:
 		return err
 	}
+	// The time to register the connection scores the address, so that reconnections prefer faster addresses
+	connectStart := time.Now()
+	go func() {
+		if connectedFuse.Await() {
+			e.edgeAddrs.ReportConnected(addr, time.Since(connectStart))
+		}
+	}()
 
 	logger := e.config.Log.With().
 		IPAddr(connection.LogFieldIPAddress, addr.UDP.IP).
@@ -376,6 +411,10 @@ func ServeTunnel(
 	protocol connection.Protocol,
 	gracefulShutdownC <-chan struct{},
 ) (err error, recoverable bool) {
+	// Deferred first so that it reports the error of a panic too
+	defer func() {
+		config.Observer.SendDisconnect(connIndex, err)
+	}()
 	// Treat panics as recoverable errors
 	defer func() {
 		if r := recover(); r != nil {
@@ -389,7 +428,6 @@ func ServeTunnel(
 		}
 	}()
 
-	defer config.Observer.SendDisconnect(connIndex)
 	err, recoverable = serveTunnel(
 		ctx,
 		connLog,
@@ -588,7 +626,7 @@ func ServeH2mux(
 	})
 
 	errGroup.Go(func() error {
-		return listenReconnect(serveCtx, reconnectCh, gracefulShutdownC)
+		return listenReconnect(serveCtx, reconnectCh, gracefulShutdownC, config.Watchdog, connIndex)
 	})
 
 	return errGroup.Wait()
@@ -611,6 +649,7 @@ func ServeHTTP2(
 		tlsServerConn,
 		orchestrator,
 		connOptions,
+		config.HTTP2Config,
 		config.Observer,
 		connIndex,
 		controlStreamHandler,
@@ -623,7 +662,7 @@ func ServeHTTP2(
 	})
 
 	errGroup.Go(func() error {
-		err := listenReconnect(serveCtx, reconnectCh, gracefulShutdownC)
+		err := listenReconnect(serveCtx, reconnectCh, gracefulShutdownC, config.Watchdog, connIndex)
 		if err != nil {
 			// forcefully break the connection (this is only used for testing)
 			connLog.Logger().Debug().Msg("Forcefully breaking http2 connection")
@@ -659,9 +698,24 @@ func ServeQUIC(
 		Tracer:                quicpogs.NewClientTracer(connLogger.Logger(), connIndex),
 	}
 
+	var packetConn net.PacketConn
+	if config.UDPRing != nil {
+		laddr := &net.UDPAddr{IP: net.IPv4zero}
+		if edgeAddr.IP.To4() == nil {
+			laddr.IP = net.IPv6unspecified
+		}
+		udpConn, err := config.UDPRing.ListenUDP(laddr)
+		if err != nil {
+			connLogger.ConnAwareLogger().Err(err).Msgf("Failed to open io_uring socket for quic connection")
+			return err, true
+		}
+		packetConn = udpConn
+	}
+
 	quicConn, err := connection.NewQUICConnection(
 		quicConfig,
 		edgeAddr,
+		packetConn,
 		tlsConfig,
 		orchestrator,
 		connOptions,
@@ -682,7 +736,7 @@ func ServeQUIC(
 	})
 
 	errGroup.Go(func() error {
-		err := listenReconnect(serveCtx, reconnectCh, gracefulShutdownC)
+		err := listenReconnect(serveCtx, reconnectCh, gracefulShutdownC, config.Watchdog, connIndex)
 		if err != nil {
 			// forcefully break the connection (this is only used for testing)
 			connLogger.Logger().Debug().Msg("Forcefully breaking quic connection")
@@ -694,14 +748,22 @@ func ServeQUIC(
 	return errGroup.Wait(), false
 }
 
-func listenReconnect(ctx context.Context, reconnectCh <-chan ReconnectSignal, gracefulShutdownCh <-chan struct{}) error {
-	select {
-	case reconnect := <-reconnectCh:
-		return reconnect
-	case <-gracefulShutdownCh:
-		return nil
-	case <-ctx.Done():
-		return nil
+// listenReconnect waits for the connection to be asked to reconnect or to shut down, sending heartbeats to wd while
+// the connection is served
+func listenReconnect(ctx context.Context, reconnectCh <-chan ReconnectSignal, gracefulShutdownCh <-chan struct{}, wd *watchdog.Watchdog, connIndex uint8) error {
+	heartbeat := wd.Register(fmt.Sprintf("connection %d", connIndex))
+	defer heartbeat.Stop()
+	for {
+		select {
+		case reconnect := <-reconnectCh:
+			return reconnect
+		case <-gracefulShutdownCh:
+			return nil
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C():
+			heartbeat.Beat()
+		}
 	}
 }
 
@@ -123,7 +123,12 @@ func CreateTunnelConfig(c *cli.Context, serverName string) (*tls.Config, error)
 	if c.String(CaCertFlag) != "" {
 		rootCAs = append(rootCAs, c.String(CaCertFlag))
 	}
+	return NewTunnelConfig(rootCAs, serverName)
+}
 
+// NewTunnelConfig creates the TLS config to connect to the edge at serverName, trusting the certificate authorities
+// of the rootCAs files, or Cloudflare's if there are none
+func NewTunnelConfig(rootCAs []string, serverName string) (*tls.Config, error) {
 	userConfig := &TLSParameters{RootCAs: rootCAs, ServerName: serverName}
 	tlsConfig, err := GetConfig(userConfig)
 	if err != nil {
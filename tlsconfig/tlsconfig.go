@@ -5,6 +5,7 @@ package tlsconfig
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"io/ioutil"
 
 	"github.com/pkg/errors"
@@ -94,3 +95,45 @@ func LoadCert(certPaths []string) (*x509.CertPool, error) {
 	}
 	return ca, nil
 }
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion parses a TLS version from 1.0 to 1.3, an empty version is 0 for the default of crypto/tls.
+func ParseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	if v, ok := tlsVersions[version]; ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("invalid TLS version %q, it must be 1.0, 1.1, 1.2 or 1.3", version)
+}
+
+// ParseCipherSuites parses the names of cipher suites of TLS 1.0 to 1.2, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+// including the insecure ones that some legacy servers only support. The cipher suites of TLS 1.3 can't be configured.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	suites := make(map[string]*tls.CipherSuite)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites[suite.Name] = suite
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		suite, ok := suites[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		if len(suite.SupportedVersions) == 1 && suite.SupportedVersions[0] == tls.VersionTLS13 {
+			return nil, fmt.Errorf("the cipher suite %s of TLS 1.3 can't be configured", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
@@ -80,3 +80,36 @@ func TestCertReloader(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expectedCert, *cert)
 }
+
+func TestParseTLSVersion(t *testing.T) {
+	version, err := ParseTLSVersion("")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0), version)
+
+	version, err = ParseTLSVersion("1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS10), version)
+
+	version, err = ParseTLSVersion("1.3")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+
+	_, err = ParseTLSVersion("TLS1.2")
+	assert.Error(t, err)
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	suites, err := ParseCipherSuites(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, suites)
+
+	suites, err = ParseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_RSA_WITH_3DES_EDE_CBC_SHA"})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA}, suites)
+
+	_, err = ParseCipherSuites([]string{"TLS_AES_128_GCM_SHA256"})
+	assert.Error(t, err)
+
+	_, err = ParseCipherSuites([]string{"ECDHE-RSA-AES128-GCM-SHA256"})
+	assert.Error(t, err)
+}
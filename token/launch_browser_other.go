@@ -10,3 +10,7 @@ import (
 func getBrowserCmd(url string) *exec.Cmd {
 	return nil
 }
+
+func hasDisplay(getenv func(string) string) bool {
+	return false
+}
@@ -10,3 +10,8 @@ import (
 func getBrowserCmd(url string) *exec.Cmd {
 	return exec.Command("xdg-open", url)
 }
+
+// hasDisplay returns whether a browser can be shown to the user of this machine
+func hasDisplay(getenv func(string) string) bool {
+	return getenv("DISPLAY") != "" || getenv("WAYLAND_DISPLAY") != ""
+}
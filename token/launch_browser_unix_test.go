@@ -0,0 +1,27 @@
+//go:build linux || freebsd || openbsd || netbsd
+// +build linux freebsd openbsd netbsd
+
+package token
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasDisplay(t *testing.T) {
+	tests := []struct {
+		env     map[string]string
+		display bool
+	}{
+		{env: map[string]string{}, display: false},
+		{env: map[string]string{"DISPLAY": ":0"}, display: true},
+		{env: map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, display: true},
+	}
+	for _, test := range tests {
+		getenv := func(key string) string { return test.env[key] }
+		assert.Equal(t, test.display, hasDisplay(getenv), "%v", test.env)
+		// Servers without a display log in from another device
+		assert.Equal(t, !test.display, isHeadless(getenv), "%v", test.env)
+	}
+}
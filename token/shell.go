@@ -1,6 +1,33 @@
 package token
 
+import (
+	"errors"
+	"os"
+)
+
+var (
+	// headless is set when logins have to be completed from another device
+	headless = isHeadless(os.Getenv)
+	// openBrowser opens login URLs, it's replaced in tests
+	openBrowser = OpenBrowser
+)
+
+// isHeadless returns whether logins have to be completed from another device in the environment of getenv, as this
+// machine has no display or the user is connected over SSH
+func isHeadless(getenv func(string) string) bool {
+	return !hasDisplay(getenv) || getenv("SSH_CONNECTION") != "" || getenv("SSH_TTY") != ""
+}
+
+// SetHeadless forces logins to be completed from another device instead of a browser opened on this machine
+func SetHeadless() {
+	headless = true
+}
+
 // OpenBrowser opens the specified URL in the default browser of the user
 func OpenBrowser(url string) error {
-	return getBrowserCmd(url).Start()
+	cmd := getBrowserCmd(url)
+	if cmd == nil {
+		return errors.New("opening a browser is not supported on this platform")
+	}
+	return cmd.Start()
 }
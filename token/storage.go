@@ -0,0 +1,65 @@
+package token
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudflare/cloudflared/secretstore"
+)
+
+// secretStore returns where tokens are stored, it's replaced in tests
+var secretStore = secretstore.Default
+
+// readStoredToken returns the token for path from the keyring of the OS. Tokens that older versions saved in
+// plaintext at path are moved to the keyring. Without a keyring, tokens stay in files at path only readable by the user.
+func readStoredToken(path string) ([]byte, error) {
+	store, err := secretStore()
+	if err == secretstore.ErrNoKeyring {
+		return ioutil.ReadFile(path)
+	} else if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(path)
+	token, err := store.Get(name)
+	if err != secretstore.ErrNotFound {
+		return token, err
+	}
+
+	token, err = ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Set(name, token); err == nil {
+		_ = os.Remove(path)
+	}
+	return token, nil
+}
+
+// writeStoredToken saves the token for path in the keyring of the OS, or at path without a keyring
+func writeStoredToken(path string, token []byte) error {
+	store, err := secretStore()
+	if err == secretstore.ErrNoKeyring {
+		return ioutil.WriteFile(path, token, 0600)
+	} else if err != nil {
+		return err
+	}
+	return store.Set(filepath.Base(path), token)
+}
+
+// removeStoredToken deletes the token for path from the keyring of the OS, and its plaintext file if any
+func removeStoredToken(path string) error {
+	store, err := secretStore()
+	if err != nil && err != secretstore.ErrNoKeyring {
+		return err
+	}
+	if store != nil {
+		if err := store.Delete(filepath.Base(path)); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
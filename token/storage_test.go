@@ -0,0 +1,87 @@
+package token
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/secretstore"
+)
+
+// memoryStore is a keyring keeping secrets in memory
+type memoryStore map[string][]byte
+
+func (s memoryStore) Get(name string) ([]byte, error) {
+	secret, ok := s[name]
+	if !ok {
+		return nil, secretstore.ErrNotFound
+	}
+	return secret, nil
+}
+
+func (s memoryStore) Set(name string, secret []byte) error {
+	s[name] = secret
+	return nil
+}
+
+func (s memoryStore) Delete(name string) error {
+	delete(s, name)
+	return nil
+}
+
+func (s memoryStore) Description() string {
+	return "memory"
+}
+
+func TestStoredTokenMigration(t *testing.T) {
+	dir := t.TempDir()
+	store := memoryStore{}
+	secretStore = func() (secretstore.Store, error) { return store, nil }
+	defer func() { secretStore = secretstore.Default }()
+
+	// Tokens saved in plaintext by older versions are moved to the keyring
+	path := filepath.Join(dir, "example.com-aud-token")
+	require.NoError(t, ioutil.WriteFile(path, []byte("legacy"), 0600))
+	token, err := readStoredToken(path)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy", string(token))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	token, err = readStoredToken(path)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy", string(token))
+
+	require.NoError(t, writeStoredToken(path, []byte("new")))
+	token, err = readStoredToken(path)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(token))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, removeStoredToken(path))
+	_, err = readStoredToken(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStoredTokenWithoutKeyring(t *testing.T) {
+	secretStore = func() (secretstore.Store, error) { return nil, secretstore.ErrNoKeyring }
+	defer func() { secretStore = secretstore.Default }()
+
+	// Tokens stay in files only readable by the user
+	path := filepath.Join(t.TempDir(), "example.com-aud-token")
+	require.NoError(t, writeStoredToken(path, []byte("token")))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	token, err := readStoredToken(path)
+	require.NoError(t, err)
+	assert.Equal(t, "token", string(token))
+
+	require.NoError(t, removeStoredToken(path))
+	_, err = readStoredToken(path)
+	assert.True(t, os.IsNotExist(err))
+}
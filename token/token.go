@@ -208,7 +208,7 @@ func getToken(appURL *url.URL, appInfo *AppInfo, useHostOnly bool, log *zerolog.
 			log.Debug().Msgf("failed to exchange org token for app token: %s", err)
 		} else {
 			// generate app path
-			if err := ioutil.WriteFile(appTokenPath, []byte(appToken), 0600); err != nil {
+			if err := writeStoredToken(appTokenPath, []byte(appToken)); err != nil {
 				return "", errors.Wrap(err, "failed to write app token to disk")
 			}
 			return appToken, nil
@@ -237,12 +237,12 @@ func getTokensFromEdge(appURL *url.URL, appTokenPath, orgTokenPath string, useHo
 
 	// If we were able to get the auth domain and generate an org token path, lets write it to disk.
 	if orgTokenPath != "" {
-		if err := ioutil.WriteFile(orgTokenPath, []byte(resp.OrgToken), 0600); err != nil {
+		if err := writeStoredToken(orgTokenPath, []byte(resp.OrgToken)); err != nil {
 			return "", errors.Wrap(err, "failed to write org token to disk")
 		}
 	}
 
-	if err := ioutil.WriteFile(appTokenPath, []byte(resp.AppToken), 0600); err != nil {
+	if err := writeStoredToken(appTokenPath, []byte(resp.AppToken)); err != nil {
 		return "", errors.Wrap(err, "failed to write app token to disk")
 	}
 
@@ -358,7 +358,7 @@ func GetOrgTokenIfExists(authDomain string) (string, error) {
 	}
 
 	if payload.isExpired() {
-		err := os.Remove(path)
+		err := removeStoredToken(path)
 		return "", err
 	}
 	return token.CompactSerialize()
@@ -380,7 +380,7 @@ func GetAppTokenIfExists(appInfo *AppInfo) (string, error) {
 	}
 
 	if payload.isExpired() {
-		err := os.Remove(path)
+		err := removeStoredToken(path)
 		return "", err
 	}
 	return token.CompactSerialize()
@@ -389,7 +389,7 @@ func GetAppTokenIfExists(appInfo *AppInfo) (string, error) {
 
 // GetTokenIfExists will return the token from local storage if it exists and not expired
 func getTokenIfExists(path string) (*jose.JSONWebSignature, error) {
-	content, err := ioutil.ReadFile(path)
+	content, err := readStoredToken(path)
 	if err != nil {
 		return nil, err
 	}
@@ -406,9 +406,5 @@ func RemoveTokenIfExists(appInfo *AppInfo) error {
 	if err != nil {
 		return err
 	}
-	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-		return err
-	}
-
-	return nil
+	return removeStoredToken(path)
 }
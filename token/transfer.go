@@ -36,12 +36,7 @@ func RunTransfer(transferURL *url.URL, resourceName, key, value string, shouldEn
 	}
 
 	// See AUTH-1423 for why we use stderr (the way git wraps ssh)
-	err = OpenBrowser(requestURL)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Please open the following URL and log in with your Cloudflare account:\n\n%s\n\nLeave cloudflared running to download the %s automatically.\n", requestURL, resourceName)
-	} else {
-		fmt.Fprintf(os.Stderr, "A browser window should have opened at the following URL:\n\n%s\n\nIf the browser failed to open, please visit the URL above directly in your browser.\n", requestURL)
-	}
+	printLoginInstructions(os.Stderr, requestURL, resourceName, headless)
 
 	var resourceData []byte
 
@@ -73,6 +68,22 @@ func RunTransfer(transferURL *url.URL, resourceName, key, value string, shouldEn
 
 }
 
+// printLoginInstructions opens a browser at requestURL, or tells the user to open it on another device if this
+// machine is headless or the browser failed to open. Either way the resource is downloaded by polling the transfer
+// service, so nothing has to be copied between devices. The transfer service has no device authorization endpoint,
+// so there's no short code like in the OAuth device flow: the whole URL is opened on the other device.
+func printLoginInstructions(w io.Writer, requestURL, resourceName string, headless bool) {
+	if headless {
+		fmt.Fprintf(w, "To log in, open the following URL in a browser on any device, e.g. your laptop or phone:\n\n%s\n\nLeave cloudflared running: the %s is downloaded to this machine automatically once you have logged in.\n", requestURL, resourceName)
+		return
+	}
+	if err := openBrowser(requestURL); err != nil {
+		fmt.Fprintf(w, "Please open the following URL and log in with your Cloudflare account:\n\n%s\n\nLeave cloudflared running to download the %s automatically.\n", requestURL, resourceName)
+	} else {
+		fmt.Fprintf(w, "A browser window should have opened at the following URL:\n\n%s\n\nIf the browser failed to open, please visit the URL above directly in your browser.\n", requestURL)
+	}
+}
+
 // BuildRequestURL creates a request suitable for a resource transfer.
 // it will return a constructed url based off the base url and query key/value provided.
 // cli will build a url for cli transfer request.
@@ -0,0 +1,86 @@
+package token
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsHeadless(t *testing.T) {
+	type headlessTest struct {
+		name     string
+		env      map[string]string
+		headless bool
+	}
+	tests := []headlessTest{
+		{name: "SSH connection", env: map[string]string{"DISPLAY": ":0", "SSH_CONNECTION": "192.0.2.1 52000 192.0.2.2 22"}, headless: true},
+		{name: "SSH terminal", env: map[string]string{"DISPLAY": ":0", "SSH_TTY": "/dev/pts/0"}, headless: true},
+	}
+	// Platforms without a display are always headless
+	if hasDisplay(func(string) string { return ":0" }) {
+		tests = append(tests, headlessTest{name: "local display", env: map[string]string{"DISPLAY": ":0"}, headless: false})
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			getenv := func(key string) string { return test.env[key] }
+			assert.Equal(t, test.headless, isHeadless(getenv))
+		})
+	}
+}
+
+func TestSetHeadless(t *testing.T) {
+	defer func(previous bool) { headless = previous }(headless)
+	headless = false
+	SetHeadless()
+	assert.True(t, headless)
+}
+
+func TestLoginInstructions(t *testing.T) {
+	const requestURL = "https://dash.cloudflare.com/argotunnel?callback=abc"
+	defer func() { openBrowser = OpenBrowser }()
+
+	tests := []struct {
+		name          string
+		headless      bool
+		browserErr    error
+		expectBrowser bool
+		expectOutput  string
+	}{
+		{
+			name:         "headless",
+			headless:     true,
+			expectOutput: "open the following URL in a browser on any device",
+		},
+		{
+			name:          "browser",
+			expectBrowser: true,
+			expectOutput:  "A browser window should have opened",
+		},
+		{
+			name:          "browser failed to open",
+			browserErr:    errors.New("no browser"),
+			expectBrowser: true,
+			expectOutput:  "Please open the following URL",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var opened []string
+			openBrowser = func(url string) error {
+				opened = append(opened, url)
+				return test.browserErr
+			}
+			var buf bytes.Buffer
+			printLoginInstructions(&buf, requestURL, "cert", test.headless)
+			if test.expectBrowser {
+				assert.Equal(t, []string{requestURL}, opened)
+			} else {
+				assert.Empty(t, opened, "a browser was opened on a headless machine")
+			}
+			assert.Contains(t, buf.String(), test.expectOutput)
+			assert.Contains(t, buf.String(), requestURL)
+		})
+	}
+}
@@ -0,0 +1,356 @@
+// Package tunnel runs a Cloudflare Tunnel connector in-process, so Go programs can publish their services, or
+// http.Handlers, without running the cloudflared binary.
+//
+// A minimal program serving an http.Handler through a tunnel:
+//
+//	err := tunnel.Run(ctx, tunnel.Config{
+//		Token: os.Getenv("TUNNEL_TOKEN"),
+//		Ingress: []tunnel.Rule{
+//			{Hostname: "app.example.com", Handler: mux},
+//			{Service: "http_status:404"},
+//		},
+//	})
+//
+// Servers of the program, e.g. gRPC or websocket servers, can also accept the connections of the tunnel from a
+// Listener instead of a TCP socket:
+//
+//	listener := tunnel.NewListener()
+//	go server.Serve(listener)
+//	err := tunnel.Run(ctx, tunnel.Config{
+//		Token:   os.Getenv("TUNNEL_TOKEN"),
+//		Ingress: []tunnel.Rule{{Listener: listener}},
+//	})
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/config"
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/edgediscovery"
+	"github.com/cloudflare/cloudflared/edgediscovery/allregions"
+	"github.com/cloudflare/cloudflared/h2mux"
+	"github.com/cloudflare/cloudflared/ingress"
+	"github.com/cloudflare/cloudflared/orchestration"
+	"github.com/cloudflare/cloudflared/signal"
+	"github.com/cloudflare/cloudflared/supervisor"
+	"github.com/cloudflare/cloudflared/tlsconfig"
+	tunnelpogs "github.com/cloudflare/cloudflared/tunnelrpc/pogs"
+)
+
+// Defaults of Config, the same as the defaults of cloudflared tunnel run
+const (
+	DefaultHAConnections = 4
+	DefaultRetries       = 5
+	DefaultGracePeriod   = 30 * time.Second
+	DefaultVersion       = "DEV"
+
+	heartbeatInterval = 5 * time.Second
+	maxHeartbeats     = 5
+	metricsUpdateFreq = 5 * time.Second
+)
+
+// Config configures a tunnel run in-process
+type Config struct {
+	// Token of the tunnel, as printed by cloudflared tunnel token. Either Token or Credentials is required.
+	Token string
+	// Credentials of the tunnel, as stored in its credentials file
+	Credentials *connection.Credentials
+
+	// Ingress rules matching requests to the service serving them, in order. The last rule must match all requests.
+	Ingress []Rule
+	// OriginRequest are the default settings of requests to origins, overridden by the settings of each rule
+	OriginRequest config.OriginRequestConfig
+
+	// Protocol to connect to the edge with: auto, quic or http2. Defaults to auto.
+	Protocol string
+	// HAConnections is the number of connections to the edge. Defaults to DefaultHAConnections.
+	HAConnections int
+	// Retries is the number of times connecting to the edge is retried. Defaults to DefaultRetries.
+	Retries uint
+	// GracePeriod is how long in-progress requests are waited for once the context of Run is done. Defaults to
+	// DefaultGracePeriod.
+	GracePeriod time.Duration
+	// EdgeIPVersion of the addresses to connect to the edge with: 4, 6 or auto. Defaults to 4.
+	EdgeIPVersion string
+	// Region of the edge to connect to, all regions by default
+	Region string
+	// Tags identify the connector
+	Tags map[string]string
+	// Version reported to the edge. Defaults to DefaultVersion.
+	Version string
+
+	// Log is where the tunnel logs, nothing is logged by default
+	Log *zerolog.Logger
+	// OnConnected is called once the tunnel has its first connection to the edge
+	OnConnected func()
+}
+
+// Rule routes the requests matching Hostname and Path to Service, or to Handler
+type Rule struct {
+	// Hostname of requests matched, all hostnames if empty. It may start with a * wildcard.
+	Hostname string
+	// Path is a regular expression of the paths of requests matched, all paths if empty
+	Path string
+	// Service the requests are proxied to, with the syntax of the ingress rules of the configuration file, e.g.
+	// http://localhost:8080 or http_status:404
+	Service string
+	// Handler serves the requests in-process instead of Service. Websockets aren't supported.
+	Handler http.Handler
+	// Listener accepts the connections of the requests instead of Service, for servers of the program
+	Listener *Listener
+	// OriginRequest are the settings of requests to Service
+	OriginRequest config.OriginRequestConfig
+}
+
+// Listener is an in-memory net.Listener, accepting the connections of the requests matching a Rule
+type Listener = ingress.Listener
+
+// NewListener returns a Listener to serve with a server of the program, and to set as the Listener of a Rule
+func NewListener() *Listener {
+	return ingress.NewListener()
+}
+
+// Run runs the tunnel until ctx is done, waiting up to the grace period for in-progress requests to end. It returns
+// an error if the tunnel fails to start or to stay connected to the edge.
+func Run(ctx context.Context, cfg Config) error {
+	log := cfg.Log
+	if log == nil {
+		nop := zerolog.Nop()
+		log = &nop
+	}
+	tunnelConfig, orchestratorConfig, err := cfg.prepare(log)
+	if err != nil {
+		return err
+	}
+
+	// The tunnel keeps running after ctx is done, until in-progress requests end or the grace period expires
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	orchestrator, err := orchestration.NewOrchestrator(runCtx, orchestratorConfig, tunnelConfig.Tags, log)
+	if err != nil {
+		return err
+	}
+
+	connectedSignal := signal.New(make(chan struct{}))
+	if cfg.OnConnected != nil {
+		go func() {
+			select {
+			case <-connectedSignal.Wait():
+				cfg.OnConnected()
+			case <-runCtx.Done():
+			}
+		}()
+	}
+
+	graceShutdownC := make(chan struct{})
+	errC := make(chan error, 1)
+	go func() {
+		reconnectCh := make(chan supervisor.ReconnectSignal, 1)
+		errC <- supervisor.StartTunnelDaemon(runCtx, tunnelConfig, orchestrator, connectedSignal, reconnectCh, graceShutdownC)
+	}()
+
+	select {
+	case err := <-errC:
+		return err
+	case <-ctx.Done():
+	}
+	close(graceShutdownC)
+	select {
+	case <-errC:
+	case <-time.After(cfg.gracePeriod()):
+		cancel()
+		<-errC
+	}
+	return nil
+}
+
+func (cfg *Config) prepare(log *zerolog.Logger) (*supervisor.TunnelConfig, *orchestration.Config, error) {
+	credentials, err := cfg.credentials()
+	if err != nil {
+		return nil, nil, err
+	}
+	ingressRules, err := cfg.ingress()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version := cfg.Version
+	if version == "" {
+		version = DefaultVersion
+	}
+	osArch := fmt.Sprintf("%s_%s", runtime.GOOS, runtime.GOARCH)
+	connectorID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can't generate connector UUID")
+	}
+	namedTunnel := &connection.NamedTunnelProperties{
+		Credentials: *credentials,
+		Client: tunnelpogs.ClientInfo{
+			ClientID: connectorID[:],
+			// Remote configuration isn't allowed, it would replace the handlers of the ingress rules
+			Features: []string{supervisor.FeatureSerializedHeaders},
+			Version:  version,
+			Arch:     osArch,
+		},
+	}
+
+	protocol := cfg.Protocol
+	if protocol == "" {
+		protocol = connection.AutoSelectFlag
+	}
+	protocolSelector, err := connection.NewProtocolSelector(protocol, false, namedTunnel, edgediscovery.ProtocolPercentage, supervisor.ResolveTTL, log)
+	if err != nil {
+		return nil, nil, err
+	}
+	edgeTLSConfigs := make(map[connection.Protocol]*tls.Config, len(connection.ProtocolList))
+	for _, p := range connection.ProtocolList {
+		tlsSettings := p.TLSSettings()
+		if tlsSettings == nil {
+			return nil, nil, fmt.Errorf("%s has unknown TLS settings", p)
+		}
+		edgeTLSConfig, err := tlsconfig.NewTunnelConfig(nil, tlsSettings.ServerName)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "unable to create TLS config to connect with edge")
+		}
+		if len(tlsSettings.NextProtos) > 0 {
+			edgeTLSConfig.NextProtos = tlsSettings.NextProtos
+		}
+		edgeTLSConfigs[p] = edgeTLSConfig
+	}
+	edgeIPVersion, err := parseEdgeIPVersion(cfg.EdgeIPVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientID := connectorID.String()
+	tags := []tunnelpogs.Tag{{Name: "ID", Value: clientID}}
+	for name, value := range cfg.Tags {
+		tags = append(tags, tunnelpogs.Tag{Name: name, Value: value})
+	}
+	haConnections := cfg.HAConnections
+	if haConnections == 0 {
+		haConnections = DefaultHAConnections
+	}
+	retries := cfg.Retries
+	if retries == 0 {
+		retries = DefaultRetries
+	}
+
+	tunnelConfig := &supervisor.TunnelConfig{
+		GracePeriod:     cfg.gracePeriod(),
+		OSArch:          osArch,
+		ClientID:        clientID,
+		Region:          cfg.Region,
+		EdgeIPVersion:   edgeIPVersion,
+		HAConnections:   haConnections,
+		IncidentLookup:  supervisor.NewIncidentLookup(),
+		Tags:            tags,
+		Log:             log,
+		LogTransport:    log,
+		Observer:        connection.NewObserver(log, log),
+		ReportedVersion: version,
+		Retries:         retries,
+		NamedTunnel:     namedTunnel,
+		MuxerConfig: &connection.MuxerConfig{
+			HeartbeatInterval:  heartbeatInterval,
+			MaxHeartbeats:      maxHeartbeats,
+			CompressionSetting: h2mux.CompressionNone,
+			MetricsUpdateFreq:  metricsUpdateFreq,
+		},
+		ProtocolSelector: protocolSelector,
+		EdgeTLSConfigs:   edgeTLSConfigs,
+	}
+	// Warp-routing is disabled, so its default configuration is valid
+	warpRouting, _ := ingress.NewWarpRoutingConfig(&config.WarpRoutingConfig{})
+	orchestratorConfig := &orchestration.Config{
+		Ingress:     &ingressRules,
+		WarpRouting: warpRouting,
+	}
+	return tunnelConfig, orchestratorConfig, nil
+}
+
+func (cfg *Config) gracePeriod() time.Duration {
+	if cfg.GracePeriod == 0 {
+		return DefaultGracePeriod
+	}
+	return cfg.GracePeriod
+}
+
+func (cfg *Config) credentials() (*connection.Credentials, error) {
+	switch {
+	case cfg.Token != "" && cfg.Credentials != nil:
+		return nil, errors.New("only one of Token and Credentials can be set")
+	case cfg.Token != "":
+		token, err := connection.ParseTunnelToken(cfg.Token)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid tunnel token")
+		}
+		credentials := token.Credentials()
+		return &credentials, nil
+	case cfg.Credentials != nil:
+		return cfg.Credentials, nil
+	default:
+		return nil, errors.New("Token or Credentials is required")
+	}
+}
+
+// ingress validates the rules like the ingress rules of the configuration file, then sets the handlers and listeners
+// of rules served in-process
+func (cfg *Config) ingress() (ingress.Ingress, error) {
+	rules := make([]config.UnvalidatedIngressRule, len(cfg.Ingress))
+	for i, rule := range cfg.Ingress {
+		service := rule.Service
+		if rule.Handler != nil || rule.Listener != nil {
+			if service != "" || (rule.Handler != nil && rule.Listener != nil) {
+				return ingress.Ingress{}, fmt.Errorf("rule #%d can only have one of Service, Handler and Listener", i+1)
+			}
+			// Stands in for the handler or listener during validation
+			service = ingress.HelloWorldService
+		}
+		rules[i] = config.UnvalidatedIngressRule{
+			Hostname:      rule.Hostname,
+			Path:          rule.Path,
+			Service:       service,
+			OriginRequest: rule.OriginRequest,
+		}
+	}
+
+	ingressRules, err := ingress.ParseIngress(&config.Configuration{
+		Ingress:       rules,
+		OriginRequest: cfg.OriginRequest,
+	})
+	if err != nil {
+		return ingress.Ingress{}, err
+	}
+	for i, rule := range cfg.Ingress {
+		if rule.Handler != nil {
+			ingressRules.Rules[i].Service = ingress.NewHandlerService(rule.Handler)
+		} else if rule.Listener != nil {
+			ingressRules.Rules[i].Service = ingress.NewListenerService(rule.Listener)
+		}
+	}
+	return ingressRules, nil
+}
+
+func parseEdgeIPVersion(version string) (allregions.ConfigIPVersion, error) {
+	switch version {
+	case "", "4":
+		return allregions.IPv4Only, nil
+	case "6":
+		return allregions.IPv6Only, nil
+	case "auto":
+		return allregions.Auto, nil
+	default:
+		return 0, fmt.Errorf("invalid EdgeIPVersion %s", version)
+	}
+}
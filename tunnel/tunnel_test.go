@@ -0,0 +1,88 @@
+package tunnel
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/connection"
+	"github.com/cloudflare/cloudflared/edgediscovery/allregions"
+	"github.com/cloudflare/cloudflared/ingress"
+)
+
+func TestConfigIngress(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	cfg := Config{Ingress: []Rule{
+		{Hostname: "app.example.com", Handler: handler},
+		{Hostname: "api.example.com", Service: "http://localhost:8080"},
+		{Service: "http_status:404"},
+	}}
+
+	ingressRules, err := cfg.ingress()
+	require.NoError(t, err)
+	require.Len(t, ingressRules.Rules, 3)
+	assert.Equal(t, ingress.HandlerService, ingressRules.Rules[0].Service.String())
+	assert.Equal(t, "http://localhost:8080", ingressRules.Rules[1].Service.String())
+	assert.Equal(t, "http_status:404", ingressRules.Rules[2].Service.String())
+
+	cfg.Ingress[0].Service = "http://localhost:8081"
+	_, err = cfg.ingress()
+	assert.Error(t, err)
+	cfg.Ingress[0].Service = ""
+	cfg.Ingress[0].Listener = NewListener()
+	_, err = cfg.ingress()
+	assert.Error(t, err)
+
+	cfg.Ingress[0].Handler = nil
+	ingressRules, err = cfg.ingress()
+	require.NoError(t, err)
+	assert.Equal(t, ingress.ListenerService, ingressRules.Rules[0].Service.String())
+
+	// The last rule must match all requests
+	cfg = Config{Ingress: []Rule{{Hostname: "app.example.com", Handler: handler}}}
+	_, err = cfg.ingress()
+	assert.Error(t, err)
+}
+
+func TestConfigCredentials(t *testing.T) {
+	tunnelToken := connection.TunnelToken{
+		AccountTag:   "account",
+		TunnelSecret: []byte("secret"),
+		TunnelID:     uuid.New(),
+	}
+	token, err := tunnelToken.Encode()
+	require.NoError(t, err)
+
+	credentials, err := (&Config{Token: token}).credentials()
+	require.NoError(t, err)
+	assert.Equal(t, tunnelToken.Credentials(), *credentials)
+
+	fromFile := &connection.Credentials{AccountTag: "account", TunnelID: uuid.New()}
+	credentials, err = (&Config{Credentials: fromFile}).credentials()
+	require.NoError(t, err)
+	assert.Equal(t, fromFile, credentials)
+
+	_, err = (&Config{Token: token, Credentials: fromFile}).credentials()
+	assert.Error(t, err)
+	_, err = (&Config{}).credentials()
+	assert.Error(t, err)
+	_, err = (&Config{Token: "not a token"}).credentials()
+	assert.Error(t, err)
+}
+
+func TestParseEdgeIPVersion(t *testing.T) {
+	version, err := parseEdgeIPVersion("")
+	require.NoError(t, err)
+	assert.Equal(t, allregions.IPv4Only, version)
+	version, err = parseEdgeIPVersion("6")
+	require.NoError(t, err)
+	assert.Equal(t, allregions.IPv6Only, version)
+	version, err = parseEdgeIPVersion("auto")
+	require.NoError(t, err)
+	assert.Equal(t, allregions.Auto, version)
+	_, err = parseEdgeIPVersion("5")
+	assert.Error(t, err)
+}
@@ -0,0 +1,243 @@
+package tunneldns
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+)
+
+const (
+	CacheSizeDefault   = 10000
+	CacheMinTTLDefault = 5 * time.Second
+	CacheMaxTTLDefault = time.Hour
+
+	// TTL of stale answers, see https://www.rfc-editor.org/rfc/rfc8767#section-4
+	staleTTL = 30 * time.Second
+)
+
+// CacheConfig configures the response cache of the DNS proxy
+type CacheConfig struct {
+	// Maximum number of cached responses, 0 disables the cache
+	MaxSize int
+	// TTLs of cached responses are clamped to [MinTTL, MaxTTL]
+	MinTTL time.Duration
+	MaxTTL time.Duration
+	// How long after expiring a response may still be served when no upstream answers, 0 disables serving stale
+	ServeStale time.Duration
+}
+
+// DefaultCacheConfig returns the cache settings used when none are configured
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		MaxSize: CacheSizeDefault,
+		MinTTL:  CacheMinTTLDefault,
+		MaxTTL:  CacheMaxTTLDefault,
+	}
+}
+
+type cacheKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+	do     bool
+	// Responses to queries with different EDNS Client Subnets may differ
+	ecs string
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	msg     *dns.Msg
+	expires time.Time
+}
+
+// CachePlugin caches successful and negative responses of the next plugin, honoring their TTLs
+type CachePlugin struct {
+	Next   plugin.Handler
+	config CacheConfig
+
+	lock    sync.Mutex
+	entries map[cacheKey]*list.Element
+	// Least recently used entries are at the back
+	lru *list.List
+
+	now func() time.Time
+}
+
+// NewCachePlugin creates a cache plugin with the given config
+func NewCachePlugin(config CacheConfig, next plugin.Handler) *CachePlugin {
+	return &CachePlugin{
+		Next:    next,
+		config:  config,
+		entries: make(map[cacheKey]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *CachePlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if p.config.MaxSize <= 0 || len(r.Question) != 1 {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+
+	key := newCacheKey(r)
+	now := p.now()
+	cached, expires := p.get(key)
+	if cached != nil && now.Before(expires) {
+		cacheHits.Inc()
+		return p.reply(w, r, cached, expires.Sub(now))
+	}
+	cacheMisses.Inc()
+
+	cw := &captureWriter{ResponseWriter: w}
+	status, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, cw, r)
+	if cw.msg == nil {
+		if cached != nil && p.config.ServeStale > 0 && now.Before(expires.Add(p.config.ServeStale)) {
+			cacheStaleServed.Inc()
+			return p.reply(w, r, cached, staleTTL)
+		}
+		return status, err
+	}
+
+	if ttl, ok := p.responseTTL(cw.msg); ok {
+		p.set(key, cw.msg, now.Add(ttl))
+	}
+	_ = w.WriteMsg(cw.msg)
+	return status, err
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *CachePlugin) Name() string { return "cache" }
+
+// Flush removes all cached responses
+func (p *CachePlugin) Flush() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.entries = make(map[cacheKey]*list.Element)
+	p.lru.Init()
+	cacheEntries.Set(0)
+}
+
+func (p *CachePlugin) reply(w dns.ResponseWriter, r *dns.Msg, cached *dns.Msg, ttl time.Duration) (int, error) {
+	reply := cached.Copy()
+	reply.Id = r.Id
+	setTTL(reply, uint32(ttl.Seconds()))
+	_ = w.WriteMsg(reply)
+	return dns.RcodeSuccess, nil
+}
+
+func (p *CachePlugin) get(key cacheKey) (*dns.Msg, time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	elem, ok := p.entries[key]
+	if !ok {
+		return nil, time.Time{}
+	}
+	p.lru.MoveToFront(elem)
+	entry := elem.Value.(*cacheEntry)
+	return entry.msg, entry.expires
+}
+
+func (p *CachePlugin) set(key cacheKey, msg *dns.Msg, expires time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if elem, ok := p.entries[key]; ok {
+		p.lru.MoveToFront(elem)
+		elem.Value = &cacheEntry{key: key, msg: msg.Copy(), expires: expires}
+		return
+	}
+	p.entries[key] = p.lru.PushFront(&cacheEntry{key: key, msg: msg.Copy(), expires: expires})
+	for p.lru.Len() > p.config.MaxSize {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.entries, oldest.Value.(*cacheEntry).key)
+	}
+	cacheEntries.Set(float64(p.lru.Len()))
+}
+
+// responseTTL returns how long msg may be cached. Only successful and NXDOMAIN responses are cached, with the
+// lowest TTL of their records clamped to the configured bounds.
+func (p *CachePlugin) responseTTL(msg *dns.Msg) (time.Duration, bool) {
+	if msg.Truncated || (msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError) {
+		return 0, false
+	}
+
+	var minTTL uint32
+	found := false
+	for _, rr := range allRecords(msg) {
+		ttl := rr.Header().Ttl
+		// The TTL of a negative response is the minimum of the SOA TTL and its MINIMUM field, see RFC 2308
+		if soa, ok := rr.(*dns.SOA); ok && soa.Minttl < ttl {
+			ttl = soa.Minttl
+		}
+		if !found || ttl < minTTL {
+			minTTL, found = ttl, true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+
+	ttl := time.Duration(minTTL) * time.Second
+	if ttl < p.config.MinTTL {
+		ttl = p.config.MinTTL
+	}
+	if p.config.MaxTTL > 0 && ttl > p.config.MaxTTL {
+		ttl = p.config.MaxTTL
+	}
+	return ttl, ttl > 0
+}
+
+func newCacheKey(r *dns.Msg) cacheKey {
+	key := cacheKey{
+		name:   strings.ToLower(r.Question[0].Name),
+		qtype:  r.Question[0].Qtype,
+		qclass: r.Question[0].Qclass,
+	}
+	if opt := r.IsEdns0(); opt != nil {
+		key.do = opt.Do()
+	}
+	if subnet := findSubnetOption(r); subnet != nil {
+		key.ecs = fmt.Sprintf("%s/%d", subnet.Address, subnet.SourceNetmask)
+	}
+	return key
+}
+
+// allRecords returns the records of all sections of msg, except the OPT pseudo-record
+func allRecords(msg *dns.Msg) []dns.RR {
+	records := make([]dns.RR, 0, len(msg.Answer)+len(msg.Ns)+len(msg.Extra))
+	records = append(records, msg.Answer...)
+	records = append(records, msg.Ns...)
+	for _, rr := range msg.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			records = append(records, rr)
+		}
+	}
+	return records
+}
+
+func setTTL(msg *dns.Msg, ttl uint32) {
+	for _, rr := range allRecords(msg) {
+		rr.Header().Ttl = ttl
+	}
+}
+
+// captureWriter records the response of the next plugin instead of writing it to the client
+type captureWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (cw *captureWriter) WriteMsg(msg *dns.Msg) error {
+	cw.msg = msg
+	return nil
+}
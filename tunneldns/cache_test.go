@@ -0,0 +1,143 @@
+package tunneldns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockHandler struct {
+	calls    int
+	response func(r *dns.Msg) *dns.Msg
+}
+
+func (h *mockHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	h.calls++
+	if h.response == nil {
+		return dns.RcodeServerFailure, errors.New("upstream unreachable")
+	}
+	_ = w.WriteMsg(h.response(r))
+	return dns.RcodeSuccess, nil
+}
+
+func (h *mockHandler) Name() string { return "mock" }
+
+func aResponse(ttl uint32) func(r *dns.Msg) *dns.Msg {
+	return func(r *dns.Msg) *dns.Msg {
+		response := new(dns.Msg)
+		response.SetReply(r)
+		response.Answer = append(response.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+			A:   net.ParseIP("192.0.2.1"),
+		})
+		return response
+	}
+}
+
+func serve(t *testing.T, handler plugin.Handler, name string) *dns.Msg {
+	query := new(dns.Msg)
+	query.SetQuestion(name, dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	_, _ = handler.ServeDNS(context.Background(), rec, query)
+	if rec.Msg != nil {
+		assert.Equal(t, query.Id, rec.Msg.Id)
+	}
+	return rec.Msg
+}
+
+func TestCacheHonorsTTL(t *testing.T) {
+	next := &mockHandler{response: aResponse(60)}
+	now := time.Now()
+	cache := NewCachePlugin(DefaultCacheConfig(), next)
+	cache.now = func() time.Time { return now }
+
+	require.NotNil(t, serve(t, cache, "example.com."))
+	now = now.Add(20 * time.Second)
+	response := serve(t, cache, "EXAMPLE.com.")
+	require.NotNil(t, response)
+	assert.Equal(t, 1, next.calls)
+	assert.Equal(t, uint32(40), response.Answer[0].Header().Ttl)
+
+	now = now.Add(41 * time.Second)
+	require.NotNil(t, serve(t, cache, "example.com."))
+	assert.Equal(t, 2, next.calls)
+}
+
+func TestCacheClampsTTL(t *testing.T) {
+	cache := NewCachePlugin(CacheConfig{MaxSize: 10, MinTTL: time.Minute, MaxTTL: time.Hour}, nil)
+	tests := []struct {
+		ttl      uint32
+		expected time.Duration
+	}{
+		{ttl: 1, expected: time.Minute},
+		{ttl: 300, expected: 5 * time.Minute},
+		{ttl: 86400, expected: time.Hour},
+	}
+	for _, test := range tests {
+		query := new(dns.Msg)
+		query.SetQuestion("example.com.", dns.TypeA)
+		ttl, ok := cache.responseTTL(aResponse(test.ttl)(query))
+		assert.True(t, ok)
+		assert.Equal(t, test.expected, ttl)
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	servfail := new(dns.Msg)
+	servfail.SetRcode(query, dns.RcodeServerFailure)
+	_, ok := cache.responseTTL(servfail)
+	assert.False(t, ok)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	next := &mockHandler{response: aResponse(60)}
+	cache := NewCachePlugin(CacheConfig{MaxSize: 2, MaxTTL: time.Hour}, next)
+
+	serve(t, cache, "a.example.com.")
+	serve(t, cache, "b.example.com.")
+	serve(t, cache, "a.example.com.")
+	serve(t, cache, "c.example.com.")
+	assert.Equal(t, 3, next.calls)
+
+	// b was the least recently used entry
+	serve(t, cache, "a.example.com.")
+	assert.Equal(t, 3, next.calls)
+	serve(t, cache, "b.example.com.")
+	assert.Equal(t, 4, next.calls)
+}
+
+func TestCacheServeStale(t *testing.T) {
+	next := &mockHandler{response: aResponse(60)}
+	now := time.Now()
+	cache := NewCachePlugin(CacheConfig{MaxSize: 10, MaxTTL: time.Hour, ServeStale: time.Hour}, next)
+	cache.now = func() time.Time { return now }
+
+	serve(t, cache, "example.com.")
+	next.response = nil
+
+	now = now.Add(30 * time.Minute)
+	response := serve(t, cache, "example.com.")
+	require.NotNil(t, response)
+	assert.Equal(t, uint32(staleTTL.Seconds()), response.Answer[0].Header().Ttl)
+
+	now = now.Add(time.Hour)
+	assert.Nil(t, serve(t, cache, "example.com."))
+}
+
+func TestCacheDisabled(t *testing.T) {
+	next := &mockHandler{response: aResponse(60)}
+	cache := NewCachePlugin(CacheConfig{}, next)
+
+	serve(t, cache, "example.com.")
+	serve(t, cache, "example.com.")
+	assert.Equal(t, 2, next.calls)
+}
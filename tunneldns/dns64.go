@@ -0,0 +1,117 @@
+package tunneldns
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// DNS64WellKnownPrefix is the NAT64 prefix reserved for IPv4/IPv6 translation, see https://www.rfc-editor.org/rfc/rfc6052#section-2.1
+const DNS64WellKnownPrefix = "64:ff9b::/96"
+
+// DNS64Config configures the synthesis of AAAA records for IPv6-only clients behind a NAT64 gateway
+type DNS64Config struct {
+	// NAT64 prefix of synthesized addresses, e.g. DNS64WellKnownPrefix. DNS64 is disabled if empty.
+	Prefix string
+}
+
+// DNS64Plugin answers AAAA queries for names that only have A records with AAAA records embedding the IPv4
+// addresses in a NAT64 prefix, see https://www.rfc-editor.org/rfc/rfc6147
+type DNS64Plugin struct {
+	Next   plugin.Handler
+	prefix *net.IPNet
+}
+
+// NewDNS64Plugin creates a DNS64 plugin, or returns an error if the prefix is invalid
+func NewDNS64Plugin(config DNS64Config, next plugin.Handler) (*DNS64Plugin, error) {
+	_, prefix, err := net.ParseCIDR(config.Prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid DNS64 prefix")
+	}
+	ones, bits := prefix.Mask.Size()
+	if bits != 128 {
+		return nil, fmt.Errorf("DNS64 prefix %s is not an IPv6 prefix", config.Prefix)
+	}
+	switch ones {
+	case 32, 40, 48, 56, 64, 96:
+	default:
+		return nil, fmt.Errorf("DNS64 prefix %s must have a length of 32, 40, 48, 56, 64 or 96", config.Prefix)
+	}
+	return &DNS64Plugin{Next: next, prefix: prefix}, nil
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *DNS64Plugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	// Clients validating DNSSEC themselves would reject synthesized records, see https://www.rfc-editor.org/rfc/rfc6147#section-5.5
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeAAAA || r.Question[0].Qclass != dns.ClassINET || r.CheckingDisabled {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+
+	cw := &captureWriter{ResponseWriter: w}
+	status, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, cw, r)
+	if cw.msg == nil {
+		return status, err
+	}
+	if cw.msg.Rcode != dns.RcodeSuccess || hasRecords(cw.msg.Answer, dns.TypeAAAA) {
+		_ = w.WriteMsg(cw.msg)
+		return status, err
+	}
+
+	query := r.Copy()
+	query.Question[0].Qtype = dns.TypeA
+	aw := &captureWriter{ResponseWriter: w}
+	if _, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, aw, query); err != nil || aw.msg == nil || !hasRecords(aw.msg.Answer, dns.TypeA) {
+		// Answer the AAAA query as is if there's no IPv4 address to synthesize from
+		_ = w.WriteMsg(cw.msg)
+		return status, nil
+	}
+
+	response := cw.msg.Copy()
+	response.Answer = nil
+	response.Ns = nil
+	response.AuthenticatedData = false
+	for _, rr := range aw.msg.Answer {
+		switch rr := rr.(type) {
+		case *dns.A:
+			hdr := rr.Hdr
+			hdr.Rrtype = dns.TypeAAAA
+			response.Answer = append(response.Answer, &dns.AAAA{Hdr: hdr, AAAA: p.synthesize(rr.A)})
+		case *dns.CNAME, *dns.DNAME:
+			response.Answer = append(response.Answer, dns.Copy(rr))
+		}
+	}
+	_ = w.WriteMsg(response)
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *DNS64Plugin) Name() string { return "dns64" }
+
+// synthesize embeds ipv4 in the prefix, skipping the reserved bits 64 to 71, see https://www.rfc-editor.org/rfc/rfc6052#section-2.2
+func (p *DNS64Plugin) synthesize(ipv4 net.IP) net.IP {
+	ipv6 := make(net.IP, net.IPv6len)
+	copy(ipv6, p.prefix.IP)
+	ones, _ := p.prefix.Mask.Size()
+	i := ones / 8
+	for _, b := range ipv4.To4() {
+		if i == 8 {
+			i++
+		}
+		ipv6[i] = b
+		i++
+	}
+	return ipv6
+}
+
+func hasRecords(section []dns.RR, rrtype uint16) bool {
+	for _, rr := range section {
+		if rr.Header().Rrtype == rrtype {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package tunneldns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveDNS64(t *testing.T, p *DNS64Plugin, name string, qtype uint16) *dns.Msg {
+	query := new(dns.Msg)
+	query.SetQuestion(name, qtype)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	_, err := p.ServeDNS(context.Background(), rec, query)
+	require.NoError(t, err)
+	require.NotNil(t, rec.Msg)
+	return rec.Msg
+}
+
+func TestDNS64Synthesis(t *testing.T) {
+	zones := zoneServer{}
+	zones.add(dns.TypeA, "ipv4only.example.", rr(t, "ipv4only.example. 300 IN A 192.0.2.33"))
+	zones.add(dns.TypeAAAA, "ipv4only.example.")
+	zones.add(dns.TypeA, "dualstack.example.", rr(t, "dualstack.example. 300 IN A 192.0.2.1"))
+	zones.add(dns.TypeAAAA, "dualstack.example.", rr(t, "dualstack.example. 300 IN AAAA 2001:db8::1"))
+	zones.add(dns.TypeA, "alias.example.", rr(t, "alias.example. 300 IN CNAME ipv4only.example."), rr(t, "ipv4only.example. 120 IN A 192.0.2.33"))
+	zones.add(dns.TypeAAAA, "alias.example.", rr(t, "alias.example. 300 IN CNAME ipv4only.example."))
+
+	p, err := NewDNS64Plugin(DNS64Config{Prefix: DNS64WellKnownPrefix}, zones)
+	require.NoError(t, err)
+
+	response := serveDNS64(t, p, "ipv4only.example.", dns.TypeAAAA)
+	require.Len(t, response.Answer, 1)
+	assert.Equal(t, "64:ff9b::c000:221", response.Answer[0].(*dns.AAAA).AAAA.String())
+	assert.Equal(t, uint32(300), response.Answer[0].Header().Ttl)
+
+	response = serveDNS64(t, p, "dualstack.example.", dns.TypeAAAA)
+	require.Len(t, response.Answer, 1)
+	assert.Equal(t, "2001:db8::1", response.Answer[0].(*dns.AAAA).AAAA.String())
+
+	response = serveDNS64(t, p, "alias.example.", dns.TypeAAAA)
+	require.Len(t, response.Answer, 2)
+	assert.Equal(t, dns.TypeCNAME, response.Answer[0].Header().Rrtype)
+	assert.Equal(t, "64:ff9b::c000:221", response.Answer[1].(*dns.AAAA).AAAA.String())
+
+	// Names that don't exist aren't synthesized, nor other query types
+	assert.Equal(t, dns.RcodeNameError, serveDNS64(t, p, "missing.example.", dns.TypeAAAA).Rcode)
+	response = serveDNS64(t, p, "ipv4only.example.", dns.TypeA)
+	require.Len(t, response.Answer, 1)
+	assert.Equal(t, dns.TypeA, response.Answer[0].Header().Rrtype)
+}
+
+func TestDNS64Prefixes(t *testing.T) {
+	// Examples of https://www.rfc-editor.org/rfc/rfc6052#section-2.4
+	tests := map[string]string{
+		"2001:db8::/32":         "2001:db8:c000:221::",
+		"2001:db8:100::/40":     "2001:db8:1c0:2:21::",
+		"2001:db8:122::/48":     "2001:db8:122:c000:2:2100::",
+		"2001:db8:122:300::/56": "2001:db8:122:3c0:0:221::",
+		"2001:db8:122:344::/64": "2001:db8:122:344:c0:2:2100:0",
+		"2001:db8:122:344::/96": "2001:db8:122:344::192.0.2.33",
+	}
+	for prefix, expected := range tests {
+		p, err := NewDNS64Plugin(DNS64Config{Prefix: prefix}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, net.ParseIP(expected), p.synthesize(net.ParseIP("192.0.2.33")), prefix)
+	}
+
+	for _, prefix := range []string{"", "192.0.2.0/24", "2001:db8::/80"} {
+		_, err := NewDNS64Plugin(DNS64Config{Prefix: prefix}, nil)
+		assert.Error(t, err, prefix)
+	}
+}
@@ -0,0 +1,52 @@
+package tunneldns
+
+import (
+	"context"
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultDNSPort = "53"
+)
+
+// UpstreamDNS is the upstream implementation for plain DNS resolvers, e.g. internal resolvers of a private network.
+// Queries are sent over UDP and retried over TCP when the response is truncated.
+type UpstreamDNS struct {
+	udpClient *dns.Client
+	tcpClient *dns.Client
+	address   string
+	log       *zerolog.Logger
+}
+
+// NewUpstreamDNS creates a new plain DNS upstream from an address, e.g. 10.0.0.53 or 10.0.0.53:5353
+func NewUpstreamDNS(address string, log *zerolog.Logger) (Upstream, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, defaultDNSPort)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, errors.Wrapf(err, "invalid DNS resolver address %s", address)
+	}
+	return &UpstreamDNS{
+		udpClient: &dns.Client{Net: "udp", Timeout: defaultTimeout},
+		tcpClient: &dns.Client{Net: "tcp", Timeout: defaultTimeout},
+		address:   address,
+		log:       log,
+	}, nil
+}
+
+// Exchange provides an implementation for the Upstream interface
+func (u *UpstreamDNS) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	response, _, err := u.udpClient.ExchangeContext(ctx, query, u.address)
+	if err == nil && response.Truncated {
+		response, _, err = u.tcpClient.ExchangeContext(ctx, query, u.address)
+	}
+	if err != nil {
+		u.log.Err(err).Msgf("failed to connect to a DNS backend %q", u.address)
+		return nil, errors.Wrap(err, "failed to perform a DNS exchange")
+	}
+	return response, nil
+}
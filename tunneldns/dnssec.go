@@ -0,0 +1,550 @@
+package tunneldns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// DNSSEC validation modes
+const (
+	// Responses are not validated
+	DNSSECOff = "off"
+	// Responses are validated, bogus ones are logged but still answered without the AD bit
+	DNSSECPermissive = "permissive"
+	// Responses are validated, bogus ones are answered with SERVFAIL
+	DNSSECEnforce = "enforce"
+
+	minZoneCacheTTL = time.Minute
+	maxZoneCacheTTL = time.Hour
+)
+
+// DS records of the root zone KSKs, see https://data.iana.org/root-anchors/root-anchors.xml
+var defaultTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+var supportedAlgorithms = map[uint8]bool{
+	dns.RSASHA1:          true,
+	dns.RSASHA1NSEC3SHA1: true,
+	dns.RSASHA256:        true,
+	dns.RSASHA512:        true,
+	dns.ECDSAP256SHA256:  true,
+	dns.ECDSAP384SHA384:  true,
+	dns.ED25519:          true,
+}
+
+var supportedDigests = map[uint8]bool{
+	dns.SHA1:   true,
+	dns.SHA256: true,
+	dns.SHA384: true,
+}
+
+// DNSSECConfig configures the DNSSEC validation of the DNS proxy
+type DNSSECConfig struct {
+	// One of DNSSECOff (default if empty), DNSSECPermissive or DNSSECEnforce
+	Mode string
+	// DS records of the root zone in presentation format, the current root KSKs are used if empty
+	TrustAnchors []string
+}
+
+type validationResult string
+
+const (
+	resultSecure   validationResult = "secure"
+	resultInsecure validationResult = "insecure"
+	resultBogus    validationResult = "bogus"
+)
+
+type delegationKind int
+
+const (
+	// The name is not a zone cut, it belongs to the zone of its parent
+	notDelegated delegationKind = iota
+	// The name is a zone cut without DS records, the zone and everything below it is unsigned
+	insecureDelegation
+	// The name is a zone cut with a validated DS record
+	secureDelegation
+)
+
+type delegation struct {
+	kind delegationKind
+	// Validated DNSKEYs of the zone of a secure delegation
+	keys    []*dns.DNSKEY
+	expires time.Time
+}
+
+// DNSSECPlugin validates responses of the next plugin by building the chain of trust from the root trust anchors,
+// and sets the AD bit of secure responses. Validation is skipped for queries with the CD bit set.
+//
+// Signatures are verified for every RRset of the answer and authority sections, and denials of existence of DS
+// records are checked to tell insecure delegations apart. Whether NSEC/NSEC3 records of negative answers cover the
+// queried name is not checked, which is left to the upstreams.
+type DNSSECPlugin struct {
+	Next    plugin.Handler
+	mode    string
+	anchors []*dns.DS
+	log     *zerolog.Logger
+
+	lock        sync.Mutex
+	delegations map[string]*delegation
+
+	now func() time.Time
+}
+
+// NewDNSSECPlugin creates a DNSSEC plugin, or returns an error if the config is invalid
+func NewDNSSECPlugin(config DNSSECConfig, next plugin.Handler, log *zerolog.Logger) (*DNSSECPlugin, error) {
+	p := &DNSSECPlugin{
+		Next:        next,
+		mode:        config.Mode,
+		log:         log,
+		delegations: make(map[string]*delegation),
+		now:         time.Now,
+	}
+	switch config.Mode {
+	case "":
+		p.mode = DNSSECOff
+	case DNSSECOff, DNSSECPermissive, DNSSECEnforce:
+	default:
+		return nil, fmt.Errorf("unknown DNSSEC mode %q, use %s, %s or %s", config.Mode, DNSSECOff, DNSSECPermissive, DNSSECEnforce)
+	}
+
+	anchors := config.TrustAnchors
+	if len(anchors) == 0 {
+		anchors = defaultTrustAnchors
+	}
+	for _, anchor := range anchors {
+		rr, err := dns.NewRR(anchor)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trust anchor %q", anchor)
+		}
+		ds, ok := rr.(*dns.DS)
+		if !ok || ds.Hdr.Name != "." {
+			return nil, fmt.Errorf("trust anchor %q is not a DS record of the root zone", anchor)
+		}
+		p.anchors = append(p.anchors, ds)
+	}
+	return p, nil
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *DNSSECPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if p.mode == DNSSECOff || len(r.Question) != 1 {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+
+	clientOpt := r.IsEdns0()
+	clientDO := clientOpt != nil && clientOpt.Do()
+	query := r.Copy()
+	if opt := query.IsEdns0(); opt != nil {
+		opt.SetDo()
+	} else {
+		query.SetEdns0(dns.DefaultMsgSize, true)
+	}
+
+	cw := &captureWriter{ResponseWriter: w}
+	status, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, cw, query)
+	if cw.msg == nil {
+		return status, err
+	}
+	response := cw.msg.Copy()
+
+	if !r.CheckingDisabled {
+		result, validationErr := p.validate(ctx, response)
+		dnssecValidations.WithLabelValues(string(result)).Inc()
+		response.AuthenticatedData = result == resultSecure && (clientDO || r.AuthenticatedData)
+		if result == resultBogus {
+			p.log.Warn().Err(validationErr).Str(LogFieldDomain, r.Question[0].Name).Msg("DNSSEC validation failed")
+			if p.mode == DNSSECEnforce {
+				response = bogusResponse(r, validationErr)
+				clientDO = true // keep the extended error
+			}
+		}
+	}
+
+	if !clientDO {
+		stripDNSSEC(response, r.Question[0].Qtype)
+	}
+	if clientOpt == nil {
+		removeOPT(response)
+	} else if opt := response.IsEdns0(); opt != nil {
+		opt.SetDo(clientDO)
+	}
+	_ = w.WriteMsg(response)
+	return status, err
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *DNSSECPlugin) Name() string { return "dnssec" }
+
+// validate returns whether all the RRsets of the answer, or of the authority section if there's no answer, are secure
+func (p *DNSSECPlugin) validate(ctx context.Context, response *dns.Msg) (validationResult, error) {
+	if response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError {
+		return resultInsecure, nil
+	}
+	section := response.Answer
+	if len(section) == 0 {
+		section = response.Ns
+	}
+	if len(section) == 0 {
+		// A negative answer without SOA or denial records can only come from an unsigned zone
+		_, keys, err := p.chainOfTrust(ctx, response.Question[0].Name)
+		if err != nil {
+			return resultBogus, err
+		}
+		if keys != nil {
+			return resultBogus, errors.New("negative answer from a signed zone has no proof")
+		}
+		return resultInsecure, nil
+	}
+
+	result := resultSecure
+	rrsets, sigs := splitRRsets(section)
+	for key, rrset := range rrsets {
+		secure, err := p.validateRRset(ctx, rrset, sigs[key])
+		if err != nil {
+			return resultBogus, errors.Wrapf(err, "%s %s", key.name, dns.TypeToString[key.rrtype])
+		}
+		if !secure {
+			result = resultInsecure
+		}
+	}
+	return result, nil
+}
+
+// validateRRset returns whether rrset is signed by a zone with a chain of trust, or an error if it's bogus
+func (p *DNSSECPlugin) validateRRset(ctx context.Context, rrset []dns.RR, sigs []*dns.RRSIG) (bool, error) {
+	owner := rrset[0].Header().Name
+	if len(sigs) == 0 {
+		_, keys, err := p.chainOfTrust(ctx, owner)
+		if err != nil {
+			return false, err
+		}
+		if keys != nil {
+			return false, errors.New("RRset of a signed zone has no signature")
+		}
+		return false, nil
+	}
+
+	signer := dns.CanonicalName(sigs[0].SignerName)
+	if !dns.IsSubDomain(signer, dns.CanonicalName(owner)) {
+		return false, fmt.Errorf("signer %s is not a parent of %s", signer, owner)
+	}
+	zone, keys, err := p.chainOfTrust(ctx, signer)
+	if err != nil {
+		return false, err
+	}
+	if keys == nil {
+		return false, nil
+	}
+	if zone != signer {
+		return false, fmt.Errorf("signer %s is not a zone, expected %s", signer, zone)
+	}
+	return true, p.verify(rrset, sigs, keys)
+}
+
+// chainOfTrust walks down the delegations from the root to name, and returns the closest zone enclosing name with
+// its validated keys. The keys are nil if a delegation on the way is insecure.
+func (p *DNSSECPlugin) chainOfTrust(ctx context.Context, name string) (string, []*dns.DNSKEY, error) {
+	zone := "."
+	keys, err := p.rootKeys(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	labels := dns.SplitDomainName(dns.CanonicalName(name))
+	for i := len(labels) - 1; i >= 0; i-- {
+		child := dns.Fqdn(strings.Join(labels[i:], "."))
+		d, err := p.delegation(ctx, zone, keys, child)
+		if err != nil {
+			return "", nil, err
+		}
+		switch d.kind {
+		case insecureDelegation:
+			return child, nil, nil
+		case secureDelegation:
+			zone, keys = child, d.keys
+		}
+	}
+	return zone, keys, nil
+}
+
+func (p *DNSSECPlugin) rootKeys(ctx context.Context) ([]*dns.DNSKEY, error) {
+	if d := p.cached("."); d != nil {
+		return d.keys, nil
+	}
+	keys, ttl, err := p.zoneKeys(ctx, ".", p.anchors)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to validate the root keys with the trust anchors")
+	}
+	d := &delegation{kind: secureDelegation, keys: keys}
+	p.store(".", d, ttl)
+	return keys, nil
+}
+
+// delegation finds out whether child, a subdomain of zone, is a secure or insecure zone cut, or not a zone cut
+func (p *DNSSECPlugin) delegation(ctx context.Context, zone string, zoneKeys []*dns.DNSKEY, child string) (*delegation, error) {
+	if d := p.cached(child); d != nil {
+		return d, nil
+	}
+
+	response, err := p.lookup(ctx, child, dns.TypeDS)
+	if err != nil {
+		return nil, err
+	}
+	d := &delegation{kind: notDelegated}
+	ttl := maxZoneCacheTTL
+
+	rrsets, sigs := splitRRsets(response.Answer)
+	dsKey := rrsetKey{name: child, rrtype: dns.TypeDS}
+	if ds := rrsets[dsKey]; len(ds) > 0 && response.Rcode == dns.RcodeSuccess {
+		if err := p.verify(ds, sigs[dsKey], zoneKeys); err != nil {
+			return nil, errors.Wrapf(err, "DS records of %s", child)
+		}
+		var supported []*dns.DS
+		for _, rr := range ds {
+			if rr := rr.(*dns.DS); supportedAlgorithms[rr.Algorithm] && supportedDigests[rr.DigestType] {
+				supported = append(supported, rr)
+			}
+		}
+		// Zones only signed with unsupported algorithms are treated as unsigned, see RFC 4035 section 5.2
+		d.kind = insecureDelegation
+		if len(supported) > 0 {
+			if d.keys, ttl, err = p.zoneKeys(ctx, child, supported); err != nil {
+				return nil, err
+			}
+			d.kind = secureDelegation
+		}
+		ttl = minDuration(ttl, rrsetTTL(ds))
+	} else {
+		// The absence of DS records must be proven by signed NSEC or NSEC3 records of the parent zone
+		denial, denialSigs := splitRRsets(response.Ns)
+		proven := false
+		for key, rrset := range denial {
+			if key.rrtype != dns.TypeNSEC && key.rrtype != dns.TypeNSEC3 {
+				continue
+			}
+			if err := p.verify(rrset, denialSigs[key], zoneKeys); err != nil {
+				return nil, errors.Wrapf(err, "denial of DS records of %s", child)
+			}
+			proven = true
+			ttl = minDuration(ttl, rrsetTTL(rrset))
+		}
+		if !proven {
+			return nil, fmt.Errorf("absence of DS records of %s in signed zone %s is not proven", child, zone)
+		}
+		if response.Rcode == dns.RcodeNameError || isInsecureDelegation(child, response.Ns) {
+			// Names that don't exist in the public DNS, e.g. forwarded internal zones, can't be validated
+			d.kind = insecureDelegation
+		}
+	}
+
+	p.store(child, d, ttl)
+	return d, nil
+}
+
+// zoneKeys returns the DNSKEYs of zone once validated with a key matching one of the DS records
+func (p *DNSSECPlugin) zoneKeys(ctx context.Context, zone string, dsRecords []*dns.DS) ([]*dns.DNSKEY, time.Duration, error) {
+	response, err := p.lookup(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, 0, err
+	}
+	rrsets, sigs := splitRRsets(response.Answer)
+	key := rrsetKey{name: dns.CanonicalName(zone), rrtype: dns.TypeDNSKEY}
+	rrset := rrsets[key]
+
+	var keys, entryKeys []*dns.DNSKEY
+	for _, rr := range rrset {
+		dnskey := rr.(*dns.DNSKEY)
+		keys = append(keys, dnskey)
+		for _, ds := range dsRecords {
+			if dnskey.KeyTag() == ds.KeyTag && dnskey.Algorithm == ds.Algorithm {
+				if computed := dnskey.ToDS(ds.DigestType); computed != nil && strings.EqualFold(computed.Digest, ds.Digest) {
+					entryKeys = append(entryKeys, dnskey)
+				}
+			}
+		}
+	}
+	if len(entryKeys) == 0 {
+		return nil, 0, fmt.Errorf("no DNSKEY of %s matches its DS records", zone)
+	}
+	if err := p.verify(rrset, sigs[key], entryKeys); err != nil {
+		return nil, 0, errors.Wrapf(err, "DNSKEY records of %s", zone)
+	}
+	return keys, rrsetTTL(rrset), nil
+}
+
+// verify checks that one of sigs is a currently valid signature of rrset by one of keys
+func (p *DNSSECPlugin) verify(rrset []dns.RR, sigs []*dns.RRSIG, keys []*dns.DNSKEY) error {
+	if len(sigs) == 0 {
+		return errors.New("missing signature")
+	}
+	now := p.now()
+	var err error = errors.New("no key matches the signatures")
+	for _, sig := range sigs {
+		if !sig.ValidityPeriod(now) {
+			err = errors.New("signature is expired or not yet valid")
+			continue
+		}
+		for _, key := range keys {
+			if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+			if err = sig.Verify(key, rrset); err == nil {
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+// lookup sends a query for DNSSEC records to the next plugin
+func (p *DNSSECPlugin) lookup(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	query := new(dns.Msg)
+	query.SetQuestion(dns.CanonicalName(name), qtype)
+	query.SetEdns0(dns.DefaultMsgSize, true)
+	cw := &captureWriter{}
+	if _, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, cw, query); err != nil {
+		return nil, errors.Wrapf(err, "failed to look up %s %s", dns.TypeToString[qtype], name)
+	}
+	if cw.msg == nil {
+		return nil, fmt.Errorf("no response to %s %s", dns.TypeToString[qtype], name)
+	}
+	return cw.msg, nil
+}
+
+func (p *DNSSECPlugin) cached(name string) *delegation {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	d, ok := p.delegations[name]
+	if !ok || p.now().After(d.expires) {
+		return nil
+	}
+	return d
+}
+
+func (p *DNSSECPlugin) store(name string, d *delegation, ttl time.Duration) {
+	if ttl < minZoneCacheTTL {
+		ttl = minZoneCacheTTL
+	}
+	d.expires = p.now().Add(ttl)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.delegations[name] = d
+}
+
+// isInsecureDelegation returns whether the denial records of a DS query for name show it's a delegation point
+func isInsecureDelegation(name string, denial []dns.RR) bool {
+	for _, rr := range denial {
+		switch rr := rr.(type) {
+		case *dns.NSEC:
+			if dns.CanonicalName(rr.Hdr.Name) == name {
+				return hasBit(rr.TypeBitMap, dns.TypeNS) && !hasBit(rr.TypeBitMap, dns.TypeSOA)
+			}
+		case *dns.NSEC3:
+			if rr.Match(name) {
+				return hasBit(rr.TypeBitMap, dns.TypeNS) && !hasBit(rr.TypeBitMap, dns.TypeSOA)
+			}
+		}
+	}
+	// Unsigned delegations in an opt-out span are proven by a covering NSEC3 record, see RFC 5155 section 6
+	for _, rr := range denial {
+		if nsec3, ok := rr.(*dns.NSEC3); ok && nsec3.Flags&0x1 == 1 && nsec3.Cover(name) {
+			return true
+		}
+	}
+	return false
+}
+
+type rrsetKey struct {
+	name   string
+	rrtype uint16
+}
+
+// splitRRsets groups the records of a section by RRset, and their signatures by the RRset they cover
+func splitRRsets(section []dns.RR) (map[rrsetKey][]dns.RR, map[rrsetKey][]*dns.RRSIG) {
+	rrsets := make(map[rrsetKey][]dns.RR)
+	sigs := make(map[rrsetKey][]*dns.RRSIG)
+	for _, rr := range section {
+		name := dns.CanonicalName(rr.Header().Name)
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			key := rrsetKey{name: name, rrtype: sig.TypeCovered}
+			sigs[key] = append(sigs[key], sig)
+			continue
+		}
+		key := rrsetKey{name: name, rrtype: rr.Header().Rrtype}
+		rrsets[key] = append(rrsets[key], rr)
+	}
+	return rrsets, sigs
+}
+
+func bogusResponse(r *dns.Msg, err error) *dns.Msg {
+	response := new(dns.Msg)
+	response.SetRcode(r, dns.RcodeServerFailure)
+	response.SetEdns0(dns.DefaultMsgSize, true)
+	opt := response.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeDNSBogus, ExtraText: err.Error()})
+	return response
+}
+
+// stripDNSSEC removes the DNSSEC records a client didn't ask for, see RFC 4035 section 3.2.1
+func stripDNSSEC(msg *dns.Msg, qtype uint16) {
+	strip := func(section []dns.RR) []dns.RR {
+		kept := section[:0]
+		for _, rr := range section {
+			switch rrtype := rr.Header().Rrtype; rrtype {
+			case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+				if rrtype != qtype {
+					continue
+				}
+			}
+			kept = append(kept, rr)
+		}
+		return kept
+	}
+	msg.Answer = strip(msg.Answer)
+	msg.Ns = strip(msg.Ns)
+}
+
+func removeOPT(msg *dns.Msg) {
+	extra := msg.Extra[:0]
+	for _, rr := range msg.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+	msg.Extra = extra
+}
+
+func hasBit(bitmap []uint16, rrtype uint16) bool {
+	for _, t := range bitmap {
+		if t == rrtype {
+			return true
+		}
+	}
+	return false
+}
+
+func rrsetTTL(rrset []dns.RR) time.Duration {
+	ttl := maxZoneCacheTTL
+	for _, rr := range rrset {
+		ttl = minDuration(ttl, time.Duration(rr.Header().Ttl)*time.Second)
+	}
+	return ttl
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,203 @@
+package tunneldns
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type zoneKey struct {
+	dnskey *dns.DNSKEY
+	signer crypto.Signer
+}
+
+func newZoneKey(t *testing.T, zone string) *zoneKey {
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := dnskey.Generate(256)
+	require.NoError(t, err)
+	return &zoneKey{dnskey: dnskey, signer: priv.(crypto.Signer)}
+}
+
+func (k *zoneKey) sign(t *testing.T, rrset ...dns.RR) []dns.RR {
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rrset[0].Header().Ttl},
+		Algorithm:  k.dnskey.Algorithm,
+		KeyTag:     k.dnskey.KeyTag(),
+		SignerName: k.dnskey.Hdr.Name,
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+	}
+	require.NoError(t, sig.Sign(k.signer, rrset))
+	return append(rrset, sig)
+}
+
+// zoneServer answers queries from a fixed set of sections, and with NXDOMAIN for anything else
+type zoneServer map[string][]dns.RR
+
+func (z zoneServer) add(qtype uint16, name string, records ...dns.RR) {
+	key := fmt.Sprintf("%s/%d", name, qtype)
+	z[key] = append(z[key], records...)
+}
+
+func (z zoneServer) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	response := new(dns.Msg)
+	response.SetReply(r)
+	records, ok := z[fmt.Sprintf("%s/%d", r.Question[0].Name, r.Question[0].Qtype)]
+	if !ok {
+		response.Rcode = dns.RcodeNameError
+	}
+	for _, rr := range records {
+		if rr.Header().Rrtype == dns.TypeNSEC || (rr.Header().Rrtype == dns.TypeRRSIG && rr.(*dns.RRSIG).TypeCovered == dns.TypeNSEC) {
+			response.Ns = append(response.Ns, rr)
+		} else {
+			response.Answer = append(response.Answer, rr)
+		}
+	}
+	response.SetEdns0(dns.DefaultMsgSize, true)
+	_ = w.WriteMsg(response)
+	return dns.RcodeSuccess, nil
+}
+
+func (z zoneServer) Name() string { return "zone" }
+
+func rr(t *testing.T, s string) dns.RR {
+	record, err := dns.NewRR(s)
+	require.NoError(t, err)
+	return record
+}
+
+// signedZones creates a root zone delegating securely to example. and insecurely to unsigned.
+func signedZones(t *testing.T) (zoneServer, []string) {
+	root := newZoneKey(t, ".")
+	example := newZoneKey(t, "example.")
+	zones := zoneServer{}
+
+	zones.add(dns.TypeDNSKEY, ".", root.sign(t, root.dnskey)...)
+	zones.add(dns.TypeDS, "example.", root.sign(t, example.dnskey.ToDS(dns.SHA256))...)
+	zones.add(dns.TypeDNSKEY, "example.", example.sign(t, example.dnskey)...)
+	zones.add(dns.TypeDS, "unsigned.", root.sign(t, rr(t, "unsigned. 3600 IN NSEC v. NS RRSIG NSEC"))...)
+
+	zones.add(dns.TypeA, "www.example.", example.sign(t, rr(t, "www.example. 300 IN A 192.0.2.1"))...)
+	zones.add(dns.TypeDS, "www.example.", example.sign(t, rr(t, "www.example. 3600 IN NSEC zzz.example. A RRSIG NSEC"))...)
+
+	bogus := example.sign(t, rr(t, "bogus.example. 300 IN A 192.0.2.1"))
+	bogus[0].(*dns.A).A = net.ParseIP("192.0.2.66")
+	zones.add(dns.TypeA, "bogus.example.", bogus...)
+	zones.add(dns.TypeDS, "bogus.example.", example.sign(t, rr(t, "bogus.example. 3600 IN NSEC www.example. A RRSIG NSEC"))...)
+
+	zones.add(dns.TypeA, "stripped.example.", rr(t, "stripped.example. 300 IN A 192.0.2.1"))
+	zones.add(dns.TypeDS, "stripped.example.", example.sign(t, rr(t, "stripped.example. 3600 IN NSEC www.example. A RRSIG NSEC"))...)
+
+	zones.add(dns.TypeA, "www.unsigned.", rr(t, "www.unsigned. 300 IN A 192.0.2.1"))
+
+	return zones, []string{root.dnskey.ToDS(dns.SHA256).String()}
+}
+
+func serveDNSSEC(t *testing.T, p *DNSSECPlugin, name string, do, cd bool) *dns.Msg {
+	query := new(dns.Msg)
+	query.SetQuestion(name, dns.TypeA)
+	query.CheckingDisabled = cd
+	if do {
+		query.SetEdns0(dns.DefaultMsgSize, true)
+	}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	_, err := p.ServeDNS(context.Background(), rec, query)
+	require.NoError(t, err)
+	require.NotNil(t, rec.Msg)
+	return rec.Msg
+}
+
+func TestDNSSECValidation(t *testing.T) {
+	zones, anchors := signedZones(t)
+	p, err := NewDNSSECPlugin(DNSSECConfig{Mode: DNSSECEnforce, TrustAnchors: anchors}, zones, &testLogger)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		rcode int
+		ad    bool
+	}{
+		{name: "www.example.", rcode: dns.RcodeSuccess, ad: true},
+		{name: "www.unsigned.", rcode: dns.RcodeSuccess},
+		{name: "bogus.example.", rcode: dns.RcodeServerFailure},
+		{name: "stripped.example.", rcode: dns.RcodeServerFailure},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := serveDNSSEC(t, p, test.name, true, false)
+			assert.Equal(t, test.rcode, response.Rcode)
+			assert.Equal(t, test.ad, response.AuthenticatedData)
+			if test.rcode == dns.RcodeServerFailure {
+				opt := response.IsEdns0()
+				require.NotNil(t, opt)
+				require.Len(t, opt.Option, 1)
+				assert.Equal(t, dns.ExtendedErrorCodeDNSBogus, opt.Option[0].(*dns.EDNS0_EDE).InfoCode)
+			}
+		})
+	}
+}
+
+func TestDNSSECStripsRecordsWithoutDO(t *testing.T) {
+	zones, anchors := signedZones(t)
+	p, err := NewDNSSECPlugin(DNSSECConfig{Mode: DNSSECEnforce, TrustAnchors: anchors}, zones, &testLogger)
+	require.NoError(t, err)
+
+	withDO := serveDNSSEC(t, p, "www.example.", true, false)
+	assert.Len(t, withDO.Answer, 2)
+	assert.True(t, withDO.IsEdns0().Do())
+
+	withoutDO := serveDNSSEC(t, p, "www.example.", false, false)
+	require.Len(t, withoutDO.Answer, 1)
+	assert.Equal(t, dns.TypeA, withoutDO.Answer[0].Header().Rrtype)
+	assert.False(t, withoutDO.AuthenticatedData)
+	assert.Nil(t, withoutDO.IsEdns0())
+}
+
+func TestDNSSECModes(t *testing.T) {
+	zones, anchors := signedZones(t)
+
+	permissive, err := NewDNSSECPlugin(DNSSECConfig{Mode: DNSSECPermissive, TrustAnchors: anchors}, zones, &testLogger)
+	require.NoError(t, err)
+	response := serveDNSSEC(t, permissive, "bogus.example.", true, false)
+	assert.Equal(t, dns.RcodeSuccess, response.Rcode)
+	assert.False(t, response.AuthenticatedData)
+
+	// Clients setting CD do their own validation
+	enforce, err := NewDNSSECPlugin(DNSSECConfig{Mode: DNSSECEnforce, TrustAnchors: anchors}, zones, &testLogger)
+	require.NoError(t, err)
+	response = serveDNSSEC(t, enforce, "bogus.example.", true, true)
+	assert.Equal(t, dns.RcodeSuccess, response.Rcode)
+
+	// Wrong trust anchors make everything bogus
+	_, otherAnchors := signedZones(t)
+	enforce, err = NewDNSSECPlugin(DNSSECConfig{Mode: DNSSECEnforce, TrustAnchors: otherAnchors}, zones, &testLogger)
+	require.NoError(t, err)
+	response = serveDNSSEC(t, enforce, "www.example.", true, false)
+	assert.Equal(t, dns.RcodeServerFailure, response.Rcode)
+}
+
+func TestDNSSECInvalidConfig(t *testing.T) {
+	_, err := NewDNSSECPlugin(DNSSECConfig{Mode: "strict"}, nil, &testLogger)
+	assert.Error(t, err)
+	_, err = NewDNSSECPlugin(DNSSECConfig{Mode: DNSSECEnforce, TrustAnchors: []string{"example. IN A 192.0.2.1"}}, nil, &testLogger)
+	assert.Error(t, err)
+
+	p, err := NewDNSSECPlugin(DNSSECConfig{}, nil, &testLogger)
+	require.NoError(t, err)
+	assert.Equal(t, DNSSECOff, p.mode)
+	assert.Len(t, p.anchors, len(defaultTrustAnchors))
+}
@@ -0,0 +1,179 @@
+package tunneldns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DoHPath = "/dns-query"
+
+	dnsMessageContentType = "application/dns-message"
+	// Largest DNS message, see https://www.rfc-editor.org/rfc/rfc8484#section-6
+	maxDNSMessageSize = 65535
+)
+
+// DoHConfig configures the DNS over HTTPS and DNS over TLS servers of the DNS proxy
+type DoHConfig struct {
+	// Listen address of the DNS over HTTPS server, e.g. localhost:8443. The server is disabled if empty.
+	Address string
+	// Listen address of the DNS over TLS server (RFC 7858), e.g. localhost:853. The server is disabled if empty.
+	DoTAddress string
+	// Certificate and key of both servers. Without them, they serve a self-signed certificate generated at startup.
+	CertFile string
+	KeyFile  string
+}
+
+// DoHServer serves DNS over HTTPS (RFC 8484) queries with a plugin chain
+type DoHServer struct {
+	server  *http.Server
+	handler plugin.Handler
+	log     *zerolog.Logger
+}
+
+// NewDoHServer creates a DNS over HTTPS server answering queries with handler, over TLS with tlsConfig
+func NewDoHServer(config DoHConfig, tlsConfig *tls.Config, handler plugin.Handler, log *zerolog.Logger) *DoHServer {
+	s := &DoHServer{handler: handler, log: log}
+	mux := http.NewServeMux()
+	mux.Handle(DoHPath, s)
+	s.server = &http.Server{
+		Addr:              config.Address,
+		Handler:           mux,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: defaultTimeout,
+	}
+	return s
+}
+
+// Serve accepts connections on listener until the server is shut down
+func (s *DoHServer) Serve(listener net.Listener) error {
+	// The certificate is the one of the TLS configuration
+	err := s.server.ServeTLS(listener, "", "")
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops the server
+func (s *DoHServer) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// ServeHTTP implements http.Handler for GET and POST requests, see https://www.rfc-editor.org/rfc/rfc8484#section-4.1
+func (s *DoHServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf []byte
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		buf, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dnsMessageContentType {
+			http.Error(w, fmt.Sprintf("content type must be %s", dnsMessageContentType), http.StatusUnsupportedMediaType)
+			return
+		}
+		buf, err = ioutil.ReadAll(io.LimitReader(r.Body, maxDNSMessageSize))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil || len(buf) == 0 {
+		http.Error(w, "missing or malformed DNS query", http.StatusBadRequest)
+		return
+	}
+
+	query := new(dns.Msg)
+	if err := query.Unpack(buf); err != nil {
+		http.Error(w, "malformed DNS query", http.StatusBadRequest)
+		return
+	}
+
+	rw := newDoHResponseWriter(r)
+	status, err := s.handler.ServeDNS(r.Context(), rw, query)
+	response := rw.msg
+	if response == nil {
+		// Same as CoreDNS, plugins that fail without writing a response leave it to the server
+		if err != nil {
+			s.log.Debug().Err(err).Msg("Failed to answer DNS over HTTPS query")
+		}
+		response = new(dns.Msg)
+		response.SetRcode(query, status)
+	}
+
+	packed, err := response.Pack()
+	if err != nil {
+		http.Error(w, "failed to pack DNS response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", dnsMessageContentType)
+	w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(minTTL(response)), 10))
+	_, _ = w.Write(packed)
+}
+
+// minTTL returns the lowest TTL of the records of msg, the freshness lifetime of a DNS over HTTPS response
+func minTTL(msg *dns.Msg) uint32 {
+	var ttl uint32
+	for i, rr := range allRecords(msg) {
+		if i == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	return ttl
+}
+
+// dohResponseWriter is a dns.ResponseWriter that keeps the response to write it as an HTTP response
+type dohResponseWriter struct {
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	msg        *dns.Msg
+}
+
+func newDoHResponseWriter(r *http.Request) *dohResponseWriter {
+	rw := &dohResponseWriter{
+		localAddr:  &net.TCPAddr{},
+		remoteAddr: &net.TCPAddr{},
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		rw.localAddr = addr
+	}
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		rw.remoteAddr = addr
+	}
+	return rw
+}
+
+func (rw *dohResponseWriter) LocalAddr() net.Addr  { return rw.localAddr }
+func (rw *dohResponseWriter) RemoteAddr() net.Addr { return rw.remoteAddr }
+
+func (rw *dohResponseWriter) WriteMsg(msg *dns.Msg) error {
+	rw.msg = msg
+	return nil
+}
+
+func (rw *dohResponseWriter) Write(buf []byte) (int, error) {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(buf); err != nil {
+		return 0, err
+	}
+	rw.msg = msg
+	return len(buf), nil
+}
+
+func (rw *dohResponseWriter) Close() error        { return nil }
+func (rw *dohResponseWriter) TsigStatus() error   { return nil }
+func (rw *dohResponseWriter) TsigTimersOnly(bool) {}
+func (rw *dohResponseWriter) Hijack()             {}
@@ -0,0 +1,160 @@
+package tunneldns
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selfSignedTLSConfig returns the server TLS configuration generated without a certificate, and a client
+// configuration trusting it
+func selfSignedTLSConfig(t *testing.T) (*tls.Config, *tls.Config) {
+	serverConfig, err := serverTLSConfig(DoHConfig{Address: "localhost:0"}, &testLogger)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(serverConfig.Certificates[0].Leaf)
+	return serverConfig, &tls.Config{RootCAs: roots, ServerName: "localhost"}
+}
+
+func newTestDoHServer(t *testing.T, handler plugin.Handler) *DoHServer {
+	serverConfig, _ := selfSignedTLSConfig(t)
+	return NewDoHServer(DoHConfig{Address: "localhost:0"}, serverConfig, handler, &testLogger)
+}
+
+func TestDoHServer(t *testing.T) {
+	serverConfig, clientConfig := selfSignedTLSConfig(t)
+	next := &mockHandler{response: aResponse(120)}
+	doh := NewDoHServer(DoHConfig{Address: "localhost:0"}, serverConfig, next, &testLogger)
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go func() {
+		_ = doh.Serve(listener)
+	}()
+	defer doh.Shutdown()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+	url := "https://" + listener.Addr().String()
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	// Clients should use 0 as ID to improve cache friendliness, see https://www.rfc-editor.org/rfc/rfc8484#section-4.1
+	query.Id = 0
+	buf, err := query.Pack()
+	require.NoError(t, err)
+
+	getResp, err := client.Get(url + DoHPath + "?dns=" + base64.RawURLEncoding.EncodeToString(buf))
+	require.NoError(t, err)
+	postResp, err := client.Post(url+DoHPath, dnsMessageContentType, bytes.NewReader(buf))
+	require.NoError(t, err)
+
+	for _, resp := range []*http.Response{getResp, postResp} {
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, dnsMessageContentType, resp.Header.Get("Content-Type"))
+		assert.Equal(t, "max-age=120", resp.Header.Get("Cache-Control"))
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		response := new(dns.Msg)
+		require.NoError(t, response.Unpack(body))
+		require.Len(t, response.Answer, 1)
+		assert.Equal(t, "192.0.2.1", response.Answer[0].(*dns.A).A.String())
+	}
+}
+
+func TestDoTServer(t *testing.T) {
+	serverConfig, clientConfig := selfSignedTLSConfig(t)
+	dot, err := newDoTServer("localhost:0", serverConfig, &mockHandler{response: aResponse(120)})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go func() {
+		_ = dot.Serve(listener)
+	}()
+	defer dot.Stop()
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	client := &dns.Client{Net: "tcp-tls", TLSConfig: clientConfig}
+	response, _, err := client.Exchange(query, listener.Addr().String())
+	require.NoError(t, err)
+	require.Len(t, response.Answer, 1)
+	assert.Equal(t, "192.0.2.1", response.Answer[0].(*dns.A).A.String())
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	serverConfig, err := serverTLSConfig(DoHConfig{Address: "192.0.2.10:8443", DoTAddress: "[::]:853"}, &testLogger)
+	require.NoError(t, err)
+	leaf := serverConfig.Certificates[0].Leaf
+	assert.Equal(t, []string{"localhost"}, leaf.DNSNames)
+	require.Len(t, leaf.IPAddresses, 3)
+	assert.Equal(t, "192.0.2.10", leaf.IPAddresses[2].String())
+
+	_, err = serverTLSConfig(DoHConfig{Address: "localhost:0", CertFile: "cert.pem"}, &testLogger)
+	assert.Error(t, err)
+}
+
+func TestDoHServerUpstreamFailure(t *testing.T) {
+	doh := newTestDoHServer(t, &mockHandler{})
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	buf, err := query.Pack()
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, DoHPath, bytes.NewReader(buf))
+	req.Header.Set("Content-Type", dnsMessageContentType)
+	rec := httptest.NewRecorder()
+	doh.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	response := new(dns.Msg)
+	require.NoError(t, response.Unpack(rec.Body.Bytes()))
+	assert.Equal(t, dns.RcodeServerFailure, response.Rcode)
+	assert.Equal(t, query.Id, response.Id)
+}
+
+func TestDoHServerInvalidRequests(t *testing.T) {
+	doh := newTestDoHServer(t, &mockHandler{})
+
+	tests := []struct {
+		name     string
+		req      *http.Request
+		expected int
+	}{
+		{
+			name:     "missing query",
+			req:      httptest.NewRequest(http.MethodGet, DoHPath, nil),
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:     "malformed query",
+			req:      httptest.NewRequest(http.MethodGet, DoHPath+"?dns=AAAA", nil),
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:     "wrong content type",
+			req:      httptest.NewRequest(http.MethodPost, DoHPath, bytes.NewReader([]byte("query"))),
+			expected: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:     "unsupported method",
+			req:      httptest.NewRequest(http.MethodPut, DoHPath, nil),
+			expected: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		doh.ServeHTTP(rec, test.req)
+		assert.Equal(t, test.expected, rec.Code, test.name)
+	}
+}
@@ -0,0 +1,164 @@
+package tunneldns
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// EDNS Client Subnet (RFC 7871) policies
+const (
+	// Queries are sent upstream with the client subnet option they were received with, if any
+	ECSPassthrough = "passthrough"
+	// The client subnet option is removed from queries
+	ECSStrip = "strip"
+	// The client subnet option of queries is truncated to ECSTruncateIPv4PrefixLength/ECSTruncateIPv6PrefixLength bits
+	ECSTruncate = "truncate"
+	// The client subnet option of queries is replaced, or added, with a configured subnet
+	ECSOverride = "override"
+
+	ECSTruncateIPv4PrefixLength = 24
+	ECSTruncateIPv6PrefixLength = 56
+
+	ecsFamilyIPv4 = 1
+	ecsFamilyIPv6 = 2
+)
+
+// ECSConfig configures how the DNS proxy handles the EDNS Client Subnet option of queries
+type ECSConfig struct {
+	// One of ECSPassthrough (default if empty), ECSStrip, ECSTruncate or ECSOverride
+	Policy string
+	// Subnet sent upstream with the ECSOverride policy, e.g. 203.0.113.0/24
+	Subnet string
+}
+
+// ECSPlugin applies an EDNS Client Subnet policy to queries before sending them to the next plugin
+type ECSPlugin struct {
+	Next   plugin.Handler
+	policy string
+	subnet *dns.EDNS0_SUBNET
+}
+
+// NewECSPlugin creates an ECS plugin, or returns an error if the config is invalid
+func NewECSPlugin(config ECSConfig, next plugin.Handler) (*ECSPlugin, error) {
+	p := &ECSPlugin{Next: next, policy: config.Policy}
+	switch config.Policy {
+	case "":
+		p.policy = ECSPassthrough
+	case ECSPassthrough, ECSStrip, ECSTruncate:
+	case ECSOverride:
+		_, subnet, err := net.ParseCIDR(config.Subnet)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid EDNS Client Subnet")
+		}
+		p.subnet = newSubnetOption(subnet)
+	default:
+		return nil, fmt.Errorf("unknown EDNS Client Subnet policy %q, use %s, %s, %s or %s", config.Policy, ECSPassthrough, ECSStrip, ECSTruncate, ECSOverride)
+	}
+	return p, nil
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *ECSPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if p.policy == ECSPassthrough {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+
+	clientSubnet := findSubnetOption(r)
+	query := r.Copy()
+	switch p.policy {
+	case ECSStrip:
+		removeSubnetOption(query)
+	case ECSTruncate:
+		if subnet := findSubnetOption(query); subnet != nil {
+			truncateSubnetOption(subnet)
+		}
+	case ECSOverride:
+		removeSubnetOption(query)
+		opt := query.IsEdns0()
+		if opt == nil {
+			query.SetEdns0(dns.DefaultMsgSize, false)
+			opt = query.IsEdns0()
+		}
+		subnet := *p.subnet
+		opt.Option = append(opt.Option, &subnet)
+	}
+
+	cw := &captureWriter{ResponseWriter: w}
+	status, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, cw, query)
+	if cw.msg == nil {
+		return status, err
+	}
+
+	// The response carries the option only if the query did, see https://www.rfc-editor.org/rfc/rfc7871#section-7.2.2
+	response := cw.msg.Copy()
+	removeSubnetOption(response)
+	if clientSubnet != nil {
+		if opt := response.IsEdns0(); opt != nil {
+			echo := *clientSubnet
+			echo.SourceScope = 0
+			opt.Option = append(opt.Option, &echo)
+		}
+	}
+	_ = w.WriteMsg(response)
+	return status, err
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *ECSPlugin) Name() string { return "ecs" }
+
+func newSubnetOption(subnet *net.IPNet) *dns.EDNS0_SUBNET {
+	ones, _ := subnet.Mask.Size()
+	option := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		SourceNetmask: uint8(ones),
+	}
+	if ip4 := subnet.IP.To4(); ip4 != nil {
+		option.Family = ecsFamilyIPv4
+		option.Address = ip4
+	} else {
+		option.Family = ecsFamilyIPv6
+		option.Address = subnet.IP
+	}
+	return option
+}
+
+func truncateSubnetOption(subnet *dns.EDNS0_SUBNET) {
+	maxLength, bits := uint8(ECSTruncateIPv4PrefixLength), 32
+	if subnet.Family == ecsFamilyIPv6 {
+		maxLength, bits = ECSTruncateIPv6PrefixLength, 128
+	}
+	if subnet.SourceNetmask > maxLength {
+		subnet.SourceNetmask = maxLength
+	}
+	subnet.Address = subnet.Address.Mask(net.CIDRMask(int(subnet.SourceNetmask), bits))
+}
+
+func findSubnetOption(msg *dns.Msg) *dns.EDNS0_SUBNET {
+	if opt := msg.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			if subnet, ok := option.(*dns.EDNS0_SUBNET); ok {
+				return subnet
+			}
+		}
+	}
+	return nil
+}
+
+func removeSubnetOption(msg *dns.Msg) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return
+	}
+	options := opt.Option[:0]
+	for _, option := range opt.Option {
+		if option.Option() != dns.EDNS0SUBNET {
+			options = append(options, option)
+		}
+	}
+	opt.Option = options
+}
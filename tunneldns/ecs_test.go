@@ -0,0 +1,103 @@
+package tunneldns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ecsRecorder records the client subnet option of the queries it receives, and answers with it like an ECS aware
+// upstream would
+type ecsRecorder struct {
+	subnet *dns.EDNS0_SUBNET
+}
+
+func (h *ecsRecorder) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	h.subnet = findSubnetOption(r)
+	response := aResponse(60)(r)
+	if opt := r.IsEdns0(); opt != nil {
+		response.Extra = append(response.Extra, dns.Copy(opt))
+	}
+	_ = w.WriteMsg(response)
+	return dns.RcodeSuccess, nil
+}
+
+func (h *ecsRecorder) Name() string { return "ecsRecorder" }
+
+func queryWithSubnet(cidr string) *dns.Msg {
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	query.SetEdns0(dns.DefaultMsgSize, false)
+	if cidr != "" {
+		_, subnet, _ := net.ParseCIDR(cidr)
+		opt := query.IsEdns0()
+		opt.Option = append(opt.Option, newSubnetOption(subnet))
+	}
+	return query
+}
+
+func serveECS(t *testing.T, config ECSConfig, query *dns.Msg) (sent *dns.EDNS0_SUBNET, received *dns.Msg) {
+	next := &ecsRecorder{}
+	ecs, err := NewECSPlugin(config, next)
+	require.NoError(t, err)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	_, err = ecs.ServeDNS(context.Background(), rec, query)
+	require.NoError(t, err)
+	require.NotNil(t, rec.Msg)
+	return next.subnet, rec.Msg
+}
+
+func TestECSPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ECSConfig
+		query    string
+		expected string
+	}{
+		{name: "passthrough", config: ECSConfig{}, query: "198.51.100.7/32", expected: "198.51.100.7/32"},
+		{name: "strip", config: ECSConfig{Policy: ECSStrip}, query: "198.51.100.7/32"},
+		{name: "truncate IPv4", config: ECSConfig{Policy: ECSTruncate}, query: "198.51.100.7/32", expected: "198.51.100.0/24"},
+		{name: "truncate IPv6", config: ECSConfig{Policy: ECSTruncate}, query: "2001:db8:1:2:3::1/128", expected: "2001:db8:1::/56"},
+		{name: "truncate short prefix", config: ECSConfig{Policy: ECSTruncate}, query: "198.51.0.0/16", expected: "198.51.0.0/16"},
+		{name: "override", config: ECSConfig{Policy: ECSOverride, Subnet: "203.0.113.0/24"}, query: "198.51.100.7/32", expected: "203.0.113.0/24"},
+		{name: "override without subnet", config: ECSConfig{Policy: ECSOverride, Subnet: "203.0.113.0/24"}, expected: "203.0.113.0/24"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sent, received := serveECS(t, test.config, queryWithSubnet(test.query))
+			if test.expected == "" {
+				assert.Nil(t, sent)
+			} else {
+				require.NotNil(t, sent)
+				_, expected, err := net.ParseCIDR(test.expected)
+				require.NoError(t, err)
+				ones, _ := expected.Mask.Size()
+				assert.Equal(t, uint8(ones), sent.SourceNetmask)
+				assert.True(t, expected.IP.Equal(sent.Address), sent.Address.String())
+			}
+
+			// The client only gets back the subnet it sent
+			echo := findSubnetOption(received)
+			if test.query == "" {
+				assert.Nil(t, echo)
+			} else {
+				require.NotNil(t, echo)
+				_, expected, _ := net.ParseCIDR(test.query)
+				assert.True(t, expected.IP.Equal(echo.Address))
+			}
+		})
+	}
+}
+
+func TestECSInvalidConfig(t *testing.T) {
+	_, err := NewECSPlugin(ECSConfig{Policy: "random"}, nil)
+	assert.Error(t, err)
+	_, err = NewECSPlugin(ECSConfig{Policy: ECSOverride}, nil)
+	assert.Error(t, err)
+}
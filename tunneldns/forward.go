@@ -0,0 +1,131 @@
+package tunneldns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	LogFieldDomain = "domain"
+)
+
+type forwardZone struct {
+	// Fully qualified, lowercase domain
+	zone           string
+	subdomainsOnly bool
+	upstreams      ProxyPlugin
+	resolvers      []string
+}
+
+func (z *forwardZone) matches(name string) bool {
+	if name == z.zone {
+		return !z.subdomainsOnly
+	}
+	return dns.IsSubDomain(z.zone, name)
+}
+
+// ForwardPlugin sends queries for configured domains to their designated resolvers (split-horizon DNS), and every
+// other query to the next plugin
+type ForwardPlugin struct {
+	Next plugin.Handler
+	log  *zerolog.Logger
+
+	lock  sync.RWMutex
+	zones []*forwardZone
+}
+
+// NewForwardPlugin creates a forward plugin without rules
+func NewForwardPlugin(next plugin.Handler, log *zerolog.Logger) *ForwardPlugin {
+	return &ForwardPlugin{Next: next, log: log}
+}
+
+// Update replaces the forwarding rules. The previous rules are kept if any of the new ones is invalid.
+func (p *ForwardPlugin) Update(rules []ForwardRule, bootstraps []string, maxUpstreamConnections int) error {
+	zones, err := p.newZones(rules, bootstraps, maxUpstreamConnections)
+	if err != nil {
+		return err
+	}
+	p.setZones(zones)
+	return nil
+}
+
+// newZones creates the upstreams of the forwarding rules and validates them, without changing the rules applied
+func (p *ForwardPlugin) newZones(rules []ForwardRule, bootstraps []string, maxUpstreamConnections int) ([]*forwardZone, error) {
+	var zones []*forwardZone
+	for i, rule := range rules {
+		if len(rule.Resolvers) == 0 {
+			return nil, fmt.Errorf("forward rule #%d has no resolvers", i+1)
+		}
+		upstreams := ProxyPlugin{}
+		for _, resolver := range rule.Resolvers {
+			var upstream Upstream
+			var err error
+			if strings.Contains(resolver, "://") {
+				upstream, err = newUpstream(resolver, bootstraps, maxUpstreamConnections, p.log)
+			} else {
+				upstream, err = NewUpstreamDNS(resolver, p.log)
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "forward rule #%d has an invalid resolver", i+1)
+			}
+			upstreams.Upstreams = append(upstreams.Upstreams, instrumentUpstream(resolver, upstream))
+		}
+		for _, domain := range rule.Domains {
+			zone := &forwardZone{upstreams: upstreams, resolvers: rule.Resolvers}
+			if strings.HasPrefix(domain, "*.") {
+				zone.subdomainsOnly = true
+				domain = strings.TrimPrefix(domain, "*.")
+			}
+			if _, ok := dns.IsDomainName(domain); !ok || domain == "" {
+				return nil, fmt.Errorf("forward rule #%d has an invalid domain %q", i+1, domain)
+			}
+			zone.zone = dns.CanonicalName(domain)
+			zones = append(zones, zone)
+		}
+	}
+
+	return zones, nil
+}
+
+func (p *ForwardPlugin) setZones(zones []*forwardZone) {
+	for _, zone := range zones {
+		p.log.Info().Str(LogFieldDomain, zone.zone).Strs("resolvers", zone.resolvers).Msg("Adding DNS forwarding rule")
+	}
+	p.lock.Lock()
+	p.zones = zones
+	p.lock.Unlock()
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *ForwardPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if len(r.Question) == 1 {
+		if zone := p.match(dns.CanonicalName(r.Question[0].Name)); zone != nil {
+			return zone.upstreams.ServeDNS(ctx, w, r)
+		}
+	}
+	return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *ForwardPlugin) Name() string { return "forward" }
+
+// match returns the most specific zone matching name, if any
+func (p *ForwardPlugin) match(name string) *forwardZone {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	var best *forwardZone
+	for _, zone := range p.zones {
+		if zone.matches(name) && (best == nil || dns.CountLabel(zone.zone) > dns.CountLabel(best.zone)) {
+			best = zone
+		}
+	}
+	return best
+}
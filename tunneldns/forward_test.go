@@ -0,0 +1,122 @@
+package tunneldns
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startDNSServer(t *testing.T) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			_ = w.WriteMsg(answer(r))
+		}),
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	return conn.LocalAddr().String(), func() { _ = server.Shutdown() }
+}
+
+func TestForwardPlugin(t *testing.T) {
+	resolver, stop := startDNSServer(t)
+	defer stop()
+
+	next := &mockHandler{response: aResponse(60)}
+	forwarder := NewForwardPlugin(next, &testLogger)
+	require.NoError(t, forwarder.Update([]ForwardRule{
+		{Domains: []string{"corp.internal", "*.lab.example.com"}, Resolvers: []string{resolver}},
+	}, nil, MaxUpstreamConnsDefault))
+
+	tests := []struct {
+		name      string
+		forwarded bool
+	}{
+		{name: "corp.internal.", forwarded: true},
+		{name: "git.CORP.internal.", forwarded: true},
+		{name: "lab.example.com.", forwarded: false},
+		{name: "nas.lab.example.com.", forwarded: true},
+		{name: "example.com.", forwarded: false},
+		{name: "notcorp.internal.", forwarded: false},
+	}
+	for _, test := range tests {
+		next.calls = 0
+		require.NotNil(t, serve(t, forwarder, test.name), test.name)
+		assert.Equal(t, !test.forwarded, next.calls == 1, test.name)
+	}
+}
+
+func TestForwardPluginMostSpecificRuleWins(t *testing.T) {
+	forwarder := NewForwardPlugin(nil, &testLogger)
+	require.NoError(t, forwarder.Update([]ForwardRule{
+		{Domains: []string{"internal"}, Resolvers: []string{"10.0.0.1"}},
+		{Domains: []string{"corp.internal"}, Resolvers: []string{"10.0.0.2"}},
+	}, nil, MaxUpstreamConnsDefault))
+
+	zone := forwarder.match("git.corp.internal.")
+	require.NotNil(t, zone)
+	assert.Equal(t, "corp.internal.", zone.zone)
+	assert.Equal(t, "10.0.0.2:53", zone.upstreams.Upstreams[0].(*instrumentedUpstream).Upstream.(*UpstreamDNS).address)
+}
+
+func TestForwardPluginInvalidRules(t *testing.T) {
+	forwarder := NewForwardPlugin(nil, &testLogger)
+	require.NoError(t, forwarder.Update([]ForwardRule{
+		{Domains: []string{"corp.internal"}, Resolvers: []string{"10.0.0.1"}},
+	}, nil, MaxUpstreamConnsDefault))
+
+	assert.Error(t, forwarder.Update([]ForwardRule{{Domains: []string{"corp.internal"}}}, nil, MaxUpstreamConnsDefault))
+	assert.Error(t, forwarder.Update([]ForwardRule{
+		{Domains: []string{"corp.internal"}, Resolvers: []string{"ftp://10.0.0.1"}},
+	}, nil, MaxUpstreamConnsDefault))
+	// The previous rules are kept
+	assert.NotNil(t, forwarder.match("corp.internal."))
+}
+
+func TestListenerReloadsRules(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, ioutil.WriteFile(rulesFile, []byte(`
+forward:
+  - domains: [corp.internal]
+    resolvers: [10.0.0.1]
+`), 0600))
+
+	listener, err := CreateListener(ListenerConfig{
+		Address:   "127.0.0.1",
+		Port:      0,
+		Cache:     DefaultCacheConfig(),
+		RulesFile: rulesFile,
+	}, &testLogger)
+	require.NoError(t, err)
+	assert.NotNil(t, listener.forwarder.match("corp.internal."))
+
+	require.NoError(t, ioutil.WriteFile(rulesFile, []byte(`
+forward:
+  - domains: [home.arpa]
+    resolvers: [192.168.1.1]
+`), 0600))
+	listener.WatcherItemDidChange(rulesFile)
+	assert.Nil(t, listener.forwarder.match("corp.internal."))
+	assert.NotNil(t, listener.forwarder.match("nas.home.arpa."))
+
+	require.NoError(t, ioutil.WriteFile(rulesFile, []byte(`forward: [`), 0600))
+	listener.WatcherItemDidChange(rulesFile)
+	assert.NotNil(t, listener.forwarder.match("nas.home.arpa."))
+
+	// Valid records aren't applied when the forwarding rules are invalid
+	require.NoError(t, ioutil.WriteFile(rulesFile, []byte(`
+records:
+  - {name: nas.home.arpa, type: A, value: 192.168.1.10}
+forward:
+  - domains: [corp.internal]
+`), 0600))
+	listener.WatcherItemDidChange(rulesFile)
+	assert.Nil(t, listener.local.lookup("nas.home.arpa."))
+	assert.NotNil(t, listener.forwarder.match("nas.home.arpa."))
+}
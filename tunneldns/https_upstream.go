@@ -45,26 +45,37 @@ func (u *UpstreamHTTPS) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg,
 		return nil, errors.Wrap(err, "failed to pack DNS query")
 	}
 
-	if len(query.Question) > 0 && query.Question[0].Name == fmt.Sprintf("%s.", u.endpoint.Hostname()) {
-		for _, bootstrap := range u.bootstraps {
-			endpoint, client, err := configureBootstrap(bootstrap)
-			if err != nil {
-				u.log.Err(err).Msgf("failed to configure bootstrap upstream %s", bootstrap)
-				continue
-			}
-			msg, err := exchange(queryBuf, query.Id, endpoint, client, u.log)
-			if err != nil {
-				u.log.Err(err).Msgf("failed to connect to a bootstrap upstream %s", bootstrap)
-				continue
-			}
-			return msg, nil
-		}
-		return nil, fmt.Errorf("failed to reach any bootstrap upstream: %v", u.bootstraps)
+	if isBootstrapQuery(query, u.endpoint.Hostname(), u.bootstraps) {
+		return exchangeBootstrap(queryBuf, query.Id, u.bootstraps, u.log)
 	}
 
 	return exchange(queryBuf, query.Id, u.endpoint, u.client, u.log)
 }
 
+// isBootstrapQuery returns true if query resolves the hostname of an upstream, which is sent to the bootstrap upstreams
+// so that the upstream can be reached when the system resolver is the DNS proxy itself
+func isBootstrapQuery(query *dns.Msg, hostname string, bootstraps []string) bool {
+	return len(bootstraps) > 0 && len(query.Question) > 0 && query.Question[0].Name == fmt.Sprintf("%s.", hostname)
+}
+
+// exchangeBootstrap sends a packed query to the bootstrap upstreams in order until one of them answers
+func exchangeBootstrap(queryBuf []byte, queryID uint16, bootstraps []string, log *zerolog.Logger) (*dns.Msg, error) {
+	for _, bootstrap := range bootstraps {
+		endpoint, client, err := configureBootstrap(bootstrap)
+		if err != nil {
+			log.Err(err).Msgf("failed to configure bootstrap upstream %s", bootstrap)
+			continue
+		}
+		msg, err := exchange(queryBuf, queryID, endpoint, client, log)
+		if err != nil {
+			log.Err(err).Msgf("failed to connect to a bootstrap upstream %s", bootstrap)
+			continue
+		}
+		return msg, nil
+	}
+	return nil, fmt.Errorf("failed to reach any bootstrap upstream: %v", bootstraps)
+}
+
 func exchange(msg []byte, queryID uint16, endpoint *url.URL, client *http.Client, log *zerolog.Logger) (*dns.Msg, error) {
 	// No content negotiation for now, use DNS wire format
 	buf, backendErr := exchangeWireformat(msg, endpoint, client)
@@ -0,0 +1,251 @@
+package tunneldns
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+const (
+	LocalRecordTTLDefault = 60
+	// Limit of CNAME records followed when answering from local records
+	maxCNAMEChain = 8
+)
+
+// LocalRecord is a static DNS record answered by the proxy itself
+type LocalRecord struct {
+	Name string `yaml:"name"`
+	// One of A, AAAA, CNAME or TXT
+	Type  string `yaml:"type"`
+	Value string `yaml:"value"`
+	// Defaults to LocalRecordTTLDefault seconds
+	TTL uint32 `yaml:"ttl"`
+}
+
+func (r LocalRecord) toRR() (dns.RR, error) {
+	if _, ok := dns.IsDomainName(r.Name); !ok || r.Name == "" {
+		return nil, fmt.Errorf("invalid name %q", r.Name)
+	}
+	ttl := r.TTL
+	if ttl == 0 {
+		ttl = LocalRecordTTLDefault
+	}
+	rrType, ok := dns.StringToType[strings.ToUpper(r.Type)]
+	if !ok {
+		return nil, fmt.Errorf("unknown record type %q", r.Type)
+	}
+	hdr := dns.RR_Header{Name: dns.CanonicalName(r.Name), Rrtype: rrType, Class: dns.ClassINET, Ttl: ttl}
+
+	switch rrType {
+	case dns.TypeA:
+		ip := net.ParseIP(r.Value)
+		if ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("%q is not an IPv4 address", r.Value)
+		}
+		return &dns.A{Hdr: hdr, A: ip.To4()}, nil
+	case dns.TypeAAAA:
+		ip := net.ParseIP(r.Value)
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("%q is not an IPv6 address", r.Value)
+		}
+		return &dns.AAAA{Hdr: hdr, AAAA: ip}, nil
+	case dns.TypeCNAME:
+		if _, ok := dns.IsDomainName(r.Value); !ok || r.Value == "" {
+			return nil, fmt.Errorf("%q is not a domain name", r.Value)
+		}
+		return &dns.CNAME{Hdr: hdr, Target: dns.CanonicalName(r.Value)}, nil
+	case dns.TypeTXT:
+		return &dns.TXT{Hdr: hdr, Txt: []string{r.Value}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported record type %s, use A, AAAA, CNAME or TXT", r.Type)
+	}
+}
+
+// LocalPlugin answers queries for names with local records, from the rules file or hosts files, and sends every
+// other query to the next plugin
+type LocalPlugin struct {
+	Next plugin.Handler
+
+	lock    sync.RWMutex
+	records map[string][]dns.RR
+}
+
+// NewLocalPlugin creates a local plugin without records
+func NewLocalPlugin(next plugin.Handler) *LocalPlugin {
+	return &LocalPlugin{Next: next}
+}
+
+// Update replaces the local records. The previous records are kept if any of the new ones is invalid.
+func (p *LocalPlugin) Update(localRecords []LocalRecord, hostsFiles []string) error {
+	records, err := newLocalRecords(localRecords, hostsFiles)
+	if err != nil {
+		return err
+	}
+	p.setRecords(records)
+	return nil
+}
+
+// newLocalRecords reads the hosts files and validates the local records, without changing the records answered
+func newLocalRecords(localRecords []LocalRecord, hostsFiles []string) (map[string][]dns.RR, error) {
+	records := make(map[string][]dns.RR)
+	for _, path := range hostsFiles {
+		if err := readHostsFile(path, records); err != nil {
+			return nil, err
+		}
+	}
+	// Records from the rules file take precedence over hosts files
+	overridden := make(map[string]bool)
+	for i, localRecord := range localRecords {
+		rr, err := localRecord.toRR()
+		if err != nil {
+			return nil, errors.Wrapf(err, "local record #%d is invalid", i+1)
+		}
+		name := rr.Header().Name
+		if !overridden[name] {
+			delete(records, name)
+			overridden[name] = true
+		}
+		records[name] = append(records[name], rr)
+	}
+	for name, rrs := range records {
+		if hasType(rrs, dns.TypeCNAME) && len(rrs) > 1 {
+			return nil, fmt.Errorf("%s has a CNAME record and other records", name)
+		}
+	}
+	return records, nil
+}
+
+func (p *LocalPlugin) setRecords(records map[string][]dns.RR) {
+	p.lock.Lock()
+	p.records = records
+	p.lock.Unlock()
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *LocalPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	if len(r.Question) != 1 || r.Question[0].Qclass != dns.ClassINET {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+	question := r.Question[0]
+	rrs := p.lookup(dns.CanonicalName(question.Name))
+	if rrs == nil {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+
+	reply := new(dns.Msg)
+	reply.SetReply(r)
+	reply.Authoritative = true
+	for i := 0; i < maxCNAMEChain; i++ {
+		if answers := filterType(rrs, question.Qtype); len(answers) > 0 || question.Qtype == dns.TypeCNAME {
+			reply.Answer = append(reply.Answer, answers...)
+			break
+		}
+		cname, ok := firstOfType(rrs, dns.TypeCNAME).(*dns.CNAME)
+		if !ok {
+			// The name exists but has no record of this type
+			break
+		}
+		reply.Answer = append(reply.Answer, dns.Copy(cname))
+		if rrs = p.lookup(cname.Target); rrs == nil {
+			p.resolveTarget(ctx, w, r, cname.Target, reply)
+			break
+		}
+	}
+
+	_ = w.WriteMsg(reply)
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *LocalPlugin) Name() string { return "local" }
+
+// resolveTarget resolves a CNAME target that has no local records with the next plugin
+func (p *LocalPlugin) resolveTarget(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, target string, reply *dns.Msg) {
+	query := r.Copy()
+	query.Question[0].Name = target
+	cw := &captureWriter{ResponseWriter: w}
+	if _, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, cw, query); err != nil || cw.msg == nil {
+		reply.Rcode = dns.RcodeServerFailure
+		return
+	}
+	reply.Rcode = cw.msg.Rcode
+	reply.Answer = append(reply.Answer, cw.msg.Answer...)
+}
+
+func (p *LocalPlugin) lookup(name string) []dns.RR {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.records[name]
+}
+
+// readHostsFile adds A and AAAA records for each entry of a hosts file, in the format of /etc/hosts
+func readHostsFile(path string, records map[string][]dns.RR) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open hosts file")
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// Zone suffixes (e.g. fe80::1%lo0) aren't part of the address
+		ip := net.ParseIP(strings.SplitN(fields[0], "%", 2)[0])
+		if ip == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			if _, ok := dns.IsDomainName(name); !ok {
+				continue
+			}
+			record := LocalRecord{Name: name, Value: ip.String(), Type: "AAAA"}
+			if ip.To4() != nil {
+				record.Type = "A"
+			}
+			rr, err := record.toRR()
+			if err != nil {
+				continue
+			}
+			records[rr.Header().Name] = append(records[rr.Header().Name], rr)
+		}
+	}
+	return errors.Wrapf(scanner.Err(), "failed to read hosts file %s", path)
+}
+
+func filterType(rrs []dns.RR, rrType uint16) []dns.RR {
+	var filtered []dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == rrType {
+			filtered = append(filtered, dns.Copy(rr))
+		}
+	}
+	return filtered
+}
+
+func firstOfType(rrs []dns.RR, rrType uint16) dns.RR {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == rrType {
+			return rr
+		}
+	}
+	return nil
+}
+
+func hasType(rrs []dns.RR, rrType uint16) bool {
+	return firstOfType(rrs, rrType) != nil
+}
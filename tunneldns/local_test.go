@@ -0,0 +1,100 @@
+package tunneldns
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveType(t *testing.T, local *LocalPlugin, name string, qtype uint16) *dns.Msg {
+	query := new(dns.Msg)
+	query.SetQuestion(name, qtype)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	_, err := local.ServeDNS(context.Background(), rec, query)
+	require.NoError(t, err)
+	require.NotNil(t, rec.Msg)
+	return rec.Msg
+}
+
+func TestLocalPlugin(t *testing.T) {
+	hostsFile := filepath.Join(t.TempDir(), "hosts")
+	require.NoError(t, ioutil.WriteFile(hostsFile, []byte(`
+# homelab
+192.168.1.10  nas nas.home.arpa
+fd00::10      nas.home.arpa # IPv6
+192.168.1.11  printer.home.arpa
+`), 0600))
+
+	next := &mockHandler{response: aResponse(60)}
+	local := NewLocalPlugin(next)
+	require.NoError(t, local.Update([]LocalRecord{
+		{Name: "printer.home.arpa", Type: "A", Value: "192.168.1.99", TTL: 300},
+		{Name: "files.home.arpa", Type: "CNAME", Value: "nas.home.arpa"},
+		{Name: "docs.home.arpa", Type: "cname", Value: "docs.example.com"},
+		{Name: "home.arpa", Type: "TXT", Value: "v=spf1 -all"},
+	}, []string{hostsFile}))
+
+	response := serveType(t, local, "NAS.home.arpa.", dns.TypeA)
+	require.Len(t, response.Answer, 1)
+	assert.True(t, response.Authoritative)
+	assert.Equal(t, "192.168.1.10", response.Answer[0].(*dns.A).A.String())
+
+	response = serveType(t, local, "nas.home.arpa.", dns.TypeAAAA)
+	require.Len(t, response.Answer, 1)
+	assert.Equal(t, "fd00::10", response.Answer[0].(*dns.AAAA).AAAA.String())
+
+	// Records of the rules file override the hosts files
+	response = serveType(t, local, "printer.home.arpa.", dns.TypeA)
+	require.Len(t, response.Answer, 1)
+	assert.Equal(t, "192.168.1.99", response.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, uint32(300), response.Answer[0].Header().Ttl)
+
+	// Known name without records of this type
+	response = serveType(t, local, "printer.home.arpa.", dns.TypeAAAA)
+	assert.Equal(t, dns.RcodeSuccess, response.Rcode)
+	assert.Empty(t, response.Answer)
+
+	// CNAME to a local name
+	response = serveType(t, local, "files.home.arpa.", dns.TypeA)
+	require.Len(t, response.Answer, 2)
+	assert.Equal(t, "nas.home.arpa.", response.Answer[0].(*dns.CNAME).Target)
+	assert.Equal(t, "192.168.1.10", response.Answer[1].(*dns.A).A.String())
+
+	// CNAME to a name resolved by the next plugin
+	response = serveType(t, local, "docs.home.arpa.", dns.TypeA)
+	require.Len(t, response.Answer, 2)
+	assert.Equal(t, "docs.example.com.", response.Answer[1].Header().Name)
+	assert.Equal(t, 1, next.calls)
+
+	response = serveType(t, local, "home.arpa.", dns.TypeTXT)
+	require.Len(t, response.Answer, 1)
+	assert.Equal(t, []string{"v=spf1 -all"}, response.Answer[0].(*dns.TXT).Txt)
+
+	serveType(t, local, "example.com.", dns.TypeA)
+	assert.Equal(t, 2, next.calls)
+}
+
+func TestLocalPluginInvalidRecords(t *testing.T) {
+	local := NewLocalPlugin(nil)
+	for _, record := range []LocalRecord{
+		{Name: "a.home.arpa", Type: "A", Value: "fd00::1"},
+		{Name: "a.home.arpa", Type: "AAAA", Value: "192.168.1.1"},
+		{Name: "a.home.arpa", Type: "MX", Value: "mail.home.arpa"},
+		{Name: "a.home.arpa", Type: "UNKNOWN", Value: "x"},
+		{Name: "", Type: "A", Value: "192.168.1.1"},
+	} {
+		assert.Error(t, local.Update([]LocalRecord{record}, nil), record)
+	}
+	assert.Error(t, local.Update([]LocalRecord{
+		{Name: "a.home.arpa", Type: "CNAME", Value: "b.home.arpa"},
+		{Name: "a.home.arpa", Type: "A", Value: "192.168.1.1"},
+	}, nil))
+	assert.Error(t, local.Update(nil, []string{filepath.Join(t.TempDir(), "missing")}))
+}
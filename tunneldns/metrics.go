@@ -2,6 +2,7 @@ package tunneldns
 
 import (
 	"context"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metrics"
@@ -10,12 +11,139 @@ import (
 	"github.com/coredns/coredns/plugin/pkg/rcode"
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
 	pluginName = "cloudflared"
+
+	metricsNamespace = "cloudflared"
+	dnsSubsystem     = "dns"
+
+	// Label of query types and response codes without a name, so that random values don't blow up the cardinality
+	otherLabel = "other"
+	// Label of upstream exchanges that failed without a response
+	errorLabel = "error"
+)
+
+var durationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+var (
+	cacheHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: dnsSubsystem,
+			Name:      "cache_hits_total",
+			Help:      "Count of DNS queries answered from the cache",
+		},
+	)
+	cacheMisses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: dnsSubsystem,
+			Name:      "cache_misses_total",
+			Help:      "Count of DNS queries not found in the cache or expired",
+		},
+	)
+	cacheStaleServed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: dnsSubsystem,
+			Name:      "cache_stale_served_total",
+			Help:      "Count of expired cached responses served because no upstream answered",
+		},
+	)
+	cacheEntries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: dnsSubsystem,
+			Name:      "cache_entries",
+			Help:      "Number of responses in the DNS cache",
+		},
+	)
+	dnssecValidations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: dnsSubsystem,
+			Name:      "dnssec_validations_total",
+			Help:      "Count of DNSSEC validated responses by result",
+		},
+		[]string{"result"},
+	)
+	queriesByType = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: dnsSubsystem,
+			Name:      "queries_total",
+			Help:      "Count of DNS queries by query type",
+		},
+		[]string{"qtype"},
+	)
+	responsesByRcode = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: dnsSubsystem,
+			Name:      "responses_total",
+			Help:      "Count of DNS responses by response code",
+		},
+		[]string{"rcode"},
+	)
+	queryDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: dnsSubsystem,
+			Name:      "query_duration_seconds",
+			Help:      "Time to answer DNS queries by query type",
+			Buckets:   durationBuckets,
+		},
+		[]string{"qtype"},
+	)
+	upstreamResponses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: dnsSubsystem,
+			Name:      "upstream_responses_total",
+			Help:      "Count of DNS queries sent upstream by upstream and response code, or error if the upstream didn't answer",
+		},
+		[]string{"upstream", "rcode"},
+	)
+	upstreamDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: dnsSubsystem,
+			Name:      "upstream_duration_seconds",
+			Help:      "Time for upstreams to answer DNS queries",
+			Buckets:   durationBuckets,
+		},
+		[]string{"upstream"},
+	)
+	upstreamHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: dnsSubsystem,
+			Name:      "upstream_healthy",
+			Help:      "Whether an upstream is healthy (1) or is only tried after the healthy ones failed (0)",
+		},
+		[]string{"upstream"},
+	)
 )
 
+func init() {
+	prometheus.MustRegister(
+		cacheHits,
+		cacheMisses,
+		cacheStaleServed,
+		cacheEntries,
+		dnssecValidations,
+		queriesByType,
+		responsesByRcode,
+		queryDuration,
+		upstreamResponses,
+		upstreamDuration,
+		upstreamHealthy,
+	)
+}
+
 // MetricsPlugin is an adapter for CoreDNS and built-in metrics
 type MetricsPlugin struct {
 	Next plugin.Handler
@@ -37,8 +165,52 @@ func (p MetricsPlugin) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dn
 	server := metrics.WithServer(ctx)
 	vars.Report(server, state, ".", rcode.ToString(rw.Rcode), pluginName, rw.Len, rw.Start)
 
+	qtype := qtypeLabel(state.QType())
+	queriesByType.WithLabelValues(qtype).Inc()
+	responsesByRcode.WithLabelValues(rcodeLabel(rw.Rcode)).Inc()
+	queryDuration.WithLabelValues(qtype).Observe(time.Since(rw.Start).Seconds())
+	topDomains.add(state.Name())
+
 	return status, err
 }
 
 // Name implements the CoreDNS plugin interface
 func (p MetricsPlugin) Name() string { return "metrics" }
+
+// instrumentedUpstream records the response codes and latency of an upstream
+type instrumentedUpstream struct {
+	Upstream
+	name string
+}
+
+// instrumentUpstream wraps upstream to export its metrics labelled with name, e.g. its endpoint
+func instrumentUpstream(name string, upstream Upstream) Upstream {
+	return &instrumentedUpstream{Upstream: upstream, name: name}
+}
+
+// Exchange provides an implementation for the Upstream interface
+func (u *instrumentedUpstream) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	start := time.Now()
+	response, err := u.Upstream.Exchange(ctx, query)
+	upstreamDuration.WithLabelValues(u.name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		upstreamResponses.WithLabelValues(u.name, errorLabel).Inc()
+	} else {
+		upstreamResponses.WithLabelValues(u.name, rcodeLabel(response.Rcode)).Inc()
+	}
+	return response, err
+}
+
+func qtypeLabel(qtype uint16) string {
+	if name, ok := dns.TypeToString[qtype]; ok {
+		return name
+	}
+	return otherLabel
+}
+
+func rcodeLabel(code int) string {
+	if name, ok := dns.RcodeToString[code]; ok {
+		return name
+	}
+	return otherLabel
+}
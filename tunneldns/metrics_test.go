@@ -0,0 +1,44 @@
+package tunneldns
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type upstreamFunc func(ctx context.Context, query *dns.Msg) (*dns.Msg, error)
+
+func (f upstreamFunc) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	return f(ctx, query)
+}
+
+func TestInstrumentedUpstream(t *testing.T) {
+	ok := instrumentUpstream("ok.test", upstreamFunc(func(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+		return aResponse(60)(query), nil
+	}))
+	failing := instrumentUpstream("failing.test", upstreamFunc(func(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+		return nil, errors.New("timeout")
+	}))
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	for i := 0; i < 2; i++ {
+		_, _ = ok.Exchange(context.Background(), query)
+		_, _ = failing.Exchange(context.Background(), query)
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(upstreamResponses.WithLabelValues("ok.test", "NOERROR")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(upstreamResponses.WithLabelValues("failing.test", errorLabel)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(upstreamResponses.WithLabelValues("failing.test", "NOERROR")))
+}
+
+func TestMetricLabels(t *testing.T) {
+	assert.Equal(t, "AAAA", qtypeLabel(dns.TypeAAAA))
+	assert.Equal(t, otherLabel, qtypeLabel(65000))
+	assert.Equal(t, "NXDOMAIN", rcodeLabel(dns.RcodeNameError))
+	assert.Equal(t, otherLabel, rcodeLabel(3000))
+}
@@ -0,0 +1,157 @@
+package tunneldns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// ALPN token of DNS over QUIC, see https://www.rfc-editor.org/rfc/rfc9250#section-4.1
+	doqALPN = "doq"
+	// DOQ_NO_ERROR, used when closing idle connections
+	doqNoError = 0x0
+
+	doqIdleTimeout = 30 * time.Second
+)
+
+// UpstreamQUIC is the upstream implementation for DNS over QUIC service (RFC 9250).
+// A single QUIC connection is reused for all queries, each query using its own stream. When the upstream can't be
+// reached over QUIC (e.g. UDP is blocked), the query fails so that the upstream pool tries the other configured
+// upstreams.
+type UpstreamQUIC struct {
+	address    string
+	tlsConfig  *tls.Config
+	quicConfig *quic.Config
+	bootstraps []string
+	log        *zerolog.Logger
+
+	connLock sync.Mutex
+	conn     quic.Connection
+}
+
+// NewUpstreamQUIC creates a new DNS over QUIC upstream from endpoint, e.g. quic://dns.example.com. Queries for the
+// hostname of the endpoint are sent to the bootstrap upstreams.
+func NewUpstreamQUIC(endpoint string, bootstraps []string, log *zerolog.Logger) (Upstream, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	upstream := newUpstreamQUIC(upstreamAddress(u), &tls.Config{ServerName: u.Hostname()}, log)
+	upstream.bootstraps = bootstraps
+	return upstream, nil
+}
+
+func newUpstreamQUIC(address string, tlsConfig *tls.Config, log *zerolog.Logger) *UpstreamQUIC {
+	quicTLSConfig := tlsConfig.Clone()
+	quicTLSConfig.NextProtos = []string{doqALPN}
+	return &UpstreamQUIC{
+		address:   address,
+		tlsConfig: quicTLSConfig,
+		quicConfig: &quic.Config{
+			HandshakeIdleTimeout: defaultTimeout,
+			MaxIdleTimeout:       doqIdleTimeout,
+		},
+		log: log,
+	}
+}
+
+// Exchange provides an implementation for the Upstream interface
+func (u *UpstreamQUIC) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	if isBootstrapQuery(query, u.tlsConfig.ServerName, u.bootstraps) {
+		return exchangeBootstrapMsg(query, u.bootstraps, u.log)
+	}
+	response, err := u.exchangeQUIC(ctx, query)
+	if err != nil {
+		u.log.Err(err).Msgf("failed to connect to a QUIC backend %q", u.address)
+		return nil, err
+	}
+	return response, nil
+}
+
+func (u *UpstreamQUIC) exchangeQUIC(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	// The DNS Message ID must be 0 over QUIC, see https://www.rfc-editor.org/rfc/rfc9250#section-4.2.1
+	wireQuery := query.Copy()
+	wireQuery.Id = 0
+	queryBuf, err := wireQuery.Pack()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack DNS query")
+	}
+
+	conn, err := u.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		u.resetConnection(conn)
+		return nil, errors.Wrap(err, "failed to open a QUIC stream")
+	}
+	defer stream.CancelRead(doqNoError)
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	_ = stream.SetDeadline(deadline)
+
+	// Each message is prefixed by its length, and the client signals it won't send more data by closing its side
+	msg := make([]byte, 2+len(queryBuf))
+	binary.BigEndian.PutUint16(msg, uint16(len(queryBuf)))
+	copy(msg[2:], queryBuf)
+	if _, err := stream.Write(msg); err != nil {
+		return nil, errors.Wrap(err, "failed to write DNS query")
+	}
+	_ = stream.Close()
+
+	var length [2]byte
+	if _, err := io.ReadFull(stream, length[:]); err != nil {
+		return nil, errors.Wrap(err, "failed to read DNS response length")
+	}
+	responseBuf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(stream, responseBuf); err != nil {
+		return nil, errors.Wrap(err, "failed to read DNS response")
+	}
+
+	response := &dns.Msg{}
+	if err := response.Unpack(responseBuf); err != nil {
+		return nil, errors.Wrap(err, "failed to unpack DNS response")
+	}
+	response.Id = query.Id
+	return response, nil
+}
+
+// connection returns the current QUIC connection, dialing a new one if there is none or it was closed
+func (u *UpstreamQUIC) connection(ctx context.Context) (quic.Connection, error) {
+	u.connLock.Lock()
+	defer u.connLock.Unlock()
+
+	if u.conn != nil && u.conn.Context().Err() == nil {
+		return u.conn, nil
+	}
+	conn, err := quic.DialAddrContext(ctx, u.address, u.tlsConfig, u.quicConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to dial QUIC upstream")
+	}
+	u.conn = conn
+	return conn, nil
+}
+
+func (u *UpstreamQUIC) resetConnection(conn quic.Connection) {
+	u.connLock.Lock()
+	defer u.connLock.Unlock()
+
+	if u.conn == conn {
+		_ = conn.CloseWithError(doqNoError, "")
+		u.conn = nil
+	}
+}
@@ -0,0 +1,163 @@
+package tunneldns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/miekg/dns"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cfdquic "github.com/cloudflare/cloudflared/quic"
+)
+
+var testLogger = zerolog.Nop()
+
+func answer(query *dns.Msg) *dns.Msg {
+	response := new(dns.Msg)
+	response.SetReply(query)
+	response.Answer = append(response.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: query.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP("192.0.2.1"),
+	})
+	return response
+}
+
+func serveDoQ(t *testing.T, listener quic.Listener, connections *int32) {
+	for {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(connections, 1)
+		go func() {
+			for {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				var length [2]byte
+				if _, err := io.ReadFull(stream, length[:]); err != nil {
+					return
+				}
+				buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(stream, buf); err != nil {
+					return
+				}
+				query := new(dns.Msg)
+				require.NoError(t, query.Unpack(buf))
+				assert.Equal(t, uint16(0), query.Id)
+
+				responseBuf, err := answer(query).Pack()
+				require.NoError(t, err)
+				binary.BigEndian.PutUint16(length[:], uint16(len(responseBuf)))
+				_, _ = stream.Write(append(length[:], responseBuf...))
+				_ = stream.Close()
+			}
+		}()
+	}
+}
+
+func TestUpstreamQUICReusesConnection(t *testing.T) {
+	serverTLSConfig := cfdquic.GenerateTLSConfig()
+	serverTLSConfig.NextProtos = []string{doqALPN}
+	listener, err := quic.ListenAddr("127.0.0.1:0", serverTLSConfig, nil)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	var connections int32
+	go serveDoQ(t, listener, &connections)
+
+	upstream := newUpstreamQUIC(listener.Addr().String(), &tls.Config{InsecureSkipVerify: true}, &testLogger)
+	for i := 0; i < 3; i++ {
+		query := new(dns.Msg)
+		query.SetQuestion("example.com.", dns.TypeA)
+		response, err := upstream.Exchange(context.Background(), query)
+		require.NoError(t, err)
+		assert.Equal(t, query.Id, response.Id)
+		require.Len(t, response.Answer, 1)
+		assert.Equal(t, "192.0.2.1", response.Answer[0].(*dns.A).A.String())
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connections))
+}
+
+func TestUpstreamQUICFailsWithoutFallback(t *testing.T) {
+	serverTLSConfig := cfdquic.GenerateTLSConfig()
+	serverTLSConfig.NextProtos = nil
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverTLSConfig)
+	require.NoError(t, err)
+	server := &dns.Server{
+		Listener: listener,
+		Net:      "tcp-tls",
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			_ = w.WriteMsg(answer(r))
+		}),
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	defer server.Shutdown()
+
+	// Nothing listens for QUIC on this address, the query isn't sent over TLS to the same address but fails so that
+	// the pool tries the other upstreams
+	upstream := newUpstreamQUIC(listener.Addr().String(), &tls.Config{InsecureSkipVerify: true}, &testLogger)
+	upstream.quicConfig.HandshakeIdleTimeout = defaultTimeout / 10
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	_, err = upstream.Exchange(context.Background(), query)
+	assert.Error(t, err)
+}
+
+func TestUpstreamBootstraps(t *testing.T) {
+	var bootstrapped int32
+	bootstrap := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&bootstrapped, 1)
+		buf, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		query := new(dns.Msg)
+		require.NoError(t, query.Unpack(buf))
+		responseBuf, err := answer(query).Pack()
+		require.NoError(t, err)
+		_, _ = w.Write(responseBuf)
+	}))
+	defer bootstrap.Close()
+
+	for _, endpoint := range []string{"https://dns.example.com/dns-query", "tls://dns.example.com", "quic://dns.example.com"} {
+		upstream, err := newUpstream(endpoint, []string{bootstrap.URL}, MaxUpstreamConnsDefault, &testLogger)
+		require.NoError(t, err)
+		query := new(dns.Msg)
+		query.SetQuestion("dns.example.com.", dns.TypeA)
+		response, err := upstream.Exchange(context.Background(), query)
+		require.NoError(t, err, endpoint)
+		require.Len(t, response.Answer, 1)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&bootstrapped))
+}
+
+func TestNewUpstream(t *testing.T) {
+	for endpoint, expected := range map[string]interface{}{
+		"https://1.1.1.1/dns-query": &UpstreamHTTPS{},
+		"http://10.0.0.1/dns-query": &UpstreamHTTPS{},
+		"tls://1.1.1.1":             &UpstreamTLS{},
+		"quic://dns.example.com":    &UpstreamQUIC{},
+	} {
+		upstream, err := newUpstream(endpoint, nil, MaxUpstreamConnsDefault, &testLogger)
+		require.NoError(t, err)
+		assert.IsType(t, expected, upstream)
+	}
+
+	_, err := newUpstream("udp://1.1.1.1", nil, MaxUpstreamConnsDefault, &testLogger)
+	assert.Error(t, err)
+
+	upstream, err := NewUpstreamQUIC("quic://dns.example.com", nil, &testLogger)
+	require.NoError(t, err)
+	assert.Equal(t, "dns.example.com:853", upstream.(*UpstreamQUIC).address)
+}
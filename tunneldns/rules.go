@@ -0,0 +1,117 @@
+package tunneldns
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/cloudflare/cloudflared/watcher"
+)
+
+const (
+	LogFieldRulesFile = "rulesFile"
+)
+
+// Rules is the content of the proxy-dns rules file. It's reloaded whenever the file is written to.
+type Rules struct {
+	// Queries for these domains are sent to the given resolvers instead of the upstreams
+	Forward []ForwardRule `yaml:"forward"`
+	// Records answered locally, overriding the upstreams and forwarding rules
+	Records []LocalRecord `yaml:"records"`
+	// Paths of files in the /etc/hosts format whose entries are answered locally. They're reloaded when they change.
+	HostsFiles []string `yaml:"hosts-files"`
+}
+
+// ForwardRule sends queries for Domains and their subdomains to Resolvers. A domain of the form *.example.com only
+// matches subdomains of example.com. Resolvers are either plain DNS addresses (10.0.0.53, 10.0.0.53:5353) or
+// upstream URLs (https://, tls://, quic://). When several rules match, the most specific domain wins.
+type ForwardRule struct {
+	Domains   []string `yaml:"domains"`
+	Resolvers []string `yaml:"resolvers"`
+}
+
+// ReadRulesFile parses the YAML rules file at path
+func ReadRulesFile(path string) (*Rules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules Rules
+	if err := yaml.NewDecoder(file).Decode(&rules); err != nil && err != io.EOF {
+		return nil, errors.Wrapf(err, "error parsing YAML in rules file at %s", path)
+	}
+	return &rules, nil
+}
+
+// applyRules validates all the rules before applying any of them, so that invalid rules leave the previous ones
+// in place
+func (l *Listener) applyRules(rules *Rules) error {
+	records, err := newLocalRecords(rules.Records, rules.HostsFiles)
+	if err != nil {
+		return err
+	}
+	zones, err := l.forwarder.newZones(rules.Forward, l.config.Bootstraps, l.config.MaxUpstreamConnections)
+	if err != nil {
+		return err
+	}
+	l.rulesLock.Lock()
+	defer l.rulesLock.Unlock()
+	l.local.setRecords(records)
+	l.forwarder.setZones(zones)
+	l.hostsFiles = rules.HostsFiles
+	return nil
+}
+
+// watchRules reloads the rules file whenever it changes
+func (l *Listener) watchRules() error {
+	rulesWatcher, err := watcher.NewFile()
+	if err != nil {
+		return errors.Wrap(err, "failed to create a rules file watcher")
+	}
+	if err := rulesWatcher.Add(l.config.RulesFile); err != nil {
+		return errors.Wrapf(err, "failed to watch rules file %s", l.config.RulesFile)
+	}
+	l.rulesWatcher = rulesWatcher
+	l.watchHostsFiles()
+	go rulesWatcher.Start(l)
+	return nil
+}
+
+func (l *Listener) watchHostsFiles() {
+	l.rulesLock.Lock()
+	hostsFiles := l.hostsFiles
+	l.rulesLock.Unlock()
+	for _, path := range hostsFiles {
+		if err := l.rulesWatcher.Add(path); err != nil {
+			l.log.Err(err).Str(LogFieldRulesFile, path).Msg("Failed to watch hosts file, it won't be reloaded when it changes")
+		}
+	}
+}
+
+// WatcherItemDidChange implements the watcher.Notification interface. A change of the rules file or of any hosts file
+// it includes reloads all the rules.
+func (l *Listener) WatcherItemDidChange(path string) {
+	rules, err := ReadRulesFile(l.config.RulesFile)
+	if err == nil {
+		err = l.applyRules(rules)
+	}
+	if err != nil {
+		l.log.Err(err).Str(LogFieldRulesFile, path).Msg("Failed to reload DNS rules, keeping the previous ones")
+		return
+	}
+	if l.rulesWatcher != nil {
+		l.watchHostsFiles()
+	}
+	// Cached responses may have been resolved with the previous rules
+	l.cache.Flush()
+	l.log.Info().Str(LogFieldRulesFile, path).Msg("DNS rules have been reloaded")
+}
+
+// WatcherDidError implements the watcher.Notification interface
+func (l *Listener) WatcherDidError(err error) {
+	l.log.Err(err).Str(LogFieldRulesFile, l.config.RulesFile).Msg("DNS rules watcher encountered an error")
+}
@@ -0,0 +1,108 @@
+package tunneldns
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// selfSignedValidity is how long the certificate generated when none is configured is valid. It's generated again
+// every time the DNS proxy starts.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// serverTLSConfig returns the TLS configuration of the DNS over HTTPS and DNS over TLS servers, with the configured
+// certificate or a self-signed one
+func serverTLSConfig(config DoHConfig, log *zerolog.Logger) (*tls.Config, error) {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, errors.New("both a certificate and a key are required to serve DNS over HTTPS and DNS over TLS")
+	}
+	var certificate tls.Certificate
+	var err error
+	if config.CertFile != "" {
+		if certificate, err = tls.LoadX509KeyPair(config.CertFile, config.KeyFile); err != nil {
+			return nil, errors.Wrap(err, "failed to load the certificate to serve DNS over HTTPS and DNS over TLS")
+		}
+	} else {
+		if certificate, err = selfSignedCertificate(serverHosts(config.Address, config.DoTAddress)); err != nil {
+			return nil, errors.Wrap(err, "failed to generate a self-signed certificate to serve DNS over HTTPS and DNS over TLS")
+		}
+		pin := sha256.Sum256(certificate.Leaf.RawSubjectPublicKeyInfo)
+		log.Warn().
+			Str("spkiPin", base64.StdEncoding.EncodeToString(pin[:])).
+			Msg("Serving DNS over HTTPS and DNS over TLS with a self-signed certificate as none is configured, clients must pin it")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// serverHosts returns the names the self-signed certificate is valid for: the loopback addresses, and the hosts of
+// the listen addresses
+func serverHosts(addresses ...string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	for _, address := range addresses {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil || host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// selfSignedCertificate generates a certificate valid for hosts, which are names or IP addresses
+func selfSignedCertificate(hosts []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: "cloudflared proxy-dns"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
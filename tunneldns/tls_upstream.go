@@ -0,0 +1,80 @@
+package tunneldns
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// Default port of both DNS over TLS and DNS over QUIC
+	defaultSecureDNSPort = "853"
+)
+
+// UpstreamTLS is the upstream implementation for DNS over TLS service
+type UpstreamTLS struct {
+	client     *dns.Client
+	address    string
+	bootstraps []string
+	log        *zerolog.Logger
+}
+
+// NewUpstreamTLS creates a new DNS over TLS upstream from endpoint, e.g. tls://1.1.1.1. Queries for the hostname of
+// the endpoint are sent to the bootstrap upstreams.
+func NewUpstreamTLS(endpoint string, bootstraps []string, log *zerolog.Logger) (Upstream, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	upstream := newUpstreamTLS(upstreamAddress(u), &tls.Config{ServerName: u.Hostname()}, log)
+	upstream.bootstraps = bootstraps
+	return upstream, nil
+}
+
+func newUpstreamTLS(address string, tlsConfig *tls.Config, log *zerolog.Logger) *UpstreamTLS {
+	return &UpstreamTLS{
+		client: &dns.Client{
+			Net:       "tcp-tls",
+			TLSConfig: tlsConfig,
+			Timeout:   defaultTimeout,
+		},
+		address: address,
+		log:     log,
+	}
+}
+
+// Exchange provides an implementation for the Upstream interface
+func (u *UpstreamTLS) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	if isBootstrapQuery(query, u.client.TLSConfig.ServerName, u.bootstraps) {
+		return exchangeBootstrapMsg(query, u.bootstraps, u.log)
+	}
+	response, _, err := u.client.ExchangeContext(ctx, query, u.address)
+	if err != nil {
+		u.log.Err(err).Msgf("failed to connect to a TLS backend %q", u.address)
+		return nil, errors.Wrap(err, "failed to perform a DNS over TLS exchange")
+	}
+	return response, nil
+}
+
+// exchangeBootstrapMsg sends query to the bootstrap upstreams
+func exchangeBootstrapMsg(query *dns.Msg, bootstraps []string, log *zerolog.Logger) (*dns.Msg, error) {
+	queryBuf, err := query.Pack()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack DNS query")
+	}
+	return exchangeBootstrap(queryBuf, query.Id, bootstraps, log)
+}
+
+// upstreamAddress returns the host:port to dial for a DNS over TLS/QUIC endpoint
+func upstreamAddress(endpoint *url.URL) string {
+	port := endpoint.Port()
+	if port == "" {
+		port = defaultSecureDNSPort
+	}
+	return net.JoinHostPort(endpoint.Hostname(), port)
+}
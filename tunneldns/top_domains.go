@@ -0,0 +1,147 @@
+package tunneldns
+
+import (
+	"container/heap"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// TopDomainsPath is served by the metrics server, which exposes the /debug/ paths of http.DefaultServeMux
+	TopDomainsPath = "/debug/dns/top-domains"
+
+	topDomainsDefault = 20
+	// Number of domains tracked, the counts of the most queried ones are exact as long as they stay above the
+	// counts of the rest
+	maxTrackedDomains = 1000
+)
+
+var topDomains = newDomainCounter(maxTrackedDomains)
+
+func init() {
+	http.HandleFunc(TopDomainsPath, serveTopDomains)
+}
+
+// DomainCount is the number of queries for a domain since the DNS proxy started
+type DomainCount struct {
+	Domain string `json:"domain"`
+	Count  uint64 `json:"count"`
+}
+
+// domainCounter approximates the most queried domains in bounded memory with the Space-Saving algorithm: once full,
+// a new domain replaces the least queried one and inherits its count, which over-estimates rare domains but never
+// misses a frequent one. Domains are kept in a min-heap of their counts so that the least queried one is found in
+// O(log n).
+type domainCounter struct {
+	lock     sync.Mutex
+	domains  map[string]*domainEntry
+	heap     domainHeap
+	capacity int
+}
+
+type domainEntry struct {
+	domain string
+	count  uint64
+	// index in the heap
+	index int
+}
+
+func newDomainCounter(capacity int) *domainCounter {
+	return &domainCounter{domains: make(map[string]*domainEntry), capacity: capacity}
+}
+
+func (c *domainCounter) add(domain string) {
+	domain = strings.ToLower(domain)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if entry, ok := c.domains[domain]; ok {
+		entry.count++
+		heap.Fix(&c.heap, entry.index)
+		return
+	}
+	if len(c.heap) < c.capacity {
+		entry := &domainEntry{domain: domain, count: 1}
+		c.domains[domain] = entry
+		heap.Push(&c.heap, entry)
+		return
+	}
+	// The least queried domain is replaced in place
+	entry := c.heap[0]
+	delete(c.domains, entry.domain)
+	entry.domain = domain
+	entry.count++
+	c.domains[domain] = entry
+	heap.Fix(&c.heap, 0)
+}
+
+// top returns the n most queried domains, most queried first
+func (c *domainCounter) top(n int) []DomainCount {
+	c.lock.Lock()
+	result := make([]DomainCount, 0, len(c.heap))
+	for _, entry := range c.heap {
+		result = append(result, DomainCount{Domain: entry.domain, Count: entry.count})
+	}
+	c.lock.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Domain < result[j].Domain
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// domainHeap implements heap.Interface, with the least queried domain first
+type domainHeap []*domainEntry
+
+func (h domainHeap) Len() int {
+	return len(h)
+}
+
+func (h domainHeap) Less(i, j int) bool {
+	return h[i].count < h[j].count
+}
+
+func (h domainHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *domainHeap) Push(x interface{}) {
+	entry := x.(*domainEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *domainHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// serveTopDomains writes the most queried domains as JSON, the number of domains can be set with the n parameter
+func serveTopDomains(w http.ResponseWriter, r *http.Request) {
+	n := topDomainsDefault
+	if param := r.URL.Query().Get("n"); param != "" {
+		var err error
+		if n, err = strconv.Atoi(param); err != nil || n <= 0 {
+			http.Error(w, "n must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(topDomains.top(n))
+}
@@ -0,0 +1,45 @@
+package tunneldns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainCounter(t *testing.T) {
+	counter := newDomainCounter(3)
+	for i := 0; i < 5; i++ {
+		counter.add("Frequent.example.com.")
+	}
+	counter.add("a.example.com.")
+	counter.add("a.example.com.")
+	counter.add("b.example.com.")
+	// Replaces b.example.com., the least queried domain
+	counter.add("c.example.com.")
+
+	assert.Equal(t, []DomainCount{
+		{Domain: "frequent.example.com.", Count: 5},
+		{Domain: "a.example.com.", Count: 2},
+		{Domain: "c.example.com.", Count: 2},
+	}, counter.top(10))
+	assert.Len(t, counter.top(1), 1)
+}
+
+func TestServeTopDomains(t *testing.T) {
+	topDomains.add("example.com.")
+
+	rec := httptest.NewRecorder()
+	serveTopDomains(rec, httptest.NewRequest(http.MethodGet, TopDomainsPath+"?n=1", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var counts []DomainCount
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &counts))
+	assert.Len(t, counts, 1)
+
+	rec = httptest.NewRecorder()
+	serveTopDomains(rec, httptest.NewRequest(http.MethodGet, TopDomainsPath+"?n=all", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -1,15 +1,20 @@
 package tunneldns
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"net"
+	"net/url"
 	"strconv"
 	"sync"
 
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
-	"github.com/coredns/coredns/plugin/cache"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/watcher"
 )
 
 const (
@@ -23,15 +28,27 @@ type Listener struct {
 	server *dnsserver.Server
 	wg     sync.WaitGroup
 	log    *zerolog.Logger
+
+	config       ListenerConfig
+	upstreams    *UpstreamPool
+	forwarder    *ForwardPlugin
+	cache        *CachePlugin
+	local        *LocalPlugin
+	rulesLock    sync.Mutex
+	hostsFiles   []string
+	dohServer    *DoHServer
+	dotServer    *dnsserver.ServerTLS
+	rulesWatcher *watcher.File
+	cancel       context.CancelFunc
 }
 
 // Create a CoreDNS server plugin from configuration
-func createConfig(address string, port uint16, p plugin.Handler) *dnsserver.Config {
+func createConfig(transport, address string, port string, p plugin.Handler) *dnsserver.Config {
 	c := &dnsserver.Config{
 		Zone:        ".",
-		Transport:   "dns",
+		Transport:   transport,
 		ListenHosts: []string{address},
-		Port:        strconv.FormatUint(uint64(port), 10),
+		Port:        port,
 	}
 
 	c.AddPlugin(func(next plugin.Handler) plugin.Handler { return p })
@@ -64,11 +81,69 @@ func (l *Listener) Start(readySignal chan struct{}) error {
 		}()
 	}
 
-	return errors.Wrap(err, "failed to create a TCP listener")
+	if err != nil {
+		return errors.Wrap(err, "failed to create a TCP listener")
+	}
+
+	// Start DNS over HTTPS listener
+	if l.dohServer != nil {
+		doh, err := net.Listen("tcp", l.config.DoH.Address)
+		if err != nil {
+			return errors.Wrap(err, "failed to create a DNS over HTTPS listener")
+		}
+		l.log.Info().Str(LogFieldAddress, doh.Addr().String()).Msg("Starting DNS over HTTPS server")
+		l.wg.Add(1)
+		go func() {
+			if err := l.dohServer.Serve(doh); err != nil {
+				l.log.Err(err).Msg("DNS over HTTPS server stopped")
+			}
+			l.wg.Done()
+		}()
+	}
+
+	// Start DNS over TLS listener
+	if l.dotServer != nil {
+		dot, err := net.Listen("tcp", l.config.DoH.DoTAddress)
+		if err != nil {
+			return errors.Wrap(err, "failed to create a DNS over TLS listener")
+		}
+		l.log.Info().Str(LogFieldAddress, dot.Addr().String()).Msg("Starting DNS over TLS server")
+		l.wg.Add(1)
+		go func() {
+			_ = l.dotServer.Serve(dot)
+			l.wg.Done()
+		}()
+	}
+
+	// Start health checks of the upstreams
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.wg.Add(1)
+	go func() {
+		l.upstreams.HealthCheck(ctx)
+		l.wg.Done()
+	}()
+
+	if l.config.RulesFile != "" {
+		return l.watchRules()
+	}
+	return nil
 }
 
 // Stop signals server shutdown and blocks until completed
 func (l *Listener) Stop() error {
+	if l.cancel != nil {
+		l.cancel()
+	}
+	if l.rulesWatcher != nil {
+		l.rulesWatcher.Shutdown()
+	}
+	if l.dohServer != nil {
+		_ = l.dohServer.Shutdown()
+	}
+	if l.dotServer != nil {
+		_ = l.dotServer.Stop()
+	}
 	if err := l.server.Stop(); err != nil {
 		return err
 	}
@@ -77,33 +152,130 @@ func (l *Listener) Stop() error {
 	return nil
 }
 
+// ListenerConfig configures the DNS proxy listener and how it resolves queries
+type ListenerConfig struct {
+	Address                string
+	Port                   uint16
+	Upstreams              []string
+	Bootstraps             []string
+	MaxUpstreamConnections int
+	Cache                  CacheConfig
+	// Optional path of a rules file, see Rules
+	RulesFile string
+	DoH       DoHConfig
+	ECS       ECSConfig
+	DNSSEC    DNSSECConfig
+	// How upstreams are selected and health checked
+	UpstreamSelection UpstreamSelectionConfig
+	DNS64             DNS64Config
+}
+
 // CreateListener configures the server and bound sockets
-func CreateListener(address string, port uint16, upstreams []string, bootstraps []string, maxUpstreamConnections int, log *zerolog.Logger) (*Listener, error) {
+func CreateListener(config ListenerConfig, log *zerolog.Logger) (*Listener, error) {
 	// Build the list of upstreams
 	upstreamList := make([]Upstream, 0)
-	for _, url := range upstreams {
+	for _, url := range config.Upstreams {
 		log.Info().Str(LogFieldURL, url).Msg("Adding DNS upstream")
-		upstream, err := NewUpstreamHTTPS(url, bootstraps, maxUpstreamConnections, log)
+		upstream, err := newUpstream(url, config.Bootstraps, config.MaxUpstreamConnections, log)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create HTTPS upstream")
+			return nil, errors.Wrapf(err, "failed to create upstream %s", url)
+		}
+		upstreamList = append(upstreamList, instrumentUpstream(url, upstream))
+	}
+
+	upstreams, err := NewUpstreamPool(config.UpstreamSelection, config.Upstreams, upstreamList, log)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create local records in front of DNSSEC validation of a local cache with forwarding rules and upstream pool
+	forwarder := NewForwardPlugin(upstreams, log)
+	cache := NewCachePlugin(config.Cache, forwarder)
+	dnssec, err := NewDNSSECPlugin(config.DNSSEC, cache, log)
+	if err != nil {
+		return nil, err
+	}
+	ecs, err := NewECSPlugin(config.ECS, dnssec)
+	if err != nil {
+		return nil, err
+	}
+	local := NewLocalPlugin(ecs)
+	var chain plugin.Handler = local
+	// Synthesize AAAA records from A records of all the sources, local records included
+	if config.DNS64.Prefix != "" {
+		if chain, err = NewDNS64Plugin(config.DNS64, local); err != nil {
+			return nil, err
 		}
-		upstreamList = append(upstreamList, upstream)
 	}
 
-	// Create a local cache with HTTPS proxy plugin
-	chain := cache.New()
-	chain.Next = ProxyPlugin{
-		Upstreams: upstreamList,
+	listener := &Listener{log: log, config: config, upstreams: upstreams, forwarder: forwarder, cache: cache, local: local}
+	if config.RulesFile != "" {
+		rules, err := ReadRulesFile(config.RulesFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := listener.applyRules(rules); err != nil {
+			return nil, err
+		}
 	}
 
 	// Format an endpoint
-	endpoint := "dns://" + net.JoinHostPort(address, strconv.FormatUint(uint64(port), 10))
+	endpoint := "dns://" + net.JoinHostPort(config.Address, strconv.FormatUint(uint64(config.Port), 10))
 
 	// Create the actual middleware server
-	server, err := dnsserver.NewServer(endpoint, []*dnsserver.Config{createConfig(address, port, NewMetricsPlugin(chain))})
+	handler := NewMetricsPlugin(chain)
+	port := strconv.FormatUint(uint64(config.Port), 10)
+	server, err := dnsserver.NewServer(endpoint, []*dnsserver.Config{createConfig("dns", config.Address, port, handler)})
 	if err != nil {
 		return nil, err
 	}
+	listener.server = server
 
-	return &Listener{server: server, log: log}, nil
+	if config.DoH.Address != "" || config.DoH.DoTAddress != "" {
+		tlsConfig, err := serverTLSConfig(config.DoH, log)
+		if err != nil {
+			return nil, err
+		}
+		if config.DoH.Address != "" {
+			listener.dohServer = NewDoHServer(config.DoH, tlsConfig, handler, log)
+		}
+		if config.DoH.DoTAddress != "" {
+			if listener.dotServer, err = newDoTServer(config.DoH.DoTAddress, tlsConfig, handler); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return listener, nil
+}
+
+// newDoTServer creates a DNS over TLS server answering queries with handler
+func newDoTServer(address string, tlsConfig *tls.Config, handler plugin.Handler) (*dnsserver.ServerTLS, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid DNS over TLS listen address")
+	}
+	config := createConfig("tls", host, port, handler)
+	config.TLSConfig = tlsConfig
+	return dnsserver.NewServerTLS("tls://"+address, []*dnsserver.Config{config})
+}
+
+// newUpstream creates an upstream for the protocol selected by the endpoint URL scheme:
+// https:// (or http://) for DNS over HTTPS, tls:// for DNS over TLS and quic:// for DNS over QUIC. Queries for the
+// hostname of any upstream are sent to the bootstrap upstreams.
+func newUpstream(endpoint string, bootstraps []string, maxUpstreamConnections int, log *zerolog.Logger) (Upstream, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "https", "http":
+		return NewUpstreamHTTPS(endpoint, bootstraps, maxUpstreamConnections, log)
+	case "tls":
+		return NewUpstreamTLS(endpoint, bootstraps, log)
+	case "quic":
+		return NewUpstreamQUIC(endpoint, bootstraps, log)
+	default:
+		return nil, fmt.Errorf("unsupported upstream scheme %q, use https://, http://, tls:// or quic://", u.Scheme)
+	}
 }
@@ -0,0 +1,232 @@
+package tunneldns
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Upstream selection policies
+const (
+	// Upstreams are tried in the configured order
+	UpstreamPolicySequential = "sequential"
+	// Upstreams are tried from the fastest to the slowest to answer recently
+	UpstreamPolicyLowestLatency = "lowest-latency"
+	// Upstreams are tried in a random order
+	UpstreamPolicyRandom = "random"
+	// Upstreams are tried in a random order favoring the ones with the highest weights
+	UpstreamPolicyWeighted = "weighted"
+
+	HealthCheckIntervalDefault = 10 * time.Second
+
+	// Consecutive failures after which an upstream is only tried once the healthy ones failed
+	unhealthyThreshold = 3
+	// Weight of the latest sample in the moving average of upstream latencies
+	latencyEWMAWeight = 0.3
+	// Name queried to check the health of upstreams
+	healthCheckName = "."
+)
+
+// UpstreamSelectionConfig configures in which order the DNS proxy tries its upstreams
+type UpstreamSelectionConfig struct {
+	// One of UpstreamPolicySequential (default if empty), UpstreamPolicyLowestLatency, UpstreamPolicyRandom or
+	// UpstreamPolicyWeighted
+	Policy string
+	// Weights of the upstreams in the same order, for UpstreamPolicyWeighted. Upstreams without a weight have a weight of 1.
+	Weights []int
+	// Interval between health checks of the upstreams, health checks are disabled if 0
+	HealthCheckInterval time.Duration
+}
+
+type pooledUpstream struct {
+	Upstream
+	name   string
+	weight int
+
+	// Protected by the pool lock
+	failures int
+	latency  time.Duration
+}
+
+func (u *pooledUpstream) healthy() bool {
+	return u.failures < unhealthyThreshold
+}
+
+// UpstreamPool is a DNS proxy plugin sending queries to upstreams in the order of a selection policy. Upstreams that
+// failed repeatedly are marked unhealthy and are only tried after the healthy ones, until they answer again, either a
+// query or a periodic health check.
+type UpstreamPool struct {
+	upstreams []*pooledUpstream
+	policy    string
+	interval  time.Duration
+	log       *zerolog.Logger
+
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+// NewUpstreamPool creates an upstream pool, or returns an error if the config is invalid. names are used to label
+// the upstreams in logs and metrics.
+func NewUpstreamPool(config UpstreamSelectionConfig, names []string, upstreams []Upstream, log *zerolog.Logger) (*UpstreamPool, error) {
+	p := &UpstreamPool{
+		policy:   config.Policy,
+		interval: config.HealthCheckInterval,
+		log:      log,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	switch config.Policy {
+	case "":
+		p.policy = UpstreamPolicySequential
+	case UpstreamPolicySequential, UpstreamPolicyLowestLatency, UpstreamPolicyRandom, UpstreamPolicyWeighted:
+	default:
+		return nil, fmt.Errorf("unknown upstream policy %q, use %s, %s, %s or %s", config.Policy,
+			UpstreamPolicySequential, UpstreamPolicyLowestLatency, UpstreamPolicyRandom, UpstreamPolicyWeighted)
+	}
+	if len(config.Weights) > len(upstreams) {
+		return nil, fmt.Errorf("%d upstream weights are configured for %d upstreams", len(config.Weights), len(upstreams))
+	}
+
+	for i, upstream := range upstreams {
+		weight := 1
+		if i < len(config.Weights) {
+			weight = config.Weights[i]
+		}
+		if weight <= 0 {
+			return nil, fmt.Errorf("weight of upstream %s must be positive", names[i])
+		}
+		p.upstreams = append(p.upstreams, &pooledUpstream{Upstream: upstream, name: names[i], weight: weight})
+		upstreamHealthy.WithLabelValues(names[i]).Set(1)
+	}
+	return p, nil
+}
+
+// ServeDNS implements the CoreDNS plugin interface
+func (p *UpstreamPool) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	backendErr := errors.New("no upstream")
+	for _, upstream := range p.order() {
+		start := time.Now()
+		reply, err := upstream.Exchange(ctx, r)
+		p.report(upstream, time.Since(start), err)
+		if err == nil {
+			_ = w.WriteMsg(reply)
+			return dns.RcodeSuccess, nil
+		}
+		backendErr = err
+	}
+	return dns.RcodeServerFailure, errors.Wrap(backendErr, "failed to contact any of the upstreams")
+}
+
+// Name implements the CoreDNS plugin interface
+func (p *UpstreamPool) Name() string { return "proxy" }
+
+// HealthCheck probes the upstreams every health check interval until ctx is done
+func (p *UpstreamPool) HealthCheck(ctx context.Context) {
+	if p.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkUpstreams(ctx)
+		}
+	}
+}
+
+func (p *UpstreamPool) checkUpstreams(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, upstream := range p.upstreams {
+		wg.Add(1)
+		go func(upstream *pooledUpstream) {
+			defer wg.Done()
+			query := new(dns.Msg)
+			query.SetQuestion(healthCheckName, dns.TypeNS)
+			checkCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
+			defer cancel()
+			start := time.Now()
+			_, err := upstream.Exchange(checkCtx, query)
+			if ctx.Err() == nil {
+				p.report(upstream, time.Since(start), err)
+			}
+		}(upstream)
+	}
+	wg.Wait()
+}
+
+// report updates the health and latency of upstream with the outcome of an exchange
+func (p *UpstreamPool) report(upstream *pooledUpstream, latency time.Duration, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	wasHealthy := upstream.healthy()
+	if err != nil {
+		upstream.failures++
+	} else {
+		upstream.failures = 0
+		if upstream.latency == 0 {
+			upstream.latency = latency
+		} else {
+			upstream.latency = time.Duration(latencyEWMAWeight*float64(latency) + (1-latencyEWMAWeight)*float64(upstream.latency))
+		}
+	}
+
+	if healthy := upstream.healthy(); healthy != wasHealthy {
+		if healthy {
+			p.log.Info().Str(LogFieldURL, upstream.name).Msg("DNS upstream recovered")
+			upstreamHealthy.WithLabelValues(upstream.name).Set(1)
+		} else {
+			p.log.Warn().Err(err).Str(LogFieldURL, upstream.name).Msg("DNS upstream is unhealthy")
+			upstreamHealthy.WithLabelValues(upstream.name).Set(0)
+		}
+	}
+}
+
+// order returns the upstreams to try for a query: the healthy ones in policy order, then the unhealthy ones as a
+// last resort
+func (p *UpstreamPool) order() []*pooledUpstream {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	ordered := make([]*pooledUpstream, len(p.upstreams))
+	copy(ordered, p.upstreams)
+	switch p.policy {
+	case UpstreamPolicyLowestLatency:
+		// Upstreams without samples go first to measure them
+		sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].latency < ordered[j].latency })
+	case UpstreamPolicyRandom:
+		p.rand.Shuffle(len(ordered), func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+	case UpstreamPolicyWeighted:
+		p.weightedShuffle(ordered)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].healthy() && !ordered[j].healthy() })
+	return ordered
+}
+
+// weightedShuffle orders upstreams by picking them one at a time with a probability proportional to their weight
+func (p *UpstreamPool) weightedShuffle(upstreams []*pooledUpstream) {
+	total := 0
+	for _, upstream := range upstreams {
+		total += upstream.weight
+	}
+	for i := range upstreams {
+		pick := p.rand.Intn(total)
+		for j := i; j < len(upstreams); j++ {
+			if pick < upstreams[j].weight {
+				upstreams[i], upstreams[j] = upstreams[j], upstreams[i]
+				break
+			}
+			pick -= upstreams[j].weight
+		}
+		total -= upstreams[i].weight
+	}
+}
@@ -0,0 +1,115 @@
+package tunneldns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUpstream answers queries unless it's down, and counts the queries it receives
+type fakeUpstream struct {
+	down  bool
+	calls int
+}
+
+func (u *fakeUpstream) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	u.calls++
+	if u.down {
+		return nil, errors.New("upstream down")
+	}
+	return aResponse(60)(query), nil
+}
+
+func newTestPool(t *testing.T, config UpstreamSelectionConfig, upstreams ...*fakeUpstream) *UpstreamPool {
+	var names []string
+	var list []Upstream
+	for i, upstream := range upstreams {
+		names = append(names, string(rune('a'+i))+".pool.test")
+		list = append(list, upstream)
+	}
+	pool, err := NewUpstreamPool(config, names, list, &testLogger)
+	require.NoError(t, err)
+	return pool
+}
+
+func serveFromPool(t *testing.T, pool *UpstreamPool) *dns.Msg {
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	_, _ = pool.ServeDNS(context.Background(), rec, query)
+	return rec.Msg
+}
+
+func TestUpstreamPoolFailover(t *testing.T) {
+	first, second := &fakeUpstream{down: true}, &fakeUpstream{}
+	pool := newTestPool(t, UpstreamSelectionConfig{}, first, second)
+
+	for i := 0; i < unhealthyThreshold+2; i++ {
+		require.NotNil(t, serveFromPool(t, pool))
+	}
+	// The first upstream isn't tried anymore once unhealthy
+	assert.Equal(t, unhealthyThreshold, first.calls)
+	assert.Equal(t, unhealthyThreshold+2, second.calls)
+
+	// It's tried first again once a health check succeeds
+	first.down = false
+	pool.checkUpstreams(context.Background())
+	require.NotNil(t, serveFromPool(t, pool))
+	assert.Equal(t, unhealthyThreshold+2, first.calls)
+	assert.Equal(t, unhealthyThreshold+3, second.calls)
+}
+
+func TestUpstreamPoolLastResort(t *testing.T) {
+	first, second := &fakeUpstream{down: true}, &fakeUpstream{down: true}
+	pool := newTestPool(t, UpstreamSelectionConfig{}, first, second)
+	for i := 0; i < unhealthyThreshold; i++ {
+		assert.Nil(t, serveFromPool(t, pool))
+	}
+
+	// Unhealthy upstreams are still tried when no upstream is healthy
+	second.down = false
+	assert.NotNil(t, serveFromPool(t, pool))
+	assert.Equal(t, unhealthyThreshold+1, first.calls)
+}
+
+func TestUpstreamPoolLowestLatency(t *testing.T) {
+	pool := newTestPool(t, UpstreamSelectionConfig{Policy: UpstreamPolicyLowestLatency}, &fakeUpstream{}, &fakeUpstream{}, &fakeUpstream{})
+	pool.report(pool.upstreams[0], 30*time.Millisecond, nil)
+	pool.report(pool.upstreams[1], 10*time.Millisecond, nil)
+	pool.report(pool.upstreams[2], 20*time.Millisecond, nil)
+
+	order := pool.order()
+	assert.Equal(t, []*pooledUpstream{pool.upstreams[1], pool.upstreams[2], pool.upstreams[0]}, order)
+}
+
+func TestUpstreamPoolWeighted(t *testing.T) {
+	pool := newTestPool(t, UpstreamSelectionConfig{Policy: UpstreamPolicyWeighted, Weights: []int{9, 1}}, &fakeUpstream{}, &fakeUpstream{})
+
+	firsts := 0
+	for i := 0; i < 1000; i++ {
+		order := pool.order()
+		require.Len(t, order, 2)
+		if order[0] == pool.upstreams[0] {
+			firsts++
+		}
+	}
+	assert.InDelta(t, 900, firsts, 60)
+}
+
+func TestUpstreamPoolInvalidConfig(t *testing.T) {
+	upstreams := []Upstream{&fakeUpstream{}}
+	names := []string{"a.pool.test"}
+	_, err := NewUpstreamPool(UpstreamSelectionConfig{Policy: "round-robin"}, names, upstreams, &testLogger)
+	assert.Error(t, err)
+	_, err = NewUpstreamPool(UpstreamSelectionConfig{Weights: []int{1, 2}}, names, upstreams, &testLogger)
+	assert.Error(t, err)
+	_, err = NewUpstreamPool(UpstreamSelectionConfig{Weights: []int{0}}, names, upstreams, &testLogger)
+	assert.Error(t, err)
+}
@@ -1,13 +1,18 @@
 package tunnelstate
 
 import (
+	"net"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 
 	"github.com/cloudflare/cloudflared/connection"
 )
 
+// maxRecentErrors is how many of the last errors of each connection are kept
+const maxRecentErrors = 5
+
 type ConnTracker struct {
 	sync.RWMutex
 	// int is the connection Index
@@ -18,6 +23,21 @@ type ConnTracker struct {
 type ConnectionInfo struct {
 	IsConnected bool
 	Protocol    connection.Protocol
+	Location    string
+	// EdgeAddress is the address of the edge the connection is connected to, if it's known
+	EdgeAddress net.IP
+	// ConnectedAt is when the connection was last established
+	ConnectedAt time.Time
+	// RecentErrors are the last errors the connection was disconnected with, oldest first
+	RecentErrors []ConnectionError
+	// Features is how the features of the connection were negotiated when it was last established, if it's known
+	Features *connection.FeatureNegotiation
+}
+
+// ConnectionError is an error a connection was disconnected with
+type ConnectionError struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
 }
 
 func NewConnTracker(log *zerolog.Logger) *ConnTracker {
@@ -37,9 +57,19 @@ func (ct *ConnTracker) OnTunnelEvent(c connection.Event) {
 	switch c.EventType {
 	case connection.Connected:
 		ct.Lock()
-		ci := ConnectionInfo{
-			IsConnected: true,
-			Protocol:    c.Protocol,
+		ci := ct.connectionInfo[c.Index]
+		// A connection reports it's connected more than once when it's established
+		if !ci.IsConnected {
+			ci.ConnectedAt = time.Now()
+		}
+		ci.IsConnected = true
+		ci.Protocol = c.Protocol
+		ci.Location = c.Location
+		if len(c.EdgeAddress) > 0 {
+			ci.EdgeAddress = c.EdgeAddress
+		}
+		if c.Features != nil {
+			ci.Features = c.Features
 		}
 		ct.connectionInfo[c.Index] = ci
 		ct.Unlock()
@@ -47,6 +77,12 @@ func (ct *ConnTracker) OnTunnelEvent(c connection.Event) {
 		ct.Lock()
 		ci := ct.connectionInfo[c.Index]
 		ci.IsConnected = false
+		if c.Err != nil {
+			ci.RecentErrors = append(ci.RecentErrors, ConnectionError{Time: time.Now(), Message: c.Err.Error()})
+			if len(ci.RecentErrors) > maxRecentErrors {
+				ci.RecentErrors = ci.RecentErrors[len(ci.RecentErrors)-maxRecentErrors:]
+			}
+		}
 		ct.connectionInfo[c.Index] = ci
 		ct.Unlock()
 	default:
@@ -78,3 +114,15 @@ func (ct *ConnTracker) HasConnectedWith(protocol connection.Protocol) bool {
 	}
 	return false
 }
+
+// Connections returns the state of the connections, by their index
+func (ct *ConnTracker) Connections() map[uint8]ConnectionInfo {
+	ct.RLock()
+	defer ct.RUnlock()
+	connections := make(map[uint8]ConnectionInfo, len(ct.connectionInfo))
+	for index, ci := range ct.connectionInfo {
+		ci.RecentErrors = append([]ConnectionError(nil), ci.RecentErrors...)
+		connections[index] = ci
+	}
+	return connections
+}
@@ -0,0 +1,19 @@
+package watchdog
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var dumpsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "cloudflared",
+		Subsystem: "watchdog",
+		Name:      "dumps_total",
+		Help:      "Number of goroutine dumps and heap profiles written by the watchdog, by the reason they were written",
+	},
+	[]string{"reason"},
+)
+
+func init() {
+	prometheus.MustRegister(dumpsTotal)
+}
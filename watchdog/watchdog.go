@@ -0,0 +1,313 @@
+// Package watchdog writes a goroutine dump and a heap profile when a loop of the process stalls or the process uses
+// more memory than a threshold, so that there's data to investigate hangs and OOM kills even when they can't be
+// reproduced. Loops are watched with heartbeats they send at HeartbeatInterval.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// HeartbeatInterval is how often the loops watched by the watchdog send a heartbeat. A stall is a heartbeat later
+	// than this interval plus the stall threshold.
+	HeartbeatInterval = time.Second
+
+	// checkInterval is how often the watchdog wakes up. When it's woken up later than this interval plus the stall
+	// threshold, the whole process didn't run, e.g. the host was suspended or the VM was paused, which isn't a stall.
+	checkInterval = time.Second
+
+	defaultMaxDumps = 5
+	defaultCooldown = 5 * time.Minute
+
+	dumpPrefix     = "cloudflared-dump-"
+	dumpTimeFormat = "20060102T150405.000Z"
+
+	reasonStall  = "stall"
+	reasonMemory = "memory"
+)
+
+// Config is when and where the watchdog writes dumps
+type Config struct {
+	// Dir is where the dumps are written, each in its own directory
+	Dir string
+	// StallThreshold is how late the heartbeat of a watched loop has to be for the loop to be considered stalled, 0
+	// disables the detection of stalls
+	StallThreshold time.Duration
+	// MemoryThreshold is the memory in bytes the runtime has to use for the process to be considered under memory
+	// pressure, 0 disables the detection of memory pressure
+	MemoryThreshold uint64
+	// MaxDumps is how many dumps are kept in Dir, the oldest are removed. It's 5 if it's 0.
+	MaxDumps int
+	// Cooldown is the minimum time between dumps. It's 5 minutes if it's 0.
+	Cooldown time.Duration
+}
+
+func (c *Config) validate() error {
+	if c.Dir == "" {
+		return fmt.Errorf("the directory of the dumps must be set")
+	}
+	if c.StallThreshold < 0 || c.MaxDumps < 0 || c.Cooldown < 0 {
+		return fmt.Errorf("the stall threshold, the maximum number of dumps and the cooldown can't be negative")
+	}
+	if c.StallThreshold == 0 && c.MemoryThreshold == 0 {
+		return fmt.Errorf("at least one of the stall and memory thresholds must be set")
+	}
+	if c.MaxDumps == 0 {
+		c.MaxDumps = defaultMaxDumps
+	}
+	if c.Cooldown == 0 {
+		c.Cooldown = defaultCooldown
+	}
+	return nil
+}
+
+// Watchdog checks the process for stalls and memory pressure
+type Watchdog struct {
+	config   Config
+	lastDump time.Time
+	log      *zerolog.Logger
+
+	// heartbeatsLock protects the time of the last heartbeat of each watched loop
+	heartbeatsLock sync.Mutex
+	heartbeats     map[*Heartbeat]time.Time
+
+	// Redeclared so they can be overridden in tests
+	now        func() time.Time
+	readMemory func() uint64
+}
+
+// New returns a Watchdog of config, after creating the directory of the dumps.
+func New(config Config, log *zerolog.Logger) (*Watchdog, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create the directory of the dumps: %w", err)
+	}
+	return &Watchdog{
+		config:     config,
+		log:        log,
+		heartbeats: make(map[*Heartbeat]time.Time),
+		now:        time.Now,
+		readMemory: readMemory,
+	}, nil
+}
+
+// Heartbeat is the heartbeat of a loop watched by the watchdog
+type Heartbeat struct {
+	watchdog *Watchdog
+	name     string
+	ticker   *time.Ticker
+}
+
+// Register starts watching the loop called name, which has to call Beat whenever C fires until it calls Stop. It
+// returns nil if w is nil, on which the methods of Heartbeat do nothing, so that loops don't need to check whether
+// the watchdog is enabled.
+func (w *Watchdog) Register(name string) *Heartbeat {
+	if w == nil {
+		return nil
+	}
+	h := &Heartbeat{watchdog: w, name: name, ticker: time.NewTicker(HeartbeatInterval)}
+	w.heartbeatsLock.Lock()
+	defer w.heartbeatsLock.Unlock()
+	w.heartbeats[h] = w.now()
+	return h
+}
+
+// C fires every HeartbeatInterval, it never fires if h is nil
+func (h *Heartbeat) C() <-chan time.Time {
+	if h == nil {
+		return nil
+	}
+	return h.ticker.C
+}
+
+// Beat records that the loop is running
+func (h *Heartbeat) Beat() {
+	if h == nil {
+		return
+	}
+	h.watchdog.heartbeatsLock.Lock()
+	defer h.watchdog.heartbeatsLock.Unlock()
+	if _, ok := h.watchdog.heartbeats[h]; ok {
+		h.watchdog.heartbeats[h] = h.watchdog.now()
+	}
+}
+
+// Stop stops watching the loop
+func (h *Heartbeat) Stop() {
+	if h == nil {
+		return
+	}
+	h.ticker.Stop()
+	h.watchdog.heartbeatsLock.Lock()
+	defer h.watchdog.heartbeatsLock.Unlock()
+	delete(h.watchdog.heartbeats, h)
+}
+
+// Run checks the process every second until ctx is done.
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	last := w.now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := w.now()
+			w.tick(now, now.Sub(last)-checkInterval)
+			last = now
+		}
+	}
+}
+
+// tick checks the process when the watchdog was woken up late, which is ignored when it's late by more than the stall
+// threshold: the heartbeats are as late since no loop could run either
+func (w *Watchdog) tick(now time.Time, late time.Duration) {
+	if w.config.StallThreshold > 0 && late > w.config.StallThreshold {
+		w.log.Debug().Dur("late", late).Msg("Watchdog ignores heartbeats missed while the process wasn't running")
+		w.heartbeatsLock.Lock()
+		for h := range w.heartbeats {
+			w.heartbeats[h] = now
+		}
+		w.heartbeatsLock.Unlock()
+	}
+	w.check(w.stalledLoops(now))
+}
+
+// stalledLoops returns the names of the watched loops whose last heartbeat is late by more than the stall threshold
+func (w *Watchdog) stalledLoops(now time.Time) []string {
+	if w.config.StallThreshold == 0 {
+		return nil
+	}
+	w.heartbeatsLock.Lock()
+	defer w.heartbeatsLock.Unlock()
+	var stalled []string
+	for h, last := range w.heartbeats {
+		if now.Sub(last) > HeartbeatInterval+w.config.StallThreshold {
+			stalled = append(stalled, h.name)
+		}
+	}
+	sort.Strings(stalled)
+	return stalled
+}
+
+// check writes a dump if a watched loop stalled, or if the memory used is above the memory threshold
+func (w *Watchdog) check(stalledLoops []string) {
+	stalled := len(stalledLoops) > 0
+	var memory uint64
+	if w.config.MemoryThreshold > 0 {
+		memory = w.readMemory()
+	}
+	pressure := w.config.MemoryThreshold > 0 && memory > w.config.MemoryThreshold
+	if !stalled && !pressure {
+		return
+	}
+
+	now := w.now()
+	if !w.lastDump.IsZero() && now.Sub(w.lastDump) < w.config.Cooldown {
+		return
+	}
+	w.lastDump = now
+	reason := reasonMemory
+	if stalled {
+		reason = reasonStall
+	}
+	dir, err := w.dump(now, reason)
+	if err != nil {
+		w.log.Err(err).Msg("Watchdog failed to write a dump")
+		return
+	}
+	dumpsTotal.WithLabelValues(reason).Inc()
+	event := w.log.Warn().Str("dir", dir)
+	if stalled {
+		event = event.Strs("stalled", stalledLoops)
+	}
+	if pressure {
+		event = event.Uint64("memory", memory).Uint64("memoryThreshold", w.config.MemoryThreshold)
+	}
+	event.Msgf("Watchdog detected %s, wrote a goroutine dump and a heap profile", describe(reason))
+	if err := w.prune(); err != nil {
+		w.log.Err(err).Msg("Watchdog failed to remove old dumps")
+	}
+}
+
+// dump writes the goroutines and the heap profile in a new directory
+func (w *Watchdog) dump(now time.Time, reason string) (string, error) {
+	dir := filepath.Join(w.config.Dir, fmt.Sprintf("%s%s-%s", dumpPrefix, now.UTC().Format(dumpTimeFormat), reason))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	// debug=2 writes the stack of each goroutine with how long it has been blocked, like an unrecovered panic
+	if err := writeProfile(filepath.Join(dir, "goroutines.txt"), "goroutine", 2); err != nil {
+		return "", err
+	}
+	if err := writeProfile(filepath.Join(dir, "heap.pprof"), "heap", 0); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func writeProfile(path, profile string, debug int) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup(profile).WriteTo(file, debug); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write the %s profile: %w", profile, err)
+	}
+	return file.Close()
+}
+
+// prune removes the oldest dumps beyond the maximum number of dumps. Only directories written by the watchdog are
+// considered, their names sort by time.
+func (w *Watchdog) prune() error {
+	entries, err := os.ReadDir(w.config.Dir)
+	if err != nil {
+		return err
+	}
+	var dumps []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), dumpPrefix) {
+			dumps = append(dumps, entry.Name())
+		}
+	}
+	if len(dumps) <= w.config.MaxDumps {
+		return nil
+	}
+	sort.Strings(dumps)
+	for _, name := range dumps[:len(dumps)-w.config.MaxDumps] {
+		if err := os.RemoveAll(filepath.Join(w.config.Dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMemory returns the memory the runtime got from the OS and hasn't released, which is what the soft memory limit
+// of the runtime limits
+func readMemory() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys - stats.HeapReleased
+}
+
+func describe(reason string) string {
+	if reason == reasonStall {
+		return "a stall of a loop of the process"
+	}
+	return "memory pressure"
+}
@@ -0,0 +1,125 @@
+package watchdog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigValidate(t *testing.T) {
+	_, err := New(Config{StallThreshold: time.Second}, &zerolog.Logger{})
+	assert.Error(t, err)
+	_, err = New(Config{Dir: t.TempDir()}, &zerolog.Logger{})
+	assert.Error(t, err)
+	_, err = New(Config{Dir: t.TempDir(), StallThreshold: -time.Second}, &zerolog.Logger{})
+	assert.Error(t, err)
+
+	watchdog, err := New(Config{Dir: filepath.Join(t.TempDir(), "dumps"), MemoryThreshold: 1}, &zerolog.Logger{})
+	require.NoError(t, err)
+	assert.Equal(t, defaultMaxDumps, watchdog.config.MaxDumps)
+	assert.Equal(t, defaultCooldown, watchdog.config.Cooldown)
+	assert.DirExists(t, watchdog.config.Dir)
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	log := zerolog.Nop()
+	watchdog, err := New(Config{
+		Dir:             dir,
+		StallThreshold:  5 * time.Second,
+		MemoryThreshold: 1 << 30,
+		MaxDumps:        2,
+		Cooldown:        time.Minute,
+	}, &log)
+	require.NoError(t, err)
+	now := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	watchdog.now = func() time.Time { return now }
+	memory := uint64(1 << 20)
+	watchdog.readMemory = func() uint64 { return memory }
+
+	watchdog.check(nil)
+	assert.Empty(t, dumps(t, dir))
+
+	watchdog.check([]string{"supervisor"})
+	require.Equal(t, []string{"cloudflared-dump-20220304T050607.000Z-stall"}, dumps(t, dir))
+	goroutines, err := os.ReadFile(filepath.Join(dir, "cloudflared-dump-20220304T050607.000Z-stall", "goroutines.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(goroutines), "TestCheck")
+	assert.FileExists(t, filepath.Join(dir, "cloudflared-dump-20220304T050607.000Z-stall", "heap.pprof"))
+
+	// No dump until the cooldown is over
+	memory = 2 << 30
+	now = now.Add(30 * time.Second)
+	watchdog.check(nil)
+	assert.Len(t, dumps(t, dir), 1)
+
+	// The oldest dump is removed, and directories not written by the watchdog are left alone
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "other"), 0700))
+	now = now.Add(time.Minute)
+	watchdog.check(nil)
+	now = now.Add(time.Minute)
+	watchdog.check(nil)
+	assert.Equal(t, []string{
+		"cloudflared-dump-20220304T050737.000Z-memory",
+		"cloudflared-dump-20220304T050837.000Z-memory",
+	}, dumps(t, dir))
+	assert.DirExists(t, filepath.Join(dir, "other"))
+}
+
+func TestHeartbeats(t *testing.T) {
+	dir := t.TempDir()
+	log := zerolog.Nop()
+	watchdog, err := New(Config{Dir: dir, StallThreshold: 5 * time.Second}, &log)
+	require.NoError(t, err)
+	now := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	watchdog.now = func() time.Time { return now }
+
+	supervisor := watchdog.Register("supervisor")
+	connection := watchdog.Register("connection 0")
+	defer supervisor.Stop()
+	now = now.Add(4 * time.Second)
+	connection.Beat()
+	now = now.Add(4 * time.Second)
+	assert.Equal(t, []string{"supervisor"}, watchdog.stalledLoops(now))
+
+	// Once a loop stops, it isn't watched anymore
+	connection.Stop()
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, []string{"supervisor"}, watchdog.stalledLoops(now))
+
+	// Heartbeats missed while the watchdog didn't run either, e.g. while the host was suspended, aren't stalls
+	watchdog.tick(now, 30*time.Second)
+	assert.Empty(t, dumps(t, dir))
+	now = now.Add(checkInterval)
+	watchdog.tick(now, 0)
+	assert.Empty(t, dumps(t, dir))
+
+	now = now.Add(10 * time.Second)
+	watchdog.tick(now, 0)
+	assert.Equal(t, []string{"cloudflared-dump-20220304T050636.000Z-stall"}, dumps(t, dir))
+
+	// The heartbeat of a disabled watchdog does nothing
+	var disabled *Watchdog
+	heartbeat := disabled.Register("supervisor")
+	assert.Nil(t, heartbeat.C())
+	heartbeat.Beat()
+	heartbeat.Stop()
+}
+
+func dumps(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), dumpPrefix) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
@@ -35,7 +35,17 @@ type GorillaConn struct {
 	readBuf bytes.Buffer
 }
 
-// Read will read messages from the websocket connection
+// NewGorillaConn wraps conn so that a close frame from the server only ends the data read, see CloseWrite
+func NewGorillaConn(conn *websocket.Conn, log *zerolog.Logger) *GorillaConn {
+	// The default handler replies with a close frame right away, which would stop us from sending the rest of our data
+	conn.SetCloseHandler(func(int, string) error {
+		return nil
+	})
+	return &GorillaConn{Conn: conn, log: log}
+}
+
+// Read will read messages from the websocket connection. It returns io.EOF once the server closed the connection
+// normally.
 func (c *GorillaConn) Read(p []byte) (int, error) {
 	// Intermediate buffer may contain unread bytes from the last read, start there before blocking on a new frame
 	if c.readBuf.Len() > 0 {
@@ -44,6 +54,9 @@ func (c *GorillaConn) Read(p []byte) (int, error) {
 
 	_, message, err := c.Conn.ReadMessage()
 	if err != nil {
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
+			return 0, io.EOF
+		}
 		return 0, err
 	}
 
@@ -65,6 +78,12 @@ func (c *GorillaConn) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// CloseWrite sends a close frame to the server, so that it knows no more data is coming while it can still send data,
+// like Conn.CloseWrite on the server side
+func (c *GorillaConn) CloseWrite() error {
+	return c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
 // SetDeadline sets both read and write deadlines, as per net.Conn interface docs:
 // "It is equivalent to calling both SetReadDeadline and SetWriteDeadline."
 // Note there is no synchronization here, but the gorilla implementation isn't thread safe anyway
@@ -86,6 +105,11 @@ type Conn struct {
 	// 2. Close only returns after in progress Write is finished, and no more Write will succeed after calling Close.
 	writeLock sync.Mutex
 	done      bool
+	// closeReceived is whether the client sent a close frame, which is only answered on Close so that the origin can
+	// keep sending data after the client is done. Protected by writeLock.
+	closeReceived bool
+	// unread is what's left of the last message after a Read with a smaller buffer
+	unread []byte
 }
 
 func NewConn(ctx context.Context, rw io.ReadWriter, log *zerolog.Logger) *Conn {
@@ -97,13 +121,71 @@ func NewConn(ctx context.Context, rw io.ReadWriter, log *zerolog.Logger) *Conn {
 	return c
 }
 
-// Read will read messages from the websocket connection
+// Read will read messages from the websocket connection. It returns io.EOF once the client closed the connection
+// normally.
 func (c *Conn) Read(reader []byte) (int, error) {
-	data, err := wsutil.ReadClientBinary(c.rw)
-	if err != nil {
-		return 0, err
+	if len(c.unread) == 0 {
+		data, err := c.readClientBinary()
+		if err != nil {
+			var closed wsutil.ClosedError
+			if errors.As(err, &closed) && (closed.Code == gobwas.StatusNormalClosure || closed.Code == gobwas.StatusNoStatusRcvd) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		c.unread = data
+	}
+	n := copy(reader, c.unread)
+	c.unread = c.unread[n:]
+	return n, nil
+}
+
+// readClientBinary reads the next binary message like wsutil.ReadClientBinary, except that a close frame isn't
+// answered right away
+func (c *Conn) readClientBinary() ([]byte, error) {
+	controlHandler := wsutil.ControlFrameHandler(c.rw, gobwas.StateServerSide)
+	handler := func(hdr gobwas.Header, r io.Reader) error {
+		if hdr.OpCode != gobwas.OpClose {
+			return controlHandler(hdr, r)
+		}
+		payload, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		c.writeLock.Lock()
+		c.closeReceived = true
+		c.writeLock.Unlock()
+		closed := wsutil.ClosedError{Code: gobwas.StatusNoStatusRcvd}
+		if len(payload) > 0 {
+			closed.Code, closed.Reason = gobwas.ParseCloseFrameData(payload)
+		}
+		return closed
+	}
+	rd := wsutil.Reader{
+		Source:         c.rw,
+		State:          gobwas.StateServerSide,
+		CheckUTF8:      true,
+		OnIntermediate: handler,
+	}
+	for {
+		hdr, err := rd.NextFrame()
+		if err != nil {
+			return nil, err
+		}
+		if hdr.OpCode.IsControl() {
+			if err := handler(hdr, &rd); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if hdr.OpCode&gobwas.OpBinary == 0 {
+			if err := rd.Discard(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return io.ReadAll(&rd)
 	}
-	return copy(reader, data), nil
 }
 
 // Write will write messages to the websocket connection.
@@ -168,9 +250,25 @@ func (c *Conn) pingPeriod(ctx context.Context) time.Duration {
 	return defaultPingPeriod
 }
 
-// Close waits for the current write to finish. Further writes will return error
+// CloseWrite sends a close frame to the client, so that it knows no more data is coming while it can still send
+// data. Further writes will return error.
+func (c *Conn) CloseWrite() error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if c.done {
+		return nil
+	}
+	c.done = true
+	return wsutil.WriteServerMessage(c.rw, gobwas.OpClose, gobwas.NewCloseFrameBody(gobwas.StatusNormalClosure, ""))
+}
+
+// Close waits for the current write to finish, and answers the close frame of the client if we didn't send ours.
+// Further writes will return error
 func (c *Conn) Close() {
 	c.writeLock.Lock()
 	defer c.writeLock.Unlock()
+	if c.closeReceived && !c.done {
+		_ = wsutil.WriteServerMessage(c.rw, gobwas.OpClose, gobwas.NewCloseFrameBody(gobwas.StatusNormalClosure, ""))
+	}
 	c.done = true
 }
@@ -0,0 +1,172 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gobwas "github.com/gobwas/ws"
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrMessageTooBig = errors.New("websocket message is larger than the maximum message size")
+	ErrPongTimeout   = errors.New("websocket origin didn't answer a ping in time")
+)
+
+// FrameStreamOptions are the controls StreamFrames enforces on a WebSocket connection
+type FrameStreamOptions struct {
+	// PingInterval is the interval of the pings sent to the origin, no pings are sent if it's 0
+	PingInterval time.Duration
+	// PongTimeout is how long the origin has to answer a ping, it's never timed out if it's 0
+	PongTimeout time.Duration
+	// MaxMessageSize is the maximum size of the messages in both directions, in bytes, there is no maximum if it's 0
+	MaxMessageSize int64
+}
+
+// Enabled is whether any of the options needs the frames of the connection to be parsed
+func (o FrameStreamOptions) Enabled() bool {
+	return o.PingInterval > 0 || o.MaxMessageSize > 0
+}
+
+type frameStream struct {
+	eyeballConn io.ReadWriter
+	originConn  io.ReadWriter
+	options     FrameStreamOptions
+	log         *zerolog.Logger
+
+	// The locks make sure frames aren't interleaved when forwarded frames, pings and close frames are written
+	eyeballLock sync.Mutex
+	originLock  sync.Mutex
+	// lastPong is the time of the last pong from the origin, in nanoseconds since the epoch
+	lastPong int64
+}
+
+// StreamFrames copies the frames of a WebSocket connection between eyeballConn, the client, and originConn, the
+// server, like Stream copies bytes, enforcing options. It returns once either direction is done, or the connection
+// is closed because of options.
+func StreamFrames(eyeballConn, originConn io.ReadWriter, options FrameStreamOptions, log *zerolog.Logger) error {
+	s := &frameStream{
+		eyeballConn: eyeballConn,
+		originConn:  originConn,
+		options:     options,
+		log:         log,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errC := make(chan error, 3)
+	go s.forward(errC, "eyeball->origin", originConn, &s.originLock, eyeballConn, false)
+	go s.forward(errC, "origin->eyeball", eyeballConn, &s.eyeballLock, originConn, true)
+	if options.PingInterval > 0 {
+		go func() {
+			errC <- s.pinger(ctx)
+		}()
+	}
+
+	err := <-errC
+	switch err {
+	case ErrMessageTooBig:
+		s.closeBoth(gobwas.StatusMessageTooBig, "message too big")
+	case ErrPongTimeout:
+		s.closeBoth(gobwas.StatusGoingAway, "origin didn't answer a ping")
+	}
+	return err
+}
+
+// forward copies the frames read from src to dst
+func (s *frameStream) forward(errC chan<- error, dir string, dst io.Writer, dstLock *sync.Mutex, src io.Reader, fromOrigin bool) {
+	defer func() {
+		// Like in Stream, writing to the eyeball once the stream is done can panic
+		if r := recover(); r != nil {
+			s.log.Debug().Msgf("Gracefully handled error %v in Streaming for %s, error %s", r, dir, debug.Stack())
+			errC <- fmt.Errorf("websocket streaming for %s panicked: %v", dir, r)
+		}
+	}()
+
+	var messageSize int64
+	for {
+		header, err := gobwas.ReadHeader(src)
+		if err != nil {
+			errC <- err
+			return
+		}
+		switch {
+		case header.OpCode == gobwas.OpContinuation:
+			messageSize += header.Length
+		case header.OpCode.IsData():
+			messageSize = header.Length
+		case header.OpCode == gobwas.OpPong && fromOrigin:
+			atomic.StoreInt64(&s.lastPong, time.Now().UnixNano())
+		}
+		if s.options.MaxMessageSize > 0 && messageSize > s.options.MaxMessageSize {
+			s.log.Debug().Msgf("Closing websocket for a message of at least %d bytes in %s", messageSize, dir)
+			errC <- ErrMessageTooBig
+			return
+		}
+
+		dstLock.Lock()
+		err = gobwas.WriteHeader(dst, header)
+		if err == nil {
+			_, err = io.CopyN(dst, src, header.Length)
+		}
+		dstLock.Unlock()
+		if err != nil {
+			errC <- err
+			return
+		}
+	}
+}
+
+func (s *frameStream) pinger(ctx context.Context) error {
+	ticker := time.NewTicker(s.options.PingInterval)
+	defer ticker.Stop()
+
+	var (
+		pingSentAt   time.Time
+		pongDeadline <-chan time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			// The pong can be read before the write returns
+			sentAt := time.Now()
+			s.originLock.Lock()
+			// Frames from clients to servers are masked
+			err := gobwas.WriteFrame(s.originConn, gobwas.MaskFrameInPlace(gobwas.NewPingFrame(nil)))
+			s.originLock.Unlock()
+			if err != nil {
+				return err
+			}
+			if s.options.PongTimeout > 0 && pongDeadline == nil {
+				pingSentAt = sentAt
+				pongDeadline = time.After(s.options.PongTimeout)
+			}
+		case <-pongDeadline:
+			if time.Unix(0, atomic.LoadInt64(&s.lastPong)).Before(pingSentAt) {
+				return ErrPongTimeout
+			}
+			pongDeadline = nil
+		}
+	}
+}
+
+// closeBoth sends a close frame to both sides, unless a frame is being written to them, which a close frame can't
+// interrupt
+func (s *frameStream) closeBoth(code gobwas.StatusCode, reason string) {
+	if s.eyeballLock.TryLock() {
+		_ = gobwas.WriteFrame(s.eyeballConn, gobwas.NewCloseFrame(gobwas.NewCloseFrameBody(code, reason)))
+		s.eyeballLock.Unlock()
+	}
+	if s.originLock.TryLock() {
+		_ = gobwas.WriteFrame(s.originConn, gobwas.MaskFrameInPlace(gobwas.NewCloseFrame(gobwas.NewCloseFrameBody(code, reason))))
+		s.originLock.Unlock()
+	}
+}
@@ -0,0 +1,127 @@
+package websocket
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	gobwas "github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamFramesPipes runs StreamFrames between an eyeball and an origin, returning their ends of the connection
+func streamFramesPipes(t *testing.T, options FrameStreamOptions) (eyeball, origin net.Conn, errC <-chan error) {
+	eyeball, eyeballConn := net.Pipe()
+	originConn, origin := net.Pipe()
+	t.Cleanup(func() {
+		eyeball.Close()
+		eyeballConn.Close()
+		originConn.Close()
+		origin.Close()
+	})
+
+	log := zerolog.Nop()
+	streamErrC := make(chan error, 1)
+	go func() {
+		streamErrC <- StreamFrames(eyeballConn, originConn, options, &log)
+	}()
+	return eyeball, origin, streamErrC
+}
+
+func TestStreamFrames(t *testing.T) {
+	eyeball, origin, errC := streamFramesPipes(t, FrameStreamOptions{MaxMessageSize: 16})
+
+	go func() {
+		_ = wsutil.WriteClientText(eyeball, []byte("hello"))
+	}()
+	message, op, err := wsutil.ReadClientData(origin)
+	require.NoError(t, err)
+	assert.Equal(t, gobwas.OpText, op)
+	assert.Equal(t, "hello", string(message))
+
+	go func() {
+		_ = wsutil.WriteServerBinary(origin, []byte("world"))
+	}()
+	message, op, err = wsutil.ReadServerData(eyeball)
+	require.NoError(t, err)
+	assert.Equal(t, gobwas.OpBinary, op)
+	assert.Equal(t, "world", string(message))
+
+	select {
+	case err := <-errC:
+		t.Fatalf("stream returned %v", err)
+	default:
+	}
+}
+
+func TestStreamFramesMaxMessageSize(t *testing.T) {
+	eyeball, origin, errC := streamFramesPipes(t, FrameStreamOptions{MaxMessageSize: 8})
+
+	// The message is fragmented in frames smaller than the maximum
+	go func() {
+		_ = gobwas.WriteFrame(eyeball, gobwas.MaskFrameInPlace(gobwas.NewFrame(gobwas.OpText, false, []byte("12345"))))
+		_ = gobwas.WriteFrame(eyeball, gobwas.MaskFrameInPlace(gobwas.NewFrame(gobwas.OpContinuation, true, []byte("67890"))))
+	}()
+	frame, err := gobwas.ReadFrame(origin)
+	require.NoError(t, err)
+	assert.Equal(t, gobwas.OpText, frame.Header.OpCode)
+
+	// Both sides are sent a close frame
+	eyeballCloseC := make(chan gobwas.Frame, 1)
+	go func() {
+		frame, _ := gobwas.ReadFrame(eyeball)
+		eyeballCloseC <- frame
+	}()
+	frame, err = gobwas.ReadFrame(origin)
+	require.NoError(t, err)
+	require.Equal(t, gobwas.OpClose, frame.Header.OpCode)
+	require.True(t, frame.Header.Masked)
+	frame = <-eyeballCloseC
+	require.Equal(t, gobwas.OpClose, frame.Header.OpCode)
+	code, _ := gobwas.ParseCloseFrameData(frame.Payload)
+	assert.Equal(t, gobwas.StatusMessageTooBig, code)
+
+	require.Equal(t, ErrMessageTooBig, <-errC)
+}
+
+func TestStreamFramesPing(t *testing.T) {
+	const pingInterval = 20 * time.Millisecond
+	eyeball, origin, errC := streamFramesPipes(t, FrameStreamOptions{
+		PingInterval: pingInterval,
+		PongTimeout:  pingInterval * 2,
+	})
+	go func() {
+		for {
+			if _, err := gobwas.ReadFrame(eyeball); err != nil {
+				return
+			}
+		}
+	}()
+
+	// The origin answers pings for a while
+	for i := 0; i < 5; i++ {
+		frame, err := gobwas.ReadFrame(origin)
+		require.NoError(t, err)
+		require.Equal(t, gobwas.OpPing, frame.Header.OpCode)
+		require.True(t, frame.Header.Masked)
+		require.NoError(t, gobwas.WriteFrame(origin, gobwas.NewPongFrame(nil)))
+	}
+
+	// Then stops answering them
+	go func() {
+		for {
+			if _, err := gobwas.ReadFrame(origin); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-errC:
+		require.Equal(t, ErrPongTimeout, err)
+	case <-time.After(time.Second):
+		t.Fatal("stream didn't time out")
+	}
+}
@@ -0,0 +1,93 @@
+package websocket
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+
+	"github.com/cloudflare/cloudflared/h2mux"
+)
+
+// MuxSubprotocol is the WebSocket subprotocol of the connections carrying several streams to a TCP origin, with h2mux.
+// Clients offer it, and cloudflared only accepts it for origins that are dialed once per stream.
+const MuxSubprotocol = "cloudflared-mux"
+
+const (
+	muxHeartbeatInterval = 5 * time.Second
+	muxMaxHeartbeats     = 5
+)
+
+// muxActiveStreams counts the streams multiplexed over WebSockets, apart from the streams of the tunnel connections
+var muxActiveStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "websocket_mux_active_streams",
+	Help: "Number of streams multiplexed over WebSocket connections",
+})
+
+var (
+	// MuxRequestHeaders are sent by the client to open a stream
+	MuxRequestHeaders = []h2mux.Header{{Name: ":method", Value: "CONNECT"}}
+	// MuxConnectedHeaders are answered by cloudflared once it connected the stream to the origin
+	MuxConnectedHeaders = []h2mux.Header{{Name: ":status", Value: "200"}}
+	// MuxFailedHeaders are answered by cloudflared when it couldn't connect the stream to the origin
+	MuxFailedHeaders = []h2mux.Header{{Name: ":status", Value: "502"}}
+)
+
+// IsMuxRequest checks whether the client of a WebSocket request offered to multiplex streams over it
+func IsMuxRequest(req *http.Request) bool {
+	for _, value := range req.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(value, ",") {
+			if strings.TrimSpace(protocol) == MuxSubprotocol {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NewClientMuxer multiplexes streams over conn, a WebSocket connection whose MuxSubprotocol was accepted by
+// cloudflared. Streams can only be opened by the client.
+func NewClientMuxer(conn io.ReadWriteCloser, log *zerolog.Logger) (*h2mux.Muxer, error) {
+	rejectStream := h2mux.MuxedStreamFunc(func(*h2mux.MuxedStream) error { return nil })
+	return newMuxer(conn, true, rejectStream, log)
+}
+
+// NewServerMuxer multiplexes streams over conn, a WebSocket connection whose MuxSubprotocol was accepted, and serves
+// the streams opened by the client with handler
+func NewServerMuxer(conn *Conn, handler h2mux.MuxedStreamHandler, log *zerolog.Logger) (*h2mux.Muxer, error) {
+	return newMuxer(&muxServerConn{Conn: conn}, false, handler, log)
+}
+
+func newMuxer(conn io.ReadWriteCloser, isClient bool, handler h2mux.MuxedStreamHandler, log *zerolog.Logger) (*h2mux.Muxer, error) {
+	return h2mux.Handshake(conn, conn, h2mux.MuxerConfig{
+		Handler:           handler,
+		IsClient:          isClient,
+		Name:              MuxSubprotocol,
+		HeartbeatInterval: muxHeartbeatInterval,
+		MaxHeartbeats:     muxMaxHeartbeats,
+		Log:               log,
+	}, muxActiveStreams)
+}
+
+// muxServerConn is the io.ReadWriteCloser h2mux needs
+type muxServerConn struct {
+	*Conn
+}
+
+func (c *muxServerConn) Close() error {
+	c.Conn.Close()
+	return nil
+}
+
+// IsMuxStreamConnected checks whether cloudflared connected a stream opened with MuxRequestHeaders to the origin
+func IsMuxStreamConnected(stream *h2mux.MuxedStream) bool {
+	for _, header := range stream.Headers {
+		if header.Name == ":status" {
+			return header.Value == "200"
+		}
+	}
+	return false
+}
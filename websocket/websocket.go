@@ -9,6 +9,7 @@ import (
 	"io"
 	"net/http"
 	"runtime/debug"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -24,6 +25,27 @@ func IsWebSocketUpgrade(req *http.Request) bool {
 	return websocket.IsWebSocketUpgrade(req)
 }
 
+// PerMessageDeflate is the extension compressing WebSocket messages, see https://www.rfc-editor.org/rfc/rfc7692
+const PerMessageDeflate = "permessage-deflate"
+
+// RemoveExtension removes the offers or acceptance of the extension from the Sec-WebSocket-Extensions header, keeping
+// the other extensions
+func RemoveExtension(header http.Header, extension string) {
+	var kept []string
+	for _, value := range header.Values("Sec-WebSocket-Extensions") {
+		for _, offer := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(offer, ";")
+			if !strings.EqualFold(strings.TrimSpace(name), extension) && strings.TrimSpace(offer) != "" {
+				kept = append(kept, strings.TrimSpace(offer))
+			}
+		}
+	}
+	header.Del("Sec-WebSocket-Extensions")
+	if len(kept) > 0 {
+		header.Set("Sec-WebSocket-Extensions", strings.Join(kept, ", "))
+	}
+}
+
 // NewResponseHeader returns headers needed to return to origin for completing handshake
 func NewResponseHeader(req *http.Request) http.Header {
 	header := http.Header{}
@@ -33,25 +55,34 @@ func NewResponseHeader(req *http.Request) http.Header {
 	return header
 }
 
+// halfCloser is a connection that can signal the end of the data it sends while still receiving, like *net.TCPConn
+type halfCloser interface {
+	CloseWrite() error
+}
+
 type bidirectionalStreamStatus struct {
-	doneChan chan struct{}
+	// doneChan receives whether the end of the data of a direction that is done was passed on with CloseWrite
+	doneChan chan bool
 	anyDone  uint32
+	// halfClose is whether the end of the data of a direction is passed on with CloseWrite
+	halfClose bool
 }
 
 func newBiStreamStatus() *bidirectionalStreamStatus {
 	return &bidirectionalStreamStatus{
-		doneChan: make(chan struct{}, 2),
+		doneChan: make(chan bool, 2),
 		anyDone:  0,
 	}
 }
 
-func (s *bidirectionalStreamStatus) markUniStreamDone() {
+func (s *bidirectionalStreamStatus) markUniStreamDone(halfClosed bool) {
 	atomic.StoreUint32(&s.anyDone, 1)
-	s.doneChan <- struct{}{}
+	s.doneChan <- halfClosed
 }
 
-func (s *bidirectionalStreamStatus) waitAnyDone() {
-	<-s.doneChan
+// waitAnyDone returns whether the direction that is done was half-closed
+func (s *bidirectionalStreamStatus) waitAnyDone() bool {
+	return <-s.doneChan
 }
 func (s *bidirectionalStreamStatus) isAnyDone() bool {
 	return atomic.LoadUint32(&s.anyDone) > 0
@@ -68,6 +99,21 @@ func Stream(tunnelConn, originConn io.ReadWriter, log *zerolog.Logger) {
 	status.waitAnyDone()
 }
 
+// StreamHalfClose copies data to & from provided io.ReadWriters like Stream, except that once a side is done sending,
+// the end of its data is passed on with CloseWrite and the other side keeps sending until it's done too, like TCP
+// half-close. If the receiving side can't be half-closed, we are done like with Stream.
+func StreamHalfClose(tunnelConn, originConn io.ReadWriter, log *zerolog.Logger) {
+	status := newBiStreamStatus()
+	status.halfClose = true
+
+	go unidirectionalStream(tunnelConn, originConn, "origin->tunnel", status, log)
+	go unidirectionalStream(originConn, tunnelConn, "tunnel->origin", status, log)
+
+	if status.waitAnyDone() {
+		status.waitAnyDone()
+	}
+}
+
 func unidirectionalStream(dst io.Writer, src io.Reader, dir string, status *bidirectionalStreamStatus, log *zerolog.Logger) {
 	defer func() {
 		// The bidirectional streaming spawns 2 goroutines to stream each direction.
@@ -102,7 +148,15 @@ func unidirectionalStream(dst io.Writer, src io.Reader, dir string, status *bidi
 	if err != nil {
 		log.Debug().Msgf("%s copy: %v", dir, err)
 	}
-	status.markUniStreamDone()
+	halfClosed := false
+	if closer, ok := dst.(halfCloser); ok && status.halfClose && err == nil {
+		if err := closer.CloseWrite(); err != nil {
+			log.Debug().Msgf("%s close write: %v", dir, err)
+		} else {
+			halfClosed = true
+		}
+	}
+	status.markUniStreamDone(halfClosed)
 }
 
 // when set to true, enables logging of content copied to/from origin and tunnel
@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,3 +17,14 @@ const (
 func TestGenerateAcceptKey(t *testing.T) {
 	assert.Equal(t, testSecWebsocketAccept, generateAcceptKey(testSecWebsocketKey))
 }
+
+func TestRemoveExtension(t *testing.T) {
+	header := http.Header{}
+	header.Add("Sec-WebSocket-Extensions", "permessage-deflate; client_max_window_bits, x-webkit-deflate-frame")
+	header.Add("Sec-WebSocket-Extensions", "Permessage-Deflate")
+	RemoveExtension(header, PerMessageDeflate)
+	assert.Equal(t, []string{"x-webkit-deflate-frame"}, header.Values("Sec-WebSocket-Extensions"))
+
+	RemoveExtension(header, "x-webkit-deflate-frame")
+	assert.Empty(t, header.Values("Sec-WebSocket-Extensions"))
+}